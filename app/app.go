@@ -6,21 +6,29 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/config/configmanager"
 	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/buildkit"
 	"github.com/abiosoft/colima/environment/container/containerd"
 	"github.com/abiosoft/colima/environment/container/docker"
 	"github.com/abiosoft/colima/environment/container/incus"
 	"github.com/abiosoft/colima/environment/container/kubernetes"
+	"github.com/abiosoft/colima/environment/container/podman"
 	"github.com/abiosoft/colima/environment/host"
+	"github.com/abiosoft/colima/environment/vm/apple"
 	"github.com/abiosoft/colima/environment/vm/lima"
 	"github.com/abiosoft/colima/environment/vm/lima/limautil"
 	"github.com/abiosoft/colima/util"
+	"github.com/abiosoft/colima/util/portforward"
 	"github.com/abiosoft/colima/util/routing"
 	"github.com/docker/go-units"
 	log "github.com/sirupsen/logrus"
@@ -37,12 +45,38 @@ type App interface {
 	Runtime() (string, error)
 	Update() error
 	Kubernetes() (environment.Container, error)
+	UpgradeKubernetes(version string) error
+	FederateKubernetes(peer string, exportServices bool) error
+	MigrateKubernetes(to string, version string, namespaces []string) error
+	Contexts() ([]ProfileContext, error)
+	CreateContexts(all bool) error
+	UseContext(profile string) error
+	ListImages(kubernetes bool) error
+	SaveImages(images []string, file string, w io.Writer, kubernetes bool) error
+	LoadImages(file string, r io.Reader, kubernetes bool, alias string) error
+	PruneImages(all bool) error
+	ListVolumes() error
+	BackupVolume(volume string, file string, w io.Writer) error
+	RestoreVolume(volume string, file string, r io.Reader, force bool) error
+	CreateSnapshot(name string) error
+	RestoreSnapshot(name string) error
+	Snapshots() ([]Snapshot, error)
+	DeleteSnapshot(name string) error
+	Clone(to string) error
+	CompactDisk(zero bool) error
+	Pause() error
+	Resume() error
+	UpdateResources(cpus int, memory float32) error
 }
 
 var _ App = (*colimaApp)(nil)
 
 // New creates a new app.
 func New() (App, error) {
+	if currentVMType() == apple.Name {
+		return newAppleApp()
+	}
+
 	guest := lima.New(host.New())
 	if err := host.IsInstalled(guest); err != nil {
 		return nil, fmt.Errorf("dependency check failed for VM: %w", err)
@@ -72,7 +106,11 @@ func (c colimaApp) startWithRuntime(conf config.Config) ([]environment.Container
 	{
 		runtime := conf.Runtime
 		if kubernetesEnabled {
-			runtime += "+k3s"
+			distro := conf.Kubernetes.Distro
+			if distro == "" {
+				distro = kubernetes.K3s
+			}
+			runtime += "+" + distro
 		}
 		log.Println("runtime:", runtime)
 	}
@@ -86,6 +124,18 @@ func (c colimaApp) startWithRuntime(conf config.Config) ([]environment.Container
 		containers = append(containers, env)
 	}
 
+	// dedicated BuildKit builder, for docker and containerd
+	if conf.BuildKit.Enabled {
+		switch conf.Runtime {
+		case docker.Name, containerd.Name:
+			env, err := c.containerEnvironment(buildkit.Name)
+			if err != nil {
+				return nil, err
+			}
+			containers = append(containers, env)
+		}
+	}
+
 	// kubernetes should come after required runtime
 	if kubernetesEnabled {
 		env, err := c.containerEnvironment(kubernetes.Name)
@@ -117,11 +167,22 @@ func (c colimaApp) Start(conf config.Config) error {
 	// the order for start is:
 	//   vm start -> container runtime provision -> container runtime start
 
+	// remove routes left behind by crashed or deleted profiles
+	if _, err := routing.PruneRoutes(ctx); err != nil {
+		log.Warnf("Failed to prune orphaned network routes: %v", err)
+	}
+
 	// start vm
 	if err := c.guest.Start(ctx, conf); err != nil {
 		return fmt.Errorf("error starting vm: %w", err)
 	}
 
+	// the previous runtime is deprovisioned if the runtime is switched
+	imagesFile, err := c.switchRuntime(ctx, conf)
+	if err != nil {
+		return err
+	}
+
 	// provision and start container runtimes
 	for _, cont := range containers {
 		log := log.WithField("context", cont.Name())
@@ -133,6 +194,38 @@ func (c colimaApp) Start(conf config.Config) error {
 		if err := cont.Start(ctx); err != nil {
 			return fmt.Errorf("error starting %s: %w", cont.Name(), err)
 		}
+
+		// provision scripts after the runtime and after Kubernetes
+		mode := config.ProvisionModeAfterRuntime
+		if cont.Name() == kubernetes.Name {
+			mode = config.ProvisionModeAfterKubernetes
+		} else if cont.Name() != conf.Runtime {
+			continue
+		}
+		if err := c.runProvisionScripts(conf, mode); err != nil {
+			return err
+		}
+	}
+	if len(containers) == 0 {
+		if err := c.runProvisionScripts(conf, config.ProvisionModeAfterRuntime); err != nil {
+			return err
+		}
+	}
+
+	// images carried across from the previous runtime
+	if imagesFile != "" {
+		loadImages(ctx, containers, imagesFile)
+		_ = c.guest.RunQuiet("sudo", "rm", "-f", imagesFile)
+	}
+
+	// registry credentials of the host
+	if err := c.setupHostCredentials(conf); err != nil {
+		log.Warnln(fmt.Errorf("error setting up host registry credentials: %w", err))
+	}
+
+	// scheduled pruning of the images and build cache
+	if err := c.setupGC(conf); err != nil {
+		log.Warnln(fmt.Errorf("error setting up scheduled pruning: %w", err))
 	}
 
 	// persist the current runtime
@@ -145,14 +238,37 @@ func (c colimaApp) Start(conf config.Config) error {
 		log.Error(fmt.Errorf("error persisting kubernetes settings: %w", err))
 	}
 
+	// agent nodes of a multi-node Kubernetes cluster, excess nodes are deleted
+	if conf.Kubernetes.AgentNodes() > 0 || (!conf.Kubernetes.Agent() && len(nodeProfiles(config.CurrentProfile())) > 0) {
+		if err := startNodes(conf); err != nil {
+			return err
+		}
+	}
+
 	log.Println("done")
 
 	// Setup Pod network routing after VM and containers are started
-	if err := routing.SetupPodRoutingForProfile(ctx, conf); err != nil {
+	if err := routing.SetupPodRoutingForProfile(ctx, config.CurrentProfile().ID, conf); err != nil {
 		log.Warnf("Failed to setup Pod network routing: %v", err)
 		// Don't fail startup for routing issues
 	}
 
+	// networks of the VMs of the peer profiles
+	if err := routing.SetupPeers(ctx, config.CurrentProfile().ID, conf); err != nil {
+		log.Warnf("Failed to connect peer profiles: %v", err)
+	}
+
+	// the hosts file is updated by the daemon without a terminal for the sudo password
+	if conf.Network.HostsFile {
+		routing.EnsureHelper(ctx)
+	}
+
+	// forwards of a previous boot are no longer active
+	reverse := portforward.NewReverseForwarder(config.CurrentProfile().ID)
+	if err := reverse.Reset(portforward.ReverseFromConfig(conf.Network.ReversePortForwards)); err != nil {
+		log.Warnf("Failed to setup reverse port forwards: %v", err)
+	}
+
 	if err := generateSSHConfig(conf.SSHConfig); err != nil {
 		log.Trace("error generating ssh_config: %w", err)
 	}
@@ -163,13 +279,27 @@ func (c colimaApp) Stop(force bool) error {
 	ctx := context.Background()
 	log.Println("stopping", config.CurrentProfile().DisplayName)
 
+	// a paused VM cannot shut down
+	if limautil.Paused(config.CurrentProfile().ID) {
+		if _, err := limautil.QMP(config.CurrentProfile().ID, "cont", nil); err != nil {
+			log.Warnln(fmt.Errorf("error resuming paused VM: %w", err))
+		}
+	}
+
+	// agent nodes of a multi-node Kubernetes cluster
+	stopNodes(force)
+
 	// Get current config for routing cleanup
 	conf, err := configmanager.LoadFrom(config.CurrentProfile().File())
 	if err != nil {
 		log.Warnf("Failed to load config for routing cleanup: %v", err)
 	} else {
+		if err := routing.CleanupPeers(ctx, config.CurrentProfile().ID, conf); err != nil {
+			log.Warnf("Failed to disconnect peer profiles: %v", err)
+		}
+
 		// Cleanup Pod network routing before stopping containers
-		if err := routing.CleanupPodRoutingForProfile(ctx, conf); err != nil {
+		if err := routing.CleanupPodRoutingForProfile(ctx, config.CurrentProfile().ID, conf); err != nil {
 			log.Warnf("Failed to cleanup Pod network routing: %v", err)
 			// Don't fail shutdown for routing issues
 		}
@@ -219,6 +349,9 @@ func (c colimaApp) Delete() error {
 	ctx := context.Background()
 	log.Println("deleting", config.CurrentProfile().DisplayName)
 
+	// agent nodes of a multi-node Kubernetes cluster
+	deleteNodes()
+
 	// the order for teardown is:
 	//   container teardown -> vm teardown
 
@@ -254,6 +387,11 @@ func (c colimaApp) Delete() error {
 		return fmt.Errorf("error deleting configs: %w", err)
 	}
 
+	// routes are not cleaned up for a running VM, they are orphaned after teardown
+	if _, err := routing.PruneRoutes(ctx); err != nil {
+		log.Warnf("Failed to prune orphaned network routes: %v", err)
+	}
+
 	log.Println("done")
 
 	if err := generateSSHConfig(false); err != nil {
@@ -279,23 +417,10 @@ func (c colimaApp) SSH(args ...string) error {
 		if err != nil {
 			return err
 		}
-		pwd, err := util.CleanPath(workDir)
-		if err != nil {
-			return err
-		}
-		for _, m := range conf.MountsOrDefault() {
-			location := m.MountPoint
-			if location == "" {
-				location = m.Location
-			}
-			location, err := util.CleanPath(location)
-			if err != nil {
-				log.Trace(err)
-				continue
-			}
-			if strings.HasPrefix(pwd, location) {
-				return nil
-			}
+		// the directory is translated for the mount point of the mount
+		if dir, ok := conf.GuestPath(workDir); ok {
+			workDir = dir
+			return nil
 		}
 		return fmt.Errorf("not a mounted directory: %s", workDir)
 	}(); err != nil {
@@ -315,20 +440,36 @@ func (c colimaApp) SSH(args ...string) error {
 }
 
 type statusInfo struct {
-	DisplayName      string `json:"display_name"`
-	Driver           string `json:"driver"`
-	Arch             string `json:"arch"`
-	Runtime          string `json:"runtime"`
-	MountType        string `json:"mount_type"`
-	IPAddress        string `json:"ip_address,omitempty"`
-	DockerSocket     string `json:"docker_socket,omitempty"`
-	ContainerdSocket string `json:"containerd_socket,omitempty"`
-	BuildkitdSocket  string `json:"buildkitd_socket,omitempty"`
-	IncusSocket      string `json:"incus_socket,omitempty"`
-	Kubernetes       bool   `json:"kubernetes"`
-	CPU              int    `json:"cpu"`
-	Memory           int64  `json:"memory"`
-	Disk             int64  `json:"disk"`
+	DisplayName      string          `json:"display_name"`
+	Driver           string          `json:"driver"`
+	Arch             string          `json:"arch"`
+	Runtime          string          `json:"runtime"`
+	MountType        string          `json:"mount_type"`
+	IPAddress        string          `json:"ip_address,omitempty"`
+	IPv6Address      string          `json:"ipv6_address,omitempty"`
+	Networks         []networkStatus `json:"networks,omitempty"`
+	SOCKSProxy       string          `json:"socks_proxy,omitempty"`
+	VNC              string          `json:"vnc,omitempty"`
+	VNCPasswordFile  string          `json:"vnc_password_file,omitempty"`
+	DockerSocket     string          `json:"docker_socket,omitempty"`
+	ContainerdSocket string          `json:"containerd_socket,omitempty"`
+	BuildkitdSocket  string          `json:"buildkitd_socket,omitempty"`
+	BuildKitSocket   string          `json:"buildkit_socket,omitempty"`
+	IncusSocket      string          `json:"incus_socket,omitempty"`
+	PodmanSocket     string          `json:"podman_socket,omitempty"`
+	PodmanRootSocket string          `json:"podman_root_socket,omitempty"`
+	Kubernetes       bool            `json:"kubernetes"`
+	KubernetesNodes  []nodeStatus    `json:"kubernetes_nodes,omitempty"`
+	CPU              int             `json:"cpu"`
+	Memory           int64           `json:"memory"`
+	Disk             int64           `json:"disk"`
+}
+
+// networkStatus is the status of an additional network of the VM.
+type networkStatus struct {
+	Mode      string `json:"mode"`
+	Interface string `json:"interface"`
+	IPAddress string `json:"ip_address,omitempty"`
 }
 
 func (c colimaApp) getStatus() (status statusInfo, err error) {
@@ -336,6 +477,9 @@ func (c colimaApp) getStatus() (status statusInfo, err error) {
 	if !c.guest.Running(ctx) {
 		return status, fmt.Errorf("%s is not running", config.CurrentProfile().DisplayName)
 	}
+	if limautil.Paused(config.CurrentProfile().ID) {
+		return status, fmt.Errorf("%s is paused, resume with 'colima resume'", config.CurrentProfile().DisplayName)
+	}
 
 	currentRuntime, err := c.currentRuntime(ctx)
 	if err != nil {
@@ -355,6 +499,28 @@ func (c colimaApp) getStatus() (status statusInfo, err error) {
 	if ipAddress != "127.0.0.1" {
 		status.IPAddress = ipAddress
 	}
+	if conf.Network.IPv6 {
+		status.IPv6Address, _ = routing.GetVMIPv6(ctx, config.CurrentProfile().ID)
+	}
+	if conf.Network.Address {
+		for i, n := range conf.Network.Networks {
+			iface := limautil.NetworkInterface(i + 1)
+			status.Networks = append(status.Networks, networkStatus{
+				Mode:      n.Mode,
+				Interface: iface,
+				IPAddress: limautil.InterfaceIPAddress(config.CurrentProfile().ID, iface),
+			})
+		}
+	}
+	if port := conf.Network.SOCKSPort; port > 0 {
+		status.SOCKSProxy = "socks5://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	}
+	if conf.Display == "vnc" {
+		if vnc, err := limautil.VNCAddress(config.CurrentProfile().ID); err == nil {
+			status.VNC = vnc
+			status.VNCPasswordFile = limautil.VNCPasswordFile(config.CurrentProfile().ID)
+		}
+	}
 	if currentRuntime == docker.Name {
 		status.DockerSocket = "unix://" + docker.HostSocketFile()
 		status.ContainerdSocket = "unix://" + containerd.HostSocketFiles().Containerd
@@ -363,11 +529,21 @@ func (c colimaApp) getStatus() (status statusInfo, err error) {
 		status.ContainerdSocket = "unix://" + containerd.HostSocketFiles().Containerd
 		status.BuildkitdSocket = "unix://" + containerd.HostSocketFiles().Buildkitd
 	}
+	if b, err := c.containerEnvironment(buildkit.Name); err == nil && b.Running(ctx) {
+		status.BuildKitSocket = "unix://" + buildkit.HostSocketFile()
+	}
 	if currentRuntime == incus.Name {
 		status.IncusSocket = "unix://" + incus.HostSocketFile()
 	}
+	if currentRuntime == podman.Name {
+		status.PodmanSocket = "unix://" + podman.HostRootlessSocketFile()
+		status.PodmanRootSocket = "unix://" + podman.HostSocketFile()
+	}
 	if k, err := c.Kubernetes(); err == nil && k.Running(ctx) {
 		status.Kubernetes = true
+		if conf.Kubernetes.Nodes > 1 {
+			status.KubernetesNodes, _ = kubernetesNodes(c.guest)
+		}
 	}
 	if inst, err := limautil.Instance(); err == nil {
 		status.CPU = inst.CPU
@@ -399,6 +575,21 @@ func (c colimaApp) Status(extended bool, jsonOutput bool) error {
 		if status.IPAddress != "" {
 			log.Println("address:", status.IPAddress)
 		}
+		if status.IPv6Address != "" {
+			log.Println("address (IPv6):", status.IPv6Address)
+		}
+		for _, n := range status.Networks {
+			if n.IPAddress != "" {
+				log.Printf("address (%s, %s): %s", n.Interface, n.Mode, n.IPAddress)
+			}
+		}
+
+		if status.SOCKSProxy != "" {
+			log.Println("socks proxy:", status.SOCKSProxy)
+		}
+		if status.VNC != "" {
+			log.Printf("vnc: %s (password in %s)", status.VNC, status.VNCPasswordFile)
+		}
 
 		// docker socket
 		if status.DockerSocket != "" {
@@ -410,14 +601,35 @@ func (c colimaApp) Status(extended bool, jsonOutput bool) error {
 		if status.BuildkitdSocket != "" {
 			log.Println("buildkitd socket:", status.BuildkitdSocket)
 		}
+		if status.BuildKitSocket != "" {
+			log.Println("buildkit builder socket:", status.BuildKitSocket)
+		}
 		if status.IncusSocket != "" {
 			log.Println("incus socket:", status.IncusSocket)
 		}
+		if status.PodmanSocket != "" {
+			log.Println("podman socket:", status.PodmanSocket)
+			log.Println("podman root socket:", status.PodmanRootSocket)
+		}
 
 		// kubernetes
 		if status.Kubernetes {
 			log.Println("kubernetes: enabled")
 		}
+		if len(status.KubernetesNodes) > 0 {
+			ready := 0
+			for _, n := range status.KubernetesNodes {
+				if n.Status == "Ready" {
+					ready++
+				}
+			}
+			log.Printf("kubernetes nodes: %d (%d ready)", len(status.KubernetesNodes), ready)
+			if extended {
+				for _, n := range status.KubernetesNodes {
+					log.Printf("  %s: %s", n.Name, n.Status)
+				}
+			}
+		}
 
 		// additional details
 		if extended {
@@ -514,6 +726,11 @@ func (c colimaApp) currentContainerEnvironments(ctx context.Context) ([]environm
 		containers = append(containers, env)
 	}
 
+	// detect and add the BuildKit builder
+	if b, err := c.containerEnvironment(buildkit.Name); err == nil && b.Running(ctx) {
+		containers = append(containers, b)
+	}
+
 	// detect and add kubernetes
 	if k, err := c.containerEnvironment(kubernetes.Name); err == nil && k.Running(ctx) {
 		containers = append(containers, k)
@@ -542,6 +759,106 @@ func (c colimaApp) Kubernetes() (environment.Container, error) {
 	return c.containerEnvironment(kubernetes.Name)
 }
 
+// UpgradeKubernetes upgrades the Kubernetes cluster in place to the version or channel,
+// the configured version or channel if empty. The agent nodes are upgraded after the server.
+func (c colimaApp) UpgradeKubernetes(version string) error {
+	ctx := context.Background()
+	k, err := c.Kubernetes()
+	if err != nil {
+		return err
+	}
+	if !k.Running(ctx) {
+		return fmt.Errorf("%s is not running", kubernetes.Name)
+	}
+	u, ok := k.(kubernetes.Upgrader)
+	if !ok {
+		return fmt.Errorf("upgrade not supported for the %s runtime", kubernetes.Name)
+	}
+
+	upgraded, err := u.Upgrade(ctx, version)
+	if err != nil {
+		return err
+	}
+
+	// persist the version to prevent a downgrade on the next startup
+	if version != "" {
+		profile := config.CurrentProfile()
+		for _, file := range []string{profile.File(), profile.StateFile()} {
+			conf, err := configmanager.LoadFrom(file)
+			if err != nil {
+				continue
+			}
+			conf.Kubernetes.Version = version
+			if err := configmanager.SaveToFile(conf, file); err != nil {
+				log.Warnln(fmt.Errorf("error saving Kubernetes version: %w", err))
+			}
+		}
+	}
+
+	for _, p := range nodeProfiles(config.CurrentProfile()) {
+		log.Printf("upgrading Kubernetes node %s", p.ShortName)
+		if err := runNode(p, "kubernetes", "upgrade", upgraded); err != nil {
+			return fmt.Errorf("error upgrading Kubernetes node %s: %w", p.ShortName, err)
+		}
+	}
+
+	return nil
+}
+
+// FederateKubernetes connects the Kubernetes clusters of the profile and the running peer profile.
+// The peer is saved in network.peers of the config, the networks are routed on the next startups.
+func (c colimaApp) FederateKubernetes(peer string, exportServices bool) error {
+	ctx := context.Background()
+	profile := config.CurrentProfile()
+	peerProfile := config.ProfileFromName(peer)
+	if peerProfile.ID == profile.ID {
+		return fmt.Errorf("cannot federate profile '%s' with itself", profile.ShortName)
+	}
+
+	k, err := c.Kubernetes()
+	if err != nil {
+		return err
+	}
+	if !k.Running(ctx) {
+		return fmt.Errorf("%s is not running", kubernetes.Name)
+	}
+	conf, err := configmanager.LoadInstance()
+	if err != nil {
+		return fmt.Errorf("error retrieving config: %w", err)
+	}
+	if i, err := limautil.ProfileInstance(peerProfile.ID); err != nil || !i.Running() {
+		return fmt.Errorf("profile '%s' is not running", peerProfile.ShortName)
+	}
+	peerConf, err := configmanager.LoadFrom(peerProfile.StateFile())
+	if err != nil || !peerConf.Kubernetes.Enabled {
+		return fmt.Errorf("%s is not enabled for profile '%s'", kubernetes.Name, peerProfile.ShortName)
+	}
+	if conf.Kubernetes.Agent() || peerConf.Kubernetes.Agent() {
+		return fmt.Errorf("federation not supported for an agent node, use the server profile instead")
+	}
+
+	if !slices.ContainsFunc(conf.Network.Peers, func(p string) bool { return config.ProfileFromName(p).ID == peerProfile.ID }) {
+		conf.Network.Peers = append(conf.Network.Peers, peerProfile.ShortName)
+		for _, file := range []string{profile.File(), profile.StateFile()} {
+			fileConf, err := configmanager.LoadFrom(file)
+			if err != nil {
+				continue
+			}
+			fileConf.Network.Peers = append(fileConf.Network.Peers, peerProfile.ShortName)
+			if err := configmanager.SaveToFile(fileConf, file); err != nil {
+				log.Warnln(fmt.Errorf("error saving network peer: %w", err))
+			}
+		}
+	}
+
+	log.Printf("federating with profile '%s'", peerProfile.ShortName)
+	if err := routing.Federate(ctx, profile.ID, conf, peerProfile.ID, peerConf, exportServices); err != nil {
+		return err
+	}
+	log.Printf("kubeconfigs stored as Secrets in namespace colima-federation")
+	return nil
+}
+
 func (c colimaApp) Active() bool {
 	return c.guest.Running(context.Background())
 }
@@ -0,0 +1,317 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/host"
+	"github.com/abiosoft/colima/environment/vm/apple"
+	"github.com/abiosoft/colima/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// appleApp is the experimental app of the apple vmType. The containers are run by the
+// containerization framework of Apple instead of a runtime in a Linux VM, each container
+// in a lightweight VM of its own, and are managed with the container CLI.
+type appleApp struct {
+	system apple.System
+}
+
+var _ App = (*appleApp)(nil)
+
+// newAppleApp creates the app of the apple vmType.
+func newAppleApp() (App, error) {
+	if err := util.AssertAppleContainer(); err != nil {
+		return nil, fmt.Errorf("dependency check failed for VM: %w", err)
+	}
+	return &appleApp{system: apple.New(host.New())}, nil
+}
+
+// currentVMType returns the vmType of the config file of the current profile.
+func currentVMType() string {
+	conf, _ := configmanager.Load()
+	return conf.VMType
+}
+
+// errAppleNotSupported returns the error of a feature not available with the apple vmType.
+func errAppleNotSupported(feature string) error {
+	return fmt.Errorf("%s is not supported by the %s vmType", feature, apple.Name)
+}
+
+// appleActiveFile marks the profile as started, in the profile config dir. The system service
+// is shared by the profiles and is running while any profile is started.
+const appleActiveFile = "apple.active"
+
+// appleActiveProfiles returns the marker files of the started profiles other than the current.
+func appleActiveProfiles() []string {
+	dir := config.CurrentProfile().ConfigDir()
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(dir), "*", appleActiveFile))
+	return slices.DeleteFunc(files, func(f string) bool { return filepath.Dir(f) == dir })
+}
+
+func (a appleApp) Active() bool {
+	if _, err := os.Stat(filepath.Join(config.CurrentProfile().ConfigDir(), appleActiveFile)); err != nil {
+		return false
+	}
+	return a.system.Running()
+}
+
+func (a appleApp) Start(conf config.Config) error {
+	log.Println("starting", config.CurrentProfile().DisplayName)
+	log.Println("runtime:", apple.Runtime, "(experimental)")
+
+	if err := a.system.Start(); err != nil {
+		return fmt.Errorf("error starting %s system: %w", apple.Runtime, err)
+	}
+	if err := os.WriteFile(filepath.Join(config.CurrentProfile().ConfigDir(), appleActiveFile), nil, 0644); err != nil {
+		return fmt.Errorf("error saving profile state: %w", err)
+	}
+
+	log.Println("done")
+	log.Printf("manage the containers with the '%s' command e.g. '%s run --rm -it alpine'", apple.Runtime, apple.Runtime)
+	log.Printf("the containers with the label '%s=%s' are stopped with the profile", apple.ProfileLabel, config.CurrentProfile().ID)
+	return nil
+}
+
+// stop stops the containers of the profile, and the system service if no other profile is started.
+func (a appleApp) stop() error {
+	if !a.system.Running() {
+		return nil
+	}
+
+	profile := config.CurrentProfile()
+	ids, err := a.system.ProfileContainers(profile.ID)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		if err := a.system.Run(append([]string{"stop"}, ids...)...); err != nil {
+			return fmt.Errorf("error stopping containers: %w", err)
+		}
+	}
+	if err := os.Remove(filepath.Join(profile.ConfigDir(), appleActiveFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error saving profile state: %w", err)
+	}
+
+	if others := appleActiveProfiles(); len(others) > 0 {
+		log.Printf("%s system is in use by other profiles, not stopped", apple.Runtime)
+		return nil
+	}
+	if err := a.system.Stop(); err != nil {
+		return fmt.Errorf("error stopping %s system: %w", apple.Runtime, err)
+	}
+	return nil
+}
+
+func (a appleApp) Stop(force bool) error {
+	log.Println("stopping", config.CurrentProfile().DisplayName)
+	if err := a.stop(); err != nil {
+		return err
+	}
+	log.Println("done")
+	return nil
+}
+
+func (a appleApp) Delete() error {
+	log.Println("deleting", config.CurrentProfile().DisplayName)
+	if err := a.stop(); err != nil {
+		return err
+	}
+
+	// the containers and images are shared by the profiles, only the configs are deleted
+	if err := configmanager.Teardown(); err != nil {
+		return fmt.Errorf("error deleting configs: %w", err)
+	}
+	log.Printf("the containers and images are retained, remove them with the '%s' command", apple.Runtime)
+
+	log.Println("done")
+	return nil
+}
+
+func (a appleApp) SSH(args ...string) error {
+	return fmt.Errorf("%w, use '%s exec' for the containers", errAppleNotSupported("ssh"), apple.Runtime)
+}
+
+func (a appleApp) Status(extended bool, jsonOutput bool) error {
+	if !a.Active() {
+		return fmt.Errorf("%s is not running", config.CurrentProfile().DisplayName)
+	}
+
+	conf, _ := configmanager.Load()
+	status := statusInfo{
+		DisplayName: config.CurrentProfile().DisplayName,
+		Driver:      conf.DriverLabel(),
+		Arch:        string(environment.HostArch()),
+		Runtime:     apple.Runtime,
+	}
+
+	if jsonOutput {
+		if err := json.NewEncoder(os.Stdout).Encode(status); err != nil {
+			return fmt.Errorf("error encoding status as json: %w", err)
+		}
+		return nil
+	}
+
+	log.Println(status.DisplayName, "is running using", status.Driver)
+	log.Println("arch:", status.Arch)
+	log.Println("runtime:", status.Runtime)
+	if extended {
+		log.Println("version:", a.system.Version())
+	}
+	return nil
+}
+
+func (a appleApp) Version() error {
+	if !a.Active() {
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Println("runtime:", apple.Runtime)
+	fmt.Println("arch:", environment.HostArch())
+	fmt.Println(a.system.Version())
+	return nil
+}
+
+func (a appleApp) Runtime() (string, error) {
+	if !a.Active() {
+		return "", fmt.Errorf("%s is not running", config.CurrentProfile().DisplayName)
+	}
+	return apple.Runtime, nil
+}
+
+func (a appleApp) Update() error { return errAppleNotSupported("runtime update") }
+
+func (a appleApp) Kubernetes() (environment.Container, error) {
+	return nil, errAppleNotSupported("kubernetes")
+}
+
+func (a appleApp) UpgradeKubernetes(string) error { return errAppleNotSupported("kubernetes") }
+
+func (a appleApp) FederateKubernetes(string, bool) error { return errAppleNotSupported("kubernetes") }
+
+func (a appleApp) MigrateKubernetes(string, string, []string) error {
+	return errAppleNotSupported("kubernetes")
+}
+
+func (a appleApp) Contexts() ([]ProfileContext, error) {
+	return nil, errAppleNotSupported("docker context")
+}
+
+func (a appleApp) CreateContexts(bool) error { return errAppleNotSupported("docker context") }
+
+func (a appleApp) UseContext(string) error { return errAppleNotSupported("docker context") }
+
+func (a appleApp) ListImages(kubernetes bool) error {
+	if kubernetes {
+		return errAppleNotSupported("kubernetes")
+	}
+	return a.system.Run("image", "list")
+}
+
+// SaveImages saves the images to the archive file, or to w if file is empty via a temporary
+// file as the container CLI requires an output file.
+func (a appleApp) SaveImages(images []string, file string, w io.Writer, kubernetes bool) error {
+	if kubernetes {
+		return errAppleNotSupported("kubernetes")
+	}
+
+	output := file
+	if output == "" {
+		f, err := os.CreateTemp("", "colima-images-*.tar")
+		if err != nil {
+			return fmt.Errorf("error creating temporary file: %w", err)
+		}
+		_ = f.Close()
+		output = f.Name()
+		defer func() { _ = os.Remove(output) }()
+	}
+
+	if err := a.system.Run(append([]string{"image", "save", "--output", output}, images...)...); err != nil {
+		return fmt.Errorf("error saving images: %w", err)
+	}
+	if file != "" {
+		return nil
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		return fmt.Errorf("error opening archive file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// LoadImages loads the images of the archive file, or of r if file is empty via a temporary
+// file as the container CLI requires an input file.
+func (a appleApp) LoadImages(file string, r io.Reader, kubernetes bool, alias string) error {
+	if kubernetes {
+		return errAppleNotSupported("kubernetes")
+	}
+
+	if file == "" {
+		f, err := os.CreateTemp("", "colima-images-*.tar")
+		if err != nil {
+			return fmt.Errorf("error creating temporary file: %w", err)
+		}
+		defer func() { _ = os.Remove(f.Name()) }()
+		if _, err := io.Copy(f, r); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("error reading archive: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		file = f.Name()
+	}
+
+	if err := a.system.Run("image", "load", "--input", file); err != nil {
+		return fmt.Errorf("error loading images: %w", err)
+	}
+	return nil
+}
+
+// PruneImages removes the images not used by a container, the container CLI has no build cache
+// or dangling images to prune separately.
+func (a appleApp) PruneImages(bool) error {
+	log.Printf("pruning the images of %s", apple.Runtime)
+	return a.system.Run("image", "prune")
+}
+
+func (a appleApp) ListVolumes() error { return a.system.Run("volume", "list") }
+
+func (a appleApp) BackupVolume(string, string, io.Writer) error {
+	return errAppleNotSupported("volume backup")
+}
+
+func (a appleApp) RestoreVolume(string, string, io.Reader, bool) error {
+	return errAppleNotSupported("volume restore")
+}
+
+func (a appleApp) CreateSnapshot(string) error { return errAppleNotSupported("snapshots") }
+
+func (a appleApp) RestoreSnapshot(string) error { return errAppleNotSupported("snapshots") }
+
+func (a appleApp) Snapshots() ([]Snapshot, error) { return nil, errAppleNotSupported("snapshots") }
+
+func (a appleApp) DeleteSnapshot(string) error { return errAppleNotSupported("snapshots") }
+
+func (a appleApp) Clone(string) error { return errAppleNotSupported("clone") }
+
+func (a appleApp) CompactDisk(bool) error { return errAppleNotSupported("disk compaction") }
+
+func (a appleApp) Pause() error { return errAppleNotSupported("pause") }
+
+func (a appleApp) Resume() error { return errAppleNotSupported("resume") }
+
+func (a appleApp) UpdateResources(int, float32) error {
+	return errAppleNotSupported("resources update")
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	log "github.com/sirupsen/logrus"
+)
+
+// Clone copies the stopped VM of the current profile, including the additional disks, to a new
+// profile, with the identity of the new profile. The hostname, IP address, docker and kubeconfig
+// contexts of the new profile are assigned on startup. The hostname is kept with Kubernetes, the
+// node of the cluster state is named after the hostname.
+func (c colimaApp) Clone(to string) error {
+	source := config.CurrentProfile()
+	target := config.ProfileFromName(to)
+	if target.ID == source.ID {
+		return fmt.Errorf("cannot clone profile '%s' to itself", source.ShortName)
+	}
+	if err := c.assertStopped(); err != nil {
+		return err
+	}
+	if nodeExists(target) {
+		return fmt.Errorf("profile '%s' already exists, delete with 'colima delete %s' and try again", target.ShortName, target.ShortName)
+	}
+
+	conf, err := configmanager.Load()
+	if err != nil {
+		return fmt.Errorf("error retrieving config: %w", err)
+	}
+	state, err := configmanager.LoadInstance()
+	if err != nil {
+		return fmt.Errorf("error retrieving config: %w", err)
+	}
+
+	log.Printf("cloning %s to profile '%s'", source.DisplayName, target.ShortName)
+	if err := os.MkdirAll(target.LimaInstanceDir(), 0755); err != nil {
+		return fmt.Errorf("error preparing to copy VM: %w", err)
+	}
+	// the lima config is regenerated for the new profile on startup
+	files := []string{"basedisk", filepath.Base(limautil.ColimaDiffDisk(source.ID)), filepath.Base(source.LimaFile())}
+	for _, file := range files {
+		if err := copyFile(filepath.Join(source.LimaInstanceDir(), file), filepath.Join(target.LimaInstanceDir(), file)); err != nil {
+			_ = os.RemoveAll(target.LimaInstanceDir())
+			return fmt.Errorf("error copying VM: %w", err)
+		}
+	}
+
+	// the additional disks are not in the instance dir
+	var disks []string
+	removeCopies := func() {
+		_ = os.RemoveAll(target.LimaInstanceDir())
+		for _, disk := range disks {
+			_ = os.RemoveAll(filepath.Dir(disk))
+		}
+	}
+	for _, d := range state.Disks {
+		src := limautil.DiskFile(limautil.DiskName(source.ID, d.Name))
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		dst := limautil.DiskFile(limautil.DiskName(target.ID, d.Name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			removeCopies()
+			return fmt.Errorf("error preparing to copy disk '%s': %w", d.Name, err)
+		}
+		disks = append(disks, dst)
+		if err := copyFile(src, dst); err != nil {
+			removeCopies()
+			return fmt.Errorf("error copying disk '%s': %w", d.Name, err)
+		}
+	}
+
+	for file, conf := range map[string]config.Config{
+		target.File():      cloneConfig(conf, source),
+		target.StateFile(): cloneConfig(state, source),
+	} {
+		if err := configmanager.SaveToFile(conf, file); err != nil {
+			removeCopies()
+			return fmt.Errorf("error saving config of profile '%s': %w", target.ShortName, err)
+		}
+	}
+
+	log.Printf("cloned to profile '%s', start with 'colima start %s'", target.ShortName, target.ShortName)
+	return nil
+}
+
+// cloneConfig returns the config of the clone of the source profile from the config conf.
+// The settings of the identity of the source are reset for the defaults of the new profile,
+// and the settings binding host ports and connecting other profiles, the host ports are in use
+// by the source profile. The hostname is kept with Kubernetes for the node name of the cluster.
+func cloneConfig(conf config.Config, source *config.Profile) config.Config {
+	switch {
+	case conf.Kubernetes.Enabled && conf.Hostname == "":
+		conf.Hostname = source.ID
+	case !conf.Kubernetes.Enabled && conf.Hostname == source.ID:
+		conf.Hostname = ""
+	}
+	// fixed context names would collide with the contexts of the source
+	if !strings.Contains(conf.DockerContext, "{{") {
+		conf.DockerContext = ""
+	}
+	if !strings.Contains(conf.Kubernetes.Kubeconfig.Context, "{{") {
+		conf.Kubernetes.Kubeconfig.Context = ""
+	}
+	conf.Kubernetes.Kubeconfig.File = ""
+	conf.Kubernetes.LoadBalancer.HostPorts = false
+	conf.Network.StaticIP = nil
+	conf.Network.SOCKSPort = 0
+	conf.Network.Peers = nil
+	return conf
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/environment/host"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	log "github.com/sirupsen/logrus"
+)
+
+// ProfileContext is the docker context and kubeconfig context of a profile.
+type ProfileContext struct {
+	Profile    string `json:"profile"`
+	Status     string `json:"status"`
+	Docker     string `json:"docker,omitempty"`     // docker context, if the runtime is docker
+	Kubernetes string `json:"kubernetes,omitempty"` // kubeconfig context, if Kubernetes is enabled
+	Kubeconfig string `json:"kubeconfig,omitempty"` // standalone kubeconfig, if any
+}
+
+// profileContext returns the contexts of the profile with the config conf.
+func profileContext(p *config.Profile, conf config.Config) (pc ProfileContext, err error) {
+	pc.Profile = p.ShortName
+	if conf.Runtime == docker.Name {
+		if pc.Docker, err = conf.DockerContextName(p); err != nil {
+			return pc, err
+		}
+	}
+	if conf.Kubernetes.Enabled {
+		if pc.Kubernetes, err = conf.Kubernetes.Kubeconfig.ContextName(p); err != nil {
+			return pc, err
+		}
+		pc.Kubeconfig = conf.Kubernetes.Kubeconfig.FilePath()
+	}
+	return pc, nil
+}
+
+// Contexts returns the docker and kubeconfig contexts of the profiles, the Kubernetes agent
+// nodes are excluded.
+func (c colimaApp) Contexts() ([]ProfileContext, error) {
+	instances, err := limautil.Instances()
+	if err != nil {
+		return nil, err
+	}
+
+	var contexts []ProfileContext
+	for _, i := range instances {
+		conf, err := i.Config()
+		if err != nil || conf.Kubernetes.Agent() {
+			continue
+		}
+		pc, err := profileContext(config.ProfileFromName(i.Name), conf)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving contexts of profile '%s': %w", i.Name, err)
+		}
+		pc.Status = i.Status
+		contexts = append(contexts, pc)
+	}
+	return contexts, nil
+}
+
+// CreateContexts creates the docker contexts of the profiles with the docker runtime,
+// including the stopped profiles. Only the current profile if not all.
+func (c colimaApp) CreateContexts(all bool) error {
+	contexts, err := c.Contexts()
+	if err != nil {
+		return err
+	}
+
+	h := host.New()
+	found := false
+	for _, pc := range contexts {
+		p := config.ProfileFromName(pc.Profile)
+		if !all && p.ID != config.CurrentProfile().ID {
+			continue
+		}
+		found = true
+		if pc.Docker == "" {
+			if !all {
+				return fmt.Errorf("profile '%s' does not use the %s runtime", p.ShortName, docker.Name)
+			}
+			continue
+		}
+		if err := docker.CreateContext(h, p, pc.Docker); err != nil {
+			return fmt.Errorf("error creating docker context of profile '%s': %w", p.ShortName, err)
+		}
+		log.Printf("docker context '%s' created for profile '%s'", pc.Docker, p.ShortName)
+	}
+	if !found && !all {
+		return fmt.Errorf("profile '%s' does not exist", config.CurrentProfile().ShortName)
+	}
+	return nil
+}
+
+// UseContext switches the docker context and the kubeconfig context to the profile.
+func (c colimaApp) UseContext(profile string) error {
+	p := config.ProfileFromName(profile)
+	if !nodeExists(p) {
+		return fmt.Errorf("profile '%s' does not exist", p.ShortName)
+	}
+	conf, err := configmanager.LoadFrom(p.StateFile())
+	if err != nil {
+		return fmt.Errorf("error retrieving config of profile '%s': %w", p.ShortName, err)
+	}
+	if conf.Kubernetes.Agent() {
+		return fmt.Errorf("profile '%s' is a Kubernetes agent node, use the server profile '%s' instead", p.ShortName, conf.Kubernetes.Server)
+	}
+	pc, err := profileContext(p, conf)
+	if err != nil {
+		return err
+	}
+	if pc.Docker == "" && pc.Kubernetes == "" {
+		return fmt.Errorf("profile '%s' has neither the %s runtime nor Kubernetes enabled", p.ShortName, docker.Name)
+	}
+
+	h := host.New()
+	if pc.Docker != "" {
+		// the context is missing if the profile is stopped
+		if err := docker.CreateContext(h, p, pc.Docker); err != nil {
+			return fmt.Errorf("error creating docker context: %w", err)
+		}
+		if err := docker.UseContext(h, pc.Docker); err != nil {
+			return fmt.Errorf("error switching docker context to '%s': %w", pc.Docker, err)
+		}
+	}
+
+	if pc.Kubernetes != "" {
+		args := []string{"kubectl", "config", "use-context", pc.Kubernetes}
+		if pc.Kubeconfig != "" {
+			args = append(args, "--kubeconfig", pc.Kubeconfig)
+		}
+		if err := h.RunQuiet(args...); err != nil {
+			return fmt.Errorf("error switching kubeconfig context to '%s': %w", pc.Kubernetes, err)
+		}
+		if pc.Kubeconfig != "" {
+			log.Printf("the cluster has a standalone kubeconfig, run 'export KUBECONFIG=%s' to use it", pc.Kubeconfig)
+		}
+	}
+
+	log.Printf("switched to profile '%s'", p.ShortName)
+	return nil
+}
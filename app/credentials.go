@@ -0,0 +1,101 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process/credentials"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// credentialHelper is the docker credential helper in the VM, retrieving the registry
+	// credentials from the credential helpers of the host.
+	credentialHelper     = "colima"
+	credentialHelperFile = "/usr/local/bin/docker-credential-" + credentialHelper
+)
+
+// credentialHelperScript is the docker credential helper in the VM. The credentials are
+// retrieved from the forwarded socket, store and erase are done on the host.
+const credentialHelperScript = `#!/bin/sh
+# generated by colima, retrieves the registry credentials from the credential helpers of the host
+socket=` + credentials.GuestSocket + `
+case "$1" in
+get) curl -sf --unix-socket "$socket" --data-binary @- http://localhost/get || { echo "credentials not found in native keychain"; exit 1; } ;;
+list) curl -sf --unix-socket "$socket" http://localhost/list || echo "{}" ;;
+*) echo "the registry credentials are managed on the host, use 'docker login' on the host"; exit 1 ;;
+esac
+`
+
+// setupHostCredentials writes the credential helper and sets it as the credential store of the
+// docker configs of the user and root, if enabled. The credential store is unset otherwise.
+func (c colimaApp) setupHostCredentials(conf config.Config) error {
+	home, err := c.guest.RunOutput("sh", "-c", "echo $HOME")
+	if err != nil {
+		return fmt.Errorf("error retrieving home dir: %w", err)
+	}
+	files := []string{filepath.Join(home, ".docker", "config.json"), "/root/.docker/config.json"}
+
+	if conf.HostCredentials {
+		if err := c.guest.Write(credentialHelperFile, []byte(credentialHelperScript)); err != nil {
+			return fmt.Errorf("error writing %s: %w", credentialHelperFile, err)
+		}
+		if err := c.guest.RunQuiet("sudo", "chmod", "755", credentialHelperFile); err != nil {
+			return err
+		}
+	}
+
+	for i, file := range files {
+		if err := c.setCredsStore(file, conf.HostCredentials); err != nil {
+			return err
+		}
+		// the config of the user is owned by the user
+		if i == 0 && conf.HostCredentials {
+			if err := c.guest.Run("sh", "-c", `sudo chown -R "$(id -u):$(id -g)" "$(dirname `+file+`)"`); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setCredsStore sets the credential helper as the credential store of the docker config file,
+// or unsets it if not enabled. The other settings of the docker config are retained, a
+// credential store not set by colima is not replaced.
+func (c colimaApp) setCredsStore(file string, enabled bool) error {
+	dockerConf := map[string]any{}
+	exists := c.guest.RunQuiet("sudo", "test", "-e", file) == nil
+	if exists {
+		b, err := c.guest.RunOutput("sudo", "cat", file)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file, err)
+		}
+		if err := json.Unmarshal([]byte(b), &dockerConf); err != nil {
+			return fmt.Errorf("error parsing %s: %w", file, err)
+		}
+	}
+
+	store, _ := dockerConf["credsStore"].(string)
+	switch {
+	case enabled && store == credentialHelper, !enabled && store != credentialHelper:
+		return nil
+	case enabled && store != "":
+		log.Warnf("%s has the credential store '%s', the registry credentials of the host are not used", file, store)
+		return nil
+	case enabled:
+		dockerConf["credsStore"] = credentialHelper
+	default:
+		delete(dockerConf, "credsStore")
+	}
+
+	b, err := json.MarshalIndent(dockerConf, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", file, err)
+	}
+	if err := c.guest.Write(file, b); err != nil {
+		return err
+	}
+	return c.guest.Run("sudo", "chmod", "600", file)
+}
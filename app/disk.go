@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/host"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util"
+	"github.com/docker/go-units"
+	log "github.com/sirupsen/logrus"
+)
+
+// zeroFillScript fills the free space of the root filesystem with zeros, for the zeroed blocks
+// to be discarded by the compaction of disks without discard support. dd fails once the disk
+// is full.
+const zeroFillScript = `dd if=/dev/zero of=/var/lib/colima-zero bs=1M status=none || true
+sync
+rm -f /var/lib/colima-zero
+sync
+`
+
+// CompactDisk reclaims the free space of the disk of the VM on the host. The free space is
+// trimmed in the VM, and zero-filled if zero. The qcow2 disk of qemu is compacted with the VM
+// restarted.
+func (c colimaApp) CompactDisk(zero bool) error {
+	p := config.CurrentProfile()
+	if !c.guest.Running(context.Background()) {
+		return fmt.Errorf("%s is not running", p.DisplayName)
+	}
+	disk := limautil.ColimaDiffDisk(p.ID)
+	before, err := allocatedSize(disk)
+	if err != nil {
+		return err
+	}
+
+	if zero {
+		log.Println("zero-filling the free space of the disk")
+		if err := c.guest.RunQuiet("sudo", "sh", "-c", zeroFillScript); err != nil {
+			return fmt.Errorf("error zero-filling disk: %w", err)
+		}
+	}
+	log.Println("trimming the free space of the disk")
+	if err := c.guest.RunQuiet("sudo", "fstrim", "--all"); err != nil {
+		return fmt.Errorf("error trimming disk: %w", err)
+	}
+
+	qcow2, err := limautil.IsQcow2(disk)
+	if err != nil {
+		return err
+	}
+	if qcow2 {
+		if err := util.AssertQemuImg(); err != nil {
+			return err
+		}
+		log.Println("compacting the disk, the VM is restarted")
+		if err := runNode(p, "stop"); err != nil {
+			return fmt.Errorf("error stopping %s: %w", p.DisplayName, err)
+		}
+		compactErr := compactQcow2(disk)
+		if err := runNode(p, "start"); err != nil {
+			return fmt.Errorf("error starting %s: %w", p.DisplayName, err)
+		}
+		if compactErr != nil {
+			return compactErr
+		}
+	}
+
+	after, err := allocatedSize(disk)
+	if err != nil {
+		return err
+	}
+	log.Printf("disk compacted, %s reclaimed", units.BytesSize(float64(max(before-after, 0))))
+	return nil
+}
+
+// compactQcow2 rewrites the qcow2 disk without the unallocated and zero clusters, on the same
+// backing image.
+func compactQcow2(disk string) error {
+	out, err := host.New().RunOutput("qemu-img", "info", "--output=json", disk)
+	if err != nil {
+		return fmt.Errorf("error retrieving disk info: %w", err)
+	}
+	var info struct {
+		BackingFile       string `json:"backing-filename"`
+		BackingFileFormat string `json:"backing-filename-format"`
+	}
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		return fmt.Errorf("error retrieving disk info: %w", err)
+	}
+
+	tmp := disk + ".compact"
+	args := []string{"qemu-img", "convert", "-O", "qcow2"}
+	if info.BackingFile != "" {
+		args = append(args, "-B", info.BackingFile)
+		if info.BackingFileFormat != "" {
+			args = append(args, "-F", info.BackingFileFormat)
+		}
+	}
+	args = append(args, disk, tmp)
+	if err := host.New().RunQuiet(args...); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("error compacting disk: %w", err)
+	}
+	return os.Rename(tmp, disk)
+}
+
+// allocatedSize returns the size of the blocks allocated on the host for the sparse file.
+func allocatedSize(file string) (int64, error) {
+	out, err := host.New().RunOutput("du", "-k", file)
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving disk usage: %w", err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("error retrieving disk usage: empty output")
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving disk usage: %w", err)
+	}
+	return size * 1024, nil
+}
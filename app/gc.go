@@ -0,0 +1,175 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/environment/container/podman"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// gcScriptFile is the pruning script in the VM, run by the gc timer.
+	gcScriptFile = "/usr/local/bin/colima-gc"
+	// gcService is the systemd service and timer of the scheduled pruning in the VM.
+	gcService       = "colima-gc"
+	gcServiceFile   = "/etc/systemd/system/" + gcService + ".service"
+	gcTimerFile     = "/etc/systemd/system/" + gcService + ".timer"
+	gcDefaultPeriod = "daily"
+)
+
+// gcRuntime is the pruning of the images and build cache of a runtime.
+type gcRuntime struct {
+	cli        string // client of the runtime
+	dataDir    string // dir of the images, for the disk usage
+	buildPrune string // args pruning the dangling build cache
+	buildAll   string // args pruning all the unused build cache
+}
+
+var gcRuntimes = map[string]gcRuntime{
+	docker.Name:     {cli: "docker", dataDir: "/var/lib/docker", buildPrune: "builder prune -f", buildAll: "builder prune -af"},
+	containerd.Name: {cli: "nerdctl", dataDir: "/var/lib/containerd", buildPrune: "builder prune -f", buildAll: "builder prune -af"},
+	podman.Name:     {cli: "podman", dataDir: "/var/lib/containers", buildPrune: "image prune -f --build-cache", buildAll: "image prune -af --build-cache"},
+}
+
+// gcScript returns the script pruning the images and build cache of the runtime, run as root.
+// The dangling images and build cache are pruned, the unused images older than the maximum
+// age, and all the unused images above the maximum disk usage or if all.
+// The client of the rootless containerd and rootless podman is run as the user.
+func gcScript(runtime string, user string, conf config.Config, all bool) string {
+	r := gcRuntimes[runtime]
+	cli := r.cli
+	switch {
+	case runtime == containerd.Name && conf.Rootless:
+		cli = fmt.Sprintf(`sudo -u %[1]s XDG_RUNTIME_DIR=/run/user/$(id -u %[1]s) nerdctl`, user)
+	case runtime == podman.Name && !conf.Podman.Rootful:
+		cli = fmt.Sprintf(`sudo -u %[1]s XDG_RUNTIME_DIR=/run/user/$(id -u %[1]s) podman`, user)
+		r.dataDir = fmt.Sprintf(`"$(getent passwd %s | cut -d: -f6)/.local/share/containers"`, user)
+	}
+
+	lines := []string{
+		"#!/bin/sh",
+		"# generated by colima, prunes the unused images and build cache of " + runtime,
+		"cli() { " + cli + ` "$@"; }`,
+		"cli image prune -f",
+		"cli " + r.buildPrune,
+	}
+	if age := conf.GC.MaxAge; age != "" {
+		lines = append(lines, "cli image prune -af --filter until="+age)
+		if runtime == docker.Name {
+			lines = append(lines, "cli builder prune -f --filter until="+age)
+		}
+	}
+
+	full := []string{"cli image prune -af", "cli " + r.buildAll}
+	switch {
+	case all:
+		lines = append(lines, full...)
+	case conf.GC.MaxDiskUsage > 0:
+		lines = append(lines,
+			fmt.Sprintf("usage=$(df --output=pcent %s | tail -n 1 | tr -dc 0-9)", r.dataDir),
+			fmt.Sprintf(`if [ "${usage:-0}" -ge %d ]; then`, conf.GC.MaxDiskUsage),
+		)
+		for _, l := range full {
+			lines = append(lines, "  "+l)
+		}
+		lines = append(lines, "fi")
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// gcUnits returns the systemd service and timer of the scheduled pruning.
+func gcUnits(schedule string) (service, timer string) {
+	if schedule == "" {
+		schedule = gcDefaultPeriod
+	}
+	service = `[Unit]
+Description=colima pruning of the images and build cache
+
+[Service]
+Type=oneshot
+ExecStart=` + gcScriptFile + "\n"
+
+	timer = `[Unit]
+Description=colima scheduled pruning of the images and build cache
+
+[Timer]
+OnCalendar=` + schedule + `
+Persistent=true
+RandomizedDelaySec=5m
+
+[Install]
+WantedBy=timers.target
+`
+	return service, timer
+}
+
+// setupGC writes the pruning script of the runtime and enables the timer of the scheduled
+// pruning, if enabled. The timer is disabled otherwise.
+func (c colimaApp) setupGC(conf config.Config) error {
+	if _, ok := gcRuntimes[conf.Runtime]; !ok {
+		return c.disableGC()
+	}
+	if !conf.GC.Enabled {
+		return c.disableGC()
+	}
+
+	user, err := c.guest.User()
+	if err != nil {
+		return fmt.Errorf("error retrieving user: %w", err)
+	}
+	service, timer := gcUnits(conf.GC.Schedule)
+	for _, f := range []struct{ file, body string }{
+		{file: gcScriptFile, body: gcScript(conf.Runtime, user, conf, false)},
+		{file: gcServiceFile, body: service},
+		{file: gcTimerFile, body: timer},
+	} {
+		if err := c.guest.Write(f.file, []byte(f.body)); err != nil {
+			return fmt.Errorf("error writing %s: %w", f.file, err)
+		}
+	}
+	if err := c.guest.RunQuiet("sudo", "chmod", "755", gcScriptFile); err != nil {
+		return err
+	}
+	if err := c.guest.RunQuiet("sudo", "systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	return c.guest.RunQuiet("sudo", "systemctl", "enable", "--now", gcService+".timer")
+}
+
+// disableGC disables the timer of the scheduled pruning, if previously enabled.
+func (c colimaApp) disableGC() error {
+	if c.guest.RunQuiet("test", "-e", gcTimerFile) != nil {
+		return nil
+	}
+	return c.guest.RunQuiet("sudo", "systemctl", "disable", "--now", gcService+".timer")
+}
+
+// PruneImages prunes the dangling images and the build cache of the runtime in the VM, with the
+// limits of the gc config. All the unused images and build cache are pruned if all.
+func (c colimaApp) PruneImages(all bool) error {
+	runtime, _, err := c.imageCommand(false)
+	if err != nil {
+		return err
+	}
+	if _, ok := gcRuntimes[runtime]; !ok {
+		return fmt.Errorf("pruning not supported for the %s runtime", runtime)
+	}
+	conf, err := configmanager.LoadInstance()
+	if err != nil {
+		return fmt.Errorf("error retrieving config: %w", err)
+	}
+	user, err := c.guest.User()
+	if err != nil {
+		return fmt.Errorf("error retrieving user: %w", err)
+	}
+
+	log.Printf("pruning the images and build cache of %s", runtime)
+	script := gcScript(runtime, user, conf, all)
+	return c.guest.RunWith(strings.NewReader(script), os.Stdout, "sudo", "sh", "-s")
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/environment/container/incus"
+	"github.com/abiosoft/colima/environment/container/podman"
+	"github.com/abiosoft/colima/environment/host"
+)
+
+// kubernetesNamespace is the containerd namespace of the images of Kubernetes.
+const kubernetesNamespace = "k8s.io"
+
+// imageCommand returns the command in the VM for the images of the runtime, of the images of
+// Kubernetes if kubernetes. Empty for incus, the images of incus are managed from the host.
+func (c colimaApp) imageCommand(kubernetes bool) (runtime string, command []string, err error) {
+	runtime, err = c.currentRuntime(context.Background())
+	if err != nil {
+		return "", nil, err
+	}
+	conf, err := configmanager.LoadInstance()
+	if err != nil {
+		return "", nil, fmt.Errorf("error retrieving config: %w", err)
+	}
+
+	if kubernetes {
+		if !conf.Kubernetes.Enabled {
+			return "", nil, fmt.Errorf("kubernetes is not enabled")
+		}
+		if runtime != containerd.Name {
+			return "", nil, fmt.Errorf("--kubernetes is only supported by the %s runtime, the cluster of the %s runtime uses the %s images", containerd.Name, runtime, runtime)
+		}
+	}
+
+	switch runtime {
+	case docker.Name:
+		return runtime, []string{"sudo", "docker"}, nil
+	case containerd.Name:
+		command = containerd.Nerdctl(conf.Rootless)
+		if kubernetes {
+			command = append(command, "--namespace", kubernetesNamespace)
+		}
+		return runtime, command, nil
+	case podman.Name:
+		if conf.Podman.Rootful {
+			return runtime, []string{"sudo", "podman"}, nil
+		}
+		return runtime, []string{"podman"}, nil
+	case incus.Name:
+		return runtime, nil, nil
+	}
+	return "", nil, fmt.Errorf("images not supported for the %s runtime", runtime)
+}
+
+// ListImages lists the images of the runtime, or of Kubernetes if kubernetes.
+func (c colimaApp) ListImages(kubernetes bool) error {
+	runtime, command, err := c.imageCommand(kubernetes)
+	if err != nil {
+		return err
+	}
+	if runtime == incus.Name {
+		return host.New().RunInteractive("incus", "image", "list", config.CurrentProfile().ID+":")
+	}
+	return c.guest.RunWith(nil, os.Stdout, slices.Concat(command, []string{"images"})...)
+}
+
+// SaveImages saves the images of the runtime, or of Kubernetes if kubernetes, to the archive
+// file on the host. The archive is written to w if file is empty.
+// For incus, the image is exported to the file, as the base name of the files of a split image.
+func (c colimaApp) SaveImages(images []string, file string, w io.Writer, kubernetes bool) error {
+	runtime, command, err := c.imageCommand(kubernetes)
+	if err != nil {
+		return err
+	}
+
+	if runtime == incus.Name {
+		if len(images) != 1 || file == "" {
+			return fmt.Errorf("the %s runtime requires a single image and --output", incus.Name)
+		}
+		return host.New().Run("incus", "image", "export", config.CurrentProfile().ID+":"+images[0], file)
+	}
+
+	args := slices.Concat(command, []string{"save"})
+	if runtime == podman.Name && len(images) > 1 {
+		args = append(args, "--multi-image-archive")
+	}
+	args = append(args, images...)
+
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return fmt.Errorf("error creating archive file: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		w = f
+	}
+	if err := c.guest.RunWith(nil, w, args...); err != nil {
+		if file != "" {
+			_ = os.Remove(file)
+		}
+		return fmt.Errorf("error saving images: %w", err)
+	}
+	return nil
+}
+
+// LoadImages loads the images of the archive file on the host into the runtime, or into
+// Kubernetes if kubernetes. The archive is read from r if file is empty.
+// For incus, the image is imported with the alias, if set.
+func (c colimaApp) LoadImages(file string, r io.Reader, kubernetes bool, alias string) error {
+	runtime, command, err := c.imageCommand(kubernetes)
+	if err != nil {
+		return err
+	}
+
+	if runtime == incus.Name {
+		if file == "" {
+			return fmt.Errorf("the %s runtime requires --input", incus.Name)
+		}
+		args := []string{"incus", "image", "import", file, config.CurrentProfile().ID + ":"}
+		if alias != "" {
+			args = append(args, "--alias", alias)
+		}
+		return host.New().Run(args...)
+	}
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("error opening archive file: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	if err := c.guest.RunWith(r, os.Stdout, slices.Concat(command, []string{"load"})...); err != nil {
+		return fmt.Errorf("error loading images: %w", err)
+	}
+	return nil
+}
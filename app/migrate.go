@@ -0,0 +1,172 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/container/kubernetes"
+	"github.com/abiosoft/colima/environment/host"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	log "github.com/sirupsen/logrus"
+)
+
+// MigrateKubernetes copies the Kubernetes cluster to a new profile and upgrades the copy to the
+// version, the configured version if empty, for a blue/green upgrade. Only the namespaces, if
+// any, are kept in addition to the system namespaces. The kubeconfig context is switched to the
+// new profile, the cluster of the current profile is kept for a rollback.
+func (c colimaApp) MigrateKubernetes(to string, version string, namespaces []string) error {
+	ctx := context.Background()
+	source := config.CurrentProfile()
+	target := config.ProfileFromName(to)
+	if target.ID == source.ID {
+		return fmt.Errorf("cannot migrate profile '%s' to itself", source.ShortName)
+	}
+	if nodeExists(target) {
+		return fmt.Errorf("profile '%s' already exists, migrate to a new profile", target.ShortName)
+	}
+
+	k, err := c.Kubernetes()
+	if err != nil {
+		return err
+	}
+	if !k.Running(ctx) {
+		return fmt.Errorf("%s is not running", kubernetes.Name)
+	}
+	conf, err := configmanager.LoadInstance()
+	if err != nil {
+		return fmt.Errorf("error retrieving config: %w", err)
+	}
+	if conf.Kubernetes.Agent() || conf.Kubernetes.AgentNodes() > 0 {
+		return fmt.Errorf("migration not supported for a multi-node cluster")
+	}
+	b, ok := k.(kubernetes.BackupRestorer)
+	if !ok {
+		return fmt.Errorf("migration not supported for %s", k.Name())
+	}
+	i, ok := k.(kubernetes.Informer)
+	if !ok {
+		return fmt.Errorf("migration not supported for %s", k.Name())
+	}
+	info, err := i.Info(ctx)
+	if err != nil {
+		return err
+	}
+	if version == "" {
+		version = conf.Kubernetes.Version
+	}
+
+	// the cluster state is copied with a backup of the current cluster
+	f, err := os.CreateTemp("", "colima-migrate-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("error creating backup file: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	log.Printf("backing up the cluster of profile '%s'", source.ShortName)
+	backupErr := b.Backup(ctx, f)
+	// the cluster is stopped for the backup, the current profile is kept running for a rollback
+	if !k.Running(ctx) {
+		if err := k.Start(ctx); err != nil {
+			log.Warnln(fmt.Errorf("error starting the cluster of profile '%s': %w", source.ShortName, err))
+		}
+	}
+	if backupErr != nil {
+		_ = f.Close()
+		return fmt.Errorf("error backing up cluster: %w", backupErr)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error saving backup: %w", err)
+	}
+
+	// the new profile is created at the current version for the backup to be restored
+	targetConf := migrationConfig(conf, source, info.Version)
+	if err := configmanager.SaveToFile(targetConf, target.File()); err != nil {
+		return fmt.Errorf("error saving config of profile '%s': %w", target.ShortName, err)
+	}
+	steps := []struct {
+		stage string
+		args  []string
+	}{
+		{stage: "creating profile '%s'", args: []string{"start"}},
+		{stage: "restoring the cluster in profile '%s'", args: []string{"kubernetes", "restore", f.Name()}},
+		{stage: "upgrading the cluster of profile '%s'", args: []string{"kubernetes", "upgrade", version}},
+	}
+	for _, s := range steps {
+		log.Printf(s.stage, target.ShortName)
+		if err := runNode(target, s.args...); err != nil {
+			return fmt.Errorf("error migrating to profile '%s': %w, delete it with 'colima delete --profile %s'",
+				target.ShortName, err, target.ShortName)
+		}
+	}
+
+	if len(namespaces) > 0 {
+		if err := pruneNamespaces(target, namespaces); err != nil {
+			return err
+		}
+	}
+
+	// the kubeconfig context of the new profile is set as the current context
+	name, err := targetConf.Kubernetes.Kubeconfig.ContextName(target)
+	if err != nil {
+		return err
+	}
+	if err := host.New().RunQuiet("kubectl", "config", "use-context", name); err != nil {
+		return fmt.Errorf("error switching kubeconfig context to '%s': %w", name, err)
+	}
+
+	sourceName, _ := conf.Kubernetes.Kubeconfig.ContextName(source)
+	log.Printf("migrated to profile '%s', kubeconfig context switched to '%s'", target.ShortName, name)
+	log.Printf("roll back with 'kubectl config use-context %s', or delete profile '%s' once no longer needed",
+		sourceName, source.ShortName)
+	return nil
+}
+
+// migrationConfig returns the config of the new profile of a migration from the config conf
+// of the source profile, at the version. The settings binding host ports and connecting other
+// profiles are reset, the host ports are in use by the current profile.
+func migrationConfig(conf config.Config, source *config.Profile, version string) config.Config {
+	// the node of the restored cluster state is named after the hostname of the source
+	if conf.Hostname == "" {
+		conf.Hostname = source.ID
+	}
+	conf.Kubernetes.Version = version
+	conf.Kubernetes.LoadBalancer.HostPorts = false
+	conf.Kubernetes.Kubeconfig.File = ""
+	setCurrentContext := false
+	conf.Kubernetes.Kubeconfig.SetCurrentContext = &setCurrentContext
+	conf.Network.SOCKSPort = 0
+	conf.Network.Peers = nil
+	return conf
+}
+
+// pruneNamespaces deletes the namespaces of the cluster of the profile, except the namespaces
+// to keep and the system namespaces.
+func pruneNamespaces(p *config.Profile, keep []string) error {
+	guest := host.New().WithEnv(limautil.EnvLimaHome+"="+config.LimaDir(), "LIMA_INSTANCE="+p.ID)
+	out, err := guest.RunOutput("lima", "kubectl", "get", "namespaces", "--output", "jsonpath={.items[*].metadata.name}")
+	if err != nil {
+		return fmt.Errorf("error retrieving namespaces of profile '%s': %w", p.ShortName, err)
+	}
+
+	args := []string{"lima", "kubectl", "delete", "namespace", "--wait=false"}
+	var deleted []string
+	for _, ns := range strings.Fields(out) {
+		if kubernetes.SystemNamespace(ns) || slices.Contains(keep, ns) {
+			continue
+		}
+		deleted = append(deleted, ns)
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+
+	log.Printf("deleting namespaces %s from profile '%s'", strings.Join(deleted, ", "), p.ShortName)
+	if err := guest.RunQuiet(append(args, deleted...)...); err != nil {
+		return fmt.Errorf("error deleting namespaces of profile '%s': %w", p.ShortName, err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util/osutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// nodeProfile returns the profile of the Kubernetes agent node at index of the server profile.
+// Indexes start at 1, the server is the node 0.
+func nodeProfile(server *config.Profile, index int) *config.Profile {
+	return config.ProfileFromName(fmt.Sprintf("%s-node-%d", server.ShortName, index))
+}
+
+// nodeProfiles returns the profiles of the existing Kubernetes agent nodes of the server profile.
+func nodeProfiles(server *config.Profile) []*config.Profile {
+	var profiles []*config.Profile
+	for i := 1; i < config.MaxNodes; i++ {
+		if p := nodeProfile(server, i); nodeExists(p) {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles
+}
+
+// nodeExists returns if the VM of the agent node profile exists.
+func nodeExists(p *config.Profile) bool {
+	_, err := os.Stat(p.LimaInstanceDir())
+	return err == nil
+}
+
+// nodeConfig returns the config of an agent node of the server profile with the config conf.
+// The agent nodes share the resources and runtime of the server, without its network
+// and host integrations.
+func nodeConfig(conf config.Config, server *config.Profile) config.Config {
+	activate := false
+	node := config.Config{
+		CPU:             conf.CPU,
+		Memory:          conf.Memory,
+		Disk:            conf.Disk,
+		Arch:            conf.Arch,
+		DiskImage:       conf.DiskImage,
+		DiskImageDigest: conf.DiskImageDigest,
+		Distro:          conf.Distro,
+		Binfmt:          conf.Binfmt,
+		CPUType:         conf.CPUType,
+		VMType:          conf.VMType,
+		VZRosetta:       conf.VZRosetta,
+		Runtime:         conf.Runtime,
+		MountType:       conf.MountType,
+		Mounts:          conf.Mounts,
+		Env:             conf.Env,
+		Docker:          conf.Docker,
+		Proxy:           conf.Proxy,
+		ForwardAgent:    conf.ForwardAgent,
+
+		ActivateRuntime: &activate,
+		Registries:      conf.Registries,
+		Kubernetes: config.Kubernetes{
+			Enabled: true,
+			Version: conf.Kubernetes.Version,
+			CNI:     conf.Kubernetes.CNI,
+			Airgap:  conf.Kubernetes.Airgap,
+			Server:  server.ShortName,
+
+			KubeletArgs: conf.Kubernetes.KubeletArgs,
+			Registries:  conf.Kubernetes.Registries,
+		},
+		Network: config.Network{
+			DNSResolvers: conf.Network.DNSResolvers,
+			DNSHosts:     conf.Network.DNSHosts,
+			DNSSearch:    conf.Network.DNSSearch,
+			DNSDomains:   conf.Network.DNSDomains,
+			MTU:          conf.Network.MTU,
+		},
+	}
+	return node
+}
+
+// runNode runs the colima command for the agent node profile.
+func runNode(p *config.Profile, args ...string) error {
+	args = append(args, "--profile", p.ShortName)
+	cmd := cli.CommandInteractive(osutil.Executable(), args...)
+	return cmd.Run()
+}
+
+// startNodes creates and starts the Kubernetes agent nodes of the current profile, and
+// deletes the agent nodes in excess of the configured number of nodes.
+func startNodes(conf config.Config) error {
+	server := config.CurrentProfile()
+
+	for i := conf.Kubernetes.AgentNodes() + 1; i < config.MaxNodes; i++ {
+		if p := nodeProfile(server, i); nodeExists(p) {
+			log.Printf("deleting Kubernetes node %s", p.ShortName)
+			if err := runNode(p, "delete", "--force"); err != nil {
+				log.Warnln(fmt.Errorf("error deleting Kubernetes node %s: %w", p.ShortName, err))
+			}
+		}
+	}
+
+	for i := 1; i <= conf.Kubernetes.AgentNodes(); i++ {
+		p := nodeProfile(server, i)
+		if err := configmanager.SaveToFile(nodeConfig(conf, server), p.File()); err != nil {
+			return fmt.Errorf("error saving config of Kubernetes node %s: %w", p.ShortName, err)
+		}
+		log.Printf("starting Kubernetes node %s", p.ShortName)
+		if err := runNode(p, "start"); err != nil {
+			return fmt.Errorf("error starting Kubernetes node %s: %w", p.ShortName, err)
+		}
+	}
+	return nil
+}
+
+// stopNodes stops the Kubernetes agent nodes of the current profile.
+func stopNodes(force bool) {
+	for _, p := range nodeProfiles(config.CurrentProfile()) {
+		log.Printf("stopping Kubernetes node %s", p.ShortName)
+		args := []string{"stop"}
+		if force {
+			args = append(args, "--force")
+		}
+		if err := runNode(p, args...); err != nil {
+			log.Warnln(fmt.Errorf("error stopping Kubernetes node %s: %w", p.ShortName, err))
+		}
+	}
+}
+
+// deleteNodes deletes the Kubernetes agent nodes of the current profile.
+func deleteNodes() {
+	for _, p := range nodeProfiles(config.CurrentProfile()) {
+		log.Printf("deleting Kubernetes node %s", p.ShortName)
+		if err := runNode(p, "delete", "--force"); err != nil {
+			log.Warnln(fmt.Errorf("error deleting Kubernetes node %s: %w", p.ShortName, err))
+		}
+	}
+}
+
+// nodeStatus is the status of a Kubernetes node.
+type nodeStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// kubernetesNodes retrieves the status of the nodes of the Kubernetes cluster in the guest.
+func kubernetesNodes(guest environment.GuestActions) ([]nodeStatus, error) {
+	out, err := guest.RunOutput("kubectl", "get", "nodes", "--no-headers")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving Kubernetes nodes: %w", err)
+	}
+	return parseKubernetesNodes(out), nil
+}
+
+// parseKubernetesNodes parses the output of `kubectl get nodes --no-headers`.
+func parseKubernetesNodes(output string) []nodeStatus {
+	var nodes []nodeStatus
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			nodes = append(nodes, nodeStatus{Name: fields[0], Status: fields[1]})
+		}
+	}
+	return nodes
+}
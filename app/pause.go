@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	log "github.com/sirupsen/logrus"
+)
+
+// assertPausable returns an error if the VM cannot be paused, only the qemu VM is paused over
+// QMP, lima does not expose the suspension of the vz VM.
+func (c colimaApp) assertPausable() error {
+	p := config.CurrentProfile()
+	if !c.guest.Running(context.Background()) {
+		return fmt.Errorf("%s is not running", p.DisplayName)
+	}
+	conf, err := configmanager.LoadInstance()
+	if err != nil {
+		return fmt.Errorf("error retrieving config: %w", err)
+	}
+	if conf.VMType != "qemu" {
+		return fmt.Errorf("pause is only supported with the qemu vmType")
+	}
+	return nil
+}
+
+// Pause pauses the vCPUs of the VM, the memory is kept for an instant resume.
+func (c colimaApp) Pause() error {
+	if err := c.assertPausable(); err != nil {
+		return err
+	}
+	p := config.CurrentProfile()
+	if limautil.Paused(p.ID) {
+		log.Println(p.DisplayName, "is already paused")
+		return nil
+	}
+
+	if _, err := limautil.QMP(p.ID, "stop", nil); err != nil {
+		return fmt.Errorf("error pausing %s: %w", p.DisplayName, err)
+	}
+	log.Println(p.DisplayName, "paused, resume with 'colima resume'")
+	return nil
+}
+
+// Resume resumes the paused VM.
+func (c colimaApp) Resume() error {
+	if err := c.assertPausable(); err != nil {
+		return err
+	}
+	p := config.CurrentProfile()
+	if !limautil.Paused(p.ID) {
+		log.Println(p.DisplayName, "is not paused")
+		return nil
+	}
+
+	if _, err := limautil.QMP(p.ID, "cont", nil); err != nil {
+		return fmt.Errorf("error resuming %s: %w", p.DisplayName, err)
+	}
+
+	// the clock of the VM stood still while paused
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := c.guest.RunQuiet("sudo", "date", "-u", "-s", "@"+now); err != nil {
+		log.Warnln(fmt.Errorf("error syncing the clock of the VM: %w", err))
+	}
+	log.Println(p.DisplayName, "resumed")
+	return nil
+}
@@ -0,0 +1,22 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/abiosoft/colima/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// runProvisionScripts runs the provision scripts of the mode as root, in the order of the config.
+func (c colimaApp) runProvisionScripts(conf config.Config, mode string) error {
+	for i, p := range conf.Provision {
+		if p.Mode != mode {
+			continue
+		}
+		log.Printf("running %s provision script", mode)
+		if err := c.guest.Run("sudo", "sh", "-c", p.Script); err != nil {
+			return fmt.Errorf("error running provision script %d (%s): %w", i+1, mode, err)
+		}
+	}
+	return nil
+}
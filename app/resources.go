@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	log "github.com/sirupsen/logrus"
+)
+
+// UpdateResources updates the CPUs and the memory in GiB of the VM, unchanged if zero. The
+// CPUs of the running VM are adjusted without a restart, up to the CPUs at startup, the VM is
+// restarted otherwise.
+func (c colimaApp) UpdateResources(cpus int, memory float32) error {
+	p := config.CurrentProfile()
+	conf, err := configmanager.Load()
+	if err != nil {
+		return fmt.Errorf("error retrieving config: %w", err)
+	}
+	if cpus > 0 {
+		conf.CPU = cpus
+	}
+	if memory > 0 {
+		conf.Memory = memory
+	}
+	if err := configmanager.ValidateConfig(conf); err != nil {
+		return err
+	}
+	if err := configmanager.SaveToFile(conf, p.File()); err != nil {
+		return fmt.Errorf("error saving config: %w", err)
+	}
+
+	if !c.guest.Running(context.Background()) {
+		log.Printf("resources updated, applied on the next startup of %s", p.DisplayName)
+		return nil
+	}
+
+	err = c.adjustResources(conf)
+	if err == nil {
+		log.Printf("resources of %s updated to %d CPUs and %.1fGiB memory", p.DisplayName, conf.CPU, conf.Memory)
+		return nil
+	}
+	log.Debugln(fmt.Errorf("resources cannot be adjusted without a restart: %w", err))
+
+	log.Printf("restarting %s to apply the resources", p.DisplayName)
+	if err := runNode(p, "restart"); err != nil {
+		return fmt.Errorf("error restarting %s: %w", p.DisplayName, err)
+	}
+	return nil
+}
+
+// adjustResources adjusts the resources of the running VM to the config conf without a
+// restart, by taking the CPUs of the VM online or offline.
+func (c colimaApp) adjustResources(conf config.Config) error {
+	state, err := configmanager.LoadInstance()
+	if err != nil {
+		return fmt.Errorf("error retrieving config: %w", err)
+	}
+	if err := liveAdjustable(state, conf); err != nil {
+		return err
+	}
+
+	if err := c.guest.RunQuiet("sudo", "sh", "-c", onlineCPUsScript(conf.CPU)); err != nil {
+		return fmt.Errorf("error adjusting CPUs: %w", err)
+	}
+	return nil
+}
+
+// liveAdjustable returns an error if the resources of the config conf cannot be applied to the
+// running VM started with the config state. Only the CPUs can be adjusted, up to the CPUs at
+// startup; the memory is fixed at startup as the VM has no memory balloon device.
+func liveAdjustable(state, conf config.Config) error {
+	if conf.Memory != state.Memory {
+		return fmt.Errorf("memory cannot be changed without a restart")
+	}
+	if conf.CPU > state.CPU {
+		return fmt.Errorf("CPUs cannot exceed the %d CPUs at startup", state.CPU)
+	}
+	return nil
+}
+
+// onlineCPUsScript returns the script that keeps the first n CPUs of the VM online and takes
+// the others offline.
+func onlineCPUsScript(n int) string {
+	return fmt.Sprintf(`for f in /sys/devices/system/cpu/cpu[0-9]*/online; do
+  i="${f%%/online}"; i="${i##*/cpu}"
+  if [ "$i" -lt %d ]; then echo 1; else echo 0; fi > "$f"
+done`, n)
+}
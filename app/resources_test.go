@@ -0,0 +1,42 @@
+package app
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+)
+
+func Test_liveAdjustable(t *testing.T) {
+	state := config.Config{CPU: 4, Memory: 8}
+
+	tests := []struct {
+		name    string
+		conf    config.Config
+		wantErr bool
+	}{
+		{name: "unchanged", conf: config.Config{CPU: 4, Memory: 8}},
+		{name: "fewer CPUs", conf: config.Config{CPU: 2, Memory: 8}},
+		{name: "more CPUs than at startup", conf: config.Config{CPU: 6, Memory: 8}, wantErr: true},
+		{name: "less memory", conf: config.Config{CPU: 4, Memory: 4}, wantErr: true},
+		{name: "more memory", conf: config.Config{CPU: 2, Memory: 12}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := liveAdjustable(state, tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("liveAdjustable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_onlineCPUsScript(t *testing.T) {
+	script := onlineCPUsScript(2)
+	if !strings.Contains(script, `-lt 2 ]`) {
+		t.Errorf("onlineCPUsScript() = %s, want the CPU count", script)
+	}
+	if err := exec.Command("sh", "-n", "-c", script).Run(); err != nil {
+		t.Errorf("onlineCPUsScript() is not a valid shell script: %v", err)
+	}
+}
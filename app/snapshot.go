@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// Snapshot is a snapshot of the disk of the VM.
+type Snapshot struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"` // size of the disk, the blocks are shared with the VM on copy-on-write filesystems
+}
+
+var snapshotNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// snapshotDir returns the dir of the snapshot of the current profile.
+func snapshotDir(name string) (string, error) {
+	if !snapshotNameRegex.MatchString(name) {
+		return "", fmt.Errorf("invalid snapshot name '%s', must be alphanumeric with '.', '_' or '-'", name)
+	}
+	return filepath.Join(limautil.ColimaSnapshotsDir(config.CurrentProfile().ID), name), nil
+}
+
+// snapshotFiles returns the files of the VM in a snapshot, the disk and the config of the
+// runtime on the disk.
+func snapshotFiles() []string {
+	p := config.CurrentProfile()
+	return []string{limautil.ColimaDiffDisk(p.ID), p.StateFile()}
+}
+
+// assertStopped returns an error if the VM is running, the disk can only be copied when the
+// filesystem is consistent.
+func (c colimaApp) assertStopped() error {
+	if !nodeExists(config.CurrentProfile()) {
+		return fmt.Errorf("%s does not exist", config.CurrentProfile().DisplayName)
+	}
+	if c.guest.Running(context.Background()) {
+		return fmt.Errorf("%s is running, stop with 'colima stop' and try again", config.CurrentProfile().DisplayName)
+	}
+	return nil
+}
+
+// copyFile copies the file src to dst, as a clone sharing the blocks on copy-on-write
+// filesystems e.g. APFS and btrfs for an instant copy.
+func copyFile(src, dst string) error {
+	tmp := dst + ".tmp"
+	args := []string{"--reflink=auto", src, tmp}
+	if util.MacOS() {
+		// clonefile is not supported outside of APFS, fallback to a full copy
+		clone := cli.Command("cp", "-c", src, tmp)
+		clone.Stderr = nil
+		if err := clone.Run(); err == nil {
+			return os.Rename(tmp, dst)
+		}
+		args = []string{src, tmp}
+	}
+	if err := cli.Command("cp", args...).Run(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("error copying '%s': %w", src, err)
+	}
+	return os.Rename(tmp, dst)
+}
+
+// CreateSnapshot creates a snapshot of the disk of the stopped VM.
+func (c colimaApp) CreateSnapshot(name string) error {
+	if err := c.assertStopped(); err != nil {
+		return err
+	}
+	dir, err := snapshotDir(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("snapshot '%s' already exists", name)
+	}
+
+	log.Printf("creating snapshot %s", name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating snapshot dir: %w", err)
+	}
+	for _, file := range snapshotFiles() {
+		if err := copyFile(file, filepath.Join(dir, filepath.Base(file))); err != nil {
+			_ = os.RemoveAll(dir)
+			return fmt.Errorf("error creating snapshot '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// RestoreSnapshot restores the disk of the stopped VM to the snapshot. The changes after the
+// snapshot are discarded.
+func (c colimaApp) RestoreSnapshot(name string) error {
+	if err := c.assertStopped(); err != nil {
+		return err
+	}
+	dir, err := snapshotDir(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("snapshot '%s' does not exist", name)
+	}
+
+	log.Printf("restoring snapshot %s", name)
+	for _, file := range snapshotFiles() {
+		if err := copyFile(filepath.Join(dir, filepath.Base(file)), file); err != nil {
+			return fmt.Errorf("error restoring snapshot '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Snapshots returns the snapshots of the VM, the oldest first.
+func (c colimaApp) Snapshots() ([]Snapshot, error) {
+	entries, err := os.ReadDir(limautil.ColimaSnapshotsDir(config.CurrentProfile().ID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error retrieving snapshots: %w", err)
+	}
+
+	var snapshots []Snapshot
+	disk := filepath.Base(limautil.ColimaDiffDisk(config.CurrentProfile().ID))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(limautil.ColimaSnapshotsDir(config.CurrentProfile().ID), entry.Name())
+		stat, err := os.Stat(filepath.Join(dir, disk))
+		if err != nil {
+			continue
+		}
+		// the dir is not modified after the snapshot is created, unlike the copied disk
+		// that may retain the timestamp of the source
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{Name: entry.Name(), Created: info.ModTime(), Size: stat.Size()})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Created.Before(snapshots[j].Created) })
+	return snapshots, nil
+}
+
+// DeleteSnapshot deletes the snapshot.
+func (c colimaApp) DeleteSnapshot(name string) error {
+	dir, err := snapshotDir(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("snapshot '%s' does not exist", name)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("error deleting snapshot '%s': %w", name, err)
+	}
+	return nil
+}
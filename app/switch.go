@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	log "github.com/sirupsen/logrus"
+)
+
+// migrateImagesFile is the archive in the VM of the images carried across a runtime switch.
+const migrateImagesFile = "/var/tmp/colima-migrate-images.tar"
+
+// switchRuntime deprovisions the runtime of the previous startup if the runtime is switched,
+// the VM disk is preserved. The images are saved for the new runtime if conf.MigrateImages,
+// the archive of the images is returned, empty if none.
+func (c colimaApp) switchRuntime(ctx context.Context, conf config.Config) (string, error) {
+	previous := c.guest.Get(environment.ContainerRuntimeKey)
+	if previous == "" || previous == conf.Runtime {
+		return "", nil
+	}
+	log.Printf("switching runtime from %s to %s", previous, conf.Runtime)
+	if environment.IsNoneRuntime(previous) {
+		return "", nil
+	}
+
+	// the runtime and addons of the previous startup
+	containers, err := c.currentContainerEnvironments(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving runtime %s: %w", previous, err)
+	}
+	if len(containers) == 0 {
+		return "", nil
+	}
+	runtime, ok := containers[0].(environment.Deprovisioner)
+	if !ok {
+		return "", fmt.Errorf("switching from the %s runtime is not supported, delete with 'colima delete' instead", previous)
+	}
+
+	// the images are saved before the runtime is stopped
+	var imagesFile string
+	if conf.MigrateImages {
+		m, ok := containers[0].(environment.ImageMigrator)
+		if !ok {
+			return "", fmt.Errorf("migrating the images of the %s runtime is not supported", previous)
+		}
+		log.Printf("saving the images of %s", previous)
+		saved, err := m.SaveImages(ctx, migrateImagesFile)
+		if err != nil {
+			return "", fmt.Errorf("error saving the images of %s: %w", previous, err)
+		}
+		if saved {
+			imagesFile = migrateImagesFile
+		}
+	}
+
+	// the addons are stopped first, in reverse of start
+	for i := len(containers) - 1; i > 0; i-- {
+		if err := containers[i].Stop(ctx); err != nil {
+			log.Warnln(fmt.Errorf("error stopping %s: %w", containers[i].Name(), err))
+		}
+	}
+	log.Printf("deprovisioning %s", previous)
+	if err := runtime.Deprovision(ctx); err != nil {
+		return "", fmt.Errorf("error deprovisioning %s: %w", previous, err)
+	}
+
+	return imagesFile, nil
+}
+
+// loadImages loads the images carried across a runtime switch into the runtime, the first
+// of the containers. Failures are not fatal, the images can be rebuilt or pulled.
+func loadImages(ctx context.Context, containers []environment.Container, file string) {
+	if len(containers) == 0 {
+		return
+	}
+	m, ok := containers[0].(environment.ImageMigrator)
+	if !ok {
+		log.Warnln(fmt.Errorf("migrating images to the %s runtime is not supported", containers[0].Name()))
+		return
+	}
+	log.Printf("loading the images into %s", containers[0].Name())
+	if err := m.LoadImages(ctx, file); err != nil {
+		log.Warnln(err)
+	}
+}
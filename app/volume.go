@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/environment/container/podman"
+	log "github.com/sirupsen/logrus"
+)
+
+// volumeCommand returns the command in the VM for the volumes of the runtime.
+func (c colimaApp) volumeCommand() (command []string, err error) {
+	runtime, err := c.currentRuntime(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	switch runtime {
+	case docker.Name, containerd.Name, podman.Name:
+	default:
+		return nil, fmt.Errorf("volumes not supported for the %s runtime", runtime)
+	}
+
+	_, command, err = c.imageCommand(false)
+	return command, err
+}
+
+// volumeMountpoint returns the dir of the volume in the VM.
+func (c colimaApp) volumeMountpoint(command []string, volume string) (string, error) {
+	out, err := c.guest.RunOutput(slices.Concat(command, []string{"volume", "inspect", "--format", "{{.Mountpoint}}", volume})...)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving volume '%s': %w", volume, err)
+	}
+	mountpoint := strings.TrimSpace(out)
+	if mountpoint == "" {
+		return "", fmt.Errorf("error retrieving volume '%s': empty mountpoint", volume)
+	}
+	return mountpoint, nil
+}
+
+// ListVolumes lists the volumes of the runtime.
+func (c colimaApp) ListVolumes() error {
+	command, err := c.volumeCommand()
+	if err != nil {
+		return err
+	}
+	return c.guest.RunWith(nil, os.Stdout, slices.Concat(command, []string{"volume", "ls"})...)
+}
+
+// BackupVolume writes the contents of the volume as a gzipped tar archive to the file on the
+// host, or to w if file is empty. The archive is created in the VM and streamed over ssh.
+func (c colimaApp) BackupVolume(volume string, file string, w io.Writer) error {
+	command, err := c.volumeCommand()
+	if err != nil {
+		return err
+	}
+	mountpoint, err := c.volumeMountpoint(command, volume)
+	if err != nil {
+		return err
+	}
+
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return fmt.Errorf("error creating archive file: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		w = f
+	}
+
+	log.Printf("backing up volume %s", volume)
+	if err := c.guest.RunWith(nil, w, "sudo", "tar", "-C", mountpoint, "-czf", "-", "."); err != nil {
+		if file != "" {
+			_ = os.Remove(file)
+		}
+		return fmt.Errorf("error backing up volume '%s': %w", volume, err)
+	}
+	return nil
+}
+
+// RestoreVolume extracts the gzipped tar archive of the file on the host, or of r if file is
+// empty, into the volume. The volume is created if missing, an existing volume must be empty
+// unless force.
+func (c colimaApp) RestoreVolume(volume string, file string, r io.Reader, force bool) error {
+	command, err := c.volumeCommand()
+	if err != nil {
+		return err
+	}
+
+	if c.guest.RunQuiet(slices.Concat(command, []string{"volume", "inspect", volume})...) != nil {
+		if err := c.guest.RunQuiet(slices.Concat(command, []string{"volume", "create", volume})...); err != nil {
+			return fmt.Errorf("error creating volume '%s': %w", volume, err)
+		}
+	}
+	mountpoint, err := c.volumeMountpoint(command, volume)
+	if err != nil {
+		return err
+	}
+	if !force {
+		out, err := c.guest.RunOutput("sudo", "find", mountpoint, "-mindepth", "1", "-maxdepth", "1")
+		if err != nil {
+			return fmt.Errorf("error checking volume '%s': %w", volume, err)
+		}
+		if strings.TrimSpace(out) != "" {
+			return fmt.Errorf("volume '%s' is not empty, use --force to restore over the contents", volume)
+		}
+	}
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("error opening archive file: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+
+	log.Printf("restoring volume %s", volume)
+	if err := c.guest.RunWith(r, os.Stdout, "sudo", "tar", "-C", mountpoint, "-xzpf", "-"); err != nil {
+		return fmt.Errorf("error restoring volume '%s': %w", volume, err)
+	}
+	return nil
+}
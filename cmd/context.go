@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/spf13/cobra"
+)
+
+// contextCmd represents the context command
+var contextCmd = &cobra.Command{
+	Use:   "context",
+	Short: "manage the docker and kubeconfig contexts of the profiles",
+	Long: `Manage the docker and kubeconfig contexts of the profiles.
+
+The name of the docker context is set with dockerContext in the config file, and the name
+of the kubeconfig context with kubernetes.kubeconfig.context.`,
+}
+
+var contextListCmdArgs struct {
+	json bool
+}
+
+// contextListCmd represents the context list command
+var contextListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list the contexts of the profiles",
+	Long:    `List the docker and kubeconfig contexts of the profiles.`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		contexts, err := newApp().Contexts()
+		if err != nil {
+			return err
+		}
+
+		if contextListCmdArgs.json {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			// print context per line to conform with 'colima list'
+			for _, c := range contexts {
+				if err := encoder.Encode(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+		_, _ = fmt.Fprintln(w, "PROFILE\tSTATUS\tDOCKER\tKUBERNETES")
+		for _, c := range contexts {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Profile, c.Status, orDash(c.Docker), orDash(c.Kubernetes))
+		}
+		return w.Flush()
+	},
+}
+
+var contextCreateCmdArgs struct {
+	all bool
+}
+
+// contextCreateCmd represents the context create command
+var contextCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "create the docker contexts of the profiles",
+	Long: `Create the docker context of the profile, or of all the profiles with the docker
+runtime with --all.
+
+The docker context of a profile is created on startup and removed when the profile is
+stopped. Creating the contexts of all the profiles allows switching between the profiles
+with 'docker context use', the profile must be running for docker to connect.`,
+	Example: "  colima context create\n" +
+		"  colima context create --all",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().CreateContexts(contextCreateCmdArgs.all)
+	},
+}
+
+// contextUseCmd represents the context use command
+var contextUseCmd = &cobra.Command{
+	Use:   "use PROFILE",
+	Short: "switch the docker and kubeconfig contexts to the profile",
+	Long: `Switch the current docker context and kubeconfig context to the profile, the docker
+context if the runtime is docker and the kubeconfig context if Kubernetes is enabled.`,
+	Example: "  colima context use default\n" +
+		"  colima context use dev",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().UseContext(args[0])
+	},
+}
+
+// orDash returns s, or a dash if empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	root.Cmd().AddCommand(contextCmd)
+	contextCmd.AddCommand(contextListCmd)
+	contextCmd.AddCommand(contextCreateCmd)
+	contextCmd.AddCommand(contextUseCmd)
+
+	contextListCmd.Flags().BoolVarP(&contextListCmdArgs.json, "json", "j", false, "print json output")
+	contextCreateCmd.Flags().BoolVarP(&contextCreateCmdArgs.all, "all", "a", false, "create the docker contexts of all the profiles")
+}
@@ -2,15 +2,38 @@ package daemon
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/abiosoft/colima/cmd/root"
 	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
 	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/daemon/process/credentials"
+	"github.com/abiosoft/colima/daemon/process/hosts"
 	"github.com/abiosoft/colima/daemon/process/inotify"
+	"github.com/abiosoft/colima/daemon/process/lbports"
+	"github.com/abiosoft/colima/daemon/process/mdns"
+	"github.com/abiosoft/colima/daemon/process/routes"
+	"github.com/abiosoft/colima/daemon/process/socks"
+	"github.com/abiosoft/colima/daemon/process/sshfs"
+	"github.com/abiosoft/colima/daemon/process/timesync"
 	"github.com/abiosoft/colima/daemon/process/vmnet"
+	"github.com/abiosoft/colima/daemon/process/watchdog"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
 	"github.com/abiosoft/colima/environment/host"
 	"github.com/abiosoft/colima/environment/vm/lima"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util/osutil"
+	"github.com/abiosoft/colima/util/routing"
 	"github.com/spf13/cobra"
 )
 
@@ -32,7 +55,12 @@ var startCmd = &cobra.Command{
 
 		var processes []process.Process
 		if daemonArgs.vmnet {
-			processes = append(processes, vmnet.New())
+			n := vmnet.ParseNetworkArg(daemonArgs.vmnetMode)
+			processes = append(processes, vmnet.NewNetwork(0, n.Mode, n.Interface))
+		}
+		for i, arg := range daemonArgs.networks {
+			n := vmnet.ParseNetworkArg(arg)
+			processes = append(processes, vmnet.NewNetwork(i+1, n.Mode, n.Interface))
 		}
 		if daemonArgs.inotify.enabled {
 			processes = append(processes, inotify.New())
@@ -40,10 +68,144 @@ var startCmd = &cobra.Command{
 			args := inotify.Args{
 				GuestActions: guest,
 				Runtime:      daemonArgs.inotify.runtime,
+				Rootless:     daemonArgs.rootless,
 				Dirs:         daemonArgs.inotify.dirs,
 			}
 			ctx = context.WithValue(ctx, inotify.CtxKeyArgs(), args)
 		}
+		if daemonArgs.routes {
+			processes = append(processes, routes.New())
+			profile := config.CurrentProfile()
+			args := routes.Args{
+				VMIP: func(ctx context.Context) (string, error) {
+					return routing.GetVMIP(ctx, profile.ID)
+				},
+				Repair: func(ctx context.Context) error {
+					conf, err := configmanager.LoadFrom(profile.StateFile())
+					if err != nil {
+						return fmt.Errorf("error retrieving current config: %w", err)
+					}
+					return routing.RepairPodRoutingForProfile(ctx, profile.ID, conf)
+				},
+			}
+			ctx = context.WithValue(ctx, routes.CtxKeyArgs(), args)
+		}
+		if daemonArgs.mdns.enabled {
+			processes = append(processes, mdns.New())
+			profile := config.CurrentProfile()
+			args := mdns.Args{
+				Hostname: daemonArgs.mdns.hostname,
+				VMIP: func(ctx context.Context) (string, error) {
+					return routing.GetVMIP(ctx, profile.ID)
+				},
+			}
+			if runtime := daemonArgs.mdns.runtime; runtime != "" {
+				guest := lima.New(host.New())
+				args.Containers = func(ctx context.Context) ([]string, error) {
+					return containerNames(guest, runtime, daemonArgs.rootless)
+				}
+			}
+			ctx = context.WithValue(ctx, mdns.CtxKeyArgs(), args)
+		}
+
+		if daemonArgs.socksPort > 0 {
+			processes = append(processes, socks.New())
+			ctx = context.WithValue(ctx, socks.CtxKeyArgs(), socks.Args{Port: daemonArgs.socksPort})
+		}
+
+		if daemonArgs.hosts.enabled {
+			processes = append(processes, hosts.New())
+			profile := config.CurrentProfile()
+			args := hosts.Args{
+				VMIP: func(ctx context.Context) (string, error) {
+					return routing.GetVMIP(ctx, profile.ID)
+				},
+				Hostnames: func(ctx context.Context) ([]string, error) {
+					var hostnames []string
+					// the Ingresses are not served until the cluster with lazy startup is started
+					if daemonArgs.hosts.kubernetes && routing.KubernetesStarted(ctx, profile.ID) {
+						h, err := routing.GetIngressHosts(ctx, profile.ID)
+						if err != nil {
+							return nil, err
+						}
+						hostnames = append(hostnames, h...)
+					}
+					if runtime := daemonArgs.hosts.runtime; runtime != "" {
+						h, err := routing.GetContainerHosts(ctx, profile.ID, runtime, daemonArgs.rootless)
+						if err != nil {
+							return nil, err
+						}
+						hostnames = append(hostnames, h...)
+					}
+					return hostnames, nil
+				},
+				Update: func(ctx context.Context, ip string, hostnames []string) error {
+					return routing.SetHosts(ctx, profile.ID, ip, hostnames)
+				},
+				Cleanup: func(ctx context.Context) error {
+					return routing.CleanupHosts(ctx, profile.ID)
+				},
+			}
+			ctx = context.WithValue(ctx, hosts.CtxKeyArgs(), args)
+		}
+
+		if daemonArgs.lbports.enabled {
+			portMap, err := parsePortMap(daemonArgs.lbports.portMap)
+			if err != nil {
+				return err
+			}
+			processes = append(processes, lbports.New())
+			profile := config.CurrentProfile()
+			args := lbports.Args{
+				Address: daemonArgs.lbports.address,
+				PortMap: portMap,
+				Ports: func(ctx context.Context) ([]routing.LoadBalancerPort, error) {
+					if !routing.KubernetesStarted(ctx, profile.ID) {
+						return nil, routing.ErrClusterUnreachable
+					}
+					return routing.GetLoadBalancerPorts(ctx, profile.ID)
+				},
+			}
+			ctx = context.WithValue(ctx, lbports.CtxKeyArgs(), args)
+		}
+
+		if daemonArgs.credentials {
+			processes = append(processes, credentials.New())
+		}
+
+		if daemonArgs.timesync {
+			processes = append(processes, timesync.New())
+			ctx = context.WithValue(ctx, timesync.CtxKeyArgs(), timesync.Args{GuestActions: lima.New(host.New())})
+		}
+
+		if daemonArgs.watchdog.enabled {
+			processes = append(processes, watchdog.New())
+			profile := config.CurrentProfile()
+			args := watchdog.Args{
+				Retries: daemonArgs.watchdog.retries,
+				Backoff: daemonArgs.watchdog.backoff,
+				Running: func(ctx context.Context) (bool, error) {
+					i, err := limautil.ProfileInstance(profile.ID)
+					if err != nil {
+						return false, err
+					}
+					return i.Running(), nil
+				},
+				Restart: func(ctx context.Context) error {
+					return restartProfile(profile.ShortName)
+				},
+			}
+			ctx = context.WithValue(ctx, watchdog.CtxKeyArgs(), args)
+		}
+
+		if len(daemonArgs.sshfsMounts) > 0 {
+			mounts, err := parseSSHFSMounts(daemonArgs.sshfsMounts)
+			if err != nil {
+				return err
+			}
+			processes = append(processes, sshfs.New())
+			ctx = context.WithValue(ctx, sshfs.CtxKeyArgs(), sshfs.Args{Mounts: mounts})
+		}
 
 		return start(ctx, processes)
 	},
@@ -79,12 +241,44 @@ var statusCmd = &cobra.Command{
 }
 
 var daemonArgs struct {
-	vmnet   bool
+	vmnet     bool
+	vmnetMode string
+	networks  []string
+	routes    bool
+	socksPort int
+	rootless  bool
+	hosts     struct {
+		enabled    bool
+		kubernetes bool
+		runtime    string
+	}
+	mdns struct {
+		enabled  bool
+		hostname string
+		runtime  string
+	}
 	inotify struct {
 		enabled bool
 		dirs    []string
 		runtime string
 	}
+	lbports struct {
+		enabled bool
+		address string
+		portMap []string
+	}
+
+	credentials bool
+
+	sshfsMounts []string
+
+	timesync bool
+
+	watchdog struct {
+		enabled bool
+		retries int
+		backoff time.Duration
+	}
 
 	verbose bool
 }
@@ -97,7 +291,108 @@ func init() {
 	daemonCmd.AddCommand(statusCmd)
 
 	startCmd.Flags().BoolVar(&daemonArgs.vmnet, "vmnet", false, "start vmnet")
+	startCmd.Flags().StringVar(&daemonArgs.vmnetMode, "vmnet-mode", vmnet.ModeShared, "vmnet mode (mode[:interface])")
+	startCmd.Flags().StringArrayVar(&daemonArgs.networks, "vmnet-network", nil, "start vmnet for additional network (mode[:interface])")
+	startCmd.Flags().BoolVar(&daemonArgs.routes, "routes", false, "start route watcher")
+	startCmd.Flags().BoolVar(&daemonArgs.rootless, "rootless", false, "use the rootless containerd of the user for the containers")
+	startCmd.Flags().BoolVar(&daemonArgs.mdns.enabled, "mdns", false, "start mDNS advertiser")
+	startCmd.Flags().StringVar(&daemonArgs.mdns.hostname, "mdns-hostname", "", "set mDNS hostname")
+	startCmd.Flags().StringVar(&daemonArgs.mdns.runtime, "mdns-runtime", "", "set runtime for advertising container hostnames")
+	startCmd.Flags().IntVar(&daemonArgs.socksPort, "socks-port", 0, "start SOCKS5 proxy on port")
+	startCmd.Flags().BoolVar(&daemonArgs.hosts.enabled, "hosts", false, "start hosts file controller")
+	startCmd.Flags().BoolVar(&daemonArgs.hosts.kubernetes, "hosts-kubernetes", false, "add Kubernetes ingress hostnames to hosts file")
+	startCmd.Flags().StringVar(&daemonArgs.hosts.runtime, "hosts-runtime", "", "set runtime for adding container hostnames to hosts file")
 	startCmd.Flags().BoolVar(&daemonArgs.inotify.enabled, "inotify", false, "start inotify")
 	startCmd.Flags().StringSliceVar(&daemonArgs.inotify.dirs, "inotify-dir", nil, "set inotify directories")
 	startCmd.Flags().StringVar(&daemonArgs.inotify.runtime, "inotify-runtime", "docker", "set runtime")
+	startCmd.Flags().BoolVar(&daemonArgs.lbports.enabled, "lbports", false, "start LoadBalancer port forwarder")
+	startCmd.Flags().StringVar(&daemonArgs.lbports.address, "lbports-address", "127.0.0.1", "set host address of the LoadBalancer ports")
+	startCmd.Flags().StringArrayVar(&daemonArgs.lbports.portMap, "lbports-map", nil, "map LoadBalancer port to host port (port:hostPort)")
+	startCmd.Flags().BoolVar(&daemonArgs.credentials, "credentials", false, "start registry credentials server")
+	startCmd.Flags().BoolVar(&daemonArgs.timesync, "timesync", false, "start VM clock sync")
+	startCmd.Flags().BoolVar(&daemonArgs.watchdog.enabled, "watchdog", false, "start VM watchdog")
+	startCmd.Flags().IntVar(&daemonArgs.watchdog.retries, "watchdog-retries", 3, "set restart attempts of the watchdog")
+	startCmd.Flags().DurationVar(&daemonArgs.watchdog.backoff, "watchdog-backoff", 10*time.Second, "set delay of the first restart of the watchdog")
+	startCmd.Flags().StringArrayVar(&daemonArgs.sshfsMounts, "sshfs-mount", nil, "mount host directory with reverse sshfs (location:mountPoint:rw|ro)")
+}
+
+// parsePortMap parses the port:hostPort mappings.
+func parsePortMap(mappings []string) (map[int]int, error) {
+	portMap := map[int]int{}
+	for _, m := range mappings {
+		port, hostPort, _ := strings.Cut(m, ":")
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port mapping '%s': %w", m, err)
+		}
+		h, err := strconv.Atoi(hostPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port mapping '%s': %w", m, err)
+		}
+		portMap[p] = h
+	}
+	return portMap, nil
+}
+
+// parseSSHFSMounts parses the location:mountPoint:rw|ro mounts. The location is split at the
+// last separators, as the mount point and the mode have no colon.
+func parseSSHFSMounts(args []string) ([]sshfs.Mount, error) {
+	var mounts []sshfs.Mount
+	for _, arg := range args {
+		rest, mode, ok := cutLast(arg, ":")
+		if !ok || (mode != "rw" && mode != "ro") {
+			return nil, fmt.Errorf("invalid sshfs mount '%s'", arg)
+		}
+		location, mountPoint, ok := cutLast(rest, ":")
+		if !ok || location == "" || mountPoint == "" {
+			return nil, fmt.Errorf("invalid sshfs mount '%s'", arg)
+		}
+		mounts = append(mounts, sshfs.Mount{Location: location, MountPoint: mountPoint, Writable: mode == "rw"})
+	}
+	return mounts, nil
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// restartProfile restarts the profile in a new session, as the daemon is stopped and started
+// again with the VM. The crashed VM is force stopped for the cleanup of the instance.
+func restartProfile(profile string) error {
+	log, err := os.OpenFile(filepath.Join(process.Dir(), "watchdog.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating watchdog log file: %w", err)
+	}
+	defer func() { _ = log.Close() }()
+
+	cmd := exec.Command("/bin/sh", "-c", `"$0" stop --force "$1"; exec "$0" start "$1"`, osutil.Executable(), profile)
+	cmd.Env = append(os.Environ(), watchdog.RestartEnvVar+"=1")
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	return cmd.Start()
+}
+
+// containerNames returns the names of the running containers of the runtime in the VM,
+// of the rootless containerd of the user if rootless.
+func containerNames(guest environment.GuestActions, runtime string, rootless bool) ([]string, error) {
+	var args []string
+	switch runtime {
+	case docker.Name:
+		args = []string{docker.Name, "ps", "--format", "{{.Names}}"}
+	case containerd.Name:
+		args = append(containerd.Nerdctl(rootless), "ps", "--format", "{{.Names}}")
+	default:
+		return nil, fmt.Errorf("container hostnames not supported for runtime '%s'", runtime)
+	}
+
+	out, err := guest.RunOutput(args...)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving containers: %w", err)
+	}
+	return strings.Fields(out), nil
 }
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/spf13/cobra"
+)
+
+// diskCmd represents the disk command
+var diskCmd = &cobra.Command{
+	Use:   "disk",
+	Short: "manage the disk of the VM",
+	Long:  `Manage the disk of the VM.`,
+}
+
+var diskCompactCmdArgs struct {
+	zero bool
+}
+
+// diskCompactCmd represents the disk compact command
+var diskCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "reclaim the free space of the disk on the host",
+	Long: `Reclaim the free space of the disk of the VM on the host e.g. after pruning images.
+
+The free space is trimmed in the VM, and the qcow2 disk of the qemu vmType is compacted with
+the VM restarted. --zero fills the free space with zeros before the trim, for the disks without
+discard support, the disk is full for the duration.`,
+	Example: "  colima prune --images && colima disk compact",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().CompactDisk(diskCompactCmdArgs.zero)
+	},
+}
+
+func init() {
+	root.Cmd().AddCommand(diskCmd)
+	diskCmd.AddCommand(diskCompactCmd)
+
+	diskCompactCmd.Flags().BoolVar(&diskCompactCmdArgs.zero, "zero", false, "zero-fill the free space before the trim")
+}
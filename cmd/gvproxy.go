@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/util/portforward"
+	"github.com/spf13/cobra"
+)
+
+var gvproxyCmdArgs struct {
+	json bool
+	data string
+}
+
+// gvproxyCmd represents the gvproxy command
+var gvproxyCmd = &cobra.Command{
+	Use:     "gvproxy",
+	Aliases: []string{"usernet"},
+	Short:   "inspect the user-v2 network",
+	Long: `Inspect the user-v2 network of the VM.
+
+The user-v2 network is provided by gvproxy (gvisor-tap-vsock) and shared
+by the VMs of all the profiles. Its HTTP API is exposed for scripting,
+see 'colima port' for managing the port forwards.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// cobra overrides PersistentPreRunE when redeclared.
+		// re-run rootCmd's.
+		if err := root.Cmd().PersistentPreRunE(cmd, args); err != nil {
+			return err
+		}
+		if !newApp().Active() {
+			return fmt.Errorf("%s is not running", config.CurrentProfile().DisplayName)
+		}
+		return nil
+	},
+}
+
+// gvproxySocketCmd represents the gvproxy socket command
+var gvproxySocketCmd = &cobra.Command{
+	Use:   "socket",
+	Short: "print the path to the API socket",
+	Long: `Print the path to the unix socket of the user-v2 network API.
+
+The API can be used directly e.g. with curl.`,
+	Example: "  curl --unix-socket $(colima gvproxy socket) http://gvproxy/services/forwarder/all",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), portforward.EndpointSocket())
+	},
+}
+
+// gvproxyLeasesCmd represents the gvproxy leases command
+var gvproxyLeasesCmd = &cobra.Command{
+	Use:   "leases",
+	Short: "list the DHCP leases",
+	Long:  `List the DHCP leases of the VMs on the user-v2 network.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		leases, err := portforward.New().Leases()
+		if err != nil {
+			return err
+		}
+		if gvproxyCmdArgs.json {
+			return json.NewEncoder(cmd.OutOrStdout()).Encode(leases)
+		}
+
+		ips := make([]string, 0, len(leases))
+		for ip := range leases {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ADDRESS\tMAC ADDRESS")
+		for _, ip := range ips {
+			_, _ = fmt.Fprintf(w, "%s\t%s\n", ip, leases[ip])
+		}
+		return w.Flush()
+	},
+}
+
+// gvproxyStatsCmd represents the gvproxy stats command
+var gvproxyStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "print the network stats",
+	Long:  `Print the network stack statistics of the user-v2 network in json.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stats, err := portforward.New().Stats()
+		if err != nil {
+			return err
+		}
+		return printJSON(cmd.OutOrStdout(), stats)
+	},
+}
+
+// gvproxyAPICmd represents the gvproxy api command
+var gvproxyAPICmd = &cobra.Command{
+	Use:   "api METHOD PATH",
+	Short: "send a request to the API",
+	Long: `Send a request to the user-v2 network API and print the response.
+
+The request body is read from --data, or stdin if --data is '-'.`,
+	Example: "  colima gvproxy api GET /services/forwarder/all\n" +
+		"  colima gvproxy api POST /services/forwarder/expose \\\n" +
+		"    --data '{\"local\":\"127.0.0.1:8080\",\"remote\":\"192.168.5.15:80\",\"protocol\":\"tcp\"}'",
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var body io.Reader
+		switch gvproxyCmdArgs.data {
+		case "":
+		case "-":
+			body = os.Stdin
+		default:
+			body = bytes.NewBufferString(gvproxyCmdArgs.data)
+		}
+
+		resp, err := portforward.New().Request(args[0], args[1], body)
+		if err != nil {
+			return err
+		}
+		if json.Valid(resp) {
+			return printJSON(cmd.OutOrStdout(), resp)
+		}
+		_, err = cmd.OutOrStdout().Write(resp)
+		return err
+	},
+}
+
+// printJSON prints the indented json.
+func printJSON(w io.Writer, b []byte) error {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, b, "", "  "); err != nil {
+		return err
+	}
+	out.WriteString("\n")
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func init() {
+	root.Cmd().AddCommand(gvproxyCmd)
+	gvproxyCmd.AddCommand(gvproxySocketCmd)
+	gvproxyCmd.AddCommand(gvproxyLeasesCmd)
+	gvproxyCmd.AddCommand(gvproxyStatsCmd)
+	gvproxyCmd.AddCommand(gvproxyAPICmd)
+
+	gvproxyLeasesCmd.Flags().BoolVarP(&gvproxyCmdArgs.json, "json", "j", false, "print json output")
+	gvproxyAPICmd.Flags().StringVarP(&gvproxyCmdArgs.data, "data", "d", "", "request body, '-' to read from stdin")
+}
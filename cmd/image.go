@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var imageCmdArgs struct {
+	kubernetes bool
+}
+
+// imageCmd represents the image command
+var imageCmd = &cobra.Command{
+	Use:     "image",
+	Aliases: []string{"images", "img"},
+	Short:   "move images between the host and the container runtime",
+	Long: `Move images between the host and the container runtime, without the runtime client
+on the host.
+
+The images are of the active runtime, or of the Kubernetes cluster with --kubernetes for the
+containerd runtime. For incus, the images are exported and imported with the incus client.`,
+}
+
+// imageListCmd represents the image list command
+var imageListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list the images of the container runtime",
+	Long:    `List the images of the container runtime.`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().ListImages(imageCmdArgs.kubernetes)
+	},
+}
+
+var imageSaveCmdArgs struct {
+	output string
+}
+
+// imageSaveCmd represents the image save command
+var imageSaveCmd = &cobra.Command{
+	Use:   "save IMAGE...",
+	Short: "save images to an archive on the host",
+	Long: `Save images of the container runtime to an archive on the host, written to the
+standard output if --output is not set.`,
+	Example: "  colima image save -o images.tar nginx:alpine redis:7\n" +
+		"  colima image save --kubernetes -o app.tar docker.io/library/app:latest\n" +
+		"  colima image save alpine | gzip > alpine.tar.gz",
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if imageSaveCmdArgs.output == "" && term.IsTerminal(int(os.Stdout.Fd())) {
+			return fmt.Errorf("refusing to write the archive to the terminal, set --output or redirect the output")
+		}
+		return newApp().SaveImages(args, imageSaveCmdArgs.output, cmd.OutOrStdout(), imageCmdArgs.kubernetes)
+	},
+}
+
+var imageLoadCmdArgs struct {
+	input string
+	alias string
+}
+
+// imageLoadCmd represents the image load command
+var imageLoadCmd = &cobra.Command{
+	Use:   "load",
+	Short: "load images from an archive on the host",
+	Long: `Load images from an archive on the host into the container runtime, read from the
+standard input if --input is not set.`,
+	Example: "  colima image load -i images.tar\n" +
+		"  colima image load --kubernetes -i app.tar\n" +
+		"  gunzip -c alpine.tar.gz | colima image load",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().LoadImages(imageLoadCmdArgs.input, cmd.InOrStdin(), imageCmdArgs.kubernetes, imageLoadCmdArgs.alias)
+	},
+}
+
+func init() {
+	root.Cmd().AddCommand(imageCmd)
+	imageCmd.AddCommand(imageListCmd)
+	imageCmd.AddCommand(imageSaveCmd)
+	imageCmd.AddCommand(imageLoadCmd)
+
+	imageCmd.PersistentFlags().BoolVarP(&imageCmdArgs.kubernetes, "kubernetes", "k", false, "images of the Kubernetes cluster (containerd runtime)")
+	imageSaveCmd.Flags().StringVarP(&imageSaveCmdArgs.output, "output", "o", "", "archive file, the base name of the image files for incus")
+	imageLoadCmd.Flags().StringVarP(&imageLoadCmdArgs.input, "input", "i", "", "archive file")
+	imageLoadCmd.Flags().StringVar(&imageLoadCmdArgs.alias, "alias", "", "alias of the imported image (incus runtime)")
+}
@@ -2,12 +2,21 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"text/tabwriter"
+	"time"
 
 	"github.com/abiosoft/colima/cmd/root"
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/environment/container/kubernetes"
+	"github.com/abiosoft/colima/util"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -128,10 +137,482 @@ The Kubernetes images are cached making the startup (after reset) much faster.`,
 	},
 }
 
+// kubernetesUpgradeCmd represents the kubernetes upgrade command
+var kubernetesUpgradeCmd = &cobra.Command{
+	Use:   "upgrade [VERSION]",
+	Short: "upgrade the Kubernetes cluster",
+	Long: `Upgrade the Kubernetes cluster in place.
+
+The version is an exact version of the distribution e.g. v1.33.3+k3s1, or a
+release channel e.g. stable, latest or v1.33 for the latest patch release.
+The configured version or channel is used if not specified.
+
+The node is drained before the upgrade and uncordoned afterwards, the Kubernetes
+objects are preserved. The version is saved in the config and downgrades are not
+supported. The agent nodes of a multi-node cluster are upgraded after the server.`,
+	Example: "  colima kubernetes upgrade\n" +
+		"  colima kubernetes upgrade stable\n" +
+		"  colima kubernetes upgrade v1.33.3+k3s1",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var version string
+		if len(args) > 0 {
+			version = args[0]
+		}
+		return newApp().UpgradeKubernetes(version)
+	},
+}
+
+var kubernetesFederateCmdArgs struct {
+	exportServices bool
+}
+
+// kubernetesFederateCmd represents the kubernetes federate command
+var kubernetesFederateCmd = &cobra.Command{
+	Use:   "federate PROFILE",
+	Short: "connect the Kubernetes cluster with the cluster of another profile",
+	Long: `Connect the Kubernetes cluster with the cluster of another running profile, for
+testing multi-cluster tooling locally.
+
+The Pod and Service networks of the clusters are routed between the VMs, and must not
+overlap. The profile is added to network.peers in the config for the routes to persist.
+
+The kubeconfig of each cluster is stored in the other cluster as the Secret
+colima-federation/<profile>, with the API server reachable from the other cluster.
+
+With --export-services, the Services labeled colima.export=true are mirrored into the
+other cluster as <service>-<profile> in the same namespace. Run again to update the
+exported Services.`,
+	Example: "  colima kubernetes federate dev\n" +
+		"  colima kubernetes federate dev --export-services",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().FederateKubernetes(args[0], kubernetesFederateCmdArgs.exportServices)
+	},
+}
+
+var kubernetesMigrateCmdArgs struct {
+	to         string
+	version    string
+	namespaces []string
+}
+
+// kubernetesMigrateCmd represents the kubernetes migrate command
+var kubernetesMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "migrate the Kubernetes cluster to a new profile with a newer version",
+	Long: `Migrate the Kubernetes cluster to a new profile with a newer Kubernetes version, for a
+blue/green upgrade.
+
+The new profile is created with the config of the current profile and the cluster is
+restored from a backup of the current cluster, including the PersistentVolumeClaim data.
+The cluster is then upgraded to the version, the configured version if not specified.
+With --namespace, only the namespaces and the system namespaces are kept.
+
+The kubeconfig context is switched to the new profile. The current profile is kept
+running, switch back to its context to roll back.`,
+	Example: "  colima kubernetes migrate --to blue\n" +
+		"  colima kubernetes migrate --to blue --version v1.33.3+k3s1\n" +
+		"  colima kubernetes migrate --to blue --namespace app --namespace db",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().MigrateKubernetes(kubernetesMigrateCmdArgs.to, kubernetesMigrateCmdArgs.version, kubernetesMigrateCmdArgs.namespaces)
+	},
+}
+
+var kubernetesInfoCmdArgs struct {
+	json bool
+}
+
+// kubernetesInfoCmd represents the kubernetes info command
+var kubernetesInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "show the Kubernetes cluster information",
+	Long: `Show the Kubernetes cluster information.
+
+This includes the distribution and version, the API server endpoint, the kubeconfig
+context on the host and the status of the CNI plugin, registry, ingress, load balancer
+and dashboard addons.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		app := newApp()
+		k, err := app.Kubernetes()
+		if err != nil {
+			return err
+		}
+		informer, ok := k.(kubernetes.Informer)
+		if !ok {
+			return fmt.Errorf("info not supported for %s", k.Name())
+		}
+		info, err := informer.Info(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		if kubernetesInfoCmdArgs.json {
+			return json.NewEncoder(cmd.OutOrStdout()).Encode(info)
+		}
+
+		status := "stopped"
+		if info.Running {
+			status = "running"
+		}
+		version := info.Version
+		if info.Channel != "" {
+			version += " (" + info.Channel + ")"
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+		_, _ = fmt.Fprintf(w, "status:\t%s\n", status)
+		_, _ = fmt.Fprintf(w, "distro:\t%s\n", info.Distro)
+		_, _ = fmt.Fprintf(w, "version:\t%s\n", version)
+		_, _ = fmt.Fprintf(w, "nodes:\t%d\n", info.Nodes)
+		if info.Server != "" {
+			_, _ = fmt.Fprintf(w, "server:\t%s\n", info.Server)
+		}
+		if info.Endpoint != "" {
+			_, _ = fmt.Fprintf(w, "endpoint:\t%s\n", info.Endpoint)
+		}
+		if info.Context != "" {
+			_, _ = fmt.Fprintf(w, "context:\t%s\n", info.Context)
+		}
+		if info.Kubeconfig != "" {
+			_, _ = fmt.Fprintf(w, "kubeconfig:\t%s\n", info.Kubeconfig)
+		}
+		for _, addon := range info.Addons {
+			detail := "disabled"
+			if addon.Enabled {
+				detail = "enabled"
+				if addon.Detail != "" {
+					detail = addon.Detail
+				}
+			}
+			_, _ = fmt.Fprintf(w, "%s:\t%s\n", addon.Name, detail)
+		}
+		return w.Flush()
+	},
+}
+
+var kubernetesDashboardCmdArgs struct {
+	port int
+	open bool
+}
+
+// kubernetesDashboardCmd represents the kubernetes dashboard command
+var kubernetesDashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "access the Kubernetes dashboard",
+	Long: `Access the Kubernetes dashboard enabled with kubernetes.dashboard in the config.
+
+The dashboard is forwarded to the port on the host until interrupted with Ctrl-C.
+The URL and a login token, valid for 24 hours, are printed on startup.`,
+	Example: "  colima kubernetes dashboard\n" +
+		"  colima kubernetes dashboard --open\n" +
+		"  colima kubernetes dashboard --port 8443",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		k, err := newApp().Kubernetes()
+		if err != nil {
+			return err
+		}
+		d, ok := k.(kubernetes.Dashboarder)
+		if !ok {
+			return fmt.Errorf("dashboard not supported for %s", k.Name())
+		}
+
+		port := kubernetesDashboardCmdArgs.port
+		dashboard, err := d.Dashboard(cmd.Context(), port)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+		_, _ = fmt.Fprintf(w, "dashboard:\t%s\n", dashboard.Name)
+		_, _ = fmt.Fprintf(w, "url:\t%s\n", dashboard.URL)
+		_, _ = fmt.Fprintf(w, "token:\t%s\n", dashboard.Token)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if kubernetesDashboardCmdArgs.open {
+			go openDashboard(port, dashboard.URL)
+		}
+		return d.ForwardDashboard(cmd.Context(), port)
+	},
+}
+
+// openDashboard opens the URL in the browser once the port forward is listening.
+func openDashboard(port int, url string) {
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	for i := 0; i < 120; i++ {
+		if conn, err := net.DialTimeout("tcp", address, time.Second); err == nil {
+			_ = conn.Close()
+			break
+		}
+		time.Sleep(time.Second)
+	}
+
+	open := "xdg-open"
+	if util.MacOS() {
+		open = "open"
+	}
+	if err := exec.Command(open, url).Run(); err != nil {
+		logrus.Warnln(fmt.Errorf("error opening dashboard in the browser: %w", err))
+	}
+}
+
+// kubernetesBackupCmd represents the kubernetes backup command
+var kubernetesBackupCmd = &cobra.Command{
+	Use:   "backup [FILE]",
+	Short: "backup the Kubernetes cluster state",
+	Long: `Backup the Kubernetes cluster state to a tarball on the host.
+
+The backup contains the datastore, certificates and persistent volumes of the cluster.
+The cluster is stopped during the backup for a consistent snapshot of the datastore.
+The file defaults to colima-<profile>-kubernetes-<timestamp>.tar.gz in the current directory.`,
+	Example: "  colima kubernetes backup\n" +
+		"  colima kubernetes backup ~/backups/cluster.tar.gz",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := kubernetesBackupRestorer()
+		if err != nil {
+			return err
+		}
+
+		file := fmt.Sprintf("colima-%s-kubernetes-%s.tar.gz", config.CurrentProfile().ShortName, time.Now().Format("20060102-150405"))
+		if len(args) > 0 {
+			file = args[0]
+		}
+		f, err := os.Create(file)
+		if err != nil {
+			return fmt.Errorf("error creating backup file: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+
+		if err := b.Backup(cmd.Context(), f); err != nil {
+			_ = os.Remove(file)
+			return err
+		}
+		logrus.Infof("backup saved to %s", file)
+		return nil
+	},
+}
+
+// kubernetesRestoreCmd represents the kubernetes restore command
+var kubernetesRestoreCmd = &cobra.Command{
+	Use:   "restore FILE",
+	Short: "restore the Kubernetes cluster state",
+	Long: `Restore the Kubernetes cluster state from a backup created with 'colima kubernetes backup'.
+
+The current cluster state is replaced. The cluster must be started with the same
+Kubernetes distribution, e.g. after 'colima delete' and 'colima start --kubernetes',
+or on another machine. The kubeconfig on the host is updated for the restored cluster.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := kubernetesBackupRestorer()
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("error opening backup file: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+
+		return b.Restore(cmd.Context(), f)
+	},
+}
+
+var kubernetesApplyCmdArgs struct {
+	files []string
+}
+
+// kubernetesApplyCmd represents the kubernetes apply command
+var kubernetesApplyCmd = &cobra.Command{
+	Use:   "apply -f FILE",
+	Short: "apply manifests to the Kubernetes cluster",
+	Long: `Apply manifests to the Kubernetes cluster with the kubectl of the VM.
+
+The files and directories are read on the host, kubectl is not required on the host.`,
+	Example: "  colima kubernetes apply -f deployment.yaml\n" +
+		"  colima kubernetes apply -f manifests/ -f https://example.com/crds.yaml\n" +
+		"  cat deployment.yaml | colima kubernetes apply -f -",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, err := kubernetesDeployer()
+		if err != nil {
+			return err
+		}
+		return d.Apply(cmd.Context(), kubernetesApplyCmdArgs.files, cmd.InOrStdin(), cmd.OutOrStdout())
+	},
+}
+
+var kubernetesInstallCmdArgs kubernetes.ChartOptions
+
+// kubernetesInstallCmd represents the kubernetes install command
+var kubernetesInstallCmd = &cobra.Command{
+	Use:   "install RELEASE CHART",
+	Short: "install a helm chart in the Kubernetes cluster",
+	Long: `Install or upgrade a helm chart in the Kubernetes cluster with the helm of the VM.
+
+helm is installed in the VM on first use, helm is not required on the host.
+The chart is a chart reference, a chart name with --repo, an OCI URL or a chart archive on the host.`,
+	Example: "  colima kubernetes install redis oci://registry-1.docker.io/bitnamicharts/redis\n" +
+		"  colima kubernetes install cert-manager cert-manager --repo https://charts.jetstack.io --namespace cert-manager --set crds.enabled=true\n" +
+		"  colima kubernetes install app ./app-0.1.0.tgz -f values.yaml",
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, err := kubernetesDeployer()
+		if err != nil {
+			return err
+		}
+		return d.Install(cmd.Context(), args[0], args[1], kubernetesInstallCmdArgs, cmd.OutOrStdout())
+	},
+}
+
+// kubernetesDeployer returns the Kubernetes runtime for deploying to the cluster.
+func kubernetesDeployer() (kubernetes.Deployer, error) {
+	k, err := newApp().Kubernetes()
+	if err != nil {
+		return nil, err
+	}
+	d, ok := k.(kubernetes.Deployer)
+	if !ok {
+		return nil, fmt.Errorf("deploying not supported for %s", k.Name())
+	}
+	return d, nil
+}
+
+// kubernetesCertsCmd represents the kubernetes certs command
+var kubernetesCertsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "manage the Kubernetes cluster certificates",
+	Long: `Manage the client and serving certificates of the Kubernetes cluster.
+
+The certificates are valid for a year, and are rotated on startup when expiring within 30 days.`,
+}
+
+var kubernetesCertsStatusCmdArgs struct {
+	json bool
+}
+
+// kubernetesCertsStatusCmd represents the kubernetes certs status command
+var kubernetesCertsStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show the expiry of the certificates",
+	Long:  `Show the expiry of the certificates of the node, the soonest expiring first.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := kubernetesCertRotator()
+		if err != nil {
+			return err
+		}
+		certs, err := r.Certs(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		if kubernetesCertsStatusCmdArgs.json {
+			return json.NewEncoder(cmd.OutOrStdout()).Encode(certs)
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+		_, _ = fmt.Fprintln(w, "FILE\tSUBJECT\tEXPIRES\tSTATUS")
+		for _, cert := range certs {
+			status := "valid"
+			switch {
+			case cert.Expiring(0):
+				status = "expired"
+			case cert.CA:
+				status = "ca"
+			case cert.Expiring(kubernetes.CertRenewBefore):
+				status = "expiring"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", cert.File, cert.Subject, cert.NotAfter.Local().Format(time.DateOnly), status)
+		}
+		return w.Flush()
+	},
+}
+
+// kubernetesCertsRotateCmd represents the kubernetes certs rotate command
+var kubernetesCertsRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "rotate the certificates",
+	Long: `Rotate the client and serving certificates of the node, the certificate authorities are kept.
+
+The cluster is restarted and the kubeconfig on the host is updated.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := kubernetesCertRotator()
+		if err != nil {
+			return err
+		}
+		return r.RotateCerts(cmd.Context())
+	},
+}
+
+// kubernetesCertRotator returns the Kubernetes runtime for the certificates.
+func kubernetesCertRotator() (kubernetes.CertRotator, error) {
+	k, err := newApp().Kubernetes()
+	if err != nil {
+		return nil, err
+	}
+	r, ok := k.(kubernetes.CertRotator)
+	if !ok {
+		return nil, fmt.Errorf("certificates not supported for %s", k.Name())
+	}
+	return r, nil
+}
+
+// kubernetesBackupRestorer returns the Kubernetes runtime for backup and restore.
+func kubernetesBackupRestorer() (kubernetes.BackupRestorer, error) {
+	k, err := newApp().Kubernetes()
+	if err != nil {
+		return nil, err
+	}
+	b, ok := k.(kubernetes.BackupRestorer)
+	if !ok {
+		return nil, fmt.Errorf("backup not supported for %s", k.Name())
+	}
+	return b, nil
+}
+
 func init() {
 	root.Cmd().AddCommand(kubernetesCmd)
 	kubernetesCmd.AddCommand(kubernetesStartCmd)
 	kubernetesCmd.AddCommand(kubernetesStopCmd)
 	kubernetesCmd.AddCommand(kubernetesDeleteCmd)
 	kubernetesCmd.AddCommand(kubernetesResetCmd)
+	kubernetesCmd.AddCommand(kubernetesUpgradeCmd)
+	kubernetesCmd.AddCommand(kubernetesInfoCmd)
+	kubernetesCmd.AddCommand(kubernetesBackupCmd)
+	kubernetesCmd.AddCommand(kubernetesRestoreCmd)
+	kubernetesCmd.AddCommand(kubernetesDashboardCmd)
+	kubernetesCmd.AddCommand(kubernetesApplyCmd)
+	kubernetesCmd.AddCommand(kubernetesInstallCmd)
+	kubernetesCmd.AddCommand(kubernetesCertsCmd)
+	kubernetesCmd.AddCommand(kubernetesFederateCmd)
+	kubernetesCmd.AddCommand(kubernetesMigrateCmd)
+	kubernetesCertsCmd.AddCommand(kubernetesCertsStatusCmd)
+	kubernetesCertsCmd.AddCommand(kubernetesCertsRotateCmd)
+
+	kubernetesInfoCmd.Flags().BoolVarP(&kubernetesInfoCmdArgs.json, "json", "j", false, "print json output")
+	kubernetesCertsStatusCmd.Flags().BoolVarP(&kubernetesCertsStatusCmdArgs.json, "json", "j", false, "print json output")
+	kubernetesFederateCmd.Flags().BoolVar(&kubernetesFederateCmdArgs.exportServices, "export-services", false, "mirror the Services labeled colima.export=true into the other cluster")
+	kubernetesMigrateCmd.Flags().StringVar(&kubernetesMigrateCmdArgs.to, "to", "", "profile to create for the migrated cluster")
+	kubernetesMigrateCmd.Flags().StringVar(&kubernetesMigrateCmdArgs.version, "version", "", "Kubernetes version or channel of the migrated cluster (default: configured version)")
+	kubernetesMigrateCmd.Flags().StringSliceVarP(&kubernetesMigrateCmdArgs.namespaces, "namespace", "n", nil, "namespace to keep, all if not specified")
+	_ = kubernetesMigrateCmd.MarkFlagRequired("to")
+	kubernetesDashboardCmd.Flags().IntVar(&kubernetesDashboardCmdArgs.port, "port", 9090, "port on the host for the dashboard")
+	kubernetesDashboardCmd.Flags().BoolVarP(&kubernetesDashboardCmdArgs.open, "open", "o", false, "open the dashboard in the browser")
+
+	kubernetesApplyCmd.Flags().StringSliceVarP(&kubernetesApplyCmdArgs.files, "filename", "f", nil, "manifest file, directory or URL, - for stdin")
+	_ = kubernetesApplyCmd.MarkFlagRequired("filename")
+
+	kubernetesInstallCmd.Flags().StringVarP(&kubernetesInstallCmdArgs.Namespace, "namespace", "n", "", "namespace of the release, created if missing (default \"default\")")
+	kubernetesInstallCmd.Flags().StringVar(&kubernetesInstallCmdArgs.Repo, "repo", "", "chart repository URL")
+	kubernetesInstallCmd.Flags().StringVar(&kubernetesInstallCmdArgs.Version, "version", "", "chart version, the latest if empty")
+	kubernetesInstallCmd.Flags().StringSliceVarP(&kubernetesInstallCmdArgs.Values, "values", "f", nil, "values file")
+	kubernetesInstallCmd.Flags().StringArrayVar(&kubernetesInstallCmdArgs.Set, "set", nil, "value as key=value")
 }
@@ -6,12 +6,15 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
 
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/cmd/root"
 	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/container/buildkit"
 	"github.com/abiosoft/colima/environment/container/containerd"
 	"github.com/abiosoft/colima/util/fsutil"
 	"github.com/abiosoft/colima/util/osutil"
@@ -33,6 +36,11 @@ var nerdctlCmd = &cobra.Command{
 	Long: `Run nerdctl to interact with containerd.
 This requires containerd runtime.
 
+The host paths of the mounted directories are translated to the paths in the VM, for the
+working directory, the compose and env files, the source of the bind mounts and the build
+context. The volumes in the compose files are not translated.
+The compose environment variables e.g. COMPOSE_PROJECT_NAME are passed to 'nerdctl compose'.
+
 It is recommended to specify '--' to differentiate from Colima flags.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -45,11 +53,124 @@ It is recommended to specify '--' to differentiate from Colima flags.
 			return fmt.Errorf("nerdctl only supports %s runtime", containerd.Name)
 		}
 
-		nerdctlArgs := append([]string{"sudo", "nerdctl"}, args...)
-		return app.SSH(nerdctlArgs...)
+		// the rootless containerd of the user, if enabled
+		conf, _ := configmanager.LoadInstance()
+		nerdctl := containerd.Nerdctl(conf.Rootless)
+
+		var env []string
+		// builds with the dedicated buildkitd, if enabled
+		if conf.BuildKit.Enabled {
+			env = append(env, "BUILDKIT_HOST=unix://"+buildkit.GuestSocketFile)
+		}
+		if slices.Contains(args, "compose") {
+			env = append(env, composeEnv(conf, os.Environ())...)
+		}
+		if len(env) > 0 {
+			nerdctl = slices.Insert(nerdctl, len(nerdctl)-1, append([]string{"env"}, env...)...)
+		}
+
+		return app.SSH(append(nerdctl, nerdctlArgs(conf, args)...)...)
 	},
 }
 
+// nerdctlPathFlags are the flags of nerdctl and nerdctl compose with a host path value.
+var nerdctlPathFlags = []string{"-f", "--file", "--project-directory", "--env-file", "--cidfile", "--iidfile"}
+
+// nerdctlArgs returns the nerdctl args with the host paths translated to the paths in the VM,
+// for the path flags, the source of bind mounts and the build context.
+func nerdctlArgs(conf config.Config, args []string) []string {
+	guestPath := func(path string) string { return nerdctlGuestPath(conf, path) }
+
+	translated := make([]string, len(args))
+	for i, arg := range args {
+		flag, value, hasValue := strings.Cut(arg, "=")
+		prev := ""
+		if i > 0 {
+			prev = args[i-1]
+		}
+
+		switch {
+		// --file=/path
+		case hasValue && slices.Contains(nerdctlPathFlags, flag):
+			arg = flag + "=" + guestPath(value)
+		// --file /path
+		case slices.Contains(nerdctlPathFlags, prev):
+			arg = guestPath(arg)
+		// --volume=/path:/dest
+		case hasValue && (flag == "-v" || flag == "--volume"):
+			arg = flag + "=" + volumeGuestPath(value, guestPath)
+		// --volume /path:/dest
+		case prev == "-v" || prev == "--volume":
+			arg = volumeGuestPath(arg, guestPath)
+		// --mount type=bind,source=/path,target=/dest
+		case prev == "--mount" || flag == "--mount":
+			arg = mountGuestPath(arg, guestPath)
+		// the build context, the last arg of build
+		case i == len(args)-1 && !strings.HasPrefix(arg, "-") && slices.Contains(args[:i], "build"):
+			arg = guestPath(arg)
+		}
+		translated[i] = arg
+	}
+	return translated
+}
+
+// nerdctlGuestPath returns the path in the VM of the absolute path on the host, the path is
+// returned unchanged if relative or not mounted.
+func nerdctlGuestPath(conf config.Config, path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	if p, ok := conf.GuestPath(path); ok {
+		return p
+	}
+	return path
+}
+
+// volumeGuestPath returns the volume spec with the source translated by guestPath.
+func volumeGuestPath(spec string, guestPath func(string) string) string {
+	source, rest, ok := strings.Cut(spec, ":")
+	if !ok {
+		return spec
+	}
+	return guestPath(source) + ":" + rest
+}
+
+// mountGuestPath returns the mount spec with the source translated by guestPath.
+func mountGuestPath(spec string, guestPath func(string) string) string {
+	fields := strings.Split(spec, ",")
+	for i, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if ok && (key == "source" || key == "src") {
+			fields[i] = key + "=" + guestPath(value)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// composeEnvVars are the environment variables of compose passed to nerdctl compose.
+var composeEnvVars = []string{"COMPOSE_PROJECT_NAME", "COMPOSE_FILE", "COMPOSE_PROFILES", "COMPOSE_PATH_SEPARATOR"}
+
+// composeEnv returns the compose environment variables of the host environ, with the host
+// paths of COMPOSE_FILE translated to the paths in the VM.
+func composeEnv(conf config.Config, environ []string) []string {
+	var env []string
+	for _, e := range environ {
+		key, value, _ := strings.Cut(e, "=")
+		if !slices.Contains(composeEnvVars, key) {
+			continue
+		}
+		if key == "COMPOSE_FILE" {
+			files := strings.Split(value, string(os.PathListSeparator))
+			for i, f := range files {
+				files[i] = nerdctlGuestPath(conf, f)
+			}
+			value = strings.Join(files, string(os.PathListSeparator))
+		}
+		env = append(env, key+"="+value)
+	}
+	return env
+}
+
 // nerdctlLinkFunc represents the nerdctl command
 var nerdctlLinkFunc = func() *cobra.Command {
 	return &cobra.Command{
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+)
+
+func Test_nerdctlArgs(t *testing.T) {
+	conf := config.Config{
+		Mounts: []config.Mount{
+			{Location: "/Users/dev"},
+			{Location: "/Users/dev/projects", MountPoint: "/projects", Writable: true},
+		},
+	}
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{
+			args: []string{"compose", "-f", "/Users/dev/projects/app/compose.yaml", "up", "-d"},
+			want: []string{"compose", "-f", "/projects/app/compose.yaml", "up", "-d"},
+		},
+		{
+			args: []string{"compose", "--file=/Users/dev/projects/app/compose.yaml", "--project-directory", "/Users/dev/projects/app", "build"},
+			want: []string{"compose", "--file=/projects/app/compose.yaml", "--project-directory", "/projects/app", "build"},
+		},
+		{
+			args: []string{"compose", "-f", "compose.yaml", "--env-file", "/Users/dev/.env", "up"},
+			want: []string{"compose", "-f", "compose.yaml", "--env-file", "/Users/dev/.env", "up"},
+		},
+		{
+			args: []string{"run", "-v", "/Users/dev/projects/data:/data:ro", "--volume=/Users/dev/projects:/src", "-p", "8080:80", "nginx"},
+			want: []string{"run", "-v", "/projects/data:/data:ro", "--volume=/projects:/src", "-p", "8080:80", "nginx"},
+		},
+		{
+			args: []string{"run", "--mount", "type=bind,source=/Users/dev/projects/data,target=/data", "alpine", "ls", "/data"},
+			want: []string{"run", "--mount", "type=bind,source=/projects/data,target=/data", "alpine", "ls", "/data"},
+		},
+		{
+			args: []string{"build", "-t", "app", "/Users/dev/projects/app"},
+			want: []string{"build", "-t", "app", "/projects/app"},
+		},
+		{
+			args: []string{"build", "-f", "/Users/dev/projects/app/Dockerfile", "/Users/dev/projects/app"},
+			want: []string{"build", "-f", "/projects/app/Dockerfile", "/projects/app"},
+		},
+		{
+			args: []string{"run", "alpine", "ls", "/Users/dev/projects"},
+			want: []string{"run", "alpine", "ls", "/Users/dev/projects"},
+		},
+		{
+			args: []string{"run", "-v", "/opt/data:/data", "-e", "KEY=/Users/dev/projects", "alpine"},
+			want: []string{"run", "-v", "/opt/data:/data", "-e", "KEY=/Users/dev/projects", "alpine"},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if got := nerdctlArgs(conf, tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nerdctlArgs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_composeEnv(t *testing.T) {
+	conf := config.Config{
+		Mounts: []config.Mount{
+			{Location: "/Users/dev/projects", MountPoint: "/projects"},
+		},
+	}
+	environ := []string{
+		"HOME=/Users/dev",
+		"COMPOSE_PROJECT_NAME=app",
+		"COMPOSE_FILE=compose.yaml:/Users/dev/projects/app/compose.override.yaml",
+	}
+	want := []string{
+		"COMPOSE_PROJECT_NAME=app",
+		"COMPOSE_FILE=compose.yaml:/projects/app/compose.override.yaml",
+	}
+	if got := composeEnv(conf, environ); !reflect.DeepEqual(got, want) {
+		t.Errorf("composeEnv() = %+v, want %+v", got, want)
+	}
+}
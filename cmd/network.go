@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/util/routing"
+	"github.com/spf13/cobra"
+)
+
+var networkCmdArgs struct {
+	json bool
+}
+
+// networkCmd represents the network command
+var networkCmd = &cobra.Command{
+	Use:   "network",
+	Short: "inspect the VM network",
+	Long:  `Inspect the network of the VM.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// cobra overrides PersistentPreRunE when redeclared.
+		// re-run rootCmd's.
+		if err := root.Cmd().PersistentPreRunE(cmd, args); err != nil {
+			return err
+		}
+		if !newApp().Active() {
+			return fmt.Errorf("%s is not running", config.CurrentProfile().DisplayName)
+		}
+		return nil
+	},
+}
+
+// networkDoctorCmd represents the network doctor command
+var networkDoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "diagnose network issues",
+	Long: `Run connectivity checks on the VM network and print the findings.
+
+The checks cover the ssh connection and reachability of the VM from the host,
+the internet access and DNS resolution in the VM, the path MTU, the configured
+port forwards and the Pod, Service and container network routes.
+
+A failed check includes a hint for fixing it. The command fails if any check failed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profile := config.CurrentProfile()
+		conf, err := configmanager.LoadFrom(profile.StateFile())
+		if err != nil {
+			return fmt.Errorf("error retrieving current config: %w", err)
+		}
+
+		findings := routing.Diagnose(cmd.Context(), profile.ID, conf)
+		if err := printFindings(cmd, findings); err != nil {
+			return err
+		}
+		return routing.FindingsErr(findings)
+	},
+}
+
+// printFindings prints the findings of the network checks.
+func printFindings(cmd *cobra.Command, findings []routing.Finding) error {
+	if networkCmdArgs.json {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		// print finding per line to conform with 'colima list'
+		for _, f := range findings {
+			if err := encoder.Encode(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+	for _, f := range findings {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", f.Check, f.Status, f.Detail)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	// actionable hints after the table
+	header := false
+	for _, f := range findings {
+		if f.Hint == "" {
+			continue
+		}
+		if !header {
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "\nSuggestions:")
+			header = true
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "  %s: %s\n", f.Check, f.Hint)
+	}
+	return nil
+}
+
+func init() {
+	root.Cmd().AddCommand(networkCmd)
+	networkCmd.AddCommand(networkDoctorCmd)
+
+	networkCmd.PersistentFlags().BoolVarP(&networkCmdArgs.json, "json", "j", false, "print json output")
+}
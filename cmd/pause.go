@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/spf13/cobra"
+)
+
+// pauseCmd represents the pause command
+var pauseCmd = &cobra.Command{
+	Use:   "pause [profile]",
+	Short: "pause Colima",
+	Long: `Pause the VM of Colima, to free the CPU without stopping the containers.
+
+The memory of the VM is kept, 'colima resume' continues the VM instantly without the startup
+of the runtime and Kubernetes. Only supported with the qemu vmType.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().Pause()
+	},
+}
+
+// resumeCmd represents the resume command
+var resumeCmd = &cobra.Command{
+	Use:   "resume [profile]",
+	Short: "resume paused Colima",
+	Long:  `Resume the paused VM of Colima.`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().Resume()
+	},
+}
+
+func init() {
+	root.Cmd().AddCommand(pauseCmd)
+	root.Cmd().AddCommand(resumeCmd)
+}
@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util/portforward"
+	"github.com/spf13/cobra"
+)
+
+var portCmdArgs struct {
+	json    bool
+	address string
+}
+
+// portCmd represents the port command
+var portCmd = &cobra.Command{
+	Use:     "port",
+	Aliases: []string{"ports"},
+	Short:   "manage port forwards",
+	Long: `Manage the port forwards from the host to the VM.
+
+Port forwards are added and removed on the running VM without
+modifying the config or restarting the VM. They do not persist
+across restarts.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// cobra overrides PersistentPreRunE when redeclared.
+		// re-run rootCmd's.
+		if err := root.Cmd().PersistentPreRunE(cmd, args); err != nil {
+			return err
+		}
+		if !newApp().Active() {
+			return fmt.Errorf("%s is not running", config.CurrentProfile().DisplayName)
+		}
+		return nil
+	},
+}
+
+// portAddCmd represents the port add command
+var portAddCmd = &cobra.Command{
+	Use:   "add [HOST_PORT:]GUEST_PORT[/PROTOCOL]...",
+	Short: "add port forwards",
+	Long: `Add port forwards from the host to the VM.
+
+The host port defaults to the guest port and the protocol defaults to tcp.`,
+	Example: "  colima port add 8080\n" +
+		"  colima port add 8080:80\n" +
+		"  colima port add 5353:53/udp --address 0.0.0.0",
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		forwards, err := parseForwards(args)
+		if err != nil {
+			return err
+		}
+		client := portforward.New()
+		for _, f := range forwards {
+			if err := client.Add(f); err != nil {
+				return err
+			}
+		}
+		return printForwards(cmd, forwards)
+	},
+}
+
+// portRemoveCmd represents the port remove command
+var portRemoveCmd = &cobra.Command{
+	Use:     "remove [HOST_PORT:]GUEST_PORT[/PROTOCOL]...",
+	Aliases: []string{"rm", "delete"},
+	Short:   "remove port forwards",
+	Long: `Remove port forwards from the host to the VM.
+
+Port forwards are matched by the host address, port and protocol.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		forwards, err := parseForwards(args)
+		if err != nil {
+			return err
+		}
+		client := portforward.New()
+		for _, f := range forwards {
+			if err := client.Remove(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// portListCmd represents the port list command
+var portListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list port forwards",
+	Long:    `List the active port forwards from the host to the VM.`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		guestIP, err := guestIPAddress()
+		if err != nil {
+			return err
+		}
+		forwards, err := portforward.New().List()
+		if err != nil {
+			return err
+		}
+		return printForwards(cmd, portforward.ForVM(forwards, guestIP))
+	},
+}
+
+// portReverseCmd represents the port reverse command
+var portReverseCmd = &cobra.Command{
+	Use:   "reverse",
+	Short: "manage reverse port forwards",
+	Long: `Manage the port forwards from the VM to the host.
+
+The forwarded ports listen on all the VM addresses, for reaching services
+on the host from the VM and the containers e.g. a debugger or a dev server.
+Only TCP is supported.
+
+Reverse port forwards in the config are added on startup.`,
+}
+
+// portReverseAddCmd represents the port reverse add command
+var portReverseAddCmd = &cobra.Command{
+	Use:   "add [GUEST_PORT:]HOST_PORT...",
+	Short: "add reverse port forwards",
+	Long: `Add port forwards from the VM to the host.
+
+The guest port defaults to the host port.`,
+	Example: "  colima port reverse add 9003\n" +
+		"  colima port reverse add 3000:8080",
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		forwards, err := parseReverseForwards(args)
+		if err != nil {
+			return err
+		}
+		reverse := portforward.NewReverseForwarder(config.CurrentProfile().ID)
+		for _, f := range forwards {
+			if err := reverse.Add(f); err != nil {
+				return err
+			}
+		}
+		return printReverseForwards(cmd, forwards)
+	},
+}
+
+// portReverseRemoveCmd represents the port reverse remove command
+var portReverseRemoveCmd = &cobra.Command{
+	Use:     "remove GUEST_PORT...",
+	Aliases: []string{"rm", "delete"},
+	Short:   "remove reverse port forwards",
+	Long:    `Remove port forwards from the VM to the host.`,
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		forwards, err := parseReverseForwards(args)
+		if err != nil {
+			return err
+		}
+		reverse := portforward.NewReverseForwarder(config.CurrentProfile().ID)
+		for _, f := range forwards {
+			if err := reverse.Remove(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// portReverseListCmd represents the port reverse list command
+var portReverseListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list reverse port forwards",
+	Long:    `List the active port forwards from the VM to the host.`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		forwards, err := portforward.NewReverseForwarder(config.CurrentProfile().ID).List()
+		if err != nil {
+			return err
+		}
+		return printReverseForwards(cmd, forwards)
+	},
+}
+
+// guestIPAddress returns the user-v2 network address of the current profile.
+func guestIPAddress() (string, error) {
+	ip := limautil.UserNetIPAddress(config.CurrentProfile().ID)
+	if ip == "" {
+		return "", fmt.Errorf("error retrieving the VM address")
+	}
+	return ip, nil
+}
+
+// parseForwards parses the port forward specs for the current profile.
+func parseForwards(specs []string) ([]portforward.Forward, error) {
+	guestIP, err := guestIPAddress()
+	if err != nil {
+		return nil, err
+	}
+	var forwards []portforward.Forward
+	for _, spec := range specs {
+		f, err := portforward.Parse(spec, portCmdArgs.address, guestIP)
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, f)
+	}
+	return forwards, nil
+}
+
+// parseReverseForwards parses the reverse port forward specs.
+func parseReverseForwards(specs []string) ([]portforward.Reverse, error) {
+	var forwards []portforward.Reverse
+	for _, spec := range specs {
+		f, err := portforward.ParseReverse(spec, portCmdArgs.address)
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, f)
+	}
+	return forwards, nil
+}
+
+// printReverseForwards prints the reverse port forwards.
+func printReverseForwards(cmd *cobra.Command, forwards []portforward.Reverse) error {
+	if portCmdArgs.json {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		// print forward per line to conform with 'colima list'
+		for _, f := range forwards {
+			if err := encoder.Encode(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+	_, _ = fmt.Fprintln(w, "GUEST PORT\tHOST")
+	for _, f := range forwards {
+		_, _ = fmt.Fprintf(w, "%d\t%s\n", f.GuestPort, f.Host)
+	}
+	return w.Flush()
+}
+
+// printForwards prints the port forwards.
+func printForwards(cmd *cobra.Command, forwards []portforward.Forward) error {
+	if portCmdArgs.json {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		// print forward per line to conform with 'colima list'
+		for _, f := range forwards {
+			if err := encoder.Encode(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+	_, _ = fmt.Fprintln(w, "HOST\tGUEST\tPROTOCOL")
+	for _, f := range forwards {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", f.Local, f.Remote, f.Protocol)
+	}
+	return w.Flush()
+}
+
+func init() {
+	root.Cmd().AddCommand(portCmd)
+	portCmd.AddCommand(portAddCmd)
+	portCmd.AddCommand(portRemoveCmd)
+	portCmd.AddCommand(portListCmd)
+	portCmd.AddCommand(portReverseCmd)
+	portReverseCmd.AddCommand(portReverseAddCmd)
+	portReverseCmd.AddCommand(portReverseRemoveCmd)
+	portReverseCmd.AddCommand(portReverseListCmd)
+
+	portCmd.PersistentFlags().BoolVarP(&portCmdArgs.json, "json", "j", false, "print json output")
+	portAddCmd.Flags().StringVar(&portCmdArgs.address, "address", "127.0.0.1", "host address to bind the forwarded ports")
+	portRemoveCmd.Flags().StringVar(&portCmdArgs.address, "address", "127.0.0.1", "host address of the forwarded ports")
+	portReverseAddCmd.Flags().StringVar(&portCmdArgs.address, "address", "127.0.0.1", "host address to forward the ports to")
+}
@@ -15,17 +15,34 @@ import (
 )
 
 var pruneCmdArgs struct {
-	force bool
-	all   bool
+	force  bool
+	all    bool
+	images bool
 }
 
 // pruneCmd represents the prune command
 var pruneCmd = &cobra.Command{
 	Use:   "prune",
 	Short: "prune cached downloaded assets",
-	Long:  `Prune cached downloaded assets`,
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Prune cached downloaded assets.
+
+With --images, the dangling images and build cache of the container runtime in the VM are
+pruned instead, with the limits of the gc config. All the unused images and build cache are
+pruned with --all.`,
+	Example: "  colima prune\n" +
+		"  colima prune --images\n" +
+		"  colima prune --images --all",
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if pruneCmdArgs.images {
+			if pruneCmdArgs.all && !pruneCmdArgs.force {
+				if y := cli.Prompt("all the unused images and build cache will be removed, are you sure"); !y {
+					return nil
+				}
+			}
+			return newApp().PruneImages(pruneCmdArgs.all)
+		}
+
 		colimaCacheDir := config.CacheDir()
 		limaCacheDir := filepath.Join(filepath.Dir(colimaCacheDir), "lima")
 		if !pruneCmdArgs.force {
@@ -57,5 +74,6 @@ func init() {
 	root.Cmd().AddCommand(pruneCmd)
 
 	pruneCmd.Flags().BoolVarP(&pruneCmdArgs.force, "force", "f", false, "do not prompt for yes/no")
-	pruneCmd.Flags().BoolVarP(&pruneCmdArgs.all, "all", "a", false, "include Lima assets")
+	pruneCmd.Flags().BoolVarP(&pruneCmdArgs.all, "all", "a", false, "include Lima assets, or all the unused images with --images")
+	pruneCmd.Flags().BoolVar(&pruneCmdArgs.images, "images", false, "prune the images and build cache of the container runtime")
 }
@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/host"
+	"github.com/abiosoft/colima/util/routing"
+	"github.com/spf13/cobra"
+)
+
+var routingCmdArgs struct {
+	json   bool
+	dryRun bool
+}
+
+// routingCmd represents the routing command
+var routingCmd = &cobra.Command{
+	Use:     "routing",
+	Aliases: []string{"route", "routes"},
+	Short:   "manage Pod, Service and container network routes",
+	Long: `Manage the host routes to the Kubernetes Pod and Service networks
+and the container networks.
+
+Routes are only managed when network address and either of Kubernetes
+or container routes are enabled.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// cobra overrides PersistentPreRunE when redeclared.
+		// re-run rootCmd's.
+		if err := root.Cmd().PersistentPreRunE(cmd, args); err != nil {
+			return err
+		}
+		if !newApp().Active() {
+			return fmt.Errorf("%s is not running", config.CurrentProfile().DisplayName)
+		}
+		return nil
+	},
+}
+
+// routingStatusCmd represents the routing status command
+var routingStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show the status of the routes",
+	Long: `Show the status of the Pod and Service network routes.
+
+A route is stale if it points to a gateway other than the VM.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rm, _, err := routeManager(cmd)
+		if err != nil {
+			return err
+		}
+		return printRouteStatus(cmd, rm, true)
+	},
+}
+
+// routingAddCmd represents the routing add command
+var routingAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "add the routes",
+	Long: `Add the Pod and Service network routes to the host.
+
+With --dry-run, the changes are printed as a shell script for review
+and manual application instead.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan := dryRun(cmd)
+		rm, _, err := routeManager(cmd)
+		if err != nil {
+			return err
+		}
+		if err := rm.SetupPodRouting(cmd.Context()); err != nil {
+			return err
+		}
+		if plan != nil {
+			return printPlan(cmd, plan)
+		}
+		return printRouteStatus(cmd, rm, false)
+	},
+}
+
+// routingRemoveCmd represents the routing remove command
+var routingRemoveCmd = &cobra.Command{
+	Use:     "remove",
+	Aliases: []string{"rm", "delete"},
+	Short:   "remove the routes",
+	Long: `Remove the Pod and Service network routes from the host.
+
+The VM is not stopped and the routes can be added back with 'colima routing add'.
+
+With --dry-run, the changes are printed as a shell script for review
+and manual application instead.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan := dryRun(cmd)
+		rm, _, err := routeManager(cmd)
+		if err != nil {
+			return err
+		}
+		if err := rm.UninstallPersistence(host.New()); err != nil {
+			return err
+		}
+		if err := rm.CleanupPodRouting(cmd.Context()); err != nil {
+			return err
+		}
+		if plan != nil {
+			return printPlan(cmd, plan)
+		}
+		return printRouteStatus(cmd, rm, false)
+	},
+}
+
+// routingRepairCmd represents the routing repair command
+var routingRepairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "repair the routes",
+	Long: `Repair the Pod and Service network routes.
+
+Missing routes are added and stale routes are replaced to point to the VM.
+
+With --dry-run, the changes are printed as a shell script for review
+and manual application instead.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan := dryRun(cmd)
+		rm, conf, err := routeManager(cmd)
+		if err != nil {
+			return err
+		}
+		if err := routing.RepairPodRoutingForProfile(cmd.Context(), config.CurrentProfile().ID, conf); err != nil {
+			return err
+		}
+		if plan != nil {
+			return printPlan(cmd, plan)
+		}
+		return printRouteStatus(cmd, rm, false)
+	},
+}
+
+// routingPruneCmd represents the routing prune command
+var routingPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "remove orphaned routes",
+	Long: `Remove the orphaned routes of the profiles that are no longer running.
+
+Routes are orphaned when Colima crashes or the VM is deleted without
+cleaning up the routes. Routes are also pruned on 'colima start' and 'colima delete'.
+
+With --dry-run, the changes are printed as a shell script for review
+and manual application instead.`,
+	Args: cobra.NoArgs,
+	// the current profile is not required to be running
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return root.Cmd().PersistentPreRunE(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan := dryRun(cmd)
+		pruned, err := routing.PruneRoutes(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if plan != nil {
+			return printPlan(cmd, plan)
+		}
+
+		if routingCmdArgs.json {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			for _, p := range pruned {
+				if err := encoder.Encode(p); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+		_, _ = fmt.Fprintln(w, "PROFILE\tCIDR\tGATEWAY\tSTATUS")
+		for _, p := range pruned {
+			status := "removed"
+			if !p.Removed {
+				status = "not present"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", config.ProfileFromName(p.Profile).ShortName, p.CIDR, p.Gateway, status)
+		}
+		return w.Flush()
+	},
+}
+
+// dryRun sets up the command context for a dry-run, if enabled,
+// and returns the plan for the changes.
+func dryRun(cmd *cobra.Command) *routing.Plan {
+	if !routingCmdArgs.dryRun {
+		return nil
+	}
+	plan := &routing.Plan{}
+	cmd.SetContext(routing.WithDryRun(cmd.Context(), plan))
+	return plan
+}
+
+// printPlan prints the changes of a dry-run.
+func printPlan(cmd *cobra.Command, plan *routing.Plan) error {
+	if routingCmdArgs.json {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		// print change per line to conform with 'colima list'
+		for _, c := range plan.Changes {
+			if err := encoder.Encode(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(plan.Changes) == 0 {
+		_, _ = fmt.Fprintln(cmd.ErrOrStderr(), "no changes required")
+		return nil
+	}
+	_, err := fmt.Fprint(cmd.OutOrStdout(), plan.Script())
+	return err
+}
+
+// routeManager returns the route manager and config for the current profile.
+func routeManager(cmd *cobra.Command) (*routing.RouteManager, config.Config, error) {
+	profile := config.CurrentProfile()
+	conf, err := configmanager.LoadFrom(profile.StateFile())
+	if err != nil {
+		return nil, conf, fmt.Errorf("error retrieving current config: %w", err)
+	}
+	rm, err := routing.ProfileRouteManager(cmd.Context(), profile.ID, conf)
+	return rm, conf, err
+}
+
+// printRouteStatus prints the status of the routes.
+// Unless always is set, the status is only printed for json output.
+func printRouteStatus(cmd *cobra.Command, rm *routing.RouteManager, always bool) error {
+	if !always && !routingCmdArgs.json {
+		return nil
+	}
+
+	statuses, err := rm.Status(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error retrieving route status: %w", err)
+	}
+
+	if routingCmdArgs.json {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		// print route per line to conform with 'colima list'
+		for _, s := range statuses {
+			if err := encoder.Encode(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NETWORK\tCIDR\tGATEWAY\tSTATUS")
+	for _, s := range statuses {
+		status := s.Status
+		if s.Status == routing.RouteStale {
+			status += " (via " + s.Current + ")"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Network, s.CIDR, s.Gateway, status)
+	}
+
+	return w.Flush()
+}
+
+func init() {
+	root.Cmd().AddCommand(routingCmd)
+	routingCmd.AddCommand(routingStatusCmd)
+	routingCmd.AddCommand(routingAddCmd)
+	routingCmd.AddCommand(routingRemoveCmd)
+	routingCmd.AddCommand(routingRepairCmd)
+	routingCmd.AddCommand(routingPruneCmd)
+
+	routingCmd.PersistentFlags().BoolVarP(&routingCmdArgs.json, "json", "j", false, "print json output")
+	routingAddCmd.Flags().BoolVar(&routingCmdArgs.dryRun, "dry-run", false, "print the changes without applying them")
+	routingRepairCmd.Flags().BoolVar(&routingCmdArgs.dryRun, "dry-run", false, "print the changes without applying them")
+	routingRemoveCmd.Flags().BoolVar(&routingCmdArgs.dryRun, "dry-run", false, "print the changes without applying them")
+	routingPruneCmd.Flags().BoolVar(&routingCmdArgs.dryRun, "dry-run", false, "print the changes without applying them")
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:     "snapshot",
+	Aliases: []string{"snapshots"},
+	Short:   "checkpoint and roll back the disk of the VM",
+	Long: `Checkpoint and roll back the disk of the VM, to return to a known-good state e.g. with
+the images pulled and the cluster seeded after destructive experiments.
+
+The VM must be stopped. The snapshots are copies of the disk, instant and sharing the unchanged
+blocks with the VM on copy-on-write filesystems e.g. APFS. The snapshots are removed with
+'colima delete'.`,
+}
+
+// snapshotCreateCmd represents the snapshot create command
+var snapshotCreateCmd = &cobra.Command{
+	Use:     "create NAME",
+	Short:   "create a snapshot of the VM",
+	Long:    `Create a snapshot of the disk of the stopped VM.`,
+	Example: "  colima stop && colima snapshot create seeded && colima start",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().CreateSnapshot(args[0])
+	},
+}
+
+// snapshotRestoreCmd represents the snapshot restore command
+var snapshotRestoreCmd = &cobra.Command{
+	Use:     "restore NAME",
+	Short:   "restore the VM to a snapshot",
+	Long:    `Restore the disk of the stopped VM to the snapshot, the changes since the snapshot are discarded.`,
+	Example: "  colima stop && colima snapshot restore seeded && colima start",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().RestoreSnapshot(args[0])
+	},
+}
+
+var snapshotListCmdArgs struct {
+	json bool
+}
+
+// snapshotListCmd represents the snapshot list command
+var snapshotListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list the snapshots of the VM",
+	Long:    `List the snapshots of the VM.`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		snapshots, err := newApp().Snapshots()
+		if err != nil {
+			return err
+		}
+
+		if snapshotListCmdArgs.json {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			// print snapshot per line to conform with 'colima list'
+			for _, s := range snapshots {
+				if err := encoder.Encode(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+		_, _ = fmt.Fprintln(w, "NAME\tCREATED\tSIZE")
+		for _, s := range snapshots {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, units.HumanDuration(time.Since(s.Created))+" ago", units.BytesSize(float64(s.Size)))
+		}
+		return w.Flush()
+	},
+}
+
+// snapshotDeleteCmd represents the snapshot delete command
+var snapshotDeleteCmd = &cobra.Command{
+	Use:     "delete NAME",
+	Aliases: []string{"rm"},
+	Short:   "delete a snapshot of the VM",
+	Long:    `Delete a snapshot of the VM.`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().DeleteSnapshot(args[0])
+	},
+}
+
+func init() {
+	root.Cmd().AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+
+	snapshotListCmd.Flags().BoolVarP(&snapshotListCmdArgs.json, "json", "j", false, "print json output")
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/abiosoft/colima/environment/container/docker"
 	"github.com/abiosoft/colima/environment/container/incus"
 	"github.com/abiosoft/colima/environment/container/kubernetes"
+	"github.com/abiosoft/colima/environment/vm/apple"
 	"github.com/abiosoft/colima/util"
 	"github.com/abiosoft/colima/util/osutil"
 	log "github.com/sirupsen/logrus"
@@ -34,13 +35,20 @@ var startCmd = &cobra.Command{
 
 Colima can also be configured with a YAML file.
 Run 'colima template' to set the default configurations or 'colima start --edit' to customize before startup.
+
+A new instance can be configured with a template file or https URL, e.g. exported with
+'colima template export', for identical environments across a team. The template of a URL
+is shown for confirmation, or opened in the editor with --edit.
 `,
 	Example: "  colima start\n" +
 		"  colima start --edit\n" +
+		"  colima start --template=team.yaml\n" +
+		"  colima start --template=https://example.com/colima/team.yaml\n" +
 		"  colima start --foreground\n" +
 		"  colima start --runtime containerd\n" +
 		"  colima start --kubernetes\n" +
 		"  colima start --runtime containerd --kubernetes\n" +
+		"  colima start --runtime containerd --migrate-images\n" +
 		"  colima start --cpu 4 --memory 8 --disk 100\n" +
 		"  colima start --arch aarch64\n" +
 		"  colima start --dns 1.1.1.1 --dns 8.8.8.8\n" +
@@ -64,6 +72,7 @@ Run 'colima template' to set the default configurations or 'colima start --edit'
 		if err != nil {
 			return err
 		}
+		conf.MigrateImages = startCmdArgs.MigrateImages
 
 		// validate config
 		if err := configmanager.ValidateConfig(conf); err != nil {
@@ -84,13 +93,25 @@ Run 'colima template' to set the default configurations or 'colima start --edit'
 		return start(app, conf)
 	},
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		// validate Lima version
-		if err := core.LimaVersionSupported(); err != nil {
-			return fmt.Errorf("lima compatibility error: %w", err)
+		// the template must be set with '=' as the value is optional
+		if startCmdArgs.Flags.Template == defaultTemplate && len(args) > 0 && templateArg(args[0]) {
+			return fmt.Errorf("use --template=%s to start with the template", args[0])
 		}
 
 		// combine args and current config file(if any)
-		prepareConfig(cmd)
+		if err := prepareConfig(cmd); err != nil {
+			return err
+		}
+
+		// the containers of the apple vmType are managed with the container command, Lima is not used
+		if startCmdArgs.VMType == apple.Name {
+			if !cmd.Flag("runtime").Changed {
+				startCmdArgs.Runtime = "none"
+			}
+		} else if err := core.LimaVersionSupported(); err != nil {
+			// validate Lima version
+			return fmt.Errorf("lima compatibility error: %w", err)
+		}
 
 		// validate config
 		if err := configmanager.ValidateConfig(startCmdArgs.Config); err != nil {
@@ -139,7 +160,7 @@ var startCmdArgs struct {
 		Foreground              bool
 		SaveConfig              bool
 		LegacyCPU               int // for backward compatibility
-		Template                bool
+		Template                string
 	}
 }
 
@@ -155,6 +176,9 @@ func init() {
 
 	mounts := strings.Join([]string{defaultMountTypeQEMU, "9p", "virtiofs"}, ", ")
 	types := strings.Join([]string{"qemu", "vz"}, ", ")
+	if util.MacOS15OrNewerOnArm() {
+		types += ", " + apple.Name + " (experimental)"
+	}
 
 	saveConfigDefault := true
 	if envSaveConfig.Exists() {
@@ -163,6 +187,7 @@ func init() {
 
 	root.Cmd().AddCommand(startCmd)
 	startCmd.Flags().StringVarP(&startCmdArgs.Runtime, "runtime", "r", docker.Name, "container runtime ("+runtimes+")")
+	startCmd.Flags().BoolVar(&startCmdArgs.MigrateImages, "migrate-images", false, "carry the images across when switching the runtime")
 	startCmd.Flags().BoolVar(&startCmdArgs.Flags.ActivateRuntime, "activate", true, "set as active Docker/Kubernetes context on startup")
 	startCmd.Flags().IntVarP(&startCmdArgs.CPU, "cpus", "c", defaultCPU, "number of CPUs")
 	startCmd.Flags().StringVar(&startCmdArgs.CPUType, "cpu-type", "", "the CPU type, options can be checked with 'qemu-system-"+defaultArch+" -cpu help'")
@@ -171,8 +196,9 @@ func init() {
 	startCmd.Flags().StringVarP(&startCmdArgs.Arch, "arch", "a", defaultArch, "architecture (aarch64, x86_64)")
 	startCmd.Flags().BoolVarP(&startCmdArgs.Flags.Foreground, "foreground", "f", false, "Keep colima in the foreground")
 	startCmd.Flags().StringVar(&startCmdArgs.Hostname, "hostname", "", "custom hostname for the virtual machine")
-	startCmd.Flags().StringVarP(&startCmdArgs.DiskImage, "disk-image", "i", "", "file path to a custom disk image")
-	startCmd.Flags().BoolVar(&startCmdArgs.Flags.Template, "template", false, "use the template file for initial configuration")
+	startCmd.Flags().StringVarP(&startCmdArgs.DiskImage, "disk-image", "i", "", "file path or URL of a custom disk image, URLs require diskImageDigest in the config file")
+	startCmd.Flags().StringVar(&startCmdArgs.Flags.Template, "template", "", "use the template file, or the file or https URL, for initial configuration")
+	startCmd.Flag("template").NoOptDefVal = defaultTemplate
 
 	// retain cpu flag for backward compatibility
 	startCmd.Flags().IntVar(&startCmdArgs.Flags.LegacyCPU, "cpu", defaultCPU, "number of CPUs")
@@ -193,6 +219,7 @@ func init() {
 			if util.MacOS13OrNewerOnArm() {
 				startCmd.Flags().BoolVar(&startCmdArgs.VZRosetta, "vz-rosetta", false, "enable Rosetta for amd64 emulation")
 				binfmtDesc += " (no-op if Rosetta is enabled)"
+				startCmd.Flags().BoolVar(&startCmdArgs.GPU, "gpu", false, "enable GPU acceleration for containers (requires vm-type vz and krunkit)")
 			}
 		}
 
@@ -200,6 +227,8 @@ func init() {
 		if util.MacOSNestedVirtualizationSupported() {
 			startCmd.Flags().BoolVarP(&startCmdArgs.NestedVirtualization, "nested-virtualization", "z", false, "enable nested virtualization")
 		}
+	} else if util.LinuxNestedVirtualizationSupported() {
+		startCmd.Flags().BoolVarP(&startCmdArgs.NestedVirtualization, "nested-virtualization", "z", false, "enable nested virtualization")
 	}
 
 	// binfmt
@@ -223,7 +252,7 @@ func init() {
 	// k8s
 	startCmd.Flags().BoolVarP(&startCmdArgs.Kubernetes.Enabled, "kubernetes", "k", false, "start with Kubernetes")
 	startCmd.Flags().BoolVar(&startCmdArgs.Flags.LegacyKubernetes, "with-kubernetes", false, "start with Kubernetes")
-	startCmd.Flags().StringVar(&startCmdArgs.Kubernetes.Version, "kubernetes-version", defaultKubernetesVersion, "must match a k3s version https://github.com/k3s-io/k3s/releases")
+	startCmd.Flags().StringVar(&startCmdArgs.Kubernetes.Version, "kubernetes-version", defaultKubernetesVersion, "must match a k3s version https://github.com/k3s-io/k3s/releases, or a channel e.g. stable")
 	startCmd.Flags().StringSliceVar(&startCmdArgs.Flags.LegacyKubernetesDisable, "kubernetes-disable", nil, "components to disable for k3s e.g. traefik,servicelb")
 	startCmd.Flags().StringSliceVar(&startCmdArgs.Kubernetes.K3sArgs, "k3s-arg", defaultK3sArgs, "additional args to pass to k3s")
 	startCmd.Flag("with-kubernetes").Hidden = true
@@ -353,7 +382,7 @@ func setFixedConfigs(conf *config.Config) {
 	}
 
 	// override the fixed configs
-	// arch, vmType, mountType, runtime are fixed and cannot be changed
+	// arch, vmType, gpu, mountType are fixed and cannot be changed
 	if fixedConf.Arch != "" {
 		warnIfNotEqual("architecture", conf.Arch, fixedConf.Arch)
 		conf.Arch = fixedConf.Arch
@@ -362,9 +391,22 @@ func setFixedConfigs(conf *config.Config) {
 		warnIfNotEqual("virtual machine type", conf.VMType, fixedConf.VMType)
 		conf.VMType = fixedConf.VMType
 	}
-	if fixedConf.Runtime != "" {
-		warnIfNotEqual("runtime", conf.Runtime, fixedConf.Runtime)
-		conf.Runtime = fixedConf.Runtime
+	// the GPU changes the driver of the VM
+	if fixedConf.Runtime != "" && conf.GPU != fixedConf.GPU {
+		warnIfNotEqual("gpu", fmt.Sprint(conf.GPU), fmt.Sprint(fixedConf.GPU))
+		conf.GPU = fixedConf.GPU
+	}
+	// the runtime is switched in place without recreating the VM, except for incus
+	if fixedConf.Runtime != "" && conf.Runtime != fixedConf.Runtime {
+		if conf.Runtime == incus.Name || fixedConf.Runtime == incus.Name {
+			log.Warnln(fmt.Errorf("'runtime' cannot be switched to or from %s after initial setup, discarded", incus.Name))
+			conf.Runtime = fixedConf.Runtime
+		} else {
+			log.Infof("switching runtime from %s to %s", fixedConf.Runtime, conf.Runtime)
+			if !conf.MigrateImages {
+				log.Infof("the images of %s are not carried across, use --migrate-images to carry them across", fixedConf.Runtime)
+			}
+		}
 	}
 	if fixedConf.MountType != "" {
 		warnIfNotEqual("volume mount type", conf.MountType, fixedConf.MountType)
@@ -376,7 +418,7 @@ func setFixedConfigs(conf *config.Config) {
 	}
 }
 
-func prepareConfig(cmd *cobra.Command) {
+func prepareConfig(cmd *cobra.Command) error {
 	current, err := configmanager.Load()
 	if err != nil {
 		// not fatal, will proceed with defaults
@@ -415,18 +457,27 @@ func prepareConfig(cmd *cobra.Command) {
 		templateUsed := false
 
 		// attempt template if enabled
-		if startCmdArgs.Flags.Template {
+		if startCmdArgs.Flags.Template == defaultTemplate {
 			template, err := configmanager.LoadFrom(templateFile())
 			if err == nil {
 				current = template
 				templateUsed = true
 			}
+		} else if startCmdArgs.Flags.Template != "" {
+			template, err := loadTemplate(startCmdArgs.Flags.Template)
+			if err != nil {
+				return err
+			}
+			current = template
+			templateUsed = true
 		}
 
 		if !templateUsed {
 			// use default config if there is no template or template is disabled
-			return
+			return nil
 		}
+	} else if startCmdArgs.Flags.Template != "" && startCmdArgs.Flags.Template != defaultTemplate {
+		log.Warnln("template is only used for the initial configuration, ignoring")
 	}
 
 	// set missing defaults in the current config
@@ -434,8 +485,38 @@ func prepareConfig(cmd *cobra.Command) {
 
 	// docker can only be set in config file
 	startCmdArgs.Docker = current.Docker
+	// docker context can only be set in config file
+	startCmdArgs.DockerContext = current.DockerContext
+	// rootless can only be set in config file
+	startCmdArgs.Rootless = current.Rootless
+	// snapshotter can only be set in config file
+	startCmdArgs.Snapshotter = current.Snapshotter
+	// gc can only be set in config file
+	startCmdArgs.GC = current.GC
+	// registries can only be set in config file
+	startCmdArgs.Registries = current.Registries
+	// hostCredentials can only be set in config file
+	startCmdArgs.HostCredentials = current.HostCredentials
+	// watchdog can only be set in config file
+	startCmdArgs.Watchdog = current.Watchdog
+	// timeSync can only be set in config file
+	startCmdArgs.TimeSync = current.TimeSync
+	// buildkit can only be set in config file
+	startCmdArgs.BuildKit = current.BuildKit
+	// podman can only be set in config file
+	startCmdArgs.Podman = current.Podman
+	// wasm can only be set in config file
+	startCmdArgs.Wasm = current.Wasm
+	// sysbox can only be set in config file
+	startCmdArgs.Sysbox = current.Sysbox
+	// incus can only be set in config file
+	startCmdArgs.Incus = current.Incus
 	// provision scripts can only be set in config file
 	startCmdArgs.Provision = current.Provision
+	// cloud-init can only be set in config file
+	startCmdArgs.CloudInit = current.CloudInit
+	// proxy can only be set in config file
+	startCmdArgs.Proxy = current.Proxy
 
 	// use current settings for unchanged configs
 	// otherwise may be reverted to their default values.
@@ -454,6 +535,30 @@ func prepareConfig(cmd *cobra.Command) {
 	if !cmd.Flag("k3s-arg").Changed && current.Kubernetes.K3sArgs != nil {
 		startCmdArgs.Kubernetes.K3sArgs = current.Kubernetes.K3sArgs
 	}
+	// network CIDRs can only be set in config file
+	startCmdArgs.Kubernetes.Distro = current.Kubernetes.Distro
+	startCmdArgs.Kubernetes.Ingress = current.Kubernetes.Ingress
+	startCmdArgs.Kubernetes.CNI = current.Kubernetes.CNI
+	startCmdArgs.Kubernetes.Dashboard = current.Kubernetes.Dashboard
+	startCmdArgs.Kubernetes.PodCIDR = current.Kubernetes.PodCIDR
+	startCmdArgs.Kubernetes.ServiceCIDR = current.Kubernetes.ServiceCIDR
+	// nodes can only be set in config file
+	startCmdArgs.Kubernetes.Nodes = current.Kubernetes.Nodes
+	startCmdArgs.Kubernetes.Server = current.Kubernetes.Server
+	startCmdArgs.Kubernetes.Registry = current.Kubernetes.Registry
+	startCmdArgs.Kubernetes.Registries = current.Kubernetes.Registries
+	startCmdArgs.Kubernetes.LoadBalancer = current.Kubernetes.LoadBalancer
+	startCmdArgs.Kubernetes.Kubeconfig = current.Kubernetes.Kubeconfig
+	startCmdArgs.Kubernetes.Airgap = current.Kubernetes.Airgap
+	startCmdArgs.Kubernetes.ImageSync = current.Kubernetes.ImageSync
+	startCmdArgs.Kubernetes.Lazy = current.Kubernetes.Lazy
+	startCmdArgs.Kubernetes.GPU = current.Kubernetes.GPU
+	startCmdArgs.Kubernetes.NodeLabels = current.Kubernetes.NodeLabels
+	startCmdArgs.Kubernetes.NodeTaints = current.Kubernetes.NodeTaints
+	startCmdArgs.Kubernetes.KubeletArgs = current.Kubernetes.KubeletArgs
+	startCmdArgs.Kubernetes.TLSSANs = current.Kubernetes.TLSSANs
+	startCmdArgs.Kubernetes.AuditPolicy = current.Kubernetes.AuditPolicy
+	startCmdArgs.Kubernetes.PodSecurity = current.Kubernetes.PodSecurity
 	if !cmd.Flag("runtime").Changed {
 		startCmdArgs.Runtime = current.Runtime
 	}
@@ -493,6 +598,25 @@ func prepareConfig(cmd *cobra.Command) {
 	if !cmd.Flag("env").Changed {
 		startCmdArgs.Env = current.Env
 	}
+	if !cmd.Flag("disk-image").Changed {
+		startCmdArgs.DiskImage = current.DiskImage
+	}
+	// disk image digest can only be set in config file
+	startCmdArgs.DiskImageDigest = current.DiskImageDigest
+	// distro can only be set in config file
+	startCmdArgs.Distro = current.Distro
+	// guest can only be set in config file
+	startCmdArgs.Guest = current.Guest
+	// swap can only be set in config file
+	startCmdArgs.Swap = current.Swap
+	// display can only be set in config file
+	startCmdArgs.Display = current.Display
+	// vm opts can only be set in config file
+	startCmdArgs.VMOpts = current.VMOpts
+	// disks can only be set in config file
+	startCmdArgs.Disks = current.Disks
+	// usb devices can only be set in config file
+	startCmdArgs.USBDevices = current.USBDevices
 	if !cmd.Flag("hostname").Changed {
 		startCmdArgs.Hostname = current.Hostname
 	}
@@ -509,10 +633,34 @@ func prepareConfig(cmd *cobra.Command) {
 	if !cmd.Flag("network-host-addresses").Changed {
 		startCmdArgs.Network.HostAddresses = current.Network.HostAddresses
 	}
+	// cluster DNS, container routes, pod access, static IP, additional networks, mDNS
+	// and the DNS search and per-domain resolvers can only be set in config file
+	startCmdArgs.Network.ClusterDNS = current.Network.ClusterDNS
+	startCmdArgs.Network.DNSSearch = current.Network.DNSSearch
+	startCmdArgs.Network.DNSDomains = current.Network.DNSDomains
+	startCmdArgs.Network.ContainerRoutes = current.Network.ContainerRoutes
+	startCmdArgs.Network.PodAccess = current.Network.PodAccess
+	startCmdArgs.Network.StaticIP = current.Network.StaticIP
+	startCmdArgs.Network.Mode = current.Network.Mode
+	startCmdArgs.Network.Interface = current.Network.Interface
+	startCmdArgs.Network.Networks = current.Network.Networks
+	startCmdArgs.Network.MDNS = current.Network.MDNS
+	startCmdArgs.Network.MDNSContainers = current.Network.MDNSContainers
+	startCmdArgs.Network.PortForwards = current.Network.PortForwards
+	startCmdArgs.Network.BindAddress = current.Network.BindAddress
+	startCmdArgs.Network.PortBindings = current.Network.PortBindings
+	startCmdArgs.Network.ReversePortForwards = current.Network.ReversePortForwards
+	startCmdArgs.Network.SOCKSPort = current.Network.SOCKSPort
+	startCmdArgs.Network.HostsFile = current.Network.HostsFile
+	startCmdArgs.Network.MTU = current.Network.MTU
+	startCmdArgs.Network.Peers = current.Network.Peers
+	startCmdArgs.Network.IPv6 = current.Network.IPv6
 	if util.MacOS() {
 		if !cmd.Flag("network-address").Changed {
 			startCmdArgs.Network.Address = current.Network.Address
 		}
+		// persisting routes can only be set in config file
+		startCmdArgs.Network.PersistRoutes = current.Network.PersistRoutes
 		if util.MacOS13OrNewer() {
 			if !cmd.Flag("vm-type").Changed {
 				startCmdArgs.VMType = current.VMType
@@ -522,15 +670,22 @@ func prepareConfig(cmd *cobra.Command) {
 			if !cmd.Flag("vz-rosetta").Changed {
 				startCmdArgs.VZRosetta = current.VZRosetta
 			}
-		}
-		if util.MacOSNestedVirtualizationSupported() {
-			if !cmd.Flag("nested-virtualization").Changed {
-				startCmdArgs.NestedVirtualization = current.NestedVirtualization
+			if !cmd.Flag("gpu").Changed {
+				startCmdArgs.GPU = current.GPU
 			}
 		}
+	} else {
+		// network address can only be set in config file on Linux, it enables Pod routing
+		startCmdArgs.Network.Address = current.Network.Address
+	}
+	// the flag is only available if supported, the config is retained for the warning otherwise
+	if f := cmd.Flag("nested-virtualization"); f == nil || !f.Changed {
+		startCmdArgs.NestedVirtualization = current.NestedVirtualization
 	}
 
 	setFixedConfigs(&startCmdArgs.Config)
+
+	return nil
 }
 
 // editConfigFile launches an editor to edit the config file.
@@ -1,15 +1,24 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/cmd/root"
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/config/configmanager"
 	"github.com/abiosoft/colima/embedded"
+	"github.com/abiosoft/colima/util/yamlutil"
 	"github.com/spf13/cobra"
 )
 
@@ -67,6 +76,94 @@ var templateCmd = &cobra.Command{
 	},
 }
 
+// templateExportCmd represents the template export command
+var templateExportCmd = &cobra.Command{
+	Use:   "export FILE",
+	Short: "export the configuration of the profile as a template",
+	Long: `Export the configuration of the profile as a template, written to the standard output if
+FILE is '-'.
+
+The template configures new instances with 'colima start --template=FILE', the file can be
+shared e.g. in the repository of a project or at a URL.
+
+The secrets are not exported, the registry passwords, the environment variables and the
+credentials of the proxy are replaced with placeholders to be filled in.`,
+	Example: "  colima template export team.yaml\n" +
+		"  colima template export --profile dev -",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profile := config.CurrentProfile()
+		conf, err := configmanager.LoadFrom(profile.File())
+		if err != nil {
+			return fmt.Errorf("profile '%s' is not configured: %w", profile.ShortName, err)
+		}
+
+		// the default hostname is of the profile
+		if conf.Hostname == profile.ID {
+			conf.Hostname = ""
+		}
+		if keys := redactTemplate(&conf); len(keys) > 0 {
+			log.Printf("warning: secrets replaced with %s in the template: %s", redacted, strings.Join(keys, ", "))
+		}
+
+		b, err := yamlutil.Encode(conf)
+		if err != nil {
+			return fmt.Errorf("error exporting template: %w", err)
+		}
+		if args[0] == "-" {
+			_, err = cmd.OutOrStdout().Write(b)
+			return err
+		}
+		if err := os.WriteFile(args[0], b, 0600); err != nil {
+			return fmt.Errorf("error exporting template: %w", err)
+		}
+		log.Println("template exported to", args[0])
+		return nil
+	},
+}
+
+// redacted is the placeholder of the secrets of an exported template.
+const redacted = "REDACTED"
+
+// redactTemplate replaces the secrets of the config with placeholders, for the config to be
+// shared as a template. It returns the keys of the replaced secrets.
+func redactTemplate(conf *config.Config) []string {
+	var keys []string
+
+	redactRegistries := func(key string, registries []config.RegistryHost) {
+		for i := range registries {
+			if registries[i].Password != "" {
+				registries[i].Password = redacted
+				keys = append(keys, fmt.Sprintf("%s[%d].password", key, i))
+			}
+		}
+	}
+	redactRegistries("registries", conf.Registries)
+	redactRegistries("kubernetes.registries", conf.Kubernetes.Registries)
+
+	env := make(map[string]string, len(conf.Env))
+	for k := range conf.Env {
+		env[k] = redacted
+		keys = append(keys, "env."+k)
+	}
+	if len(env) > 0 {
+		conf.Env = env
+	}
+
+	for key, proxy := range map[string]*string{"proxy.http": &conf.Proxy.HTTP, "proxy.https": &conf.Proxy.HTTPS} {
+		u, err := url.Parse(*proxy)
+		if err != nil || u.User == nil {
+			continue
+		}
+		u.User = url.UserPassword(redacted, redacted)
+		*proxy = u.String()
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
 func templateFile() string { return filepath.Join(config.TemplatesDir(), "default.yaml") }
 
 func templateFileOrDefault() (string, error) {
@@ -81,6 +178,82 @@ func templateFileOrDefault() (string, error) {
 	return embedded.ReadString("defaults/colima.yaml")
 }
 
+// defaultTemplate is the value of the template flag of start for the template file.
+const defaultTemplate = "default"
+
+// templateArg returns if the arg is a template file or URL rather than a profile.
+func templateArg(arg string) bool {
+	return remoteTemplate(arg) || strings.HasSuffix(arg, ".yaml") || strings.HasSuffix(arg, ".yml")
+}
+
+// remoteTemplate returns if the template is a URL.
+func remoteTemplate(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// loadTemplate loads the config template from the file or the URL.
+func loadTemplate(location string) (config.Config, error) {
+	file := location
+	if remoteTemplate(location) {
+		f, err := downloadTemplate(location)
+		if err != nil {
+			return config.Config{}, err
+		}
+		defer func() { _ = os.Remove(f) }()
+		file = f
+	}
+
+	conf, err := configmanager.LoadFrom(file)
+	if err != nil {
+		return conf, fmt.Errorf("error loading template: %w", err)
+	}
+	if conf.Empty() {
+		return conf, fmt.Errorf("error loading template: runtime not set in '%s'", location)
+	}
+	return conf, nil
+}
+
+// downloadTemplate downloads the template at the URL to a temporary file.
+// The template is shown for confirmation, unless it is edited before starting.
+func downloadTemplate(url string) (string, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return "", fmt.Errorf("error downloading template: '%s' is not an https URL", url)
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("error downloading template: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error downloading template: %s", resp.Status)
+	}
+
+	f, err := os.CreateTemp("", "colima-template-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	// a template is a small config file
+	var buf bytes.Buffer
+	if _, err := io.Copy(io.MultiWriter(f, &buf), io.LimitReader(resp.Body, 1<<20)); err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("error downloading template: %w", err)
+	}
+
+	// the template is reviewed in the editor with --edit
+	if !startCmdArgs.Flags.Edit {
+		fmt.Printf("template %s:\n\n%s\n", url, buf.String())
+		if !cli.Prompt("start with the template") {
+			_ = os.Remove(f.Name())
+			return "", fmt.Errorf("template not confirmed, review it with --edit")
+		}
+	}
+	return f.Name(), nil
+}
+
 var templateCmdArgs struct {
 	Editor string
 	Print  bool
@@ -88,6 +261,7 @@ var templateCmdArgs struct {
 
 func init() {
 	root.Cmd().AddCommand(templateCmd)
+	templateCmd.AddCommand(templateExportCmd)
 
 	templateCmd.Flags().StringVar(&templateCmdArgs.Editor, "editor", "", `editor to use for edit e.g. vim, nano, code (default "$EDITOR" env var)`)
 	templateCmd.Flags().BoolVar(&templateCmdArgs.Print, "print", false, `print out the configuration file path, without editing`)
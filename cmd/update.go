@@ -5,18 +5,43 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var updateCmdArgs struct {
+	cpus   int
+	memory float32
+}
+
 // statusCmd represents the status command
 var updateCmd = &cobra.Command{
 	Use:     "update [profile]",
 	Aliases: []string{"u", "up"},
 	Short:   "update the container runtime",
-	Long:    `Update the current container runtime.`,
-	Args:    cobra.MaximumNArgs(1),
+	Long: `Update the current container runtime.
+
+With --cpus or --memory, the resources of the VM are updated instead. The CPUs of the
+running VM are adjusted without a restart, up to the CPUs at startup. The VM is restarted
+otherwise, e.g. to change the memory.`,
+	Example: "  colima update\n" +
+		"  colima update --cpus 6 --memory 12",
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if cmd.Flag("cpu").Changed && !cmd.Flag("cpus").Changed {
+			cpus, _ := cmd.Flags().GetInt("cpu")
+			updateCmdArgs.cpus = cpus
+		}
+		if updateCmdArgs.cpus > 0 || updateCmdArgs.memory > 0 {
+			return newApp().UpdateResources(updateCmdArgs.cpus, updateCmdArgs.memory)
+		}
 		return newApp().Update()
 	},
 }
 
 func init() {
 	root.Cmd().AddCommand(updateCmd)
+
+	updateCmd.Flags().IntVarP(&updateCmdArgs.cpus, "cpus", "c", 0, "number of CPUs")
+	updateCmd.Flags().Float32VarP(&updateCmdArgs.memory, "memory", "m", 0, "memory in GiB")
+
+	// cpu flag for consistency with the legacy flag of start
+	updateCmd.Flags().Int("cpu", 0, "number of CPUs")
+	updateCmd.Flag("cpu").Hidden = true
 }
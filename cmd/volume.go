@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/abiosoft/colima/cmd/root"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// volumeCmd represents the volume command
+var volumeCmd = &cobra.Command{
+	Use:     "volume",
+	Aliases: []string{"volumes", "vol"},
+	Short:   "back up and restore the volumes of the container runtime",
+	Long: `Back up and restore the volumes of the container runtime, to preserve the volumes
+across 'colima delete' or to move them between profiles.
+
+The volume contents are archived as a gzipped tar in the VM and streamed to the host.
+The volumes are of the active runtime, docker, containerd or podman.`,
+}
+
+// volumeListCmd represents the volume list command
+var volumeListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list the volumes of the container runtime",
+	Long:    `List the volumes of the container runtime.`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return newApp().ListVolumes()
+	},
+}
+
+// volumeBackupCmd represents the volume backup command
+var volumeBackupCmd = &cobra.Command{
+	Use:   "backup VOLUME FILE",
+	Short: "back up a volume to an archive on the host",
+	Long: `Back up the contents of a volume to a gzipped tar archive on the host, written to
+the standard output if FILE is '-'.
+
+The containers using the volume should be stopped for a consistent backup e.g. of a database.`,
+	Example: "  colima volume backup pgdata pgdata.tgz\n" +
+		"  colima volume backup pgdata - | ssh remote 'cat > pgdata.tgz'",
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := args[1]
+		if file == "-" {
+			if term.IsTerminal(int(os.Stdout.Fd())) {
+				return fmt.Errorf("refusing to write the archive to the terminal, set FILE or redirect the output")
+			}
+			file = ""
+		}
+		return newApp().BackupVolume(args[0], file, cmd.OutOrStdout())
+	},
+}
+
+var volumeRestoreCmdArgs struct {
+	force bool
+}
+
+// volumeRestoreCmd represents the volume restore command
+var volumeRestoreCmd = &cobra.Command{
+	Use:   "restore VOLUME FILE",
+	Short: "restore a volume from an archive on the host",
+	Long: `Restore the contents of a volume from a gzipped tar archive on the host, read from
+the standard input if FILE is '-'.
+
+The volume is created if it does not exist. An existing volume must be empty, unless --force
+is set to extract the archive over the contents of the volume.`,
+	Example: "  colima volume restore pgdata pgdata.tgz\n" +
+		"  colima volume restore --profile other pgdata pgdata.tgz\n" +
+		"  ssh remote 'cat pgdata.tgz' | colima volume restore pgdata -",
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := args[1]
+		if file == "-" {
+			file = ""
+		}
+		return newApp().RestoreVolume(args[0], file, cmd.InOrStdin(), volumeRestoreCmdArgs.force)
+	},
+}
+
+func init() {
+	root.Cmd().AddCommand(volumeCmd)
+	volumeCmd.AddCommand(volumeListCmd)
+	volumeCmd.AddCommand(volumeBackupCmd)
+	volumeCmd.AddCommand(volumeRestoreCmd)
+
+	volumeRestoreCmd.Flags().BoolVarP(&volumeRestoreCmdArgs.force, "force", "f", false, "restore over the contents of a non-empty volume")
+}
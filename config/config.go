@@ -1,8 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"net"
+	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/abiosoft/colima/util"
 	"github.com/abiosoft/colima/util/osutil"
@@ -32,10 +38,12 @@ type Config struct {
 	CPU      int               `yaml:"cpu,omitempty"`
 	Disk     int               `yaml:"disk,omitempty"`
 	Memory   float32           `yaml:"memory,omitempty"`
+	Swap     Swap              `yaml:"swap,omitempty"`
 	Arch     string            `yaml:"arch,omitempty"`
 	CPUType  string            `yaml:"cpuType,omitempty"`
 	Network  Network           `yaml:"network,omitempty"`
 	Env      map[string]string `yaml:"env,omitempty"` // environment variables
+	Proxy    Proxy             `yaml:"proxy,omitempty"`
 	Hostname string            `yaml:"hostname"`
 
 	// SSH
@@ -48,15 +56,29 @@ type Config struct {
 	VZRosetta            bool   `yaml:"rosetta,omitempty"`
 	Binfmt               *bool  `yaml:"binfmt,omitempty"`
 	NestedVirtualization bool   `yaml:"nestedVirtualization,omitempty"`
+	GPU                  bool   `yaml:"gpu,omitempty"`     // Vulkan acceleration with virtio-gpu Venus, vz on Apple Silicon only
+	Display              string `yaml:"display,omitempty"` // none, vnc (qemu only) or window, defaults to none
 	DiskImage            string `yaml:"diskImage,omitempty"`
+	DiskImageDigest      string `yaml:"diskImageDigest,omitempty"` // sha256 or sha512 digest of a custom disk image
+	Distro               string `yaml:"distro,omitempty"`          // distro of a custom disk image, defaults to ubuntu
+	VMOpts               VMOpts `yaml:"vmOpts,omitempty"`          // options of the VM not modelled by Colima
+
+	// additional disks
+	Disks []Disk `yaml:"disks,omitempty"`
+
+	// USB devices of the host passed through to the VM, qemu only
+	USBDevices []USBDevice `yaml:"usbDevices,omitempty"`
 
 	// volume mounts
 	Mounts       []Mount `yaml:"mounts,omitempty"`
 	MountType    string  `yaml:"mountType,omitempty"`
 	MountINotify bool    `yaml:"mountInotify,omitempty"`
 
-	// Runtime is one of docker, containerd.
+	// Runtime is one of docker, containerd, incus, podman.
 	Runtime         string `yaml:"runtime,omitempty"`
+	Rootless        bool   `yaml:"rootless,omitempty"`    // rootless containerd of the user, containerd runtime only
+	MigrateImages   bool   `yaml:"-"`                     // images carried across a runtime switch, not persisted
+	Snapshotter     string `yaml:"snapshotter,omitempty"` // lazy-pulling snapshotter of containerd, stargz or nydus
 	ActivateRuntime *bool  `yaml:"autoActivate,omitempty"`
 
 	// Kubernetes configuration
@@ -65,23 +87,474 @@ type Config struct {
 	// Docker configuration
 	Docker map[string]any `yaml:"docker,omitempty"`
 
+	// DockerContext is the template of the docker context name, defaults to the profile ID
+	DockerContext string `yaml:"dockerContext,omitempty"`
+
+	// Podman configuration
+	Podman Podman `yaml:"podman,omitempty"`
+
+	// Wasm configuration
+	Wasm Wasm `yaml:"wasm,omitempty"`
+
+	// Sysbox runtime for nested containers e.g. docker-in-docker, docker and containerd runtimes only
+	Sysbox bool `yaml:"sysbox,omitempty"`
+
+	// Incus configuration
+	Incus Incus `yaml:"incus,omitempty"`
+
+	// BuildKit configuration
+	BuildKit BuildKit `yaml:"buildkit,omitempty"`
+
+	// GC is the scheduled pruning of the images and build cache of the container runtime
+	GC GC `yaml:"gc,omitempty"`
+
+	// Registries are the registry mirrors, credentials and TLS settings of the container runtime
+	// and Kubernetes.
+	Registries []RegistryHost `yaml:"registries,omitempty"`
+
+	// HostCredentials forwards the registry credential lookups of the clients and the kubelet
+	// to the credential helpers of the docker config of the host.
+	HostCredentials bool `yaml:"hostCredentials,omitempty"`
+
+	// Watchdog restarts the VM when the hypervisor process exits unexpectedly
+	Watchdog Watchdog `yaml:"watchdog,omitempty"`
+
+	// TimeSync corrects the clock drift of the VM from the host e.g. after the host sleeps
+	TimeSync bool `yaml:"timeSync,omitempty"`
+
+	// Guest is the kernel configuration of the VM
+	Guest Guest `yaml:"guest,omitempty"`
+
 	// provision scripts
 	Provision []Provision `yaml:"provision,omitempty"`
+
+	// cloud-config user-data of cloud-init, converted to provision scripts
+	CloudInit string `yaml:"cloudInit,omitempty"`
+}
+
+// Podman is podman configuration.
+type Podman struct {
+	Rootful bool `yaml:"rootful,omitempty"` // rootful podman as the default connection, rootless otherwise
+}
+
+// Wasm is the configuration of the WebAssembly shims of containerd.
+type Wasm struct {
+	Enabled bool     `yaml:"enabled"`
+	Shims   []string `yaml:"shims,omitempty"` // spin, wasmtime or wasmedge, all if empty
+}
+
+// WasmShims returns the WebAssembly shims to install, none if disabled.
+func (c Config) WasmShims() []string {
+	if !c.Wasm.Enabled {
+		return nil
+	}
+	if len(c.Wasm.Shims) == 0 {
+		return []string{"spin", "wasmtime", "wasmedge"}
+	}
+	return c.Wasm.Shims
+}
+
+// Incus is incus configuration.
+type Incus struct {
+	Project  string   `yaml:"project,omitempty"`  // project created if missing and selected on the host
+	Profiles []string `yaml:"profiles,omitempty"` // files of the profiles on the host, named after the file
+	APIPort  int      `yaml:"apiPort,omitempty"`  // host port of the HTTPS API, disabled if zero
+}
+
+// ProfileFiles returns the files of the profiles with ~ and environment variables expanded.
+func (i Incus) ProfileFiles() []string {
+	files := make([]string, 0, len(i.Profiles))
+	for _, p := range i.Profiles {
+		files = append(files, expandPath(p))
+	}
+	return files
+}
+
+// GC is the scheduled pruning of the unused images and build cache in the VM.
+type GC struct {
+	Enabled      bool   `yaml:"enabled"`
+	MaxDiskUsage int    `yaml:"maxDiskUsage,omitempty"` // disk usage percentage above which all unused images are pruned
+	MaxAge       string `yaml:"maxAge,omitempty"`       // age of the unused images and build cache pruned e.g. 168h
+	Schedule     string `yaml:"schedule,omitempty"`     // systemd calendar event e.g. daily, defaults to daily
+}
+
+// Watchdog is the automatic restart of the VM by the daemon when the hypervisor process exits
+// unexpectedly.
+type Watchdog struct {
+	Enabled bool   `yaml:"enabled"`
+	Retries int    `yaml:"retries,omitempty"` // restart attempts before giving up, defaults to 3
+	Backoff string `yaml:"backoff,omitempty"` // delay of the first restart e.g. 10s, doubled for each attempt, defaults to 10s
+}
+
+// RetriesOrDefault returns the restart attempts of the watchdog.
+func (w Watchdog) RetriesOrDefault() int {
+	if w.Retries > 0 {
+		return w.Retries
+	}
+	return 3
+}
+
+// BackoffOrDefault returns the delay of the first restart of the watchdog.
+func (w Watchdog) BackoffOrDefault() time.Duration {
+	if d, err := time.ParseDuration(w.Backoff); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Second
+}
+
+// BuildKit is the configuration of the dedicated buildkitd in the VM.
+type BuildKit struct {
+	Enabled        bool     `yaml:"enabled"`
+	Worker         string   `yaml:"worker,omitempty"`         // oci or containerd, defaults to oci
+	MaxParallelism int      `yaml:"maxParallelism,omitempty"` // maximum parallel build steps, unlimited if 0
+	CacheSize      string   `yaml:"cacheSize,omitempty"`      // maximum size of the build cache e.g. 20GB, the buildkit default if empty
+	Mirrors        []string `yaml:"mirrors,omitempty"`        // registry mirrors of docker.io e.g. mirror.gcr.io
 }
 
 // Kubernetes is kubernetes configuration
 type Kubernetes struct {
-	Enabled bool     `yaml:"enabled"`
-	Version string   `yaml:"version"`
-	K3sArgs []string `yaml:"k3sArgs"`
+	Enabled     bool     `yaml:"enabled"`
+	Distro      string   `yaml:"distro,omitempty"`    // k3s or k0s, defaults to k3s
+	Ingress     string   `yaml:"ingress,omitempty"`   // traefik, nginx or none, defaults to the k3s args
+	CNI         string   `yaml:"cni,omitempty"`       // flannel, calico, cilium or none, defaults to the distro default
+	Dashboard   string   `yaml:"dashboard,omitempty"` // kubernetes-dashboard, headlamp or none, defaults to none
+	Version     string   `yaml:"version"`
+	K3sArgs     []string `yaml:"k3sArgs"`
+	PodCIDR     string   `yaml:"podCIDR,omitempty"`
+	ServiceCIDR string   `yaml:"serviceCIDR,omitempty"`
+	Nodes       int      `yaml:"nodes,omitempty"`     // number of nodes, each in a VM, the server and nodes-1 agents
+	Server      string   `yaml:"server,omitempty"`    // profile of the k3s server, set for the agent nodes
+	ImageSync   *bool    `yaml:"imageSync,omitempty"` // sync the docker images to the cluster not using docker, defaults to true
+	Lazy        bool     `yaml:"lazy,omitempty"`      // k3s started on the first API request
+	GPU         *bool    `yaml:"gpu,omitempty"`       // GPU device plugin if the VM has a GPU, defaults to true
+
+	NodeLabels  map[string]string `yaml:"nodeLabels,omitempty"`  // labels of the server node
+	NodeTaints  []string          `yaml:"nodeTaints,omitempty"`  // taints of the server node e.g. key=value:NoSchedule
+	KubeletArgs []string          `yaml:"kubeletArgs,omitempty"` // args of the kubelet of all the nodes e.g. max-pods=200
+	TLSSANs     []string          `yaml:"tlsSANs,omitempty"`     // additional hostnames and IPs of the API server certificate
+	AuditPolicy string            `yaml:"auditPolicy,omitempty"` // audit policy file on the host, audit logging is disabled if empty
+
+	Registry     KubernetesRegistry     `yaml:"registry,omitempty"`     // local image registry
+	Registries   []RegistryHost         `yaml:"registries,omitempty"`   // registry mirrors, credentials and TLS settings, in addition to the registries of the runtime
+	PodSecurity  KubernetesPodSecurity  `yaml:"podSecurity,omitempty"`  // Pod Security Admission defaults
+	LoadBalancer KubernetesLoadBalancer `yaml:"loadBalancer,omitempty"` // LoadBalancer services reachable from the host
+	Kubeconfig   KubernetesKubeconfig   `yaml:"kubeconfig,omitempty"`   // kubeconfig on the host
+	Airgap       KubernetesAirgap       `yaml:"airgap,omitempty"`       // offline installation of k3s
+}
+
+// AuditPolicyFile returns the audit policy file with ~ and environment variables expanded,
+// empty if audit logging is disabled.
+func (k Kubernetes) AuditPolicyFile() string {
+	if k.AuditPolicy == "" {
+		return ""
+	}
+	return expandPath(k.AuditPolicy)
+}
+
+// KubernetesPodSecurity are the cluster-wide defaults of the Pod Security Admission, for the
+// namespaces without the pod-security.kubernetes.io labels.
+type KubernetesPodSecurity struct {
+	Enforce          string   `yaml:"enforce,omitempty"`          // privileged, baseline or restricted, defaults to privileged
+	Audit            string   `yaml:"audit,omitempty"`            // level of the audit annotations, defaults to privileged
+	Warn             string   `yaml:"warn,omitempty"`             // level of the user warnings, defaults to privileged
+	Version          string   `yaml:"version,omitempty"`          // version of the policies e.g. v1.33, defaults to latest
+	ExemptNamespaces []string `yaml:"exemptNamespaces,omitempty"` // namespaces exempted in addition to the system namespaces
+}
+
+// Enabled returns if the defaults are set, the Pod Security Admission is enabled regardless.
+func (p KubernetesPodSecurity) Enabled() bool {
+	return p.Enforce != "" || p.Audit != "" || p.Warn != ""
+}
+
+// KubernetesAirgap is the installation of k3s from the files on the host, without internet access.
+type KubernetesAirgap struct {
+	Binary string   `yaml:"binary,omitempty"` // k3s binary
+	Script string   `yaml:"script,omitempty"` // k3s install script
+	Images []string `yaml:"images,omitempty"` // image tarballs e.g. k3s-airgap-images-arm64.tar.gz and the images of the CNI plugin
+}
+
+// Enabled returns if k3s is installed from the files on the host.
+func (a KubernetesAirgap) Enabled() bool { return a.Binary != "" }
+
+// Expanded returns the airgap files with ~ and environment variables expanded.
+func (a KubernetesAirgap) Expanded() KubernetesAirgap {
+	expanded := KubernetesAirgap{}
+	if a.Binary != "" {
+		expanded.Binary = expandPath(a.Binary)
+	}
+	if a.Script != "" {
+		expanded.Script = expandPath(a.Script)
+	}
+	for _, image := range a.Images {
+		expanded.Images = append(expanded.Images, expandPath(image))
+	}
+	return expanded
+}
+
+// KubernetesKubeconfig is the handling of the kubeconfig of the cluster on the host.
+type KubernetesKubeconfig struct {
+	Context           string `yaml:"context,omitempty"`           // template of the context name, defaults to the profile ID
+	File              string `yaml:"file,omitempty"`              // standalone kubeconfig, merged into $KUBECONFIG or ~/.kube/config if empty
+	SetCurrentContext *bool  `yaml:"setCurrentContext,omitempty"` // defaults to autoActivate
+	Cleanup           *bool  `yaml:"cleanup,omitempty"`           // removed on reset and delete, defaults to true
+}
+
+// DefaultKubeconfigContext is the default template of the kubeconfig context name.
+const DefaultKubeconfigContext = "{{.ID}}"
+
+// ContextName returns the name of the kubeconfig context, cluster and user for the profile.
+// The template has access to the ID and ShortName of the profile.
+func (k KubernetesKubeconfig) ContextName(p *Profile) (string, error) {
+	return contextName("kubeconfig", k.Context, DefaultKubeconfigContext, p)
+}
+
+// DefaultDockerContext is the default template of the docker context name.
+const DefaultDockerContext = "{{.ID}}"
+
+// DockerContextName returns the name of the docker context for the profile.
+// The template has access to the ID and ShortName of the profile.
+func (c Config) DockerContextName(p *Profile) (string, error) {
+	return contextName("docker", c.DockerContext, DefaultDockerContext, p)
+}
+
+// contextName returns the context name of the template for the profile, the default template
+// if empty.
+func contextName(kind, tmpl, defaultTmpl string, p *Profile) (string, error) {
+	if tmpl == "" {
+		tmpl = defaultTmpl
+	}
+	b, err := util.ParseTemplate(tmpl, p)
+	if err != nil {
+		return "", fmt.Errorf("error parsing %s context: %w", kind, err)
+	}
+	name := strings.TrimSpace(string(b))
+	if name == "" {
+		return "", fmt.Errorf("empty %s context for template '%s'", kind, tmpl)
+	}
+	return name, nil
+}
+
+// FilePath returns the path of the standalone kubeconfig with ~ and environment variables expanded,
+// empty if the kubeconfig is merged.
+func (k KubernetesKubeconfig) FilePath() string {
+	if k.File == "" {
+		return ""
+	}
+	return expandPath(k.File)
+}
+
+// expandPath returns the path with ~ and environment variables expanded.
+func expandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if strings.HasPrefix(path, "~") {
+		path = strings.Replace(path, "~", util.HomeDir(), 1)
+	}
+	return filepath.Clean(path)
+}
+
+// CurrentContext returns if the context is set as the current context of the merged kubeconfig.
+func (k KubernetesKubeconfig) CurrentContext(autoActivate bool) bool {
+	if k.SetCurrentContext == nil {
+		return autoActivate
+	}
+	return *k.SetCurrentContext
+}
+
+// CleanupEnabled returns if the kubeconfig is removed on reset and delete. It is enabled by default.
+func (k KubernetesKubeconfig) CleanupEnabled() bool {
+	return k.Cleanup == nil || *k.Cleanup
+}
+
+// KubernetesLoadBalancer is the LoadBalancer service support, with the IPs allocated from a pool
+// routed from the host to the VM.
+type KubernetesLoadBalancer struct {
+	Enabled bool   `yaml:"enabled"`
+	CIDR    string `yaml:"cidr,omitempty"` // pool of the IPs, defaults to 10.44.0.0/24
+
+	// ports of the LoadBalancer services forwarded to the host, with or without the pool
+	HostPorts   bool        `yaml:"hostPorts,omitempty"`
+	HostPortMap map[int]int `yaml:"hostPortMap,omitempty"` // service port to host port e.g. 80: 8080
+}
+
+// DefaultLoadBalancerCIDR is the default pool of the LoadBalancer IPs.
+const DefaultLoadBalancerCIDR = "10.44.0.0/24"
+
+// LoadBalancerCIDR returns the pool of the LoadBalancer IPs, empty if disabled.
+func (k Kubernetes) LoadBalancerCIDR() string {
+	switch {
+	case !k.Enabled || !k.LoadBalancer.Enabled:
+		return ""
+	case k.LoadBalancer.CIDR != "":
+		return k.LoadBalancer.CIDR
+	}
+	return DefaultLoadBalancerCIDR
+}
+
+// KubernetesRegistry is the local image registry for the Kubernetes cluster, running in the VM.
+type KubernetesRegistry struct {
+	Enabled bool `yaml:"enabled"`
+	Port    int  `yaml:"port,omitempty"` // port in the VM and on the host, defaults to 5000
+}
+
+// DefaultRegistryPort is the default port of the local image registry.
+const DefaultRegistryPort = 5000
+
+// PortOrDefault returns the port of the registry, the default port if unset.
+func (r KubernetesRegistry) PortOrDefault() int {
+	if r.Port > 0 {
+		return r.Port
+	}
+	return DefaultRegistryPort
+}
+
+// RegistryHost is the mirrors, credentials and TLS settings of a registry.
+type RegistryHost struct {
+	Host               string   `yaml:"host"`                         // registry host e.g. docker.io or registry.example.com:5000
+	Mirrors            []string `yaml:"mirrors,omitempty"`            // mirror endpoints e.g. https://mirror.example.com
+	Username           string   `yaml:"username,omitempty"`           // credentials of the registry
+	Password           string   `yaml:"password,omitempty"`           // credentials of the registry
+	Insecure           bool     `yaml:"insecure,omitempty"`           // plain HTTP registry
+	InsecureSkipVerify bool     `yaml:"insecureSkipVerify,omitempty"` // skip the TLS verification of the registry and mirrors
+}
+
+// KubernetesRegistries returns the registries of the cluster, the registries of the container
+// runtime with kubernetes.registries taking precedence for the same host.
+func (c Config) KubernetesRegistries() []RegistryHost {
+	var registries []RegistryHost
+	for _, r := range c.Registries {
+		if !slices.ContainsFunc(c.Kubernetes.Registries, func(k RegistryHost) bool { return k.Host == r.Host }) {
+			registries = append(registries, r)
+		}
+	}
+	return append(registries, c.Kubernetes.Registries...)
+}
+
+// ImageSyncEnabled returns if the images of the docker runtime are synced to the cluster,
+// for the distributions without support for docker. It is enabled by default.
+func (k Kubernetes) ImageSyncEnabled() bool {
+	return k.ImageSync == nil || *k.ImageSync
+}
+
+// GPUEnabled returns if the GPU of the VM, if any, is exposed to the pods.
+func (k Kubernetes) GPUEnabled() bool {
+	return k.GPU == nil || *k.GPU
+}
+
+// MaxNodes is the maximum number of Kubernetes nodes.
+const MaxNodes = 8
+
+// Agent returns if the node is an agent of the k3s server of another profile.
+func (k Kubernetes) Agent() bool { return k.Server != "" }
+
+// AgentNodes returns the number of agent nodes of the k3s server.
+func (k Kubernetes) AgentNodes() int {
+	if !k.Enabled || k.Agent() || k.Nodes <= 1 {
+		return 0
+	}
+	return k.Nodes - 1
+}
+
+// Proxy is the proxy configuration for the VM, the container runtimes and Kubernetes.
+type Proxy struct {
+	HTTP    string   `yaml:"http,omitempty"`
+	HTTPS   string   `yaml:"https,omitempty"`
+	NoProxy []string `yaml:"noProxy,omitempty"` // addresses excluded in addition to the VM and cluster networks
+	System  bool     `yaml:"system,omitempty"`  // use the macOS system proxy settings if no proxy is set
 }
 
 // Network is VM network configuration
 type Network struct {
-	Address       bool              `yaml:"address"`
-	DNSResolvers  []net.IP          `yaml:"dns"`
-	DNSHosts      map[string]string `yaml:"dnsHosts"`
-	HostAddresses bool              `yaml:"hostAddresses"`
+	Address             bool                 `yaml:"address"`
+	DNSResolvers        []net.IP             `yaml:"dns"`
+	DNSHosts            map[string]string    `yaml:"dnsHosts"`
+	DNSSearch           []string             `yaml:"dnsSearch,omitempty"`  // search domains
+	DNSDomains          map[string][]net.IP  `yaml:"dnsDomains,omitempty"` // resolvers per domain e.g. for split DNS
+	HostAddresses       bool                 `yaml:"hostAddresses"`
+	PersistRoutes       bool                 `yaml:"persistRoutes,omitempty"`
+	ClusterDNS          bool                 `yaml:"clusterDNS,omitempty"`
+	ContainerRoutes     bool                 `yaml:"containerRoutes,omitempty"`
+	PodAccess           string               `yaml:"podAccess,omitempty"`           // route, pf or off
+	StaticIP            net.IP               `yaml:"staticIP,omitempty"`            // fixed address of the reachable network interface
+	Mode                string               `yaml:"mode,omitempty"`                // vmnet mode of the reachable network: shared, host or bridged
+	Interface           string               `yaml:"interface,omitempty"`           // host network interface for the bridged mode e.g. en0
+	Networks            []VMNetwork          `yaml:"networks,omitempty"`            // additional networks
+	MDNS                bool                 `yaml:"mdns,omitempty"`                // advertise the VM hostname via mDNS
+	MDNSContainers      bool                 `yaml:"mdnsContainers,omitempty"`      // advertise the container hostnames via mDNS
+	PortForwards        []PortForward        `yaml:"portForwards,omitempty"`        // port forwards from the host to the VM
+	BindAddress         net.IP               `yaml:"bindAddress,omitempty"`         // host address of the forwarded ports listening on all the VM addresses
+	PortBindings        []PortBinding        `yaml:"portBindings,omitempty"`        // host addresses of specific forwarded ports, overriding the bind address
+	ReversePortForwards []ReversePortForward `yaml:"reversePortForwards,omitempty"` // port forwards from the VM to the host
+	SOCKSPort           int                  `yaml:"socksPort,omitempty"`           // port of the SOCKS5 proxy into the VM network on localhost
+	HostsFile           bool                 `yaml:"hostsFile,omitempty"`           // point the ingress and container hostnames to the VM in /etc/hosts
+	MTU                 int                  `yaml:"mtu,omitempty"`                 // MTU of the VM and container networks
+	Peers               []string             `yaml:"peers,omitempty"`               // profiles with networks reachable from the VM and vice versa
+	IPv6                bool                 `yaml:"ipv6,omitempty"`                // IPv6 for the VM, the containers and Kubernetes
+}
+
+// PortForward is a port forward from the host to the VM, exposing the guest port on the host.
+type PortForward struct {
+	GuestPort int    `yaml:"guestPort"`
+	HostPort  int    `yaml:"hostPort,omitempty"` // defaults to the guest port
+	HostIP    net.IP `yaml:"hostIP,omitempty"`   // defaults to 127.0.0.1
+	Protocol  string `yaml:"protocol,omitempty"` // tcp or udp, defaults to tcp
+}
+
+// PortBinding is the host address of a forwarded port listening on all the VM addresses
+// e.g. a published container port, overriding the bind address.
+type PortBinding struct {
+	Port     int    `yaml:"port"`
+	Address  net.IP `yaml:"address"`
+	Protocol string `yaml:"protocol,omitempty"` // tcp or udp, defaults to both
+}
+
+// BindAddressOrDefault returns the host address of the forwarded ports listening on all the VM addresses.
+// Defaults to 127.0.0.1, to prevent exposing the ports to the local network.
+func (n Network) BindAddressOrDefault() net.IP {
+	if n.BindAddress == nil {
+		return net.ParseIP("127.0.0.1")
+	}
+	return n.BindAddress
+}
+
+// ReversePortForward is a port forward from the VM to the host, exposing the host port in the VM
+// for reaching services on the host from the VM and the containers.
+type ReversePortForward struct {
+	GuestPort int    `yaml:"guestPort"`
+	HostPort  int    `yaml:"hostPort,omitempty"` // defaults to the guest port
+	HostIP    net.IP `yaml:"hostIP,omitempty"`   // defaults to 127.0.0.1
+}
+
+// VMNetwork is an additional network of the virtual machine.
+type VMNetwork struct {
+	Mode      string `yaml:"mode"`                // shared, host or bridged
+	Interface string `yaml:"interface,omitempty"` // host network interface for bridged mode e.g. en0
+}
+
+// Guest is the kernel configuration of the VM, applied on startup.
+type Guest struct {
+	Sysctls       map[string]string `yaml:"sysctls,omitempty"`       // kernel parameters e.g. fs.inotify.max_user_instances
+	KernelModules []string          `yaml:"kernelModules,omitempty"` // kernel modules loaded on boot e.g. nbd
+}
+
+// Swap is the swap of the VM, for the memory-constrained VMs.
+type Swap struct {
+	Size int  `yaml:"size,omitempty"` // size in GiB, disabled if 0 unless zram
+	ZRAM bool `yaml:"zram,omitempty"` // compressed swap in memory, half the memory if size is 0
+}
+
+// Enabled returns if the swap is enabled.
+func (s Swap) Enabled() bool { return s.Size > 0 || s.ZRAM }
+
+// VMOpts are the extra options of the VM, for the tweaks of the devices or the machine not
+// modelled by Colima.
+type VMOpts struct {
+	QEMU QEMUOpts       `yaml:"qemu,omitempty"`
+	VZ   map[string]any `yaml:"vz,omitempty"` // vmOpts.vz of the Lima config
+}
+
+// QEMUOpts are the extra options of the qemu VM.
+type QEMUOpts struct {
+	Args []string `yaml:"args,omitempty"` // arguments appended to the qemu command line
 }
 
 // Mount is volume mount
@@ -89,6 +562,88 @@ type Mount struct {
 	Location   string `yaml:"location"`
 	MountPoint string `yaml:"mountPoint,omitempty"`
 	Writable   bool   `yaml:"writable"`
+	MountType  string `yaml:"mountType,omitempty"` // overrides the mountType of the config
+}
+
+// SSHFSMountType returns if the mount type is sshfs, reverse-sshfs is the name of Lima.
+func SSHFSMountType(mountType string) bool {
+	return mountType == "sshfs" || mountType == "reverse-sshfs"
+}
+
+// MountTypeOf returns the mount type of the mount.
+func (c Config) MountTypeOf(m Mount) string {
+	if m.MountType != "" {
+		return m.MountType
+	}
+	return c.MountType
+}
+
+// LimaMountType returns the mount type of the mounts managed by Lima, a single mount type for
+// all the mounts. The virtiofs or 9p type of any mount takes precedence over sshfs.
+func (c Config) LimaMountType() string {
+	for _, m := range c.Mounts {
+		if t := c.MountTypeOf(m); !SSHFSMountType(t) {
+			return t
+		}
+	}
+	return c.MountType
+}
+
+// SSHFSMounts returns the sshfs mounts combined with the virtiofs or 9p mounts of Lima. The
+// mounts are managed by Colima with reverse sshfs.
+func (c Config) SSHFSMounts() []Mount {
+	if SSHFSMountType(c.LimaMountType()) {
+		return nil
+	}
+	var mounts []Mount
+	for _, m := range c.Mounts {
+		if SSHFSMountType(c.MountTypeOf(m)) {
+			mounts = append(mounts, m)
+		}
+	}
+	return mounts
+}
+
+// Disk is an additional disk of the VM, formatted and mounted in the VM.
+type Disk struct {
+	Name       string `yaml:"name"`
+	Size       int    `yaml:"size"`                 // size in GiB, can only be increased
+	FSType     string `yaml:"fsType,omitempty"`     // ext4 or xfs, defaults to ext4
+	MountPoint string `yaml:"mountPoint,omitempty"` // defaults to /mnt/<name>
+}
+
+// DefaultDiskFSType is the default filesystem of the additional disks.
+const DefaultDiskFSType = "ext4"
+
+// MountPointOrDefault returns the mount point of the disk in the VM.
+func (d Disk) MountPointOrDefault() string {
+	if d.MountPoint != "" {
+		return d.MountPoint
+	}
+	return "/mnt/" + d.Name
+}
+
+// USBDevice is a USB device of the host, identified by the hexadecimal vendor and product ids
+// e.g. 0x0483 and 0x3748 as listed by lsusb or system_profiler SPUSBDataType.
+type USBDevice struct {
+	VendorID  string `yaml:"vendorId"`
+	ProductID string `yaml:"productId"`
+}
+
+// IDs returns the vendor and product ids of the USB device.
+func (u USBDevice) IDs() (vendorID, productID uint16, err error) {
+	parse := func(id string) (uint16, error) {
+		id = strings.TrimPrefix(strings.ToLower(id), "0x")
+		n, err := strconv.ParseUint(id, 16, 16)
+		return uint16(n), err
+	}
+	if vendorID, err = parse(u.VendorID); err != nil {
+		return 0, 0, fmt.Errorf("invalid USB vendorId: '%s', must be hexadecimal e.g. 0x0483", u.VendorID)
+	}
+	if productID, err = parse(u.ProductID); err != nil {
+		return 0, 0, fmt.Errorf("invalid USB productId: '%s', must be hexadecimal e.g. 0x3748", u.ProductID)
+	}
+	return vendorID, productID, nil
 }
 
 type Provision struct {
@@ -96,6 +651,18 @@ type Provision struct {
 	Script string `yaml:"script"`
 }
 
+// Provision modes run by Colima as root after the startup of the container runtime or
+// Kubernetes, the other modes are run by Lima on boot.
+const (
+	ProvisionModeAfterRuntime    = "after-runtime"
+	ProvisionModeAfterKubernetes = "after-kubernetes"
+)
+
+// LimaProvision returns if the provision script is run by Lima.
+func (p Provision) LimaProvision() bool {
+	return p.Mode != ProvisionModeAfterRuntime && p.Mode != ProvisionModeAfterKubernetes
+}
+
 func (c Config) MountsOrDefault() []Mount {
 	if len(c.Mounts) > 0 {
 		return c.Mounts
@@ -107,6 +674,31 @@ func (c Config) MountsOrDefault() []Mount {
 	}
 }
 
+// GuestPath returns the path in the VM of the absolute path on the host, translated through
+// the mount point of the most specific mount. False is returned if the path is not mounted.
+func (c Config) GuestPath(path string) (string, bool) {
+	path = filepath.Clean(path)
+	guestPath, matched := "", ""
+	for _, m := range c.MountsOrDefault() {
+		location, err := util.CleanPath(m.Location)
+		if err != nil || len(location) <= len(matched) {
+			continue
+		}
+		rel, err := filepath.Rel(location, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		mountPoint := location
+		if m.MountPoint != "" {
+			if mountPoint, err = util.CleanPath(m.MountPoint); err != nil {
+				continue
+			}
+		}
+		guestPath, matched = filepath.Join(mountPoint, rel), location
+	}
+	return guestPath, matched != ""
+}
+
 // AutoActivate returns if auto-activation of host client config is enabled.
 func (c Config) AutoActivate() bool {
 	if c.ActivateRuntime == nil {
@@ -119,12 +711,29 @@ func (c Config) AutoActivate() bool {
 func (c Config) Empty() bool { return c.Runtime == "" } // this may be better but not really needed.
 
 func (c Config) DriverLabel() string {
+	if util.MacOS15OrNewerOnArm() && c.VMType == "apple" {
+		return "Apple Containerization"
+	}
+	if util.MacOS13OrNewerOnArm() && c.VMType == "vz" && c.GPU {
+		return "krunkit"
+	}
 	if util.MacOS13OrNewer() && c.VMType == "vz" {
 		return "macOS Virtualization.Framework"
 	}
 	return "QEMU"
 }
 
+// Distros of the disk image, the disk images of Colima are Ubuntu.
+const (
+	DistroUbuntu = "ubuntu"
+	DistroAlpine = "alpine"
+	DistroFedora = "fedora"
+)
+
+// GPUDevice is the CDI device of the GPU of the VM, requested by the containers
+// e.g. with docker run --device.
+const GPUDevice = "colima.dev/gpu=all"
+
 // CtxKey returns the context key for config.
 func CtxKey() any {
 	return struct{ name string }{name: "colima_config"}
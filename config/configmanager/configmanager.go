@@ -2,18 +2,36 @@ package configmanager
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process/vmnet"
 	"github.com/abiosoft/colima/util"
+	"github.com/abiosoft/colima/util/cloudinit"
 	"github.com/abiosoft/colima/util/yamlutil"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
+// diskImageDigestRegex is the digest of a custom disk image, sha256 or sha512.
+var diskImageDigestRegex = regexp.MustCompile(`^(sha256:[0-9a-fA-F]{64}|sha512:[0-9a-fA-F]{128})$`)
+
+// sysctlRegex is the name of a kernel parameter.
+var sysctlRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.\-/]*$`)
+
+// kernelModuleRegex is the name of a kernel module.
+var kernelModuleRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// diskNameRegex is the name of an additional disk.
+var diskNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
 // Save saves the config.
 func Save(c config.Config) error {
 	return yamlutil.Save(c, config.CurrentProfile().File())
@@ -56,31 +74,617 @@ func LoadFrom(file string) (config.Config, error) {
 	return c, nil
 }
 
+// validateStaticIP validates the static IP address to be a host address in the subnet other than the gateway.
+func validateStaticIP(ip, gateway net.IP, subnet *net.IPNet) error {
+	ip = ip.To4()
+	broadcast := make(net.IP, len(subnet.IP.To4()))
+	for i, b := range subnet.IP.To4() {
+		broadcast[i] = b | ^subnet.Mask[len(subnet.Mask)-4+i]
+	}
+	if !subnet.Contains(ip) || ip.Equal(gateway) || ip.Equal(subnet.IP) || ip.Equal(broadcast) {
+		return fmt.Errorf("invalid network.staticIP: '%s', must be a host address in %s other than %s", ip, subnet.String(), gateway)
+	}
+	return nil
+}
+
 // ValidateConfig validates config before we use it
 func ValidateConfig(c config.Config) error {
-	validMountTypes := map[string]bool{"9p": true, "sshfs": true}
+	validMountTypes := map[string]bool{"9p": true, "sshfs": true, "reverse-sshfs": true}
 	if util.MacOS13OrNewer() {
 		validMountTypes["virtiofs"] = true
 	}
 	if _, ok := validMountTypes[c.MountType]; !ok {
 		return fmt.Errorf("invalid mountType: '%s'", c.MountType)
 	}
+	for _, m := range c.Mounts {
+		if m.MountType == "" {
+			continue
+		}
+		if _, ok := validMountTypes[m.MountType]; !ok {
+			return fmt.Errorf("invalid mountType for mount '%s': '%s'", m.Location, m.MountType)
+		}
+		if m.MountType == "9p" && c.VMType != "qemu" {
+			return fmt.Errorf("invalid mountType for mount '%s': 9p requires vmType 'qemu'", m.Location)
+		}
+		if m.MountType == "virtiofs" && c.VMType != "vz" {
+			return fmt.Errorf("invalid mountType for mount '%s': virtiofs requires vmType 'vz'", m.Location)
+		}
+	}
+	var nativeMountType string
+	for _, m := range c.Mounts {
+		t := c.MountTypeOf(m)
+		if config.SSHFSMountType(t) {
+			continue
+		}
+		if nativeMountType != "" && t != nativeMountType {
+			return fmt.Errorf("cannot combine %s and %s mounts, only sshfs mounts can be combined with another mount type", nativeMountType, t)
+		}
+		nativeMountType = t
+	}
+	if len(c.SSHFSMounts()) > 0 && !util.MacOS() && !util.Linux() {
+		return fmt.Errorf("sshfs mounts combined with %s mounts are limited to macOS and Linux", nativeMountType)
+	}
 	validVMTypes := map[string]bool{"qemu": true}
 	if util.MacOS13OrNewer() {
 		validVMTypes["vz"] = true
 	}
+	if util.MacOS15OrNewerOnArm() {
+		validVMTypes["apple"] = true
+	}
 	if _, ok := validVMTypes[c.VMType]; !ok {
 		return fmt.Errorf("invalid vmType: '%s'", c.VMType)
 	}
+	if c.VMType == "apple" {
+		if c.Runtime != "none" {
+			return fmt.Errorf("vmType 'apple' requires runtime 'none', the containers are managed with the container command")
+		}
+		if c.Kubernetes.Enabled {
+			return fmt.Errorf("kubernetes is not supported by vmType 'apple'")
+		}
+		if err := util.AssertAppleContainer(); err != nil {
+			return fmt.Errorf("cannot use vmType: '%s', error: %w", c.VMType, err)
+		}
+	}
 	if c.VMType == "qemu" {
 		if err := util.AssertQemuImg(); err != nil {
 			return fmt.Errorf("cannot use vmType: '%s', error: %w", c.VMType, err)
 		}
 	}
 
-	if c.DiskImage != "" {
+	for key, value := range c.Guest.Sysctls {
+		if !sysctlRegex.MatchString(key) {
+			return fmt.Errorf("invalid guest.sysctls key: '%s'", key)
+		}
+		if strings.ContainsAny(value, "\n") {
+			return fmt.Errorf("invalid guest.sysctls.%s: '%s'", key, value)
+		}
+	}
+	for _, module := range c.Guest.KernelModules {
+		if !kernelModuleRegex.MatchString(module) {
+			return fmt.Errorf("invalid guest.kernelModules: '%s'", module)
+		}
+	}
+
+	if c.Swap.Size < 0 {
+		return fmt.Errorf("invalid swap.size: %d, must be a number of GiB", c.Swap.Size)
+	}
+
+	switch c.Display {
+	case "", "none", "window":
+	case "vnc":
+		if c.VMType != "qemu" {
+			return fmt.Errorf("display 'vnc' requires vmType 'qemu', use 'window' for vmType 'vz'")
+		}
+	default:
+		return fmt.Errorf("invalid display: '%s', must be none, vnc or window", c.Display)
+	}
+	if c.Display != "" && c.Display != "none" && c.GPU {
+		return fmt.Errorf("display is not supported with gpu")
+	}
+
+	if c.GPU {
+		if c.VMType != "vz" || !util.MacOS13OrNewerOnArm() {
+			return fmt.Errorf("gpu requires vmType 'vz' on Apple Silicon")
+		}
+		if c.Runtime == "incus" {
+			return fmt.Errorf("gpu is not supported by the incus runtime")
+		}
+		if err := util.AssertKrunkit(); err != nil {
+			return fmt.Errorf("cannot enable gpu, error: %w", err)
+		}
+	}
+
+	if c.Rootless {
+		if c.Runtime != "containerd" {
+			return fmt.Errorf("rootless is only supported by the containerd runtime")
+		}
+		if c.Kubernetes.Enabled {
+			return fmt.Errorf("rootless is not supported with Kubernetes")
+		}
+	}
+
+	switch c.Snapshotter {
+	case "", "overlayfs":
+	case "stargz", "nydus":
+		if c.Runtime != "containerd" {
+			return fmt.Errorf("snapshotter is only supported by the containerd runtime")
+		}
+		if c.Rootless {
+			return fmt.Errorf("snapshotter is not supported with rootless")
+		}
+	default:
+		return fmt.Errorf("invalid snapshotter: '%s'", c.Snapshotter)
+	}
+
+	if c.Wasm.Enabled {
+		switch c.Runtime {
+		case "docker", "containerd":
+		default:
+			return fmt.Errorf("wasm requires docker or containerd runtime")
+		}
+	}
+	for _, shim := range c.Wasm.Shims {
+		switch shim {
+		case "spin", "wasmtime", "wasmedge":
+		default:
+			return fmt.Errorf("invalid wasm shim: '%s'", shim)
+		}
+	}
+
+	if c.Sysbox {
+		switch c.Runtime {
+		case "docker", "containerd":
+		default:
+			return fmt.Errorf("sysbox requires docker or containerd runtime")
+		}
+		if c.Rootless {
+			return fmt.Errorf("sysbox is not supported with rootless")
+		}
+	}
+
+	if c.GC.MaxDiskUsage < 0 || c.GC.MaxDiskUsage > 100 {
+		return fmt.Errorf("invalid gc.maxDiskUsage: %d, must be a percentage", c.GC.MaxDiskUsage)
+	}
+	if c.GC.MaxAge != "" {
+		if _, err := time.ParseDuration(c.GC.MaxAge); err != nil {
+			return fmt.Errorf("invalid gc.maxAge: '%s'", c.GC.MaxAge)
+		}
+	}
+	if c.Watchdog.Retries < 0 {
+		return fmt.Errorf("invalid watchdog.retries: %d", c.Watchdog.Retries)
+	}
+	if c.Watchdog.Backoff != "" {
+		if d, err := time.ParseDuration(c.Watchdog.Backoff); err != nil || d <= 0 {
+			return fmt.Errorf("invalid watchdog.backoff: '%s', must be a duration e.g. 10s", c.Watchdog.Backoff)
+		}
+	}
+	if c.Watchdog.Enabled && !util.MacOS() && !util.Linux() {
+		return fmt.Errorf("watchdog is limited to macOS and Linux")
+	}
+	if c.TimeSync && !util.MacOS() && !util.Linux() {
+		return fmt.Errorf("timeSync is limited to macOS and Linux")
+	}
+	if strings.ContainsAny(c.GC.Schedule, "\n") {
+		return fmt.Errorf("invalid gc.schedule: '%s'", c.GC.Schedule)
+	}
+
+	if c.HostCredentials && c.Runtime == "incus" {
+		return fmt.Errorf("hostCredentials is not supported by the incus runtime")
+	}
+
+	if c.Incus.Project != "" || len(c.Incus.Profiles) > 0 || c.Incus.APIPort != 0 {
+		if c.Runtime != "incus" {
+			return fmt.Errorf("incus config is only supported by the incus runtime")
+		}
+	}
+	if c.Incus.APIPort < 0 || c.Incus.APIPort > 65535 {
+		return fmt.Errorf("invalid incus.apiPort: %d", c.Incus.APIPort)
+	}
+	for _, profile := range c.Incus.Profiles {
+		if profile == "" {
+			return fmt.Errorf("incus.profiles cannot contain an empty path")
+		}
+	}
+
+	if c.BuildKit.Enabled {
+		switch c.Runtime {
+		case "docker", "containerd":
+		default:
+			return fmt.Errorf("buildkit requires docker or containerd runtime")
+		}
+	}
+	switch c.BuildKit.Worker {
+	case "", "oci", "containerd":
+	default:
+		return fmt.Errorf("invalid buildkit.worker: '%s'", c.BuildKit.Worker)
+	}
+	if c.BuildKit.MaxParallelism < 0 {
+		return fmt.Errorf("invalid buildkit.maxParallelism: %d", c.BuildKit.MaxParallelism)
+	}
+
+	for _, n := range []struct{ name, cidrs string }{
+		{name: "kubernetes.podCIDR", cidrs: c.Kubernetes.PodCIDR},
+		{name: "kubernetes.serviceCIDR", cidrs: c.Kubernetes.ServiceCIDR},
+		{name: "kubernetes.loadBalancer.cidr", cidrs: c.Kubernetes.LoadBalancer.CIDR},
+	} {
+		if n.cidrs == "" {
+			continue
+		}
+		// comma separated for dual-stack
+		for _, cidr := range strings.Split(n.cidrs, ",") {
+			if _, _, err := net.ParseCIDR(strings.TrimSpace(cidr)); err != nil {
+				return fmt.Errorf("invalid %s: '%s'", n.name, cidr)
+			}
+		}
+	}
+
+	switch c.Kubernetes.Distro {
+	case "", "k3s":
+	case "k0s":
+		if c.Kubernetes.Nodes > 1 || c.Kubernetes.Agent() {
+			return fmt.Errorf("multiple Kubernetes nodes are only supported by k3s")
+		}
+	default:
+		return fmt.Errorf("invalid kubernetes.distro: '%s'", c.Kubernetes.Distro)
+	}
+	if c.Kubernetes.Nodes < 0 || c.Kubernetes.Nodes > config.MaxNodes {
+		return fmt.Errorf("invalid kubernetes.nodes: %d, must be between 1 and %d", c.Kubernetes.Nodes, config.MaxNodes)
+	}
+	if c.Kubernetes.Nodes > 1 || c.Kubernetes.Agent() {
+		switch c.Runtime {
+		case "docker", "containerd":
+		default:
+			return fmt.Errorf("multiple Kubernetes nodes require docker or containerd runtime")
+		}
+	}
+	if c.Kubernetes.Agent() && c.Kubernetes.Nodes > 1 {
+		return fmt.Errorf("kubernetes.nodes cannot be set for an agent node")
+	}
+	if c.Kubernetes.Lazy {
+		if c.Kubernetes.Distro == "k0s" {
+			return fmt.Errorf("kubernetes.lazy is only supported by k3s")
+		}
+		if c.Kubernetes.Nodes > 1 || c.Kubernetes.Agent() {
+			return fmt.Errorf("kubernetes.lazy is not supported with multiple Kubernetes nodes")
+		}
+	}
+	switch c.Kubernetes.CNI {
+	case "", "calico", "cilium", "none":
+	case "flannel":
+		if c.Kubernetes.Distro == "k0s" {
+			return fmt.Errorf("kubernetes.cni flannel is not supported by k0s")
+		}
+	default:
+		return fmt.Errorf("invalid kubernetes.cni: '%s'", c.Kubernetes.CNI)
+	}
+	switch c.Kubernetes.Ingress {
+	case "", "traefik", "nginx", "none":
+	default:
+		return fmt.Errorf("invalid kubernetes.ingress: '%s'", c.Kubernetes.Ingress)
+	}
+	switch c.Kubernetes.Dashboard {
+	case "", "kubernetes-dashboard", "headlamp", "none":
+	default:
+		return fmt.Errorf("invalid kubernetes.dashboard: '%s'", c.Kubernetes.Dashboard)
+	}
+	if p := c.Kubernetes.Registry.Port; p < 0 || p > 65535 {
+		return fmt.Errorf("invalid kubernetes.registry.port: %d", p)
+	}
+	for key := range c.Kubernetes.NodeLabels {
+		if key == "" || strings.ContainsAny(key, "=, ") {
+			return fmt.Errorf("invalid kubernetes.nodeLabels key: '%s'", key)
+		}
+	}
+	for _, taint := range c.Kubernetes.NodeTaints {
+		key, effect, _ := strings.Cut(taint, ":")
+		switch effect {
+		case "NoSchedule", "PreferNoSchedule", "NoExecute":
+		default:
+			return fmt.Errorf("invalid kubernetes.nodeTaints: '%s', must be key[=value]:NoSchedule|PreferNoSchedule|NoExecute", taint)
+		}
+		if key == "" || strings.HasPrefix(key, "=") {
+			return fmt.Errorf("invalid kubernetes.nodeTaints: '%s', key is required", taint)
+		}
+	}
+	for _, san := range c.Kubernetes.TLSSANs {
+		if san == "" || strings.ContainsAny(san, ", /") {
+			return fmt.Errorf("invalid kubernetes.tlsSANs: '%s', must be a hostname or IP address", san)
+		}
+	}
+	for port, hostPort := range c.Kubernetes.LoadBalancer.HostPortMap {
+		if port < 1 || port > 65535 || hostPort < 1 || hostPort > 65535 {
+			return fmt.Errorf("invalid kubernetes.loadBalancer.hostPortMap: '%d: %d', ports must be between 1 and 65535", port, hostPort)
+		}
+	}
+	if err := validateRegistries("kubernetes.registries", c.Kubernetes.Registries); err != nil {
+		return err
+	}
+	if err := validateRegistries("registries", c.Registries); err != nil {
+		return err
+	}
+	if err := validateDocker(c.Docker); err != nil {
+		return err
+	}
+	if err := validateSecurity(c.Kubernetes); err != nil {
+		return err
+	}
+	if err := validateAirgap(c.Kubernetes); err != nil {
+		return err
+	}
+	if _, err := c.Kubernetes.Kubeconfig.ContextName(config.CurrentProfile()); err != nil {
+		return fmt.Errorf("invalid kubernetes.kubeconfig.context: %w", err)
+	}
+	if file := c.Kubernetes.Kubeconfig.FilePath(); file != "" && !filepath.IsAbs(file) {
+		return fmt.Errorf("invalid kubernetes.kubeconfig.file: '%s', must be an absolute path", c.Kubernetes.Kubeconfig.File)
+	}
+	dockerContext, err := c.DockerContextName(config.CurrentProfile())
+	if err != nil {
+		return fmt.Errorf("invalid dockerContext: %w", err)
+	}
+	if dockerContext == "default" {
+		return fmt.Errorf("invalid dockerContext: '%s', reserved by docker", c.DockerContext)
+	}
+
+	switch c.Network.PodAccess {
+	case "", "route", "off":
+	case "pf":
+		if !util.MacOS() {
+			return fmt.Errorf("network.podAccess: 'pf' is only supported on macOS")
+		}
+	case "wireguard":
+		if !util.MacOS() && !util.Linux() {
+			return fmt.Errorf("network.podAccess: 'wireguard' is only supported on macOS and Linux")
+		}
+	default:
+		return fmt.Errorf("invalid network.podAccess: '%s'", c.Network.PodAccess)
+	}
+
+	for _, domain := range c.Network.DNSSearch {
+		if strings.TrimSpace(domain) == "" || strings.ContainsAny(domain, " '") {
+			return fmt.Errorf("invalid network.dnsSearch domain: '%s'", domain)
+		}
+	}
+	for domain, resolvers := range c.Network.DNSDomains {
+		if strings.TrimSpace(domain) == "" || strings.ContainsAny(domain, " '") {
+			return fmt.Errorf("invalid network.dnsDomains domain: '%s'", domain)
+		}
+		if len(resolvers) == 0 {
+			return fmt.Errorf("network.dnsDomains: no resolvers specified for '%s'", domain)
+		}
+	}
+
+	if ip := c.Network.StaticIP; ip != nil {
+		if !c.Network.Address {
+			return fmt.Errorf("network.staticIP requires network address to be enabled")
+		}
+		if ip.To4() == nil {
+			return fmt.Errorf("invalid network.staticIP: '%s', only IPv4 addresses are supported", ip)
+		}
+		// the vmnet network is used by qemu, incus and the host mode, the VZ NAT network by vz
+		// and the bridged mode uses the host network
+		if c.Network.Mode != vmnet.ModeBridged {
+			gateway := net.ParseIP(vmnet.NetGateway)
+			subnet := &net.IPNet{IP: gateway.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+			if c.VMType != "qemu" && c.Runtime != "incus" && c.Network.Mode != vmnet.ModeHost {
+				gateway, subnet = vmnet.VZNATNetwork()
+			}
+			if err := validateStaticIP(ip, gateway, subnet); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch c.Network.Mode {
+	case "", vmnet.ModeShared:
+		if c.Network.Interface != "" {
+			return fmt.Errorf("network.interface is only supported for '%s' mode", vmnet.ModeBridged)
+		}
+	case vmnet.ModeHost, vmnet.ModeBridged:
+		if !util.MacOS() {
+			return fmt.Errorf("network.mode '%s' is only supported on macOS", c.Network.Mode)
+		}
+		if !c.Network.Address {
+			return fmt.Errorf("network.mode requires network address to be enabled")
+		}
+		if c.Network.Mode == vmnet.ModeBridged && c.Network.Interface == "" {
+			return fmt.Errorf("network.interface is required for '%s' mode", vmnet.ModeBridged)
+		}
+		if c.Network.Mode == vmnet.ModeHost && c.Network.Interface != "" {
+			return fmt.Errorf("network.interface is only supported for '%s' mode", vmnet.ModeBridged)
+		}
+	default:
+		return fmt.Errorf("invalid network.mode: '%s'", c.Network.Mode)
+	}
+
+	if len(c.Network.Networks) > 0 {
+		if !util.MacOS() {
+			return fmt.Errorf("network.networks is only supported on macOS")
+		}
+		if !c.Network.Address {
+			return fmt.Errorf("network.networks requires network address to be enabled")
+		}
+		if len(c.Network.Networks) > vmnet.MaxNetworks {
+			return fmt.Errorf("network.networks: at most %d additional networks are supported", vmnet.MaxNetworks)
+		}
+	}
+	for i, n := range c.Network.Networks {
+		switch n.Mode {
+		case vmnet.ModeShared, vmnet.ModeHost:
+		case vmnet.ModeBridged:
+			if n.Interface == "" {
+				return fmt.Errorf("network.networks[%d]: interface is required for '%s' mode", i, n.Mode)
+			}
+		default:
+			return fmt.Errorf("invalid network.networks[%d].mode: '%s'", i, n.Mode)
+		}
+	}
+
+	if c.Network.MDNS && !c.Network.Address {
+		return fmt.Errorf("network.mdns requires network address to be enabled")
+	}
+	if c.Network.MDNSContainers && !c.Network.MDNS {
+		return fmt.Errorf("network.mdnsContainers requires network.mdns to be enabled")
+	}
+	if c.Network.HostsFile && !c.Network.Address {
+		return fmt.Errorf("network.hostsFile requires network address to be enabled")
+	}
+
+	for i, p := range c.Network.PortForwards {
+		if p.GuestPort < 1 || p.GuestPort > 65535 {
+			return fmt.Errorf("invalid network.portForwards[%d].guestPort: %d", i, p.GuestPort)
+		}
+		if p.HostPort < 0 || p.HostPort > 65535 {
+			return fmt.Errorf("invalid network.portForwards[%d].hostPort: %d", i, p.HostPort)
+		}
+		switch p.Protocol {
+		case "", "tcp", "udp":
+		default:
+			return fmt.Errorf("invalid network.portForwards[%d].protocol: '%s'", i, p.Protocol)
+		}
+	}
+
+	for i, b := range c.Network.PortBindings {
+		if b.Port < 1 || b.Port > 65535 {
+			return fmt.Errorf("invalid network.portBindings[%d].port: %d", i, b.Port)
+		}
+		if b.Address == nil {
+			return fmt.Errorf("network.portBindings[%d]: address is required", i)
+		}
+		switch b.Protocol {
+		case "", "tcp", "udp":
+		default:
+			return fmt.Errorf("invalid network.portBindings[%d].protocol: '%s'", i, b.Protocol)
+		}
+	}
+
+	for key, val := range map[string]string{"http": c.Proxy.HTTP, "https": c.Proxy.HTTPS} {
+		if val == "" {
+			continue
+		}
+		if u, err := url.Parse(val); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid proxy.%s: '%s'", key, val)
+		}
+	}
+
+	for i, p := range c.Network.Peers {
+		if p == "" || strings.ContainsAny(p, " /") {
+			return fmt.Errorf("invalid network.peers[%d]: '%s'", i, p)
+		}
+	}
+
+	if c.Network.MTU != 0 && (c.Network.MTU < 576 || c.Network.MTU > 9000) {
+		return fmt.Errorf("invalid network.mtu: %d, must be between 576 and 9000", c.Network.MTU)
+	}
+
+	if c.Network.SOCKSPort < 0 || c.Network.SOCKSPort > 65535 {
+		return fmt.Errorf("invalid network.socksPort: %d", c.Network.SOCKSPort)
+	}
+
+	guestPorts := map[int]bool{}
+	for i, p := range c.Network.ReversePortForwards {
+		if p.GuestPort < 1 || p.GuestPort > 65535 {
+			return fmt.Errorf("invalid network.reversePortForwards[%d].guestPort: %d", i, p.GuestPort)
+		}
+		if p.HostPort < 0 || p.HostPort > 65535 {
+			return fmt.Errorf("invalid network.reversePortForwards[%d].hostPort: %d", i, p.HostPort)
+		}
+		if guestPorts[p.GuestPort] {
+			return fmt.Errorf("network.reversePortForwards: guest port %d is forwarded more than once", p.GuestPort)
+		}
+		guestPorts[p.GuestPort] = true
+	}
+
+	for _, p := range c.Provision {
+		switch p.Mode {
+		case "", "system", "user", "boot", "dependency", config.ProvisionModeAfterRuntime, config.ProvisionModeAfterKubernetes:
+		default:
+			return fmt.Errorf("invalid provision mode: '%s'", p.Mode)
+		}
+	}
+	if c.CloudInit != "" {
+		if _, err := cloudinit.Parse(c.CloudInit); err != nil {
+			return err
+		}
+	}
+
+	if c.DiskImage != "" && c.DiskImageDigest == "" {
 		if strings.HasPrefix(c.DiskImage, "http://") || strings.HasPrefix(c.DiskImage, "https://") {
-			return fmt.Errorf("cannot use diskImage: remote URLs not supported, only local files can be specified")
+			return fmt.Errorf("cannot use diskImage: remote URLs require diskImageDigest")
+		}
+	}
+	if c.DiskImageDigest != "" {
+		if c.DiskImage == "" {
+			return fmt.Errorf("diskImageDigest requires diskImage")
+		}
+		if !diskImageDigestRegex.MatchString(c.DiskImageDigest) {
+			return fmt.Errorf("invalid diskImageDigest: '%s', must be sha256:<hex> or sha512:<hex>", c.DiskImageDigest)
+		}
+	}
+	switch c.Distro {
+	case "", config.DistroUbuntu:
+	case config.DistroAlpine, config.DistroFedora:
+		// the container runtimes are preinstalled in the Ubuntu disk images and installed with apt
+		if c.DiskImage == "" {
+			return fmt.Errorf("distro '%s' requires diskImage, the disk images of Colima are Ubuntu", c.Distro)
+		}
+		if c.Runtime != "none" {
+			return fmt.Errorf("distro '%s' requires runtime 'none', the container runtimes require Ubuntu", c.Distro)
+		}
+		if c.Kubernetes.Enabled {
+			return fmt.Errorf("kubernetes is not supported by distro '%s'", c.Distro)
+		}
+		if c.GPU {
+			return fmt.Errorf("gpu is not supported by distro '%s'", c.Distro)
+		}
+	default:
+		return fmt.Errorf("invalid distro: '%s'", c.Distro)
+	}
+
+	if len(c.USBDevices) > 0 && c.VMType != "qemu" {
+		return fmt.Errorf("usbDevices requires vmType 'qemu'")
+	}
+	for _, u := range c.USBDevices {
+		if _, _, err := u.IDs(); err != nil {
+			return err
+		}
+	}
+
+	if len(c.VMOpts.QEMU.Args) > 0 {
+		if c.VMType != "qemu" {
+			return fmt.Errorf("vmOpts.qemu requires vmType 'qemu'")
+		}
+		if !strings.HasPrefix(c.VMOpts.QEMU.Args[0], "-") {
+			return fmt.Errorf("invalid vmOpts.qemu.args: '%s', must start with an option e.g. -device", c.VMOpts.QEMU.Args[0])
+		}
+		for _, arg := range c.VMOpts.QEMU.Args {
+			if arg == "" || strings.ContainsAny(arg, "\n") {
+				return fmt.Errorf("invalid vmOpts.qemu.args: '%s'", arg)
+			}
+		}
+	}
+	if len(c.VMOpts.VZ) > 0 && c.VMType != "vz" {
+		return fmt.Errorf("vmOpts.vz requires vmType 'vz'")
+	}
+
+	diskNames := map[string]bool{}
+	for _, d := range c.Disks {
+		if !diskNameRegex.MatchString(d.Name) {
+			return fmt.Errorf("invalid disk name: '%s', must be lowercase alphanumeric, '-' or '_'", d.Name)
+		}
+		if diskNames[d.Name] {
+			return fmt.Errorf("duplicate disk name: '%s'", d.Name)
+		}
+		diskNames[d.Name] = true
+		if d.Size <= 0 {
+			return fmt.Errorf("invalid size for disk '%s': %d, must be a positive number of GiB", d.Name, d.Size)
+		}
+		switch d.FSType {
+		case "", "ext4", "xfs":
+		default:
+			return fmt.Errorf("invalid fsType for disk '%s': '%s', must be ext4 or xfs", d.Name, d.FSType)
+		}
+		if d.MountPoint != "" && !filepath.IsAbs(d.MountPoint) {
+			return fmt.Errorf("invalid mountPoint for disk '%s': '%s', must be an absolute path", d.Name, d.MountPoint)
 		}
 	}
 
@@ -124,3 +728,81 @@ func Teardown() error {
 	}
 	return nil
 }
+
+// validateAirgap validates the files of the offline installation of k3s.
+func validateAirgap(k config.Kubernetes) error {
+	airgap := k.Airgap
+	if !airgap.Enabled() {
+		if airgap.Script != "" || len(airgap.Images) > 0 {
+			return fmt.Errorf("kubernetes.airgap.binary is required for kubernetes.airgap")
+		}
+		return nil
+	}
+	if k.Distro == "k0s" {
+		return fmt.Errorf("kubernetes.airgap is only supported by k3s")
+	}
+	if airgap.Script == "" {
+		return fmt.Errorf("kubernetes.airgap.script is required for kubernetes.airgap")
+	}
+
+	expanded := airgap.Expanded()
+	type airgapFile struct{ name, file string }
+	files := []airgapFile{
+		{name: "kubernetes.airgap.binary", file: expanded.Binary},
+		{name: "kubernetes.airgap.script", file: expanded.Script},
+	}
+	for i, image := range expanded.Images {
+		files = append(files, airgapFile{name: fmt.Sprintf("kubernetes.airgap.images[%d]", i), file: image})
+	}
+	for _, f := range files {
+		if stat, err := os.Stat(f.file); err != nil || stat.IsDir() {
+			return fmt.Errorf("invalid %s: '%s' is not a file", f.name, f.file)
+		}
+	}
+	return nil
+}
+
+// validateSecurity validates the audit policy and the Pod Security Admission defaults.
+func validateSecurity(k config.Kubernetes) error {
+	if k.AuditPolicy == "" && !k.PodSecurity.Enabled() {
+		return nil
+	}
+	if k.Distro == "k0s" {
+		return fmt.Errorf("kubernetes.auditPolicy and kubernetes.podSecurity are only supported by k3s")
+	}
+	if file := k.AuditPolicyFile(); file != "" {
+		if stat, err := os.Stat(file); err != nil || stat.IsDir() {
+			return fmt.Errorf("invalid kubernetes.auditPolicy: '%s' is not a file", file)
+		}
+	}
+	for _, level := range []struct{ name, value string }{
+		{name: "enforce", value: k.PodSecurity.Enforce},
+		{name: "audit", value: k.PodSecurity.Audit},
+		{name: "warn", value: k.PodSecurity.Warn},
+	} {
+		switch level.value {
+		case "", "privileged", "baseline", "restricted":
+		default:
+			return fmt.Errorf("invalid kubernetes.podSecurity.%s: '%s', must be privileged, baseline or restricted", level.name, level.value)
+		}
+	}
+	if v := k.PodSecurity.Version; v != "" && v != "latest" && !strings.HasPrefix(v, "v1.") {
+		return fmt.Errorf("invalid kubernetes.podSecurity.version: '%s', must be latest or a Kubernetes minor version e.g. v1.33", v)
+	}
+	return nil
+}
+
+// validateRegistries validates the registries of the config field name.
+func validateRegistries(name string, registries []config.RegistryHost) error {
+	for i, r := range registries {
+		if r.Host == "" || strings.Contains(r.Host, "/") {
+			return fmt.Errorf("invalid %s[%d].host: '%s', must be a registry host e.g. docker.io", name, i, r.Host)
+		}
+		for _, m := range r.Mirrors {
+			if u, err := url.Parse(m); m == "" || err != nil || (strings.Contains(m, "://") && u.Host == "") {
+				return fmt.Errorf("invalid %s[%d].mirrors: '%s'", name, i, m)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package configmanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// dockerValueType is the type of the value of a daemon.json key.
+type dockerValueType string
+
+const (
+	dockerBool    dockerValueType = "a boolean"
+	dockerString  dockerValueType = "a string"
+	dockerNumber  dockerValueType = "a number"
+	dockerStrings dockerValueType = "a list of strings"
+	dockerObject  dockerValueType = "an object"
+	dockerObjects dockerValueType = "a list of objects"
+)
+
+// dockerDaemonKeys are the keys of the daemon.json of dockerd on Linux, with the types of the values.
+var dockerDaemonKeys = map[string]dockerValueType{
+	"allow-direct-routing":             dockerBool,
+	"allow-nondistributable-artifacts": dockerStrings,
+	"api-cors-header":                  dockerString,
+	"authorization-plugins":            dockerStrings,
+	"bip":                              dockerString,
+	"bip6":                             dockerString,
+	"bridge":                           dockerString,
+	"bridge-accept-fwmark":             dockerString,
+	"builder":                          dockerObject,
+	"cdi-spec-dirs":                    dockerStrings,
+	"cgroup-parent":                    dockerString,
+	"containerd":                       dockerString,
+	"containerd-namespace":             dockerString,
+	"containerd-plugin-namespace":      dockerString,
+	"cpu-rt-period":                    dockerNumber,
+	"cpu-rt-runtime":                   dockerNumber,
+	"data-root":                        dockerString,
+	"debug":                            dockerBool,
+	"default-address-pools":            dockerObjects,
+	"default-cgroupns-mode":            dockerString,
+	"default-gateway":                  dockerString,
+	"default-gateway-v6":               dockerString,
+	"default-ipc-mode":                 dockerString,
+	"default-network-opts":             dockerObject,
+	"default-runtime":                  dockerString,
+	"default-shm-size":                 dockerString,
+	"default-ulimits":                  dockerObject,
+	"dns":                              dockerStrings,
+	"dns-opts":                         dockerStrings,
+	"dns-search":                       dockerStrings,
+	"exec-opts":                        dockerStrings,
+	"exec-root":                        dockerString,
+	"experimental":                     dockerBool,
+	"features":                         dockerObject,
+	"firewall-backend":                 dockerString,
+	"fixed-cidr":                       dockerString,
+	"fixed-cidr-v6":                    dockerString,
+	"group":                            dockerString,
+	"host-gateway-ip":                  dockerString,
+	"host-gateway-ips":                 dockerStrings,
+	"hosts":                            dockerStrings,
+	"icc":                              dockerBool,
+	"init":                             dockerBool,
+	"init-path":                        dockerString,
+	"insecure-registries":              dockerStrings,
+	"ip":                               dockerString,
+	"ip-forward":                       dockerBool,
+	"ip-forward-no-drop":               dockerBool,
+	"ip-masq":                          dockerBool,
+	"ip6tables":                        dockerBool,
+	"iptables":                         dockerBool,
+	"ipv6":                             dockerBool,
+	"labels":                           dockerStrings,
+	"live-restore":                     dockerBool,
+	"log-driver":                       dockerString,
+	"log-format":                       dockerString,
+	"log-level":                        dockerString,
+	"log-opts":                         dockerObject,
+	"max-concurrent-downloads":         dockerNumber,
+	"max-concurrent-uploads":           dockerNumber,
+	"max-download-attempts":            dockerNumber,
+	"metrics-addr":                     dockerString,
+	"mtu":                              dockerNumber,
+	"no-new-privileges":                dockerBool,
+	"node-generic-resources":           dockerStrings,
+	"oom-score-adjust":                 dockerNumber,
+	"pidfile":                          dockerString,
+	"proxies":                          dockerObject,
+	"raw-logs":                         dockerBool,
+	"registry-mirrors":                 dockerStrings,
+	"runtimes":                         dockerObject,
+	"seccomp-profile":                  dockerString,
+	"selinux-enabled":                  dockerBool,
+	"shutdown-timeout":                 dockerNumber,
+	"storage-driver":                   dockerString,
+	"storage-opts":                     dockerStrings,
+	"swarm-default-advertise-addr":     dockerString,
+	"tls":                              dockerBool,
+	"tlscacert":                        dockerString,
+	"tlscert":                          dockerString,
+	"tlskey":                           dockerString,
+	"tlsverify":                        dockerBool,
+	"userland-proxy":                   dockerBool,
+	"userland-proxy-path":              dockerString,
+	"userns-remap":                     dockerString,
+	"validate":                         dockerBool,
+}
+
+// validateDocker validates the docker config against the daemon.json of dockerd, for the typos
+// and invalid values to be reported before dockerd fails to start in the VM. The unknown keys
+// not resembling a known key are passed through with a warning, e.g. the keys of a newer dockerd.
+func validateDocker(conf map[string]any) error {
+	keys := make([]string, 0, len(conf))
+	for key := range conf {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := conf[key]
+		valueType, ok := dockerDaemonKeys[key]
+		if !ok {
+			if suggestion := closestDockerKey(key); suggestion != "" {
+				return fmt.Errorf("unknown docker config '%s', did you mean '%s'?", key, suggestion)
+			}
+			logrus.Warnf("unknown docker config '%s' passed through as is, see https://docs.docker.com/reference/cli/dockerd/#daemon-configuration-file", key)
+			continue
+		}
+		if !dockerValueValid(valueType, value) {
+			return fmt.Errorf("invalid docker.%s: '%v', must be %s", key, value, valueType)
+		}
+	}
+
+	if level, ok := conf["log-level"].(string); ok {
+		switch level {
+		case "trace", "debug", "info", "warn", "warning", "error", "fatal", "panic":
+		default:
+			return fmt.Errorf("invalid docker.log-level: '%s', must be debug, info, warn, error or fatal", level)
+		}
+	}
+	if features, ok := conf["features"].(map[string]any); ok {
+		for name, enabled := range features {
+			if _, ok := enabled.(bool); !ok {
+				return fmt.Errorf("invalid docker.features.%s: '%v', must be a boolean", name, enabled)
+			}
+		}
+	}
+	if opts, ok := conf["log-opts"].(map[string]any); ok {
+		for name, opt := range opts {
+			if _, ok := opt.(string); !ok {
+				return fmt.Errorf("invalid docker.log-opts.%s: '%v', must be a string", name, opt)
+			}
+		}
+	}
+	if pools, ok := conf["default-address-pools"].([]any); ok {
+		for i, p := range pools {
+			pool, _ := p.(map[string]any)
+			if _, ok := pool["base"].(string); !ok {
+				return fmt.Errorf("invalid docker.default-address-pools[%d].base: must be a subnet e.g. 172.17.0.0/16", i)
+			}
+			if !dockerValueValid(dockerNumber, pool["size"]) {
+				return fmt.Errorf("invalid docker.default-address-pools[%d].size: must be a prefix length e.g. 24", i)
+			}
+		}
+	}
+	return nil
+}
+
+// dockerValueValid returns if the value, as decoded from YAML, is of the type.
+func dockerValueValid(valueType dockerValueType, value any) bool {
+	switch valueType {
+	case dockerBool:
+		_, ok := value.(bool)
+		return ok
+	case dockerString:
+		_, ok := value.(string)
+		return ok
+	case dockerNumber:
+		switch value.(type) {
+		case int, int64, uint64, float64:
+			return true
+		}
+		return false
+	case dockerObject:
+		_, ok := value.(map[string]any)
+		return ok
+	case dockerStrings, dockerObjects:
+		elem := dockerString
+		if valueType == dockerObjects {
+			elem = dockerObject
+		}
+		switch list := value.(type) {
+		case []string:
+			return valueType == dockerStrings
+		case []any:
+			for _, v := range list {
+				if !dockerValueValid(elem, v) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// closestDockerKey returns the daemon.json key closest to the unknown key, empty if none is close.
+func closestDockerKey(key string) string {
+	// a typo of a longer key may differ by more characters
+	closest, distance := "", max(3, len(key)/4)
+	for k := range dockerDaemonKeys {
+		if d := editDistance(strings.ToLower(key), k); d < distance || (d == distance && closest != "" && k < closest) {
+			closest, distance = k, d
+		}
+	}
+	return closest
+}
+
+// editDistance returns the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
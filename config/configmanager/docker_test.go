@@ -0,0 +1,67 @@
+package configmanager
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_validateDocker(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    map[string]any
+		wantErr string
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			conf: map[string]any{
+				"debug":                 true,
+				"log-level":             "warn",
+				"mtu":                   1400,
+				"dns":                   []any{"1.1.1.1"},
+				"features":              map[string]any{"buildkit": true},
+				"log-opts":              map[string]any{"max-size": "10m"},
+				"default-address-pools": []any{map[string]any{"base": "10.10.0.0/16", "size": 24}},
+			},
+		},
+		{name: "typo", conf: map[string]any{"insecure-registry": []any{"example.com"}}, wantErr: "did you mean 'insecure-registries'"},
+		{name: "unknown key passed through", conf: map[string]any{"zzz-future-option": true}},
+		{name: "invalid type", conf: map[string]any{"debug": "yes"}, wantErr: "must be a boolean"},
+		{name: "invalid list", conf: map[string]any{"dns": []any{1}}, wantErr: "must be a list of strings"},
+		{name: "invalid log level", conf: map[string]any{"log-level": "verbose"}, wantErr: "invalid docker.log-level"},
+		{name: "invalid feature", conf: map[string]any{"features": map[string]any{"buildkit": "true"}}, wantErr: "docker.features.buildkit"},
+		{name: "invalid log opt", conf: map[string]any{"log-opts": map[string]any{"max-file": 3}}, wantErr: "docker.log-opts.max-file"},
+		{name: "invalid address pool", conf: map[string]any{"default-address-pools": []any{map[string]any{"base": "10.10.0.0/16"}}}, wantErr: "default-address-pools[0].size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDocker(tt.conf)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateDocker() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateDocker() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_editDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "abc", want: 3},
+		{a: "mtu", b: "mtu", want: 0},
+		{a: "dbug", b: "debug", want: 1},
+		{a: "kitten", b: "sitting", want: 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -152,3 +152,6 @@ const configFileName = "colima.yaml"
 
 // SSHConfigFile returns the path to generated ssh config.
 func SSHConfigFile() string { return filepath.Join(configBaseDir.Dir(), "ssh_config") }
+
+// RoutesFile returns the path to the registry of host network routes of all profiles.
+func RoutesFile() string { return filepath.Join(configBaseDir.Dir(), "routes.json") }
@@ -3,13 +3,25 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/daemon/process/credentials"
+	"github.com/abiosoft/colima/daemon/process/hosts"
 	"github.com/abiosoft/colima/daemon/process/inotify"
+	"github.com/abiosoft/colima/daemon/process/lbports"
+	"github.com/abiosoft/colima/daemon/process/mdns"
+	"github.com/abiosoft/colima/daemon/process/routes"
+	"github.com/abiosoft/colima/daemon/process/socks"
+	"github.com/abiosoft/colima/daemon/process/sshfs"
+	"github.com/abiosoft/colima/daemon/process/timesync"
 	"github.com/abiosoft/colima/daemon/process/vmnet"
+	"github.com/abiosoft/colima/daemon/process/watchdog"
 	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
 	"github.com/abiosoft/colima/util"
 	"github.com/abiosoft/colima/util/fsutil"
 	"github.com/abiosoft/colima/util/osutil"
@@ -51,7 +63,7 @@ type processManager struct {
 }
 
 func (l processManager) Dependencies(ctx context.Context, conf config.Config) (deps process.Dependency, root bool) {
-	processes := processesFromConfig(conf)
+	processes := processesFromConfig(ctx, conf)
 	return process.Dependencies(processes...)
 }
 
@@ -72,7 +84,7 @@ func (l processManager) Running(ctx context.Context, conf config.Config) (s Stat
 
 	ctx = context.WithValue(ctx, process.CtxKeyDaemon(), s.Running)
 
-	for _, p := range processesFromConfig(conf) {
+	for _, p := range processesFromConfig(ctx, conf) {
 		pErr := p.Alive(ctx)
 		s.Processes = append(s.Processes, processStatus{
 			Name:    p.Name(),
@@ -93,8 +105,15 @@ func (l processManager) Start(ctx context.Context, conf config.Config) error {
 	args := []string{osutil.Executable(), "daemon", "start", config.CurrentProfile().ShortName}
 
 	if conf.Network.Address {
-		args = append(args, "--vmnet")
+		args = append(args, "--vmnet", "--vmnet-mode", vmnet.NetworkArg(vmnet.PrimaryNetwork(conf.Network)))
 	}
+	for _, n := range conf.Network.Networks {
+		args = append(args, "--vmnet-network", vmnet.NetworkArg(n))
+	}
+	if conf.Rootless {
+		args = append(args, "--rootless")
+	}
+
 	if conf.MountINotify {
 		args = append(args, "--inotify")
 		args = append(args, "--inotify-runtime", conf.Runtime)
@@ -107,6 +126,65 @@ func (l processManager) Start(ctx context.Context, conf config.Config) error {
 		}
 	}
 
+	if watchRoutes(ctx, conf) {
+		args = append(args, "--routes")
+	}
+
+	if conf.Network.MDNS {
+		hostname := config.CurrentProfile().ID
+		if conf.Hostname != "" {
+			hostname = conf.Hostname
+		}
+		args = append(args, "--mdns", "--mdns-hostname", hostname)
+		if conf.Network.MDNSContainers {
+			args = append(args, "--mdns-runtime", conf.Runtime)
+		}
+	}
+
+	if conf.Network.SOCKSPort > 0 {
+		args = append(args, "--socks-port", strconv.Itoa(conf.Network.SOCKSPort))
+	}
+
+	if conf.Network.HostsFile {
+		args = append(args, "--hosts")
+		if conf.Kubernetes.Enabled {
+			args = append(args, "--hosts-kubernetes")
+		}
+		if conf.Runtime == docker.Name || conf.Runtime == containerd.Name {
+			args = append(args, "--hosts-runtime", conf.Runtime)
+		}
+	}
+
+	if conf.Kubernetes.Enabled && conf.Kubernetes.LoadBalancer.HostPorts {
+		args = append(args, "--lbports", "--lbports-address", conf.Network.BindAddressOrDefault().String())
+		for port, hostPort := range conf.Kubernetes.LoadBalancer.HostPortMap {
+			args = append(args, "--lbports-map", strconv.Itoa(port)+":"+strconv.Itoa(hostPort))
+		}
+	}
+
+	if conf.HostCredentials {
+		args = append(args, "--credentials")
+	}
+
+	if conf.TimeSync {
+		args = append(args, "--timesync")
+	}
+
+	if conf.Watchdog.Enabled {
+		watchdog.ResetAttempts()
+		args = append(args, "--watchdog",
+			"--watchdog-retries", strconv.Itoa(conf.Watchdog.RetriesOrDefault()),
+			"--watchdog-backoff", conf.Watchdog.BackoffOrDefault().String())
+	}
+
+	for _, m := range conf.SSHFSMounts() {
+		arg, err := sshfsMountArg(m)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--sshfs-mount", arg)
+	}
+
 	if cli.Settings.Verbose {
 		args = append(args, "--very-verbose")
 	}
@@ -121,15 +199,79 @@ func (l processManager) Stop(ctx context.Context, conf config.Config) error {
 	return l.host.RunQuiet(osutil.Executable(), "daemon", "stop", config.CurrentProfile().ShortName)
 }
 
-func processesFromConfig(conf config.Config) []process.Process {
+func processesFromConfig(ctx context.Context, conf config.Config) []process.Process {
 	var processes []process.Process
 
 	if conf.Network.Address {
-		processes = append(processes, vmnet.New())
+		n := vmnet.PrimaryNetwork(conf.Network)
+		processes = append(processes, vmnet.NewNetwork(0, n.Mode, n.Interface))
+	}
+	for i, n := range conf.Network.Networks {
+		processes = append(processes, vmnet.NewNetwork(i+1, n.Mode, n.Interface))
 	}
 	if conf.MountINotify {
 		processes = append(processes, inotify.New())
 	}
+	if watchRoutes(ctx, conf) {
+		processes = append(processes, routes.New())
+	}
+	if conf.Network.MDNS {
+		processes = append(processes, mdns.New())
+	}
+	if conf.Network.SOCKSPort > 0 {
+		processes = append(processes, socks.New())
+	}
+	if conf.Network.HostsFile {
+		processes = append(processes, hosts.New())
+	}
+	if conf.Kubernetes.Enabled && conf.Kubernetes.LoadBalancer.HostPorts {
+		processes = append(processes, lbports.New())
+	}
+	if conf.HostCredentials {
+		processes = append(processes, credentials.New())
+	}
+	if len(conf.SSHFSMounts()) > 0 {
+		processes = append(processes, sshfs.New())
+	}
+	if conf.Watchdog.Enabled {
+		processes = append(processes, watchdog.New())
+	}
+	if conf.TimeSync {
+		processes = append(processes, timesync.New())
+	}
 
 	return processes
 }
+
+// sshfsMountArg returns the daemon arg of the sshfs mount (location:mountPoint:rw|ro).
+func sshfsMountArg(m config.Mount) (string, error) {
+	location, err := util.CleanPath(m.Location)
+	if err != nil {
+		return "", fmt.Errorf("error sanitising mount path for sshfs: %w", err)
+	}
+	mountPoint := location
+	if m.MountPoint != "" {
+		if mountPoint, err = util.CleanPath(m.MountPoint); err != nil {
+			return "", fmt.Errorf("error sanitising mount point for sshfs: %w", err)
+		}
+	}
+	mode := "ro"
+	if m.Writable {
+		mode = "rw"
+	}
+	return location + ":" + mountPoint + ":" + mode, nil
+}
+
+// WatchRoutes returns if the Pod and Service network routes are watched for the config.
+func WatchRoutes(conf config.Config) bool {
+	return conf.Network.Address && (conf.Kubernetes.Enabled || conf.Network.ContainerRoutes) && (util.MacOS() || util.Linux())
+}
+
+// watchRoutes returns if the Pod and Service network routes should be watched, as set in the
+// context on startup or for the config otherwise.
+func watchRoutes(ctx context.Context, conf config.Config) bool {
+	if watch, ok := ctx.Value(CtxKey(routes.Name)).(bool); ok {
+		return watch
+	}
+	return WatchRoutes(conf)
+}
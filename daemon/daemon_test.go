@@ -0,0 +1,40 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process/routes"
+	"github.com/abiosoft/colima/util"
+)
+
+func Test_processesFromConfig_routes(t *testing.T) {
+	if !util.MacOS() && !util.Linux() {
+		t.Skip("routes not supported")
+	}
+
+	conf := config.Config{
+		Kubernetes: config.Kubernetes{Enabled: true},
+		Network:    config.Network{Address: true},
+	}
+	hasRoutes := func(ctx context.Context, conf config.Config) bool {
+		for _, p := range processesFromConfig(ctx, conf) {
+			if p.Name() == routes.Name {
+				return true
+			}
+		}
+		return false
+	}
+
+	// status and dependencies are retrieved without the startup context
+	if !hasRoutes(context.Background(), conf) {
+		t.Errorf("processesFromConfig() missing %s process", routes.Name)
+	}
+
+	// the startup context takes precedence over the config
+	ctx := context.WithValue(context.Background(), CtxKey(routes.Name), false)
+	if hasRoutes(ctx, conf) {
+		t.Errorf("processesFromConfig() unexpected %s process", routes.Name)
+	}
+}
@@ -0,0 +1,288 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util"
+	"github.com/sirupsen/logrus"
+)
+
+const Name = "credentials"
+
+const (
+	// GuestDir is the dir of the forwarded socket in the VM, owned by the user.
+	GuestDir = "/run/colima-credentials"
+	// GuestSocket is the socket in the VM serving the credentials of the host.
+	GuestSocket = GuestDir + "/helper.sock"
+)
+
+// restartInterval is the interval for restarting the forwarding after it exits e.g. when the VM restarts.
+const restartInterval = 5 * time.Second
+
+// dockerHubServer is the server of Docker Hub in the docker credential stores.
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// HostSocket is the socket on the host serving the credentials.
+func HostSocket() string { return filepath.Join(process.Dir(), "credentials.sock") }
+
+// New returns the registry credentials process.
+// The credential helpers of the docker config of the host are served on a socket, forwarded
+// to the VM by ssh remote forwarding for the credential helper of docker and the kubelet.
+func New() process.Process {
+	return &credentialsProcess{log: logrus.WithField("context", "credentials")}
+}
+
+var _ process.Process = (*credentialsProcess)(nil)
+
+type credentialsProcess struct {
+	log *logrus.Entry
+}
+
+// Alive implements process.Process
+func (c *credentialsProcess) Alive(ctx context.Context) error {
+	daemonRunning, _ := ctx.Value(process.CtxKeyDaemon()).(bool)
+
+	// if the parent is active, we can assume the server is active.
+	if daemonRunning {
+		return nil
+	}
+	return fmt.Errorf("credentials server not running")
+}
+
+// Dependencies implements process.Process
+func (*credentialsProcess) Dependencies() (deps []process.Dependency, root bool) {
+	// ssh is a dependency of Lima
+	return nil, false
+}
+
+// Name implements process.Process
+func (*credentialsProcess) Name() string {
+	return Name
+}
+
+// Start implements process.Process
+func (c *credentialsProcess) Start(ctx context.Context) error {
+	socket := HostSocket()
+	_ = os.Remove(socket)
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("error listening on credentials socket: %w", err)
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		_ = l.Close()
+		return fmt.Errorf("error setting permission of credentials socket: %w", err)
+	}
+
+	server := &http.Server{Handler: c.handler()}
+	go func() {
+		if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.log.Error(fmt.Errorf("error serving credentials: %w", err))
+		}
+	}()
+	defer func() { _ = server.Close() }()
+
+	c.log.Infof("serving the registry credentials of the host on %s", GuestSocket)
+
+	profileID := config.CurrentProfile().ID
+	for {
+		cmd := exec.CommandContext(ctx, "ssh", forwardArgs(profileID, socket)...)
+		if out, err := cmd.CombinedOutput(); err != nil && ctx.Err() == nil {
+			c.log.Tracef("credentials forwarding exited: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(restartInterval):
+		}
+	}
+}
+
+// forwardArgs returns the ssh args forwarding the guest socket to the host socket.
+func forwardArgs(profileID, socket string) []string {
+	return limautil.SSHArgs(profileID, "-N", "-R", GuestSocket+":"+socket, "-o", "ExitOnForwardFailure=yes")
+}
+
+// handler returns the handler of the requests of the credential helper and the kubelet
+// credential provider in the VM.
+//
+//	POST /get      server in the body, the credentials of the docker credential helper protocol
+//	GET  /list     the servers and usernames of the credential store
+//	POST /kubelet  CredentialProviderRequest in the body, the CredentialProviderResponse
+func (c *credentialsProcess) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /get", func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		creds, err := get(strings.TrimSpace(string(b)))
+		if err != nil {
+			c.log.Tracef("error retrieving credentials: %v", err)
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(creds)
+	})
+
+	mux.HandleFunc("GET /list", func(w http.ResponseWriter, r *http.Request) {
+		list := map[string]string{}
+		if conf, err := readDockerConfig(); err == nil && conf.CredsStore != "" {
+			if out, err := runHelper(conf.CredsStore, "list", ""); err == nil {
+				_ = json.Unmarshal(out, &list)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(list)
+	})
+
+	mux.HandleFunc("POST /kubelet", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Image string `json:"image"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(kubeletResponse(req.Image))
+	})
+
+	return mux
+}
+
+// Credentials are the credentials of the docker credential helper protocol.
+type Credentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// dockerConfig is the credential helper settings of the docker config of the host.
+type dockerConfig struct {
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// helper returns the credential helper of the server, the credential helper of the registry
+// if set, or the credential store.
+func (d dockerConfig) helper(server string) string {
+	if h, ok := d.CredHelpers[server]; ok {
+		return h
+	}
+	if h, ok := d.CredHelpers[serverHost(server)]; ok {
+		return h
+	}
+	return d.CredsStore
+}
+
+// serverHost returns the host of the server, with the scheme and path removed.
+func serverHost(server string) string {
+	if _, s, ok := strings.Cut(server, "://"); ok {
+		server = s
+	}
+	host, _, _ := strings.Cut(server, "/")
+	return host
+}
+
+// readDockerConfig reads the docker config of the host, in $DOCKER_CONFIG if set.
+func readDockerConfig() (dockerConfig, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		dir = filepath.Join(util.HomeDir(), ".docker")
+	}
+
+	var conf dockerConfig
+	b, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return conf, fmt.Errorf("error reading docker config: %w", err)
+	}
+	if err := json.Unmarshal(b, &conf); err != nil {
+		return conf, fmt.Errorf("error parsing docker config: %w", err)
+	}
+	return conf, nil
+}
+
+// runHelper runs the action of the docker credential helper on the host with the input.
+func runHelper(helper, action, input string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker-credential-"+helper, action)
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// the error is written to stdout by the credential helpers
+		msg := strings.TrimSpace(stdout.String() + " " + stderr.String())
+		return nil, fmt.Errorf("error running docker-credential-%s %s: %w: %s", helper, action, err, msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// get returns the credentials of the server from the credential helper of the host.
+func get(server string) (Credentials, error) {
+	var creds Credentials
+	conf, err := readDockerConfig()
+	if err != nil {
+		return creds, err
+	}
+	helper := conf.helper(server)
+	if helper == "" {
+		return creds, fmt.Errorf("no credential helper for %s", server)
+	}
+
+	out, err := runHelper(helper, "get", server)
+	if err != nil {
+		return creds, err
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return creds, fmt.Errorf("error parsing credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// imageRegistry returns the registry of the image, docker.io if the image has no registry.
+func imageRegistry(image string) string {
+	registry, _, ok := strings.Cut(image, "/")
+	if !ok || (!strings.ContainsAny(registry, ".:") && registry != "localhost") {
+		return "docker.io"
+	}
+	return registry
+}
+
+// kubeletResponse returns the CredentialProviderResponse of the kubelet for the image, with
+// the credentials of the registry of the image, if any.
+func kubeletResponse(image string) map[string]any {
+	auth := map[string]any{}
+
+	registry := imageRegistry(image)
+	server := registry
+	if registry == "docker.io" {
+		server = dockerHubServer
+	}
+	// identity tokens are not supported by the kubelet
+	if creds, err := get(server); err == nil && creds.Username != "<token>" {
+		auth[registry] = map[string]string{"username": creds.Username, "password": creds.Secret}
+	}
+
+	return map[string]any{
+		"apiVersion":   "credentialprovider.kubelet.k8s.io/v1",
+		"kind":         "CredentialProviderResponse",
+		"cacheKeyType": "Registry",
+		"auth":         auth,
+	}
+}
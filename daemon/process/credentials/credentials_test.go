@@ -0,0 +1,53 @@
+package credentials
+
+import (
+	"testing"
+)
+
+func Test_imageRegistry(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "nginx", want: "docker.io"},
+		{image: "library/nginx:latest", want: "docker.io"},
+		{image: "ghcr.io/abiosoft/colima", want: "ghcr.io"},
+		{image: "localhost/app", want: "localhost"},
+		{image: "localhost:5000/app", want: "localhost:5000"},
+		{image: "123456789012.dkr.ecr.us-east-1.amazonaws.com/app@sha256:abc", want: "123456789012.dkr.ecr.us-east-1.amazonaws.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := imageRegistry(tt.image); got != tt.want {
+				t.Errorf("imageRegistry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dockerConfig_helper(t *testing.T) {
+	conf := dockerConfig{
+		CredsStore: "osxkeychain",
+		CredHelpers: map[string]string{
+			"gcr.io": "gcloud",
+			"123456789012.dkr.ecr.us-east-1.amazonaws.com": "ecr-login",
+		},
+	}
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{server: dockerHubServer, want: "osxkeychain"},
+		{server: "gcr.io", want: "gcloud"},
+		{server: "https://gcr.io/v2/", want: "gcloud"},
+		{server: "123456789012.dkr.ecr.us-east-1.amazonaws.com", want: "ecr-login"},
+		{server: "ghcr.io", want: "osxkeychain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			if got := conf.helper(tt.server); got != tt.want {
+				t.Errorf("helper() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
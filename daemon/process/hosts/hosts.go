@@ -0,0 +1,123 @@
+package hosts
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/sirupsen/logrus"
+)
+
+const Name = "hosts"
+const watchInterval = 10 * time.Second
+
+// Args are the hosts file controller arguments.
+type Args struct {
+	// VMIP returns the current IP address of the VM.
+	VMIP func(ctx context.Context) (string, error)
+	// Hostnames returns the hostnames to point to the VM e.g. of the Ingresses.
+	Hostnames func(ctx context.Context) ([]string, error)
+	// Update replaces the entries in the hosts file with the hostnames pointing to ip.
+	Update func(ctx context.Context, ip string, hostnames []string) error
+	// Cleanup removes the entries from the hosts file.
+	Cleanup func(ctx context.Context) error
+}
+
+func CtxKeyArgs() any { return struct{ name string }{name: "hosts_args"} }
+
+// New returns the hosts file controller process.
+func New() process.Process {
+	return &hostsProcess{
+		log: logrus.WithField("context", "hosts"),
+	}
+}
+
+var _ process.Process = (*hostsProcess)(nil)
+
+type hostsProcess struct {
+	// last written entries
+	vmIP      string
+	hostnames []string
+
+	log *logrus.Entry
+}
+
+// Alive implements process.Process
+func (h *hostsProcess) Alive(ctx context.Context) error {
+	daemonRunning, _ := ctx.Value(process.CtxKeyDaemon()).(bool)
+
+	// if the parent is active, we can assume the controller is active.
+	if daemonRunning {
+		return nil
+	}
+	return fmt.Errorf("hosts file controller not running")
+}
+
+// Dependencies implements process.Process
+func (*hostsProcess) Dependencies() (deps []process.Dependency, root bool) {
+	return nil, false
+}
+
+// Name implements process.Process
+func (*hostsProcess) Name() string {
+	return Name
+}
+
+// Start implements process.Process
+func (h *hostsProcess) Start(ctx context.Context) error {
+	args, ok := ctx.Value(CtxKeyArgs()).(Args)
+	if !ok {
+		return fmt.Errorf("args missing in context")
+	}
+
+	h.log.Info("managing hosts file entries")
+	defer func() {
+		// ctx is done, the cleanup requires a fresh context
+		if err := args.Cleanup(context.Background()); err != nil {
+			h.log.Errorf("error cleaning up hosts file entries: %v", err)
+		}
+	}()
+
+	h.check(ctx, args)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchInterval):
+			h.check(ctx, args)
+		}
+	}
+}
+
+// check updates the hosts file if the VM IP address or the hostnames have changed since the last update.
+// Failed updates are retried on the next check.
+func (h *hostsProcess) check(ctx context.Context, args Args) {
+	vmIP, err := args.VMIP(ctx)
+	if err != nil {
+		// VM not (yet) reachable
+		h.log.Tracef("error retrieving VM IP: %v", err)
+		return
+	}
+
+	hostnames, err := args.Hostnames(ctx)
+	if err != nil {
+		// retrieved hostnames are incomplete, retain the current entries
+		h.log.Tracef("error retrieving hostnames: %v", err)
+		return
+	}
+	sort.Strings(hostnames)
+
+	if vmIP == h.vmIP && slices.Equal(hostnames, h.hostnames) {
+		return
+	}
+
+	if err := args.Update(ctx, vmIP, hostnames); err != nil {
+		h.log.Errorf("error updating hosts file entries: %v", err)
+		return
+	}
+	h.vmIP, h.hostnames = vmIP, hostnames
+	h.log.Infof("hosts file entries updated: %v -> %s", hostnames, vmIP)
+}
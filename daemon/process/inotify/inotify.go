@@ -18,6 +18,8 @@ type Args struct {
 	environment.GuestActions
 	Dirs    []string
 	Runtime string
+	// Rootless is set for the rootless containerd of the user.
+	Rootless bool
 }
 
 func CtxKeyArgs() any { return struct{ name string }{name: "inotify_args"} }
@@ -32,9 +34,10 @@ func New() process.Process {
 var _ process.Process = (*inotifyProcess)(nil)
 
 type inotifyProcess struct {
-	vmVols  []string
-	guest   environment.GuestActions
-	runtime string
+	vmVols   []string
+	guest    environment.GuestActions
+	runtime  string
+	rootless bool
 
 	log *logrus.Entry
 }
@@ -70,6 +73,7 @@ func (f *inotifyProcess) Start(ctx context.Context) error {
 
 	f.guest = args.GuestActions
 	f.runtime = args.Runtime
+	f.rootless = args.Rootless
 	log := f.log
 
 	log.Info("waiting for VM to start")
@@ -34,7 +34,8 @@ func (f *inotifyProcess) monitorContainerVolumes(ctx context.Context, c chan<- [
 
 		// containerd
 		var namespaces []string
-		out, err := f.guest.RunOutput("sudo", "nerdctl", "namespace", "list", "-q")
+		nerdctl := containerd.Nerdctl(f.rootless)
+		out, err := f.guest.RunOutput(append(nerdctl, "namespace", "list", "-q")...)
 		if err != nil {
 			return nil, fmt.Errorf("error retrieving containerd namespaces: %w", err)
 		}
@@ -43,7 +44,7 @@ func (f *inotifyProcess) monitorContainerVolumes(ctx context.Context, c chan<- [
 		}
 
 		for _, ns := range namespaces {
-			v, err := f.fetchVolumes("sudo", "nerdctl", "--namespace", ns)
+			v, err := f.fetchVolumes(append(nerdctl, "--namespace", ns)...)
 			if err != nil {
 				return nil, fmt.Errorf("error retrieving containerd volumes: %w", err)
 			}
@@ -0,0 +1,173 @@
+package lbports
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util/routing"
+	"github.com/sirupsen/logrus"
+)
+
+const Name = "lbports"
+const watchInterval = 10 * time.Second
+
+// Args are the LoadBalancer port forwarder arguments.
+type Args struct {
+	// Address is the host address of the forwarded ports.
+	Address string
+	// PortMap maps the Service ports to the host ports, the same port if unmapped.
+	PortMap map[int]int
+	// Ports returns the ports of the LoadBalancer Services in the VM.
+	Ports func(ctx context.Context) ([]routing.LoadBalancerPort, error)
+}
+
+func CtxKeyArgs() any { return struct{ name string }{name: "lbports_args"} }
+
+// New returns the LoadBalancer port forwarder process.
+// The ports of the LoadBalancer Services are forwarded to the host by ssh local port
+// forwarding, as with Docker Desktop, and updated as the Services change.
+func New() process.Process {
+	return &lbPortsProcess{log: logrus.WithField("context", "lbports")}
+}
+
+var _ process.Process = (*lbPortsProcess)(nil)
+
+type lbPortsProcess struct {
+	// active forwards and the cancellation of the ssh process
+	forwards []string
+	cancel   context.CancelFunc
+
+	log *logrus.Entry
+}
+
+// Alive implements process.Process
+func (l *lbPortsProcess) Alive(ctx context.Context) error {
+	daemonRunning, _ := ctx.Value(process.CtxKeyDaemon()).(bool)
+
+	// if the parent is active, we can assume the forwarder is active.
+	if daemonRunning {
+		return nil
+	}
+	return fmt.Errorf("LoadBalancer port forwarder not running")
+}
+
+// Dependencies implements process.Process
+func (*lbPortsProcess) Dependencies() (deps []process.Dependency, root bool) {
+	// ssh is a dependency of Lima
+	return nil, false
+}
+
+// Name implements process.Process
+func (*lbPortsProcess) Name() string {
+	return Name
+}
+
+// Start implements process.Process
+func (l *lbPortsProcess) Start(ctx context.Context) error {
+	args, ok := ctx.Value(CtxKeyArgs()).(Args)
+	if !ok {
+		return fmt.Errorf("args missing in context")
+	}
+
+	l.log.Infof("forwarding LoadBalancer ports to %s", args.Address)
+	defer l.stop()
+
+	l.check(ctx, args)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchInterval):
+			l.check(ctx, args)
+		}
+	}
+}
+
+// check restarts the forwarding if the ports of the LoadBalancer Services have changed.
+func (l *lbPortsProcess) check(ctx context.Context, args Args) {
+	ports, err := args.Ports(ctx)
+	if err != nil {
+		// cluster not (yet) reachable, retain the current forwards
+		l.log.Tracef("error retrieving LoadBalancer ports: %v", err)
+		return
+	}
+
+	forwards := forwardSpecs(args.Address, args.PortMap, ports)
+	if slices.Equal(forwards, l.forwards) && l.cancel != nil {
+		return
+	}
+
+	l.stop()
+	l.forwards = forwards
+	if len(forwards) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	l.cancel = cancel
+	go l.forward(ctx, forwards)
+	l.log.Infof("LoadBalancer ports forwarded: %v", forwards)
+}
+
+// stop stops the active forwards, if any.
+func (l *lbPortsProcess) stop() {
+	if l.cancel != nil {
+		l.cancel()
+		l.cancel = nil
+	}
+}
+
+// forward runs ssh with the local port forwards until ctx is done, restarted on exit e.g. when the VM restarts.
+func (l *lbPortsProcess) forward(ctx context.Context, forwards []string) {
+	profileID := config.CurrentProfile().ID
+	for {
+		cmd := exec.CommandContext(ctx, "ssh", forwardArgs(profileID, forwards)...)
+		if out, err := cmd.CombinedOutput(); err != nil && ctx.Err() == nil {
+			l.log.Tracef("LoadBalancer port forwarding exited: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchInterval):
+		}
+	}
+}
+
+// forwardSpecs returns the ssh local forward specs of the ports, as address:hostPort:ip:port.
+// A host port is forwarded once, to the first Service port.
+func forwardSpecs(address string, portMap map[int]int, ports []routing.LoadBalancerPort) []string {
+	var specs []string
+	seen := map[int]bool{}
+	for _, p := range ports {
+		hostPort := p.Port
+		if mapped, ok := portMap[p.Port]; ok {
+			hostPort = mapped
+		}
+		if hostPort <= 0 || seen[hostPort] {
+			continue
+		}
+		seen[hostPort] = true
+		specs = append(specs, net.JoinHostPort(address, strconv.Itoa(hostPort))+":"+p.String())
+	}
+	return specs
+}
+
+// forwardArgs returns the ssh args for the forwards.
+// The ports that cannot be bound on the host are skipped.
+func forwardArgs(profileID string, forwards []string) []string {
+	opts := []string{"-N", "-o", "ExitOnForwardFailure=no"}
+	for _, f := range forwards {
+		opts = append(opts, "-L", f)
+	}
+	return limautil.SSHArgs(profileID, opts...)
+}
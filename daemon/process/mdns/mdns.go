@@ -0,0 +1,233 @@
+package mdns
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util"
+	"github.com/sirupsen/logrus"
+)
+
+const Name = "mdns"
+const watchInterval = 10 * time.Second
+
+// Args are the mDNS advertiser arguments.
+type Args struct {
+	// Hostname is the hostname of the VM, advertised as <hostname>.local.
+	Hostname string
+	// VMIP returns the current IP address of the VM.
+	VMIP func(ctx context.Context) (string, error)
+	// Containers returns the names of the running containers, advertised as <container>.<hostname>.local.
+	// It is nil if container hostnames are not advertised.
+	Containers func(ctx context.Context) ([]string, error)
+}
+
+func CtxKeyArgs() any { return struct{ name string }{name: "mdns_args"} }
+
+// New returns the mDNS advertiser process.
+func New() process.Process {
+	return &mdnsProcess{
+		publishers: map[string]publisher{},
+		log:        logrus.WithField("context", "mdns"),
+	}
+}
+
+var _ process.Process = (*mdnsProcess)(nil)
+
+type mdnsProcess struct {
+	vmIP       string
+	publishers map[string]publisher // by hostname
+
+	log *logrus.Entry
+}
+
+// Alive implements process.Process
+func (m *mdnsProcess) Alive(ctx context.Context) error {
+	daemonRunning, _ := ctx.Value(process.CtxKeyDaemon()).(bool)
+
+	// if the parent is active, we can assume the advertiser is active.
+	if daemonRunning {
+		return nil
+	}
+	return fmt.Errorf("mdns advertiser not running")
+}
+
+// Dependencies implements process.Process
+func (*mdnsProcess) Dependencies() (deps []process.Dependency, root bool) {
+	return []process.Dependency{publisherCommand{}}, false
+}
+
+// Name implements process.Process
+func (*mdnsProcess) Name() string {
+	return Name
+}
+
+// Start implements process.Process
+func (m *mdnsProcess) Start(ctx context.Context) error {
+	args, ok := ctx.Value(CtxKeyArgs()).(Args)
+	if !ok {
+		return fmt.Errorf("args missing in context")
+	}
+
+	m.log.Infof("advertising %s.local via mDNS", args.Hostname)
+	defer m.unpublishAll()
+
+	m.check(ctx, args)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchInterval):
+			m.check(ctx, args)
+		}
+	}
+}
+
+// check publishes the hostnames for the current VM IP address and running containers.
+// Publishers are restarted if the VM IP address has changed.
+func (m *mdnsProcess) check(ctx context.Context, args Args) {
+	vmIP, err := args.VMIP(ctx)
+	if err != nil {
+		// VM not (yet) reachable
+		m.log.Tracef("error retrieving VM IP: %v", err)
+		return
+	}
+
+	if vmIP != m.vmIP {
+		if m.vmIP != "" {
+			m.log.Infof("VM IP address changed from %s to %s, re-advertising hostnames", m.vmIP, vmIP)
+		}
+		m.unpublishAll()
+		m.vmIP = vmIP
+	}
+
+	hostnames := []string{args.Hostname}
+	if args.Containers != nil {
+		containers, err := args.Containers(ctx)
+		if err != nil {
+			m.log.Tracef("error retrieving containers: %v", err)
+		}
+		for _, c := range containers {
+			hostnames = append(hostnames, c+"."+args.Hostname)
+		}
+	}
+
+	m.sync(ctx, hostnames)
+}
+
+// sync starts the publishers for the hostnames and stops the others.
+func (m *mdnsProcess) sync(ctx context.Context, hostnames []string) {
+	wanted := map[string]bool{}
+	for _, h := range hostnames {
+		wanted[h] = true
+	}
+
+	for h := range m.publishers {
+		if !wanted[h] {
+			m.unpublish(h)
+		}
+	}
+
+	sort.Strings(hostnames)
+	for _, h := range hostnames {
+		if p, ok := m.publishers[h]; ok && p.running() {
+			continue
+		}
+		p, err := publish(ctx, h+".local", m.vmIP)
+		if err != nil {
+			m.log.Errorf("error advertising %s.local: %v", h, err)
+			continue
+		}
+		m.publishers[h] = p
+		m.log.Infof("advertising %s.local -> %s", h, m.vmIP)
+	}
+}
+
+func (m *mdnsProcess) unpublish(hostname string) {
+	if p, ok := m.publishers[hostname]; ok {
+		p.stop()
+		delete(m.publishers, hostname)
+		m.log.Infof("stopped advertising %s.local", hostname)
+	}
+}
+
+func (m *mdnsProcess) unpublishAll() {
+	for h := range m.publishers {
+		m.unpublish(h)
+	}
+}
+
+// publisher is a running command advertising a hostname.
+type publisher struct {
+	stop func()
+	done chan struct{}
+}
+
+// running returns if the command has not exited.
+func (p publisher) running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// publish starts the command to advertise the address record for hostname.
+// The command runs until stopped or ctx is done.
+func publish(ctx context.Context, hostname, ip string) (publisher, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	args := publishArgs(hostname, ip)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return publisher{}, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(done)
+	}()
+	return publisher{stop: cancel, done: done}, nil
+}
+
+// publishArgs returns the command to advertise the address record for hostname.
+// dns-sd is used on macOS and avahi-publish on Linux.
+func publishArgs(hostname, ip string) []string {
+	if util.MacOS() {
+		// proxy registration, the service is only a placeholder for the address record
+		name := strings.TrimSuffix(hostname, ".local")
+		return []string{"dns-sd", "-P", name, "_device-info._tcp", "local", "0", hostname, ip}
+	}
+	return []string{"avahi-publish", "--address", "--no-reverse", hostname, ip}
+}
+
+var _ process.Dependency = publisherCommand{}
+
+// publisherCommand is the command for advertising hostnames.
+type publisherCommand struct{}
+
+func (publisherCommand) command() string {
+	if util.MacOS() {
+		return "dns-sd"
+	}
+	return "avahi-publish"
+}
+
+// Installed implements process.Dependency
+func (p publisherCommand) Installed() bool {
+	_, err := exec.LookPath(p.command())
+	return err == nil
+}
+
+// Install implements process.Dependency
+func (p publisherCommand) Install(environment.HostActions) error {
+	return fmt.Errorf("%s not found, install avahi-utils and ensure avahi-daemon is running", p.command())
+}
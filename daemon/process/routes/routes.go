@@ -0,0 +1,106 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/sirupsen/logrus"
+)
+
+const Name = "routes"
+const watchInterval = 10 * time.Second
+
+// Args are the route watcher arguments.
+type Args struct {
+	// VMIP returns the current IP address of the VM.
+	VMIP func(ctx context.Context) (string, error)
+	// Repair re-points the Pod and Service network routes to the VM.
+	Repair func(ctx context.Context) error
+}
+
+func CtxKeyArgs() any { return struct{ name string }{name: "routes_args"} }
+
+// New returns the route watcher process.
+func New() process.Process {
+	return &routesProcess{
+		log: logrus.WithField("context", "routes"),
+	}
+}
+
+var _ process.Process = (*routesProcess)(nil)
+
+type routesProcess struct {
+	vmIP string
+
+	log *logrus.Entry
+}
+
+// Alive implements process.Process
+func (r *routesProcess) Alive(ctx context.Context) error {
+	daemonRunning, _ := ctx.Value(process.CtxKeyDaemon()).(bool)
+
+	// if the parent is active, we can assume the watcher is active.
+	if daemonRunning {
+		return nil
+	}
+	return fmt.Errorf("route watcher not running")
+}
+
+// Dependencies implements process.Process
+func (*routesProcess) Dependencies() (deps []process.Dependency, root bool) {
+	return nil, false
+}
+
+// Name implements process.Process
+func (*routesProcess) Name() string {
+	return Name
+}
+
+// Start implements process.Process
+func (r *routesProcess) Start(ctx context.Context) error {
+	args, ok := ctx.Value(CtxKeyArgs()).(Args)
+	if !ok {
+		return fmt.Errorf("args missing in context")
+	}
+
+	r.log.Info("watching VM IP address for changes")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchInterval):
+			r.check(ctx, args)
+		}
+	}
+}
+
+// check repairs the routes if the VM IP address has changed since the last check.
+func (r *routesProcess) check(ctx context.Context, args Args) {
+	vmIP, err := args.VMIP(ctx)
+	if err != nil {
+		// VM not (yet) reachable
+		r.log.Tracef("error retrieving VM IP: %v", err)
+		return
+	}
+
+	if vmIP == r.vmIP {
+		return
+	}
+
+	// the routes are set up on startup, only changes are relevant
+	if r.vmIP == "" {
+		r.log.Infof("VM IP address is %s", vmIP)
+		r.vmIP = vmIP
+		return
+	}
+
+	r.log.Infof("VM IP address changed from %s to %s, repairing routes", r.vmIP, vmIP)
+	if err := args.Repair(ctx); err != nil {
+		r.log.Errorf("error repairing routes: %v", err)
+		return
+	}
+	r.vmIP = vmIP
+}
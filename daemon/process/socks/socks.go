@@ -0,0 +1,111 @@
+package socks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/sirupsen/logrus"
+)
+
+const Name = "socks"
+
+// restartInterval is the interval for restarting the proxy after it exits e.g. when the VM restarts.
+const restartInterval = 5 * time.Second
+
+// Args are the SOCKS5 proxy arguments.
+type Args struct {
+	// Port is the port of the proxy on localhost.
+	Port int
+}
+
+func CtxKeyArgs() any { return struct{ name string }{name: "socks_args"} }
+
+// New returns the SOCKS5 proxy process.
+// The proxy is provided by ssh dynamic port forwarding, connections are made
+// from the VM network namespace to reach the Pod, Service and container IPs.
+func New() process.Process {
+	return &socksProcess{log: logrus.WithField("context", "socks")}
+}
+
+var _ process.Process = (*socksProcess)(nil)
+
+type socksProcess struct {
+	log *logrus.Entry
+}
+
+// Alive implements process.Process
+func (s *socksProcess) Alive(ctx context.Context) error {
+	daemonRunning, _ := ctx.Value(process.CtxKeyDaemon()).(bool)
+
+	// if the parent is active, we can assume the proxy is active.
+	if daemonRunning {
+		return nil
+	}
+	return fmt.Errorf("socks proxy not running")
+}
+
+// Dependencies implements process.Process
+func (*socksProcess) Dependencies() (deps []process.Dependency, root bool) {
+	return []process.Dependency{sshCommand{}}, false
+}
+
+// Name implements process.Process
+func (*socksProcess) Name() string {
+	return Name
+}
+
+// Start implements process.Process
+func (s *socksProcess) Start(ctx context.Context) error {
+	args, ok := ctx.Value(CtxKeyArgs()).(Args)
+	if !ok {
+		return fmt.Errorf("args missing in context")
+	}
+
+	profileID := config.CurrentProfile().ID
+	s.log.Infof("starting SOCKS5 proxy on %s", address(args.Port))
+
+	for {
+		cmd := exec.CommandContext(ctx, "ssh", proxyArgs(profileID, args.Port)...)
+		if err := cmd.Run(); err != nil && ctx.Err() == nil {
+			s.log.Tracef("SOCKS5 proxy exited: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(restartInterval):
+		}
+	}
+}
+
+// address returns the address of the proxy for port.
+func address(port int) string { return net.JoinHostPort("127.0.0.1", strconv.Itoa(port)) }
+
+// proxyArgs returns the ssh args for the proxy on port.
+func proxyArgs(profileID string, port int) []string {
+	return limautil.SSHArgs(profileID, "-N", "-D", address(port), "-o", "ExitOnForwardFailure=yes")
+}
+
+var _ process.Dependency = sshCommand{}
+
+// sshCommand is the ssh client for the proxy.
+type sshCommand struct{}
+
+// Installed implements process.Dependency
+func (sshCommand) Installed() bool {
+	_, err := exec.LookPath("ssh")
+	return err == nil
+}
+
+// Install implements process.Dependency
+func (sshCommand) Install(environment.HostActions) error {
+	return fmt.Errorf("ssh not found, install an OpenSSH client")
+}
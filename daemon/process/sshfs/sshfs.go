@@ -0,0 +1,182 @@
+package sshfs
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/sirupsen/logrus"
+)
+
+const Name = "sshfs"
+
+// restartInterval is the interval for remounting after sshfs exits e.g. when the VM restarts.
+const restartInterval = 5 * time.Second
+
+// sftpServers are the locations of the sftp server of OpenSSH on macOS and Linux distros.
+var sftpServers = []string{
+	"/usr/libexec/sftp-server",
+	"/usr/lib/openssh/sftp-server",
+	"/usr/libexec/openssh/sftp-server",
+	"/usr/lib/ssh/sftp-server",
+}
+
+// Mount is a directory of the host mounted in the VM.
+type Mount struct {
+	Location   string
+	MountPoint string
+	Writable   bool
+}
+
+// Args are the sshfs mount arguments.
+type Args struct {
+	Mounts []Mount
+}
+
+func CtxKeyArgs() any { return struct{ name string }{name: "sshfs_args"} }
+
+// New returns the sshfs mount process.
+// The directories are mounted with reverse sshfs, sshfs in the VM is served by the sftp server
+// of the host over ssh. It is used for the sshfs mounts combined with virtiofs or 9p mounts,
+// Lima supports a single mount type.
+func New() process.Process {
+	return &sshfsProcess{log: logrus.WithField("context", "sshfs")}
+}
+
+var _ process.Process = (*sshfsProcess)(nil)
+
+type sshfsProcess struct {
+	log *logrus.Entry
+}
+
+// Alive implements process.Process
+func (s *sshfsProcess) Alive(ctx context.Context) error {
+	daemonRunning, _ := ctx.Value(process.CtxKeyDaemon()).(bool)
+
+	// if the parent is active, we can assume the mounts are active.
+	if daemonRunning {
+		return nil
+	}
+	return fmt.Errorf("sshfs mounts not running")
+}
+
+// Dependencies implements process.Process
+func (*sshfsProcess) Dependencies() (deps []process.Dependency, root bool) {
+	return []process.Dependency{sftpServer{}}, false
+}
+
+// Name implements process.Process
+func (*sshfsProcess) Name() string {
+	return Name
+}
+
+// Start implements process.Process
+func (s *sshfsProcess) Start(ctx context.Context) error {
+	args, ok := ctx.Value(CtxKeyArgs()).(Args)
+	if !ok {
+		return fmt.Errorf("args missing in context")
+	}
+
+	server, err := sftpServerPath()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, m := range args.Mounts {
+		wg.Add(1)
+		go func(m Mount) {
+			defer wg.Done()
+			s.log.Infof("mounting %s at %s", m.Location, m.MountPoint)
+			for {
+				if err := s.mount(ctx, server, m); err != nil && ctx.Err() == nil {
+					s.log.Tracef("sshfs mount of %s exited: %v", m.Location, err)
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(restartInterval):
+				}
+			}
+		}(m)
+	}
+	wg.Wait()
+	return nil
+}
+
+// mount runs sshfs in the VM connected to the sftp server of the host until either exits.
+func (s *sshfsProcess) mount(ctx context.Context, server string, m Mount) error {
+	profileID := config.CurrentProfile().ID
+	ssh := exec.CommandContext(ctx, "ssh", sshArgs(profileID, m)...)
+	sftp := exec.CommandContext(ctx, server)
+	if !m.Writable {
+		sftp.Args = append(sftp.Args, "-R")
+	}
+
+	in, err := sftp.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	ssh.Stdin = in
+	out, err := ssh.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	sftp.Stdin = out
+
+	if err := sftp.Start(); err != nil {
+		return fmt.Errorf("error starting sftp server: %w", err)
+	}
+	defer func() {
+		_ = sftp.Process.Kill()
+		_ = sftp.Wait()
+	}()
+	return ssh.Run()
+}
+
+// sshArgs returns the ssh args for running sshfs for the mount in the VM.
+func sshArgs(profileID string, m Mount) []string {
+	opts := []string{"slave", "allow_other", "follow_symlinks"}
+	if !m.Writable {
+		opts = append(opts, "ro")
+	}
+	script := fmt.Sprintf("sudo umount -l %[1]q 2>/dev/null; sudo mkdir -p %[1]q && exec sudo sshfs :%[2]q %[1]q -o %[3]s",
+		m.MountPoint, m.Location, strings.Join(opts, ","))
+
+	return append(limautil.SSHArgs(profileID, "-T"), script)
+}
+
+// sftpServerPath returns the path to the sftp server of the host.
+func sftpServerPath() (string, error) {
+	for _, p := range sftpServers {
+		if _, err := exec.LookPath(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("sftp-server not found, install the OpenSSH server")
+}
+
+var _ process.Dependency = sftpServer{}
+
+// sftpServer is the sftp server of OpenSSH for the mounts.
+type sftpServer struct{}
+
+// Installed implements process.Dependency
+func (sftpServer) Installed() bool {
+	_, err := sftpServerPath()
+	return err == nil
+}
+
+// Install implements process.Dependency
+func (sftpServer) Install(environment.HostActions) error {
+	_, err := sftpServerPath()
+	return err
+}
@@ -0,0 +1,131 @@
+package timesync
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/sirupsen/logrus"
+)
+
+const Name = "timesync"
+
+const (
+	// checkInterval is the interval for checking the clock of the VM.
+	checkInterval = 30 * time.Second
+	// maxDrift is the drift of the clock of the VM above which the clock is set, the
+	// measurement includes the latency of ssh.
+	maxDrift = time.Second
+)
+
+// Args are the time sync arguments.
+type Args struct {
+	environment.GuestActions
+}
+
+func CtxKeyArgs() any { return struct{ name string }{name: "timesync_args"} }
+
+// New returns the time sync process.
+// The clock of the VM is set to the clock of the host when it drifts, e.g. after the host
+// sleeps, as the VM has no time source of the host.
+func New() process.Process {
+	return &timesyncProcess{log: logrus.WithField("context", "timesync")}
+}
+
+var _ process.Process = (*timesyncProcess)(nil)
+
+type timesyncProcess struct {
+	log *logrus.Entry
+}
+
+// Alive implements process.Process
+func (t *timesyncProcess) Alive(ctx context.Context) error {
+	daemonRunning, _ := ctx.Value(process.CtxKeyDaemon()).(bool)
+
+	// if the parent is active, we can assume the time sync is active.
+	if daemonRunning {
+		return nil
+	}
+	return fmt.Errorf("time sync not running")
+}
+
+// Dependencies implements process.Process
+func (*timesyncProcess) Dependencies() (deps []process.Dependency, root bool) {
+	return nil, false
+}
+
+// Name implements process.Process
+func (*timesyncProcess) Name() string {
+	return Name
+}
+
+// Start implements process.Process
+func (t *timesyncProcess) Start(ctx context.Context) error {
+	args, ok := ctx.Value(CtxKeyArgs()).(Args)
+	if !ok {
+		return fmt.Errorf("args missing in context")
+	}
+
+	t.log.Info("syncing the clock of the VM")
+
+	profileID := config.CurrentProfile().ID
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(checkInterval):
+		}
+
+		// the clock of the paused VM is synced on resume
+		if limautil.Paused(profileID) {
+			continue
+		}
+
+		drift, err := clockDrift(args.GuestActions)
+		if err != nil {
+			t.log.Tracef("error retrieving the clock of the VM: %v", err)
+			continue
+		}
+		if drift.Abs() < maxDrift {
+			continue
+		}
+
+		t.log.Infof("clock of the VM drifted by %s, syncing", drift.Round(time.Millisecond))
+		if err := syncClock(args.GuestActions); err != nil {
+			t.log.Warnln(fmt.Errorf("error syncing the clock of the VM: %w", err))
+		}
+	}
+}
+
+// clockDrift returns the drift of the clock of the VM from the clock of the host, against the
+// time of the host halfway through the command.
+func clockDrift(guest environment.GuestActions) (time.Duration, error) {
+	start := time.Now()
+	out, err := guest.RunOutput("date", "+%s.%N")
+	if err != nil {
+		return 0, err
+	}
+	end := time.Now()
+
+	sec, nsec, _ := strings.Cut(strings.TrimSpace(out), ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: '%s'", out)
+	}
+	ns, _ := strconv.ParseInt(nsec, 10, 64)
+
+	host := start.Add(end.Sub(start) / 2)
+	return time.Unix(s, ns).Sub(host), nil
+}
+
+// syncClock sets the clock of the VM to the clock of the host.
+func syncClock(guest environment.GuestActions) error {
+	now := time.Now()
+	return guest.RunQuiet("sudo", "date", "-u", "-s", fmt.Sprintf("@%d.%09d", now.Unix(), now.Nanosecond()))
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/config"
@@ -22,16 +23,98 @@ const (
 
 	NetGateway = "192.168.106.1"
 	NetDHCPEnd = "192.168.106.254"
+
+	// MaxNetworks is the maximum number of additional networks.
+	MaxNetworks = 8
+
+	// VZNATGateway is the default gateway of the VZ NAT network of the shared mode with vz.
+	VZNATGateway = "192.168.64.1"
+)
+
+// VZNATNetwork returns the gateway and the subnet of the VZ NAT network.
+// The network is configurable in the macOS vmnet preferences, the default is used otherwise.
+func VZNATNetwork() (net.IP, *net.IPNet) {
+	const prefs = "/Library/Preferences/SystemConfiguration/com.apple.vmnet"
+	read := func(key string) string {
+		out, err := exec.Command("defaults", "read", prefs, key).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	gateway := net.ParseIP(read("Shared_Net_Address")).To4()
+	mask := net.IPMask(net.ParseIP(read("Shared_Net_Mask")).To4())
+	if gateway == nil || mask == nil {
+		gateway, mask = net.ParseIP(VZNATGateway).To4(), net.CIDRMask(24, 32)
+	}
+	return gateway, &net.IPNet{IP: gateway.Mask(mask), Mask: mask}
+}
+
+// Modes of the vmnet networks.
+const (
+	ModeShared  = "shared"
+	ModeHost    = "host"
+	ModeBridged = "bridged"
 )
 
 var _ process.Process = (*vmnetProcess)(nil)
 
-func New() process.Process { return &vmnetProcess{} }
+func New() process.Process { return &vmnetProcess{mode: ModeShared} }
+
+// NewNetwork creates the vmnet process for the additional network at index.
+// Indexes start at 1, 0 is the primary network.
+// iface is the host network interface for the bridged mode.
+func NewNetwork(index int, mode, iface string) process.Process {
+	return &vmnetProcess{index: index, mode: mode, iface: iface}
+}
+
+type vmnetProcess struct {
+	index int
+	mode  string
+	iface string
+}
+
+// NetworkName returns the process name for the network at index.
+func NetworkName(index int) string {
+	if index == 0 {
+		return Name
+	}
+	return fmt.Sprintf("%s-%d", Name, index)
+}
 
-type vmnetProcess struct{}
+// NetworkGateway returns the gateway address for the shared or host network at index.
+// Each network has a distinct /24 subnet, starting from 192.168.106.0/24 for the primary network.
+func NetworkGateway(index int) string { return fmt.Sprintf("192.168.%d.1", 106+index) }
 
-func (*vmnetProcess) Alive(ctx context.Context) error {
-	info := Info()
+// NetworkDHCPEnd returns the end of the DHCP range for the shared or host network at index.
+func NetworkDHCPEnd(index int) string { return fmt.Sprintf("192.168.%d.254", 106+index) }
+
+// PrimaryNetwork returns the vmnet network of the reachable IP address for the network config.
+// The mode defaults to shared.
+func PrimaryNetwork(n config.Network) config.VMNetwork {
+	if n.Mode == "" {
+		return config.VMNetwork{Mode: ModeShared}
+	}
+	return config.VMNetwork{Mode: n.Mode, Interface: n.Interface}
+}
+
+// NetworkArg returns the daemon arg for the additional network in the form mode[:interface].
+func NetworkArg(n config.VMNetwork) string {
+	if n.Interface == "" {
+		return n.Mode
+	}
+	return n.Mode + ":" + n.Interface
+}
+
+// ParseNetworkArg parses the daemon arg for an additional network.
+func ParseNetworkArg(arg string) config.VMNetwork {
+	mode, iface, _ := strings.Cut(arg, ":")
+	return config.VMNetwork{Mode: mode, Interface: iface}
+}
+
+func (p *vmnetProcess) Alive(ctx context.Context) error {
+	info := NetworkInfo(p.index)
 	pidFile := info.PidFile
 	socketFile := info.Socket.File()
 
@@ -57,11 +140,28 @@ func (*vmnetProcess) Alive(ctx context.Context) error {
 }
 
 // Name implements process.BgProcess
-func (*vmnetProcess) Name() string { return Name }
+func (p *vmnetProcess) Name() string { return NetworkName(p.index) }
+
+// args returns the socket_vmnet args for the network mode.
+func (p *vmnetProcess) args() []string {
+	if p.mode == ModeBridged {
+		return []string{
+			"--vmnet-mode", ModeBridged,
+			"--socket-group", "staff",
+			"--vmnet-interface", p.iface,
+		}
+	}
+	return []string{
+		"--vmnet-mode", p.mode,
+		"--socket-group", "staff",
+		"--vmnet-gateway", NetworkGateway(p.index),
+		"--vmnet-dhcp-end", NetworkDHCPEnd(p.index),
+	}
+}
 
 // Start implements process.BgProcess
-func (*vmnetProcess) Start(ctx context.Context) error {
-	info := Info()
+func (p *vmnetProcess) Start(ctx context.Context) error {
+	info := NetworkInfo(p.index)
 	socket := info.Socket.File()
 	pid := info.PidFile
 
@@ -73,14 +173,9 @@ func (*vmnetProcess) Start(ctx context.Context) error {
 
 	go func() {
 		// rootfully start the vmnet daemon
-		command := cli.CommandInteractive("sudo", BinaryPath,
-			"--vmnet-mode", "shared",
-			"--socket-group", "staff",
-			"--vmnet-gateway", NetGateway,
-			"--vmnet-dhcp-end", NetDHCPEnd,
-			"--pidfile", pid,
-			socket,
-		)
+		args := append([]string{BinaryPath}, p.args()...)
+		args = append(args, "--pidfile", pid, socket)
+		command := cli.CommandInteractive("sudo", args...)
 
 		if cli.Settings.Verbose {
 			command.Env = append(command.Env, os.Environ()...)
@@ -135,11 +230,23 @@ func Info() struct {
 	PidFile string
 	Socket  osutil.Socket
 } {
+	return NetworkInfo(0)
+}
+
+// NetworkInfo returns the pid and socket files of the network at index.
+func NetworkInfo(index int) struct {
+	PidFile string
+	Socket  osutil.Socket
+} {
+	name := "vmnet"
+	if index > 0 {
+		name = fmt.Sprintf("vmnet%d", index)
+	}
 	return struct {
 		PidFile string
 		Socket  osutil.Socket
 	}{
-		PidFile: filepath.Join(runDir(), "vmnet-"+config.CurrentProfile().ShortName+".pid"),
-		Socket:  osutil.Socket(filepath.Join(process.Dir(), "vmnet.sock")),
+		PidFile: filepath.Join(runDir(), name+"-"+config.CurrentProfile().ShortName+".pid"),
+		Socket:  osutil.Socket(filepath.Join(process.Dir(), name+".sock")),
 	}
 }
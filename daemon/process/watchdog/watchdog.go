@@ -0,0 +1,179 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/sirupsen/logrus"
+)
+
+const Name = "watchdog"
+
+// RestartEnvVar is set for the 'colima start' of the restarts of the watchdog, the restart
+// attempts are reset by the other starts.
+const RestartEnvVar = "COLIMA_WATCHDOG_RESTART"
+
+var (
+	// checkInterval is the interval for checking the status of the VM.
+	checkInterval = 10 * time.Second
+	// stableInterval is the uptime of the VM after which the restart attempts are reset.
+	stableInterval = 10 * time.Minute
+)
+
+// Args are the watchdog arguments.
+type Args struct {
+	// Retries is the number of restart attempts before giving up.
+	Retries int
+	// Backoff is the delay of the first restart, doubled for each attempt.
+	Backoff time.Duration
+	// Running returns if the VM is running.
+	Running func(ctx context.Context) (bool, error)
+	// Restart restarts the VM. The daemon is restarted with the VM, the restart must
+	// not be terminated with the daemon.
+	Restart func(ctx context.Context) error
+}
+
+func CtxKeyArgs() any { return struct{ name string }{name: "watchdog_args"} }
+
+// New returns the watchdog process.
+// The VM is restarted when it stops without 'colima stop', i.e. when the hypervisor process
+// exits unexpectedly. The daemon is stopped before the VM by 'colima stop'.
+func New() process.Process {
+	return &watchdogProcess{log: logrus.WithField("context", "watchdog")}
+}
+
+var _ process.Process = (*watchdogProcess)(nil)
+
+type watchdogProcess struct {
+	log *logrus.Entry
+}
+
+// Alive implements process.Process
+func (w *watchdogProcess) Alive(ctx context.Context) error {
+	daemonRunning, _ := ctx.Value(process.CtxKeyDaemon()).(bool)
+
+	// if the parent is active, we can assume the watchdog is active.
+	if daemonRunning {
+		return nil
+	}
+	return fmt.Errorf("watchdog not running")
+}
+
+// Dependencies implements process.Process
+func (*watchdogProcess) Dependencies() (deps []process.Dependency, root bool) {
+	return nil, false
+}
+
+// Name implements process.Process
+func (*watchdogProcess) Name() string {
+	return Name
+}
+
+// Start implements process.Process
+func (w *watchdogProcess) Start(ctx context.Context) error {
+	args, ok := ctx.Value(CtxKeyArgs()).(Args)
+	if !ok {
+		return fmt.Errorf("args missing in context")
+	}
+
+	w.log.Info("watching the VM")
+
+	// the daemon is started before the VM, the VM is watched once it is running
+	var runningSince time.Time
+	stopped := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(checkInterval):
+		}
+
+		running, err := args.Running(ctx)
+		if err != nil {
+			w.log.Tracef("error retrieving VM status: %v", err)
+			continue
+		}
+		if running {
+			if runningSince.IsZero() {
+				runningSince = time.Now()
+			}
+			if time.Since(runningSince) > stableInterval {
+				resetAttempts()
+			}
+			stopped = 0
+			continue
+		}
+		if runningSince.IsZero() {
+			continue
+		}
+
+		// confirm the status to not restart during a transient error
+		if stopped++; stopped < 2 {
+			continue
+		}
+
+		attempts := attempts()
+		if attempts >= args.Retries {
+			w.log.Errorf("VM stopped unexpectedly, giving up after %d restart attempts", attempts)
+			return nil
+		}
+		delay := backoff(args.Backoff, attempts)
+		w.log.Warnf("VM stopped unexpectedly, restarting in %s (attempt %d of %d)", delay, attempts+1, args.Retries)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		if err := setAttempts(attempts + 1); err != nil {
+			w.log.Warnln(err)
+		}
+		if err := args.Restart(ctx); err != nil {
+			return fmt.Errorf("error restarting VM: %w", err)
+		}
+		// the daemon is restarted with the VM
+		return nil
+	}
+}
+
+// backoff returns the delay of the restart after the previous attempts, doubled for each attempt.
+func backoff(base time.Duration, attempts int) time.Duration { return base << attempts }
+
+// attemptsFile is the file of the restart attempts, preserved across the restarts of the daemon.
+var attemptsFile = func() string { return filepath.Join(process.Dir(), "watchdog_attempts") }
+
+// attempts returns the restart attempts since the VM was last stable.
+func attempts() int {
+	b, err := os.ReadFile(attemptsFile())
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return n
+}
+
+// setAttempts saves the restart attempts.
+func setAttempts(n int) error {
+	if err := os.WriteFile(attemptsFile(), []byte(strconv.Itoa(n)), 0644); err != nil {
+		return fmt.Errorf("error saving restart attempts: %w", err)
+	}
+	return nil
+}
+
+// resetAttempts resets the restart attempts.
+func resetAttempts() { _ = os.Remove(attemptsFile()) }
+
+// ResetAttempts resets the restart attempts unless the VM is started by the watchdog,
+// for a 'colima start' of the user to be watched with all the restart attempts.
+func ResetAttempts() {
+	if os.Getenv(RestartEnvVar) == "" {
+		resetAttempts()
+	}
+}
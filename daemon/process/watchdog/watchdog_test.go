@@ -0,0 +1,130 @@
+package watchdog
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_backoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: 10 * time.Second},
+		{attempts: 1, want: 20 * time.Second},
+		{attempts: 3, want: 80 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := backoff(10*time.Second, tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// watch runs the watchdog with the statuses of the VM, the last status is repeated.
+// It returns the restarts of the VM.
+func watch(t *testing.T, retries int, statuses ...bool) int {
+	t.Helper()
+
+	var checks, restarts atomic.Int32
+	args := Args{
+		Retries: retries,
+		Backoff: time.Millisecond,
+		Running: func(ctx context.Context) (bool, error) {
+			i := int(checks.Add(1)) - 1
+			return statuses[min(i, len(statuses)-1)], nil
+		},
+		Restart: func(ctx context.Context) error {
+			restarts.Add(1)
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	ctx = context.WithValue(ctx, CtxKeyArgs(), args)
+	if err := New().Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	return int(restarts.Load())
+}
+
+func TestWatchdog(t *testing.T) {
+	interval, stable, file := checkInterval, stableInterval, attemptsFile
+	t.Cleanup(func() { checkInterval, stableInterval, attemptsFile = interval, stable, file })
+	checkInterval = time.Millisecond
+	stableInterval = time.Hour
+	dir := t.TempDir()
+	attemptsFile = func() string { return filepath.Join(dir, "watchdog_attempts") }
+
+	t.Run("not started", func(t *testing.T) {
+		resetAttempts()
+		if got := watch(t, 3, false); got != 0 {
+			t.Errorf("restarts = %d, want 0", got)
+		}
+	})
+
+	t.Run("transient stop", func(t *testing.T) {
+		resetAttempts()
+		// a single failed check is not confirmed, the context ends the watch
+		if got := watch(t, 3, true, false, true); got != 0 {
+			t.Errorf("restarts = %d, want 0", got)
+		}
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		resetAttempts()
+		if got := watch(t, 3, true, false); got != 1 {
+			t.Errorf("restarts = %d, want 1", got)
+		}
+		if got := attempts(); got != 1 {
+			t.Errorf("attempts() = %d, want 1", got)
+		}
+	})
+
+	t.Run("give up", func(t *testing.T) {
+		resetAttempts()
+		// the restarts of the VM restart the watchdog
+		for range 3 {
+			watch(t, 3, true, false)
+		}
+		if got := watch(t, 3, true, false); got != 0 {
+			t.Errorf("restarts = %d, want 0 after the retries", got)
+		}
+		if got := attempts(); got != 3 {
+			t.Errorf("attempts() = %d, want 3", got)
+		}
+	})
+
+	t.Run("stable", func(t *testing.T) {
+		resetAttempts()
+		if err := setAttempts(2); err != nil {
+			t.Fatal(err)
+		}
+		stableInterval = 0
+		defer func() { stableInterval = time.Hour }()
+		watch(t, 3, true, true, true, false)
+		if got := attempts(); got != 1 {
+			t.Errorf("attempts() = %d, want 1 after the stable VM", got)
+		}
+	})
+
+	t.Run("reset on start", func(t *testing.T) {
+		if err := setAttempts(2); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv(RestartEnvVar, "1")
+		ResetAttempts()
+		if got := attempts(); got != 2 {
+			t.Errorf("attempts() = %d, want 2 after the restart of the watchdog", got)
+		}
+		t.Setenv(RestartEnvVar, "")
+		ResetAttempts()
+		if got := attempts(); got != 0 {
+			t.Errorf("attempts() = %d, want 0 after the start of the user", got)
+		}
+	})
+}
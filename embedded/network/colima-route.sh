@@ -0,0 +1,173 @@
+#!/bin/sh
+# Privileged helper for managing the host routes to the Kubernetes Pod and Service networks.
+# It is installed with a sudoers rule by colima to avoid sudo password prompts.
+#
+# usage: colima-route add <cidr> <gateway>
+#        colima-route delete <cidr>
+#        colima-route pf-load <anchor> < rules
+#        colima-route pf-flush <anchor>
+#        colima-route pf-show <anchor>
+#        colima-route hosts-set <profile> < entries
+#        colima-route hosts-clear <profile>
+
+set -eu
+PATH=/usr/sbin:/usr/bin:/sbin:/bin
+
+usage() {
+    echo "usage: $0 add <cidr> <gateway> | delete <cidr> | pf-load <anchor> | pf-flush <anchor> | pf-show <anchor> | hosts-set <profile> | hosts-clear <profile>" >&2
+    exit 1
+}
+
+# only the pf rules generated by colima are permitted
+PF_RULE='^(nat on [a-z0-9]+ inet6? from any to [0-9a-fA-F:.]+/[0-9]{1,3} -> \([a-z0-9]+\)|pass out quick route-to \([a-z0-9]+ [0-9a-fA-F:.]+\) inet6? from any to [0-9a-fA-F:.]+/[0-9]{1,3} keep state)$'
+
+# only the /etc/hosts entries of an address and a hostname are permitted
+HOSTS_ENTRY='^[0-9a-fA-F:.]+ [A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$'
+
+# the Pod, Service, container and LoadBalancer networks recorded by colima when installing the helper
+NETWORKS=/opt/colima/etc/networks
+
+# recorded_network returns if the network is recorded and not broader than a /8 (IPv4) or /16 (IPv6).
+recorded_network() {
+    prefix="${1##*/}"
+    min=8
+    case "$1" in *:*) min=16 ;; esac
+    [ "$prefix" -ge "$min" ] && [ -f "$NETWORKS" ] && grep -qxF "$1" "$NETWORKS"
+}
+
+# vm_address returns if the address is of a VM, directly connected on a vmnet bridge
+# or the peer of a colima WireGuard tunnel.
+vm_address() {
+    printf '%s' "$1" | grep -Eq '^[0-9a-fA-F:.]+$' || return 1
+    if [ "$(uname)" = "Darwin" ]; then
+        flag=""
+        case "$1" in *:*) flag="-inet6" ;; esac
+        info="$(route -n get $flag "$1" 2>/dev/null)" || return 1
+        iface="$(printf '%s\n' "$info" | awk '$1 == "interface:" { print $2 }')"
+        via="$(printf '%s\n' "$info" | awk '$1 == "gateway:" { print $2 }')"
+    else
+        info="$(ip -o route get "$1" 2>/dev/null)" || return 1
+        iface="$(printf '%s\n' "$info" | awk '{ for (i = 1; i < NF; i++) if ($i == "dev") print $(i + 1) }')"
+        via="$(printf '%s\n' "$info" | awk '{ for (i = 1; i < NF; i++) if ($i == "via") print $(i + 1) }')"
+    fi
+    case "$iface" in
+    bridge[0-9]*) [ -z "$via" ] ;;
+    utun[0-9]* | wg-*) printf '%s' "$1" | grep -Eq '^10\.254\.[0-9]{1,3}\.[0-9]{1,3}$' ;;
+    *) return 1 ;;
+    esac
+}
+
+# write_hosts replaces the block of the profile in /etc/hosts with the entries, if any.
+# The file is rewritten in place to preserve its ownership and permissions.
+write_hosts() {
+    tmp="$(mktemp)"
+    awk -v begin="# BEGIN colima $profile" -v end="# END colima $profile" '
+        $0 == begin { skip = 1; next }
+        $0 == end { skip = 0; next }
+        !skip { print }
+    ' /etc/hosts >"$tmp"
+    if [ -n "$1" ]; then
+        printf '# BEGIN colima %s\n%s\n# END colima %s\n' "$profile" "$1" "$profile" >>"$tmp"
+    fi
+    cat "$tmp" >/etc/hosts
+    rm -f "$tmp"
+}
+
+action="${1:-}"
+
+case "$action" in
+add | delete)
+    cidr="${2:-}"
+    gateway="${3:-}"
+
+    printf '%s' "$cidr" | grep -Eq '^[0-9a-fA-F:.]+/[0-9]{1,3}$' || usage
+    if ! recorded_network "$cidr"; then
+        echo "network $cidr is not recorded in $NETWORKS" >&2
+        exit 1
+    fi
+
+    family=4
+    case "$cidr" in *:*) family=6 ;; esac
+
+    inet=""
+    [ "$family" = 6 ] && inet="-inet6"
+    ;;
+pf-load | pf-flush | pf-show)
+    [ "$(uname)" = "Darwin" ] || usage
+    anchor="${2:-}"
+    printf '%s' "$anchor" | grep -Eq '^com\.apple/colima\.[A-Za-z0-9._-]+$' || usage
+    ;;
+hosts-set | hosts-clear)
+    profile="${2:-}"
+    printf '%s' "$profile" | grep -Eq '^[A-Za-z0-9._-]+$' || usage
+    ;;
+esac
+
+case "$action" in
+add)
+    printf '%s' "$gateway" | grep -Eq '^[0-9a-fA-F:.]+$' || usage
+    if ! vm_address "$gateway"; then
+        echo "gateway $gateway is not a VM address" >&2
+        exit 1
+    fi
+    if [ "$(uname)" = "Darwin" ]; then
+        route -n change $inet "$cidr" "$gateway" >/dev/null 2>&1 || route -n add $inet "$cidr" "$gateway"
+    else
+        ip -$family route replace "$cidr" via "$gateway"
+    fi
+    ;;
+delete)
+    if [ "$(uname)" = "Darwin" ]; then
+        route -n delete $inet "$cidr"
+    else
+        ip -$family route del "$cidr"
+    fi
+    ;;
+pf-load)
+    rules="$(cat)"
+    if printf '%s\n' "$rules" | grep -Evq "$PF_RULE"; then
+        echo "invalid pf rules" >&2
+        exit 1
+    fi
+    for cidr in $(printf '%s\n' "$rules" | sed -E 's/.* to ([^ ]+).*/\1/'); do
+        if ! recorded_network "$cidr"; then
+            echo "network $cidr is not recorded in $NETWORKS" >&2
+            exit 1
+        fi
+    done
+    for gateway in $(printf '%s\n' "$rules" | sed -nE 's/.*route-to \([a-z0-9]+ ([^)]+)\).*/\1/p'); do
+        if ! vm_address "$gateway"; then
+            echo "gateway $gateway is not a VM address" >&2
+            exit 1
+        fi
+    done
+    printf '%s\n' "$rules" | pfctl -a "$anchor" -f -
+    pfctl -e >/dev/null 2>&1 || true
+    ;;
+pf-flush)
+    pfctl -a "$anchor" -F all
+    ;;
+pf-show)
+    pfctl -a "$anchor" -s rules
+    ;;
+hosts-set)
+    entries="$(cat)"
+    if [ -n "$entries" ] && printf '%s\n' "$entries" | grep -Evq "$HOSTS_ENTRY"; then
+        echo "invalid hosts entries" >&2
+        exit 1
+    fi
+    for address in $(printf '%s\n' "$entries" | awk 'NF { print $1 }'); do
+        if ! vm_address "$address"; then
+            echo "address $address is not a VM address" >&2
+            exit 1
+        fi
+    done
+    write_hosts "$entries"
+    ;;
+hosts-clear)
+    write_hosts ""
+    ;;
+*)
+    usage
+    ;;
+esac
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 )
 
 // IsNoneRuntime returns if runtime is none.
@@ -70,3 +72,53 @@ func ContainerRuntimes() (names []string) {
 	}
 	return
 }
+
+// Deprovisioner is implemented by the container runtimes that can be switched from without
+// recreating the VM.
+type Deprovisioner interface {
+	// Deprovision stops and disables the container runtime for another runtime to be provisioned.
+	// The images and containers are kept on the VM disk.
+	Deprovision(ctx context.Context) error
+}
+
+// ImageMigrator is implemented by the container runtimes with images that can be carried
+// across a runtime switch.
+type ImageMigrator interface {
+	// SaveImages saves the tagged images to the archive file in the VM, false if there are no images.
+	SaveImages(ctx context.Context, file string) (bool, error)
+	// LoadImages loads the images of the archive file in the VM.
+	LoadImages(ctx context.Context, file string) error
+}
+
+// SaveImages saves the tagged images listed with the image command in the VM to the archive
+// file, false if there are no images. The args are the additional args of the save command.
+func SaveImages(guest GuestActions, command []string, file string, args ...string) (bool, error) {
+	out, err := guest.RunOutput(slices.Concat(command, []string{"images", "--format", "{{.Repository}}:{{.Tag}}"})...)
+	if err != nil {
+		return false, fmt.Errorf("error listing images: %w", err)
+	}
+
+	var images []string
+	for _, image := range strings.Fields(out) {
+		if strings.Contains(image, "<none>") || slices.Contains(images, image) {
+			continue
+		}
+		images = append(images, image)
+	}
+	if len(images) == 0 {
+		return false, nil
+	}
+
+	if err := guest.Run(slices.Concat(command, []string{"save"}, args, []string{"--output", file}, images)...); err != nil {
+		return false, fmt.Errorf("error saving images: %w", err)
+	}
+	return true, nil
+}
+
+// LoadImages loads the images of the archive file in the VM with the image command.
+func LoadImages(guest GuestActions, command []string, file string) error {
+	if err := guest.Run(slices.Concat(command, []string{"load", "--input", file})...); err != nil {
+		return fmt.Errorf("error loading images: %w", err)
+	}
+	return nil
+}
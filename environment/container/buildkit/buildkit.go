@@ -0,0 +1,278 @@
+package buildkit
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/util"
+	"github.com/abiosoft/colima/util/downloader"
+)
+
+// Name is the name of the BuildKit builder.
+const Name = "buildkit"
+
+// Workers.
+const (
+	WorkerOCI        = "oci"
+	WorkerContainerd = "containerd"
+)
+
+const (
+	// version is the version of BuildKit installed in the VM.
+	version = "v0.23.2"
+	// binDir is the dir of the BuildKit binaries in the VM, separate from the buildkitd of the containerd runtime.
+	binDir = "/usr/local/lib/colima-buildkit/bin"
+	// rootDir is the state dir of the builder in the VM, including the build cache.
+	rootDir = "/var/lib/colima-buildkit"
+	// configFile is the buildkitd config in the VM.
+	configFile = "/etc/colima-buildkit/buildkitd.toml"
+	// service is the systemd service of the builder in the VM.
+	service = "colima-buildkit"
+	// serviceFile is the systemd unit of the builder in the VM.
+	serviceFile = "/etc/systemd/system/" + service + ".service"
+
+	// GuestSocketFile is the socket of the builder in the VM.
+	GuestSocketFile = "/run/colima-buildkit/buildkitd.sock"
+)
+
+//go:embed buildkitd.toml
+var buildkitdConf string
+
+//go:embed buildkit.service
+var serviceUnit string
+
+var configDir = func() string { return config.CurrentProfile().ConfigDir() }
+
+// HostSocketFile returns the path to the builder socket on host.
+func HostSocketFile() string { return filepath.Join(configDir(), "buildkit.sock") }
+
+// BuilderName returns the name of the docker buildx builder on the host, distinct from
+// the docker context of the profile listed as a builder by buildx.
+func BuilderName() string { return config.CurrentProfile().ID + "-" + Name }
+
+func init() {
+	environment.RegisterContainer(Name, newRuntime, true)
+}
+
+var _ environment.Container = (*buildkitRuntime)(nil)
+
+type buildkitRuntime struct {
+	host  environment.HostActions
+	guest environment.GuestActions
+	cli.CommandChain
+}
+
+// newRuntime creates a new BuildKit builder.
+func newRuntime(host environment.HostActions, guest environment.GuestActions) environment.Container {
+	return &buildkitRuntime{
+		host:         host,
+		guest:        guest,
+		CommandChain: cli.New(Name),
+	}
+}
+
+func (b buildkitRuntime) Name() string {
+	return Name
+}
+
+// Provision installs BuildKit on first use and configures the builder.
+func (b buildkitRuntime) Provision(ctx context.Context) error {
+	conf, _ := ctx.Value(config.CtxKey()).(config.Config)
+	a := b.Init(ctx)
+
+	if out, err := b.guest.RunOutput(binDir+"/buildkitd", "--version"); err != nil || !strings.Contains(out, " "+version+" ") {
+		a.Stagef("installing buildkit %s", version)
+		b.install(a)
+	}
+
+	// buildkitd config
+	a.Add(func() error {
+		gid, err := b.guest.RunOutput("id", "-g")
+		if err != nil {
+			return fmt.Errorf("error retrieving user group: %w", err)
+		}
+		worker := conf.BuildKit.Worker
+		if worker == "" {
+			worker = WorkerOCI
+		}
+		// the rootless containerd of the user is reachable by the link to its socket
+		address := "/run/containerd/containerd.sock"
+		if conf.Rootless {
+			uid, err := b.guest.RunOutput("id", "-u")
+			if err != nil {
+				return fmt.Errorf("error retrieving user id: %w", err)
+			}
+			address = strings.ReplaceAll(containerd.GuestRootlessSocketFiles.Containerd, "{{.UID}}", strings.TrimSpace(uid))
+		}
+		values := struct {
+			config.BuildKit
+			Worker            string
+			Root              string
+			Socket            string
+			GID               string
+			ContainerdAddress string
+		}{
+			BuildKit:          conf.BuildKit,
+			Worker:            worker,
+			Root:              rootDir,
+			Socket:            GuestSocketFile,
+			GID:               strings.TrimSpace(gid),
+			ContainerdAddress: address,
+		}
+		body, err := util.ParseTemplate(buildkitdConf, values)
+		if err != nil {
+			return fmt.Errorf("error parsing buildkitd config template: %w", err)
+		}
+		return b.guest.Write(configFile, body)
+	})
+
+	// systemd service
+	a.Add(func() error {
+		values := struct{ BinDir, ConfigFile string }{BinDir: binDir, ConfigFile: configFile}
+		body, err := util.ParseTemplate(serviceUnit, values)
+		if err != nil {
+			return fmt.Errorf("error parsing buildkit service template: %w", err)
+		}
+		if err := b.guest.Write(serviceFile, body); err != nil {
+			return err
+		}
+		return b.guest.RunQuiet("sudo", "systemctl", "daemon-reload")
+	})
+
+	return a.Exec()
+}
+
+// install downloads and installs BuildKit in the VM.
+func (b buildkitRuntime) install(a *cli.ActiveCommandChain) {
+	downloadPath := "/tmp/buildkit.tar.gz"
+	url := "https://github.com/moby/buildkit/releases/download/" + version +
+		"/buildkit-" + version + ".linux-" + b.guest.Arch().GoArch() + ".tar.gz"
+
+	a.Add(func() error {
+		return downloader.DownloadToGuest(b.host, b.guest, downloader.Request{URL: url}, downloadPath)
+	})
+	a.Add(func() error {
+		if err := b.guest.Run("sudo", "mkdir", "-p", binDir); err != nil {
+			return err
+		}
+		// the archive has the binaries in bin/
+		return b.guest.Run("sudo", "tar", "-xzf", downloadPath, "-C", filepath.Dir(binDir), "bin")
+	})
+	a.Add(func() error { return b.guest.RunQuiet("rm", "-f", downloadPath) })
+}
+
+// Start starts the builder and registers it as a docker buildx builder on the host.
+func (b buildkitRuntime) Start(ctx context.Context) error {
+	conf, _ := ctx.Value(config.CtxKey()).(config.Config)
+	a := b.Init(ctx)
+
+	a.Add(func() error {
+		return b.guest.Run("sudo", "systemctl", "restart", service)
+	})
+
+	// service startup takes few seconds, retry for a minute before giving up.
+	a.Retry("", time.Second, 60, func(int) error {
+		return b.guest.RunQuiet("sudo", binDir+"/buildctl", "--addr", "unix://"+GuestSocketFile, "debug", "workers")
+	})
+
+	// docker buildx builder, if buildx is available on the host
+	a.Add(func() error {
+		if err := b.setupBuilder(conf.AutoActivate()); err != nil {
+			return cli.ErrNonFatal(err)
+		}
+		return nil
+	})
+
+	return a.Exec()
+}
+
+func (b buildkitRuntime) Running(ctx context.Context) bool {
+	return b.guest.RunQuiet("systemctl", "is-active", "--quiet", service) == nil
+}
+
+func (b buildkitRuntime) Stop(ctx context.Context) error {
+	a := b.Init(ctx)
+
+	a.Add(func() error {
+		return b.guest.Run("sudo", "systemctl", "stop", service)
+	})
+
+	// clear the buildx builder
+	// since the builder can be disabled on startup,
+	// it is better to not leave unnecessary traces behind
+	a.Add(b.teardownBuilder)
+
+	return a.Exec()
+}
+
+func (b buildkitRuntime) Teardown(ctx context.Context) error {
+	a := b.Init(ctx)
+
+	// clear the buildx builder
+	a.Add(b.teardownBuilder)
+
+	return a.Exec()
+}
+
+func (b buildkitRuntime) Dependencies() []string {
+	// docker buildx is optional
+	return nil
+}
+
+func (b buildkitRuntime) Version(ctx context.Context) string {
+	version, _ := b.guest.RunOutput(binDir+"/buildkitd", "--version")
+	return version
+}
+
+func (b *buildkitRuntime) Update(ctx context.Context) (bool, error) {
+	return false, fmt.Errorf("update not supported for %s", Name)
+}
+
+// buildxAvailable returns if docker buildx is installed on the host.
+func (b buildkitRuntime) buildxAvailable() bool {
+	return b.host.RunQuiet("docker", "buildx", "version") == nil
+}
+
+// builderCreated returns if the buildx builder exists on the host.
+func (b buildkitRuntime) builderCreated() bool {
+	return b.host.RunQuiet("docker", "buildx", "inspect", BuilderName()) == nil
+}
+
+// setupBuilder creates the buildx builder with the remote driver for the builder socket,
+// set as the current builder if activate.
+func (b buildkitRuntime) setupBuilder(activate bool) error {
+	if !b.buildxAvailable() {
+		return nil
+	}
+
+	if !b.builderCreated() {
+		if err := b.host.RunQuiet("docker", "buildx", "create",
+			"--name", BuilderName(),
+			"--driver", "remote",
+			"unix://"+HostSocketFile(),
+		); err != nil {
+			return fmt.Errorf("error creating buildx builder: %w", err)
+		}
+	}
+
+	if !activate {
+		return nil
+	}
+	return b.host.RunQuiet("docker", "buildx", "use", BuilderName())
+}
+
+// teardownBuilder removes the buildx builder on the host.
+func (b buildkitRuntime) teardownBuilder() error {
+	if !b.buildxAvailable() || !b.builderCreated() {
+		return nil
+	}
+	return b.host.RunQuiet("docker", "buildx", "rm", BuilderName())
+}
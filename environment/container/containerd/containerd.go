@@ -10,6 +10,9 @@ import (
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util"
+	"github.com/abiosoft/colima/util/proxy"
 )
 
 // Name is container runtime name
@@ -33,13 +36,14 @@ func HostSocketFiles() (files struct {
 // There may be need to make this flexible for non-Lima VMs.
 
 //go:embed config.toml
-var containerdConf []byte
+var containerdConf string
 
 //go:embed buildkitd.toml
-var buildKitConf []byte
+var buildKitConf string
 
 const containerdConfFile = "/etc/containerd/config.toml"
 const buildKitConfFile = "/etc/buildkit/buildkitd.toml"
+const nerdctlConfFile = "/etc/nerdctl/nerdctl.toml"
 
 func newRuntime(host environment.HostActions, guest environment.GuestActions) environment.Container {
 	return &containerdRuntime{
@@ -67,22 +71,134 @@ func (c containerdRuntime) Name() string {
 
 func (c containerdRuntime) Provision(ctx context.Context) error {
 	a := c.Init(ctx)
+	log := c.Logger(ctx)
+	conf, _ := ctx.Value(config.CtxKey()).(config.Config)
+	proxies := proxy.Resolve(conf).Guest(proxy.GuestHost).WithNoProxy(proxy.NoProxyDefaults(conf, limautil.IPAddress(config.CurrentProfile().ID))...)
 
-	// containerd config
+	// registry mirrors, TLS settings and credentials, not fatal
+	registries := func() error {
+		if err := c.setRegistries(conf.Registries, conf.Rootless); err != nil {
+			log.Warnln(err)
+		}
+		return nil
+	}
+
+	// the disk image of the other runtimes has no nerdctl, for a runtime switch
+	if c.guest.RunQuiet("sh", "-c", "command -v nerdctl") != nil {
+		a.Stagef("installing nerdctl %s", nerdctlVersion)
+		c.install(a)
+	}
+
+	// rootless containerd of the user
+	if conf.Rootless {
+		InstallWasmShims(c.host, c.guest, a, WasmShims(conf.WasmShims()))
+		c.provisionRootless(a, proxies)
+		a.Add(registries)
+		return a.Exec()
+	}
+
+	// disabled if previously switched to another runtime
+	a.Add(func() error {
+		return c.guest.RunQuiet("sudo", "systemctl", "enable", "containerd", "buildkit")
+	})
+
+	// lazy-pulling snapshotter, if enabled
+	c.provisionSnapshotter(a, conf.Snapshotter)
+
+	// WebAssembly shims, if enabled
+	wasmShims := WasmShims(conf.WasmShims())
+	InstallWasmShims(c.host, c.guest, a, wasmShims)
+
+	// sysbox runtime, if enabled
+	if conf.Sysbox {
+		InstallSysbox(c.host, c.guest, a)
+	}
+
+	// containerd, buildkitd and nerdctl config
 	a.Add(func() error {
-		return c.guest.Write(containerdConfFile, containerdConf)
+		values := struct {
+			Snapshotter, Socket string
+			WasmShims           []WasmShim
+			KubernetesCertsDir  string
+		}{
+			Snapshotter:        conf.Snapshotter,
+			Socket:             SnapshotterSocket(conf.Snapshotter),
+			WasmShims:          wasmShims,
+			KubernetesCertsDir: KubernetesCertsDir,
+		}
+		for _, f := range []struct{ file, body string }{
+			{file: containerdConfFile, body: containerdConf},
+			{file: buildKitConfFile, body: buildKitConf},
+			{file: nerdctlConfFile, body: nerdctlConf},
+		} {
+			body, err := util.ParseTemplate(f.body, values)
+			if err != nil {
+				return fmt.Errorf("error parsing %s: %w", f.file, err)
+			}
+			if err := c.guest.Write(f.file, body); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 
-	// buildkitd config
+	// proxy settings of the host, applied on restart
 	a.Add(func() error {
-		return c.guest.Write(buildKitConfFile, buildKitConf)
+		return c.setProxy(proxies)
 	})
 
+	a.Add(registries)
+
 	return a.Exec()
 }
 
+// nerdctlConf is the nerdctl config, for the default snapshotter of nerdctl.
+const nerdctlConf = `{{if .Socket}}snapshotter = "{{.Snapshotter}}"
+{{end}}`
+
+// proxyDropIns are the systemd drop-ins for the proxy settings of the services.
+var proxyDropIns = append([]string{
+	"/etc/systemd/system/containerd.service.d/colima-proxy.conf",
+	"/etc/systemd/system/buildkit.service.d/colima-proxy.conf",
+}, snapshotterDropIns()...)
+
+// setProxy sets the proxy settings of containerd and buildkitd, removing them if empty.
+func (c containerdRuntime) setProxy(proxies proxy.Settings) error {
+	for _, file := range proxyDropIns {
+		if proxies.Empty() {
+			if err := c.guest.RunQuiet("sudo", "rm", "-f", file); err != nil {
+				return fmt.Errorf("error removing proxy settings: %w", err)
+			}
+			continue
+		}
+		if err := c.guest.RunQuiet("sudo", "mkdir", "-p", filepath.Dir(file)); err != nil {
+			return fmt.Errorf("error creating systemd drop-in dir: %w", err)
+		}
+		if err := c.guest.Write(file, []byte(proxies.SystemdDropIn())); err != nil {
+			return fmt.Errorf("error writing proxy settings: %w", err)
+		}
+	}
+	return c.guest.RunQuiet("sudo", "systemctl", "daemon-reload")
+}
+
 func (c containerdRuntime) Start(ctx context.Context) error {
 	a := c.Init(ctx)
+	conf, _ := ctx.Value(config.CtxKey()).(config.Config)
+
+	if conf.Rootless {
+		c.startRootless(a)
+		return a.Exec()
+	}
+
+	// the rootless containerd, if previously enabled, is not used
+	if c.rootlessRunning() {
+		a.Add(c.stopRootless)
+	}
+
+	// the snapshotter must be running for the images to be pulled
+	a.Add(func() error {
+		return c.startSnapshotter(conf.Snapshotter)
+	})
 
 	a.Add(func() error {
 		return c.guest.Run("sudo", "service", "containerd", "restart")
@@ -100,12 +216,54 @@ func (c containerdRuntime) Start(ctx context.Context) error {
 	return a.Exec()
 }
 
+// startRootless starts the rootless containerd and buildkitd of the user, the rootful
+// containerd is not used and stopped.
+func (c containerdRuntime) startRootless(a *cli.ActiveCommandChain) {
+	a.Add(func() error {
+		return c.guest.RunQuiet("sudo", "systemctl", "stop", "buildkit", "containerd")
+	})
+
+	a.Add(func() error {
+		return c.guest.Run("systemctl", "--user", "restart", "containerd")
+	})
+
+	// service startup takes few seconds, retry at most 10 times before giving up.
+	a.Retry("", time.Second*5, 10, func(int) error {
+		return c.guest.RunQuiet("nerdctl", "info")
+	})
+
+	a.Add(func() error {
+		return c.guest.Run("systemctl", "--user", "start", "buildkit")
+	})
+
+	// the sockets are linked for forwarding to the host
+	a.Add(func() error {
+		if err := c.guest.RunQuiet("sh", "-c", rootlessLinkScript); err != nil {
+			return fmt.Errorf("error linking rootless containerd sockets: %w", err)
+		}
+		return nil
+	})
+}
+
+// rootlessRunning returns if the rootless containerd of the user is running.
+func (c containerdRuntime) rootlessRunning() bool {
+	return c.guest.RunQuiet("systemctl", "--user", "--quiet", "is-active", "containerd") == nil
+}
+
+// stopRootless stops the rootless containerd and buildkitd of the user.
+func (c containerdRuntime) stopRootless() error {
+	return c.guest.Run("systemctl", "--user", "stop", "buildkit", "containerd")
+}
+
 func (c containerdRuntime) Running(ctx context.Context) bool {
-	return c.guest.RunQuiet("service", "containerd", "status") == nil
+	return c.guest.RunQuiet("service", "containerd", "status") == nil || c.rootlessRunning()
 }
 
 func (c containerdRuntime) Stop(ctx context.Context) error {
 	a := c.Init(ctx)
+	if c.rootlessRunning() {
+		a.Add(c.stopRootless)
+	}
 	a.Add(func() error {
 		return c.guest.Run("sudo", "service", "containerd", "stop")
 	})
@@ -117,13 +275,46 @@ func (c containerdRuntime) Teardown(context.Context) error {
 	return nil
 }
 
+var _ environment.Deprovisioner = (*containerdRuntime)(nil)
+
+// Deprovision disables the rootful and rootless containerd and buildkitd, for switching to
+// another runtime.
+func (c containerdRuntime) Deprovision(ctx context.Context) error {
+	a := c.Init(ctx)
+
+	if c.rootlessRunning() {
+		a.Add(func() error {
+			return c.guest.RunQuiet("systemctl", "--user", "disable", "--now", "buildkit", "containerd")
+		})
+	}
+	a.Add(func() error {
+		return c.guest.RunQuiet("sudo", "systemctl", "disable", "--now", "buildkit", "containerd")
+	})
+
+	return a.Exec()
+}
+
+var _ environment.ImageMigrator = (*containerdRuntime)(nil)
+
+// SaveImages saves the images of the default namespace, of the rootless containerd if running.
+func (c containerdRuntime) SaveImages(ctx context.Context, file string) (bool, error) {
+	return environment.SaveImages(c.guest, Nerdctl(c.rootlessRunning()), file)
+}
+
+// LoadImages loads the images into the default namespace, of the rootless containerd if enabled.
+func (c containerdRuntime) LoadImages(ctx context.Context, file string) error {
+	conf, _ := ctx.Value(config.CtxKey()).(config.Config)
+	return environment.LoadImages(c.guest, Nerdctl(conf.Rootless), file)
+}
+
 func (c containerdRuntime) Dependencies() []string {
 	// no dependencies
 	return nil
 }
 
 func (c containerdRuntime) Version(ctx context.Context) string {
-	version, _ := c.guest.RunOutput("sudo", "nerdctl", "version", "--format", `client: {{.Client.Version}}{{printf "\n"}}server: {{(index .Server.Components 0).Version}}`)
+	args := append(Nerdctl(c.rootlessRunning()), "version", "--format", `client: {{.Client.Version}}{{printf "\n"}}server: {{(index .Server.Components 0).Version}}`)
+	version, _ := c.guest.RunOutput(args...)
 	return version
 }
 
@@ -0,0 +1,35 @@
+package containerd
+
+import (
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/util/downloader"
+)
+
+// nerdctlVersion is the version of the nerdctl full bundle installed when switching to
+// containerd from another runtime.
+const nerdctlVersion = "v2.1.3"
+
+// install downloads and installs the nerdctl full bundle with containerd, buildkitd and the
+// CNI plugins in the VM.
+func (c containerdRuntime) install(a *cli.ActiveCommandChain) {
+	downloadPath := "/tmp/nerdctl-full.tar.gz"
+	url := "https://github.com/containerd/nerdctl/releases/download/" + nerdctlVersion +
+		"/nerdctl-full-" + strings.TrimPrefix(nerdctlVersion, "v") + "-linux-" + c.guest.Arch().GoArch() + ".tar.gz"
+
+	a.Add(func() error {
+		r := downloader.Request{
+			URL: url,
+			SHA: &downloader.SHA{Size: 256, URL: "https://github.com/containerd/nerdctl/releases/download/" + nerdctlVersion + "/SHA256SUMS"},
+		}
+		return downloader.DownloadToGuest(c.host, c.guest, r, downloadPath)
+	})
+	a.Add(func() error {
+		return c.guest.Run("sudo", "tar", "-xzf", downloadPath, "-C", "/usr/local")
+	})
+	a.Add(func() error { return c.guest.RunQuiet("rm", "-f", downloadPath) })
+	a.Add(func() error {
+		return c.guest.RunQuiet("sudo", "systemctl", "daemon-reload")
+	})
+}
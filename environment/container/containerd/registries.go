@@ -0,0 +1,187 @@
+package containerd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+)
+
+const (
+	// CertsDir is the registry hosts dir of containerd and nerdctl.
+	CertsDir = "/etc/containerd/certs.d"
+	// KubernetesCertsDir is the registry hosts dir of the CRI plugin of containerd for the image
+	// pulls of Kubernetes, separate for the registries of Kubernetes not to replace the registries
+	// of the runtime.
+	KubernetesCertsDir = "/etc/containerd/kubernetes/certs.d"
+	// RegistryManaged marks the registry configs written by colima.
+	RegistryManaged = "# managed by colima"
+
+	// registriesKey is the hosts of the registry configs written for the registries of the runtime.
+	registriesKey = "containerd_registries"
+	// credentialsKey is set if the registry credentials of nerdctl are written by colima.
+	credentialsKey = "containerd_credentials"
+)
+
+// RegistryEndpoint returns the endpoint URL of the mirror, https if the scheme is not set.
+func RegistryEndpoint(endpoint string) string {
+	if strings.Contains(endpoint, "://") {
+		return strings.TrimSuffix(endpoint, "/")
+	}
+	return "https://" + strings.TrimSuffix(endpoint, "/")
+}
+
+// RegistryServer returns the URL of the registry, Docker Hub is served at registry-1.docker.io.
+// An insecure registry is served over plain HTTP.
+func RegistryServer(r config.RegistryHost) string {
+	switch {
+	case r.Host == "docker.io":
+		return "https://registry-1.docker.io"
+	case r.Insecure:
+		return "http://" + r.Host
+	}
+	return "https://" + r.Host
+}
+
+// hostsConfigured returns if the registry has settings for the containerd hosts config.
+func hostsConfigured(r config.RegistryHost) bool {
+	return len(r.Mirrors) > 0 || r.Insecure || r.InsecureSkipVerify
+}
+
+// HostsConfig returns the containerd hosts config of the registry, with the mirrors
+// tried in order before the registry.
+func HostsConfig(r config.RegistryHost) []byte {
+	var b strings.Builder
+	b.WriteString(RegistryManaged + "\n")
+	fmt.Fprintf(&b, "server = %q\n", RegistryServer(r))
+
+	endpoints := r.Mirrors
+	if len(endpoints) == 0 {
+		endpoints = []string{RegistryServer(r)}
+	}
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(&b, "\n[host.%q]\n", RegistryEndpoint(endpoint))
+		b.WriteString(`  capabilities = ["pull", "resolve"]` + "\n")
+		if r.InsecureSkipVerify {
+			b.WriteString("  skip_verify = true\n")
+		}
+	}
+	return []byte(b.String())
+}
+
+// WriteHostsConfigs writes the containerd hosts configs of the registries to the hosts dir, and
+// removes the configs of the registries previously written for the key and no longer configured.
+func WriteHostsConfigs(guest environment.GuestActions, certsDir, key string, registries []config.RegistryHost) error {
+	if previous := guest.Get(key); previous != "" {
+		for _, host := range strings.Split(previous, ",") {
+			if err := guest.RunQuiet("sudo", "rm", "-rf", filepath.Join(certsDir, host)); err != nil {
+				return fmt.Errorf("error removing containerd registry config: %w", err)
+			}
+		}
+	}
+
+	var hosts []string
+	for _, r := range registries {
+		if !hostsConfigured(r) {
+			continue
+		}
+		dir := filepath.Join(certsDir, r.Host)
+		if err := guest.Run("sudo", "mkdir", "-p", dir); err != nil {
+			return fmt.Errorf("error creating containerd registry dir: %w", err)
+		}
+		if err := guest.Write(filepath.Join(dir, "hosts.toml"), HostsConfig(r)); err != nil {
+			return err
+		}
+		hosts = append(hosts, r.Host)
+	}
+	return guest.Set(key, strings.Join(hosts, ","))
+}
+
+// WriteCredentials writes the file with registry credentials, readable by the owner only.
+// The file is created with the permissions before the credentials are written.
+func WriteCredentials(guest environment.GuestActions, file string, body []byte) error {
+	if err := guest.Run("sudo", "mkdir", "-p", filepath.Dir(file)); err != nil {
+		return fmt.Errorf("error creating dir of %s: %w", file, err)
+	}
+	if err := guest.Run("sudo", "install", "-m", "600", "/dev/null", file); err != nil {
+		return fmt.Errorf("error creating %s: %w", file, err)
+	}
+	return guest.Write(file, body)
+}
+
+// DockerConfig returns the docker config with the credentials of the registries, nil if none.
+// The docker config is used for the credentials by nerdctl and the kubelet.
+func DockerConfig(registries []config.RegistryHost) ([]byte, error) {
+	auths := map[string]any{}
+	for _, r := range registries {
+		if r.Username == "" && r.Password == "" {
+			continue
+		}
+		auth := base64.StdEncoding.EncodeToString([]byte(r.Username + ":" + r.Password))
+		host := r.Host
+		if host == "docker.io" {
+			host = "https://index.docker.io/v1/"
+		}
+		auths[host] = map[string]any{"auth": auth}
+	}
+	if len(auths) == 0 {
+		return nil, nil
+	}
+
+	b, err := json.MarshalIndent(map[string]any{"auths": auths}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding registry credentials: %w", err)
+	}
+	return b, nil
+}
+
+// setRegistries writes the containerd hosts configs of the registries, and the credentials
+// of nerdctl of root or, if rootless, of the user. Existing credentials not written by colima
+// are retained.
+func (c containerdRuntime) setRegistries(registries []config.RegistryHost, rootless bool) error {
+	if err := WriteHostsConfigs(c.guest, CertsDir, registriesKey, registries); err != nil {
+		return err
+	}
+
+	file := "/root/.docker/config.json"
+	if rootless {
+		home, err := c.guest.RunOutput("sh", "-c", "echo $HOME")
+		if err != nil {
+			return fmt.Errorf("error retrieving home dir: %w", err)
+		}
+		file = filepath.Join(home, ".docker", "config.json")
+	}
+
+	managed := c.guest.Get(credentialsKey) != ""
+	exists := c.guest.RunQuiet("sudo", "test", "-e", file) == nil
+
+	credentials, err := DockerConfig(registries)
+	if err != nil {
+		return err
+	}
+	switch {
+	case credentials == nil:
+		if exists && managed {
+			if err := c.guest.RunQuiet("sudo", "rm", "-f", file); err != nil {
+				return fmt.Errorf("error removing registry credentials: %w", err)
+			}
+		}
+		return c.guest.Set(credentialsKey, "")
+	case exists && !managed:
+		return fmt.Errorf("%s exists, configure the registry credentials with 'nerdctl login'", file)
+	}
+
+	if err := WriteCredentials(c.guest, file, credentials); err != nil {
+		return err
+	}
+	if rootless {
+		if err := c.guest.Run("sh", "-c", `sudo chown -R "$(id -u):$(id -g)" "$(dirname `+file+`)"`); err != nil {
+			return err
+		}
+	}
+	return c.guest.Set(credentialsKey, file)
+}
@@ -0,0 +1,92 @@
+package containerd
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/util/proxy"
+)
+
+// GuestRootlessSocketFiles are the links in the VM to the sockets of the rootless containerd and
+// buildkitd, templated by Lima. The sockets are in the mount namespace of rootlesskit and not
+// reachable for forwarding to the host otherwise.
+var GuestRootlessSocketFiles = struct {
+	Containerd string
+	Buildkitd  string
+}{
+	Containerd: "/run/user/{{.UID}}/colima/containerd.sock",
+	Buildkitd:  "/run/user/{{.UID}}/colima/buildkitd.sock",
+}
+
+// rootlessLinkScript links the sockets of the rootless containerd and buildkitd in the mount
+// namespace of rootlesskit, the namespace changes on each start of containerd.
+const rootlessLinkScript = `set -e
+dir="/run/user/$(id -u)"
+pid="$(cat "$dir/containerd-rootless/child_pid")"
+mkdir -p "$dir/colima"
+ln -sfn "/proc/$pid/root$dir/containerd/containerd.sock" "$dir/colima/containerd.sock"
+ln -sfn "/proc/$pid/root$dir/buildkit/buildkitd.sock" "$dir/colima/buildkitd.sock"
+`
+
+// rootlessProxyDropIns are the systemd user drop-ins for the proxy settings of the rootless services.
+var rootlessProxyDropIns = []string{
+	"$HOME/.config/systemd/user/containerd.service.d/colima-proxy.conf",
+	"$HOME/.config/systemd/user/buildkit.service.d/colima-proxy.conf",
+}
+
+// Nerdctl returns the nerdctl command in the VM, for the rootless containerd of the user if rootless.
+func Nerdctl(rootless bool) []string {
+	if rootless {
+		return []string{"nerdctl"}
+	}
+	return []string{"sudo", "nerdctl"}
+}
+
+// provisionRootless sets up the rootless containerd and buildkitd of the user with rootlesskit,
+// kept running with lingering.
+func (c containerdRuntime) provisionRootless(a *cli.ActiveCommandChain, proxies proxy.Settings) {
+	a.Add(func() error {
+		return c.guest.RunQuiet("sh", "-c", `sudo loginctl enable-linger "$USER"`)
+	})
+	a.Add(func() error {
+		if c.guest.RunQuiet("sh", "-c", "command -v newuidmap") == nil {
+			return nil
+		}
+		return c.guest.RunQuiet("sh", "-c", "sudo apt-get update -y && sudo apt-get install -y uidmap")
+	})
+	a.Add(func() error {
+		if c.guest.RunQuiet("systemctl", "--user", "--quiet", "is-enabled", "containerd") == nil {
+			return nil
+		}
+		if err := c.guest.RunQuiet("containerd-rootless-setuptool.sh", "install"); err != nil {
+			return fmt.Errorf("error setting up rootless containerd: %w", err)
+		}
+		if err := c.guest.RunQuiet("containerd-rootless-setuptool.sh", "install-buildkit"); err != nil {
+			return fmt.Errorf("error setting up rootless buildkitd: %w", err)
+		}
+		return nil
+	})
+
+	// proxy settings of the host, applied on restart
+	a.Add(func() error {
+		return c.setRootlessProxy(proxies)
+	})
+}
+
+// setRootlessProxy sets the proxy settings of the rootless containerd and buildkitd, removing them if empty.
+func (c containerdRuntime) setRootlessProxy(proxies proxy.Settings) error {
+	for _, file := range rootlessProxyDropIns {
+		if proxies.Empty() {
+			if err := c.guest.RunQuiet("sh", "-c", `rm -f "`+file+`"`); err != nil {
+				return fmt.Errorf("error removing proxy settings: %w", err)
+			}
+			continue
+		}
+		script := `mkdir -p "$(dirname "` + file + `")" && cat > "` + file + `"`
+		if err := c.guest.RunWith(bytes.NewReader([]byte(proxies.SystemdDropIn())), nil, "sh", "-c", script); err != nil {
+			return fmt.Errorf("error writing proxy settings: %w", err)
+		}
+	}
+	return c.guest.RunQuiet("systemctl", "--user", "daemon-reload")
+}
@@ -0,0 +1,204 @@
+package containerd
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/util/downloader"
+)
+
+// Lazy-pulling snapshotters.
+const (
+	SnapshotterStargz = "stargz"
+	SnapshotterNydus  = "nydus"
+)
+
+// snapshotterArchive is a release archive of the binaries of a snapshotter.
+type snapshotterArchive struct {
+	url   string
+	files []string // binaries in the archive
+}
+
+// snapshotter is a lazy-pulling snapshotter running as a containerd proxy plugin.
+type snapshotter struct {
+	service  string // systemd service
+	socket   string // grpc socket of the proxy plugin
+	binary   string // binary checked for installation
+	unit     string // systemd unit
+	config   string // config file, if any
+	body     string // config of the config file
+	archives func(arch string) []snapshotterArchive
+}
+
+const (
+	stargzVersion           = "v0.16.3"
+	nydusSnapshotterVersion = "v0.15.2"
+	nydusVersion            = "v2.3.1"
+)
+
+var snapshotters = map[string]snapshotter{
+	SnapshotterStargz: {
+		service: "stargz-snapshotter",
+		socket:  "/run/containerd-stargz-grpc/containerd-stargz-grpc.sock",
+		binary:  "containerd-stargz-grpc",
+		unit: `[Unit]
+Description=stargz snapshotter
+After=network.target local-fs.target
+Before=containerd.service
+
+[Service]
+Type=notify
+Environment=HOME=/root
+ExecStart=/usr/local/bin/containerd-stargz-grpc --log-level=info --address=/run/containerd-stargz-grpc/containerd-stargz-grpc.sock
+Restart=always
+RestartSec=1
+
+[Install]
+WantedBy=multi-user.target
+`,
+		archives: func(arch string) []snapshotterArchive {
+			return []snapshotterArchive{{
+				url: "https://github.com/containerd/stargz-snapshotter/releases/download/" + stargzVersion +
+					"/stargz-snapshotter-" + stargzVersion + "-linux-" + arch + ".tar.gz",
+				files: []string{"containerd-stargz-grpc", "ctr-remote"},
+			}}
+		},
+	},
+	SnapshotterNydus: {
+		service: "nydus-snapshotter",
+		socket:  "/run/containerd-nydus/containerd-nydus-grpc.sock",
+		binary:  "containerd-nydus-grpc",
+		unit: `[Unit]
+Description=nydus snapshotter
+After=network.target local-fs.target
+Before=containerd.service
+
+[Service]
+Environment=HOME=/root
+ExecStart=/usr/local/bin/containerd-nydus-grpc --nydusd /usr/local/bin/nydusd --nydusd-config /etc/nydus/nydusd-config.fusedev.json --log-to-stdout
+Restart=always
+RestartSec=1
+
+[Install]
+WantedBy=multi-user.target
+`,
+		config: "/etc/nydus/nydusd-config.fusedev.json",
+		body: `{
+  "device": {
+    "backend": {
+      "type": "registry",
+      "config": {"timeout": 5, "connect_timeout": 5, "retry_limit": 2}
+    },
+    "cache": {"type": "blobcache"}
+  },
+  "mode": "direct",
+  "digest_validate": false,
+  "iostats_files": false,
+  "enable_xattr": true,
+  "fs_prefetch": {"enable": true, "threads_count": 4}
+}
+`,
+		archives: func(arch string) []snapshotterArchive {
+			return []snapshotterArchive{
+				{
+					url: "https://github.com/containerd/nydus-snapshotter/releases/download/" + nydusSnapshotterVersion +
+						"/nydus-snapshotter-" + nydusSnapshotterVersion + "-linux-" + arch + ".tar.gz",
+					files: []string{"bin/containerd-nydus-grpc"},
+				},
+				{
+					url: "https://github.com/dragonflyoss/nydus/releases/download/" + nydusVersion +
+						"/nydus-static-" + nydusVersion + "-linux-" + arch + ".tgz",
+					files: []string{"nydus-static/nydusd", "nydus-static/nydus-image"},
+				},
+			}
+		},
+	},
+}
+
+// SnapshotterSocket returns the socket of the proxy plugin of the snapshotter, empty if
+// not a lazy-pulling snapshotter.
+func SnapshotterSocket(name string) string {
+	return snapshotters[name].socket
+}
+
+// snapshotterUnitFile returns the systemd unit file of the snapshotter service.
+func snapshotterUnitFile(s snapshotter) string {
+	return "/etc/systemd/system/" + s.service + ".service"
+}
+
+// provisionSnapshotter installs the snapshotter on first use, and writes the service and config.
+func (c containerdRuntime) provisionSnapshotter(a *cli.ActiveCommandChain, name string) {
+	s, ok := snapshotters[name]
+	if !ok {
+		return
+	}
+
+	if c.guest.RunQuiet("test", "-x", "/usr/local/bin/"+s.binary) != nil {
+		a.Stagef("installing %s snapshotter", name)
+		for i, archive := range s.archives(c.guest.Arch().GoArch()) {
+			downloadPath := fmt.Sprintf("/tmp/colima-snapshotter-%d.tar.gz", i)
+			extractDir := fmt.Sprintf("/tmp/colima-snapshotter-%d", i)
+			a.Add(func() error {
+				return downloader.DownloadToGuest(c.host, c.guest, downloader.Request{URL: archive.url}, downloadPath)
+			})
+			a.Add(func() error {
+				if err := c.guest.Run("mkdir", "-p", extractDir); err != nil {
+					return err
+				}
+				if err := c.guest.Run("tar", "-xzf", downloadPath, "-C", extractDir); err != nil {
+					return err
+				}
+				for _, file := range archive.files {
+					if err := c.guest.Run("sudo", "install", "-m", "755", path.Join(extractDir, file), "/usr/local/bin/"); err != nil {
+						return fmt.Errorf("error installing %s: %w", path.Base(file), err)
+					}
+				}
+				return nil
+			})
+			a.Add(func() error { return c.guest.RunQuiet("rm", "-rf", downloadPath, extractDir) })
+		}
+	}
+
+	a.Add(func() error {
+		if s.config != "" {
+			if err := c.guest.Write(s.config, []byte(s.body)); err != nil {
+				return fmt.Errorf("error writing %s snapshotter config: %w", name, err)
+			}
+		}
+		if err := c.guest.Write(snapshotterUnitFile(s), []byte(s.unit)); err != nil {
+			return fmt.Errorf("error writing %s snapshotter service: %w", name, err)
+		}
+		return c.guest.RunQuiet("sudo", "systemctl", "daemon-reload")
+	})
+}
+
+// startSnapshotter starts the service of the snapshotter, and stops the services of the other
+// snapshotters if previously enabled.
+func (c containerdRuntime) startSnapshotter(name string) error {
+	for n, s := range snapshotters {
+		if n == name || c.guest.RunQuiet("test", "-e", snapshotterUnitFile(s)) != nil {
+			continue
+		}
+		_ = c.guest.RunQuiet("sudo", "systemctl", "stop", s.service)
+	}
+
+	s, ok := snapshotters[name]
+	if !ok {
+		return nil
+	}
+	if err := c.guest.Run("sudo", "systemctl", "restart", s.service); err != nil {
+		return fmt.Errorf("error starting %s snapshotter: %w", name, err)
+	}
+	return nil
+}
+
+// snapshotterDropIns returns the systemd drop-ins for the proxy settings of the snapshotter
+// services, the layers are pulled by the snapshotter.
+func snapshotterDropIns() []string {
+	var dropIns []string
+	for _, s := range snapshotters {
+		dropIns = append(dropIns, "/etc/systemd/system/"+s.service+".service.d/colima-proxy.conf")
+	}
+	return dropIns
+}
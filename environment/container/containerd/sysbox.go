@@ -0,0 +1,48 @@
+package containerd
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util/downloader"
+)
+
+const (
+	// SysboxRuntime is the name of the sysbox runtime of docker and of nerdctl.
+	SysboxRuntime = "sysbox-runc"
+	// SysboxBinary is the runtime binary of sysbox.
+	SysboxBinary = "/usr/bin/sysbox-runc"
+
+	sysboxVersion = "0.6.7"
+)
+
+// sysboxURL returns the release package of sysbox for the architecture.
+func sysboxURL(arch environment.Arch) string {
+	return "https://downloads.nestybox.com/sysbox/releases/v" + sysboxVersion +
+		"/sysbox-ce_" + sysboxVersion + "-0.linux_" + arch.GoArch() + ".deb"
+}
+
+// InstallSysbox installs sysbox in the VM if missing and starts its services. The containers
+// of the sysbox runtime run system software e.g. docker or Kubernetes without privileges.
+func InstallSysbox(host environment.HostActions, guest environment.GuestActions, a *cli.ActiveCommandChain) {
+	if guest.RunQuiet("test", "-x", SysboxBinary) != nil {
+		a.Stagef("installing sysbox %s", sysboxVersion)
+		downloadPath := path.Join("/tmp", "sysbox-ce.deb")
+		a.Add(func() error {
+			return downloader.DownloadToGuest(host, guest, downloader.Request{URL: sysboxURL(guest.Arch())}, downloadPath)
+		})
+		a.Add(func() error {
+			if err := guest.Run("sudo", "sh", "-c", "apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y "+downloadPath); err != nil {
+				return fmt.Errorf("error installing sysbox: %w", err)
+			}
+			return nil
+		})
+		a.Add(func() error { return guest.RunQuiet("rm", "-f", downloadPath) })
+	}
+
+	a.Add(func() error {
+		return guest.RunQuiet("sudo", "systemctl", "enable", "--now", "sysbox")
+	})
+}
@@ -0,0 +1,93 @@
+package containerd
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util/downloader"
+)
+
+// WasmShim is a containerd shim of a WebAssembly runtime.
+type WasmShim struct {
+	Name        string // name of the CRI runtime and of the Kubernetes RuntimeClass
+	RuntimeType string // runtime of the shim, as passed to --runtime
+	binary      string
+	url         func(arch environment.Arch) string
+}
+
+const (
+	spinShimVersion    = "v0.19.0"
+	runwasiShimVersion = "v0.6.0"
+)
+
+// runwasiShimURL returns the release archive of the runwasi shim of the runtime.
+func runwasiShimURL(runtime string) func(arch environment.Arch) string {
+	return func(arch environment.Arch) string {
+		tag := url.PathEscape("containerd-shim-" + runtime + "/" + runwasiShimVersion)
+		return "https://github.com/containerd/runwasi/releases/download/" + tag +
+			"/containerd-shim-" + runtime + "-" + string(arch) + "-linux-musl.tar.gz"
+	}
+}
+
+var wasmShims = []WasmShim{
+	{
+		Name:        "spin",
+		RuntimeType: "io.containerd.spin.v2",
+		binary:      "containerd-shim-spin-v2",
+		url: func(arch environment.Arch) string {
+			return "https://github.com/spinframework/containerd-shim-spin/releases/download/" + spinShimVersion +
+				"/containerd-shim-spin-v2-linux-" + string(arch) + ".tar.gz"
+		},
+	},
+	{
+		Name:        "wasmtime",
+		RuntimeType: "io.containerd.wasmtime.v1",
+		binary:      "containerd-shim-wasmtime-v1",
+		url:         runwasiShimURL("wasmtime"),
+	},
+	{
+		Name:        "wasmedge",
+		RuntimeType: "io.containerd.wasmedge.v1",
+		binary:      "containerd-shim-wasmedge-v1",
+		url:         runwasiShimURL("wasmedge"),
+	},
+}
+
+// WasmShims returns the shims with the names, in the order of the names.
+func WasmShims(names []string) []WasmShim {
+	var shims []WasmShim
+	for _, name := range names {
+		for _, s := range wasmShims {
+			if s.Name == name {
+				shims = append(shims, s)
+			}
+		}
+	}
+	return shims
+}
+
+// InstallWasmShims installs the shims missing in the VM to /usr/local/bin, where they are
+// found by containerd for the runtime types.
+func InstallWasmShims(host environment.HostActions, guest environment.GuestActions, a *cli.ActiveCommandChain, shims []WasmShim) {
+	for _, s := range shims {
+		if guest.RunQuiet("test", "-x", "/usr/local/bin/"+s.binary) == nil {
+			continue
+		}
+
+		a.Stagef("installing %s wasm shim", s.Name)
+		downloadPath := path.Join("/tmp", s.binary+".tar.gz")
+		a.Add(func() error {
+			return downloader.DownloadToGuest(host, guest, downloader.Request{URL: s.url(guest.Arch())}, downloadPath)
+		})
+		a.Add(func() error {
+			if err := guest.Run("sudo", "tar", "-xzf", downloadPath, "-C", "/usr/local/bin", s.binary); err != nil {
+				return fmt.Errorf("error installing %s wasm shim: %w", s.Name, err)
+			}
+			return nil
+		})
+		a.Add(func() error { return guest.RunQuiet("rm", "-f", downloadPath) })
+	}
+}
@@ -4,8 +4,13 @@ import (
 	"path/filepath"
 
 	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment"
 )
 
+// contextKey is the key of the name of the docker context on the host.
+const contextKey = "docker_context"
+
 var configDir = func() string { return config.CurrentProfile().ConfigDir() }
 
 // HostSocketFile returns the path to the docker socket on host.
@@ -14,25 +19,62 @@ func LegacyDefaultHostSocketFile() string {
 	return filepath.Join(filepath.Dir(configDir()), "docker.sock")
 }
 
-func (d dockerRuntime) contextCreated() bool {
-	return d.host.RunQuiet("docker", "context", "inspect", config.CurrentProfile().ID) == nil
-}
+// ProfileSocketFile returns the path to the docker socket of the profile on host.
+func ProfileSocketFile(p *config.Profile) string { return filepath.Join(p.ConfigDir(), "docker.sock") }
 
-func (d dockerRuntime) setupContext() error {
-	if d.contextCreated() {
+// CreateContext creates the docker context of the profile on the host, if not created.
+// The context is created regardless of the profile running.
+func CreateContext(host environment.HostActions, p *config.Profile, name string) error {
+	if host.RunQuiet("docker", "context", "inspect", name) == nil {
 		return nil
 	}
 
-	profile := config.CurrentProfile()
-
-	return d.host.Run("docker", "context", "create", profile.ID,
-		"--description", profile.DisplayName,
-		"--docker", "host=unix://"+HostSocketFile(),
+	return host.Run("docker", "context", "create", name,
+		"--description", p.DisplayName,
+		"--docker", "host=unix://"+ProfileSocketFile(p),
 	)
 }
 
+// UseContext sets the docker context as the current context on the host.
+func UseContext(host environment.HostActions, name string) error {
+	return host.Run("docker", "context", "use", name)
+}
+
+// contextName returns the name of the docker context of the profile, from the config of the
+// instance if the VM is not running.
+func (d dockerRuntime) contextName() string {
+	if name := d.guest.Get(contextKey); name != "" {
+		return name
+	}
+	conf, _ := configmanager.LoadInstance()
+	if name, err := conf.DockerContextName(config.CurrentProfile()); err == nil {
+		return name
+	}
+	return config.CurrentProfile().ID
+}
+
+func (d dockerRuntime) contextCreated() bool {
+	return d.host.RunQuiet("docker", "context", "inspect", d.contextName()) == nil
+}
+
+// setupContext creates the docker context, the context previously created with another name
+// is removed.
+func (d dockerRuntime) setupContext(name string) error {
+	if previous := d.guest.Get(contextKey); previous != "" && previous != name {
+		if d.host.RunQuiet("docker", "context", "inspect", previous) == nil {
+			if err := d.host.Run("docker", "context", "rm", "--force", previous); err != nil {
+				return err
+			}
+		}
+	}
+	if err := CreateContext(d.host, config.CurrentProfile(), name); err != nil {
+		return err
+	}
+	return d.guest.Set(contextKey, name)
+}
+
 func (d dockerRuntime) useContext() error {
-	return d.host.Run("docker", "context", "use", config.CurrentProfile().ID)
+	return UseContext(d.host, d.contextName())
 }
 
 func (d dockerRuntime) teardownContext() error {
@@ -40,5 +82,5 @@ func (d dockerRuntime) teardownContext() error {
 		return nil
 	}
 
-	return d.host.Run("docker", "context", "rm", "--force", config.CurrentProfile().ID)
+	return d.host.Run("docker", "context", "rm", "--force", d.contextName())
 }
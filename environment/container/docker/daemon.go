@@ -5,6 +5,11 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"strconv"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/util/proxy"
 )
 
 const daemonFile = "/etc/docker/daemon.json"
@@ -52,16 +57,34 @@ func resolveHostProxy(hostProxy, hostGateway string) string {
 	return hostProxy
 }
 
-func (d dockerRuntime) createDaemonFile(conf map[string]any, env map[string]string) error {
+// IPv6 networks of the containers, unique local addresses as the containers are not reachable
+// from the internet.
+const (
+	ipv6BridgeCIDR = "fd00:dc::/64"
+	ipv6PoolBase   = "fd00:dc:1::/48"
+)
+
+// defaultAddressPools are the default docker address pools with an IPv6 pool appended.
+var defaultAddressPools = []map[string]any{
+	{"base": "172.17.0.0/16", "size": 16},
+	{"base": "172.18.0.0/15", "size": 16},
+	{"base": "172.20.0.0/14", "size": 16},
+	{"base": "172.24.0.0/13", "size": 16},
+	{"base": "192.168.0.0/16", "size": 20},
+	{"base": ipv6PoolBase, "size": 64},
+}
+
+func (d dockerRuntime) createDaemonFile(conf map[string]any, proxies proxy.Settings, network config.Network, registries []config.RegistryHost, sysbox bool) error {
 	if conf == nil {
 		conf = map[string]any{}
 	}
 
-	// enable buildkit (if not set by user)
+	// enable buildkit and CDI devices e.g. the GPU (if not set by user)
 	if _, ok := conf["features"]; !ok {
 		conf["features"] = map[string]any{
 			"buildkit":               true,
 			"containerd-snapshotter": true,
+			"cdi":                    true,
 		}
 	}
 
@@ -70,27 +93,80 @@ func (d dockerRuntime) createDaemonFile(conf map[string]any, env map[string]stri
 		conf["exec-opts"] = []string{"native.cgroupdriver=cgroupfs"}
 	} else if opts, ok := conf["exec-opts"].([]string); ok {
 		conf["exec-opts"] = append(opts, "native.cgroupdriver=cgroupfs")
+	} else if opts, ok := conf["exec-opts"].([]any); ok {
+		// as decoded from the config file
+		conf["exec-opts"] = append(opts, "native.cgroupdriver=cgroupfs")
+	}
+	// sysbox runtime (if not set by user)
+	if sysbox {
+		runtimes, _ := conf["runtimes"].(map[string]any)
+		if runtimes == nil {
+			runtimes = map[string]any{}
+		}
+		if _, ok := runtimes[containerd.SysboxRuntime]; !ok {
+			runtimes[containerd.SysboxRuntime] = map[string]any{"path": containerd.SysboxBinary}
+		}
+		conf["runtimes"] = runtimes
+	}
+	// DNS search domains for the containers (if not set by user)
+	if _, ok := conf["dns-search"]; !ok && len(network.DNSSearch) > 0 {
+		conf["dns-search"] = network.DNSSearch
+	}
+
+	// registry mirrors of Docker Hub and insecure registries (if not set by user)
+	if _, ok := conf["registry-mirrors"]; !ok {
+		if mirrors := registryMirrors(registries); len(mirrors) > 0 {
+			conf["registry-mirrors"] = mirrors
+		}
+	}
+	if _, ok := conf["insecure-registries"]; !ok {
+		if insecure := insecureRegistries(registries); len(insecure) > 0 {
+			conf["insecure-registries"] = insecure
+		}
+	}
+
+	// options of the default bridge and the user-defined networks (if not set by user)
+	bridgeOpts := map[string]string{}
+	// MTU
+	if network.MTU > 0 {
+		if _, ok := conf["mtu"]; !ok {
+			conf["mtu"] = network.MTU
+		}
+		bridgeOpts["com.docker.network.driver.mtu"] = strconv.Itoa(network.MTU)
+	}
+	// IPv6
+	if _, ok := conf["ipv6"]; !ok && network.IPv6 {
+		conf["ipv6"] = true
+		conf["fixed-cidr-v6"] = ipv6BridgeCIDR
+		if _, ok := conf["default-address-pools"]; !ok {
+			conf["default-address-pools"] = defaultAddressPools
+		}
+		bridgeOpts["com.docker.network.enable_ipv6"] = "true"
 	}
+	if _, ok := conf["default-network-opts"]; !ok && len(bridgeOpts) > 0 {
+		conf["default-network-opts"] = map[string]any{"bridge": bridgeOpts}
+	}
+
 	// remove host-gateway-ip if set by the user
 	// to avoid clash with systemd configuration
 	delete(conf, hostGatewayIPKey)
 
 	// add proxy vars if set
 	// according to https://docs.docker.com/config/daemon/systemd/#httphttps-proxy
-	if vars := d.proxyEnvVars(env); !vars.empty() {
+	if !proxies.Empty() {
 		proxyConf := map[string]any{}
 		hostGatewayIP, err := getHostGatewayIp(d, conf)
 		if err != nil {
 			return err
 		}
-		if vars.http != "" {
-			proxyConf["http-proxy"] = resolveHostProxy(vars.http, hostGatewayIP)
+		if proxies.HTTP != "" {
+			proxyConf["http-proxy"] = resolveHostProxy(proxies.HTTP, hostGatewayIP)
 		}
-		if vars.https != "" {
-			proxyConf["https-proxy"] = resolveHostProxy(vars.https, hostGatewayIP)
+		if proxies.HTTPS != "" {
+			proxyConf["https-proxy"] = resolveHostProxy(proxies.HTTPS, hostGatewayIP)
 		}
-		if vars.no != "" {
-			proxyConf["no-proxy"] = vars.no
+		if proxies.NoProxy != "" {
+			proxyConf["no-proxy"] = proxies.NoProxy
 		}
 		conf["proxies"] = proxyConf
 	}
@@ -102,6 +178,41 @@ func (d dockerRuntime) createDaemonFile(conf map[string]any, env map[string]stri
 	return d.guest.Write(daemonFile, b)
 }
 
+// registryMirrors returns the mirrors of Docker Hub, docker only supports mirrors of Docker Hub.
+func registryMirrors(registries []config.RegistryHost) []string {
+	var mirrors []string
+	for _, r := range registries {
+		if r.Host != "docker.io" {
+			continue
+		}
+		for _, m := range r.Mirrors {
+			mirrors = append(mirrors, containerd.RegistryEndpoint(m))
+		}
+	}
+	return mirrors
+}
+
+// insecureRegistries returns the plain HTTP registries and the registries, including the mirrors,
+// without TLS verification.
+func insecureRegistries(registries []config.RegistryHost) []string {
+	var hosts []string
+	for _, r := range registries {
+		if !r.Insecure && !r.InsecureSkipVerify {
+			continue
+		}
+		hosts = append(hosts, r.Host)
+		if !r.InsecureSkipVerify {
+			continue
+		}
+		for _, m := range r.Mirrors {
+			if u, err := url.Parse(containerd.RegistryEndpoint(m)); err == nil && u.Host != "" {
+				hosts = append(hosts, u.Host)
+			}
+		}
+	}
+	return hosts
+}
+
 func (d dockerRuntime) addHostGateway(conf map[string]any) error {
 	// get host-gateway ip from the guest
 	ip, err := getHostGatewayIp(d, conf)
@@ -7,7 +7,10 @@ import (
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
 	"github.com/abiosoft/colima/util/debutil"
+	"github.com/abiosoft/colima/util/proxy"
 )
 
 // Name is container runtime name.
@@ -44,15 +47,40 @@ func (d dockerRuntime) Provision(ctx context.Context) error {
 
 	conf, _ := ctx.Value(config.CtxKey()).(config.Config)
 
+	// the disk image of the other runtimes has no docker, for a runtime switch
+	if d.guest.RunQuiet("sh", "-c", "command -v dockerd") != nil {
+		a.Stage("installing")
+		a.Add(func() error {
+			return d.guest.RunQuiet("sh", "-c", "curl -fsSL https://get.docker.com | sudo sh")
+		})
+		a.Add(func() error {
+			return d.guest.RunQuiet("sh", "-c", `sudo usermod -aG docker "$USER"`)
+		})
+	}
+
+	// disabled if previously switched to another runtime
+	a.Add(func() error {
+		return d.guest.RunQuiet("sudo", "systemctl", "enable", "docker.socket", "docker.service")
+	})
+
 	// provision containerd
 	a.Add(func() error {
 		return d.provisionContainerd(ctx)
 	})
 
+	// WebAssembly shims, if enabled
+	containerd.InstallWasmShims(d.host, d.guest, a, containerd.WasmShims(conf.WasmShims()))
+
+	// sysbox runtime, if enabled
+	if conf.Sysbox {
+		containerd.InstallSysbox(d.host, d.guest, a)
+	}
+
 	// daemon.json
 	a.Add(func() error {
 		// these are not fatal errors
-		if err := d.createDaemonFile(conf.Docker, conf.Env); err != nil {
+		proxies := proxy.Resolve(conf).WithNoProxy(proxy.NoProxyDefaults(conf, limautil.IPAddress(config.CurrentProfile().ID))...)
+		if err := d.createDaemonFile(conf.Docker, proxies, conf.Network, conf.Registries, conf.Sysbox); err != nil {
 			log.Warnln(err)
 		}
 		if err := d.addHostGateway(conf.Docker); err != nil {
@@ -65,7 +93,13 @@ func (d dockerRuntime) Provision(ctx context.Context) error {
 	})
 
 	// docker context
-	a.Add(d.setupContext)
+	a.Add(func() error {
+		name, err := conf.DockerContextName(config.CurrentProfile())
+		if err != nil {
+			return err
+		}
+		return d.setupContext(name)
+	})
 	if conf.AutoActivate() {
 		a.Add(d.useContext)
 	}
@@ -131,6 +165,30 @@ func (d dockerRuntime) Teardown(ctx context.Context) error {
 	return a.Exec()
 }
 
+var _ environment.Deprovisioner = (*dockerRuntime)(nil)
+
+// Deprovision disables docker and removes the docker context, for switching to another runtime.
+func (d dockerRuntime) Deprovision(ctx context.Context) error {
+	a := d.Init(ctx)
+
+	a.Add(func() error {
+		return d.guest.RunQuiet("sudo", "systemctl", "disable", "--now", "docker.socket", "docker.service")
+	})
+	a.Add(d.teardownContext)
+
+	return a.Exec()
+}
+
+var _ environment.ImageMigrator = (*dockerRuntime)(nil)
+
+func (d dockerRuntime) SaveImages(ctx context.Context, file string) (bool, error) {
+	return environment.SaveImages(d.guest, []string{"sudo", "docker"}, file)
+}
+
+func (d dockerRuntime) LoadImages(ctx context.Context, file string) error {
+	return environment.LoadImages(d.guest, []string{"sudo", "docker"}, file)
+}
+
 func (d dockerRuntime) Dependencies() []string {
 	return []string{"docker"}
 }
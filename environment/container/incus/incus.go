@@ -6,7 +6,9 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/abiosoft/colima/cli"
@@ -19,6 +21,9 @@ import (
 
 const incusBridgeInterface = "incusbr0"
 
+// GuestAPIPort is the port of the HTTPS API in the VM, forwarded to incus.apiPort on the host.
+const GuestAPIPort = 8443
+
 func newRuntime(host environment.HostActions, guest environment.GuestActions) environment.Container {
 	return &incusRuntime{
 		host:         host,
@@ -111,6 +116,21 @@ func (c *incusRuntime) Start(ctx context.Context) error {
 		return c.setRemote(conf.AutoActivate())
 	})
 
+	a.Add(func() error {
+		if err := c.setAPIRemote(conf.Incus.APIPort); err != nil {
+			return cli.ErrNonFatal(err)
+		}
+		return nil
+	})
+
+	a.Add(func() error {
+		return c.setProfiles(conf.Incus.ProfileFiles())
+	})
+
+	a.Add(func() error {
+		return c.setProject(conf.Incus.Project)
+	})
+
 	a.Add(func() error {
 		if err := c.addDockerRemote(); err != nil {
 			return cli.ErrNonFatal(err)
@@ -187,8 +207,141 @@ func (c incusRuntime) unsetRemote() error {
 	}
 
 	// if has remote, remove remote
-	if c.hasRemote(config.CurrentProfile().ID) {
-		return c.host.RunQuiet("incus", "remote", "remove", config.CurrentProfile().ID)
+	for _, name := range []string{config.CurrentProfile().ID, apiRemoteName()} {
+		if !c.hasRemote(name) {
+			continue
+		}
+		if err := c.host.RunQuiet("incus", "remote", "remove", name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apiRemoteName returns the name of the remote for the HTTPS API on the host.
+func apiRemoteName() string { return config.CurrentProfile().ID + "-https" }
+
+// setAPIRemote enables the HTTPS API in the VM and adds the remote for it on the host, with
+// the client certificate of the host trusted by a token. Disabled and removed if port is zero,
+// the remote is added again if the port has changed.
+func (c incusRuntime) setAPIRemote(port int) error {
+	url := "https://127.0.0.1:" + strconv.Itoa(port)
+	remotes, err := c.fetchRemotes()
+	if err != nil {
+		return err
+	}
+	if remote, ok := remotes[apiRemoteName()]; ok {
+		if port != 0 && remote.Addr == url {
+			return nil
+		}
+		if err := c.unsetAPIRemote(); err != nil {
+			return err
+		}
+	}
+	if port == 0 {
+		if err := c.guest.RunQuiet("sudo", "incus", "config", "unset", "core.https_address"); err != nil {
+			return fmt.Errorf("error disabling HTTPS API: %w", err)
+		}
+		return nil
+	}
+
+	address := "127.0.0.1:" + strconv.Itoa(GuestAPIPort)
+	if err := c.guest.RunQuiet("sudo", "incus", "config", "set", "core.https_address", address); err != nil {
+		return fmt.Errorf("error enabling HTTPS API: %w", err)
+	}
+
+	token, err := c.guest.RunOutput("sudo", "incus", "config", "trust", "add", apiRemoteName(), "--quiet")
+	if err != nil {
+		return fmt.Errorf("error creating trust token for the client certificate: %w", err)
+	}
+
+	// the client certificate is generated on the host if missing
+	if err := c.host.RunQuiet("incus", "remote", "add", apiRemoteName(), url,
+		"--token", strings.TrimSpace(token),
+		"--accept-certificate",
+	); err != nil {
+		return fmt.Errorf("error adding remote for HTTPS API: %w", err)
+	}
+
+	return nil
+}
+
+// unsetAPIRemote removes the remote for the HTTPS API on the host and the trust of its client
+// certificate in the VM.
+func (c incusRuntime) unsetAPIRemote() error {
+	if remote, _ := c.host.RunOutput("incus", "remote", "get-default"); remote == apiRemoteName() {
+		if err := c.host.RunQuiet("incus", "remote", "switch", "local"); err != nil {
+			return err
+		}
+	}
+	if err := c.host.RunQuiet("incus", "remote", "remove", apiRemoteName()); err != nil {
+		return fmt.Errorf("error removing remote for HTTPS API: %w", err)
+	}
+	// the client certificate is trusted with the name of the remote
+	out, err := c.guest.RunOutput("sudo", "incus", "config", "trust", "list", "--format", "csv", "--columns", "nf")
+	if err != nil {
+		return fmt.Errorf("error retrieving trusted certificates: %w", err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		name, fingerprint, _ := strings.Cut(strings.TrimSpace(line), ",")
+		if name != apiRemoteName() {
+			continue
+		}
+		if err := c.guest.RunQuiet("sudo", "incus", "config", "trust", "remove", fingerprint); err != nil {
+			return fmt.Errorf("error removing trusted certificate: %w", err)
+		}
+	}
+	return nil
+}
+
+// setProfiles creates or updates the profiles from the files on the host.
+// The profiles are named after the files without the extension.
+func (c incusRuntime) setProfiles(files []string) error {
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("error reading incus profile '%s': %w", name, err)
+		}
+
+		if c.guest.RunQuiet("sudo", "incus", "profile", "show", name) != nil {
+			if err := c.guest.RunQuiet("sudo", "incus", "profile", "create", name); err != nil {
+				return fmt.Errorf("error creating incus profile '%s': %w", name, err)
+			}
+		}
+		if err := c.guest.RunWith(bytes.NewReader(b), nil, "sudo", "incus", "profile", "edit", name); err != nil {
+			return fmt.Errorf("error applying incus profile '%s': %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// setProject creates the project if missing and selects it for the remotes on the host.
+// The project shares the images and profiles of the default project.
+func (c incusRuntime) setProject(project string) error {
+	if project == "" {
+		return nil
+	}
+
+	if c.guest.RunQuiet("sudo", "incus", "project", "show", project) != nil {
+		if err := c.guest.RunQuiet("sudo", "incus", "project", "create", project,
+			"--config", "features.images=false",
+			"--config", "features.profiles=false",
+		); err != nil {
+			return fmt.Errorf("error creating incus project '%s': %w", project, err)
+		}
+	}
+
+	for _, remote := range []string{config.CurrentProfile().ID, apiRemoteName()} {
+		if !c.hasRemote(remote) {
+			continue
+		}
+		if err := c.host.RunQuiet("incus", "project", "switch", remote+":"+project); err != nil {
+			return fmt.Errorf("error switching to incus project '%s': %w", project, err)
+		}
 	}
 
 	return nil
@@ -220,7 +373,7 @@ func (c incusRuntime) fetchRemotes() (remoteInfo, error) {
 
 func (c incusRuntime) isDefaultRemote() bool {
 	remote, _ := c.host.RunOutput("incus", "remote", "get-default")
-	return remote == config.CurrentProfile().ID
+	return remote == config.CurrentProfile().ID || remote == apiRemoteName()
 }
 
 func (c incusRuntime) addDockerRemote() error {
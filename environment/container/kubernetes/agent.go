@@ -0,0 +1,138 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util/proxy"
+)
+
+const (
+	// nodeTokenFile is the token in the server VM for joining the agent nodes.
+	nodeTokenFile = "/var/lib/rancher/k3s/server/node-token"
+	// serverKubeconfigFile is the kubeconfig in the server VM, with the listen port of the server.
+	serverKubeconfigFile = "/etc/rancher/k3s/k3s.yaml"
+	// agentTokenFile is the token in the agent VM for joining the server.
+	agentTokenFile = "/etc/rancher/k3s/agent-token"
+
+	// agentService is the service of the k3s agent.
+	agentService = "k3s-agent"
+)
+
+// joinInfo is the info for joining an agent node to the k3s server.
+type joinInfo struct {
+	IP    string // server address
+	URL   string
+	Token string
+}
+
+// serverJoinInfo retrieves the info for joining the k3s server in the VM of the server profile.
+// The server is reached on the user-v2 network address.
+func serverJoinInfo(host environment.HostActions, server string) (joinInfo, error) {
+	serverID := config.ProfileFromName(server).ID
+
+	ip := limautil.UserNetIPAddress(serverID)
+	if ip == "" {
+		return joinInfo{}, fmt.Errorf("address of server profile '%s' not available, ensure it is running", server)
+	}
+
+	script := fmt.Sprintf("cat %s && grep -m1 'server:' %s", nodeTokenFile, serverKubeconfigFile)
+	out, err := serverHost(host, server).RunOutput("lima", "sudo", "sh", "-c", script)
+	if err != nil {
+		return joinInfo{}, fmt.Errorf("error retrieving join token of server profile '%s': %w", server, err)
+	}
+	return parseJoinInfo(out, ip)
+}
+
+// serverHost returns the host for running commands in the VM of the server profile with lima.
+func serverHost(host environment.HostActions, server string) environment.HostActions {
+	serverID := config.ProfileFromName(server).ID
+	return host.WithEnv(limautil.EnvLimaHome+"="+config.LimaDir(), "LIMA_INSTANCE="+serverID)
+}
+
+// parseJoinInfo parses the node token and the server line of the kubeconfig, for the server at ip.
+func parseJoinInfo(output, ip string) (joinInfo, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 || strings.TrimSpace(lines[0]) == "" {
+		return joinInfo{}, fmt.Errorf("unexpected server output")
+	}
+
+	_, server, _ := strings.Cut(lines[1], "server:")
+	u, err := url.Parse(strings.TrimSpace(server))
+	if err != nil || u.Port() == "" {
+		return joinInfo{}, fmt.Errorf("invalid server address: '%s'", strings.TrimSpace(server))
+	}
+
+	return joinInfo{
+		IP:    ip,
+		URL:   "https://" + net.JoinHostPort(ip, u.Port()),
+		Token: strings.TrimSpace(lines[0]),
+	}, nil
+}
+
+// installK3sAgent installs k3s as an agent node of the k3s server in the VM of the server profile.
+func installK3sAgent(
+	host environment.HostActions,
+	guest environment.GuestActions,
+	a *cli.ActiveCommandChain,
+	containerRuntime string,
+	k3sVersion string,
+	airgap config.KubernetesAirgap,
+	server string,
+	proxies proxy.Settings,
+	kubelet []string,
+) {
+	installK3sScript(host, guest, a, k3sVersion, airgap)
+
+	var join joinInfo
+	a.Retry("waiting for server", time.Second*5, 6, func(int) error {
+		var err error
+		join, err = serverJoinInfo(host, server)
+		return err
+	})
+	// the token is passed as a file to keep it out of the process list
+	a.Add(func() error {
+		return guest.Write(agentTokenFile, []byte(join.Token+"\n"))
+	})
+	a.Add(func() error {
+		return guest.Run("sudo", "chmod", "600", agentTokenFile)
+	})
+
+	args := []string{"agent"}
+	a.Retry("waiting for VM IP address", time.Second*5, 4, func(int) error {
+		ip := limautil.UserNetIPAddress(config.CurrentProfile().ID)
+		if ip == "" {
+			return fmt.Errorf("no IP address assigned to the user-v2 network interface")
+		}
+		args = append(args, "--node-ip", ip, "--flannel-iface", limautil.UserNetInterface)
+		return nil
+	})
+
+	for _, arg := range kubeletArgs(kubelet) {
+		args = append(args, "--kubelet-arg="+arg)
+	}
+
+	switch containerRuntime {
+	case docker.Name:
+		args = append(args, "--docker")
+	case containerd.Name:
+		args = append(args, "--container-runtime-endpoint", "unix:///run/containerd/containerd.sock")
+	}
+
+	a.Add(func() error {
+		env := []string{"env", "K3S_URL=" + join.URL, "K3S_TOKEN_FILE=" + agentTokenFile}
+		for k, v := range proxies.WithNoProxy(join.IP).Env() {
+			env = append(env, k+"="+v)
+		}
+		return guest.Run(append(env, "sh", "-c", "INSTALL_K3S_SKIP_DOWNLOAD=true INSTALL_K3S_SKIP_ENABLE=true k3s-install.sh "+strings.Join(args, " "))...)
+	})
+}
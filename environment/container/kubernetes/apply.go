@@ -0,0 +1,219 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util/downloader"
+)
+
+const (
+	// helmVersion is the version of helm installed in the VM.
+	helmVersion = "v3.18.4"
+	// helmFile is the helm binary in the VM.
+	helmFile = "/usr/local/bin/helm"
+	// deployDir is the staging dir in the VM for the manifests, values and charts on the host.
+	deployDir = "/tmp/colima-kubernetes-deploy"
+)
+
+// ChartOptions are the options of a helm chart installation.
+type ChartOptions struct {
+	Namespace string   // namespace of the release, created if missing
+	Repo      string   // chart repository URL, if the chart is not a reference or local archive
+	Version   string   // chart version, the latest if empty
+	Values    []string // values files on the host
+	Set       []string // values as key=value
+}
+
+// Deployer is implemented by the Kubernetes runtime for deploying to the cluster with the
+// kubectl and helm of the VM, without kubectl and helm on the host.
+type Deployer interface {
+	// Apply applies the manifests of the files, directories or URLs, "-" for the manifests read from r.
+	Apply(ctx context.Context, files []string, r io.Reader, w io.Writer) error
+	// Install installs or upgrades the release of the helm chart.
+	Install(ctx context.Context, release, chart string, opts ChartOptions, w io.Writer) error
+}
+
+var _ Deployer = (*kubernetesRuntime)(nil)
+
+// deployable returns an error if the cluster cannot be deployed to from the node.
+func (c *kubernetesRuntime) deployable(ctx context.Context) error {
+	if conf := c.config(); conf.Agent() {
+		return fmt.Errorf("not supported for an agent node, use the server profile '%s' instead", conf.Server)
+	}
+	if !c.Running(ctx) {
+		return fmt.Errorf("%s is not running", Name)
+	}
+	return nil
+}
+
+// Apply applies the manifests with kubectl in the VM. The files and directories on the host
+// are copied to the VM, the URLs are fetched by kubectl.
+func (c *kubernetesRuntime) Apply(ctx context.Context, files []string, r io.Reader, w io.Writer) error {
+	if err := c.deployable(ctx); err != nil {
+		return err
+	}
+
+	if err := c.guest.Run("mkdir", "-p", deployDir); err != nil {
+		return fmt.Errorf("error creating deploy dir: %w", err)
+	}
+	defer func() { _ = c.guest.RunQuiet("sudo", "rm", "-rf", deployDir) }()
+
+	args := []string{"kubectl", "apply"}
+	for i, file := range files {
+		switch {
+		case file == "-", isURL(file):
+			args = append(args, "-f", file)
+		default:
+			manifests, err := hostManifests(file)
+			if err != nil {
+				return err
+			}
+			for j, manifest := range manifests {
+				staged, err := c.stage(manifest, fmt.Sprintf("manifest-%d-%d%s", i, j, filepath.Ext(manifest)))
+				if err != nil {
+					return err
+				}
+				args = append(args, "-f", staged)
+			}
+		}
+	}
+
+	return c.guest.RunWith(r, w, args...)
+}
+
+// Install installs or upgrades the release with helm in the VM, helm is installed on first use.
+// The values files and local chart archive on the host are copied to the VM.
+func (c *kubernetesRuntime) Install(ctx context.Context, release, chart string, opts ChartOptions, w io.Writer) error {
+	if err := c.deployable(ctx); err != nil {
+		return err
+	}
+
+	if out, err := c.guest.RunOutput(helmFile, "version", "--short"); err != nil || !strings.HasPrefix(out, helmVersion) {
+		a := c.Init(ctx)
+		a.Stagef("installing helm %s", helmVersion)
+		installHelm(c.host, c.guest, a)
+		if err := a.Exec(); err != nil {
+			return fmt.Errorf("error installing helm: %w", err)
+		}
+	}
+
+	if err := c.guest.Run("mkdir", "-p", deployDir); err != nil {
+		return fmt.Errorf("error creating deploy dir: %w", err)
+	}
+	defer func() { _ = c.guest.RunQuiet("sudo", "rm", "-rf", deployDir) }()
+
+	// a local chart archive is copied, a chart directory must be packaged
+	if stat, err := os.Stat(chart); err == nil {
+		if stat.IsDir() {
+			return fmt.Errorf("chart directory not supported, package the chart with 'helm package %s'", chart)
+		}
+		if chart, err = c.stage(chart, "chart"+filepath.Ext(chart)); err != nil {
+			return err
+		}
+	}
+
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	args := []string{"sudo", helmFile, "--kubeconfig", c.distro().kubeconfigFile(),
+		"upgrade", "--install", release, chart,
+		"--namespace", namespace, "--create-namespace",
+	}
+	if opts.Repo != "" {
+		args = append(args, "--repo", opts.Repo)
+	}
+	if opts.Version != "" {
+		args = append(args, "--version", opts.Version)
+	}
+	for i, values := range opts.Values {
+		staged, err := c.stage(values, "values-"+strconv.Itoa(i)+".yaml")
+		if err != nil {
+			return err
+		}
+		args = append(args, "--values", staged)
+	}
+	for _, set := range opts.Set {
+		args = append(args, "--set", set)
+	}
+
+	return c.guest.RunWith(nil, w, args...)
+}
+
+// stage copies the file on the host to the deploy dir in the VM, and returns the path in the VM.
+func (c *kubernetesRuntime) stage(file, name string) (string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", file, err)
+	}
+	staged := filepath.Join(deployDir, name)
+	if err := c.guest.Write(staged, b); err != nil {
+		return "", fmt.Errorf("error copying %s: %w", file, err)
+	}
+	return staged, nil
+}
+
+// hostManifests returns the manifest files of the file or directory on the host.
+// The manifests of a directory are the yaml and json files, as with kubectl.
+func hostManifests(file string) ([]string, error) {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file, err)
+	}
+	if !stat.IsDir() {
+		return []string{file}, nil
+	}
+
+	entries, err := os.ReadDir(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file, err)
+	}
+	var manifests []string
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+			if !entry.IsDir() {
+				manifests = append(manifests, filepath.Join(file, entry.Name()))
+			}
+		}
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("no manifests found in %s", file)
+	}
+	return manifests, nil
+}
+
+// isURL returns if the file is a URL fetched by kubectl.
+func isURL(file string) bool {
+	return strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://")
+}
+
+// installHelm downloads and installs helm in the VM.
+func installHelm(host environment.HostActions, guest environment.GuestActions, a *cli.ActiveCommandChain) {
+	downloadPath := "/tmp/helm.tar.gz"
+	platform := "linux-" + guest.Arch().GoArch()
+
+	url := "https://get.helm.sh/helm-" + helmVersion + "-" + platform + ".tar.gz"
+	a.Add(func() error {
+		r := downloader.Request{
+			URL: url,
+			SHA: &downloader.SHA{Size: 256, URL: url + ".sha256sum"},
+		}
+		return downloader.DownloadToGuest(host, guest, r, downloadPath)
+	})
+	a.Add(func() error {
+		if err := guest.Run("tar", "-xzf", downloadPath, "-C", "/tmp", platform+"/helm"); err != nil {
+			return err
+		}
+		return guest.Run("sudo", "install", "/tmp/"+platform+"/helm", helmFile)
+	})
+	a.Add(func() error { return guest.RunQuiet("rm", "-rf", downloadPath, "/tmp/"+platform) })
+}
@@ -0,0 +1,193 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// backupMetadata is the metadata of the backup, the first entry of the archive.
+	backupMetadata = "colima-kubernetes-backup.json"
+	// backupDir is the staging dir in the VM for the backup metadata and the archive to restore.
+	backupDir = "/tmp/colima-kubernetes-backup"
+)
+
+// BackupRestorer is implemented by the Kubernetes runtime for backing up and restoring the cluster state.
+type BackupRestorer interface {
+	// Backup writes the archive of the cluster state to w.
+	Backup(ctx context.Context, w io.Writer) error
+	// Restore replaces the cluster state with the archive read from r.
+	Restore(ctx context.Context, r io.Reader) error
+}
+
+var _ BackupRestorer = (*kubernetesRuntime)(nil)
+
+// backupInfo is the metadata of the backup.
+type backupInfo struct {
+	Distro  string    `json:"distro"`
+	Version string    `json:"version"`
+	Dirs    []string  `json:"dirs"`
+	Created time.Time `json:"created"`
+}
+
+// Backup writes a gzipped tar archive of the datastore, certificates and persistent volumes
+// of the cluster to w. The cluster is stopped for a consistent snapshot of the datastore
+// and started afterwards, also if the backup fails.
+func (c *kubernetesRuntime) Backup(ctx context.Context, w io.Writer) (err error) {
+	if c.config().Agent() {
+		return fmt.Errorf("backup not supported for an agent node, backup the server profile instead")
+	}
+	d := c.distro()
+	if !d.installed() {
+		return fmt.Errorf("%s is not installed", Name)
+	}
+
+	info := backupInfo{
+		Distro:  d.Name(),
+		Version: d.installedVersion(),
+		Created: time.Now().UTC(),
+	}
+	for _, dir := range d.dataDirs() {
+		if c.guest.RunQuiet("sudo", "test", "-d", dir) == nil {
+			info.Dirs = append(info.Dirs, dir)
+		}
+	}
+	b, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("error encoding backup metadata: %w", err)
+	}
+
+	if c.Running(ctx) {
+		a := c.Init(ctx)
+		a.Stage("stopping")
+		a.Add(d.stop)
+		// the cluster is started even if stopping partially failed
+		defer func() {
+			a := c.Init(ctx)
+			a.Stage("starting")
+			a.Add(d.start)
+			if startErr := a.Exec(); err == nil {
+				err = startErr
+			}
+		}()
+		if err := a.Exec(); err != nil {
+			return err
+		}
+	}
+
+	a := c.Init(ctx)
+	a.Stage("creating backup")
+	a.Add(func() error {
+		if err := c.guest.Run("mkdir", "-p", backupDir); err != nil {
+			return fmt.Errorf("error creating backup dir: %w", err)
+		}
+		return c.guest.Write(backupDir+"/"+backupMetadata, b)
+	})
+	a.Add(func() error {
+		args := []string{"sudo", "tar", "-czf", "-", "-C", backupDir, backupMetadata, "-C", "/"}
+		for _, dir := range info.Dirs {
+			args = append(args, strings.TrimPrefix(dir, "/"))
+		}
+		if err := c.guest.RunWith(nil, w, args...); err != nil {
+			return fmt.Errorf("error archiving cluster state: %w", err)
+		}
+		return nil
+	})
+	a.Add(func() error { return c.guest.RunQuiet("sudo", "rm", "-rf", backupDir) })
+
+	return a.Exec()
+}
+
+// Restore replaces the datastore, certificates and persistent volumes of the cluster with
+// the archive read from r, created by Backup. The cluster must be of the same distribution,
+// and is restarted with the restored state. The kubeconfig on the host is updated for the
+// restored certificates.
+func (c *kubernetesRuntime) Restore(ctx context.Context, r io.Reader) error {
+	if c.config().Agent() {
+		return fmt.Errorf("restore not supported for an agent node, restore the server profile instead")
+	}
+	d := c.distro()
+	if !d.installed() {
+		return fmt.Errorf("%s is not installed, start the cluster before restoring", Name)
+	}
+
+	log := c.Logger(ctx)
+	archive := backupDir + "/restore.tar.gz"
+
+	// the archive is staged in the VM to validate the metadata before the state is replaced
+	if err := c.guest.Run("mkdir", "-p", backupDir); err != nil {
+		return fmt.Errorf("error creating backup dir: %w", err)
+	}
+	defer func() { _ = c.guest.RunQuiet("sudo", "rm", "-rf", backupDir) }()
+	if err := c.guest.RunWith(r, nil, "sh", "-c", "cat > "+archive); err != nil {
+		return fmt.Errorf("error copying backup: %w", err)
+	}
+	if err := c.guest.RunQuiet("tar", "-xzf", archive, "-C", backupDir, backupMetadata); err != nil {
+		return fmt.Errorf("invalid backup, %s not found: %w", backupMetadata, err)
+	}
+
+	var info backupInfo
+	{
+		b, err := c.guest.Read(backupDir + "/" + backupMetadata)
+		if err != nil {
+			return fmt.Errorf("error reading backup metadata: %w", err)
+		}
+		if err := json.Unmarshal([]byte(b), &info); err != nil {
+			return fmt.Errorf("error parsing backup metadata: %w", err)
+		}
+	}
+	if info.Distro != d.Name() {
+		return fmt.Errorf("backup of a %s cluster cannot be restored to a %s cluster", info.Distro, d.Name())
+	}
+	if current := d.installedVersion(); current != "" && compareVersions(info.Version, current) > 0 {
+		log.Warnf("backup of version %s is newer than the installed version %s", info.Version, current)
+	}
+
+	// only the state dirs of the distribution are restored
+	var dirs []string
+	for _, dir := range d.dataDirs() {
+		if slices.Contains(info.Dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("invalid backup, no %s cluster state found", d.Name())
+	}
+
+	a := c.Init(ctx)
+
+	a.Stage("stopping")
+	if c.Running(ctx) {
+		a.Add(d.stop)
+	}
+	// the containers of the current Pods are recreated from the restored state
+	a.Add(c.deleteAllContainers)
+
+	args := []string{"sudo", "tar", "-xzf", archive, "-C", "/"}
+	for _, dir := range dirs {
+		a.Add(func() error { return c.guest.Run("sudo", "rm", "-rf", dir) })
+		args = append(args, strings.TrimPrefix(dir, "/"))
+	}
+
+	a.Stagef("restoring backup of %s", info.Created.Local().Format(time.RFC1123))
+	a.Add(func() error {
+		if err := c.guest.Run(args...); err != nil {
+			return fmt.Errorf("error extracting cluster state: %w", err)
+		}
+		return nil
+	})
+
+	// the kubeconfig is updated for the restored certificates
+	a.Add(func() error { return c.guest.Set(masterAddressKey, "") })
+
+	if err := a.Exec(); err != nil {
+		return c.reportFailure(ctx, "restore", err)
+	}
+
+	return c.Start(ctx)
+}
@@ -0,0 +1,132 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+)
+
+// CertRenewBefore is the remaining validity of the certificates rotated on startup.
+const CertRenewBefore = 30 * 24 * time.Hour
+
+// Cert is a certificate of the cluster.
+type Cert struct {
+	File     string    `json:"file"`
+	Subject  string    `json:"subject"`
+	NotAfter time.Time `json:"notAfter"`
+	CA       bool      `json:"ca"` // certificate authority, not rotated
+}
+
+// Expiring returns if the certificate expires within d.
+func (c Cert) Expiring(d time.Duration) bool {
+	return time.Until(c.NotAfter) < d
+}
+
+// CertRotator is implemented by the Kubernetes runtime for checking and rotating the certificates of the cluster.
+type CertRotator interface {
+	// Certs returns the certificates of the node.
+	Certs(ctx context.Context) ([]Cert, error)
+	// RotateCerts renews the client and serving certificates of the node, the certificate
+	// authorities are kept.
+	RotateCerts(ctx context.Context) error
+}
+
+var _ CertRotator = (*kubernetesRuntime)(nil)
+
+// Certs returns the certificates of the node, sorted by expiry.
+func (c *kubernetesRuntime) Certs(context.Context) ([]Cert, error) {
+	d := c.distro()
+	if !d.installed() {
+		return nil, fmt.Errorf("%s is not installed", Name)
+	}
+
+	// the certificates are read at once, each prefixed with the file name
+	script := `find ` + strings.Join(d.certDirs(), " ") + ` -name '*.crt' 2>/dev/null | while read -r f; do echo "# $f"; cat "$f"; done`
+	out, err := c.guest.RunOutput("sudo", "sh", "-c", script)
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificates: %w", err)
+	}
+	return parseCerts(out), nil
+}
+
+// RotateCerts renews the certificates with the cluster stopped, and restarts the cluster.
+// The kubeconfig on the host is updated for the renewed client certificate.
+func (c *kubernetesRuntime) RotateCerts(ctx context.Context) error {
+	d := c.distro()
+	if !d.installed() {
+		return fmt.Errorf("%s is not installed", Name)
+	}
+
+	a := c.Init(ctx)
+	if c.Running(ctx) {
+		a.Stage("stopping")
+		a.Add(d.stop)
+	}
+	c.rotateCerts(a)
+	if err := a.Exec(); err != nil {
+		return err
+	}
+
+	return c.Start(ctx)
+}
+
+// rotateCerts renews the certificates of the stopped cluster.
+func (c *kubernetesRuntime) rotateCerts(a *cli.ActiveCommandChain) {
+	a.Stage("rotating certificates")
+	a.Add(c.distro().rotateCerts)
+
+	// the kubeconfig is updated for the renewed certificates
+	a.Add(func() error { return c.guest.Set(masterAddressKey, "") })
+}
+
+// renewExpiringCerts rotates the certificates of the stopped cluster if any expires soon,
+// long-lived clusters are unusable with expired certificates.
+func (c *kubernetesRuntime) renewExpiringCerts(ctx context.Context, a *cli.ActiveCommandChain) {
+	if !c.distro().installed() {
+		return
+	}
+	certs, err := c.Certs(ctx)
+	if err != nil {
+		c.Logger(ctx).Warnln(fmt.Errorf("error checking certificates: %w", err))
+		return
+	}
+	for _, cert := range certs {
+		if !cert.CA && cert.Expiring(CertRenewBefore) {
+			a.Stagef("certificate %s expires on %s", cert.File, cert.NotAfter.Local().Format(time.DateOnly))
+			c.rotateCerts(a)
+			return
+		}
+	}
+}
+
+// parseCerts parses the PEM certificates, each preceded by a line with "# " and the file name.
+// The certificates that cannot be parsed are skipped.
+func parseCerts(out string) []Cert {
+	var certs []Cert
+	for _, section := range strings.Split("\n"+out, "\n# ")[1:] {
+		file, data, _ := strings.Cut(section, "\n")
+		// a bundle has the certificate of the file first
+		block, _ := pem.Decode([]byte(data))
+		if block == nil || block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, Cert{
+			File:     strings.TrimSpace(file),
+			Subject:  cert.Subject.CommonName,
+			NotAfter: cert.NotAfter,
+			CA:       cert.IsCA,
+		})
+	}
+	slices.SortStableFunc(certs, func(a, b Cert) int { return a.NotAfter.Compare(b.NotAfter) })
+	return certs
+}
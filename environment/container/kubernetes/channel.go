@@ -0,0 +1,63 @@
+package kubernetes
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// versionKey is the installed version, resolved once for a channel and kept until upgraded.
+const versionKey = "kubernetes_version"
+
+var channelRegex = regexp.MustCompile(`^(stable|latest|testing|v?\d+\.\d+)$`)
+
+// isChannel returns if the version is a release channel e.g. stable, latest or v1.29
+// for the latest patch release of a minor version.
+func isChannel(version string) bool {
+	return channelRegex.MatchString(version)
+}
+
+// resolveVersion returns the version to install for the configured version or channel.
+// The version of a channel is resolved once and kept until the cluster is upgraded.
+func (c kubernetesRuntime) resolveVersion(d distro, version string) (string, error) {
+	if !isChannel(version) {
+		return d.version(version), nil
+	}
+
+	current := c.config()
+	if installed := c.guest.Get(versionKey); installed != "" && current.Version == version && c.distro().Name() == d.Name() {
+		return installed, nil
+	}
+	return d.channelVersion(version)
+}
+
+// compareVersions compares the major, minor and patch of the versions e.g. v1.33.3+k3s1
+// and returns -1, 0 or 1. The release of the distribution in the suffix e.g. k3s1 is compared
+// if the rest is equal.
+func compareVersions(a, b string) int {
+	parse := func(v string) (n [4]int, name string) {
+		v, suffix, _ := strings.Cut(strings.TrimPrefix(v, "v"), "+")
+		for i, s := range strings.SplitN(v, ".", 3) {
+			n[i], _ = strconv.Atoi(s)
+		}
+		// the release is the trailing number e.g. k3s1, k3s10, k0s.0
+		name = strings.TrimRight(suffix, "0123456789")
+		n[3], _ = strconv.Atoi(suffix[len(name):])
+		return n, name
+	}
+
+	an, aname := parse(a)
+	bn, bname := parse(b)
+	for i := range an {
+		if i == len(an)-1 && aname != bname {
+			return strings.Compare(aname, bname)
+		}
+		switch {
+		case an[i] < bn[i]:
+			return -1
+		case an[i] > bn[i]:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,25 @@
+package kubernetes
+
+import "testing"
+
+func Test_compareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "v1.29.4+k3s1", b: "v1.29.4+k3s1", want: 0},
+		{a: "v1.29.4+k3s1", b: "v1.30.0+k3s1", want: -1},
+		{a: "v1.29.10+k3s1", b: "v1.29.9+k3s1", want: 1},
+		{a: "v1.29.4+k3s2", b: "v1.29.4+k3s10", want: -1},
+		{a: "v1.29.4+k3s10", b: "v1.29.4+k3s9", want: 1},
+		{a: "v1.29.4+k0s.1", b: "v1.29.4+k0s.0", want: 1},
+		{a: "v1.29.4", b: "v1.29.4+k3s1", want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := compareVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("compareVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,27 +2,191 @@ package kubernetes
 
 import (
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/embedded"
 	"github.com/abiosoft/colima/environment"
+	"gopkg.in/yaml.v3"
 )
 
-func installCniConfig(guest environment.GuestActions, a *cli.ActiveCommandChain) {
+// CNI plugins.
+const (
+	CNIFlannel = "flannel"
+	CNICalico  = "calico"
+	CNICilium  = "cilium"
+	CNINone    = "none"
+)
+
+// flannelConfFile is the CNI config of flannel, the k3s default.
+const flannelConfFile = "/etc/cni/net.d/10-flannel.conflist"
+
+// cniManifest is the manifest of the CNI chart, auto-deployed by k3s.
+const cniManifest = "/var/lib/rancher/k3s/server/manifests/colima-cni.yaml"
+
+// vxlanOverhead is the encapsulation overhead of the flannel VXLAN backend, the k3s default.
+const vxlanOverhead = 50
+
+// flannelEnabled returns if the CNI plugin is flannel, the k3s default.
+func flannelEnabled(cni string) bool {
+	return cni == "" || cni == CNIFlannel
+}
+
+func installCniConfig(guest environment.GuestActions, a *cli.ActiveCommandChain, cni string, mtu int) {
+	// the flannel config of a previous cluster takes precedence over the CNI plugin
+	if !flannelEnabled(cni) {
+		a.Add(func() error {
+			return guest.RunQuiet("sudo", "rm", "-f", flannelConfFile)
+		})
+		return
+	}
+
 	// fix cni config
 	a.Add(func() error {
-		flannelFile := "/etc/cni/net.d/10-flannel.conflist"
-		cniConfDir := filepath.Dir(flannelFile)
+		cniConfDir := filepath.Dir(flannelConfFile)
 		if err := guest.Run("sudo", "mkdir", "-p", cniConfDir); err != nil {
 			return fmt.Errorf("error creating cni config dir: %w", err)
 		}
 
-		flannel, err := embedded.Read("k3s/flannel.json")
+		flannel, err := flannelConfig(mtu)
 		if err != nil {
-			return fmt.Errorf("error reading embedded flannel config: %w", err)
+			return err
 		}
-		return guest.Write(flannelFile, flannel)
+		return guest.Write(flannelConfFile, flannel)
 	})
 }
+
+// flannelConfig returns the flannel CNI config with the MTU of the Pod network
+// derived from the network MTU. flannel derives the MTU from the network interface if unset.
+func flannelConfig(mtu int) ([]byte, error) {
+	flannel, err := embedded.Read("k3s/flannel.json")
+	if err != nil {
+		return nil, fmt.Errorf("error reading embedded flannel config: %w", err)
+	}
+	if mtu <= 0 {
+		return flannel, nil
+	}
+
+	var conf struct {
+		Name       string           `json:"name"`
+		CNIVersion string           `json:"cniVersion"`
+		Plugins    []map[string]any `json:"plugins"`
+	}
+	if err := json.Unmarshal(flannel, &conf); err != nil {
+		return nil, fmt.Errorf("error parsing embedded flannel config: %w", err)
+	}
+	for _, plugin := range conf.Plugins {
+		if delegate, ok := plugin["delegate"].(map[string]any); ok && plugin["type"] == "flannel" {
+			delegate["mtu"] = mtu - vxlanOverhead
+		}
+	}
+	return json.MarshalIndent(conf, "", "    ")
+}
+
+// installK3sCNI deploys the chart of the CNI plugin replacing flannel.
+// The manifest is removed for flannel or no CNI plugin.
+func installK3sCNI(guest environment.GuestActions, a *cli.ActiveCommandChain, conf config.Kubernetes, ipv6 bool, mtu int) {
+	a.Add(func() error {
+		chart, ok, err := cniChart(conf.CNI, podCIDRs(conf, ipv6), mtu)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return guest.RunQuiet("sudo", "rm", "-f", cniManifest)
+		}
+
+		manifest, err := k3sHelmChart(chart)
+		if err != nil {
+			return err
+		}
+		return guest.Write(cniManifest, manifest)
+	})
+}
+
+// podCIDRs returns the Pod networks of the cluster, as routed from the host.
+func podCIDRs(conf config.Kubernetes, ipv6 bool) []string {
+	cidr := "10.42.0.0/16"
+	if _, val, ok := k3sArgIndex(conf.K3sArgs, "--cluster-cidr"); ok && val != "" {
+		cidr = val
+	}
+	if conf.PodCIDR != "" {
+		cidr = conf.PodCIDR
+	}
+
+	var cidrs []string
+	for _, c := range strings.Split(cidr, ",") {
+		cidrs = append(cidrs, strings.TrimSpace(c))
+	}
+	if ipv6 && !strings.Contains(cidr, ":") {
+		cidrs = append(cidrs, ipv6PodCIDR)
+	}
+	return cidrs
+}
+
+// cniChart returns the chart of the CNI plugin with the IP pools of the Pod networks,
+// false for flannel or no CNI plugin. The chart is required to bootstrap the cluster.
+func cniChart(cni string, podCIDRs []string, mtu int) (helmChart, bool, error) {
+	var chart helmChart
+	var values map[string]any
+
+	switch cni {
+	case CNICalico:
+		var pools []map[string]any
+		for _, cidr := range podCIDRs {
+			pools = append(pools, map[string]any{
+				"cidr":          cidr,
+				"encapsulation": "VXLAN",
+				"natOutgoing":   "Enabled",
+			})
+		}
+		network := map[string]any{
+			"bgp":     "Disabled",
+			"ipPools": pools,
+		}
+		if mtu > 0 {
+			network["mtu"] = mtu - vxlanOverhead
+		}
+		chart = helmChart{
+			Name:      "tigera-operator",
+			Repo:      "https://docs.tigera.io/calico/charts",
+			Namespace: "tigera-operator",
+		}
+		values = map[string]any{
+			"installation": map[string]any{
+				"cni":           map[string]any{"type": "Calico"},
+				"calicoNetwork": network,
+			},
+		}
+
+	case CNICilium:
+		// the Pod networks of the nodes are allocated from the cluster Pod networks
+		chart = helmChart{
+			Name:      "cilium",
+			Repo:      "https://helm.cilium.io",
+			Namespace: "kube-system",
+		}
+		values = map[string]any{
+			"ipam":     map[string]any{"mode": "kubernetes"},
+			"operator": map[string]any{"replicas": 1},
+			"ipv6":     map[string]any{"enabled": len(podCIDRs) > 1},
+		}
+		if mtu > 0 {
+			values["MTU"] = mtu
+		}
+
+	default:
+		return chart, false, nil
+	}
+
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return chart, false, fmt.Errorf("error encoding %s values: %w", chart.Name, err)
+	}
+	chart.Values = string(b)
+	chart.Bootstrap = true
+	return chart, true, nil
+}
@@ -0,0 +1,81 @@
+package kubernetes
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/daemon/process/credentials"
+	"github.com/abiosoft/colima/environment"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// credentialProviderDir is the dir of the kubelet credential provider plugin.
+	credentialProviderDir = "/var/lib/kubelet/credential-provider"
+	// credentialProviderConfigFile is the CredentialProviderConfig of the kubelet.
+	credentialProviderConfigFile = "/var/lib/kubelet/credential-provider-config.yaml"
+	// credentialProvider is the kubelet credential provider plugin, retrieving the registry
+	// credentials from the credential helpers of the host.
+	credentialProvider = "colima-credential-provider"
+)
+
+// credentialProviderScript is the kubelet credential provider plugin, the CredentialProviderRequest
+// is answered by the forwarded socket.
+const credentialProviderScript = `#!/bin/sh
+# generated by colima, retrieves the registry credentials from the credential helpers of the host
+exec curl -sf --unix-socket ` + credentials.GuestSocket + ` --data-binary @- http://localhost/kubelet
+`
+
+// credentialProviderArgs returns the kubelet args of the credential provider plugin.
+func credentialProviderArgs() []string {
+	return []string{
+		"image-credential-provider-config=" + credentialProviderConfigFile,
+		"image-credential-provider-bin-dir=" + credentialProviderDir,
+	}
+}
+
+// installCredentialProvider writes the credential provider plugin of the kubelet and its config,
+// if enabled. The plugin is removed otherwise.
+func installCredentialProvider(guest environment.GuestActions, a *cli.ActiveCommandChain, enabled bool) {
+	a.Add(func() error {
+		if !enabled {
+			return guest.RunQuiet("sudo", "rm", "-rf", credentialProviderDir, credentialProviderConfigFile)
+		}
+
+		plugin := filepath.Join(credentialProviderDir, credentialProvider)
+		if err := guest.Write(plugin, []byte(credentialProviderScript)); err != nil {
+			return err
+		}
+		if err := guest.Run("sudo", "chmod", "755", plugin); err != nil {
+			return err
+		}
+
+		b, err := credentialProviderConfig()
+		if err != nil {
+			return err
+		}
+		return guest.Write(credentialProviderConfigFile, b)
+	})
+}
+
+// credentialProviderConfig returns the CredentialProviderConfig of the kubelet, with the plugin
+// matching the images of all the registries.
+func credentialProviderConfig() ([]byte, error) {
+	b, err := yaml.Marshal(map[string]any{
+		"apiVersion": "kubelet.config.k8s.io/v1",
+		"kind":       "CredentialProviderConfig",
+		"providers": []map[string]any{
+			{
+				"name":                 credentialProvider,
+				"apiVersion":           "credentialprovider.kubelet.k8s.io/v1",
+				"matchImages":          []string{"*", "*.*", "*.*.*", "*.*.*.*", "*.*.*.*.*", "*.*.*.*.*.*"},
+				"defaultCacheDuration": "5m",
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding kubelet credential provider config: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,215 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+	"gopkg.in/yaml.v3"
+)
+
+// Dashboards.
+const (
+	DashboardKubernetes = "kubernetes-dashboard"
+	DashboardHeadlamp   = "headlamp"
+	DashboardNone       = "none"
+)
+
+const (
+	// k3sDashboardManifest is the manifest of the dashboard chart and account, auto-deployed by k3s.
+	k3sDashboardManifest = "/var/lib/rancher/k3s/server/manifests/colima-dashboard.yaml"
+	// k0sDashboardManifest is the manifest of the dashboard account, auto-deployed by k0s.
+	k0sDashboardManifest = "/var/lib/k0s/manifests/colima/dashboard.yaml"
+
+	// dashboardAccount is the service account of the login token of the dashboard.
+	dashboardAccount = "colima-dashboard"
+	// dashboardTokenDuration is the validity of the login token.
+	dashboardTokenDuration = "24h"
+)
+
+// dashboard is a dashboard chart with the service serving the UI.
+type dashboard struct {
+	chart   helmChart
+	service string
+	port    int
+	scheme  string
+}
+
+// dashboards are the dashboards of the cluster. The metrics of the dashboards are
+// provided by the metrics-server bundled with k3s and k0s.
+var dashboards = map[string]dashboard{
+	DashboardKubernetes: {
+		chart: helmChart{
+			Name:      "kubernetes-dashboard",
+			Repo:      "https://kubernetes.github.io/dashboard/",
+			Namespace: "kubernetes-dashboard",
+		},
+		service: "kubernetes-dashboard-kong-proxy",
+		port:    443,
+		scheme:  "https",
+	},
+	DashboardHeadlamp: {
+		chart: helmChart{
+			Name:      "headlamp",
+			Repo:      "https://kubernetes-sigs.github.io/headlamp/",
+			Namespace: "headlamp",
+		},
+		service: "headlamp",
+		port:    80,
+		scheme:  "http",
+	},
+}
+
+// Dashboard is the dashboard of the cluster, reachable on the host with the port forward.
+type Dashboard struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Token string `json:"token"` // login token, valid for 24 hours
+}
+
+// Dashboarder is implemented by the Kubernetes runtime for accessing the dashboard of the cluster.
+type Dashboarder interface {
+	// Dashboard returns the dashboard served on the port of the host, with a new login token.
+	Dashboard(ctx context.Context, port int) (Dashboard, error)
+	// ForwardDashboard forwards the port of the host to the dashboard, until interrupted.
+	ForwardDashboard(ctx context.Context, port int) error
+}
+
+var _ Dashboarder = (*kubernetesRuntime)(nil)
+
+// enabledDashboard returns the configured dashboard, or an error if none.
+func (c *kubernetesRuntime) enabledDashboard(ctx context.Context) (dashboard, error) {
+	conf := c.config()
+	if conf.Agent() {
+		return dashboard{}, fmt.Errorf("dashboard not supported for an agent node, use the server profile '%s' instead", conf.Server)
+	}
+	d, ok := dashboards[conf.Dashboard]
+	if !ok {
+		return dashboard{}, fmt.Errorf("dashboard not enabled, set kubernetes.dashboard in the config")
+	}
+	if !c.Running(ctx) {
+		return dashboard{}, fmt.Errorf("%s is not running", Name)
+	}
+	return d, nil
+}
+
+// Dashboard returns the dashboard with a login token of the dashboard account.
+func (c *kubernetesRuntime) Dashboard(ctx context.Context, port int) (Dashboard, error) {
+	d, err := c.enabledDashboard(ctx)
+	if err != nil {
+		return Dashboard{}, err
+	}
+
+	token, err := c.guest.RunOutput("kubectl", "--namespace", d.chart.Namespace,
+		"create", "token", dashboardAccount, "--duration="+dashboardTokenDuration)
+	if err != nil {
+		return Dashboard{}, fmt.Errorf("error creating dashboard token, the dashboard may still be deploying: %w", err)
+	}
+
+	return Dashboard{
+		Name:  d.chart.Name,
+		URL:   d.scheme + "://localhost:" + strconv.Itoa(port),
+		Token: strings.TrimSpace(token),
+	}, nil
+}
+
+// ForwardDashboard runs the port forward to the dashboard service in the VM, on the localhost
+// address forwarded to the host.
+func (c *kubernetesRuntime) ForwardDashboard(ctx context.Context, port int) error {
+	d, err := c.enabledDashboard(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the port forward fails until the dashboard is ready
+	if err := c.kubectl("--namespace", d.chart.Namespace, "wait", "deployment", "--all", "--for=condition=Available", "--timeout=120s"); err != nil {
+		return fmt.Errorf("dashboard not ready: %w", err)
+	}
+
+	return c.guest.RunInteractive("kubectl", "--namespace", d.chart.Namespace,
+		"port-forward", "service/"+d.service, strconv.Itoa(port)+":"+strconv.Itoa(d.port))
+}
+
+// installK3sDashboard deploys the chart of the dashboard and the dashboard account.
+// The manifest is removed if no dashboard is configured.
+func installK3sDashboard(guest environment.GuestActions, a *cli.ActiveCommandChain, name string) {
+	a.Add(func() error {
+		d, ok := dashboards[name]
+		if !ok {
+			return guest.RunQuiet("sudo", "rm", "-f", k3sDashboardManifest)
+		}
+
+		chart, err := k3sHelmChart(d.chart)
+		if err != nil {
+			return err
+		}
+		account, err := dashboardAccountManifest(d.chart.Namespace)
+		if err != nil {
+			return err
+		}
+		return guest.Write(k3sDashboardManifest, bytes.Join([][]byte{chart, account}, []byte("---\n")))
+	})
+}
+
+// installK0sDashboard deploys the dashboard account, the dashboard is a helm extension of the k0s config.
+// The manifest is removed if no dashboard is configured.
+func installK0sDashboard(guest environment.GuestActions, a *cli.ActiveCommandChain, name string) {
+	a.Add(func() error {
+		d, ok := dashboards[name]
+		if !ok {
+			return guest.RunQuiet("sudo", "rm", "-f", k0sDashboardManifest)
+		}
+
+		account, err := dashboardAccountManifest(d.chart.Namespace)
+		if err != nil {
+			return err
+		}
+		if err := guest.Run("sudo", "mkdir", "-p", filepath.Dir(k0sDashboardManifest)); err != nil {
+			return fmt.Errorf("error creating k0s manifests dir: %w", err)
+		}
+		return guest.Write(k0sDashboardManifest, account)
+	})
+}
+
+// dashboardAccountManifest returns the manifest of the namespace of the dashboard and the
+// cluster-admin service account for the login token.
+func dashboardAccountManifest(namespace string) ([]byte, error) {
+	var docs [][]byte
+	for _, obj := range []map[string]any{
+		{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]any{"name": namespace},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "ServiceAccount",
+			"metadata":   map[string]any{"name": dashboardAccount, "namespace": namespace},
+		},
+		{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "ClusterRoleBinding",
+			"metadata":   map[string]any{"name": dashboardAccount},
+			"roleRef": map[string]any{
+				"apiGroup": "rbac.authorization.k8s.io",
+				"kind":     "ClusterRole",
+				"name":     "cluster-admin",
+			},
+			"subjects": []map[string]any{
+				{"kind": "ServiceAccount", "name": dashboardAccount, "namespace": namespace},
+			},
+		},
+	} {
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding dashboard account: %w", err)
+		}
+		docs = append(docs, b)
+	}
+	return bytes.Join(docs, []byte("---\n")), nil
+}
@@ -0,0 +1,73 @@
+package kubernetes
+
+import (
+	"net"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util/proxy"
+	"github.com/sirupsen/logrus"
+)
+
+// Kubernetes distributions.
+const (
+	K3s = "k3s"
+	K0s = "k0s"
+)
+
+// distro is a Kubernetes distribution installed in the VM.
+type distro interface {
+	// Name returns the name of the distribution.
+	Name() string
+	// version returns the version to install for the configured version.
+	// The default version is used if unset or set for another distribution.
+	version(version string) string
+	// channelVersion resolves the version of the release channel.
+	channelVersion(channel string) (string, error)
+	installed() bool
+	installedVersion() string
+	versionInstalled(version string) bool
+	running() bool
+	provision(a *cli.ActiveCommandChain, log *logrus.Entry, p provisionArgs)
+	start() error
+	stop() error
+	uninstall() error
+	// service returns the systemd service of the node.
+	service() string
+	// kubeconfig returns the admin kubeconfig with the cluster, context and user
+	// named default and the server on 127.0.0.1.
+	kubeconfig() (string, error)
+	// kubeconfigFile returns the admin kubeconfig in the VM, readable by root.
+	kubeconfigFile() string
+	// dataDirs returns the dirs of the cluster state, the datastore, certificates and
+	// persistent volumes, for backup and restore.
+	dataDirs() []string
+	// certDirs returns the dirs of the certificates of the node.
+	certDirs() []string
+	// rotateCerts renews the client and serving certificates of the stopped node.
+	rotateCerts() error
+}
+
+// provisionArgs are the settings for provisioning a distribution.
+type provisionArgs struct {
+	conf           config.Kubernetes
+	runtime        string
+	currentRuntime string // runtime of the existing cluster, if any
+	proxies        proxy.Settings
+	ipv6           bool
+	mtu            int
+	dnsDomains     map[string][]net.IP
+	wasmShims      []string // WebAssembly shims of the containerd runtime, for the RuntimeClasses
+	configured     bool     // started with a config, not a restart of the running instance
+}
+
+// newDistro returns the distribution for the config.
+func newDistro(host environment.HostActions, guest environment.GuestActions, conf config.Kubernetes) distro {
+	switch conf.Distro {
+	case K0s:
+		return k0s{host: host, guest: guest}
+	default:
+		return k3s{host: host, guest: guest, agent: conf.Agent()}
+	}
+}
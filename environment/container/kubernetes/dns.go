@@ -0,0 +1,67 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+	"gopkg.in/yaml.v3"
+)
+
+// coreDNSCustomManifest is the manifest for the custom CoreDNS config, auto-deployed by k3s.
+const coreDNSCustomManifest = "/var/lib/rancher/k3s/server/manifests/colima-coredns-custom.yaml"
+
+// installCoreDNSForwarders configures CoreDNS to forward the queries for the domains to their resolvers.
+// The manifest is removed if there are no domains.
+func installCoreDNSForwarders(guest environment.GuestActions, a *cli.ActiveCommandChain, domains map[string][]net.IP) {
+	a.Add(func() error {
+		if len(domains) == 0 {
+			return guest.RunQuiet("sudo", "rm", "-f", coreDNSCustomManifest)
+		}
+
+		manifest, err := coreDNSCustomConfigMap(domains)
+		if err != nil {
+			return err
+		}
+		return guest.Write(coreDNSCustomManifest, manifest)
+	})
+}
+
+// coreDNSCustomConfigMap returns the coredns-custom configmap with a server block per domain.
+// The server blocks are imported by the CoreDNS config of k3s.
+func coreDNSCustomConfigMap(domains map[string][]net.IP) ([]byte, error) {
+	names := make([]string, 0, len(domains))
+	for domain := range domains {
+		names = append(names, domain)
+	}
+	sort.Strings(names)
+
+	var servers strings.Builder
+	for _, domain := range names {
+		var resolvers []string
+		for _, ip := range domains[domain] {
+			resolvers = append(resolvers, ip.String())
+		}
+		fmt.Fprintf(&servers, "%s:53 {\n    errors\n    cache 30\n    forward . %s\n}\n", domain, strings.Join(resolvers, " "))
+	}
+
+	configMap := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]any{
+			"name":      "coredns-custom",
+			"namespace": "kube-system",
+		},
+		"data": map[string]string{
+			"colima.server": servers.String(),
+		},
+	}
+	b, err := yaml.Marshal(configMap)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling coredns-custom configmap: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,119 @@
+package kubernetes
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+	"gopkg.in/yaml.v3"
+)
+
+// GPUResource is the resource of the GPU of the VM requested by the pods, e.g. with
+// the resource limit squat.ai/gpu: 1.
+const GPUResource = "squat.ai/" + gpuDeviceName
+
+const (
+	// k3sGPUManifest is the manifest of the GPU device plugin, auto-deployed by k3s.
+	k3sGPUManifest = "/var/lib/rancher/k3s/server/manifests/colima-gpu.yaml"
+	// k0sGPUManifest is the manifest of the GPU device plugin, auto-deployed by k0s.
+	k0sGPUManifest = "/var/lib/k0s/manifests/colima/gpu.yaml"
+
+	// k3sKubeletDir and k0sKubeletDir are the root dirs of the kubelet, with the device plugin sockets.
+	k3sKubeletDir = "/var/lib/kubelet"
+	k0sKubeletDir = "/var/lib/k0s/kubelet"
+
+	// gpuDevicePluginImage is pinned to a commit of the device plugin, the images are tagged by commit.
+	gpuDevicePluginImage = "ghcr.io/squat/generic-device-plugin:36bfc606bba2064de6ede0ff2764cbb52edff70d"
+	gpuDeviceName        = "gpu"
+	// gpuDeviceDir is the dir of the render nodes of the virtio-gpu device.
+	gpuDeviceDir = "/dev/dri"
+	// gpuShares is the number of containers sharing the GPU, the render nodes are not exclusive.
+	gpuShares = 8
+)
+
+// gpuAvailable returns if the VM has a GPU with a render node, as with the virtio-gpu device
+// of the Metal accelerated VM.
+func gpuAvailable(guest environment.GuestActions) bool {
+	return guest.RunQuiet("sh", "-c", "ls "+gpuDeviceDir+"/renderD* >/dev/null 2>&1") == nil
+}
+
+// installGPUDevicePlugin deploys the device plugin exposing the GPU of the VM to the pods
+// as GPUResource. The manifest is removed if disabled or if the VM has no GPU.
+func installGPUDevicePlugin(guest environment.GuestActions, a *cli.ActiveCommandChain, manifest, kubeletDir string, enabled bool) {
+	a.Add(func() error {
+		if !enabled || !gpuAvailable(guest) {
+			return guest.RunQuiet("sudo", "rm", "-f", manifest)
+		}
+
+		b, err := gpuDevicePluginManifest(kubeletDir)
+		if err != nil {
+			return err
+		}
+		if err := guest.Run("sudo", "mkdir", "-p", filepath.Dir(manifest)); err != nil {
+			return fmt.Errorf("error creating manifests dir: %w", err)
+		}
+		return guest.Write(manifest, b)
+	})
+}
+
+// gpuDevicePluginManifest returns the manifest of the generic device plugin, advertising the
+// render nodes of the VM as the GPU resource on each node.
+func gpuDevicePluginManifest(kubeletDir string) ([]byte, error) {
+	device, err := yaml.Marshal(map[string]any{
+		"name": gpuDeviceName,
+		"groups": []map[string]any{
+			{
+				"count": gpuShares,
+				"paths": []map[string]any{{"path": gpuDeviceDir + "/renderD*"}},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding GPU device: %w", err)
+	}
+
+	labels := map[string]any{"app.kubernetes.io/name": "colima-gpu-device-plugin"}
+	b, err := yaml.Marshal(map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "DaemonSet",
+		"metadata": map[string]any{
+			"name":      "colima-gpu-device-plugin",
+			"namespace": "kube-system",
+		},
+		"spec": map[string]any{
+			"selector": map[string]any{"matchLabels": labels},
+			"template": map[string]any{
+				"metadata": map[string]any{"labels": labels},
+				"spec": map[string]any{
+					"priorityClassName": "system-node-critical",
+					"tolerations":       []map[string]any{{"operator": "Exists"}},
+					"containers": []map[string]any{
+						{
+							"name":  "device-plugin",
+							"image": gpuDevicePluginImage,
+							"args":  []string{"--device", string(device)},
+							"resources": map[string]any{
+								"requests": map[string]any{"cpu": "10m", "memory": "16Mi"},
+								"limits":   map[string]any{"memory": "32Mi"},
+							},
+							"securityContext": map[string]any{"privileged": true},
+							"volumeMounts": []map[string]any{
+								{"name": "device-plugins", "mountPath": "/var/lib/kubelet/device-plugins"},
+								{"name": "dev", "mountPath": "/dev"},
+							},
+						},
+					},
+					"volumes": []map[string]any{
+						{"name": "device-plugins", "hostPath": map[string]any{"path": filepath.Join(kubeletDir, "device-plugins")}},
+						{"name": "dev", "hostPath": map[string]any{"path": "/dev"}},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding GPU device plugin: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,95 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+)
+
+const (
+	imageSyncService = "colima-image-sync"
+	imageSyncUnit    = "/etc/systemd/system/" + imageSyncService + ".service"
+	imageSyncScript  = "/usr/local/bin/" + imageSyncService
+)
+
+// imageSyncScriptBody imports the tagged images of docker into the containerd of k0s,
+// on startup and on each build, pull, load and tag. The synced images are recorded
+// to skip the unchanged images on the next startup.
+const imageSyncScriptBody = `#!/bin/sh
+synced=/var/lib/colima/image-sync
+mkdir -p "$(dirname "$synced")" && touch "$synced"
+
+sync_image() {
+  id="$(docker image inspect --format '{{.Id}}' "$1" 2>/dev/null)" || return
+  grep -qxF "$id $1" "$synced" && return
+  if docker save "$1" | k0s ctr -n k8s.io images import --all-platforms - >/dev/null; then
+    echo "$id $1" >>"$synced"
+    echo "synced $1"
+  else
+    echo "error syncing $1" >&2
+  fi
+}
+
+docker images --format '{{.Repository}}:{{.Tag}}' | grep -v '<none>' | while read -r image; do
+  sync_image "$image"
+done
+
+docker events --filter type=image --filter event=tag --filter event=pull --filter event=load \
+  --format '{{.Actor.Attributes.name}}' | while read -r image; do
+  sync_image "$image"
+done
+`
+
+// imageSyncUnitBody is the service of the image sync, started and stopped with k0s.
+const imageSyncUnitBody = `[Unit]
+Description=Sync docker images to the Kubernetes cluster
+After=docker.service ` + k0sService + `.service
+Requires=docker.service
+PartOf=` + k0sService + `.service
+
+[Service]
+ExecStart=` + imageSyncScript + `
+Restart=always
+RestartSec=5
+
+[Install]
+WantedBy=` + k0sService + `.service
+`
+
+// installImageSync installs the service syncing the images of the docker runtime to the
+// containerd of k0s, k0s has no support for the docker runtime. The service is removed if disabled.
+func installImageSync(guest environment.GuestActions, a *cli.ActiveCommandChain, enabled bool) {
+	if !enabled {
+		a.Add(func() error { return removeImageSync(guest) })
+		return
+	}
+
+	a.Add(func() error {
+		if err := guest.Write(imageSyncScript, []byte(imageSyncScriptBody)); err != nil {
+			return fmt.Errorf("error writing image sync script: %w", err)
+		}
+		return guest.Run("sudo", "chmod", "755", imageSyncScript)
+	})
+	a.Add(func() error {
+		if err := guest.Write(imageSyncUnit, []byte(imageSyncUnitBody)); err != nil {
+			return fmt.Errorf("error writing image sync service: %w", err)
+		}
+		if err := guest.Run("sudo", "systemctl", "daemon-reload"); err != nil {
+			return err
+		}
+		return guest.Run("sudo", "systemctl", "enable", imageSyncService)
+	})
+}
+
+// removeImageSync removes the image sync service, if installed.
+func removeImageSync(guest environment.GuestActions) error {
+	if guest.RunQuiet("test", "-e", imageSyncUnit) != nil {
+		return nil
+	}
+	_ = guest.RunQuiet("sudo", "systemctl", "disable", "--now", imageSyncService)
+	if err := guest.RunQuiet("sudo", "rm", "-f", imageSyncUnit, imageSyncScript); err != nil {
+		return fmt.Errorf("error removing image sync service: %w", err)
+	}
+	return guest.RunQuiet("sudo", "systemctl", "daemon-reload")
+}
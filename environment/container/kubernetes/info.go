@@ -0,0 +1,120 @@
+package kubernetes
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/abiosoft/colima/config"
+)
+
+// Info is the information of the Kubernetes cluster.
+type Info struct {
+	Running    bool    `json:"running"`
+	Distro     string  `json:"distro"`
+	Version    string  `json:"version"`
+	Channel    string  `json:"channel,omitempty"`    // configured release channel, if any
+	Endpoint   string  `json:"endpoint,omitempty"`   // API server, empty for the agent nodes
+	Context    string  `json:"context,omitempty"`    // context of the kubeconfig on the host
+	Kubeconfig string  `json:"kubeconfig,omitempty"` // standalone kubeconfig on the host, empty if merged
+	Server     string  `json:"server,omitempty"`     // profile of the server, set for the agent nodes
+	Nodes      int     `json:"nodes"`
+	Addons     []Addon `json:"addons"`
+}
+
+// Addon is the status of an addon of the cluster.
+type Addon struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// Informer is implemented by the Kubernetes runtime for retrieving the information of the cluster.
+type Informer interface {
+	Info(ctx context.Context) (Info, error)
+}
+
+var _ Informer = (*kubernetesRuntime)(nil)
+
+// Info returns the information of the cluster.
+func (c *kubernetesRuntime) Info(ctx context.Context) (Info, error) {
+	conf := c.config()
+	d := c.distro()
+
+	info := Info{
+		Running: c.Running(ctx),
+		Distro:  d.Name(),
+		Version: d.installedVersion(),
+		Nodes:   max(conf.Nodes, 1),
+	}
+	if isChannel(conf.Version) {
+		info.Channel = conf.Version
+	}
+
+	// the API server and addons are of the server node
+	if conf.Agent() {
+		info.Server = conf.Server
+		return info, nil
+	}
+
+	if port, err := strconv.Atoi(c.guest.Get(listenPortKey)); err == nil && port > 0 {
+		address := c.guest.Get(masterAddressKey)
+		if address == "" {
+			address = "127.0.0.1"
+		}
+		info.Endpoint = "https://" + net.JoinHostPort(address, strconv.Itoa(port))
+	}
+	if c.guest.Get(masterAddressKey) != "" || c.guest.Get(kubeconfigContextKey) != "" {
+		info.Context = c.contextName()
+		info.Kubeconfig = c.guest.Get(kubeconfigFileKey)
+	}
+
+	cni := Addon{Name: "cni", Detail: cniPlugin(conf)}
+	cni.Enabled = cni.Detail != CNINone
+	registry := Addon{Name: "registry", Enabled: conf.Registry.Enabled}
+	if registry.Enabled {
+		registry.Detail = "localhost:" + strconv.Itoa(conf.Registry.PortOrDefault())
+	}
+	ingress := Addon{Name: "ingress", Detail: ingressController(conf)}
+	ingress.Enabled = ingress.Detail != IngressNone
+	loadBalancer := Addon{Name: "loadBalancer", Detail: conf.LoadBalancerCIDR()}
+	loadBalancer.Enabled = loadBalancer.Detail != ""
+
+	dashboard := Addon{Name: "dashboard"}
+	if _, ok := dashboards[conf.Dashboard]; ok {
+		dashboard.Enabled = true
+		dashboard.Detail = conf.Dashboard
+	}
+
+	gpu := Addon{Name: "gpu"}
+	if conf.GPUEnabled() && gpuAvailable(c.guest) {
+		gpu.Enabled = true
+		gpu.Detail = GPUResource
+	}
+
+	info.Addons = []Addon{cni, registry, ingress, loadBalancer, dashboard, gpu}
+	return info, nil
+}
+
+// ingressController returns the ingress controller of the cluster for conf.
+// The bundled traefik of k3s is enabled unless disabled in the k3s args.
+func ingressController(conf config.Kubernetes) string {
+	switch {
+	case conf.Ingress != "":
+		return conf.Ingress
+	case conf.Distro == K0s, k3sDisabled(conf.K3sArgs, "traefik"):
+		return IngressNone
+	}
+	return IngressTraefik
+}
+
+// cniPlugin returns the CNI plugin of the cluster for conf, the default of the distribution if unset.
+func cniPlugin(conf config.Kubernetes) string {
+	switch {
+	case conf.CNI != "":
+		return conf.CNI
+	case conf.Distro == K0s:
+		return "kube-router"
+	}
+	return CNIFlannel
+}
@@ -0,0 +1,174 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+	"gopkg.in/yaml.v3"
+)
+
+// Ingress controllers.
+const (
+	IngressTraefik = "traefik"
+	IngressNginx   = "nginx"
+	IngressNone    = "none"
+)
+
+// ingressManifest is the manifest of the ingress controller chart, auto-deployed by k3s.
+const ingressManifest = "/var/lib/rancher/k3s/server/manifests/colima-ingress.yaml"
+
+// helmChart is a helm chart deployed by the helm controller of k3s or the helm extensions of k0s.
+type helmChart struct {
+	Name      string
+	Repo      string
+	Namespace string
+	Values    string
+	Bootstrap bool // required to bootstrap the cluster e.g. the CNI plugin, installed before the nodes are ready
+}
+
+// ingressCharts are the charts of the ingress controllers. The controller listens on
+// the ports 80 and 443 of the node, forwarded to the host or reachable on the VM IP address.
+var ingressCharts = map[string]helmChart{
+	IngressNginx: {
+		Name:      "ingress-nginx",
+		Repo:      "https://kubernetes.github.io/ingress-nginx",
+		Namespace: "ingress-nginx",
+		Values: `controller:
+  kind: DaemonSet
+  hostPort:
+    enabled: true
+  service:
+    type: ClusterIP
+  ingressClassResource:
+    default: true
+`,
+	},
+	IngressTraefik: {
+		Name:      "traefik",
+		Repo:      "https://traefik.github.io/charts",
+		Namespace: "traefik",
+		Values: `ports:
+  web:
+    hostPort: 80
+  websecure:
+    hostPort: 443
+service:
+  type: ClusterIP
+ingressClass:
+  isDefaultClass: true
+`,
+	},
+}
+
+// installK3sIngress deploys the chart of the ingress controller not bundled with k3s.
+// The manifest is removed for the bundled traefik or no ingress controller.
+func installK3sIngress(guest environment.GuestActions, a *cli.ActiveCommandChain, ingress string) {
+	a.Add(func() error {
+		if ingress != IngressNginx {
+			return guest.RunQuiet("sudo", "rm", "-f", ingressManifest)
+		}
+
+		manifest, err := k3sHelmChart(ingressCharts[ingress])
+		if err != nil {
+			return err
+		}
+		return guest.Write(ingressManifest, manifest)
+	})
+}
+
+// k3sHelmChart returns the HelmChart manifest of the chart for the helm controller of k3s.
+func k3sHelmChart(chart helmChart) ([]byte, error) {
+	spec := map[string]any{
+		"repo":            chart.Repo,
+		"chart":           chart.Name,
+		"targetNamespace": chart.Namespace,
+		"createNamespace": true,
+		"valuesContent":   chart.Values,
+	}
+	if chart.Bootstrap {
+		// the install job runs on the host network
+		spec["bootstrap"] = true
+	}
+	b, err := yaml.Marshal(map[string]any{
+		"apiVersion": "helm.cattle.io/v1",
+		"kind":       "HelmChart",
+		"metadata": map[string]any{
+			"name":      chart.Name,
+			"namespace": "kube-system",
+		},
+		"spec": spec,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s chart: %w", chart.Name, err)
+	}
+	return b, nil
+}
+
+// k0sHelmExtensions returns the helm extensions of the k0s config for the charts, nil if none.
+func k0sHelmExtensions(charts ...helmChart) map[string]any {
+	if len(charts) == 0 {
+		return nil
+	}
+	var repositories, releases []map[string]any
+	for _, chart := range charts {
+		repositories = append(repositories, map[string]any{"name": chart.Name, "url": chart.Repo})
+		releases = append(releases, map[string]any{
+			"name":      chart.Name,
+			"chartname": chart.Name + "/" + chart.Name,
+			"namespace": chart.Namespace,
+			"values":    chart.Values,
+		})
+	}
+	return map[string]any{
+		"repositories": repositories,
+		"charts":       releases,
+	}
+}
+
+// k3sDisabled returns if the component is disabled in the k3s args.
+func k3sDisabled(args []string, component string) bool {
+	for _, arg := range args {
+		if val, ok := disableArgValue(arg); ok {
+			for _, c := range strings.Split(val, ",") {
+				if strings.TrimSpace(c) == component {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// k3sEnabled returns the k3s args without the component disabled.
+func k3sEnabled(args []string, component string) []string {
+	var enabled []string
+	for _, arg := range args {
+		val, ok := disableArgValue(arg)
+		if !ok {
+			enabled = append(enabled, arg)
+			continue
+		}
+		var components []string
+		for _, c := range strings.Split(val, ",") {
+			if c = strings.TrimSpace(c); c != component {
+				components = append(components, c)
+			}
+		}
+		if len(components) > 0 {
+			enabled = append(enabled, "--disable="+strings.Join(components, ","))
+		}
+	}
+	return enabled
+}
+
+// disableArgValue returns the value of the k3s --disable arg.
+func disableArgValue(arg string) (string, bool) {
+	for _, sep := range []string{"=", " "} {
+		if val, ok := strings.CutPrefix(arg, "--disable"+sep); ok {
+			return strings.TrimSpace(val), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,394 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util/downloader"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// K0sDefaultVersion is the default version of k0s.
+const K0sDefaultVersion = "v1.33.3+k0s.0"
+
+const (
+	// k0sConfigFile is the cluster config in the VM.
+	k0sConfigFile = "/etc/k0s/k0s.yaml"
+	// k0sService is the service of the k0s controller.
+	k0sService = "k0scontroller"
+	// k0sKubectlFile is the kubectl wrapper in the VM, k0s does not install kubectl.
+	k0sKubectlFile = "/usr/local/bin/kubectl"
+	// k0sKubeconfigFile is the admin kubeconfig in the VM.
+	k0sKubeconfigFile = k0sPKIDir + "/admin.conf"
+	// k0sPKIDir is the dir of the certificates in the VM.
+	k0sPKIDir = "/var/lib/k0s/pki"
+)
+
+var _ distro = k0s{}
+
+// k0s is the k0s distribution, a single node controller with the worker enabled.
+type k0s struct {
+	host  environment.HostActions
+	guest environment.GuestActions
+}
+
+func (k k0s) Name() string { return K0s }
+
+func (k k0s) version(version string) string {
+	switch {
+	case version == "" || strings.Contains(version, "+"+K3s):
+		return K0sDefaultVersion
+	case !strings.Contains(version, "+"+K0s):
+		return version + "+k0s.0"
+	}
+	return version
+}
+
+func (k k0s) channelVersion(channel string) (string, error) {
+	switch channel {
+	case "stable", "latest":
+	default:
+		return "", fmt.Errorf("k0s channel '%s' not supported, use stable or latest", channel)
+	}
+	out, err := k.host.RunOutput("curl", "-fsSL", "https://docs.k0sproject.io/"+channel+".txt")
+	if err != nil {
+		return "", fmt.Errorf("error resolving k0s channel '%s': %w", channel, err)
+	}
+	return k.version(strings.TrimSpace(out)), nil
+}
+
+func (k k0s) installed() bool {
+	return k.guest.RunQuiet("test", "-e", "/etc/systemd/system/"+k0sService+".service") == nil
+}
+
+func (k k0s) installedVersion() string {
+	out, err := k.guest.RunOutput("k0s", "version")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+func (k k0s) versionInstalled(version string) bool {
+	return k.installedVersion() == version
+}
+
+func (k k0s) service() string { return k0sService }
+
+func (k k0s) running() bool {
+	return k.guest.RunQuiet("sudo", "service", k0sService, "status") == nil
+}
+
+func (k k0s) provision(a *cli.ActiveCommandChain, log *logrus.Entry, p provisionArgs) {
+	conf := p.conf
+
+	if !k.versionInstalled(conf.Version) {
+		if k.installed() {
+			a.Stagef("version changed to %s, downloading and installing", conf.Version)
+		} else {
+			a.Stage("downloading and installing")
+		}
+		installK0sBinary(k.host, k.guest, a, conf.Version)
+	}
+
+	var address, ipv6Address string
+	a.Retry("waiting for VM IP address", time.Second*5, 4, func(int) error {
+		address = limautil.IPAddress(config.CurrentProfile().ID)
+		if address == "" {
+			return fmt.Errorf("no IP address assigned to network interface")
+		}
+		// the default route address is used without a reachable address
+		if address == "127.0.0.1" {
+			address = ""
+		}
+		if address != "" && p.ipv6 {
+			ipv6Address = limautil.IPv6Address(config.CurrentProfile().ID, limautil.NetInterface)
+			if ipv6Address == "" {
+				a.Logger().Warnln("no IP address assigned to network interface, Kubernetes dual-stack disabled")
+			}
+		}
+		return nil
+	})
+
+	a.Add(func() error {
+		port, err := getPortNumber(k.guest)
+		if err != nil {
+			return err
+		}
+		b, err := k0sConfig(conf, address, ipv6Address, port)
+		if err != nil {
+			return err
+		}
+		if err := k.guest.Run("sudo", "mkdir", "-p", "/etc/k0s"); err != nil {
+			return fmt.Errorf("error creating k0s config dir: %w", err)
+		}
+		return k.guest.Write(k0sConfigFile, b)
+	})
+
+	args := []string{"sudo", "k0s", "install", "controller", "--single", "--force", "--config", k0sConfigFile}
+	switch p.runtime {
+	case containerd.Name:
+		args = append(args, "--cri-socket", "remote:unix:///run/containerd/containerd.sock")
+	default:
+		// the containerd of docker has no CRI, the embedded containerd is used
+		if !conf.ImageSyncEnabled() {
+			log.Warnln("k0s uses its own containerd, images of the docker runtime are not available to the cluster")
+		}
+	}
+	for key, val := range p.proxies.Env() {
+		args = append(args, "--env", key+"="+val)
+	}
+	// node topology, applied when the node is registered
+	if labels := nodeLabels(conf.NodeLabels); len(labels) > 0 {
+		args = append(args, "--labels", strings.Join(labels, ","))
+	}
+	if len(conf.NodeTaints) > 0 {
+		args = append(args, "--taints", strings.Join(conf.NodeTaints, ","))
+	}
+	a.Add(func() error {
+		var kubelet []string
+		for _, arg := range kubeletArgs(conf.KubeletArgs) {
+			kubelet = append(kubelet, "--"+arg)
+		}
+		if address != "" {
+			nodeIP := address
+			if ipv6Address != "" {
+				nodeIP += "," + ipv6Address
+			}
+			kubelet = append(kubelet, "--node-ip="+nodeIP)
+		}
+		if len(kubelet) == 0 {
+			return k.guest.Run(args...)
+		}
+		return k.guest.Run(append(args, "--kubelet-extra-args", strings.Join(kubelet, " "))...)
+	})
+
+	// the flannel config of a previous k3s cluster takes precedence over kube-router
+	a.Add(func() error {
+		return k.guest.RunQuiet("sudo", "rm", "-f", flannelConfFile)
+	})
+
+	// kubectl for the guest, as provided by k3s
+	a.Add(func() error {
+		return k.guest.Write(k0sKubectlFile, []byte("#!/bin/sh\nexec sudo k0s kubectl \"$@\"\n"))
+	})
+	a.Add(func() error {
+		return k.guest.Run("sudo", "chmod", "755", k0sKubectlFile)
+	})
+
+	installK0sLoadBalancer(k.guest, a, conf.LoadBalancerCIDR())
+	installK0sDashboard(k.guest, a, conf.Dashboard)
+	installGPUDevicePlugin(k.guest, a, k0sGPUManifest, k0sKubeletDir, conf.GPUEnabled())
+	if p.configured {
+		installRuntimeClasses(k.guest, a, k0sWasmManifest, p.wasmShims)
+		removeSysboxRuntimeClass(k.guest, a, k0sSysboxManifest)
+	}
+
+	// images of the docker runtime for the embedded containerd
+	installImageSync(k.guest, a, p.runtime == docker.Name && conf.ImageSyncEnabled())
+
+	if p.configured && len(p.dnsDomains) > 0 {
+		log.Warnln("network.dnsDomains are not forwarded by the CoreDNS of k0s")
+	}
+}
+
+func (k k0s) start() error {
+	return k.guest.Run("sudo", "service", k0sService, "start")
+}
+
+func (k k0s) stop() error {
+	return k.guest.Run("sudo", "k0s", "stop")
+}
+
+func (k k0s) uninstall() error {
+	// the cluster must be stopped for the reset
+	_ = k.guest.RunQuiet("sudo", "k0s", "stop")
+	if err := k.guest.Run("sudo", "k0s", "reset", "--config", k0sConfigFile); err != nil {
+		return err
+	}
+	if err := removeImageSync(k.guest); err != nil {
+		return err
+	}
+	return k.guest.RunQuiet("sudo", "rm", "-f", k0sKubectlFile)
+}
+
+func (k k0s) kubeconfig() (string, error) {
+	port, err := getPortNumber(k.guest)
+	if err != nil {
+		return "", err
+	}
+	kubeconfig, err := k.guest.RunOutput("sudo", "k0s", "kubeconfig", "admin")
+	if err != nil {
+		return "", err
+	}
+	return k0sKubeconfig(kubeconfig, port)
+}
+
+func (k k0s) kubeconfigFile() string { return k0sKubeconfigFile }
+
+func (k k0s) certDirs() []string { return []string{k0sPKIDir} }
+
+func (k k0s) rotateCerts() error {
+	// k0s has no rotate command, the removed certificates are regenerated on startup.
+	// The certificate authorities and the service account keys are kept.
+	script := `find ` + k0sPKIDir + ` -name '*.crt' ! -name 'ca.crt' ! -name '*-ca.crt' | while read -r f; do rm -f "$f" "${f%.crt}.key"; done`
+	return k.guest.Run("sudo", "sh", "-c", script)
+}
+
+func (k k0s) dataDirs() []string {
+	// the SQLite datastore, certificates and manifests
+	return []string{"/var/lib/k0s/db", "/var/lib/k0s/pki", "/var/lib/k0s/manifests"}
+}
+
+func installK0sBinary(
+	host environment.HostActions,
+	guest environment.GuestActions,
+	a *cli.ActiveCommandChain,
+	k0sVersion string,
+) {
+	downloadPath := "/tmp/k0s"
+
+	baseURL := "https://github.com/k0sproject/k0s/releases/download/" + k0sVersion + "/"
+	url := baseURL + "k0s-" + k0sVersion + "-" + guest.Arch().GoArch()
+	shaURL := baseURL + "sha256sums.txt"
+	a.Add(func() error {
+		r := downloader.Request{
+			URL: url,
+			SHA: &downloader.SHA{Size: 256, URL: shaURL},
+		}
+		return downloader.DownloadToGuest(host, guest, r, downloadPath)
+	})
+	a.Add(func() error {
+		return guest.Run("sudo", "install", downloadPath, "/usr/local/bin/k0s")
+	})
+}
+
+// k0sConfig returns the k0s cluster config with the API server on the listen port, the CNI plugin,
+// the ingress controller and the load balancer.
+// The Pod and Service networks default to the networks of k3s, assumed by the routes and proxy settings.
+func k0sConfig(conf config.Kubernetes, address, ipv6Address string, port int) ([]byte, error) {
+	api := map[string]any{"port": port}
+	// the serving certificate of the API server is regenerated on startup for changed SANs
+	var sans []string
+	if address != "" {
+		api["address"] = address
+		sans = append(sans, address, "127.0.0.1")
+		if ipv6Address != "" {
+			sans = append(sans, ipv6Address)
+		}
+	}
+	if sans = append(sans, conf.TLSSANs...); len(sans) > 0 {
+		api["sans"] = sans
+	}
+
+	podCIDR, serviceCIDR := "10.42.0.0/16", "10.43.0.0/16"
+	if conf.PodCIDR != "" {
+		podCIDR = conf.PodCIDR
+	}
+	if conf.ServiceCIDR != "" {
+		serviceCIDR = conf.ServiceCIDR
+	}
+	network := map[string]any{
+		"podCIDR":     podCIDR,
+		"serviceCIDR": serviceCIDR,
+	}
+	if ipv6Address != "" {
+		network["dualStack"] = map[string]any{
+			"enabled":         true,
+			"IPv6podCIDR":     ipv6PodCIDR,
+			"IPv6serviceCIDR": ipv6ServiceCIDR,
+		}
+	}
+
+	var charts []helmChart
+	// kube-router is the k0s default, calico is bundled with k0s
+	switch conf.CNI {
+	case CNICalico:
+		network["provider"] = "calico"
+		network["calico"] = map[string]any{"mode": "vxlan"}
+	case CNICilium, CNINone:
+		network["provider"] = "custom"
+		cidrs := strings.Split(podCIDR, ",")
+		if ipv6Address != "" {
+			cidrs = append(cidrs, ipv6PodCIDR)
+		}
+		chart, ok, err := cniChart(conf.CNI, cidrs, 0)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			charts = append(charts, chart)
+		}
+	}
+
+	spec := map[string]any{
+		"api":     api,
+		"network": network,
+	}
+	if chart, ok := ingressCharts[conf.Ingress]; ok {
+		charts = append(charts, chart)
+	}
+	if conf.LoadBalancerCIDR() != "" {
+		charts = append(charts, metalLBChart)
+	}
+	if d, ok := dashboards[conf.Dashboard]; ok {
+		charts = append(charts, d.chart)
+	}
+	if helm := k0sHelmExtensions(charts...); helm != nil {
+		spec["extensions"] = map[string]any{"helm": helm}
+	}
+
+	b, err := yaml.Marshal(map[string]any{
+		"apiVersion": "k0s.k0sproject.io/v1beta1",
+		"kind":       "ClusterConfig",
+		"metadata":   map[string]any{"name": "k0s"},
+		"spec":       spec,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding k0s config: %w", err)
+	}
+	return b, nil
+}
+
+// k0sKubeconfig returns the admin kubeconfig of k0s with the cluster, context and user
+// named default and the server on 127.0.0.1 at the listen port, as the kubeconfig of k3s.
+func k0sKubeconfig(kubeconfig string, port int) (string, error) {
+	var conf map[string]any
+	if err := yaml.Unmarshal([]byte(kubeconfig), &conf); err != nil {
+		return "", fmt.Errorf("error parsing k0s kubeconfig: %w", err)
+	}
+
+	for _, key := range []string{"clusters", "contexts", "users"} {
+		items, _ := conf[key].([]any)
+		for _, item := range items {
+			entry, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			entry["name"] = "default"
+			if cluster, ok := entry["cluster"].(map[string]any); ok {
+				cluster["server"] = "https://127.0.0.1:" + strconv.Itoa(port)
+			}
+			if context, ok := entry["context"].(map[string]any); ok {
+				context["cluster"], context["user"] = "default", "default"
+				delete(context, "namespace")
+			}
+		}
+	}
+	conf["current-context"] = "default"
+
+	b, err := yaml.Marshal(conf)
+	if err != nil {
+		return "", fmt.Errorf("error encoding k0s kubeconfig: %w", err)
+	}
+	return string(b), nil
+}
@@ -2,6 +2,8 @@ package kubernetes
 
 import (
 	"fmt"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -14,11 +16,306 @@ import (
 	"github.com/abiosoft/colima/environment/vm/lima/limautil"
 	"github.com/abiosoft/colima/util"
 	"github.com/abiosoft/colima/util/downloader"
+	"github.com/abiosoft/colima/util/proxy"
 	"github.com/sirupsen/logrus"
 )
 
 const listenPortKey = "k3s_listen_port"
 
+var _ distro = k3s{}
+
+// k3s is the k3s distribution, the server or an agent of the server of another profile.
+type k3s struct {
+	host  environment.HostActions
+	guest environment.GuestActions
+	agent bool
+}
+
+func (k k3s) Name() string { return K3s }
+
+func (k k3s) version(version string) string {
+	if version == "" || strings.Contains(version, "+"+K0s) {
+		return DefaultVersion
+	}
+	return version
+}
+
+func (k k3s) channelVersion(channel string) (string, error) {
+	// the channels of the minor versions are prefixed with v e.g. v1.29
+	if channel[0] >= '0' && channel[0] <= '9' {
+		channel = "v" + channel
+	}
+	// the channel redirects to the release of the version
+	url := "https://update.k3s.io/v1-release/channels/" + channel
+	out, err := k.host.RunOutput("curl", "-fsSL", "-o", "/dev/null", "-w", "%{url_effective}", url)
+	if err != nil {
+		return "", fmt.Errorf("error resolving k3s channel '%s': %w", channel, err)
+	}
+	version := path.Base(strings.TrimSpace(out))
+	if !strings.Contains(version, "+"+K3s) {
+		return "", fmt.Errorf("error resolving k3s channel '%s': unexpected release '%s'", channel, version)
+	}
+	return version, nil
+}
+
+// service returns the k3s service, k3s-agent for the agent nodes.
+func (k k3s) service() string {
+	if k.agent {
+		return agentService
+	}
+	return "k3s"
+}
+
+func (k k3s) installed() bool {
+	// it is installed if uninstall script is present.
+	return k.guest.RunQuiet("command", "-v", k.service()+"-uninstall.sh") == nil
+}
+
+func (k k3s) installedVersion() string {
+	// k3s version v1.33.3+k3s1 (...)
+	out, err := k.guest.RunOutput("k3s", "--version")
+	if fields := strings.Fields(out); err == nil && len(fields) >= 3 {
+		return fields[2]
+	}
+	return ""
+}
+
+func (k k3s) versionInstalled(version string) bool {
+	// validate version change via cli flag/config.
+	out, err := k.guest.RunOutput("k3s", "--version")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(out, version)
+}
+
+func (k k3s) running() bool {
+	return k.guest.RunQuiet("sudo", "service", k.service(), "status") == nil
+}
+
+func (k k3s) provision(a *cli.ActiveCommandChain, log *logrus.Entry, p provisionArgs) {
+	conf := p.conf
+	airgap := conf.Airgap.Expanded()
+
+	// agent node of the k3s server of another profile
+	if conf.Agent() {
+		if !k.versionInstalled(conf.Version) {
+			a.Stage("downloading and installing")
+			installK3sBinary(k.host, k.guest, a, conf.Version, airgap)
+			installK3sCache(k.host, k.guest, a, log, p.runtime, conf.Version, airgap)
+		}
+		a.Stagef("joining server profile '%s'", conf.Server)
+		installK3sAgent(k.host, k.guest, a, p.runtime, conf.Version, airgap, conf.Server, p.proxies, conf.KubeletArgs)
+		installCniConfig(k.guest, a, conf.CNI, p.mtu)
+		return
+	}
+
+	// the files referenced by the API server args must exist before k3s is started by the install
+	if p.configured {
+		installK3sSecurity(k.guest, a, conf)
+	}
+
+	multiNode := conf.Nodes > 1
+	if k.versionInstalled(conf.Version) {
+		// runtime has changed, ensure the required images are in the registry
+		if p.currentRuntime != "" && p.currentRuntime != p.runtime {
+			a.Stagef("changing runtime to %s", p.runtime)
+			installK3sCache(k.host, k.guest, a, log, p.runtime, conf.Version, airgap)
+		}
+		// other settings may have changed e.g. ingress
+		installK3sCluster(k.host, k.guest, a, p.runtime, conf.Version, airgap, k3sArgs(conf), p.proxies, p.ipv6, multiNode, conf.Lazy)
+	} else {
+		if k.installed() {
+			a.Stagef("version changed to %s, downloading and installing", conf.Version)
+		} else {
+			if p.configured {
+				a.Stage("downloading and installing")
+			} else {
+				a.Stage("installing")
+			}
+		}
+		installK3s(k.host, k.guest, a, log, p.runtime, conf.Version, airgap, k3sArgs(conf), p.proxies, p.ipv6, multiNode, conf.Lazy)
+	}
+	installK3sLazy(k.guest, a, conf.Lazy)
+
+	// this needs to happen on each startup
+	{
+		// cni is used by both cri-dockerd and containerd
+		installCniConfig(k.guest, a, conf.CNI, p.mtu)
+	}
+
+	// CNI plugin, split DNS, ingress controller, load balancer, dashboard, GPU device plugin,
+	// WebAssembly RuntimeClasses for the cluster
+	if p.configured {
+		installK3sCNI(k.guest, a, conf, p.ipv6, p.mtu)
+		installCoreDNSForwarders(k.guest, a, p.dnsDomains)
+		installK3sIngress(k.guest, a, conf.Ingress)
+		installK3sLoadBalancer(k.guest, a, conf.LoadBalancerCIDR())
+		installK3sDashboard(k.guest, a, conf.Dashboard)
+		installGPUDevicePlugin(k.guest, a, k3sGPUManifest, k3sKubeletDir, conf.GPUEnabled())
+		installRuntimeClasses(k.guest, a, k3sWasmManifest, p.wasmShims)
+		removeSysboxRuntimeClass(k.guest, a, k3sSysboxManifest)
+	}
+}
+
+func (k k3s) start() error {
+	return k.guest.Run("sudo", "service", k.service(), "start")
+}
+
+func (k k3s) stop() error {
+	return k.guest.Run("k3s-killall.sh")
+}
+
+func (k k3s) uninstall() error {
+	return k.guest.Run(k.service() + "-uninstall.sh")
+}
+
+func (k k3s) kubeconfig() (string, error) {
+	return k.guest.Read(serverKubeconfigFile)
+}
+
+func (k k3s) kubeconfigFile() string { return serverKubeconfigFile }
+
+func (k k3s) certDirs() []string {
+	if k.agent {
+		return []string{"/var/lib/rancher/k3s/agent"}
+	}
+	return []string{"/var/lib/rancher/k3s/server/tls", "/var/lib/rancher/k3s/agent"}
+}
+
+func (k k3s) rotateCerts() error {
+	// the certificates of the agent are renewed by the server on startup
+	if k.agent {
+		return nil
+	}
+	return k.guest.Run("sudo", "k3s", "certificate", "rotate")
+}
+
+func (k k3s) dataDirs() []string {
+	// the SQLite datastore, certificates and token of the server, and the local-path volumes
+	return []string{"/var/lib/rancher/k3s/server", "/var/lib/rancher/k3s/storage"}
+}
+
+// k3sArgs returns the k3s args for conf, including the configured network CIDRs, CNI plugin,
+// node topology, certificate SANs, ingress controller, load balancer, dashboard and API server security.
+// Explicitly passed k3s args take precedence.
+func k3sArgs(conf config.Kubernetes) []string {
+	args := append([]string{}, conf.K3sArgs...)
+	if conf.PodCIDR != "" && !hasK3sArg(args, "--cluster-cidr") {
+		args = append(args, "--cluster-cidr="+conf.PodCIDR)
+	}
+	if conf.ServiceCIDR != "" && !hasK3sArg(args, "--service-cidr") {
+		args = append(args, "--service-cidr="+conf.ServiceCIDR)
+	}
+	// the bundled traefik is the traefik ingress controller
+	switch conf.Ingress {
+	case IngressTraefik:
+		args = k3sEnabled(args, "traefik")
+	case IngressNginx, IngressNone:
+		if !k3sDisabled(args, "traefik") {
+			args = append(args, "--disable=traefik")
+		}
+	}
+	// the CNI plugin replaces flannel and enforces the network policies
+	if !flannelEnabled(conf.CNI) {
+		if !hasK3sArg(args, "--flannel-backend") {
+			args = append(args, "--flannel-backend=none")
+		}
+		if !hasK3sArg(args, "--disable-network-policy") {
+			args = append(args, "--disable-network-policy")
+		}
+	}
+	// node topology, the labels and taints are of the server node
+	for _, label := range nodeLabels(conf.NodeLabels) {
+		args = append(args, "--node-label="+label)
+	}
+	for _, taint := range conf.NodeTaints {
+		args = append(args, "--node-taint="+taint)
+	}
+	for _, arg := range kubeletArgs(conf.KubeletArgs) {
+		args = append(args, "--kubelet-arg="+arg)
+	}
+	// the serving certificate of the API server is extended with the SANs on startup
+	for _, san := range conf.TLSSANs {
+		args = append(args, "--tls-san="+san)
+	}
+	// the metrics of the dashboard are provided by the bundled metrics-server
+	if _, ok := dashboards[conf.Dashboard]; ok {
+		args = k3sEnabled(args, "metrics-server")
+	}
+	// the LoadBalancer IPs are allocated by MetalLB
+	if conf.LoadBalancerCIDR() != "" && !k3sDisabled(args, "servicelb") {
+		args = append(args, "--disable=servicelb")
+	}
+	// audit logging and Pod Security Admission defaults of the API server
+	args = append(args, securityK3sArgs(conf)...)
+	return args
+}
+
+// IPv6 networks of the dual-stack cluster.
+const (
+	ipv6PodCIDR     = "fd00:42::/56"
+	ipv6ServiceCIDR = "fd00:43::/112"
+)
+
+// dualStackK3sArgs returns the k3s args with the IPv6 Pod and Service networks appended
+// to the IPv4 networks, and the node IP addresses of both address families.
+func dualStackK3sArgs(args []string, nodeIPv4, nodeIPv6 string) []string {
+	args = append([]string{}, args...)
+	for _, n := range []struct{ arg, ipv4, ipv6 string }{
+		{arg: "--cluster-cidr", ipv4: "10.42.0.0/16", ipv6: ipv6PodCIDR},
+		{arg: "--service-cidr", ipv4: "10.43.0.0/16", ipv6: ipv6ServiceCIDR},
+	} {
+		i, val, ok := k3sArgIndex(args, n.arg)
+		switch {
+		case !ok:
+			args = append(args, n.arg+"="+n.ipv4+","+n.ipv6)
+		case i < 0:
+			// set in another form, left as is
+		case !strings.Contains(val, ":"):
+			args[i] = n.arg + "=" + val + "," + n.ipv6
+		}
+	}
+	if !hasK3sArg(args, "--node-ip") {
+		args = append(args, "--node-ip="+nodeIPv4+","+nodeIPv6)
+	}
+	if !hasK3sArg(args, "--flannel-ipv6-masq") {
+		args = append(args, "--flannel-ipv6-masq")
+	}
+	return args
+}
+
+// multiNodeK3sArgs returns the k3s server args for a multi-node cluster. The server is advertised
+// on the user-v2 network address, reachable from the agent nodes, and the reachable address
+// remains valid for the kubeconfig on the host.
+func multiNodeK3sArgs(args []string, userNetIP, ipAddress string) []string {
+	args = append([]string{}, args...)
+	if !hasK3sArg(args, "--node-ip") {
+		args = append(args, "--node-ip", userNetIP)
+	}
+	if !hasK3sArg(args, "--advertise-address") {
+		args = append(args, "--advertise-address", userNetIP)
+	}
+	if !hasK3sArg(args, "--flannel-iface") {
+		args = append(args, "--flannel-iface", limautil.UserNetInterface)
+	}
+	if ipAddress != "127.0.0.1" && ipAddress != userNetIP {
+		args = append(args, "--tls-san", ipAddress)
+	}
+	return args
+}
+
+// k3sArgIndex returns the index and the value of the k3s arg set as --arg=value,
+// the index is -1 if the arg is set in another form.
+func k3sArgIndex(k3sArgs []string, argName string) (int, string, bool) {
+	for i, arg := range k3sArgs {
+		if val, ok := strings.CutPrefix(arg, argName+"="); ok {
+			return i, val, true
+		}
+	}
+	return -1, "", hasK3sArg(k3sArgs, argName)
+}
+
 func hasK3sArg(k3sArgs []string, argName string) bool {
 	for _, arg := range k3sArgs {
 		if strings.HasPrefix(arg, argName+"=") {
@@ -40,11 +337,16 @@ func installK3s(host environment.HostActions,
 	log *logrus.Entry,
 	containerRuntime string,
 	k3sVersion string,
+	airgap config.KubernetesAirgap,
 	disable []string,
+	proxies proxy.Settings,
+	ipv6 bool,
+	multiNode bool,
+	lazy bool,
 ) {
-	installK3sBinary(host, guest, a, k3sVersion)
-	installK3sCache(host, guest, a, log, containerRuntime, k3sVersion)
-	installK3sCluster(host, guest, a, containerRuntime, k3sVersion, disable)
+	installK3sBinary(host, guest, a, k3sVersion, airgap)
+	installK3sCache(host, guest, a, log, containerRuntime, k3sVersion, airgap)
+	installK3sCluster(host, guest, a, containerRuntime, k3sVersion, airgap, disable, proxies, ipv6, multiNode, lazy)
 }
 
 func installK3sBinary(
@@ -52,8 +354,20 @@ func installK3sBinary(
 	guest environment.GuestActions,
 	a *cli.ActiveCommandChain,
 	k3sVersion string,
+	airgap config.KubernetesAirgap,
 ) {
 	downloadPath := "/tmp/k3s"
+	install := func() error {
+		return guest.Run("sudo", "install", downloadPath, "/usr/local/bin/k3s")
+	}
+
+	if airgap.Enabled() {
+		a.Add(func() error {
+			return downloader.CopyToGuest(host, guest, airgap.Binary, downloadPath)
+		})
+		a.Add(install)
+		return
+	}
 
 	baseURL := "https://github.com/k3s-io/k3s/releases/download/" + k3sVersion + "/"
 	shaSumTxt := "sha256sum-" + guest.Arch().GoArch() + ".txt"
@@ -70,8 +384,28 @@ func installK3sBinary(
 		}
 		return downloader.DownloadToGuest(host, guest, r, downloadPath)
 	})
+	a.Add(install)
+}
+
+// installK3sScript installs the k3s install script in the guest.
+func installK3sScript(
+	host environment.HostActions,
+	guest environment.GuestActions,
+	a *cli.ActiveCommandChain,
+	k3sVersion string,
+	airgap config.KubernetesAirgap,
+) {
+	downloadPath := "/tmp/k3s-install.sh"
+	url := "https://raw.githubusercontent.com/k3s-io/k3s/" + k3sVersion + "/install.sh"
 	a.Add(func() error {
-		return guest.Run("sudo", "install", downloadPath, "/usr/local/bin/k3s")
+		if airgap.Enabled() {
+			return downloader.CopyToGuest(host, guest, airgap.Script, downloadPath)
+		}
+		r := downloader.Request{URL: url}
+		return downloader.DownloadToGuest(host, guest, r, downloadPath)
+	})
+	a.Add(func() error {
+		return guest.Run("sudo", "install", downloadPath, "/usr/local/bin/k3s-install.sh")
 	})
 }
 
@@ -82,7 +416,28 @@ func installK3sCache(
 	log *logrus.Entry,
 	containerRuntime string,
 	k3sVersion string,
+	airgap config.KubernetesAirgap,
 ) {
+	airGapDir := "/var/lib/rancher/k3s/agent/images/"
+
+	// image tarballs on the host, k3s imports the compressed tarballs as well
+	if airgap.Enabled() {
+		a.Add(func() error {
+			return guest.Run("sudo", "mkdir", "-p", airGapDir)
+		})
+		for _, image := range airgap.Images {
+			downloadPath := "/tmp/" + filepath.Base(image)
+			a.Add(func() error {
+				return downloader.CopyToGuest(host, guest, image, downloadPath)
+			})
+			a.Add(func() error {
+				return guest.Run("sudo", "cp", downloadPath, airGapDir)
+			})
+			loadK3sImages(guest, a, log, containerRuntime, downloadPath)
+		}
+		return
+	}
+
 	baseURL := "https://github.com/k3s-io/k3s/releases/download/" + k3sVersion + "/"
 	imageTar := "k3s-airgap-images-" + guest.Arch().GoArch() + ".tar"
 	shaSumTxt := "sha256sum-" + guest.Arch().GoArch() + ".txt"
@@ -102,7 +457,6 @@ func installK3sCache(
 		return guest.Run("gzip", "-f", "-d", downloadPathTarGz)
 	})
 
-	airGapDir := "/var/lib/rancher/k3s/agent/images/"
 	a.Add(func() error {
 		return guest.Run("sudo", "mkdir", "-p", airGapDir)
 	})
@@ -110,13 +464,24 @@ func installK3sCache(
 		return guest.Run("sudo", "cp", downloadPathTar, airGapDir)
 	})
 
-	// load OCI images for K3s
-	// this can be safely ignored if failed as the images would be pulled afterwards.
+	loadK3sImages(guest, a, log, containerRuntime, downloadPathTar)
+}
+
+// loadK3sImages loads the OCI images of the tarball into the container runtime, k3s does not
+// import the images for an external runtime.
+// This can be safely ignored if failed as the images would be pulled afterwards.
+func loadK3sImages(
+	guest environment.GuestActions,
+	a *cli.ActiveCommandChain,
+	log *logrus.Entry,
+	containerRuntime string,
+	tarball string,
+) {
 	switch containerRuntime {
 	case containerd.Name:
 		a.Stage("loading oci images")
 		a.Add(func() error {
-			if err := guest.Run("sudo", "nerdctl", "-n", "k8s.io", "load", "-i", downloadPathTar, "--all-platforms"); err != nil {
+			if err := guest.Run("sudo", "nerdctl", "-n", "k8s.io", "load", "-i", tarball, "--all-platforms"); err != nil {
 				log.Warnln(fmt.Errorf("error loading oci images: %w", err))
 				log.Warnln("startup may delay a bit as images will be pulled from oci registry")
 			}
@@ -125,7 +490,7 @@ func installK3sCache(
 	case docker.Name:
 		a.Stage("loading oci images")
 		a.Add(func() error {
-			if err := guest.Run("sudo", "docker", "load", "-i", downloadPathTar); err != nil {
+			if err := guest.Run("sudo", "docker", "load", "-i", tarball); err != nil {
 				log.Warnln(fmt.Errorf("error loading oci images: %w", err))
 				log.Warnln("startup may delay a bit as images will be pulled from oci registry")
 			}
@@ -140,18 +505,15 @@ func installK3sCluster(
 	a *cli.ActiveCommandChain,
 	containerRuntime string,
 	k3sVersion string,
+	airgap config.KubernetesAirgap,
 	k3sArgs []string,
+	proxies proxy.Settings,
+	ipv6 bool,
+	multiNode bool,
+	lazy bool,
 ) {
 	// install k3s last to ensure it is the last step
-	downloadPath := "/tmp/k3s-install.sh"
-	url := "https://raw.githubusercontent.com/k3s-io/k3s/" + k3sVersion + "/install.sh"
-	a.Add(func() error {
-		r := downloader.Request{URL: url}
-		return downloader.DownloadToGuest(host, guest, r, downloadPath)
-	})
-	a.Add(func() error {
-		return guest.Run("sudo", "install", downloadPath, "/usr/local/bin/k3s-install.sh")
-	})
+	installK3sScript(host, guest, a, k3sVersion, airgap)
 
 	args := append([]string{
 		"--write-kubeconfig-mode", "644",
@@ -163,15 +525,39 @@ func installK3sCluster(
 			return fmt.Errorf("no IP address assigned to network interface")
 		}
 
+		// the nodes of a multi-node cluster are connected via the user-v2 network
+		if multiNode {
+			userNetIP := limautil.UserNetIPAddress(config.CurrentProfile().ID)
+			if userNetIP == "" {
+				return fmt.Errorf("no IP address assigned to the user-v2 network interface")
+			}
+			if ipv6 {
+				a.Logger().Warnln("Kubernetes dual-stack is not supported with multiple nodes")
+			}
+			args = multiNodeK3sArgs(args, userNetIP, ipAddress)
+			return nil
+		}
+
 		if ipAddress == "127.0.0.1" {
 			args = append(args, "--flannel-iface", "eth0")
 		} else {
 			if !hasK3sArg(k3sArgs, "--advertise-address") {
 				args = append(args, "--advertise-address", ipAddress)
 			}
+			// the kubeconfig on the host points to the reachable IP address, regardless of
+			// the advertised address
+			args = append(args, "--tls-san", ipAddress)
 			if !hasK3sArg(k3sArgs, "--flannel-iface") {
 				args = append(args, "--flannel-iface", limautil.NetInterface)
 			}
+			// dual-stack requires an IPv6 address on the node
+			if ipv6 {
+				if ipv6Address := limautil.IPv6Address(config.CurrentProfile().ID, limautil.NetInterface); ipv6Address != "" {
+					args = dualStackK3sArgs(args, ipAddress, ipv6Address)
+				} else {
+					a.Logger().Warnln("no IPv6 address assigned to network interface, Kubernetes dual-stack disabled")
+				}
+			}
 		}
 		return nil
 	})
@@ -188,12 +574,25 @@ func installK3sCluster(
 		if err != nil {
 			return err
 		}
+		// the port is of the socket starting the cluster on the first request, k3s listens on another port
+		if lazy {
+			if port, err = getLazyPortNumber(guest); err != nil {
+				return err
+			}
+		}
 		args = append(args, "--https-listen-port", strconv.Itoa(port))
 		return nil
 	})
 
+	// the installer persists the proxy environment variables for the k3s service,
+	// including the embedded containerd.
+	env := []string{"env"}
+	for k, v := range proxies.Env() {
+		env = append(env, k+"="+v)
+	}
+
 	a.Add(func() error {
-		return guest.Run("sh", "-c", "INSTALL_K3S_SKIP_DOWNLOAD=true INSTALL_K3S_SKIP_ENABLE=true k3s-install.sh "+strings.Join(args, " "))
+		return guest.Run(append(env, "sh", "-c", "INSTALL_K3S_SKIP_DOWNLOAD=true INSTALL_K3S_SKIP_ENABLE=true k3s-install.sh "+strings.Join(args, " "))...)
 	})
 }
 
@@ -12,11 +12,24 @@ import (
 	"github.com/abiosoft/colima/environment/vm/lima/limautil"
 )
 
-const masterAddressKey = "master_address"
+const (
+	masterAddressKey = "master_address"
+	// kubeconfigContextKey is the context name of the kubeconfig on the host.
+	kubeconfigContextKey = "kubeconfig_context"
+	// kubeconfigFileKey is the standalone kubeconfig on the host, empty if merged.
+	kubeconfigFileKey = "kubeconfig_file"
+)
 
 func (c kubernetesRuntime) provisionKubeconfig(ctx context.Context) error {
+	kubeconf := c.config().Kubeconfig
+	name, err := kubeconf.ContextName(config.CurrentProfile())
+	if err != nil {
+		return err
+	}
+	file := kubeconf.FilePath()
+
 	ip := limautil.IPAddress(config.CurrentProfile().ID)
-	if ip == c.guest.Get(masterAddressKey) {
+	if ip == c.guest.Get(masterAddressKey) && name == c.contextName() && file == c.guest.Get(kubeconfigFileKey) {
 		return nil
 	}
 
@@ -26,7 +39,7 @@ func (c kubernetesRuntime) provisionKubeconfig(ctx context.Context) error {
 	a.Stage("updating config")
 
 	// remove existing configs (if any)
-	// this is safe as the profile name is unique to colima
+	// this is safe as the context name is unique to colima
 	c.unsetKubeconfig(a)
 
 	// ensure host kube directory exists
@@ -47,15 +60,28 @@ func (c kubernetesRuntime) provisionKubeconfig(ctx context.Context) error {
 		kubeconfFile = filepath.SplitList(envKubeConfFile)[0]
 	}
 	tmpkubeconfFile := filepath.Join(hostKubeDir, "."+profile, "colima-temp")
+	if file != "" {
+		tmpkubeconfFile = file
+		a.Add(func() error {
+			return c.host.Run("mkdir", "-p", filepath.Dir(file))
+		})
+	}
 
 	// manipulate in VM and save to host
 	a.Add(func() error {
-		kubeconfig, err := c.guest.Read("/etc/rancher/k3s/k3s.yaml")
+		kubeconfig, err := c.distro().kubeconfig()
 		if err != nil {
 			return fmt.Errorf("error fetching kubeconfig on guest: %w", err)
 		}
+		// replace port, the server is the socket starting the cluster
+		if c.config().Lazy {
+			if kubeconfig, err = lazyKubeconfig(c.guest, kubeconfig); err != nil {
+				return err
+			}
+		}
+
 		// replace name
-		kubeconfig = strings.ReplaceAll(kubeconfig, ": default", ": "+profile)
+		kubeconfig = strings.ReplaceAll(kubeconfig, ": default", ": "+name)
 
 		// replace IP
 		if ip != "" && ip != "127.0.0.1" {
@@ -66,6 +92,44 @@ func (c kubernetesRuntime) provisionKubeconfig(ctx context.Context) error {
 		return c.host.Write(tmpkubeconfFile, []byte(kubeconfig))
 	})
 
+	if file != "" {
+		// the standalone kubeconfig has the credentials of the cluster
+		a.Add(func() error {
+			return c.host.Run("chmod", "600", file)
+		})
+	} else {
+		c.mergeKubeconfig(a, name, kubeconfFile, tmpkubeconfFile)
+
+		// set new context
+		conf, _ := ctx.Value(config.CtxKey()).(config.Config)
+		if kubeconf.CurrentContext(conf.AutoActivate()) {
+			a.Add(func() error {
+				out, err := c.host.RunOutput("kubectl", "config", "use-context", name)
+				if err != nil {
+					return err
+				}
+				log.Println(out)
+				return nil
+			})
+		}
+	}
+
+	// save settings
+	a.Add(func() error {
+		return c.guest.Set(masterAddressKey, ip)
+	})
+	a.Add(func() error {
+		return c.guest.Set(kubeconfigContextKey, name)
+	})
+	a.Add(func() error {
+		return c.guest.Set(kubeconfigFileKey, file)
+	})
+
+	return a.Exec()
+}
+
+// mergeKubeconfig merges the kubeconfig in tmpkubeconfFile into kubeconfFile, the existing file is backed up.
+func (c kubernetesRuntime) mergeKubeconfig(a *cli.ActiveCommandChain, name, kubeconfFile, tmpkubeconfFile string) {
 	// merge on host
 	a.Add(func() (err error) {
 		// prepare new host with right env var.
@@ -98,42 +162,49 @@ func (c kubernetesRuntime) provisionKubeconfig(ctx context.Context) error {
 
 		return nil
 	})
+}
 
-	// set new context
-	conf, _ := ctx.Value(config.CtxKey()).(config.Config)
-	if conf.AutoActivate() {
-		a.Add(func() error {
-			out, err := c.host.RunOutput("kubectl", "config", "use-context", profile)
-			if err != nil {
-				return err
-			}
-			log.Println(out)
-			return nil
-		})
+// contextName returns the context name of the kubeconfig on the host, the profile ID for
+// kubeconfigs created before the name was saved.
+func (c kubernetesRuntime) contextName() string {
+	if name := c.guest.Get(kubeconfigContextKey); name != "" {
+		return name
 	}
+	return config.CurrentProfile().ID
+}
 
-	// save settings
-	a.Add(func() error {
-		return c.guest.Set(masterAddressKey, ip)
-	})
-
-	return a.Exec()
+// kubectlArgs returns the kubectl args for the context of the cluster on the host.
+func (c kubernetesRuntime) kubectlArgs() []string {
+	args := []string{"--context", c.contextName()}
+	if file := c.guest.Get(kubeconfigFileKey); file != "" {
+		args = append(args, "--kubeconfig", file)
+	}
+	return args
 }
 
+// unsetKubeconfig removes the context of the cluster from the kubeconfig on the host,
+// or the standalone kubeconfig.
 func (c kubernetesRuntime) unsetKubeconfig(a *cli.ActiveCommandChain) {
-	profile := config.CurrentProfile().ID
+	if file := c.guest.Get(kubeconfigFileKey); file != "" {
+		a.Add(func() error {
+			return c.host.RunQuiet("rm", "-f", file)
+		})
+		return
+	}
+
+	name := c.contextName()
 	a.Add(func() error {
-		return c.host.Run("kubectl", "config", "unset", "users."+profile)
+		return c.host.Run("kubectl", "config", "unset", "users."+name)
 	})
 	a.Add(func() error {
-		return c.host.Run("kubectl", "config", "unset", "contexts."+profile)
+		return c.host.Run("kubectl", "config", "unset", "contexts."+name)
 	})
 	a.Add(func() error {
-		return c.host.Run("kubectl", "config", "unset", "clusters."+profile)
+		return c.host.Run("kubectl", "config", "unset", "clusters."+name)
 	})
 	// kubectl config unset current-context
 	a.Add(func() error {
-		if c, _ := c.host.RunOutput("kubectl", "config", "current-context"); c != config.CurrentProfile().ID {
+		if c, _ := c.host.RunOutput("kubectl", "config", "current-context"); c != name {
 			return nil
 		}
 		return c.host.Run("kubectl", "config", "unset", "current-context")
@@ -141,9 +212,17 @@ func (c kubernetesRuntime) unsetKubeconfig(a *cli.ActiveCommandChain) {
 }
 
 func (c kubernetesRuntime) teardownKubeconfig(a *cli.ActiveCommandChain) {
-	a.Stage("reverting config")
-	c.unsetKubeconfig(a)
+	if c.config().Kubeconfig.CleanupEnabled() {
+		a.Stage("reverting config")
+		c.unsetKubeconfig(a)
+	}
 	a.Add(func() error {
 		return c.guest.Set(masterAddressKey, "")
 	})
+	a.Add(func() error {
+		return c.guest.Set(kubeconfigContextKey, "")
+	})
+	a.Add(func() error {
+		return c.guest.Set(kubeconfigFileKey, "")
+	})
 }
@@ -4,14 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
 	"github.com/abiosoft/colima/environment"
 	"github.com/abiosoft/colima/environment/container/containerd"
 	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util/proxy"
 )
 
 // Name is container runtime name
@@ -47,22 +51,13 @@ func (c kubernetesRuntime) Name() string {
 	return Name
 }
 
-func (c kubernetesRuntime) isInstalled() bool {
-	// it is installed if uninstall script is present.
-	return c.guest.RunQuiet("command", "-v", "k3s-uninstall.sh") == nil
-}
-
-func (c kubernetesRuntime) isVersionInstalled(version string) bool {
-	// validate version change via cli flag/config.
-	out, err := c.guest.RunOutput("k3s", "--version")
-	if err != nil {
-		return false
-	}
-	return strings.Contains(out, version)
+// distro returns the distribution of the persisted config.
+func (c kubernetesRuntime) distro() distro {
+	return newDistro(c.host, c.guest, c.config())
 }
 
 func (c kubernetesRuntime) Running(context.Context) bool {
-	return c.guest.RunQuiet("sudo", "service", "k3s", "status") == nil
+	return c.distro().running()
 }
 
 func (c kubernetesRuntime) runtime() string {
@@ -87,6 +82,13 @@ func (c kubernetesRuntime) setConfig(conf config.Kubernetes) error {
 }
 
 func (c *kubernetesRuntime) Provision(ctx context.Context) error {
+	if err := c.provision(ctx); err != nil {
+		return c.reportFailure(ctx, "provisioning", err)
+	}
+	return nil
+}
+
+func (c *kubernetesRuntime) provision(ctx context.Context) error {
 	log := c.Logger(ctx)
 	a := c.Init(ctx)
 	if c.Running(ctx) {
@@ -104,46 +106,95 @@ func (c *kubernetesRuntime) Provision(ctx context.Context) error {
 		conf = c.config()
 	}
 
-	if conf.Version == "" {
-		// this ensure if `version` tag in `kubernetes` section in yaml is empty,
-		// it should assign with the `DefaultVersion` for the baseURL
-		conf.Version = DefaultVersion
+	// network settings, the config of the running instance is used for restarts
+	instanceConf := appConf
+	if !ok {
+		instanceConf, _ = configmanager.LoadInstance()
 	}
-
-	if c.isVersionInstalled(conf.Version) {
-		// runtime has changed, ensure the required images are in the registry
-		if currentRuntime := c.runtime(); currentRuntime != "" && currentRuntime != runtime {
-			a.Stagef("changing runtime to %s", runtime)
-			installK3sCache(c.host, c.guest, a, log, runtime, conf.Version)
+	conf.Enabled = true
+	instanceConf.Kubernetes = conf
+	ipv6 := instanceConf.Network.IPv6
+
+	// proxy settings of the host
+	proxies := proxy.Resolve(instanceConf).Guest(proxy.GuestHost).
+		WithNoProxy(proxy.NoProxyDefaults(instanceConf, limautil.IPAddress(config.CurrentProfile().ID))...)
+
+	d := newDistro(c.host, c.guest, conf)
+	// this ensure if `version` tag in `kubernetes` section in yaml is empty,
+	// or set for another distribution, it is assigned the default version of the distribution.
+	// a channel is resolved to its version, the channel is persisted.
+	installConf := conf
+	if conf.Airgap.Enabled() && isChannel(conf.Version) {
+		return fmt.Errorf("release channel '%s' not supported with kubernetes.airgap, set the version of the k3s binary", conf.Version)
+	}
+	{
+		version, err := c.resolveVersion(d, conf.Version)
+		if err != nil {
+			return err
 		}
-		// other settings may have changed e.g. ingress
-		installK3sCluster(c.host, c.guest, a, runtime, conf.Version, conf.K3sArgs)
-	} else {
-		if c.isInstalled() {
-			a.Stagef("version changed to %s, downloading and installing", conf.Version)
-		} else {
-			if ok {
-				a.Stage("downloading and installing")
-			} else {
-				a.Stage("installing")
-			}
+		installConf.Version = version
+		if !isChannel(conf.Version) {
+			conf.Version = version
 		}
-		installK3s(c.host, c.guest, a, log, runtime, conf.Version, conf.K3sArgs)
 	}
 
-	// this needs to happen on each startup
-	{
-		// cni is used by both cri-dockerd and containerd
-		installCniConfig(c.guest, a)
+	// distribution has changed, remove the existing cluster
+	if current := c.distro(); current.Name() != d.Name() && current.installed() {
+		a.Stagef("changing distribution to %s", d.Name())
+		a.Add(current.uninstall)
+		a.Add(c.deleteAllContainers)
+		// the kubeconfig of the new cluster must be retrieved
+		a.Add(func() error { return c.guest.Set(masterAddressKey, "") })
 	}
 
+	// the server port of the kubeconfig changes with lazy startup
+	if c.config().Lazy != conf.Lazy {
+		a.Add(func() error { return c.guest.Set(masterAddressKey, "") })
+	}
+
+	// local image registry and registries, configured before the cluster starts
+	if ok {
+		if !conf.Agent() {
+			installRegistry(c.guest, a, runtime, conf.Registry)
+		}
+		installRegistries(c.guest, a, conf, appConf.KubernetesRegistries())
+		installCredentialProvider(c.guest, a, appConf.HostCredentials)
+		if appConf.HostCredentials {
+			installConf.KubeletArgs = slices.Concat(installConf.KubeletArgs, credentialProviderArgs())
+		}
+		// the kubelet of k0s fails to start with swap
+		if appConf.Swap.Enabled() {
+			installConf.KubeletArgs = slices.Concat(installConf.KubeletArgs, []string{"fail-swap-on=false"})
+		}
+	}
+
+	d.provision(a, log, provisionArgs{
+		conf:           installConf,
+		runtime:        runtime,
+		currentRuntime: c.runtime(),
+		proxies:        proxies,
+		ipv6:           ipv6,
+		mtu:            appConf.Network.MTU,
+		dnsDomains:     appConf.Network.DNSDomains,
+		wasmShims:      wasmShims(appConf),
+		configured:     ok,
+	})
+
 	// provision successful, now we can persist the version
 	a.Add(func() error { return c.setConfig(conf) })
+	a.Add(func() error { return c.guest.Set(versionKey, installConf.Version) })
 
 	return a.Exec()
 }
 
 func (c kubernetesRuntime) Start(ctx context.Context) error {
+	if err := c.start(ctx); err != nil {
+		return c.reportFailure(ctx, "startup", err)
+	}
+	return nil
+}
+
+func (c kubernetesRuntime) start(ctx context.Context) error {
 	log := c.Logger(ctx)
 	a := c.Init(ctx)
 	if c.Running(ctx) {
@@ -151,13 +202,39 @@ func (c kubernetesRuntime) Start(ctx context.Context) error {
 		return nil
 	}
 
-	a.Add(func() error {
-		return c.guest.Run("sudo", "service", "k3s", "start")
-	})
+	c.renewExpiringCerts(ctx, a)
+
+	if conf := c.config(); conf.Registry.Enabled && !conf.Agent() {
+		a.Add(func() error { return startRegistry(c.guest, c.runtime()) })
+	}
+
+	// with lazy startup, the cluster is started by the first request once the kubeconfig exists
+	if c.config().Lazy {
+		a.Add(func() error { return startLazy(c.guest) })
+		if c.guest.RunQuiet("test", "-e", serverKubeconfigFile) == nil {
+			a.Stage("starting on first request")
+			if err := a.Exec(); err != nil {
+				return err
+			}
+			return c.provisionKubeconfig(ctx)
+		}
+	}
+	a.Add(c.distro().start)
+
+	// the agent nodes have no API server and kubeconfig
+	if c.config().Agent() {
+		return a.Exec()
+	}
+
 	a.Retry("", time.Second*2, 10, func(int) error {
 		return c.guest.RunQuiet("kubectl", "cluster-info")
 	})
+	if err := a.Exec(); err != nil {
+		return err
+	}
 
+	a = c.Init(ctx)
+	c.applyNodeTopology(a, c.config())
 	if err := a.Exec(); err != nil {
 		return err
 	}
@@ -167,15 +244,24 @@ func (c kubernetesRuntime) Start(ctx context.Context) error {
 
 func (c kubernetesRuntime) Stop(ctx context.Context) error {
 	a := c.Init(ctx)
-	a.Add(func() error {
-		return c.guest.Run("k3s-killall.sh")
-	})
+	// the first request must not start the cluster
+	if c.config().Lazy {
+		a.Add(func() error { return stopLazy(c.guest) })
+	}
+	a.Add(c.distro().stop)
 
 	// k3s is buggy with external containerd for now
 	// cleanup is manual
 	a.Add(c.stopAllContainers)
 
-	return a.Exec()
+	if c.guest.Get(registryPortKey) != "" {
+		a.Add(func() error { return stopRegistry(c.guest, c.runtime()) })
+	}
+
+	if err := a.Exec(); err != nil {
+		return c.reportFailure(ctx, "stop", err)
+	}
+	return nil
 }
 
 func (c kubernetesRuntime) deleteAllContainers() error {
@@ -244,19 +330,30 @@ func (c kubernetesRuntime) runningContainerIDs() string {
 func (c kubernetesRuntime) Teardown(ctx context.Context) error {
 	a := c.Init(ctx)
 
-	if c.isInstalled() {
-		a.Add(func() error {
-			return c.guest.Run("k3s-uninstall.sh")
-		})
+	d := c.distro()
+	if d.installed() {
+		a.Add(d.uninstall)
+	}
+	if c.config().Lazy {
+		installK3sLazy(c.guest, a, false)
 	}
 
 	// k3s is buggy with external containerd for now
 	// cleanup is manual
 	a.Add(c.deleteAllContainers)
 
-	c.teardownKubeconfig(a)
+	if c.guest.Get(registryPortKey) != "" {
+		a.Add(func() error { return deleteRegistry(c.guest, c.runtime()) })
+	}
 
-	return a.Exec()
+	if !c.config().Agent() {
+		c.teardownKubeconfig(a)
+	}
+
+	if err := a.Exec(); err != nil {
+		return c.reportFailure(ctx, "teardown", err)
+	}
+	return nil
 }
 
 func (c kubernetesRuntime) Dependencies() []string {
@@ -264,7 +361,7 @@ func (c kubernetesRuntime) Dependencies() []string {
 }
 
 func (c kubernetesRuntime) Version(context.Context) string {
-	version, _ := c.host.RunOutput("kubectl", "--context", config.CurrentProfile().ID, "version", "--short")
+	version, _ := c.host.RunOutput(append(append([]string{"kubectl"}, c.kubectlArgs()...), "version", "--short")...)
 	return version
 }
 
@@ -0,0 +1,135 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util"
+)
+
+const (
+	// lazyPortKey is the port k3s listens on with lazy startup, the listen port is of the socket.
+	lazyPortKey = "k3s_lazy_port"
+
+	lazySocket     = "colima-k3s-lazy.socket"
+	lazyService    = "colima-k3s-lazy.service"
+	lazySocketUnit = "/etc/systemd/system/" + lazySocket
+	lazyUnit       = "/etc/systemd/system/" + lazyService
+)
+
+// lazySocketUnitBody is the socket on the listen port of the API server, the first
+// connection starts k3s.
+const lazySocketUnitBody = `[Unit]
+Description=Start k3s on the first API request
+
+[Socket]
+ListenStream=%d
+`
+
+// lazyUnitBody is the service started by the socket, proxying the connections to k3s
+// once the API server is ready.
+const lazyUnitBody = `[Unit]
+Description=Proxy the API requests to k3s
+Requires=k3s.service ` + lazySocket + `
+After=k3s.service ` + lazySocket + `
+
+[Service]
+ExecStartPre=/bin/sh -c 'until k3s kubectl get --raw /readyz >/dev/null 2>&1; do sleep 1; done'
+ExecStart=/usr/lib/systemd/systemd-socket-proxyd 127.0.0.1:%d
+TimeoutStartSec=300
+`
+
+// installK3sLazy installs the socket and service starting k3s on the first request to the
+// API server. The units are removed if disabled.
+func installK3sLazy(guest environment.GuestActions, a *cli.ActiveCommandChain, enabled bool) {
+	a.Add(func() error {
+		// the socket must not hold the listen port of k3s
+		_ = guest.RunQuiet("sudo", "systemctl", "stop", lazySocket, lazyService)
+
+		if !enabled {
+			if guest.RunQuiet("test", "-e", lazySocketUnit) != nil {
+				return nil
+			}
+			if err := guest.RunQuiet("sudo", "rm", "-f", lazySocketUnit, lazyUnit); err != nil {
+				return fmt.Errorf("error removing lazy startup: %w", err)
+			}
+			return guest.RunQuiet("sudo", "systemctl", "daemon-reload")
+		}
+
+		port, err := getPortNumber(guest)
+		if err != nil {
+			return err
+		}
+		lazyPort, err := getLazyPortNumber(guest)
+		if err != nil {
+			return err
+		}
+		if err := guest.Write(lazySocketUnit, []byte(fmt.Sprintf(lazySocketUnitBody, port))); err != nil {
+			return fmt.Errorf("error writing lazy startup socket: %w", err)
+		}
+		if err := guest.Write(lazyUnit, []byte(fmt.Sprintf(lazyUnitBody, lazyPort))); err != nil {
+			return fmt.Errorf("error writing lazy startup service: %w", err)
+		}
+		return guest.Run("sudo", "systemctl", "daemon-reload")
+	})
+}
+
+// startLazy listens for the first request to the API server, k3s is started on demand.
+func startLazy(guest environment.GuestActions) error {
+	return guest.Run("sudo", "systemctl", "start", lazySocket)
+}
+
+// stopLazy stops listening for the requests to the API server, k3s is not stopped.
+func stopLazy(guest environment.GuestActions) error {
+	return guest.RunQuiet("sudo", "systemctl", "stop", lazySocket, lazyService)
+}
+
+// getLazyPortNumber retrieves the previously set port number of k3s with lazy startup.
+// If missing, a random port available in the VM is set and returned.
+func getLazyPortNumber(guest environment.GuestActions) (int, error) {
+	if port, err := strconv.Atoi(guest.Get(lazyPortKey)); err == nil && port > 0 {
+		return port, nil
+	}
+
+	port, err := guestAvailablePort(guest)
+	if err != nil {
+		return 0, err
+	}
+	if err := guest.Set(lazyPortKey, strconv.Itoa(port)); err != nil {
+		return 0, err
+	}
+	return port, nil
+}
+
+// guestAvailablePort returns a random port not listened on in the VM.
+func guestAvailablePort(guest environment.GuestActions) (int, error) {
+	for range 10 {
+		// the port available on the host is a random candidate for the VM
+		port := util.RandomAvailablePort()
+		out, err := guest.RunOutput("ss", "-Hltn", "sport = :"+strconv.Itoa(port))
+		if err != nil {
+			return 0, fmt.Errorf("error checking port %d in the VM: %w", port, err)
+		}
+		if strings.TrimSpace(out) == "" {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("error picking an available port in the VM")
+}
+
+// lazyKubeconfig returns the kubeconfig with the server on the port of the socket,
+// k3s writes the kubeconfig with the port k3s listens on.
+func lazyKubeconfig(guest environment.GuestActions, kubeconfig string) (string, error) {
+	port, err := getPortNumber(guest)
+	if err != nil {
+		return "", err
+	}
+	lazyPort, err := getLazyPortNumber(guest)
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(kubeconfig, "https://127.0.0.1:"+strconv.Itoa(lazyPort), "https://127.0.0.1:"+strconv.Itoa(port)), nil
+}
@@ -0,0 +1,89 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// k3sLoadBalancerManifest is the manifest of MetalLB and the pool, auto-deployed by k3s.
+	k3sLoadBalancerManifest = "/var/lib/rancher/k3s/server/manifests/colima-loadbalancer.yaml"
+	// k0sLoadBalancerManifest is the manifest of the pool, auto-deployed by k0s.
+	k0sLoadBalancerManifest = "/var/lib/k0s/manifests/colima/loadbalancer.yaml"
+)
+
+// metalLBChart is the chart of MetalLB for allocating the LoadBalancer IPs.
+// The IPs are not announced by the speaker, the pool is routed from the host to the VM
+// and the traffic to the IPs is forwarded by kube-proxy.
+var metalLBChart = helmChart{
+	Name:      "metallb",
+	Repo:      "https://metallb.github.io/metallb",
+	Namespace: "metallb-system",
+	Values: `speaker:
+  enabled: false
+`,
+}
+
+// installK3sLoadBalancer deploys MetalLB with the pool of the LoadBalancer IPs.
+// The manifest is removed if cidr is empty.
+func installK3sLoadBalancer(guest environment.GuestActions, a *cli.ActiveCommandChain, cidr string) {
+	a.Add(func() error {
+		if cidr == "" {
+			return guest.RunQuiet("sudo", "rm", "-f", k3sLoadBalancerManifest)
+		}
+
+		chart, err := k3sHelmChart(metalLBChart)
+		if err != nil {
+			return err
+		}
+		pool, err := metalLBPool(cidr)
+		if err != nil {
+			return err
+		}
+		// the pool is applied once the chart has installed the CRDs
+		return guest.Write(k3sLoadBalancerManifest, bytes.Join([][]byte{chart, pool}, []byte("---\n")))
+	})
+}
+
+// installK0sLoadBalancer deploys the pool of the LoadBalancer IPs, MetalLB is a helm extension of the k0s config.
+// The manifest is removed if cidr is empty.
+func installK0sLoadBalancer(guest environment.GuestActions, a *cli.ActiveCommandChain, cidr string) {
+	a.Add(func() error {
+		if cidr == "" {
+			return guest.RunQuiet("sudo", "rm", "-f", k0sLoadBalancerManifest)
+		}
+
+		pool, err := metalLBPool(cidr)
+		if err != nil {
+			return err
+		}
+		if err := guest.Run("sudo", "mkdir", "-p", filepath.Dir(k0sLoadBalancerManifest)); err != nil {
+			return fmt.Errorf("error creating k0s manifests dir: %w", err)
+		}
+		return guest.Write(k0sLoadBalancerManifest, pool)
+	})
+}
+
+// metalLBPool returns the manifest of the MetalLB pool for the cidr.
+func metalLBPool(cidr string) ([]byte, error) {
+	b, err := yaml.Marshal(map[string]any{
+		"apiVersion": "metallb.io/v1beta1",
+		"kind":       "IPAddressPool",
+		"metadata": map[string]any{
+			"name":      "colima",
+			"namespace": metalLBChart.Namespace,
+		},
+		"spec": map[string]any{
+			"addresses": []string{cidr},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding MetalLB pool: %w", err)
+	}
+	return b, nil
+}
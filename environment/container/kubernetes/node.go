@@ -0,0 +1,62 @@
+package kubernetes
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+)
+
+// nodeLabels returns the node labels as key=value, sorted by key.
+func nodeLabels(labels map[string]string) []string {
+	var list []string
+	for key, val := range labels {
+		list = append(list, key+"="+val)
+	}
+	slices.Sort(list)
+	return list
+}
+
+// kubeletArgs returns the kubelet args without the leading dashes e.g. max-pods=200,
+// as expected by the --kubelet-arg flag of k3s.
+func kubeletArgs(args []string) []string {
+	var list []string
+	for _, arg := range args {
+		if arg = strings.TrimLeft(strings.TrimSpace(arg), "-"); arg != "" {
+			list = append(list, arg)
+		}
+	}
+	return list
+}
+
+// applyNodeTopology applies the labels and taints to the server node of the running cluster.
+// The labels and taints are only set by the distributions when the node is registered.
+func (c kubernetesRuntime) applyNodeTopology(a *cli.ActiveCommandChain, conf config.Kubernetes) {
+	if len(conf.NodeLabels) == 0 && len(conf.NodeTaints) == 0 {
+		return
+	}
+
+	a.Add(func() error {
+		node, err := c.guest.RunOutput("hostname")
+		if err != nil {
+			return fmt.Errorf("error retrieving node name: %w", err)
+		}
+		node = strings.ToLower(strings.TrimSpace(node))
+
+		if labels := nodeLabels(conf.NodeLabels); len(labels) > 0 {
+			args := append([]string{"label", "node", node, "--overwrite"}, labels...)
+			if err := c.kubectl(args...); err != nil {
+				return fmt.Errorf("error labelling node %s: %w", node, err)
+			}
+		}
+		if len(conf.NodeTaints) > 0 {
+			args := append([]string{"taint", "node", node, "--overwrite"}, conf.NodeTaints...)
+			if err := c.kubectl(args...); err != nil {
+				return fmt.Errorf("error tainting node %s: %w", node, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,150 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// registriesKey is the hosts of the containerd registry configs written for kubernetes.registries.
+	registriesKey = "kubernetes_registries"
+	// kubeletCredentialsKey is set if the credentials of the kubelet are written by colima.
+	kubeletCredentialsKey = "kubernetes_kubelet_credentials"
+
+	// kubeletCredentialsFile is the docker config with the registry credentials, passed by the
+	// kubelet to the container runtime for the image pulls.
+	kubeletCredentialsFile = "/var/lib/kubelet/config.json"
+)
+
+// installRegistries writes the k3s registries config with the mirror of the local registry and
+// the registries, and the containerd hosts configs of the registries. The registries are the
+// registries of the container runtime and kubernetes.registries.
+// The configs of the registries no longer configured are removed.
+func installRegistries(guest environment.GuestActions, a *cli.ActiveCommandChain, conf config.Kubernetes, registries []config.RegistryHost) {
+	var local string
+	if conf.Registry.Enabled && !conf.Agent() {
+		local = "localhost:" + strconv.Itoa(conf.Registry.PortOrDefault())
+	}
+
+	// containerd hosts configs
+	a.Add(func() error {
+		return containerd.WriteHostsConfigs(guest, containerd.KubernetesCertsDir, registriesKey, registries)
+	})
+
+	// registry credentials for the kubelet, applicable to all the container runtimes
+	a.Add(func() error {
+		managed := guest.Get(kubeletCredentialsKey) != ""
+		exists := guest.RunQuiet("sudo", "test", "-e", kubeletCredentialsFile) == nil
+
+		credentials, err := containerd.DockerConfig(registries)
+		if err != nil {
+			return err
+		}
+		switch {
+		case credentials == nil:
+			if exists && managed {
+				if err := guest.RunQuiet("sudo", "rm", "-f", kubeletCredentialsFile); err != nil {
+					return fmt.Errorf("error removing kubelet credentials: %w", err)
+				}
+			}
+			return guest.Set(kubeletCredentialsKey, "")
+		case exists && !managed:
+			a.Logger().Warnln(kubeletCredentialsFile + " exists, configure the registry credentials manually")
+			return nil
+		}
+
+		if err := containerd.WriteCredentials(guest, kubeletCredentialsFile, credentials); err != nil {
+			return err
+		}
+		return guest.Set(kubeletCredentialsKey, "1")
+	})
+
+	a.Add(func() error {
+		// the registries of k3s may be configured by the user
+		b, err := guest.Read(k3sRegistriesFile)
+		managed := err != nil || strings.HasPrefix(b, containerd.RegistryManaged)
+
+		if local == "" && len(registries) == 0 {
+			if err == nil && managed {
+				return guest.RunQuiet("sudo", "rm", "-f", k3sRegistriesFile)
+			}
+			return nil
+		}
+		if !managed {
+			a.Logger().Warnln(k3sRegistriesFile + " exists, configure the registries manually")
+			return nil
+		}
+
+		k3sConf, err := k3sRegistries(local, registries)
+		if err != nil {
+			return err
+		}
+		// the config contains the registry credentials
+		return containerd.WriteCredentials(guest, k3sRegistriesFile, k3sConf)
+	})
+}
+
+// k3sRegistries returns the k3s registries config with the mirror for the plain HTTP local registry,
+// if set, and the mirrors, credentials and TLS settings of the registries.
+func k3sRegistries(local string, registries []config.RegistryHost) ([]byte, error) {
+	mirrors := map[string]any{}
+	configs := map[string]any{}
+
+	if local != "" {
+		mirrors[local] = map[string]any{
+			"endpoint": []string{"http://" + local},
+		}
+	}
+
+	for _, r := range registries {
+		var endpoints []string
+		for _, endpoint := range r.Mirrors {
+			endpoints = append(endpoints, containerd.RegistryEndpoint(endpoint))
+		}
+		// an insecure registry is served over plain HTTP
+		if r.Insecure {
+			endpoints = append(endpoints, "http://"+r.Host)
+		}
+		if len(endpoints) > 0 {
+			mirrors[r.Host] = map[string]any{"endpoint": endpoints}
+		}
+
+		conf := map[string]any{}
+		if r.Username != "" || r.Password != "" {
+			conf["auth"] = map[string]any{"username": r.Username, "password": r.Password}
+		}
+		if r.InsecureSkipVerify {
+			conf["tls"] = map[string]any{"insecure_skip_verify": true}
+			// the TLS settings apply to the endpoint hosts
+			for _, endpoint := range endpoints {
+				if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+					configs[u.Host] = map[string]any{"tls": map[string]any{"insecure_skip_verify": true}}
+				}
+			}
+		}
+		if len(conf) > 0 {
+			configs[r.Host] = conf
+		}
+	}
+
+	registriesConf := map[string]any{}
+	if len(mirrors) > 0 {
+		registriesConf["mirrors"] = mirrors
+	}
+	if len(configs) > 0 {
+		registriesConf["configs"] = configs
+	}
+	b, err := yaml.Marshal(registriesConf)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding k3s registries config: %w", err)
+	}
+	return append([]byte(containerd.RegistryManaged+"\n"), b...), nil
+}
@@ -0,0 +1,143 @@
+package kubernetes
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+const (
+	registryContainer = "colima-registry"
+	registryImage     = "docker.io/library/registry:2"
+	// registryPortKey is the port of the existing registry container.
+	registryPortKey = "kubernetes_registry_port"
+
+	// k3sRegistriesFile is the registry config of k3s, applied to its embedded containerd.
+	k3sRegistriesFile = "/etc/rancher/k3s/registries.yaml"
+)
+
+// registryCLI returns the command for managing the registry container with the container runtime.
+func registryCLI(runtime string) []string {
+	if runtime == containerd.Name {
+		return []string{"sudo", "nerdctl"}
+	}
+	return []string{"sudo", "docker"}
+}
+
+// installRegistry runs the local image registry in the VM and configures the mirror of
+// containerd for the registry. The registry is removed if disabled, the images are retained.
+// The mirror of k3s is configured by installRegistries.
+func installRegistry(guest environment.GuestActions, a *cli.ActiveCommandChain, runtime string, conf config.KubernetesRegistry) {
+	cmd := registryCLI(runtime)
+	exists := guest.RunQuiet(append(cmd, "container", "inspect", registryContainer)...) == nil
+
+	if !conf.Enabled {
+		a.Add(func() error { return deleteRegistry(guest, runtime) })
+		return
+	}
+
+	port := strconv.Itoa(conf.PortOrDefault())
+
+	// recreated on port change
+	if exists && guest.Get(registryPortKey) != port {
+		a.Add(func() error {
+			return guest.Run(append(cmd, "rm", "-f", registryContainer)...)
+		})
+		exists = false
+	}
+	a.Add(func() error { return removeRegistryConfig(guest) })
+
+	a.Stage("starting registry")
+	if exists {
+		a.Add(func() error {
+			return guest.Run(append(cmd, "start", registryContainer)...)
+		})
+	} else {
+		a.Add(func() error {
+			return guest.Run(append(cmd, "run", "-d",
+				"--name", registryContainer,
+				"--restart", "unless-stopped",
+				"-p", port+":5000",
+				"-v", registryContainer+":/var/lib/registry",
+				registryImage,
+			)...)
+		})
+	}
+	a.Add(func() error { return guest.Set(registryPortKey, port) })
+
+	host := "localhost:" + port
+	// for the pushes with nerdctl and the image pulls of the cluster
+	a.Add(func() error {
+		for _, certsDir := range []string{containerd.CertsDir, containerd.KubernetesCertsDir} {
+			dir := filepath.Join(certsDir, host)
+			if err := guest.Run("sudo", "mkdir", "-p", dir); err != nil {
+				return fmt.Errorf("error creating containerd registry dir: %w", err)
+			}
+			if err := guest.Write(filepath.Join(dir, "hosts.toml"), containerdRegistryHosts(host)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// startRegistry starts the local image registry container stopped with the cluster.
+func startRegistry(guest environment.GuestActions, runtime string) error {
+	cmd := registryCLI(runtime)
+	if guest.RunQuiet(append(cmd, "container", "inspect", registryContainer)...) != nil {
+		return nil
+	}
+	return guest.Run(append(cmd, "start", registryContainer)...)
+}
+
+// stopRegistry stops the local image registry container, if any.
+func stopRegistry(guest environment.GuestActions, runtime string) error {
+	cmd := registryCLI(runtime)
+	if guest.RunQuiet(append(cmd, "container", "inspect", registryContainer)...) != nil {
+		return nil
+	}
+	return guest.Run(append(cmd, "stop", registryContainer)...)
+}
+
+// deleteRegistry removes the local image registry container and its containerd config.
+// The images are retained.
+func deleteRegistry(guest environment.GuestActions, runtime string) error {
+	cmd := registryCLI(runtime)
+	if guest.RunQuiet(append(cmd, "container", "inspect", registryContainer)...) == nil {
+		if err := guest.Run(append(cmd, "rm", "-f", registryContainer)...); err != nil {
+			return err
+		}
+	}
+	if err := removeRegistryConfig(guest); err != nil {
+		return err
+	}
+	return guest.Set(registryPortKey, "")
+}
+
+// removeRegistryConfig removes the containerd registry config of the local registry.
+func removeRegistryConfig(guest environment.GuestActions) error {
+	if port := guest.Get(registryPortKey); port != "" {
+		for _, certsDir := range []string{containerd.CertsDir, containerd.KubernetesCertsDir} {
+			dir := filepath.Join(certsDir, "localhost:"+port)
+			if err := guest.RunQuiet("sudo", "rm", "-rf", dir); err != nil {
+				return fmt.Errorf("error removing containerd registry config: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// containerdRegistryHosts returns the containerd hosts config for the plain HTTP registry at host.
+func containerdRegistryHosts(host string) []byte {
+	return []byte(fmt.Sprintf(`%s
+server = "http://%s"
+
+[host."http://%s"]
+  capabilities = ["pull", "resolve", "push"]
+`, containerd.RegistryManaged, host, host))
+}
@@ -0,0 +1,164 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+)
+
+const (
+	// failureReportFile is the report of the last failure of a lifecycle command, in the profile config dir.
+	failureReportFile = "kubernetes-failure.log"
+	// reportLogLines is the number of lines of the service logs in the report.
+	reportLogLines = 200
+	// summaryLines is the maximum number of lines of each section of the summary.
+	summaryLines = 5
+)
+
+// nodeConditionsTemplate lists the name of each node followed by the conditions as type=status reason: message.
+const nodeConditionsTemplate = `{range .items[*]}{.metadata.name}{"\n"}{range .status.conditions[*]}{.type}={.status} {.reason}: {.message}{"\n"}{end}{end}`
+
+// reportSection is a section of the failure report.
+type reportSection struct {
+	title string
+	args  []string
+	// summary returns the lines of the summary of the output, none if nil.
+	summary func(out string) []string
+}
+
+// reportFailure writes the report of the action of the cluster failing e.g. startup to the
+// profile config dir, logs the summary and returns the error with the location of the report.
+func (c kubernetesRuntime) reportFailure(ctx context.Context, action string, err error) error {
+	log := c.Logger(ctx)
+	d := c.distro()
+
+	kubectl := func(args ...string) []string {
+		return append([]string{"kubectl", "--request-timeout=5s"}, args...)
+	}
+	sections := []reportSection{
+		{
+			title: "service status",
+			args:  []string{"sudo", "systemctl", "status", d.service(), "--no-pager", "--lines=0"},
+		},
+		{
+			title:   "service logs",
+			args:    []string{"sudo", "journalctl", "--unit", d.service(), "--no-pager", "--lines", fmt.Sprint(reportLogLines)},
+			summary: matchingLines(isErrorLog),
+		},
+	}
+	// the agent nodes have no API server
+	if !c.config().Agent() {
+		sections = append(sections,
+			reportSection{
+				title:   "node conditions",
+				args:    kubectl("get", "nodes", "--output", "jsonpath="+nodeConditionsTemplate),
+				summary: matchingLines(isUnhealthyCondition),
+			},
+			reportSection{
+				title:   "kube-system pods",
+				args:    kubectl("get", "pods", "--namespace", "kube-system", "--output", "wide"),
+				summary: matchingLines(isUnhealthyPod),
+			},
+			reportSection{
+				title:   "kube-system warning events",
+				args:    kubectl("get", "events", "--namespace", "kube-system", "--field-selector", "type=Warning", "--sort-by", ".lastTimestamp"),
+				summary: matchingLines(func(line string) bool { return !strings.HasPrefix(line, "LAST SEEN") }),
+			},
+		)
+	}
+
+	var report, summary strings.Builder
+	_, _ = fmt.Fprintf(&report, "%s %s failure on %s: %v\n", d.Name(), action, time.Now().Format(time.RFC1123), err)
+	for _, s := range sections {
+		out, cmdErr := c.guest.RunOutput(s.args...)
+		if cmdErr != nil {
+			out = strings.TrimSpace(out + "\n" + cmdErr.Error())
+		}
+		_, _ = fmt.Fprintf(&report, "\n==> %s: %s\n%s\n", s.title, strings.Join(s.args, " "), out)
+
+		if s.summary == nil {
+			continue
+		}
+		if lines := s.summary(out); len(lines) > 0 {
+			_, _ = fmt.Fprintf(&summary, "%s:\n", s.title)
+			for _, line := range lines {
+				_, _ = fmt.Fprintf(&summary, "  %s\n", line)
+			}
+		}
+	}
+
+	file := filepath.Join(config.CurrentProfile().ConfigDir(), failureReportFile)
+	if writeErr := c.host.Write(file, []byte(report.String())); writeErr != nil {
+		log.Warnln(fmt.Errorf("error saving failure report: %w", writeErr))
+		file = ""
+	}
+
+	if summary.Len() > 0 {
+		log.Warnln("failure summary:\n" + strings.TrimSuffix(summary.String(), "\n"))
+	}
+	if file == "" {
+		return err
+	}
+	return fmt.Errorf("%w, failure report saved to %s", err, file)
+}
+
+// matchingLines returns the summary of the last lines of the output matching the filter.
+func matchingLines(filter func(line string) bool) func(string) []string {
+	return func(out string) []string {
+		var lines []string
+		for _, line := range strings.Split(out, "\n") {
+			if line = strings.TrimSpace(line); line != "" && filter(line) {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > summaryLines {
+			lines = lines[len(lines)-summaryLines:]
+		}
+		return lines
+	}
+}
+
+// isErrorLog returns if the service log line is an error of k3s, k0s or the Kubernetes components.
+func isErrorLog(line string) bool {
+	for _, s := range []string{"level=error", "level=fatal", "level=panic", " E0", " E1", " F0", " F1"} {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnhealthyCondition returns if the node condition line is unhealthy,
+// Ready is expected to be True and the pressure conditions False.
+func isUnhealthyCondition(line string) bool {
+	condition, _, _ := strings.Cut(line, " ")
+	switch {
+	case !strings.Contains(condition, "="):
+		// node name
+		return false
+	case strings.HasPrefix(condition, "Ready="):
+		return condition != "Ready=True"
+	}
+	return !strings.HasSuffix(condition, "=False")
+}
+
+// isUnhealthyPod returns if the pod line is of a Pod neither running with all the containers ready nor completed.
+func isUnhealthyPod(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || fields[0] == "NAME" {
+		return false
+	}
+	ready, status := fields[1], fields[2]
+	switch status {
+	case "Completed":
+		return false
+	case "Running":
+		r, total, _ := strings.Cut(ready, "/")
+		return r != total
+	}
+	return true
+}
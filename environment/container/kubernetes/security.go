@@ -0,0 +1,138 @@
+package kubernetes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// k3sAuditPolicyFile is the audit policy of the API server, copied from the host.
+	k3sAuditPolicyFile = "/var/lib/rancher/k3s/server/colima-audit-policy.yaml"
+	// k3sAuditLogFile is the audit log of the API server, rotated by the API server.
+	k3sAuditLogFile = "/var/lib/rancher/k3s/server/logs/audit.log"
+	// k3sAdmissionConfigFile is the admission config with the Pod Security Admission defaults.
+	k3sAdmissionConfigFile = "/var/lib/rancher/k3s/server/colima-admission-config.yaml"
+)
+
+// podSecurityExemptNamespaces are the namespaces of the system components and the addons,
+// exempted from the Pod Security Admission defaults.
+var podSecurityExemptNamespaces = []string{
+	"kube-system",
+	"calico-system",
+	"tigera-operator",
+	"traefik",
+	"ingress-nginx",
+	"metallb-system",
+	"kubernetes-dashboard",
+	"headlamp",
+}
+
+// SystemNamespace returns if the namespace is of the cluster, the system components or the addons.
+func SystemNamespace(namespace string) bool {
+	switch namespace {
+	case "default", "kube-public", "kube-node-lease":
+		return true
+	}
+	return slices.Contains(podSecurityExemptNamespaces, namespace)
+}
+
+// securityK3sArgs returns the API server args of the audit logging and the Pod Security
+// Admission defaults, with the files written by installK3sSecurity.
+func securityK3sArgs(conf config.Kubernetes) []string {
+	var args []string
+	if conf.AuditPolicy != "" {
+		args = append(args,
+			"--kube-apiserver-arg=audit-policy-file="+k3sAuditPolicyFile,
+			"--kube-apiserver-arg=audit-log-path="+k3sAuditLogFile,
+			"--kube-apiserver-arg=audit-log-maxage=7",
+			"--kube-apiserver-arg=audit-log-maxbackup=3",
+			"--kube-apiserver-arg=audit-log-maxsize=100",
+		)
+	}
+	if conf.PodSecurity.Enabled() {
+		args = append(args, "--kube-apiserver-arg=admission-control-config-file="+k3sAdmissionConfigFile)
+	}
+	return args
+}
+
+// installK3sSecurity writes the audit policy and the admission config referenced by the
+// k3s args, before k3s is installed. The files are removed if disabled.
+func installK3sSecurity(guest environment.GuestActions, a *cli.ActiveCommandChain, conf config.Kubernetes) {
+	a.Add(func() error {
+		if conf.AuditPolicy == "" && !conf.PodSecurity.Enabled() {
+			return nil
+		}
+		if err := guest.Run("sudo", "mkdir", "-p", filepath.Dir(k3sAuditPolicyFile)); err != nil {
+			return fmt.Errorf("error creating k3s server dir: %w", err)
+		}
+		return nil
+	})
+	a.Add(func() error {
+		file := conf.AuditPolicyFile()
+		if file == "" {
+			return guest.RunQuiet("sudo", "rm", "-f", k3sAuditPolicyFile)
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("error reading audit policy: %w", err)
+		}
+		return guest.Write(k3sAuditPolicyFile, b)
+	})
+	a.Add(func() error {
+		if !conf.PodSecurity.Enabled() {
+			return guest.RunQuiet("sudo", "rm", "-f", k3sAdmissionConfigFile)
+		}
+		b, err := admissionConfig(conf.PodSecurity)
+		if err != nil {
+			return err
+		}
+		return guest.Write(k3sAdmissionConfigFile, b)
+	})
+}
+
+// admissionConfig returns the admission config of the Pod Security Admission defaults.
+func admissionConfig(p config.KubernetesPodSecurity) ([]byte, error) {
+	version := p.Version
+	if version == "" {
+		version = "latest"
+	}
+	defaults := map[string]string{}
+	for level, value := range map[string]string{"enforce": p.Enforce, "audit": p.Audit, "warn": p.Warn} {
+		if value == "" {
+			value = "privileged"
+		}
+		defaults[level] = value
+		defaults[level+"-version"] = version
+	}
+
+	b, err := yaml.Marshal(map[string]any{
+		"apiVersion": "apiserver.config.k8s.io/v1",
+		"kind":       "AdmissionConfiguration",
+		"plugins": []map[string]any{
+			{
+				"name": "PodSecurity",
+				"configuration": map[string]any{
+					"apiVersion": "pod-security.admission.config.k8s.io/v1",
+					"kind":       "PodSecurityConfiguration",
+					"defaults":   defaults,
+					"exemptions": map[string]any{
+						"usernames":      []string{},
+						"runtimeClasses": []string{},
+						"namespaces":     append(append([]string{}, podSecurityExemptNamespaces...), p.ExemptNamespaces...),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding admission config: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,19 @@
+package kubernetes
+
+import (
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+)
+
+const (
+	// k3sSysboxManifest is the manifest of the sysbox RuntimeClass of previous versions.
+	k3sSysboxManifest = "/var/lib/rancher/k3s/server/manifests/colima-sysbox.yaml"
+	// k0sSysboxManifest is the manifest of the sysbox RuntimeClass of previous versions.
+	k0sSysboxManifest = "/var/lib/k0s/manifests/colima/sysbox.yaml"
+)
+
+// removeSysboxRuntimeClass removes the manifest of the sysbox RuntimeClass of previous versions.
+// Sysbox supports Kubernetes with CRI-O only, the pods are not run with sysbox on containerd.
+func removeSysboxRuntimeClass(guest environment.GuestActions, a *cli.ActiveCommandChain, manifest string) {
+	a.Add(func() error { return guest.RunQuiet("sudo", "rm", "-f", manifest) })
+}
@@ -0,0 +1,106 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// drainTimeout is the timeout for evicting the Pods of the node before the upgrade.
+const drainTimeout = "120s"
+
+// Upgrader is implemented by the Kubernetes runtime for upgrading a running cluster in place.
+type Upgrader interface {
+	// Upgrade upgrades the node to the version or channel, the configured version or
+	// channel if empty, and returns the upgraded version.
+	Upgrade(ctx context.Context, version string) (string, error)
+}
+
+var _ Upgrader = (*kubernetesRuntime)(nil)
+
+// Upgrade upgrades the node in place. The node is drained before the upgrade and uncordoned afterwards,
+// the Pods and the cluster state are preserved.
+func (c *kubernetesRuntime) Upgrade(ctx context.Context, version string) (string, error) {
+	log := c.Logger(ctx)
+	if !c.Running(ctx) {
+		return "", fmt.Errorf("%s is not running", Name)
+	}
+
+	conf := c.config()
+	if version == "" {
+		version = conf.Version
+	}
+
+	d := c.distro()
+	target := d.version(version)
+	if isChannel(version) {
+		if conf.Airgap.Enabled() {
+			return "", fmt.Errorf("release channel '%s' not supported with kubernetes.airgap", version)
+		}
+		var err error
+		if target, err = d.channelVersion(version); err != nil {
+			return "", err
+		}
+	}
+
+	current := d.installedVersion()
+	switch {
+	case current == target:
+		log.Printf("already at version %s", current)
+		return current, nil
+	case current != "" && compareVersions(target, current) < 0:
+		return "", fmt.Errorf("downgrade from %s to %s not supported, reset the cluster instead", current, target)
+	}
+
+	node, err := c.guest.RunOutput("hostname")
+	if err != nil {
+		return "", fmt.Errorf("error retrieving node name: %w", err)
+	}
+	node = strings.ToLower(strings.TrimSpace(node))
+
+	a := c.Init(ctx)
+	a.Stagef("upgrading from %s to %s", current, target)
+
+	a.Stagef("draining node %s", node)
+	a.Add(func() error {
+		// the upgrade proceeds if the Pods cannot be evicted e.g. due to a disruption budget
+		if err := c.kubectl("drain", node, "--ignore-daemonsets", "--delete-emptydir-data", "--timeout="+drainTimeout); err != nil {
+			log.Warnln(fmt.Errorf("error draining node %s: %w", node, err))
+		}
+		return nil
+	})
+
+	// persist the version, the channel is resolved to the target version
+	a.Add(func() error {
+		conf.Version = version
+		if !isChannel(version) {
+			conf.Version = target
+		}
+		return c.setConfig(conf)
+	})
+	a.Add(func() error { return c.guest.Set(versionKey, target) })
+
+	a.Add(func() error { return c.Stop(ctx) })
+	// provisioned from the persisted config
+	a.Add(func() error { return c.provision(context.Background()) })
+	a.Add(func() error { return c.start(ctx) })
+
+	a.Stagef("uncordoning node %s", node)
+	a.Retry("", time.Second*2, 30, func(int) error {
+		return c.kubectl("uncordon", node)
+	})
+
+	if err := a.Exec(); err != nil {
+		return "", c.reportFailure(ctx, "upgrade", err)
+	}
+	return target, nil
+}
+
+// kubectl runs kubectl for the cluster, in the VM of the server profile for the agent nodes.
+func (c kubernetesRuntime) kubectl(args ...string) error {
+	if conf := c.config(); conf.Agent() {
+		return serverHost(c.host, conf.Server).RunQuiet(append([]string{"lima", "kubectl"}, args...)...)
+	}
+	return c.guest.RunQuiet(append([]string{"kubectl"}, args...)...)
+}
@@ -0,0 +1,69 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// k3sWasmManifest is the manifest of the WebAssembly RuntimeClasses, auto-deployed by k3s.
+	k3sWasmManifest = "/var/lib/rancher/k3s/server/manifests/colima-wasm.yaml"
+	// k0sWasmManifest is the manifest of the WebAssembly RuntimeClasses, auto-deployed by k0s.
+	k0sWasmManifest = "/var/lib/k0s/manifests/colima/wasm.yaml"
+)
+
+// wasmShims returns the WebAssembly shims for the RuntimeClasses, only the containerd runtime
+// is configured with the shims as CRI runtimes.
+func wasmShims(conf config.Config) []string {
+	if conf.Runtime != containerd.Name {
+		return nil
+	}
+	return conf.WasmShims()
+}
+
+// installRuntimeClasses deploys the RuntimeClasses of the handlers, the CRI runtimes of
+// containerd e.g. the WebAssembly shims. The manifest is removed if there are no handlers.
+func installRuntimeClasses(guest environment.GuestActions, a *cli.ActiveCommandChain, manifest string, handlers []string) {
+	a.Add(func() error {
+		if len(handlers) == 0 {
+			return guest.RunQuiet("sudo", "rm", "-f", manifest)
+		}
+
+		b, err := runtimeClassManifest(handlers)
+		if err != nil {
+			return err
+		}
+		if err := guest.Run("sudo", "mkdir", "-p", filepath.Dir(manifest)); err != nil {
+			return fmt.Errorf("error creating manifests dir: %w", err)
+		}
+		return guest.Write(manifest, b)
+	})
+}
+
+// runtimeClassManifest returns the manifest of the RuntimeClasses of the handlers, named
+// after the handlers.
+func runtimeClassManifest(handlers []string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	for _, handler := range handlers {
+		if err := enc.Encode(map[string]any{
+			"apiVersion": "node.k8s.io/v1",
+			"kind":       "RuntimeClass",
+			"metadata":   map[string]any{"name": handler},
+			"handler":    handler,
+		}); err != nil {
+			return nil, fmt.Errorf("error encoding RuntimeClass '%s': %w", handler, err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("error encoding RuntimeClasses: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,263 @@
+package podman
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util/debutil"
+)
+
+// Name is container runtime name.
+const Name = "podman"
+
+const (
+	// GuestSocketFile is the socket of the rootful podman in the VM.
+	GuestSocketFile = "/run/podman/podman.sock"
+	// GuestRootlessSocketFile is the socket of the rootless podman in the VM, templated by Lima.
+	GuestRootlessSocketFile = "/run/user/{{.UID}}/podman/podman.sock"
+)
+
+var configDir = func() string { return config.CurrentProfile().ConfigDir() }
+
+// HostSocketFile returns the path to the rootful podman socket on host.
+func HostSocketFile() string { return filepath.Join(configDir(), "podman-root.sock") }
+
+// HostRootlessSocketFile returns the path to the rootless podman socket on host.
+func HostRootlessSocketFile() string { return filepath.Join(configDir(), "podman.sock") }
+
+// connections returns the names of the podman system connections on the host
+// of the rootless and rootful podman, as with podman machine.
+func connections() (rootless, rootful string) {
+	name := config.CurrentProfile().ID
+	return name, name + "-root"
+}
+
+var _ environment.Container = (*podmanRuntime)(nil)
+
+func init() {
+	environment.RegisterContainer(Name, newRuntime, false)
+}
+
+type podmanRuntime struct {
+	host  environment.HostActions
+	guest environment.GuestActions
+	cli.CommandChain
+}
+
+// newRuntime creates a new podman runtime.
+func newRuntime(host environment.HostActions, guest environment.GuestActions) environment.Container {
+	return &podmanRuntime{
+		host:         host,
+		guest:        guest,
+		CommandChain: cli.New(Name),
+	}
+}
+
+func (p podmanRuntime) Name() string {
+	return Name
+}
+
+// Provision installs podman on first startup, the disk image has no container runtime.
+// The rootless podman of the user is kept running with lingering.
+func (p podmanRuntime) Provision(ctx context.Context) error {
+	a := p.Init(ctx)
+
+	if p.guest.RunQuiet("sh", "-c", "command -v podman") != nil {
+		a.Stage("installing")
+		a.Add(func() error {
+			return p.guest.RunQuiet("sh", "-c", "sudo apt-get update -y && sudo apt-get install -y podman")
+		})
+	}
+
+	a.Add(func() error {
+		return p.guest.RunQuiet("sh", "-c", `sudo loginctl enable-linger "$USER"`)
+	})
+	a.Add(func() error {
+		return p.guest.RunQuiet("sudo", "systemctl", "enable", "podman.socket")
+	})
+	a.Add(func() error {
+		return p.guest.RunQuiet("systemctl", "--user", "enable", "podman.socket")
+	})
+
+	return a.Exec()
+}
+
+func (p podmanRuntime) Start(ctx context.Context) error {
+	conf, _ := ctx.Value(config.CtxKey()).(config.Config)
+	a := p.Init(ctx)
+
+	a.Add(func() error {
+		return p.guest.RunQuiet("sudo", "systemctl", "start", "podman.socket")
+	})
+	a.Add(func() error {
+		return p.guest.RunQuiet("systemctl", "--user", "start", "podman.socket")
+	})
+
+	// the user session may take few seconds on first startup, retry for a minute before giving up.
+	a.Retry("", time.Second, 60, func(int) error {
+		if err := p.guest.RunQuiet("sudo", "podman", "info"); err != nil {
+			return err
+		}
+		return p.guest.RunQuiet("podman", "info")
+	})
+
+	// podman system connections
+	a.Add(func() error {
+		return p.setupConnections(conf.AutoActivate(), conf.Podman.Rootful)
+	})
+
+	return a.Exec()
+}
+
+func (p podmanRuntime) Running(ctx context.Context) bool {
+	return p.guest.RunQuiet("systemctl", "is-active", "--quiet", "podman.socket") == nil
+}
+
+func (p podmanRuntime) Stop(ctx context.Context) error {
+	a := p.Init(ctx)
+
+	a.Add(func() error {
+		if !p.Running(ctx) {
+			return nil
+		}
+		return p.guest.Run("sudo", "systemctl", "stop", "podman.socket", "podman.service")
+	})
+	a.Add(func() error {
+		return p.guest.RunQuiet("systemctl", "--user", "stop", "podman.socket", "podman.service")
+	})
+
+	// clear podman system connections
+	// since the container runtime can be changed on startup,
+	// it is better to not leave unnecessary traces behind
+	a.Add(p.teardownConnections)
+
+	return a.Exec()
+}
+
+func (p podmanRuntime) Teardown(ctx context.Context) error {
+	a := p.Init(ctx)
+
+	// clear podman system connections
+	a.Add(p.teardownConnections)
+
+	return a.Exec()
+}
+
+var _ environment.Deprovisioner = (*podmanRuntime)(nil)
+
+// Deprovision disables the rootful and rootless podman sockets and removes the system
+// connections, for switching to another runtime.
+func (p podmanRuntime) Deprovision(ctx context.Context) error {
+	a := p.Init(ctx)
+
+	a.Add(func() error {
+		return p.guest.RunQuiet("sudo", "systemctl", "disable", "--now", "podman.socket")
+	})
+	a.Add(func() error {
+		return p.guest.RunQuiet("systemctl", "--user", "disable", "--now", "podman.socket")
+	})
+	a.Add(p.teardownConnections)
+
+	return a.Exec()
+}
+
+var _ environment.ImageMigrator = (*podmanRuntime)(nil)
+
+// imageCommand returns the podman command of the images in the VM, rootful if rootful.
+func imageCommand(ctx context.Context) []string {
+	conf, _ := ctx.Value(config.CtxKey()).(config.Config)
+	if conf.Podman.Rootful {
+		return []string{"sudo", "podman"}
+	}
+	return []string{"podman"}
+}
+
+// SaveImages saves the images of the rootless podman, or the rootful podman if rootful.
+func (p podmanRuntime) SaveImages(ctx context.Context, file string) (bool, error) {
+	// podman saves a single image without a multi-image archive
+	return environment.SaveImages(p.guest, imageCommand(ctx), file, "--multi-image-archive")
+}
+
+// LoadImages loads the images into the rootless podman, or the rootful podman if rootful.
+func (p podmanRuntime) LoadImages(ctx context.Context, file string) error {
+	return environment.LoadImages(p.guest, imageCommand(ctx), file)
+}
+
+func (p podmanRuntime) Dependencies() []string {
+	return []string{"podman"}
+}
+
+func (p podmanRuntime) Version(ctx context.Context) string {
+	rootless, _ := connections()
+	version, _ := p.host.RunOutput("podman", "--connection", rootless, "version", "--format", `client: v{{.Client.Version}}{{printf "\n"}}server: v{{.Server.Version}}`)
+	return version
+}
+
+func (p *podmanRuntime) Update(ctx context.Context) (bool, error) {
+	packages := []string{
+		"podman",
+		"crun",
+		"conmon",
+	}
+
+	return debutil.UpdateRuntime(ctx, p.guest, p, packages...)
+}
+
+// existingConnections returns the names of the podman system connections on the host.
+func (p podmanRuntime) existingConnections() []string {
+	out, err := p.host.RunOutput("podman", "system", "connection", "list", "--format", "{{.Name}}")
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(out)
+}
+
+// setupConnections creates the system connections of the rootless and rootful podman,
+// and sets the rootless or, if rootful, the rootful connection as the default if activate.
+func (p podmanRuntime) setupConnections(activate, rootful bool) error {
+	rootless, root := connections()
+	existing := p.existingConnections()
+
+	for name, socket := range map[string]string{
+		rootless: HostRootlessSocketFile(),
+		root:     HostSocketFile(),
+	} {
+		if slices.Contains(existing, name) {
+			continue
+		}
+		if err := p.host.RunQuiet("podman", "system", "connection", "add", name, "unix://"+socket); err != nil {
+			return fmt.Errorf("error creating podman connection '%s': %w", name, err)
+		}
+	}
+
+	if !activate {
+		return nil
+	}
+	name := rootless
+	if rootful {
+		name = root
+	}
+	return p.host.RunQuiet("podman", "system", "connection", "default", name)
+}
+
+// teardownConnections removes the system connections of the rootless and rootful podman.
+func (p podmanRuntime) teardownConnections() error {
+	existing := p.existingConnections()
+	rootless, root := connections()
+	for _, name := range []string{rootless, root} {
+		if !slices.Contains(existing, name) {
+			continue
+		}
+		if err := p.host.RunQuiet("podman", "system", "connection", "remove", name); err != nil {
+			return fmt.Errorf("error removing podman connection '%s': %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package apple
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/abiosoft/colima/environment"
+)
+
+const (
+	// Name is the vmType of the containerization framework of Apple.
+	Name = "apple"
+	// Runtime is the runtime of the containers, managed with the container CLI.
+	Runtime = "container"
+	// ProfileLabel is the label of the containers of a profile, stopped with the profile.
+	ProfileLabel = "dev.colima.profile"
+)
+
+// New returns the container system of the containerization framework.
+func New(host environment.HostActions) System {
+	return System{host: host}
+}
+
+// System is the system service of the container CLI. Each container runs in a lightweight VM
+// of its own, the service and the containers and images are shared by all the profiles.
+type System struct {
+	host environment.HostActions
+}
+
+// Start starts the system service, the default kernel of the containers is installed if missing.
+func (s System) Start() error {
+	return s.host.Run(Runtime, "system", "start", "--enable-kernel-install")
+}
+
+// Stop stops the system service and the running containers.
+func (s System) Stop() error {
+	return s.host.Run(Runtime, "system", "stop")
+}
+
+// Running returns if the system service is running.
+func (s System) Running() bool {
+	return s.host.RunQuiet(Runtime, "system", "status") == nil
+}
+
+// Version returns the version of the container CLI.
+func (s System) Version() string {
+	out, _ := s.host.RunOutput(Runtime, "--version")
+	return strings.TrimSpace(out)
+}
+
+// Run runs the container CLI with the args.
+func (s System) Run(args ...string) error {
+	return s.host.Run(append([]string{Runtime}, args...)...)
+}
+
+// ProfileContainers returns the IDs of the running containers with the label of the profile.
+func (s System) ProfileContainers(profile string) ([]string, error) {
+	out, err := s.host.RunOutput(Runtime, "list", "--format", "json")
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %w", err)
+	}
+	var containers []struct {
+		Status        string `json:"status"`
+		Configuration struct {
+			ID     string            `json:"id"`
+			Labels map[string]string `json:"labels"`
+		} `json:"configuration"`
+	}
+	if err := json.Unmarshal([]byte(out), &containers); err != nil {
+		return nil, fmt.Errorf("error decoding containers: %w", err)
+	}
+
+	var ids []string
+	for _, c := range containers {
+		if c.Status == "running" && c.Configuration.Labels[ProfileLabel] == profile {
+			ids = append(ids, c.Configuration.ID)
+		}
+	}
+	return ids, nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/daemon"
 	"github.com/abiosoft/colima/daemon/process/inotify"
+	"github.com/abiosoft/colima/daemon/process/routes"
 	"github.com/abiosoft/colima/daemon/process/vmnet"
 	"github.com/abiosoft/colima/environment/container/incus"
 	"github.com/abiosoft/colima/environment/vm/lima/limaconfig"
@@ -15,21 +16,66 @@ import (
 )
 
 func (l *limaVM) startDaemon(ctx context.Context, conf config.Config) (context.Context, error) {
-	// vmnet is used by QEMU and always used by incus (even with VZ)
-	useVmnet := conf.VMType == limaconfig.QEMU || conf.Runtime == incus.Name
+	// vmnet is used by QEMU and krunkit (GPU), always used by incus (even with VZ)
+	// and used by VZ for the modes other than shared (VZ NAT)
+	useVmnet := util.MacOS() && (conf.VMType == limaconfig.QEMU || conf.GPU || conf.Runtime == incus.Name ||
+		vmnet.PrimaryNetwork(conf.Network).Mode != vmnet.ModeShared)
+
+	// Pod and container routes are watched for VM IP address changes
+	watchRoutes := daemon.WatchRoutes(conf)
+
+	// mDNS advertises the reachable IP address
+	conf.Network.MDNS = conf.Network.MDNS && conf.Network.Address && (util.MacOS() || util.Linux())
+
+	// hosts file entries point to the reachable IP address
+	conf.Network.HostsFile = conf.Network.HostsFile && conf.Network.Address && (util.MacOS() || util.Linux())
+
+	// the SOCKS5 proxy uses ssh from the host
+	if !util.MacOS() && !util.Linux() {
+		conf.Network.SOCKSPort = 0
+	}
+
+	// the registry credentials are forwarded with ssh from the host
+	if !util.MacOS() && !util.Linux() {
+		conf.HostCredentials = false
+	}
+
+	// additional networks always use vmnet, regardless of the VM type
+	if !util.MacOS() || !conf.Network.Address {
+		conf.Network.Networks = nil
+	}
 
 	// network daemon is only needed for vmnet
 	conf.Network.Address = conf.Network.Address && useVmnet
+	useVmnet = useVmnet || len(conf.Network.Networks) > 0
+
+	// inotify is limited to macOS
+	conf.MountINotify = conf.MountINotify && util.MacOS()
 
-	// limited to macOS (with vmnet required)
-	// or with inotify enabled
-	if !util.MacOS() || (!conf.MountINotify && !conf.Network.Address) {
+	// the sshfs mounts combined with the mounts of Lima use ssh from the host
+	sshfsMounts := len(conf.SSHFSMounts()) > 0 && (util.MacOS() || util.Linux())
+
+	// the watchdog runs in the daemon
+	conf.Watchdog.Enabled = conf.Watchdog.Enabled && (util.MacOS() || util.Linux())
+
+	// the clock of the VM is synced over ssh from the host
+	conf.TimeSync = conf.TimeSync && (util.MacOS() || util.Linux())
+
+	// the LoadBalancer ports are forwarded with ssh from the host
+	lbPorts := conf.Kubernetes.Enabled && conf.Kubernetes.LoadBalancer.HostPorts && (util.MacOS() || util.Linux())
+
+	// limited to macOS (with vmnet required or with inotify enabled)
+	// or with route watcher enabled
+	if !daemonRequired(conf, watchRoutes, sshfsMounts, lbPorts) {
 		return ctx, nil
 	}
 
 	ctxKeyVmnet := daemon.CtxKey(vmnet.Name)
 	ctxKeyInotify := daemon.CtxKey(inotify.Name)
 
+	// the network address is disabled below for the VMs without vmnet
+	ctx = context.WithValue(ctx, daemon.CtxKey(routes.Name), watchRoutes)
+
 	// use a nested chain for convenience
 	a := l.Init(ctx)
 	log := a.Logger()
@@ -51,8 +97,10 @@ func (l *limaVM) startDaemon(ctx context.Context, conf config.Config) (context.C
 	// add network processes to daemon
 	if useVmnet {
 		a.Add(func() error {
-			if conf.Network.Address {
+			if conf.Network.Address || len(conf.Network.Networks) > 0 {
 				a.Stage("preparing network")
+			}
+			if conf.Network.Address {
 				ctx = context.WithValue(ctx, ctxKeyVmnet, true)
 			}
 			deps, root := l.daemon.Dependencies(ctx, conf)
@@ -84,7 +132,7 @@ func (l *limaVM) startDaemon(ctx context.Context, conf config.Config) (context.C
 
 	statusKey := struct{ key string }{key: "daemonStatus"}
 	// delay to ensure that the processes have started
-	if conf.Network.Address || conf.MountINotify {
+	if conf.Network.Address || len(conf.Network.Networks) > 0 || conf.MountINotify || conf.Network.MDNS || conf.Network.SOCKSPort > 0 || conf.Network.HostsFile || conf.HostCredentials || watchRoutes || lbPorts {
 		a.Retry("", time.Second*1, 15, func(i int) error {
 			s, err := l.daemon.Running(ctx, conf)
 			ctx = context.WithValue(ctx, statusKey, s)
@@ -151,3 +199,11 @@ func (l *limaVM) startDaemon(ctx context.Context, conf config.Config) (context.C
 
 	return ctx, nil
 }
+
+// daemonRequired returns if a process of the daemon is enabled for the config, with the
+// settings not supported by the host already disabled.
+func daemonRequired(conf config.Config, watchRoutes, sshfsMounts, lbPorts bool) bool {
+	return conf.MountINotify || conf.Network.Address || len(conf.Network.Networks) > 0 || conf.Network.MDNS ||
+		conf.Network.SOCKSPort > 0 || conf.Network.HostsFile || conf.HostCredentials || watchRoutes ||
+		sshfsMounts || lbPorts || conf.Watchdog.Enabled || conf.TimeSync
+}
@@ -0,0 +1,36 @@
+package lima
+
+import (
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+)
+
+func Test_daemonRequired(t *testing.T) {
+	type args struct {
+		conf        config.Config
+		watchRoutes bool
+		sshfsMounts bool
+		lbPorts     bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{name: "none", args: args{conf: config.Config{}}, want: false},
+		{name: "kubernetes without host ports", args: args{conf: config.Config{Kubernetes: config.Kubernetes{Enabled: true}}}, want: false},
+		{name: "loadbalancer host ports", args: args{lbPorts: true}, want: true},
+		{name: "network address", args: args{conf: config.Config{Network: config.Network{Address: true}}}, want: true},
+		{name: "route watcher", args: args{watchRoutes: true}, want: true},
+		{name: "sshfs mounts", args: args{sshfsMounts: true}, want: true},
+		{name: "time sync", args: args{conf: config.Config{TimeSync: true}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := daemonRequired(tt.args.conf, tt.args.watchRoutes, tt.args.sshfsMounts, tt.args.lbPorts); got != tt.want {
+				t.Errorf("daemonRequired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package lima
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util"
+)
+
+// resizeDisk grows the disk image to the size in GiB. Raw images e.g. of vz are extended in
+// place as sparse files, qcow2 images of qemu require qemu-img. Other formats are refused,
+// truncating them would corrupt the image.
+func (l limaVM) resizeDisk(disk string, size int) error {
+	format, err := limautil.DiskFormat(disk)
+	if err != nil {
+		return fmt.Errorf("cannot resize disk: %w", err)
+	}
+	if format == limautil.DiskFormatRaw {
+		return os.Truncate(disk, int64(size)<<30)
+	}
+
+	if err := util.AssertQemuImg(); err != nil {
+		return err
+	}
+	// qemu-img resize /path/to/diffdisk 100G
+	return l.host.RunQuiet("qemu-img", "resize", disk, fmt.Sprintf("%dG", size))
+}
+
+// growRootScript grows the partition and the filesystem of the root disk to the size of the
+// disk. growpart exits with 1 if the partition is already at the size of the disk.
+const growRootScript = `set -e
+dev="$(findmnt -no SOURCE /)"
+fstype="$(findmnt -no FSTYPE /)"
+disk="/dev/$(lsblk -no PKNAME "$dev")"
+part="$(cat "/sys/class/block/$(basename "$dev")/partition")"
+growpart "$disk" "$part" || [ $? -eq 1 ]
+case "$fstype" in
+ext4) resize2fs "$dev" ;;
+xfs) xfs_growfs / ;;
+btrfs) btrfs filesystem resize max / ;;
+*) echo "unsupported filesystem $fstype" >&2; exit 1 ;;
+esac
+`
+
+// growRootFilesystem grows the root filesystem of the VM after the disk is resized.
+func (l limaVM) growRootFilesystem() error {
+	return l.RunQuiet("sudo", "sh", "-c", growRootScript)
+}
+
+// growFilesystemScript grows the filesystem mounted at the mount point to the size of the
+// disk, the additional disks are formatted without a partition.
+const growFilesystemScript = `set -e
+dev="$(findmnt -no SOURCE "$1")"
+case "$(findmnt -no FSTYPE "$1")" in
+ext4) resize2fs "$dev" ;;
+xfs) xfs_growfs "$1" ;;
+esac
+`
+
+// syncDisks creates the missing additional disks of the config and grows the disks with an
+// increased size, for the filesystems to be grown after startup. The disks removed from the
+// config since the previous startup are deleted.
+func (l *limaVM) syncDisks(ctx context.Context, conf config.Config) error {
+	log := l.Logger(ctx)
+	l.resizedDisks = nil
+
+	// the disks of the previous startup are tracked in the state
+	state, stateErr := configmanager.LoadInstance()
+	for _, d := range state.Disks {
+		if slices.ContainsFunc(conf.Disks, func(c config.Disk) bool { return c.Name == d.Name }) {
+			continue
+		}
+		name := limautil.DiskName(config.CurrentProfile().ID, d.Name)
+		if !limautil.HasDisk(name) {
+			continue
+		}
+		log.Warnf("deleting disk %s removed from the config...", d.Name)
+		if err := limautil.DeleteDisk(name); err != nil {
+			log.Warnln(fmt.Errorf("unable to delete disk %s: %w", d.Name, err))
+		}
+	}
+
+	// track the disks before startup, the state is otherwise only saved after a successful startup
+	defer func() {
+		if stateErr != nil {
+			return
+		}
+		state.Disks = conf.Disks
+		if err := configmanager.SaveToFile(state, config.CurrentProfile().StateFile()); err != nil {
+			log.Warnln(fmt.Errorf("error persisting Colima state: %w", err))
+		}
+	}()
+
+	for _, d := range conf.Disks {
+		name := limautil.DiskName(config.CurrentProfile().ID, d.Name)
+		disk, err := limautil.Disk(name)
+		if err != nil {
+			log.Printf("creating disk %s of %dGiB...", d.Name, d.Size)
+			if err := limautil.CreateDisk(name, d.Size); err != nil {
+				return fmt.Errorf("error creating disk '%s': %w", d.Name, err)
+			}
+			continue
+		}
+
+		size := int64(d.Size) << 30
+		if size < disk.Size {
+			log.Warnf("size of disk %s cannot be reduced, ignoring...", d.Name)
+			continue
+		}
+		if size > disk.Size {
+			log.Printf("resizing disk %s to %dGiB...", d.Name, d.Size)
+			if err := limautil.ResizeDisk(name, d.Size); err != nil {
+				log.Warnln(fmt.Errorf("unable to resize disk %s: %w", d.Name, err))
+				continue
+			}
+			l.resizedDisks = append(l.resizedDisks, d.MountPointOrDefault())
+		}
+	}
+	return nil
+}
+
+// growDiskFilesystems grows the filesystems of the resized additional disks.
+func (l limaVM) growDiskFilesystems() error {
+	for _, mountPoint := range l.resizedDisks {
+		if err := l.RunQuiet("sudo", "sh", "-c", growFilesystemScript, "sh", mountPoint); err != nil {
+			return fmt.Errorf("error growing filesystem of %s: %w", mountPoint, err)
+		}
+	}
+	return nil
+}
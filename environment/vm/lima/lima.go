@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/abiosoft/colima/cli"
@@ -67,6 +69,12 @@ type limaVM struct {
 
 	// network between host and the vm
 	daemon daemon.Manager
+
+	// disk resized on startup, for the filesystem to be grown
+	diskResized bool
+
+	// mount points of the additional disks resized on startup
+	resizedDisks []string
 }
 
 func (l limaVM) Dependencies() []string {
@@ -101,13 +109,17 @@ func (l *limaVM) Start(ctx context.Context, conf config.Config) error {
 		return l.downloadDiskImage(ctx, conf)
 	})
 
+	a.Add(func() error {
+		return l.syncDisks(ctx, conf)
+	})
+
 	a.Add(func() error {
 		return yamlutil.WriteYAML(l.limaConf, confFile)
 	})
 
 	a.Add(l.writeNetworkFile)
 	a.Add(func() error {
-		return l.host.Run(limactl, "start", "--tty=false", confFile)
+		return l.startHost(conf).Run(limactl, "start", "--tty=false", confFile)
 	})
 	a.Add(func() error {
 		return os.Remove(confFile)
@@ -150,6 +162,10 @@ func (l *limaVM) resume(ctx context.Context, conf config.Config) error {
 
 	a.Add(l.setDiskImage)
 
+	a.Add(func() error {
+		return l.syncDisks(ctx, conf)
+	})
+
 	a.Add(func() error {
 		err := yamlutil.WriteYAML(l.limaConf, config.CurrentProfile().LimaFile())
 		return err
@@ -159,7 +175,7 @@ func (l *limaVM) resume(ctx context.Context, conf config.Config) error {
 
 	a.Stage("starting")
 	a.Add(func() error {
-		return l.host.Run(limactl, "start", config.CurrentProfile().ID)
+		return l.startHost(conf).Run(limactl, "start", config.CurrentProfile().ID)
 	})
 
 	l.addPostStartActions(a, conf)
@@ -186,7 +202,8 @@ func (l limaVM) Stop(ctx context.Context, force bool) error {
 
 	a.Stage("stopping")
 
-	if util.MacOS() {
+	// the daemon runs on Linux for the route watcher
+	if util.MacOS() || util.Linux() {
 		conf, _ := configmanager.LoadInstance()
 		a.Retry("", time.Second*1, 10, func(retryCount int) error {
 			err := l.daemon.Stop(ctx, conf)
@@ -212,8 +229,10 @@ func (l limaVM) Stop(ctx context.Context, force bool) error {
 func (l limaVM) Teardown(ctx context.Context) error {
 	a := l.Init(ctx)
 
-	if util.MacOS() {
-		conf, _ := configmanager.LoadInstance()
+	conf, _ := configmanager.LoadInstance()
+
+	// the daemon runs on Linux for the route watcher
+	if util.MacOS() || util.Linux() {
 		a.Retry("", time.Second*1, 10, func(retryCount int) error {
 			return l.daemon.Stop(ctx, conf)
 		})
@@ -223,6 +242,28 @@ func (l limaVM) Teardown(ctx context.Context) error {
 		return l.host.Run(limactl, "delete", "--force", config.CurrentProfile().ID)
 	})
 
+	// the additional disks are not deleted with the instance, the disks of the config are
+	// included for the disks created before a failed first startup
+	a.Add(func() error {
+		disks := conf.Disks
+		if current, err := configmanager.LoadFrom(config.CurrentProfile().File()); err == nil {
+			for _, d := range current.Disks {
+				if !slices.ContainsFunc(disks, func(s config.Disk) bool { return s.Name == d.Name }) {
+					disks = append(disks, d)
+				}
+			}
+		}
+		for _, d := range disks {
+			name := limautil.DiskName(config.CurrentProfile().ID, d.Name)
+			if limautil.HasDisk(name) {
+				if err := limautil.DeleteDisk(name); err != nil {
+					logrus.Warnln(fmt.Errorf("unable to delete disk %s: %w", d.Name, err))
+				}
+			}
+		}
+		return nil
+	})
+
 	return a.Exec()
 }
 
@@ -274,6 +315,16 @@ func (l limaVM) Arch() environment.Arch {
 func (l *limaVM) downloadDiskImage(ctx context.Context, conf config.Config) error {
 	log := l.Logger(ctx)
 
+	// use a user specified disk image of any origin, verified with the digest
+	if conf.DiskImage != "" && conf.DiskImageDigest != "" {
+		image, err := l.customDiskImage(conf.DiskImage, conf.DiskImageDigest)
+		if err != nil {
+			return err
+		}
+		l.limaConf.Images = []limaconfig.File{image}
+		return nil
+	}
+
 	// use a user specified disk image
 	if conf.DiskImage != "" {
 		if _, err := os.Stat(conf.DiskImage); err != nil {
@@ -312,6 +363,33 @@ func (l *limaVM) downloadDiskImage(ctx context.Context, conf config.Config) erro
 	return nil
 }
 
+// customDiskImage returns the custom disk image at location, a file path or a URL downloaded
+// to the cache, verified with the digest.
+func (l *limaVM) customDiskImage(location, digest string) (limaconfig.File, error) {
+	sha := downloader.SHA{Size: 256, Digest: digest}
+	if strings.HasPrefix(digest, "sha512:") {
+		sha.Size = 512
+	}
+
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		logrus.Infoln("downloading disk image ...")
+		file, err := downloader.Download(l.host, downloader.Request{URL: location, SHA: &sha})
+		if err != nil {
+			return limaconfig.File{}, fmt.Errorf("error downloading disk image: %w", err)
+		}
+		location = file
+	} else {
+		if _, err := os.Stat(location); err != nil {
+			return limaconfig.File{}, fmt.Errorf("invalid disk image: %w", err)
+		}
+		if err := sha.ValidateFile(l.host, location); err != nil {
+			return limaconfig.File{}, fmt.Errorf("disk image does not match diskImageDigest: %w", err)
+		}
+	}
+
+	return limaconfig.File{Location: location, Arch: l.limaConf.Arch}, nil
+}
+
 func (l *limaVM) setDiskImage() error {
 	var c limaconfig.Config
 	b, err := os.ReadFile(config.CurrentProfile().LimaFile())
@@ -346,18 +424,8 @@ func (l *limaVM) syncDiskSize(ctx context.Context, conf config.Config) config.Co
 			return false
 		}
 
-		if err := util.AssertQemuImg(); err != nil {
-			log.Warnln(fmt.Errorf("unable to resize disk: %w", err))
-			return false
-		}
-
-		sizeStr := fmt.Sprintf("%dG", conf.Disk)
-		args := []string{"qemu-img", "resize"}
 		disk := limautil.ColimaDiffDisk(config.CurrentProfile().ID)
-		args = append(args, disk, sizeStr)
-
-		// qemu-img resize /path/to/diffdisk +10G
-		if err := l.host.RunQuiet(args...); err != nil {
+		if err := l.resizeDisk(disk, conf.Disk); err != nil {
 			log.Warnln(fmt.Errorf("unable to resize disk: %w", err))
 			return false
 		}
@@ -369,11 +437,44 @@ func (l *limaVM) syncDiskSize(ctx context.Context, conf config.Config) config.Co
 	if !resized {
 		conf.Disk = instance.Disk
 	}
+	l.diskResized = resized
 
 	return conf
 }
 
 func (l *limaVM) addPostStartActions(a *cli.ActiveCommandChain, conf config.Config) {
+	// grow the root filesystem to the resized disk
+	a.Add(func() error {
+		if !l.diskResized {
+			return nil
+		}
+		if err := l.growRootFilesystem(); err != nil {
+			logrus.Warnln(fmt.Errorf("unable to grow the filesystem to the disk size: %w", err))
+		}
+		return nil
+	})
+	a.Add(func() error {
+		if err := l.growDiskFilesystems(); err != nil {
+			logrus.Warnln(fmt.Errorf("unable to grow the filesystem to the disk size: %w", err))
+		}
+		return nil
+	})
+
+	// usb devices are hotplugged over QMP on the USB controller of the qemu VM
+	a.Add(func() error {
+		for i, u := range conf.USBDevices {
+			vendorID, productID, err := u.IDs()
+			if err != nil {
+				return err
+			}
+			id := fmt.Sprintf("colima-usb%d", i)
+			if err := limautil.AttachUSBDevice(config.CurrentProfile().ID, id, vendorID, productID); err != nil {
+				logrus.Warnln(err)
+			}
+		}
+		return nil
+	})
+
 	// registry certs
 	a.Add(l.copyCerts)
 
@@ -439,3 +540,14 @@ func (l *limaVM) assertQemu() error {
 	}
 	return nil
 }
+
+// startHost returns the host for starting the VM. The extra qemu args of the config are passed
+// to Lima with the QEMU_SYSTEM_<ARCH> variable, the args are appended to the qemu binary.
+func (l limaVM) startHost(conf config.Config) environment.HostActions {
+	if len(conf.VMOpts.QEMU.Args) == 0 || l.limaConf.VMType != limaconfig.QEMU {
+		return l.host
+	}
+	arch := string(environment.Arch(l.limaConf.Arch).Value())
+	command := append([]string{"qemu-system-" + arch}, conf.VMOpts.QEMU.Args...)
+	return l.host.WithEnv("QEMU_SYSTEM_" + strings.ToUpper(arch) + "=" + shellQuote(command))
+}
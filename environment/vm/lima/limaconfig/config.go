@@ -31,6 +31,12 @@ type Config struct {
 	Provision            []Provision       `yaml:"provision,omitempty" json:"provision,omitempty"`
 	Rosetta              Rosetta           `yaml:"rosetta,omitempty" json:"rosetta,omitempty"`
 	NestedVirtualization bool              `yaml:"nestedVirtualization,omitempty" json:"nestedVirtualization,omitempty"`
+	Video                Video             `yaml:"video,omitempty" json:"video,omitempty"`
+}
+
+type Video struct {
+	// Display is "none", "default", "vnc" or "vz" for the vz GUI window.
+	Display *string `yaml:"display,omitempty" json:"display,omitempty"`
 }
 
 type File struct {
@@ -71,7 +77,8 @@ type Firmware struct {
 }
 
 type VMOpts struct {
-	QEMU QEMUOpts `yaml:"qemu,omitempty" json:"qemu,omitempty"`
+	QEMU QEMUOpts       `yaml:"qemu,omitempty" json:"qemu,omitempty"`
+	VZ   map[string]any `yaml:"vz,omitempty" json:"vz,omitempty"`
 }
 
 type QEMUOpts struct {
@@ -93,8 +100,9 @@ const (
 	NINEP    MountType = "9p"
 	VIRTIOFS MountType = "virtiofs"
 
-	QEMU VMType = "qemu"
-	VZ   VMType = "vz"
+	QEMU    VMType = "qemu"
+	VZ      VMType = "vz"
+	Krunkit VMType = "krunkit"
 )
 
 type PortForward struct {
@@ -4,36 +4,51 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-
-	"github.com/abiosoft/colima/config"
+	"io"
+	"os"
 )
 
-// HasDisk checks if a lima disk exists for the current instance.
-func HasDisk() bool {
-	name := config.CurrentProfile().ID
+// DiskName returns the name of the lima disk of the additional disk of the profile, the lima
+// disks are shared by the instances.
+func DiskName(profileID, name string) string {
+	return profileID + "-" + name
+}
 
-	var resp struct {
-		Name string `json:"name"`
-	}
+// DiskInfo is the information about a lima disk.
+type DiskInfo struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Disk returns the lima disk with the name.
+func Disk(name string) (DiskInfo, error) {
+	var resp DiskInfo
 
 	cmd := Limactl("disk", "list", "--json", name)
+	cmd.Stderr = nil
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
 
 	if err := cmd.Run(); err != nil {
-		return false
+		return resp, fmt.Errorf("error retrieving lima disk: %w", err)
 	}
-
 	if err := json.NewDecoder(&buf).Decode(&resp); err != nil {
-		return false
+		return resp, fmt.Errorf("error retrieving lima disk: %w", err)
 	}
+	if resp.Name != name {
+		return resp, fmt.Errorf("lima disk '%s' not found", name)
+	}
+	return resp, nil
+}
 
-	return resp.Name == name
+// HasDisk checks if the lima disk with the name exists.
+func HasDisk(name string) bool {
+	_, err := Disk(name)
+	return err == nil
 }
 
 // CreateDisk creates a lima disk with size in GiB.
-func CreateDisk(size int) error {
-	name := config.CurrentProfile().ID
+func CreateDisk(name string, size int) error {
 	cmd := Limactl("disk", "create", name, "--size", fmt.Sprintf("%dGiB", size))
 
 	if err := cmd.Run(); err != nil {
@@ -43,9 +58,19 @@ func CreateDisk(size int) error {
 	return nil
 }
 
-// DeleteDisk deletes lima disk for the current instance.
-func DeleteDisk() error {
-	name := config.CurrentProfile().ID
+// ResizeDisk grows the lima disk to size in GiB.
+func ResizeDisk(name string, size int) error {
+	cmd := Limactl("disk", "resize", name, "--size", fmt.Sprintf("%dGiB", size))
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error resizing lima disk: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteDisk deletes the lima disk with the name.
+func DeleteDisk(name string) error {
 	cmd := Limactl("disk", "delete", name)
 
 	if err := cmd.Run(); err != nil {
@@ -54,3 +79,59 @@ func DeleteDisk() error {
 
 	return nil
 }
+
+// Disk image formats.
+const (
+	DiskFormatQcow2 = "qcow2"
+	DiskFormatRaw   = "raw"
+)
+
+// qcow2Magic is the header of a qcow2 disk image.
+var qcow2Magic = []byte{'Q', 'F', 'I', 0xfb}
+
+// asifMagic is the header of an ASIF (Apple sparse image format) disk image.
+var asifMagic = []byte{'s', 'h', 'd', 'w'}
+
+// DiskFormat returns the format of the disk image. Raw images have no header and are
+// identified by the partition table of the root disk.
+func DiskFormat(disk string) (string, error) {
+	f, err := os.Open(disk)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	header := make([]byte, 1024)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return "", fmt.Errorf("error reading disk header: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(header, qcow2Magic):
+		return DiskFormatQcow2, nil
+	case bytes.HasPrefix(header, asifMagic):
+		return "", fmt.Errorf("unsupported disk image format 'asif' of %s", disk)
+	// GPT header
+	case bytes.Equal(header[512:520], []byte("EFI PART")):
+		return DiskFormatRaw, nil
+	// MBR boot signature
+	case header[510] == 0x55 && header[511] == 0xaa:
+		return DiskFormatRaw, nil
+	}
+	return "", fmt.Errorf("unknown disk image format of %s", disk)
+}
+
+// IsQcow2 returns if the disk image is in the qcow2 format.
+func IsQcow2(disk string) (bool, error) {
+	f, err := os.Open(disk)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	header := make([]byte, len(qcow2Magic))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false, fmt.Errorf("error reading disk header: %w", err)
+	}
+	return bytes.Equal(header, qcow2Magic), nil
+}
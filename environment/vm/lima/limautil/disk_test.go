@@ -0,0 +1,44 @@
+package limautil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskFormat(t *testing.T) {
+	header := func(offset int, magic ...byte) []byte {
+		b := make([]byte, 2048)
+		copy(b[offset:], magic)
+		return b
+	}
+
+	tests := []struct {
+		name    string
+		header  []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "qcow2", header: header(0, qcow2Magic...), want: DiskFormatQcow2},
+		{name: "raw gpt", header: header(512, []byte("EFI PART")...), want: DiskFormatRaw},
+		{name: "raw mbr", header: header(510, 0x55, 0xaa), want: DiskFormatRaw},
+		{name: "asif", header: header(0, asifMagic...), wantErr: true},
+		{name: "unknown", header: header(0), wantErr: true},
+		{name: "truncated", header: qcow2Magic, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			disk := filepath.Join(t.TempDir(), "disk")
+			if err := os.WriteFile(disk, tt.header, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := DiskFormat(disk)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DiskFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DiskFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -13,6 +13,13 @@ func ColimaDiffDisk(profileID string) string {
 	return filepath.Join(config.ProfileFromName(profileID).LimaInstanceDir(), colimaDiffDiskFile)
 }
 
+const colimaSnapshotsDir = "snapshots"
+
+// ColimaSnapshotsDir returns path to the dir of the disk snapshots of the colima VM.
+func ColimaSnapshotsDir(profileID string) string {
+	return filepath.Join(config.ProfileFromName(profileID).LimaInstanceDir(), colimaSnapshotsDir)
+}
+
 const networkFile = "networks.yaml"
 
 // NetworkFile returns path to the network file.
@@ -24,3 +31,8 @@ func NetworkFile() string {
 func NetworkAssetsDirectory() string {
 	return filepath.Join(config.LimaDir(), "_networks")
 }
+
+// DiskFile returns the path to the image of the lima disk.
+func DiskFile(name string) string {
+	return filepath.Join(config.LimaDir(), "_disks", name, "datadisk")
+}
@@ -42,7 +42,7 @@ func ImageCached(arch environment.Arch, runtime string) (limaconfig.File, bool)
 func findImage(arch environment.Arch, runtime string) (f limaconfig.File, err error) {
 	err = fmt.Errorf("cannot find %s image for %s runtime", arch, runtime)
 
-	imgFile, ok := diskImageMap[runtime]
+	imgFile, ok := diskImageMap[imageRuntime(runtime)]
 	if !ok {
 		return
 	}
@@ -53,6 +53,15 @@ func findImage(arch environment.Arch, runtime string) (f limaconfig.File, err er
 	return img, nil
 }
 
+// imageRuntime returns the runtime of the disk image for the runtime.
+// podman is installed on first startup on the disk image without a runtime.
+func imageRuntime(runtime string) string {
+	if runtime == "podman" {
+		return "none"
+	}
+	return runtime
+}
+
 // Image returns the details of the disk image to download for the arch and runtime.
 func Image(arch environment.Arch, runtime string) (limaconfig.File, error) {
 	return findImage(arch, runtime)
@@ -16,6 +16,11 @@ func Instance() (InstanceInfo, error) {
 	return getInstance(config.CurrentProfile().ID)
 }
 
+// ProfileInstance returns the instance of the profile.
+func ProfileInstance(profileID string) (InstanceInfo, error) {
+	return getInstance(profileID)
+}
+
 // InstanceInfo is the information about a Lima instance
 type InstanceInfo struct {
 	Name    string `json:"name,omitempty"`
@@ -141,7 +146,7 @@ func getRuntime(conf config.Config) string {
 	var runtime string
 
 	switch conf.Runtime {
-	case "docker", "containerd", "incus":
+	case "docker", "containerd", "incus", "podman":
 		runtime = conf.Runtime
 	case "none":
 		return "none"
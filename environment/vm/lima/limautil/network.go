@@ -2,6 +2,7 @@ package limautil
 
 import (
 	"bytes"
+	"strconv"
 	"strings"
 )
 
@@ -11,6 +12,19 @@ const NetInterface = "col0"
 // network metric for the route
 const NetMetric = 300
 
+// network interface for the user-v2 network in the virtual machine.
+const UserNetInterface = "eth0"
+
+// NetworkInterface returns the network interface in the virtual machine for the additional network at index.
+// Indexes start at 1, NetInterface is the reachable network.
+func NetworkInterface(index int) string { return "col" + strconv.Itoa(index) }
+
+// InterfaceIPAddress returns the ip address of the network interface for profile.
+// An empty string is returned if the address cannot be retrieved.
+func InterfaceIPAddress(profileID, interfaceName string) string {
+	return getIPAddress(profileID, interfaceName)
+}
+
 // IPAddress returns the ip address for profile.
 // It returns the PTP address if networking is enabled or falls back to 127.0.0.1.
 // It is guaranteed to return a value.
@@ -34,6 +48,25 @@ func IPAddress(profileID string) string {
 	return fallback
 }
 
+// UserNetIPAddress returns the ip address of the user-v2 network interface for profile.
+// An empty string is returned if the address cannot be retrieved.
+func UserNetIPAddress(profileID string) string {
+	return getIPAddress(profileID, UserNetInterface)
+}
+
+// IPv6Address returns the global IPv6 address of the network interface for profile.
+// An empty string is returned if the interface has no global IPv6 address.
+func IPv6Address(profileID, interfaceName string) string {
+	var buf bytes.Buffer
+	cmd := Limactl("shell", profileID, "sh", "-c",
+		`ip -6 addr show `+interfaceName+` scope global | grep inet6 | awk -F' ' '{print $2 }' | cut -d/ -f1 | head -n1`)
+	cmd.Stderr = nil
+	cmd.Stdout = &buf
+
+	_ = cmd.Run()
+	return strings.TrimSpace(buf.String())
+}
+
 func getIPAddress(profileID, interfaceName string) string {
 	var buf bytes.Buffer
 	// TODO: this should be less hacky
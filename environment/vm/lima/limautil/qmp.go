@@ -0,0 +1,84 @@
+package limautil
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+)
+
+// QMPSocket returns the path to the QMP socket of the qemu VM of the profile.
+func QMPSocket(profileID string) string {
+	return filepath.Join(config.ProfileFromName(profileID).LimaInstanceDir(), "qmp.sock")
+}
+
+// QMP runs the QMP command with the arguments, if any, on the qemu VM of the profile and returns
+// the result.
+func QMP(profileID string, command string, args map[string]any) (json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", QMPSocket(profileID), 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to qemu: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+
+	// the greeting is followed by the capabilities negotiation
+	var greeting map[string]json.RawMessage
+	if err := dec.Decode(&greeting); err != nil {
+		return nil, fmt.Errorf("error reading qemu greeting: %w", err)
+	}
+	for _, c := range []string{"qmp_capabilities", command} {
+		req := map[string]any{"execute": c}
+		if c == command && args != nil {
+			req["arguments"] = args
+		}
+		if err := enc.Encode(req); err != nil {
+			return nil, fmt.Errorf("error sending qemu command '%s': %w", c, err)
+		}
+		for {
+			var resp struct {
+				Return json.RawMessage `json:"return"`
+				Error  *struct {
+					Desc string `json:"desc"`
+				} `json:"error"`
+				Event string `json:"event"`
+			}
+			if err := dec.Decode(&resp); err != nil {
+				return nil, fmt.Errorf("error reading qemu response: %w", err)
+			}
+			if resp.Event != "" {
+				// asynchronous events are not responses
+				continue
+			}
+			if resp.Error != nil {
+				return nil, fmt.Errorf("error running qemu command '%s': %s", c, resp.Error.Desc)
+			}
+			if c == command {
+				return resp.Return, nil
+			}
+			break
+		}
+	}
+	return nil, nil
+}
+
+// Paused returns if the qemu VM of the profile is paused.
+func Paused(profileID string) bool {
+	out, err := QMP(profileID, "query-status", nil)
+	if err != nil {
+		return false
+	}
+	var status struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(out, &status); err != nil {
+		return false
+	}
+	return status.Status == "paused"
+}
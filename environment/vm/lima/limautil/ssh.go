@@ -52,6 +52,27 @@ func replaceSSHConfig(conf string, profileID string) string {
 
 const sshConfigFile = "ssh.config"
 
+// SSHConfigFile returns the path to the Lima SSH config file for profile.
+func SSHConfigFile(profileID string) string { return sshConfig(profileID).File() }
+
+// SSHHost returns the host for profile in the Lima SSH config file.
+func SSHHost(profileID string) string { return "lima-" + config.ProfileFromName(profileID).ID }
+
+// SSHArgs returns the ssh args for a dedicated connection to the VM of profile, with the
+// options before the host. A dedicated connection is used to not be affected by the shared
+// connection of Lima, and the connection is closed when the VM is unreachable.
+func SSHArgs(profileID string, opts ...string) []string {
+	args := []string{
+		"-F", SSHConfigFile(profileID),
+		"-o", "ControlMaster=no",
+		"-o", "ControlPath=none",
+		"-o", "ServerAliveInterval=10",
+		"-o", "ServerAliveCountMax=3",
+	}
+	args = append(args, opts...)
+	return append(args, SSHHost(profileID))
+}
+
 // sshConfig is the ssh configuration file for a Colima profile.
 type sshConfig string
 
@@ -0,0 +1,19 @@
+package limautil
+
+import "fmt"
+
+// AttachUSBDevice passes the USB device of the host with the vendor and product ids through to
+// the running qemu VM of the profile, on the USB controller of the VM. The device is detached
+// when the VM stops.
+func AttachUSBDevice(profileID string, id string, vendorID, productID uint16) error {
+	_, err := QMP(profileID, "device_add", map[string]any{
+		"driver":    "usb-host",
+		"id":        id,
+		"vendorid":  vendorID,
+		"productid": productID,
+	})
+	if err != nil {
+		return fmt.Errorf("error attaching USB device %04x:%04x: %w", vendorID, productID, err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package limautil
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+)
+
+// VNCPasswordFile returns the path to the VNC password file of the VM of the profile, written
+// by Lima on startup.
+func VNCPasswordFile(profileID string) string {
+	return filepath.Join(config.ProfileFromName(profileID).LimaInstanceDir(), "vncpassword")
+}
+
+// VNCAddress returns the vnc:// address of the display of the VM of the profile.
+// Lima writes the qemu display e.g. 127.0.0.1:0 on startup, on port 5900 + display.
+func VNCAddress(profileID string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(config.ProfileFromName(profileID).LimaInstanceDir(), "vncdisplay"))
+	if err != nil {
+		return "", fmt.Errorf("error retrieving VNC display: %w", err)
+	}
+	host, display, ok := strings.Cut(strings.TrimSpace(string(b)), ":")
+	if !ok {
+		return "", fmt.Errorf("invalid VNC display: '%s'", string(b))
+	}
+	n, err := strconv.Atoi(display)
+	if err != nil {
+		return "", fmt.Errorf("invalid VNC display: '%s'", string(b))
+	}
+	return "vnc://" + net.JoinHostPort(host, strconv.Itoa(5900+n)), nil
+}
@@ -6,19 +6,27 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/abiosoft/colima/daemon"
 	"github.com/abiosoft/colima/daemon/process/vmnet"
 
 	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process/credentials"
 	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/buildkit"
 	"github.com/abiosoft/colima/environment/container/containerd"
 	"github.com/abiosoft/colima/environment/container/docker"
 	"github.com/abiosoft/colima/environment/container/incus"
+	"github.com/abiosoft/colima/environment/container/podman"
 	"github.com/abiosoft/colima/environment/vm/lima/limaconfig"
 	"github.com/abiosoft/colima/environment/vm/lima/limautil"
 	"github.com/abiosoft/colima/util"
+	"github.com/abiosoft/colima/util/cloudinit"
+	"github.com/abiosoft/colima/util/pkgutil"
+	"github.com/abiosoft/colima/util/proxy"
 	"github.com/sirupsen/logrus"
 )
 
@@ -45,17 +53,52 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 			}
 		}
 
-		if util.MacOSNestedVirtualizationSupported() {
-			l.NestedVirtualization = conf.NestedVirtualization
+		if conf.NestedVirtualization {
+			if util.MacOSNestedVirtualizationSupported() {
+				l.NestedVirtualization = true
+			} else {
+				logrus.Warnln("nested virtualization requires an M3 or newer chip and macOS 15 or newer, ignoring")
+			}
 		}
 	}
 
+	// GPU acceleration is provided by krunkit with virtio-gpu Venus, with the host requirements
+	// of vz but without Rosetta and nested virtualization.
+	if conf.GPU && l.VMType == limaconfig.VZ {
+		l.VMType = limaconfig.Krunkit
+		l.Rosetta = limaconfig.Rosetta{}
+		if l.NestedVirtualization {
+			logrus.Warnln("nested virtualization is not supported with GPU acceleration, ignoring")
+		}
+		l.NestedVirtualization = false
+	}
+
 	if conf.CPUType != "" && conf.CPUType != "host" {
 		l.VMOpts.QEMU.CPUType = map[environment.Arch]string{
 			l.Arch: conf.CPUType,
 		}
 	}
 
+	// the display of the VM, the GUI window of vz or the default window of qemu
+	display := ""
+	switch conf.Display {
+	case "vnc":
+		display = "vnc"
+	case "window":
+		display = "default"
+		if l.VMType == limaconfig.VZ {
+			display = "vz"
+		}
+	}
+	if display != "" {
+		l.Video.Display = &display
+	}
+
+	// the vz options are passed through, the qemu args are passed on startup
+	if len(conf.VMOpts.VZ) > 0 && l.VMType == limaconfig.VZ {
+		l.VMOpts.VZ = conf.VMOpts.VZ
+	}
+
 	if conf.CPU > 0 {
 		l.CPUs = &conf.CPU
 	}
@@ -79,9 +122,27 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 		l.HostResolver.Hosts["host.docker.internal"] = "host.lima.internal"
 	}
 
-	l.Env = conf.Env
-	if l.Env == nil {
-		l.Env = make(map[string]string)
+	// search domains and resolvers per domain
+	l.Provision = append(l.Provision, limaconfig.Provision{
+		Mode:   limaconfig.ProvisionModeSystem,
+		Script: resolvedScript(conf.Network.DNSSearch, conf.Network.DNSDomains),
+	})
+
+	l.Env = make(map[string]string)
+	for k, v := range conf.Env {
+		l.Env[k] = v
+	}
+
+	// proxy settings of the host, the VM IP address is only known in advance if static
+	{
+		var vmIP string
+		if conf.Network.StaticIP != nil {
+			vmIP = conf.Network.StaticIP.String()
+		}
+		proxies := proxy.Resolve(conf).Guest(proxy.GuestHost).WithNoProxy(proxy.NoProxyDefaults(conf, vmIP)...)
+		for k, v := range proxies.Env() {
+			l.Env[k] = v
+		}
 	}
 
 	// extra required provision commands
@@ -92,6 +153,32 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 			Script: "sysctl -w fs.inotify.max_user_watches=1048576",
 		})
 
+		// kernel modules and sysctls of the config, after the defaults to override them
+		l.Provision = append(l.Provision, limaconfig.Provision{
+			Mode:   limaconfig.ProvisionModeSystem,
+			Script: guestKernelScript(conf.Guest),
+		})
+
+		// allow reverse port forwards to listen on the addresses requested by the client,
+		// for access from the containers.
+		l.Provision = append(l.Provision, limaconfig.Provision{
+			Mode:   limaconfig.ProvisionModeBoot,
+			Script: sshdConfigScript("/etc/ssh/sshd_config.d/99-colima.conf", "GatewayPorts clientspecified"),
+		})
+
+		// dir of the forwarded socket of the registry credentials of the host, the stale
+		// socket of a previous connection is replaced.
+		if conf.HostCredentials {
+			l.Provision = append(l.Provision, limaconfig.Provision{
+				Mode: limaconfig.ProvisionModeBoot,
+				Script: strings.Join([]string{
+					sshdConfigScript("/etc/ssh/sshd_config.d/99-colima-credentials.conf", "StreamLocalBindUnlink yes"),
+					"mkdir -p " + credentials.GuestDir,
+					"chown {{ .User }} " + credentials.GuestDir,
+				}, "\n"),
+			})
+		}
+
 		// add user to docker group
 		// "sudo", "usermod", "-aG", "docker", user
 		if conf.Runtime == docker.Name {
@@ -120,6 +207,22 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 			Script: "hostnamectl set-hostname " + hostname,
 		})
 
+		// KVM for the user and the containers, with the nested virtualization of vz, or of qemu
+		// with the KVM of a Linux host
+		if l.NestedVirtualization || (conf.NestedVirtualization && l.VMType == limaconfig.QEMU && util.LinuxNestedVirtualizationSupported()) {
+			l.Provision = append(l.Provision, limaconfig.Provision{
+				Mode:   limaconfig.ProvisionModeSystem,
+				Script: kvmScript,
+			})
+		}
+
+		// Vulkan driver and CDI spec of the GPU for the containers
+		if conf.GPU {
+			l.Provision = append(l.Provision, limaconfig.Provision{
+				Mode:   limaconfig.ProvisionModeSystem,
+				Script: gpuScript(),
+			})
+		}
 	}
 
 	// network setup
@@ -130,8 +233,8 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 
 		reachableIPAddress := true
 		if conf.Network.Address {
-			// incus always uses vmnet
-			if l.VMType == limaconfig.VZ && conf.Runtime != incus.Name {
+			// incus always uses vmnet, VZ NAT only provides the shared mode
+			if l.VMType == limaconfig.VZ && conf.Runtime != incus.Name && vmnet.PrimaryNetwork(conf.Network).Mode == vmnet.ModeShared {
 				l.Networks = append(l.Networks, limaconfig.Network{
 					VZNAT:     true,
 					Interface: limautil.NetInterface,
@@ -163,9 +266,34 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 				}
 			}
 
+			// additional networks
+			if util.MacOS() {
+				for i, n := range conf.Network.Networks {
+					index := i + 1
+					socketFile := vmnet.NetworkInfo(index).Socket.File()
+					if _, err := os.Stat(socketFile); err != nil {
+						logrus.Warn(fmt.Errorf("error setting up %s network: vmnet socket file not found: %w", n.Mode, err))
+						continue
+					}
+					l.Networks = append(l.Networks, limaconfig.Network{
+						Socket:    socketFile,
+						Interface: limautil.NetworkInterface(index),
+						Metric:    limautil.NetMetric + uint32(index),
+					})
+				}
+			}
+
+			// keep the reachable IP address stable across restarts
+			if reachableIPAddress {
+				l.Provision = append(l.Provision, limaconfig.Provision{
+					Mode:   limaconfig.ProvisionModeSystem,
+					Script: staticIPScript(conf.Network.StaticIP),
+				})
+			}
+
 			// disable ports 80 and 443 when k8s is enabled and there is a reachable IP address
-			// to prevent ingress (traefik) from occupying relevant host ports.
-			if reachableIPAddress && conf.Kubernetes.Enabled && !ingressDisabled(conf.Kubernetes.K3sArgs) {
+			// to prevent ingress (traefik or nginx) from occupying relevant host ports.
+			if reachableIPAddress && conf.Kubernetes.Enabled && ingressEnabled(conf.Kubernetes) {
 				l.PortForwards = append(l.PortForwards,
 					limaconfig.PortForward{
 						GuestIP:           net.ParseIP("0.0.0.0"),
@@ -184,6 +312,18 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 				)
 			}
 
+			// incus HTTPS API, must precede the rules below as the first matching rule applies
+			if conf.Runtime == incus.Name && conf.Incus.APIPort > 0 {
+				l.PortForwards = append(l.PortForwards,
+					limaconfig.PortForward{
+						GuestIP:   net.ParseIP("127.0.0.1"),
+						GuestPort: incus.GuestAPIPort,
+						HostIP:    net.ParseIP("127.0.0.1"),
+						HostPort:  conf.Incus.APIPort,
+						Proto:     limaconfig.TCP,
+					})
+			}
+
 			// disable port forwarding for Incus when there is a reachable IP address for consistent behaviour
 			if reachableIPAddress && conf.Runtime == incus.Name {
 				l.PortForwards = append(l.PortForwards,
@@ -195,6 +335,14 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 						Ignore:            true,
 						Proto:             limaconfig.TCP,
 					},
+					limaconfig.PortForward{
+						GuestIP:           net.ParseIP("0.0.0.0"),
+						GuestIPMustBeZero: true,
+						GuestPortRange:    [2]int{1, 65535},
+						HostPortRange:     [2]int{1, 65535},
+						Ignore:            true,
+						Proto:             limaconfig.UDP,
+					},
 					limaconfig.PortForward{
 						GuestIP:        net.ParseIP("127.0.0.1"),
 						GuestPortRange: [2]int{1, 65535},
@@ -202,11 +350,40 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 						Ignore:         true,
 						Proto:          limaconfig.TCP,
 					},
+					limaconfig.PortForward{
+						GuestIP:        net.ParseIP("127.0.0.1"),
+						GuestPortRange: [2]int{1, 65535},
+						HostPortRange:  [2]int{1, 65535},
+						Ignore:         true,
+						Proto:          limaconfig.UDP,
+					},
 				)
 			}
 		}
+
+		// IPv6 address assignment via router advertisements
+		if conf.Network.IPv6 {
+			l.Provision = append(l.Provision, limaconfig.Provision{
+				Mode:   limaconfig.ProvisionModeSystem,
+				Script: ipv6Script(),
+			})
+		}
+
+		// MTU of the network interfaces, applied after the static IP address
+		if conf.Network.MTU > 0 {
+			l.Provision = append(l.Provision, limaconfig.Provision{
+				Mode:   limaconfig.ProvisionModeSystem,
+				Script: mtuScript(conf.Network.MTU),
+			})
+		}
 	}
 
+	// swap, the swap file is removed when disabled
+	l.Provision = append(l.Provision, limaconfig.Provision{
+		Mode:   limaconfig.ProvisionModeSystem,
+		Script: swapScript(conf.Swap),
+	})
+
 	// ports and sockets
 	{
 		// docker socket
@@ -235,7 +412,7 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 		}
 
 		// containerd socket
-		if conf.Runtime == containerd.Name {
+		if conf.Runtime == containerd.Name && !conf.Rootless {
 			l.PortForwards = append(l.PortForwards,
 				limaconfig.PortForward{
 					GuestSocket: "/var/run/containerd/containerd.sock",
@@ -249,6 +426,21 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 				})
 		}
 
+		// rootless containerd socket
+		if conf.Runtime == containerd.Name && conf.Rootless {
+			l.PortForwards = append(l.PortForwards,
+				limaconfig.PortForward{
+					GuestSocket: containerd.GuestRootlessSocketFiles.Containerd,
+					HostSocket:  containerd.HostSocketFiles().Containerd,
+					Proto:       limaconfig.TCP,
+				},
+				limaconfig.PortForward{
+					GuestSocket: containerd.GuestRootlessSocketFiles.Buildkitd,
+					HostSocket:  containerd.HostSocketFiles().Buildkitd,
+					Proto:       limaconfig.TCP,
+				})
+		}
+
 		if conf.Runtime == incus.Name {
 			l.PortForwards = append(l.PortForwards,
 				limaconfig.PortForward{
@@ -258,26 +450,38 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 				})
 		}
 
+		// dedicated BuildKit builder socket
+		if conf.BuildKit.Enabled {
+			l.PortForwards = append(l.PortForwards,
+				limaconfig.PortForward{
+					GuestSocket: buildkit.GuestSocketFile,
+					HostSocket:  buildkit.HostSocketFile(),
+					Proto:       limaconfig.TCP,
+				})
+		}
+
+		// podman sockets, rootful and rootless
+		if conf.Runtime == podman.Name {
+			l.PortForwards = append(l.PortForwards,
+				limaconfig.PortForward{
+					GuestSocket: podman.GuestSocketFile,
+					HostSocket:  podman.HostSocketFile(),
+					Proto:       limaconfig.TCP,
+				},
+				limaconfig.PortForward{
+					GuestSocket: podman.GuestRootlessSocketFile,
+					HostSocket:  podman.HostRootlessSocketFile(),
+					Proto:       limaconfig.TCP,
+				})
+		}
+
+		// configured port forwards take precedence over the defaults and the ignore rules,
+		// the first matching rule applies
+		l.PortForwards = append(portForwards(conf.Network.PortForwards), l.PortForwards...)
+
 		// handle port forwarding to allow listening on 0.0.0.0
-		// bind 0.0.0.0
-		l.PortForwards = append(l.PortForwards,
-			limaconfig.PortForward{
-				GuestIPMustBeZero: true,
-				GuestIP:           net.ParseIP("0.0.0.0"),
-				GuestPortRange:    [2]int{1, 65535},
-				HostIP:            net.ParseIP("0.0.0.0"),
-				HostPortRange:     [2]int{1, 65535},
-				Proto:             limaconfig.TCP,
-			},
-			limaconfig.PortForward{
-				GuestIPMustBeZero: true,
-				GuestIP:           net.ParseIP("0.0.0.0"),
-				GuestPortRange:    [2]int{1, 65535},
-				HostIP:            net.ParseIP("0.0.0.0"),
-				HostPortRange:     [2]int{1, 65535},
-				Proto:             limaconfig.UDP,
-			},
-		)
+		// bind the bind address, 127.0.0.1 by default
+		l.PortForwards = append(l.PortForwards, bindForwards(conf.Network.BindAddressOrDefault(), conf.Network.PortBindings)...)
 		// bind 127.0.0.1
 		l.PortForwards = append(l.PortForwards,
 			limaconfig.PortForward{
@@ -307,16 +511,23 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 						HostPortRange:  [2]int{1, 65535},
 						Proto:          limaconfig.TCP,
 					},
+					limaconfig.PortForward{
+						GuestIP:        ip,
+						GuestPortRange: [2]int{1, 65535},
+						HostIP:         ip,
+						HostPortRange:  [2]int{1, 65535},
+						Proto:          limaconfig.UDP,
+					},
 				)
 			}
 		}
 	}
 
-	switch strings.ToLower(conf.MountType) {
+	switch strings.ToLower(conf.LimaMountType()) {
 	case "ssh", "sshfs", "reversessh", "reverse-ssh", "reversesshfs", limaconfig.REVSSHFS:
 		l.MountType = limaconfig.REVSSHFS
 	default:
-		if l.VMType == limaconfig.VZ {
+		if l.VMType == limaconfig.VZ || l.VMType == limaconfig.Krunkit {
 			l.MountType = limaconfig.VIRTIOFS
 		} else { // qemu
 			l.MountType = limaconfig.NINEP
@@ -351,7 +562,14 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 		l.Mounts = append(l.Mounts, limaconfig.Mount{Location: config.CacheDir(), Writable: false})
 		cacheOverlapFound := false
 
+		// the sshfs mounts combined with the mounts of Lima are mounted by the daemon
+		sshfsMounts := conf.SSHFSMounts()
+
 		for _, m := range conf.Mounts {
+			if slices.Contains(sshfsMounts, m) {
+				continue
+			}
+
 			var location, mountPoint string
 			location, err = util.CleanPath(m.Location)
 			if err != nil {
@@ -374,8 +592,42 @@ func newConf(ctx context.Context, conf config.Config) (l limaconfig.Config, err
 		}
 	}
 
-	// provision scripts
+	// additional disks, formatted by lima on first use and mounted at /mnt/lima-<disk>
+	for _, d := range conf.Disks {
+		name := limautil.DiskName(config.CurrentProfile().ID, d.Name)
+		format := true
+		fsType := d.FSType
+		if fsType == "" {
+			fsType = config.DefaultDiskFSType
+		}
+		l.AdditionalDisks = append(l.AdditionalDisks, limaconfig.Disk{Name: name, Format: &format, FSType: &fsType})
+
+		mountPoint := shellQuote([]string{d.MountPointOrDefault()})
+		l.Provision = append(l.Provision, limaconfig.Provision{
+			Mode:   limaconfig.ProvisionModeSystem,
+			Script: fmt.Sprintf("mkdir -p %[1]s && (mountpoint -q %[1]s || mount --bind %[2]s %[1]s)", mountPoint, shellQuote([]string{"/mnt/lima-" + name})),
+		})
+	}
+
+	// cloud-init user-data, before the provision scripts
+	if conf.CloudInit != "" {
+		userData, err := cloudinit.Parse(conf.CloudInit)
+		if err != nil {
+			return l, err
+		}
+		if script := userData.BootScript(); script != "" {
+			l.Provision = append(l.Provision, limaconfig.Provision{Mode: limaconfig.ProvisionModeBoot, Script: script})
+		}
+		if script := userData.Script(); script != "" {
+			l.Provision = append(l.Provision, limaconfig.Provision{Mode: limaconfig.ProvisionModeSystem, Script: script})
+		}
+	}
+
+	// provision scripts, the scripts after the runtime are run by Colima
 	for _, script := range conf.Provision {
+		if !script.LimaProvision() {
+			continue
+		}
 		l.Provision = append(l.Provision, limaconfig.Provision{
 			Mode:   script.Mode,
 			Script: script.Script,
@@ -408,6 +660,18 @@ func checkOverlappingMounts(mounts []config.Mount) error {
 	return nil
 }
 
+// ingressEnabled returns if an ingress controller is enabled for the cluster.
+// The bundled traefik of k3s is enabled unless disabled in the k3s args if no ingress controller is set.
+func ingressEnabled(conf config.Kubernetes) bool {
+	switch conf.Ingress {
+	case "traefik", "nginx":
+		return true
+	case "none":
+		return false
+	}
+	return conf.Distro != "k0s" && !ingressDisabled(conf.K3sArgs)
+}
+
 // disableHas checks if the provided feature is indeed found in the disable configuration slice.
 func ingressDisabled(disableFlags []string) bool {
 	disabled := func(s string) bool { return s == "traefik" || s == "ingress" }
@@ -431,3 +695,320 @@ func ingressDisabled(disableFlags []string) bool {
 	}
 	return false
 }
+
+// portForwards returns the Lima port forwards for the configured port forwards.
+// Guest ports listening on 127.0.0.1 or 0.0.0.0 are matched.
+func portForwards(forwards []config.PortForward) []limaconfig.PortForward {
+	var l []limaconfig.PortForward
+	for _, f := range forwards {
+		p := limaconfig.PortForward{
+			GuestIP:   net.ParseIP("127.0.0.1"),
+			GuestPort: f.GuestPort,
+			HostIP:    f.HostIP,
+			HostPort:  f.HostPort,
+			Proto:     limaconfig.TCP,
+		}
+		if p.HostIP == nil {
+			p.HostIP = net.ParseIP("127.0.0.1")
+		}
+		if p.HostPort == 0 {
+			p.HostPort = f.GuestPort
+		}
+		if f.Protocol == limaconfig.UDP {
+			p.Proto = limaconfig.UDP
+		}
+		l = append(l, p)
+	}
+	return l
+}
+
+// bindForwards returns the port forwards of the ports listening on all the VM addresses to the
+// bind address on the host, preceded by the per port overrides.
+func bindForwards(bindAddress net.IP, bindings []config.PortBinding) []limaconfig.PortForward {
+	var l []limaconfig.PortForward
+	for _, b := range bindings {
+		for _, proto := range []limaconfig.Proto{limaconfig.TCP, limaconfig.UDP} {
+			if b.Protocol != "" && limaconfig.Proto(b.Protocol) != proto {
+				continue
+			}
+			l = append(l, limaconfig.PortForward{
+				GuestIPMustBeZero: true,
+				GuestIP:           net.ParseIP("0.0.0.0"),
+				GuestPort:         b.Port,
+				HostIP:            b.Address,
+				HostPort:          b.Port,
+				Proto:             proto,
+			})
+		}
+	}
+	for _, proto := range []limaconfig.Proto{limaconfig.TCP, limaconfig.UDP} {
+		l = append(l, limaconfig.PortForward{
+			GuestIPMustBeZero: true,
+			GuestIP:           net.ParseIP("0.0.0.0"),
+			GuestPortRange:    [2]int{1, 65535},
+			HostIP:            bindAddress,
+			HostPortRange:     [2]int{1, 65535},
+			Proto:             proto,
+		})
+	}
+	return l
+}
+
+// sshdConfigScript returns the provision script to write the sshd config file.
+// sshd is reloaded on changes as it may already be running, e.g. when the config changes.
+// The script can be followed by other commands.
+func sshdConfigScript(file, conf string) string {
+	return strings.Join([]string{
+		"mkdir -p " + filepath.Dir(file),
+		fmt.Sprintf("echo '%s' > %s.tmp", conf, file),
+		fmt.Sprintf("if cmp -s %[1]s.tmp %[1]s; then rm -f %[1]s.tmp; else", file),
+		fmt.Sprintf("  mv %[1]s.tmp %[1]s", file),
+		"  systemctl try-reload-or-restart ssh.service sshd.service 2>/dev/null || true",
+		"fi",
+	}, "\n")
+}
+
+// staticIPNetplanFile is the netplan config for the static IP address in the VM.
+// It is applied after the netplan config generated by cloud-init.
+const staticIPNetplanFile = "/etc/netplan/99-colima-static-ip.yaml"
+
+// staticIPScript returns the provision script to assign the static IP address to the
+// reachable network interface, replacing the DHCP lease.
+// The netplan config is removed if ip is nil, restoring DHCP.
+func staticIPScript(ip net.IP) string {
+	if ip == nil {
+		return fmt.Sprintf("if [ -f %[1]s ]; then rm -f %[1]s && netplan apply; fi", staticIPNetplanFile)
+	}
+
+	address := ip.String() + "/24"
+	return strings.Join([]string{
+		fmt.Sprintf("ip -4 addr show %s | grep -q 'inet %s ' && [ -f %s ] && exit 0", limautil.NetInterface, address, staticIPNetplanFile),
+		fmt.Sprintf("cat > %s <<EOF", staticIPNetplanFile),
+		"network:",
+		"  version: 2",
+		"  ethernets:",
+		"    " + limautil.NetInterface + ":",
+		"      dhcp4: false",
+		"      addresses: [" + address + "]",
+		"EOF",
+		"chmod 600 " + staticIPNetplanFile,
+		"netplan apply",
+	}, "\n")
+}
+
+// mtuScript returns the provision script to set the MTU of the network interfaces of the VM.
+// The MTU is not persisted, the default is restored on restart when unset.
+func mtuScript(mtu int) string {
+	return fmt.Sprintf(`for dev in /sys/class/net/*; do [ -e "$dev/device" ] && ip link set dev "${dev##*/}" mtu %d; done; true`, mtu)
+}
+
+const (
+	// guestModulesFile loads the kernel modules of the config on boot.
+	guestModulesFile = "/etc/modules-load.d/99-colima.conf"
+	// guestSysctlFile applies the sysctls of the config on boot.
+	guestSysctlFile = "/etc/sysctl.d/99-colima.conf"
+)
+
+// guestKernelScript returns the provision script of the kernel modules and the sysctls of the
+// config. The config files are also read on boot, the files are removed when unset.
+// The failures are reported without failing the startup, a module may be missing in the kernel.
+func guestKernelScript(guest config.Guest) string {
+	var script []string
+
+	if len(guest.KernelModules) == 0 {
+		script = append(script, "rm -f "+guestModulesFile)
+	} else {
+		script = append(script, "printf '%s\\n' "+shellQuote(guest.KernelModules)+" > "+guestModulesFile)
+		for _, module := range guest.KernelModules {
+			script = append(script, fmt.Sprintf("modprobe %[1]s || echo 'unable to load kernel module %[1]s' >&2", module))
+		}
+	}
+
+	if len(guest.Sysctls) == 0 {
+		script = append(script, "rm -f "+guestSysctlFile)
+	} else {
+		keys := make([]string, 0, len(guest.Sysctls))
+		for key := range guest.Sysctls {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		lines := make([]string, len(keys))
+		for i, key := range keys {
+			lines[i] = key + " = " + guest.Sysctls[key]
+		}
+		script = append(script,
+			"printf '%s\\n' "+shellQuote(lines)+" > "+guestSysctlFile,
+			"sysctl -p "+guestSysctlFile+" >/dev/null || echo 'unable to apply sysctls' >&2",
+		)
+	}
+
+	return strings.Join(script, "\n")
+}
+
+// swapFile is the swap file of the VM.
+const swapFile = "/colima.swap"
+
+// zramResetScript disables and resets the zram swap devices, when zram is disabled.
+const zramResetScript = `for dev in $(swapon --show=NAME --noheadings | grep zram); do swapoff "$dev" && zramctl --reset "$dev" || true; done`
+
+// swapScript returns the provision script of the swap of the VM, a swap file of the size or
+// a zram device. The swap file is recreated on startup when the size changes.
+func swapScript(swap config.Swap) string {
+	if !swap.Enabled() {
+		return strings.Join([]string{
+			"swapoff " + swapFile + " 2>/dev/null; rm -f " + swapFile,
+			zramResetScript,
+		}, "\n")
+	}
+
+	if swap.ZRAM {
+		size := fmt.Sprintf("%dG", swap.Size)
+		if swap.Size == 0 {
+			size = `"$(( $(awk '/^MemTotal:/ {print $2}' /proc/meminfo) / 2 ))K"`
+		}
+		return strings.Join([]string{
+			"set -e",
+			"swapoff " + swapFile + " 2>/dev/null || true",
+			"rm -f " + swapFile,
+			"swapon --show=NAME --noheadings | grep -q zram && exit 0",
+			"modprobe zram",
+			`dev="$(zramctl --find --size ` + size + ` --algorithm zstd)"`,
+			`mkswap "$dev" >/dev/null`,
+			`swapon -p 100 "$dev"`,
+		}, "\n")
+	}
+
+	return strings.Join([]string{
+		"set -e",
+		zramResetScript,
+		fmt.Sprintf(`if [ "$(stat -c %%s %s 2>/dev/null)" != "%d" ]; then`, swapFile, int64(swap.Size)<<30),
+		"  swapoff " + swapFile + " 2>/dev/null || true",
+		fmt.Sprintf("  rm -f %[1]s && fallocate -l %[2]dG %[1]s && chmod 600 %[1]s", swapFile, swap.Size),
+		"  mkswap " + swapFile + " >/dev/null",
+		"fi",
+		"swapon --show=NAME --noheadings | grep -qx " + swapFile + " || swapon " + swapFile,
+	}, "\n")
+}
+
+// ipv6Script returns the provision script to enable IPv6 on the network interfaces of the VM.
+// Router advertisements are accepted with forwarding enabled, which is required for routing
+// the container and Pod networks.
+func ipv6Script() string {
+	return strings.Join([]string{
+		"sysctl -w net.ipv6.conf.all.disable_ipv6=0 net.ipv6.conf.default.disable_ipv6=0 >/dev/null",
+		`for dev in /sys/class/net/*; do [ -e "$dev/device" ] && sysctl -w "net.ipv6.conf.${dev##*/}.accept_ra=2" >/dev/null; done; true`,
+	}, "\n")
+}
+
+// gpuCDIFile is the CDI spec of the GPU in the VM, for docker and containerd.
+const gpuCDIFile = "/etc/cdi/colima-gpu.yaml"
+
+// kvmScript is the provision script granting the user access to /dev/kvm of the nested
+// virtualization, e.g. for the emulators or for kind and KubeVirt.
+const kvmScript = `modprobe kvm 2>/dev/null || true
+if [ -e /dev/kvm ]; then
+  groupadd -f kvm
+  chgrp kvm /dev/kvm
+  chmod 660 /dev/kvm
+  usermod -aG kvm {{ .User }}
+fi`
+
+// gpuScript returns the provision script to install the Mesa Vulkan drivers, with the Venus
+// driver of the virtio-gpu device, and to generate the CDI spec of the render nodes.
+// The containers request the GPU with the device config.GPUDevice.
+func gpuScript() string {
+	kind, name, _ := strings.Cut(config.GPUDevice, "=")
+	return strings.Join([]string{
+		"{ " + pkgutil.Install("mesa-vulkan-drivers") + "; } || true",
+		"mkdir -p " + filepath.Dir(gpuCDIFile),
+		"{",
+		`echo 'cdiVersion: "0.6.0"'`,
+		"echo 'kind: " + kind + "'",
+		"echo 'devices:'",
+		"echo '  - name: " + name + "'",
+		"echo '    containerEdits:'",
+		"echo '      deviceNodes:'",
+		`for dev in /dev/dri/card* /dev/dri/renderD*; do [ -e "$dev" ] && echo "        - path: $dev"; done`,
+		"} > " + gpuCDIFile,
+	}, "\n")
+}
+
+// resolvedConfFile is the systemd-resolved config for the DNS settings in the VM.
+const resolvedConfFile = "/etc/systemd/resolved.conf.d/colima.conf"
+
+// resolvedDropIn is the systemd-networkd drop-in for the resolvers per domain, in the
+// drop-in directory of the network file of the link routing to the resolvers.
+const resolvedDropIn = "colima-dns.conf"
+
+// resolvedScript returns the provision script to configure systemd-resolved in the VM
+// with the search domains and the resolvers per domain.
+// The resolvers are set as routing-only domains of the link routing to them, the global
+// resolvers are left unchanged. The config is removed if there are neither.
+func resolvedScript(search []string, domains map[string][]net.IP) string {
+	names := make([]string, 0, len(domains))
+	for domain := range domains {
+		names = append(names, domain)
+	}
+	sort.Strings(names)
+
+	script := []string{
+		"changed= networks=",
+		// search domains
+		"mkdir -p " + filepath.Dir(resolvedConfFile),
+	}
+	if len(search) == 0 {
+		script = append(script, fmt.Sprintf("if [ -f %[1]s ]; then rm -f %[1]s && changed=1; fi", resolvedConfFile))
+	} else {
+		conf := []string{"[Resolve]", "Domains=" + strings.Join(search, " ")}
+		script = append(script,
+			fmt.Sprintf("printf '%%s\\n' %s > %s.tmp", shellQuote(conf), resolvedConfFile),
+			fmt.Sprintf("if cmp -s %[1]s.tmp %[1]s; then rm -f %[1]s.tmp; else mv %[1]s.tmp %[1]s && changed=1; fi", resolvedConfFile),
+		)
+	}
+
+	// resolvers per domain, staged to only reload networkd on changes
+	script = append(script,
+		"stage=$(mktemp -d)",
+		fmt.Sprintf("for f in /etc/systemd/network/*.d/%s; do [ -f \"$f\" ] && mkdir -p \"$stage/${f%%/*}\" && : > \"$stage/$f\"; done", resolvedDropIn),
+	)
+	for _, domain := range names {
+		var servers []string
+		for _, ip := range domains[domain] {
+			servers = append(servers, ip.String())
+		}
+		if len(servers) == 0 {
+			continue
+		}
+		conf := []string{"[Network]", "DNS=" + strings.Join(servers, " "), "Domains=~" + domain}
+		script = append(script,
+			fmt.Sprintf(`dev=$(ip -o route get %s | awk '{ for (i = 1; i < NF; i++) if ($i == "dev") print $(i + 1) }')`, servers[0]),
+			`file=$(networkctl status "$dev" 2>/dev/null | awk '$1 == "Network" && $2 == "File:" { print $3 }')`,
+			fmt.Sprintf(`if [ -z "$file" ]; then echo "no network file for the resolvers of %s" >&2; else`, domain),
+			fmt.Sprintf(`  f="/etc/systemd/network/${file##*/}.d/%s"; mkdir -p "$stage/${f%%/*}"`, resolvedDropIn),
+			fmt.Sprintf(`  printf '%%s\n' %s >> "$stage/$f"`, shellQuote(conf)),
+			"fi",
+		)
+	}
+	script = append(script,
+		`for staged in $(find "$stage" -type f); do`,
+		`  f="${staged#"$stage"}"`,
+		`  if [ ! -s "$staged" ]; then rm -f "$f" && changed=1 networks=1 && continue; fi`,
+		`  cmp -s "$staged" "$f" && continue`,
+		`  mkdir -p "${f%/*}" && cp "$staged" "$f" && changed=1 networks=1`,
+		"done",
+		`rm -rf "$stage"`,
+		`[ -n "$networks" ] && networkctl reload`,
+		`[ -n "$changed" ] && systemctl restart systemd-resolved`,
+		"true",
+	)
+	return strings.Join(script, "\n")
+}
+
+// shellQuote returns the args single quoted for a shell script.
+func shellQuote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
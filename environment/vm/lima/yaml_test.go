@@ -3,11 +3,15 @@ package lima
 import (
 	"context"
 	"fmt"
+	"net"
+	"os/exec"
 	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon"
+	"github.com/abiosoft/colima/daemon/process/vmnet"
 	"github.com/abiosoft/colima/environment/vm/lima/limaconfig"
 	"github.com/abiosoft/colima/util"
 	"github.com/abiosoft/colima/util/fsutil"
@@ -100,6 +104,58 @@ func Test_config_Mounts(t *testing.T) {
 	}
 }
 
+func Test_config_MountTypes(t *testing.T) {
+	fsutil.FS = fsutil.FakeFS
+	conf, err := newConf(context.Background(), config.Config{
+		VMType:    "qemu",
+		MountType: "sshfs",
+		Mounts: []config.Mount{
+			{Location: "/User/user/projects", MountType: "9p"},
+			{Location: "/User/user/shared"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.MountType != limaconfig.NINEP {
+		t.Errorf("got mountType: %s, want: %s", conf.MountType, limaconfig.NINEP)
+	}
+	for _, m := range conf.Mounts {
+		if m.Location == "/User/user/shared" {
+			t.Errorf("sshfs mount %s should not be mounted by lima", m.Location)
+		}
+	}
+}
+
+func Test_config_PortForwardsPrecedence(t *testing.T) {
+	fsutil.FS = fsutil.FakeFS
+	ctx := context.WithValue(context.Background(), daemon.CtxKey(vmnet.Name), true)
+	conf, err := newConf(ctx, config.Config{
+		VMType:     "qemu",
+		Runtime:    "docker",
+		Kubernetes: config.Kubernetes{Enabled: true},
+		Network: config.Network{
+			Address:      true,
+			PortForwards: []config.PortForward{{GuestPort: 80, HostPort: 8080}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range conf.PortForwards {
+		if p.GuestPort != 80 {
+			continue
+		}
+		if p.Ignore || p.HostPort != 8080 {
+			t.Errorf("got port forward %+v for guest port 80, want the configured port forward first", p)
+		}
+		return
+	}
+	t.Errorf("port forward for guest port 80 not found")
+}
+
 func Test_ingressDisabled(t *testing.T) {
 	tests := []struct {
 		args []string
@@ -118,3 +174,174 @@ func Test_ingressDisabled(t *testing.T) {
 		})
 	}
 }
+
+func Test_ingressEnabled(t *testing.T) {
+	tests := []struct {
+		conf config.Kubernetes
+		want bool
+	}{
+		{conf: config.Kubernetes{}, want: true},
+		{conf: config.Kubernetes{K3sArgs: []string{"--disable=traefik"}}, want: false},
+		{conf: config.Kubernetes{Ingress: "nginx", K3sArgs: []string{"--disable=traefik"}}, want: true},
+		{conf: config.Kubernetes{Ingress: "traefik", K3sArgs: []string{"--disable=traefik"}}, want: true},
+		{conf: config.Kubernetes{Ingress: "none"}, want: false},
+		{conf: config.Kubernetes{Distro: "k0s"}, want: false},
+		{conf: config.Kubernetes{Distro: "k0s", Ingress: "nginx"}, want: true},
+	}
+	for i, tt := range tests {
+		t.Run(strconv.Itoa(i+1), func(t *testing.T) {
+			if got := ingressEnabled(tt.conf); got != tt.want {
+				t.Errorf("ingressEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_staticIPScript(t *testing.T) {
+	script := staticIPScript(net.ParseIP("192.168.106.10"))
+	for _, want := range []string{
+		"addresses: [192.168.106.10/24]",
+		"dhcp4: false",
+		"netplan apply",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("staticIPScript() = %q, missing %q", script, want)
+		}
+	}
+
+	if got := staticIPScript(nil); !strings.Contains(got, "rm -f "+staticIPNetplanFile) {
+		t.Errorf("staticIPScript(nil) = %q, want removal of %s", got, staticIPNetplanFile)
+	}
+}
+
+func Test_mtuScript(t *testing.T) {
+	script := mtuScript(1400)
+	if !strings.Contains(script, `ip link set dev "${dev##*/}" mtu 1400`) {
+		t.Errorf("mtuScript() = %q, missing MTU of the network interfaces", script)
+	}
+}
+
+func Test_guestKernelScript(t *testing.T) {
+	script := guestKernelScript(config.Guest{
+		Sysctls:       map[string]string{"net.ipv4.ip_forward": "1", "fs.inotify.max_user_instances": "8192"},
+		KernelModules: []string{"nbd"},
+	})
+	want := "printf '%s\\n' 'fs.inotify.max_user_instances = 8192' 'net.ipv4.ip_forward = 1' > " + guestSysctlFile
+	if !strings.Contains(script, want) {
+		t.Errorf("guestKernelScript() = %q, missing sorted sysctls", script)
+	}
+	if !strings.Contains(script, "modprobe nbd") {
+		t.Errorf("guestKernelScript() = %q, missing kernel module", script)
+	}
+
+	script = guestKernelScript(config.Guest{})
+	if !strings.Contains(script, "rm -f "+guestModulesFile) || !strings.Contains(script, "rm -f "+guestSysctlFile) {
+		t.Errorf("guestKernelScript() = %q, missing removal of the config files", script)
+	}
+}
+
+func Test_swapScript(t *testing.T) {
+	script := swapScript(config.Swap{Size: 2})
+	if !strings.Contains(script, "fallocate -l 2G "+swapFile) || !strings.Contains(script, `!= "2147483648"`) {
+		t.Errorf("swapScript() = %q, missing swap file of the size", script)
+	}
+	script = swapScript(config.Swap{ZRAM: true})
+	if !strings.Contains(script, "zramctl --find --size \"$((") {
+		t.Errorf("swapScript() = %q, missing zram device of half the memory", script)
+	}
+	script = swapScript(config.Swap{})
+	if !strings.Contains(script, "rm -f "+swapFile) {
+		t.Errorf("swapScript() = %q, missing removal of the swap file", script)
+	}
+
+	// the zram devices are reset when zram is disabled
+	for _, swap := range []config.Swap{{}, {Size: 2}} {
+		script := swapScript(swap)
+		if !strings.Contains(script, "zramctl --reset") {
+			t.Errorf("swapScript(%+v) = %q, missing reset of the zram devices", swap, script)
+		}
+		if err := exec.Command("sh", "-n", "-c", script).Run(); err != nil {
+			t.Errorf("swapScript(%+v) is not a valid shell script: %v", swap, err)
+		}
+	}
+}
+
+func Test_ipv6Script(t *testing.T) {
+	script := ipv6Script()
+	for _, want := range []string{"disable_ipv6=0", "accept_ra=2"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("ipv6Script() = %q, missing %q", script, want)
+		}
+	}
+}
+
+func Test_sshdConfigScript(t *testing.T) {
+	script := sshdConfigScript("/etc/ssh/sshd_config.d/99-colima.conf", "GatewayPorts clientspecified")
+	if !strings.Contains(script, "systemctl try-reload-or-restart ssh.service") {
+		t.Errorf("sshdConfigScript() = %q, want sshd reloaded", script)
+	}
+	if err := exec.Command("sh", "-n", "-c", script).Run(); err != nil {
+		t.Errorf("sshdConfigScript() is not a valid shell script: %v", err)
+	}
+}
+
+func Test_resolvedScript(t *testing.T) {
+	script := resolvedScript([]string{"example.com"}, map[string][]net.IP{
+		"corp.example.com": {net.ParseIP("10.0.0.53")},
+	})
+	for _, want := range []string{
+		"'[Resolve]' 'Domains=example.com'",
+		"ip -o route get 10.0.0.53",
+		"'[Network]' 'DNS=10.0.0.53' 'Domains=~corp.example.com'",
+		"networkctl reload",
+		"systemctl restart systemd-resolved",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("resolvedScript() = %q, missing %q", script, want)
+		}
+	}
+	// the global resolvers are left unchanged
+	if strings.Contains(script, "'DNS=10.0.0.53' 'Domains=example.com") {
+		t.Errorf("resolvedScript() = %q, want the resolvers per link", script)
+	}
+	if err := exec.Command("sh", "-n", "-c", script).Run(); err != nil {
+		t.Errorf("resolvedScript() is not a valid shell script: %v", err)
+	}
+
+	if got := resolvedScript(nil, nil); !strings.Contains(got, "rm -f "+resolvedConfFile) {
+		t.Errorf("resolvedScript(nil, nil) = %q, want removal of %s", got, resolvedConfFile)
+	}
+}
+
+func Test_portForwards(t *testing.T) {
+	forwards := []config.PortForward{
+		{GuestPort: 53, HostPort: 5353, Protocol: "udp"},
+		{GuestPort: 8080, HostIP: net.ParseIP("0.0.0.0")},
+	}
+	got := portForwards(forwards)
+	if len(got) != 2 {
+		t.Fatalf("portForwards() = %d forwards, want 2", len(got))
+	}
+	if p := got[0]; p.GuestPort != 53 || p.HostPort != 5353 || p.Proto != limaconfig.UDP || !p.HostIP.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("portForwards()[0] = %+v", p)
+	}
+	if p := got[1]; p.GuestPort != 8080 || p.HostPort != 8080 || p.Proto != limaconfig.TCP || !p.HostIP.Equal(net.ParseIP("0.0.0.0")) {
+		t.Errorf("portForwards()[1] = %+v", p)
+	}
+}
+
+func Test_bindForwards(t *testing.T) {
+	bindings := []config.PortBinding{{Port: 3000, Address: net.ParseIP("0.0.0.0"), Protocol: "tcp"}}
+	got := bindForwards(net.ParseIP("127.0.0.1"), bindings)
+	if len(got) != 3 {
+		t.Fatalf("bindForwards() = %d forwards, want 3", len(got))
+	}
+	if p := got[0]; p.GuestPort != 3000 || p.HostPort != 3000 || p.Proto != limaconfig.TCP || !p.HostIP.Equal(net.ParseIP("0.0.0.0")) || !p.GuestIPMustBeZero {
+		t.Errorf("bindForwards()[0] = %+v", p)
+	}
+	for _, p := range got[1:] {
+		if p.GuestPortRange != [2]int{1, 65535} || !p.HostIP.Equal(net.ParseIP("127.0.0.1")) || !p.GuestIPMustBeZero {
+			t.Errorf("bindForwards() catch-all = %+v", p)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package cloudinit converts the cloud-config user-data of cloud-init to provision scripts.
+package cloudinit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/abiosoft/colima/util/pkgutil"
+	"gopkg.in/yaml.v3"
+)
+
+// UserData is the supported subset of the cloud-config user-data of cloud-init.
+type UserData struct {
+	Bootcmd    []Command   `yaml:"bootcmd"`
+	CACerts    CACerts     `yaml:"ca_certs"`
+	WriteFiles []WriteFile `yaml:"write_files"`
+	Packages   []string    `yaml:"packages"`
+	Runcmd     []Command   `yaml:"runcmd"`
+}
+
+// CACerts are the certificates added to the trusted CAs.
+type CACerts struct {
+	Trusted []string `yaml:"trusted"`
+}
+
+// WriteFile is a file written to the VM.
+type WriteFile struct {
+	Path        string `yaml:"path"`
+	Content     string `yaml:"content"`
+	Encoding    string `yaml:"encoding"`    // empty, text/plain, b64 or base64
+	Permissions string `yaml:"permissions"` // octal e.g. '0644'
+	Owner       string `yaml:"owner"`       // user:group
+	Append      bool   `yaml:"append"`
+}
+
+// Command is a shell command, a string run by the shell or a list of the args.
+type Command []string
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *Command) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*c = Command{value.Value}
+		return nil
+	}
+	var args []string
+	if err := value.Decode(&args); err != nil {
+		return fmt.Errorf("command must be a string or a list of strings: %w", err)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("command must not be empty")
+	}
+	for i := range args {
+		args[i] = quote(args[i])
+	}
+	// a list of args is quoted, unlike the string for the shell
+	*c = Command{strings.Join(args, " ")}
+	return nil
+}
+
+func (c Command) String() string { return strings.Join(c, " ") }
+
+// Parse parses the cloud-config user-data. Only the keys of UserData are supported.
+func Parse(data string) (u UserData, err error) {
+	var keys map[string]any
+	if err := yaml.Unmarshal([]byte(data), &keys); err != nil {
+		return u, fmt.Errorf("error parsing cloud-init user-data: %w", err)
+	}
+	var unsupported []string
+	for key := range keys {
+		switch key {
+		case "bootcmd", "ca_certs", "write_files", "packages", "runcmd":
+		default:
+			unsupported = append(unsupported, key)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return u, fmt.Errorf("unsupported cloud-init keys: %s, supported keys are bootcmd, ca_certs, write_files, packages and runcmd",
+			strings.Join(unsupported, ", "))
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader([]byte(data)))
+	dec.KnownFields(true)
+	// empty user-data, or comments only
+	if err := dec.Decode(&u); err != nil && !errors.Is(err, io.EOF) {
+		return u, fmt.Errorf("error parsing cloud-init user-data: %w", err)
+	}
+
+	for _, f := range u.WriteFiles {
+		if !path.IsAbs(f.Path) {
+			return u, fmt.Errorf("invalid cloud-init write_files path: '%s', must be absolute", f.Path)
+		}
+		switch f.Encoding {
+		case "", "text/plain", "b64", "base64":
+		default:
+			return u, fmt.Errorf("invalid cloud-init write_files encoding: '%s', must be text/plain or b64", f.Encoding)
+		}
+	}
+	return u, nil
+}
+
+// BootScript returns the script of the bootcmd, run on every boot before the network is up.
+func (u UserData) BootScript() string {
+	var lines []string
+	for _, c := range u.Bootcmd {
+		lines = append(lines, c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Script returns the script of the CA certificates, files, packages and commands, in that order.
+// The script is run on every boot and must be idempotent, unlike the runcmd of cloud-init that
+// runs once per instance.
+func (u UserData) Script() string {
+	var lines []string
+	if len(u.CACerts.Trusted) > 0 {
+		// the anchors of update-ca-trust on Fedora, update-ca-certificates otherwise
+		lines = append(lines,
+			"cadir=/usr/local/share/ca-certificates; command -v update-ca-trust >/dev/null && cadir=/etc/pki/ca-trust/source/anchors",
+			`mkdir -p "$cadir"`,
+		)
+		for i, cert := range u.CACerts.Trusted {
+			encoded := base64.StdEncoding.EncodeToString([]byte(cert))
+			lines = append(lines, fmt.Sprintf(`echo %s | base64 -d > "$cadir/colima-cloud-init-%d.crt"`, quote(encoded), i))
+		}
+		lines = append(lines, "if command -v update-ca-trust >/dev/null; then update-ca-trust; else update-ca-certificates; fi")
+	}
+	for _, f := range u.WriteFiles {
+		lines = append(lines, "mkdir -p "+quote(path.Dir(f.Path)))
+		if f.Encoding == "b64" || f.Encoding == "base64" {
+			// already encoded, written as is
+			lines = append(lines, writeEncoded(strings.Join(strings.Fields(f.Content), ""), f.Path, f.Append))
+		} else {
+			lines = append(lines, writeBase64(f.Content, f.Path, f.Append))
+		}
+		if f.Permissions != "" {
+			lines = append(lines, "chmod "+quote(f.Permissions)+" "+quote(f.Path))
+		}
+		if f.Owner != "" {
+			lines = append(lines, "chown "+quote(f.Owner)+" "+quote(f.Path))
+		}
+	}
+	if len(u.Packages) > 0 {
+		packages := make([]string, len(u.Packages))
+		for i, p := range u.Packages {
+			packages[i] = quote(p)
+		}
+		lines = append(lines, pkgutil.Install(packages...))
+	}
+	for _, c := range u.Runcmd {
+		lines = append(lines, c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeBase64 returns the command writing the content to the file.
+func writeBase64(content, file string, appendFile bool) string {
+	return writeEncoded(base64.StdEncoding.EncodeToString([]byte(content)), file, appendFile)
+}
+
+// writeEncoded returns the command writing the base64 encoded content to the file.
+// The appended content is written once as a block after a marker comment of the content,
+// the script runs on every boot.
+func writeEncoded(encoded, file string, appendFile bool) string {
+	if !appendFile {
+		return "echo " + quote(encoded) + " | base64 -d > " + quote(file)
+	}
+	sum := sha256.Sum256([]byte(encoded))
+	marker := quote(fmt.Sprintf("# colima cloud-init %x", sum[:8]))
+	return "grep -qxF " + marker + " " + quote(file) + " 2>/dev/null || { echo " + marker + "; echo " + quote(encoded) + " | base64 -d; } >> " + quote(file)
+}
+
+// quote quotes the string for the shell.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,113 @@
+package cloudinit
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/util/pkgutil"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "empty", data: ""},
+		{name: "supported", data: "#cloud-config\npackages: [htop]\nruncmd:\n  - sysctl -w vm.max_map_count=262144\n  - [echo, done]\n"},
+		{name: "unsupported key", data: "users: []\nmounts: []\n", wantErr: "unsupported cloud-init keys: mounts, users"},
+		{name: "unknown field", data: "write_files:\n  - path: /etc/a\n    defer: true\n", wantErr: "field defer not found"},
+		{name: "relative path", data: "write_files:\n  - path: etc/a\n", wantErr: "must be absolute"},
+		{name: "encoding", data: "write_files:\n  - path: /etc/a\n    encoding: gzip\n", wantErr: "invalid cloud-init write_files encoding"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.data)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Parse() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserData_Script(t *testing.T) {
+	u, err := Parse(`
+bootcmd:
+  - echo boot
+ca_certs:
+  trusted:
+    - CERT
+write_files:
+  - path: /etc/sysctl.d/99-app.conf
+    content: vm.max_map_count=262144
+    permissions: '0644'
+  - path: /etc/b64
+    encoding: b64
+    content: aGk=
+    append: true
+packages: [htop, "it's"]
+runcmd:
+  - sysctl --system
+  - [echo, "a b"]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := u.BootScript(); got != "echo boot" {
+		t.Errorf("BootScript() = %q", got)
+	}
+
+	want := strings.Join([]string{
+		"cadir=/usr/local/share/ca-certificates; command -v update-ca-trust >/dev/null && cadir=/etc/pki/ca-trust/source/anchors",
+		`mkdir -p "$cadir"`,
+		`echo 'Q0VSVA==' | base64 -d > "$cadir/colima-cloud-init-0.crt"`,
+		"if command -v update-ca-trust >/dev/null; then update-ca-trust; else update-ca-certificates; fi",
+		"mkdir -p '/etc/sysctl.d'",
+		"echo 'dm0ubWF4X21hcF9jb3VudD0yNjIxNDQ=' | base64 -d > '/etc/sysctl.d/99-app.conf'",
+		"chmod '0644' '/etc/sysctl.d/99-app.conf'",
+		"mkdir -p '/etc'",
+		"grep -qxF '# colima cloud-init 96e3186af2815065' '/etc/b64' 2>/dev/null || { echo '# colima cloud-init 96e3186af2815065'; echo 'aGk=' | base64 -d; } >> '/etc/b64'",
+		pkgutil.Install(`'htop'`, `'it'\''s'`),
+		"sysctl --system",
+		"'echo' 'a b'",
+	}, "\n")
+	if got := u.Script(); got != want {
+		t.Errorf("Script() =\n%s\nwant\n%s", got, want)
+	}
+	if err := exec.Command("sh", "-n", "-c", u.Script()).Run(); err != nil {
+		t.Errorf("Script() is not a valid shell script: %v", err)
+	}
+}
+
+func Test_writeEncoded_append(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(file, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the script runs on every boot
+	script := writeBase64("10.0.0.1 registry.local\n", file, true)
+	for range 2 {
+		if out, err := exec.Command("sh", "-c", script).CombinedOutput(); err != nil {
+			t.Fatalf("writeBase64() script error: %v: %s", err, out)
+		}
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(b), "10.0.0.1 registry.local"); got != 1 {
+		t.Errorf("appended content written %d times, want once:\n%s", got, b)
+	}
+}
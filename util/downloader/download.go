@@ -43,6 +43,24 @@ func DownloadToGuest(host hostActions, guest guestActions, r Request, filename s
 	return guest.RunQuiet("cp", cacheFile, filename)
 }
 
+// CopyToGuest copies the file on the host to the destination in the guest.
+//
+// The file is staged in the cache directory shared with the guest, it is not required
+// to be in a mounted directory.
+// filename must be an absolute path and a directory on the guest that does not require root access.
+func CopyToGuest(host hostActions, guest guestActions, file string, filename string) error {
+	cacheFile := CacheFilename("file://" + file)
+	if err := host.RunQuiet("mkdir", "-p", filepath.Dir(cacheFile)); err != nil {
+		return fmt.Errorf("error preparing cache dir: %w", err)
+	}
+	if err := host.RunQuiet("cp", file, cacheFile); err != nil {
+		return fmt.Errorf("error copying '%s': %w", file, err)
+	}
+	defer func() { _ = host.RunQuiet("rm", "-f", cacheFile) }()
+
+	return guest.RunQuiet("cp", cacheFile, filename)
+}
+
 // Download downloads file at url and returns the location of the downloaded file.
 func Download(host hostActions, r Request) (string, error) {
 	d := downloader{
@@ -0,0 +1,31 @@
+package util
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Linux returns if the current OS is Linux.
+func Linux() bool {
+	return runtime.GOOS == "linux"
+}
+
+// LinuxNestedVirtualizationSupported returns if the KVM module of the current device allows
+// nested virtualization.
+func LinuxNestedVirtualizationSupported() bool {
+	if !Linux() {
+		return false
+	}
+	for _, module := range []string{"kvm_intel", "kvm_amd"} {
+		b, err := os.ReadFile("/sys/module/" + module + "/parameters/nested")
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(string(b)) {
+		case "Y", "1":
+			return true
+		}
+	}
+	return false
+}
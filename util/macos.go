@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/abiosoft/colima/cli"
 	"github.com/coreos/go-semver/semver"
@@ -29,9 +32,14 @@ func MacOS13OrNewer() bool { return minMacOSVersion("13.0.0") }
 // MacOS15OrNewer returns if the current OS is macOS 15 or newer.
 func MacOS15OrNewer() bool { return minMacOSVersion("15.0.0") }
 
+// MacOS15OrNewerOnArm returns if the current OS is macOS 15 or newer on Apple Silicon.
+func MacOS15OrNewerOnArm() bool {
+	return runtime.GOARCH == "arm64" && MacOS15OrNewer()
+}
+
 // MacOSNestedVirtualizationSupported returns if the current device supports nested virtualization.
 func MacOSNestedVirtualizationSupported() bool {
-	return (IsMx(3) || IsMx(4)) && MacOS15OrNewer()
+	return MacOS15OrNewer() && IsMxOrNewer(3)
 }
 
 func minMacOSVersion(version string) bool {
@@ -55,7 +63,17 @@ func minMacOSVersion(version string) bool {
 
 // IsMx returns if the current device is an Apple Silicon Mx device
 // where x is the number e.g. x = 1 --> m1, x = 3 --> m3 e.t.c.
-func IsMx(x int) bool {
+func IsMx(x int) bool { return chipGeneration() == x }
+
+// IsMxOrNewer returns if the current device is an Apple Silicon Mx device or newer
+// where x is the number e.g. x = 3 --> m3, m4 e.t.c.
+func IsMxOrNewer(x int) bool { return chipGeneration() >= x }
+
+var chipGenerationRegex = regexp.MustCompile(`\bM(\d+)\b`)
+
+// chipGeneration returns the number of the Apple Silicon chip e.g. 3 for m3, 0 if not Apple Silicon.
+// The chip is only retrieved once, system_profiler is slow.
+var chipGeneration = sync.OnceValue(func() int {
 	var resp struct {
 		SPHardwareDataType []struct {
 			ChipType string `json:"chip_type"`
@@ -68,21 +86,25 @@ func IsMx(x int) bool {
 
 	if err := cmd.Run(); err != nil {
 		logrus.Trace(fmt.Errorf("error retriving chip version: %w", err))
-		return false
+		return 0
 	}
 
 	if err := json.NewDecoder(&buf).Decode(&resp); err != nil {
 		logrus.Trace(fmt.Errorf("error decoding system_profiler response: %w", err))
-		return false
+		return 0
 	}
 
 	if len(resp.SPHardwareDataType) == 0 {
-		return false
+		return 0
 	}
 
-	chipType := strings.ToUpper(resp.SPHardwareDataType[0].ChipType)
-	return strings.Contains(chipType, fmt.Sprintf("M%d", x))
-}
+	match := chipGenerationRegex.FindStringSubmatch(strings.ToUpper(resp.SPHardwareDataType[0].ChipType))
+	if match == nil {
+		return 0
+	}
+	x, _ := strconv.Atoi(match[1])
+	return x
+})
 
 // RosettaRunning checks if Rosetta process is running.
 func RosettaRunning() bool {
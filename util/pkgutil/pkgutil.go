@@ -0,0 +1,18 @@
+package pkgutil
+
+import "strings"
+
+// Install returns the shell command to install the missing packages with the package manager
+// of the distro of the VM, apt on Ubuntu, apk on Alpine and dnf on Fedora.
+// The packages must be quoted for the shell and named the same on the distros.
+// The returned command should be passed to 'sh -c' or equivalent, as root.
+func Install(packages ...string) string {
+	list := strings.Join(packages, " ")
+	return "if command -v apt-get >/dev/null; then " +
+		"dpkg -s " + list + " >/dev/null 2>&1 || (apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y " + list + "); " +
+		"elif command -v apk >/dev/null; then " +
+		"apk info -e " + list + " >/dev/null 2>&1 || apk add " + list + "; " +
+		"elif command -v dnf >/dev/null; then " +
+		"rpm -q " + list + " >/dev/null 2>&1 || dnf install -y " + list + "; " +
+		"else echo 'no supported package manager' >&2; false; fi"
+}
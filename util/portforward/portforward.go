@@ -0,0 +1,194 @@
+// Package portforward manages the port forwards of the user-v2 network on a running VM.
+//
+// The user-v2 network is provided by gvproxy (gvisor-tap-vsock) via Lima, forwards
+// are added and removed with its forwarder API without restarting the VM.
+package portforward
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+)
+
+// Protocols of the port forwards.
+const (
+	TCP = "tcp"
+	UDP = "udp"
+)
+
+// Forward is a port forward from the host to the VM.
+type Forward struct {
+	Local    string `json:"local"`    // host address e.g. 127.0.0.1:8080
+	Remote   string `json:"remote"`   // VM address e.g. 192.168.5.15:80
+	Protocol string `json:"protocol"` // tcp or udp
+}
+
+// Client is the client for the API of the user-v2 network.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// EndpointSocket returns the path to the API socket of the user-v2 network.
+func EndpointSocket() string {
+	return filepath.Join(config.LimaDir(), "_networks", "user-v2", "user-v2_ep.sock")
+}
+
+// New creates a client for the API of the user-v2 network.
+func New() Client {
+	socket := EndpointSocket()
+	return Client{
+		baseURL: "http://gvproxy",
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// List returns the port forwards of the user-v2 network.
+// Forwards of all the VMs on the network are returned.
+func (c Client) List() ([]Forward, error) {
+	var forwards []Forward
+	if err := c.do(http.MethodGet, "/services/forwarder/all", nil, &forwards); err != nil {
+		return nil, fmt.Errorf("error retrieving port forwards: %w", err)
+	}
+	return forwards, nil
+}
+
+// Add adds the port forward.
+func (c Client) Add(f Forward) error {
+	if err := c.do(http.MethodPost, "/services/forwarder/expose", f, nil); err != nil {
+		return fmt.Errorf("error adding port forward for %s: %w", f.Local, err)
+	}
+	return nil
+}
+
+// Remove removes the port forward for the local address and protocol of f.
+func (c Client) Remove(f Forward) error {
+	req := struct {
+		Local    string `json:"local"`
+		Protocol string `json:"protocol"`
+	}{Local: f.Local, Protocol: f.Protocol}
+	if err := c.do(http.MethodPost, "/services/forwarder/unexpose", req, nil); err != nil {
+		return fmt.Errorf("error removing port forward for %s: %w", f.Local, err)
+	}
+	return nil
+}
+
+// Leases returns the DHCP leases of the user-v2 network, the MAC addresses by IP address.
+func (c Client) Leases() (map[string]string, error) {
+	var leases map[string]string
+	if err := c.do(http.MethodGet, "/leases", nil, &leases); err != nil {
+		return nil, fmt.Errorf("error retrieving DHCP leases: %w", err)
+	}
+	return leases, nil
+}
+
+// Stats returns the network stack statistics of the user-v2 network.
+func (c Client) Stats() (json.RawMessage, error) {
+	var stats json.RawMessage
+	if err := c.do(http.MethodGet, "/stats", nil, &stats); err != nil {
+		return nil, fmt.Errorf("error retrieving network stats: %w", err)
+	}
+	return stats, nil
+}
+
+// Request sends the raw request to the API and returns the response body.
+// A non 200 response status is returned as an error.
+func (c Client) Request(method, path string, body io.Reader) ([]byte, error) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	req, err := http.NewRequest(strings.ToUpper(method), c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return b, nil
+}
+
+// do sends the request to the API and decodes the response into v, if not nil.
+func (c Client) do(method, path string, body, v any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	b, err := c.Request(method, path, r)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Parse parses the port forward spec in the format [HOST_PORT:]GUEST_PORT[/PROTOCOL]
+// for the VM at guestIP. The host port is bound on address, and defaults to the guest port.
+func Parse(spec, address, guestIP string) (Forward, error) {
+	f := Forward{Protocol: TCP}
+
+	ports := spec
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		ports, f.Protocol = spec[:i], strings.ToLower(spec[i+1:])
+	}
+	if f.Protocol != TCP && f.Protocol != UDP {
+		return f, fmt.Errorf("invalid protocol '%s' in '%s', must be one of %s or %s", f.Protocol, spec, TCP, UDP)
+	}
+
+	hostPort, guestPort, ok := strings.Cut(ports, ":")
+	if !ok {
+		guestPort = hostPort
+	}
+	for _, p := range []string{hostPort, guestPort} {
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			return f, fmt.Errorf("invalid port '%s' in '%s'", p, spec)
+		}
+	}
+
+	f.Local = net.JoinHostPort(address, hostPort)
+	f.Remote = net.JoinHostPort(guestIP, guestPort)
+	return f, nil
+}
+
+// ForVM returns the port forwards to the VM at guestIP.
+func ForVM(forwards []Forward, guestIP string) []Forward {
+	var vm []Forward
+	for _, f := range forwards {
+		if host, _, err := net.SplitHostPort(f.Remote); err == nil && host == guestIP {
+			vm = append(vm, f)
+		}
+	}
+	return vm
+}
@@ -0,0 +1,113 @@
+package portforward
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Forward
+		wantErr bool
+	}{
+		{spec: "8080", want: Forward{Local: "127.0.0.1:8080", Remote: "192.168.5.15:8080", Protocol: TCP}},
+		{spec: "8080:80", want: Forward{Local: "127.0.0.1:8080", Remote: "192.168.5.15:80", Protocol: TCP}},
+		{spec: "5353:53/udp", want: Forward{Local: "127.0.0.1:5353", Remote: "192.168.5.15:53", Protocol: UDP}},
+		{spec: "8080/sctp", wantErr: true},
+		{spec: "http:80", wantErr: true},
+		{spec: "8080:70000", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := Parse(tt.spec, "127.0.0.1", "192.168.5.15")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForVM(t *testing.T) {
+	forwards := []Forward{
+		{Local: "127.0.0.1:8080", Remote: "192.168.5.15:80", Protocol: TCP},
+		{Local: "127.0.0.1:8081", Remote: "192.168.5.16:80", Protocol: TCP},
+		{Local: "127.0.0.1:60022", Remote: "192.168.5.15:22", Protocol: TCP},
+	}
+	want := []Forward{forwards[0], forwards[2]}
+	if got := ForVM(forwards, "192.168.5.15"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ForVM() = %+v, want %+v", got, want)
+	}
+}
+
+func TestClient(t *testing.T) {
+	forwards := map[string]Forward{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/services/forwarder/all", func(w http.ResponseWriter, r *http.Request) {
+		var list []Forward
+		for _, f := range forwards {
+			list = append(list, f)
+		}
+		_ = json.NewEncoder(w).Encode(list)
+	})
+	mux.HandleFunc("/services/forwarder/expose", func(w http.ResponseWriter, r *http.Request) {
+		var f Forward
+		_ = json.NewDecoder(r.Body).Decode(&f)
+		if _, ok := forwards[f.Local]; ok {
+			http.Error(w, "proxy already running", http.StatusInternalServerError)
+			return
+		}
+		forwards[f.Local] = f
+	})
+	mux.HandleFunc("/services/forwarder/unexpose", func(w http.ResponseWriter, r *http.Request) {
+		var f Forward
+		_ = json.NewDecoder(r.Body).Decode(&f)
+		delete(forwards, f.Local)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := Client{baseURL: server.URL, http: server.Client()}
+	f := Forward{Local: "127.0.0.1:8080", Remote: "192.168.5.15:80", Protocol: TCP}
+
+	if err := c.Add(f); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := c.Add(f); err == nil {
+		t.Errorf("Add() of existing forward expected error")
+	}
+	if got, err := c.List(); err != nil || !reflect.DeepEqual(got, []Forward{f}) {
+		t.Errorf("List() = %+v, %v, want %+v", got, err, []Forward{f})
+	}
+	if err := c.Remove(f); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if got, err := c.List(); err != nil || len(got) != 0 {
+		t.Errorf("List() = %+v, %v, want none", got, err)
+	}
+}
+
+func TestClient_Request(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/leases", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"192.168.5.15":"5a:94:ef:e4:0c:ee"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := Client{baseURL: server.URL, http: server.Client()}
+	want := map[string]string{"192.168.5.15": "5a:94:ef:e4:0c:ee"}
+	if got, err := c.Leases(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Leases() = %v, %v, want %v", got, err, want)
+	}
+	if _, err := c.Request("get", "missing", nil); err == nil {
+		t.Errorf("Request() of missing path expected error")
+	}
+}
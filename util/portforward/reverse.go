@@ -0,0 +1,186 @@
+package portforward
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+)
+
+// Reverse is a port forward from the VM to the host, for reaching services
+// on the host from the VM and the containers.
+type Reverse struct {
+	GuestPort int    `json:"guestPort"` // port listening on all VM addresses
+	Host      string `json:"host"`      // host address e.g. 127.0.0.1:9000
+}
+
+// spec returns the ssh remote forward spec.
+func (r Reverse) spec() string { return fmt.Sprintf("0.0.0.0:%d:%s", r.GuestPort, r.Host) }
+
+// ParseReverse parses the reverse port forward spec in the format [GUEST_PORT:]HOST_PORT.
+// The host port is reached on hostIP, and the guest port defaults to the host port.
+func ParseReverse(spec, hostIP string) (Reverse, error) {
+	guestPort, hostPort, ok := strings.Cut(spec, ":")
+	if !ok {
+		hostPort = guestPort
+	}
+
+	var ports [2]int
+	for i, p := range []string{guestPort, hostPort} {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 65535 {
+			return Reverse{}, fmt.Errorf("invalid port '%s' in '%s'", p, spec)
+		}
+		ports[i] = n
+	}
+
+	return Reverse{GuestPort: ports[0], Host: net.JoinHostPort(hostIP, strconv.Itoa(ports[1]))}, nil
+}
+
+// ReverseFromConfig returns the reverse port forwards for the configured ones.
+func ReverseFromConfig(forwards []config.ReversePortForward) []Reverse {
+	var rs []Reverse
+	for _, f := range forwards {
+		hostIP, hostPort := "127.0.0.1", f.HostPort
+		if f.HostIP != nil {
+			hostIP = f.HostIP.String()
+		}
+		if hostPort == 0 {
+			hostPort = f.GuestPort
+		}
+		rs = append(rs, Reverse{GuestPort: f.GuestPort, Host: net.JoinHostPort(hostIP, strconv.Itoa(hostPort))})
+	}
+	return rs
+}
+
+// reverseStateFile is the file for the active reverse port forwards in the Lima instance directory.
+const reverseStateFile = "colima_reverse_forwards.json"
+
+// ReverseForwarder manages the reverse port forwards of a profile.
+// The forwards are added to the shared SSH connection to the VM and are
+// recorded as they cannot be retrieved from the connection.
+type ReverseForwarder struct {
+	stateFile string
+	// ssh runs ssh with the args for the VM.
+	ssh func(args ...string) error
+}
+
+// NewReverseForwarder creates a reverse port forwarder for the running VM of the profile.
+func NewReverseForwarder(profileID string) ReverseForwarder {
+	return ReverseForwarder{
+		stateFile: filepath.Join(config.ProfileFromName(profileID).LimaInstanceDir(), reverseStateFile),
+		ssh: func(args ...string) error {
+			args = append([]string{"-F", limautil.SSHConfigFile(profileID)}, args...)
+			args = append(args, limautil.SSHHost(profileID))
+
+			var stderr bytes.Buffer
+			cmd := exec.Command("ssh", args...)
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+			}
+			return nil
+		},
+	}
+}
+
+// List returns the active reverse port forwards.
+func (f ReverseForwarder) List() ([]Reverse, error) {
+	b, err := os.ReadFile(f.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading reverse port forwards: %w", err)
+	}
+	var rs []Reverse
+	if err := json.Unmarshal(b, &rs); err != nil {
+		return nil, fmt.Errorf("error decoding reverse port forwards: %w", err)
+	}
+	return rs, nil
+}
+
+// Add adds the reverse port forward.
+func (f ReverseForwarder) Add(r Reverse) error {
+	rs, err := f.List()
+	if err != nil {
+		return err
+	}
+	for _, active := range rs {
+		if active.GuestPort == r.GuestPort {
+			return fmt.Errorf("guest port %d is already forwarded to %s", r.GuestPort, active.Host)
+		}
+	}
+
+	// the shared connection is started if not running e.g. after a restart
+	if err := f.ssh("-O", "check"); err != nil {
+		if err := f.ssh("-o", "ControlMaster=auto", "-o", "ControlPersist=yes", "true"); err != nil {
+			return fmt.Errorf("error connecting to the VM: %w", err)
+		}
+	}
+	if err := f.ssh("-O", "forward", "-R", r.spec()); err != nil {
+		return fmt.Errorf("error adding reverse port forward for guest port %d: %w", r.GuestPort, err)
+	}
+
+	return f.save(append(rs, r))
+}
+
+// Remove removes the reverse port forward for the guest port of r.
+func (f ReverseForwarder) Remove(r Reverse) error {
+	rs, err := f.List()
+	if err != nil {
+		return err
+	}
+	for i, active := range rs {
+		if active.GuestPort != r.GuestPort {
+			continue
+		}
+		if err := f.ssh("-O", "cancel", "-R", active.spec()); err != nil {
+			return fmt.Errorf("error removing reverse port forward for guest port %d: %w", r.GuestPort, err)
+		}
+		return f.save(append(rs[:i], rs[i+1:]...))
+	}
+	return fmt.Errorf("guest port %d is not forwarded", r.GuestPort)
+}
+
+// Reset discards the recorded reverse port forwards and adds rs.
+// It is meant for a freshly started VM, the recorded forwards are no longer active.
+func (f ReverseForwarder) Reset(rs []Reverse) error {
+	if err := f.save(nil); err != nil {
+		return err
+	}
+	var errs []error
+	for _, r := range rs {
+		if err := f.Add(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// save records the active reverse port forwards.
+func (f ReverseForwarder) save(rs []Reverse) error {
+	if len(rs) == 0 {
+		if err := os.Remove(f.stateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error saving reverse port forwards: %w", err)
+		}
+		return nil
+	}
+	b, err := json.Marshal(rs)
+	if err != nil {
+		return fmt.Errorf("error encoding reverse port forwards: %w", err)
+	}
+	if err := os.WriteFile(f.stateFile, b, 0644); err != nil {
+		return fmt.Errorf("error saving reverse port forwards: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package portforward
+
+import (
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+)
+
+func TestParseReverse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Reverse
+		wantErr bool
+	}{
+		{spec: "9003", want: Reverse{GuestPort: 9003, Host: "127.0.0.1:9003"}},
+		{spec: "3000:8080", want: Reverse{GuestPort: 3000, Host: "127.0.0.1:8080"}},
+		{spec: "3000:http", wantErr: true},
+		{spec: "0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseReverse(tt.spec, "127.0.0.1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReverse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseReverse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReverseFromConfig(t *testing.T) {
+	got := ReverseFromConfig([]config.ReversePortForward{
+		{GuestPort: 9003},
+		{GuestPort: 3000, HostPort: 8080, HostIP: net.ParseIP("192.168.1.10")},
+	})
+	want := []Reverse{
+		{GuestPort: 9003, Host: "127.0.0.1:9003"},
+		{GuestPort: 3000, Host: "192.168.1.10:8080"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReverseFromConfig() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReverseForwarder(t *testing.T) {
+	var commands []string
+	f := ReverseForwarder{
+		stateFile: filepath.Join(t.TempDir(), reverseStateFile),
+		ssh: func(args ...string) error {
+			commands = append(commands, strings.Join(args, " "))
+			return nil
+		},
+	}
+
+	r := Reverse{GuestPort: 9003, Host: "127.0.0.1:9003"}
+	if err := f.Reset([]Reverse{r}); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if err := f.Add(Reverse{GuestPort: 9003, Host: "127.0.0.1:9004"}); err == nil {
+		t.Errorf("Add() of forwarded guest port expected error")
+	}
+	if got, err := f.List(); err != nil || !reflect.DeepEqual(got, []Reverse{r}) {
+		t.Errorf("List() = %+v, %v, want %+v", got, err, []Reverse{r})
+	}
+	if err := f.Remove(Reverse{GuestPort: 9003}); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := f.Remove(Reverse{GuestPort: 9003}); err == nil {
+		t.Errorf("Remove() of unforwarded guest port expected error")
+	}
+	if got, err := f.List(); err != nil || len(got) != 0 {
+		t.Errorf("List() = %+v, %v, want none", got, err)
+	}
+
+	want := []string{
+		"-O check",
+		"-O forward -R 0.0.0.0:9003:127.0.0.1:9003",
+		"-O cancel -R 0.0.0.0:9003:127.0.0.1:9003",
+	}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("ssh commands = %q, want %q", commands, want)
+	}
+}
@@ -0,0 +1,242 @@
+// Package proxy resolves the proxy settings of the host for propagation to the VM,
+// the container runtimes and Kubernetes.
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/util"
+	"github.com/sirupsen/logrus"
+)
+
+// GuestHost is the hostname of the host in the VM.
+const GuestHost = "host.lima.internal"
+
+// Settings are the proxy settings.
+type Settings struct {
+	HTTP    string
+	HTTPS   string
+	NoProxy string // comma separated
+}
+
+// Empty returns if no proxy is set.
+func (s Settings) Empty() bool { return s.HTTP == "" && s.HTTPS == "" }
+
+// Env returns the environment variables for the proxy settings,
+// in both lower and upper case e.g. http_proxy and HTTP_PROXY.
+func (s Settings) Env() map[string]string {
+	env := map[string]string{}
+	if s.Empty() {
+		return env
+	}
+	set := func(key, val string) {
+		if val != "" {
+			env[key] = val
+			env[strings.ToUpper(key)] = val
+		}
+	}
+	set("http_proxy", s.HTTP)
+	set("https_proxy", s.HTTPS)
+	set("no_proxy", s.NoProxy)
+	return env
+}
+
+// SystemdDropIn returns the systemd unit drop-in setting the proxy environment variables of a service.
+func (s Settings) SystemdDropIn() string {
+	env := s.Env()
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines := []string{"[Service]"}
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("Environment=%q", k+"="+env[k]))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// WithNoProxy returns the settings with the entries appended to the no proxy list, skipping duplicates.
+func (s Settings) WithNoProxy(entries ...string) Settings {
+	var list []string
+	seen := map[string]bool{}
+	for _, e := range append(strings.Split(s.NoProxy, ","), entries...) {
+		e = strings.TrimSpace(e)
+		if e == "" || seen[e] {
+			continue
+		}
+		seen[e] = true
+		list = append(list, e)
+	}
+	s.NoProxy = strings.Join(list, ",")
+	return s
+}
+
+// Guest returns the settings with the proxies on the loopback address of the host
+// replaced with hostname, for use in the VM.
+func (s Settings) Guest(hostname string) Settings {
+	s.HTTP = guestURL(s.HTTP, hostname)
+	s.HTTPS = guestURL(s.HTTPS, hostname)
+	return s
+}
+
+// guestURL returns the proxy URL with the loopback host replaced with hostname.
+func guestURL(proxy, hostname string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return proxy
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return proxy
+	}
+	if port := u.Port(); port != "" {
+		hostname = net.JoinHostPort(hostname, port)
+	}
+	u.Host = hostname
+	return u.String()
+}
+
+// Resolve returns the proxy settings for conf.
+// The precedence is the proxy config, the env config, the environment variables of
+// the host and lastly the macOS system proxy settings.
+func Resolve(conf config.Config) Settings {
+	if s := (Settings{HTTP: conf.Proxy.HTTP, HTTPS: conf.Proxy.HTTPS}); !s.Empty() {
+		return s.WithNoProxy(conf.Proxy.NoProxy...)
+	}
+
+	getVal := func(key string) string {
+		for _, k := range []string{key, strings.ToUpper(key)} {
+			// config
+			if val, ok := conf.Env[k]; ok {
+				return val
+			}
+			// os
+			if val := os.Getenv(k); val != "" {
+				return val
+			}
+		}
+		return ""
+	}
+	if s := (Settings{HTTP: getVal("http_proxy"), HTTPS: getVal("https_proxy"), NoProxy: getVal("no_proxy")}); !s.Empty() {
+		return s.WithNoProxy(conf.Proxy.NoProxy...)
+	}
+
+	if util.MacOS() && conf.Proxy.System {
+		s, err := System()
+		if err != nil {
+			logrus.Debugf("error retrieving system proxy settings: %v", err)
+		}
+		return s.WithNoProxy(conf.Proxy.NoProxy...)
+	}
+
+	return Settings{}
+}
+
+// NoProxyDefaults returns the addresses that must not be proxied in the VM: the loopback
+// addresses, the host, the VM IP address and the Kubernetes Pod and Service networks.
+func NoProxyDefaults(conf config.Config, vmIP string) []string {
+	entries := []string{"localhost", "127.0.0.1", "::1", GuestHost}
+	if vmIP != "" && vmIP != "127.0.0.1" {
+		entries = append(entries, vmIP)
+	}
+	if conf.Kubernetes.Enabled {
+		podCIDR, serviceCIDR := conf.Kubernetes.PodCIDR, conf.Kubernetes.ServiceCIDR
+		if podCIDR == "" {
+			podCIDR = "10.42.0.0/16" // k3s default
+		}
+		if serviceCIDR == "" {
+			serviceCIDR = "10.43.0.0/16" // k3s default
+		}
+		entries = append(entries, strings.Split(podCIDR, ",")...)
+		entries = append(entries, strings.Split(serviceCIDR, ",")...)
+		if cidr := conf.Kubernetes.LoadBalancerCIDR(); cidr != "" {
+			entries = append(entries, cidr)
+		}
+		entries = append(entries, ".svc", ".cluster.local")
+	}
+	if conf.Network.IPv6 {
+		// unique local addresses of the container and Pod networks
+		entries = append(entries, "fd00::/8")
+	}
+	return entries
+}
+
+// System returns the macOS system proxy settings.
+func System() (Settings, error) {
+	out, err := exec.Command("scutil", "--proxy").Output()
+	if err != nil {
+		return Settings{}, fmt.Errorf("error running scutil: %w", err)
+	}
+	return parseSCUtil(string(out)), nil
+}
+
+// parseSCUtil parses the output of `scutil --proxy`.
+func parseSCUtil(output string) Settings {
+	values := map[string]string{}
+	var exceptions []string
+	inExceptions := false
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, val, ok := strings.Cut(line, " : ")
+		switch {
+		case inExceptions && line == "}":
+			inExceptions = false
+		case inExceptions && ok:
+			exceptions = append(exceptions, noProxyEntry(val))
+		case ok && key == "ExceptionsList":
+			inExceptions = true
+		case ok:
+			values[key] = val
+		}
+	}
+
+	proxy := func(scheme string) string {
+		host, port := values[scheme+"Proxy"], values[scheme+"Port"]
+		if values[scheme+"Enable"] != "1" || host == "" {
+			return ""
+		}
+		if _, err := strconv.Atoi(port); err == nil {
+			host = net.JoinHostPort(host, port)
+		}
+		return "http://" + host
+	}
+
+	s := Settings{HTTP: proxy("HTTP"), HTTPS: proxy("HTTPS")}
+	if s.Empty() {
+		return s
+	}
+	if values["ExcludeSimpleHostnames"] == "1" {
+		exceptions = append(exceptions, "localhost")
+	}
+	return s.WithNoProxy(exceptions...)
+}
+
+// noProxyEntry converts the macOS proxy exception to the no_proxy format
+// e.g. *.local to .local and 169.254/16 to 169.254.0.0/16.
+func noProxyEntry(exception string) string {
+	if domain, ok := strings.CutPrefix(exception, "*."); ok {
+		return "." + domain
+	}
+	if ip, bits, ok := strings.Cut(exception, "/"); ok {
+		if parts := strings.Split(ip, "."); len(parts) < 4 && !strings.Contains(ip, ":") {
+			for len(parts) < 4 {
+				parts = append(parts, "0")
+			}
+			return strings.Join(parts, ".") + "/" + bits
+		}
+	}
+	return exception
+}
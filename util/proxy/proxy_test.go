@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+)
+
+func Test_parseSCUtil(t *testing.T) {
+	output := `<dictionary> {
+  ExceptionsList : <array> {
+    0 : *.local
+    1 : 169.254/16
+    2 : 10.0.0.0/8
+  }
+  ExcludeSimpleHostnames : 1
+  FTPPassive : 1
+  HTTPEnable : 1
+  HTTPPort : 3128
+  HTTPProxy : proxy.example.com
+  HTTPSEnable : 1
+  HTTPSPort : 3129
+  HTTPSProxy : proxy.example.com
+}
+`
+	want := Settings{
+		HTTP:    "http://proxy.example.com:3128",
+		HTTPS:   "http://proxy.example.com:3129",
+		NoProxy: ".local,169.254.0.0/16,10.0.0.0/8,localhost",
+	}
+	if got := parseSCUtil(output); got != want {
+		t.Errorf("parseSCUtil() = %+v, want %+v", got, want)
+	}
+
+	disabled := "<dictionary> {\n  HTTPEnable : 0\n  HTTPPort : 3128\n  HTTPProxy : proxy.example.com\n}\n"
+	if got := parseSCUtil(disabled); !got.Empty() {
+		t.Errorf("parseSCUtil() = %+v, want empty settings", got)
+	}
+}
+
+func TestSettings_Guest(t *testing.T) {
+	s := Settings{HTTP: "http://127.0.0.1:8080", HTTPS: "http://proxy.example.com:8080"}.Guest(GuestHost)
+	if want := "http://host.lima.internal:8080"; s.HTTP != want {
+		t.Errorf("HTTP = %s, want %s", s.HTTP, want)
+	}
+	if want := "http://proxy.example.com:8080"; s.HTTPS != want {
+		t.Errorf("HTTPS = %s, want %s", s.HTTPS, want)
+	}
+	if got := guestURL("http://localhost", GuestHost); got != "http://host.lima.internal" {
+		t.Errorf("guestURL() = %s", got)
+	}
+}
+
+func TestNoProxyDefaults(t *testing.T) {
+	conf := config.Config{Kubernetes: config.Kubernetes{Enabled: true, ServiceCIDR: "10.96.0.0/12"}}
+	conf.Kubernetes.LoadBalancer.Enabled = true
+	s := Settings{HTTP: "http://proxy:3128", NoProxy: "localhost,.example.com"}.WithNoProxy(NoProxyDefaults(conf, "192.168.106.2")...)
+
+	entries := strings.Split(s.NoProxy, ",")
+	for _, want := range []string{".example.com", "192.168.106.2", "10.42.0.0/16", "10.96.0.0/12", config.DefaultLoadBalancerCIDR, ".svc", ".cluster.local", GuestHost} {
+		if !slices.Contains(entries, want) {
+			t.Errorf("NoProxy = %s, missing %s", s.NoProxy, want)
+		}
+	}
+	if n := strings.Count(s.NoProxy, "localhost"); n != 1 {
+		t.Errorf("NoProxy = %s, want localhost once", s.NoProxy)
+	}
+
+	env := s.Env()
+	if env["NO_PROXY"] != s.NoProxy || env["no_proxy"] != s.NoProxy || env["HTTP_PROXY"] != s.HTTP {
+		t.Errorf("Env() = %v", env)
+	}
+	if _, ok := env["HTTPS_PROXY"]; ok {
+		t.Errorf("Env() = %v, unexpected HTTPS_PROXY", env)
+	}
+}
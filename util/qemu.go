@@ -14,3 +14,23 @@ func AssertQemuImg() error {
 
 	return nil
 }
+
+// AssertKrunkit checks if krunkit is installed, for GPU acceleration.
+func AssertKrunkit() error {
+	cmd := "krunkit"
+	if _, err := exec.LookPath(cmd); err != nil {
+		return fmt.Errorf("%s not found, run 'brew tap slp/krunkit && brew install %s' to install", cmd, cmd)
+	}
+
+	return nil
+}
+
+// AssertAppleContainer checks if the container CLI of Apple is installed, for the apple vmType.
+func AssertAppleContainer() error {
+	cmd := "container"
+	if _, err := exec.LookPath(cmd); err != nil {
+		return fmt.Errorf("%s not found, install it from https://github.com/apple/container/releases", cmd)
+	}
+
+	return nil
+}
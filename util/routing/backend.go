@@ -0,0 +1,149 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+
+	"github.com/abiosoft/colima/util"
+)
+
+var (
+	// ErrRouteNotFound is returned when a route does not exist in the host routing table.
+	ErrRouteNotFound = errors.New("route not found")
+	// ErrPermission is returned when the host routing table cannot be modified due to insufficient privileges.
+	ErrPermission = errors.New("insufficient privileges to modify routes")
+	// ErrUnsupported is returned when route manipulation is not supported on the host OS.
+	ErrUnsupported = errors.New("route manipulation not supported on this OS")
+)
+
+// Route is a host route for a network via a gateway.
+type Route struct {
+	Destination *net.IPNet
+	Gateway     net.IP
+	Interface   string // only set for listed routes
+}
+
+func (r Route) String() string {
+	if r.Gateway == nil {
+		return r.Destination.String()
+	}
+	return r.Destination.String() + " -> " + r.Gateway.String()
+}
+
+// via returns the gateway or the interface of the route.
+func (r Route) via() string {
+	if r.Gateway != nil {
+		return r.Gateway.String()
+	}
+	return r.Interface
+}
+
+// RouteBackend manipulates the host routing table.
+type RouteBackend interface {
+	// Get returns the route for the exact destination network.
+	// ErrRouteNotFound is returned if there is none.
+	Get(dst *net.IPNet) (Route, error)
+	// Add adds the route, replacing any existing route for the destination.
+	Add(ctx context.Context, r Route) error
+	// Delete removes the route for the destination network.
+	// ErrRouteNotFound is returned if there is none.
+	Delete(ctx context.Context, dst *net.IPNet) error
+	// List returns the network routes in the routing table, including the
+	// networks of the interfaces. Default and host routes are omitted.
+	List() ([]Route, error)
+}
+
+// defaultBackend returns the route backend for the host OS.
+func defaultBackend() RouteBackend {
+	native := newNativeBackend()
+	if os.Geteuid() == 0 {
+		return native
+	}
+	return sudoBackend{native}
+}
+
+// sudoBackend uses the native backend for route lookups and falls back to
+// the privileged helper, or route(8) or ip(8) via sudo, when the native backend
+// lacks the privileges to modify the routing table.
+type sudoBackend struct{ RouteBackend }
+
+func (s sudoBackend) Add(ctx context.Context, r Route) error {
+	err := s.RouteBackend.Add(ctx, r)
+	if !errors.Is(err, ErrPermission) {
+		return err
+	}
+
+	cidr := r.Destination.String()
+	if HelperInstalled() && helperPermits(cidr) {
+		return runHelper(ctx, "add", cidr, r.Gateway.String())
+	}
+
+	_, err = s.Get(r.Destination)
+	return runSudo(ctx, routeAddArgs(r, err == nil)...)
+}
+
+func (s sudoBackend) Delete(ctx context.Context, dst *net.IPNet) error {
+	err := s.RouteBackend.Delete(ctx, dst)
+	if !errors.Is(err, ErrPermission) {
+		return err
+	}
+
+	cidr := dst.String()
+	if HelperInstalled() && helperPermits(cidr) {
+		return runHelper(ctx, "delete", cidr)
+	}
+
+	return runSudo(ctx, routeDeleteArgs(cidr)...)
+}
+
+// routeAddArgs returns the route(8) or ip(8) args to add the route.
+// exists indicates that a route for the destination exists and is to be replaced.
+func routeAddArgs(r Route, exists bool) []string {
+	cidr := r.Destination.String()
+	if util.Linux() {
+		return append(linuxRouteArgs(cidr, "replace"), "via", r.Gateway.String())
+	}
+	action := "add"
+	if exists {
+		action = "change"
+	}
+	return append(macOSRouteArgs(cidr, "route", action), r.Gateway.String())
+}
+
+// routeDeleteArgs returns the route(8) or ip(8) args to delete the route for cidr.
+func routeDeleteArgs(cidr string) []string {
+	if util.Linux() {
+		return linuxRouteArgs(cidr, "del")
+	}
+	return macOSRouteArgs(cidr, "route", "delete")
+}
+
+// runSudo runs the command with sudo.
+func runSudo(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "sudo", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// parseRoute returns the route for cidr via gateway.
+// gateway can be empty.
+func parseRoute(cidr, gateway string) (Route, error) {
+	_, dst, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return Route{}, fmt.Errorf("invalid network CIDR '%s': %w", cidr, err)
+	}
+	r := Route{Destination: dst}
+	if gateway != "" {
+		r.Gateway = net.ParseIP(gateway)
+		if r.Gateway == nil {
+			return Route{}, fmt.Errorf("invalid gateway IP address '%s'", gateway)
+		}
+	}
+	return r, nil
+}
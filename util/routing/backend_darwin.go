@@ -0,0 +1,187 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+
+	"golang.org/x/net/route"
+	"golang.org/x/sys/unix"
+)
+
+// nativeBackend manipulates the host routing table via PF_ROUTE sockets.
+type nativeBackend struct{}
+
+func newNativeBackend() RouteBackend { return nativeBackend{} }
+
+// routeSeq is the sequence number for routing socket messages.
+var routeSeq int32
+
+func (b nativeBackend) Get(dst *net.IPNet) (Route, error) {
+	msg, err := b.request(unix.RTM_GET, Route{Destination: dst})
+	if err != nil {
+		return Route{}, err
+	}
+
+	// the lookup returns the best matching route, only an exact match is relevant
+	if len(msg.Addrs) <= unix.RTAX_NETMASK {
+		return Route{}, ErrRouteNotFound
+	}
+	ip, mask := addrIP(msg.Addrs[unix.RTAX_DST]), addrIP(msg.Addrs[unix.RTAX_NETMASK])
+	if ip == nil || !ip.Equal(dst.IP) || mask == nil || !net.IP(dst.Mask).Equal(mask) {
+		return Route{}, ErrRouteNotFound
+	}
+
+	r := Route{Destination: dst}
+	if msg.Flags&unix.RTF_GATEWAY != 0 {
+		r.Gateway = addrIP(msg.Addrs[unix.RTAX_GATEWAY])
+	}
+	return r, nil
+}
+
+func (b nativeBackend) Add(_ context.Context, r Route) error {
+	_, err := b.request(unix.RTM_ADD, r)
+	if errors.Is(err, unix.EEXIST) {
+		_, err = b.request(unix.RTM_CHANGE, r)
+	}
+	return err
+}
+
+func (b nativeBackend) Delete(_ context.Context, dst *net.IPNet) error {
+	_, err := b.request(unix.RTM_DELETE, Route{Destination: dst})
+	return err
+}
+
+func (nativeBackend) List() ([]Route, error) {
+	rib, err := route.FetchRIB(unix.AF_UNSPEC, route.RIBTypeRoute, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving routing table: %w", err)
+	}
+	msgs, err := route.ParseRIB(route.RIBTypeRoute, rib)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing routing table: %w", err)
+	}
+
+	var list []Route
+	for _, m := range msgs {
+		msg, ok := m.(*route.RouteMessage)
+		if !ok || msg.Flags&(unix.RTF_HOST|unix.RTF_LLINFO|unix.RTF_WASCLONED) != 0 || len(msg.Addrs) <= unix.RTAX_NETMASK {
+			continue
+		}
+		ip, mask := addrIP(msg.Addrs[unix.RTAX_DST]), addrIP(msg.Addrs[unix.RTAX_NETMASK])
+		if ip == nil || mask == nil || len(ip) != len(mask) {
+			continue
+		}
+		dst := &net.IPNet{IP: ip, Mask: net.IPMask(mask)}
+		if ones, bits := dst.Mask.Size(); ones == 0 || ones == bits {
+			// default, host or non-contiguous netmask
+			continue
+		}
+
+		r := Route{Destination: dst}
+		if msg.Flags&unix.RTF_GATEWAY != 0 {
+			r.Gateway = addrIP(msg.Addrs[unix.RTAX_GATEWAY])
+		}
+		if iface, err := net.InterfaceByIndex(msg.Index); err == nil {
+			r.Interface = iface.Name
+		}
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+// request sends the routing message of type typ for the route.
+// The reply is only awaited for RTM_GET requests.
+func (nativeBackend) request(typ int, r Route) (*route.RouteMessage, error) {
+	fd, err := unix.Socket(unix.AF_ROUTE, unix.SOCK_RAW, unix.AF_UNSPEC)
+	if err != nil {
+		return nil, fmt.Errorf("error opening routing socket: %w", err)
+	}
+	defer func() { _ = unix.Close(fd) }()
+
+	addrs := make([]route.Addr, unix.RTAX_MAX)
+	addrs[unix.RTAX_DST] = toAddr(r.Destination.IP)
+	addrs[unix.RTAX_NETMASK] = toAddr(net.IP(r.Destination.Mask))
+
+	flags := unix.RTF_UP | unix.RTF_STATIC
+	if r.Gateway != nil {
+		flags |= unix.RTF_GATEWAY
+		addrs[unix.RTAX_GATEWAY] = toAddr(r.Gateway)
+	}
+
+	msg := route.RouteMessage{
+		Version: unix.RTM_VERSION,
+		Type:    typ,
+		Flags:   flags,
+		ID:      uintptr(os.Getpid()),
+		Seq:     int(atomic.AddInt32(&routeSeq, 1)),
+		Addrs:   addrs,
+	}
+	b, err := msg.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error creating routing message: %w", err)
+	}
+	if _, err := unix.Write(fd, b); err != nil {
+		return nil, routeError(err)
+	}
+	if typ != unix.RTM_GET {
+		return nil, nil
+	}
+
+	buf := make([]byte, os.Getpagesize())
+	for {
+		n, err := unix.Read(fd, buf)
+		if err != nil {
+			return nil, fmt.Errorf("error reading routing socket: %w", err)
+		}
+		msgs, err := route.ParseRIB(route.RIBTypeRoute, buf[:n])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing routing message: %w", err)
+		}
+		for _, m := range msgs {
+			if reply, ok := m.(*route.RouteMessage); ok && reply.ID == msg.ID && reply.Seq == msg.Seq {
+				if reply.Err != nil {
+					return nil, routeError(reply.Err)
+				}
+				return reply, nil
+			}
+		}
+	}
+}
+
+// toAddr converts ip to a routing socket address.
+func toAddr(ip net.IP) route.Addr {
+	if ip4 := ip.To4(); ip4 != nil {
+		a := &route.Inet4Addr{}
+		copy(a.IP[:], ip4)
+		return a
+	}
+	a := &route.Inet6Addr{}
+	copy(a.IP[:], ip.To16())
+	return a
+}
+
+// addrIP converts a routing socket address to an IP.
+func addrIP(addr route.Addr) net.IP {
+	switch a := addr.(type) {
+	case *route.Inet4Addr:
+		return net.IP(a.IP[:])
+	case *route.Inet6Addr:
+		return net.IP(a.IP[:])
+	}
+	return nil
+}
+
+// routeError maps routing socket errors to the backend errors.
+func routeError(err error) error {
+	switch {
+	case errors.Is(err, unix.ESRCH):
+		return ErrRouteNotFound
+	case errors.Is(err, unix.EPERM), errors.Is(err, unix.EACCES):
+		return fmt.Errorf("%w: %w", ErrPermission, err)
+	}
+	return err
+}
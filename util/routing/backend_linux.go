@@ -0,0 +1,82 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// nativeBackend manipulates the host routing table via netlink.
+type nativeBackend struct{}
+
+func newNativeBackend() RouteBackend { return nativeBackend{} }
+
+func (nativeBackend) Get(dst *net.IPNet) (Route, error) {
+	routes, err := netlink.RouteListFiltered(family(dst), &netlink.Route{Dst: dst}, netlink.RT_FILTER_DST)
+	if err != nil {
+		return Route{}, netlinkError(err)
+	}
+	for _, r := range routes {
+		if r.Dst != nil && r.Dst.String() == dst.String() {
+			return Route{Destination: r.Dst, Gateway: r.Gw}, nil
+		}
+	}
+	return Route{}, ErrRouteNotFound
+}
+
+func (nativeBackend) Add(_ context.Context, r Route) error {
+	return netlinkError(netlink.RouteReplace(&netlink.Route{Dst: r.Destination, Gw: r.Gateway}))
+}
+
+func (nativeBackend) Delete(_ context.Context, dst *net.IPNet) error {
+	return netlinkError(netlink.RouteDel(&netlink.Route{Dst: dst}))
+}
+
+func (nativeBackend) List() ([]Route, error) {
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, netlinkError(err)
+	}
+
+	var list []Route
+	for _, r := range routes {
+		if r.Dst == nil {
+			// default route
+			continue
+		}
+		if ones, bits := r.Dst.Mask.Size(); ones == 0 || ones == bits {
+			continue
+		}
+		route := Route{Destination: r.Dst, Gateway: r.Gw}
+		if link, err := netlink.LinkByIndex(r.LinkIndex); err == nil {
+			route.Interface = link.Attrs().Name
+		}
+		list = append(list, route)
+	}
+	return list, nil
+}
+
+// family returns the netlink address family of the network.
+func family(n *net.IPNet) int {
+	if n.IP.To4() == nil {
+		return netlink.FAMILY_V6
+	}
+	return netlink.FAMILY_V4
+}
+
+// netlinkError maps netlink errors to the backend errors.
+func netlinkError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, unix.ESRCH):
+		return ErrRouteNotFound
+	case errors.Is(err, unix.EPERM), errors.Is(err, unix.EACCES):
+		return fmt.Errorf("%w: %w", ErrPermission, err)
+	}
+	return err
+}
@@ -0,0 +1,18 @@
+//go:build !darwin && !linux
+
+package routing
+
+import (
+	"context"
+	"net"
+)
+
+// nativeBackend is a stub for unsupported operating systems.
+type nativeBackend struct{}
+
+func newNativeBackend() RouteBackend { return nativeBackend{} }
+
+func (nativeBackend) Get(*net.IPNet) (Route, error)            { return Route{}, ErrUnsupported }
+func (nativeBackend) Add(context.Context, Route) error         { return ErrUnsupported }
+func (nativeBackend) Delete(context.Context, *net.IPNet) error { return ErrUnsupported }
+func (nativeBackend) List() ([]Route, error)                   { return nil, ErrUnsupported }
@@ -0,0 +1,38 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+)
+
+// containerSubnetsFormat is the network inspect format for the network subnets.
+const containerSubnetsFormat = `{{range .IPAM.Config}}{{.Subnet}} {{end}}`
+
+// GetContainerCIDR retrieves the bridge network CIDRs of the container runtime in the VM of the profile.
+// e.g. 172.17.0.0/16 for the default docker bridge and the user-defined networks.
+func GetContainerCIDR(ctx context.Context, profile, runtime string) ([]string, error) {
+	var script string
+	switch runtime {
+	case docker.Name:
+		script = fmt.Sprintf("docker network inspect -f '%s' $(docker network ls -q --filter driver=bridge)", containerSubnetsFormat)
+	case containerd.Name:
+		script = fmt.Sprintf("nerdctl network inspect -f '%s' $(nerdctl network ls -q)", containerSubnetsFormat)
+	default:
+		return nil, fmt.Errorf("container network routing not supported for runtime '%s'", runtime)
+	}
+
+	guest := newGuest(profile)
+	if !guest.Running(ctx) {
+		return nil, fmt.Errorf("VM not running")
+	}
+
+	output, err := guest.RunOutput("sudo", "sh", "-c", script)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving container networks: %w", err)
+	}
+
+	return mergeCIDRs(fieldCIDRs(output)), nil
+}
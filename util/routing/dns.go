@@ -0,0 +1,139 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// ClusterDomain is the Kubernetes cluster domain.
+const ClusterDomain = "cluster.local"
+
+// clusterDNSFile returns the host resolver config file for the cluster domain.
+func clusterDNSFile() string {
+	if util.Linux() {
+		return "/etc/systemd/resolved.conf.d/colima-" + ClusterDomain + ".conf"
+	}
+	return "/etc/resolver/" + ClusterDomain
+}
+
+// clusterDNSHeader returns the header identifying the resolver config of the profile.
+func clusterDNSHeader(profile string) string {
+	return "# generated by colima for " + profile + ", do not edit"
+}
+
+// clusterDNSConfig returns the host resolver config for the cluster domain.
+func clusterDNSConfig(profile, dnsIP string) string {
+	lines := []string{clusterDNSHeader(profile)}
+	if util.Linux() {
+		lines = append(lines, "[Resolve]", "DNS="+dnsIP, "Domains=~"+ClusterDomain)
+	} else {
+		lines = append(lines, "domain "+ClusterDomain, "nameserver "+dnsIP)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// GetClusterDNSIP retrieves the Service IP address of the cluster DNS (CoreDNS) in the VM of the profile.
+func GetClusterDNSIP(ctx context.Context, profile string) (string, error) {
+	api, err := newKubeAPI(ctx, profile)
+	if err != nil {
+		return "", err
+	}
+
+	var service kubeService
+	if err := api.get("/api/v1/namespaces/kube-system/services/kube-dns", &service); err != nil {
+		return "", fmt.Errorf("error retrieving cluster DNS service: %w", err)
+	}
+
+	ip := service.Spec.ClusterIP
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("invalid cluster DNS IP address: '%s'", ip)
+	}
+	return ip, nil
+}
+
+// SetupClusterDNS configures the host to resolve the cluster domain with the cluster DNS at dnsIP.
+// macOS uses /etc/resolver, Linux uses systemd-resolved.
+func (rm *RouteManager) SetupClusterDNS(host environment.HostActions, dnsIP string) error {
+	if !supported() {
+		log.Debug("Cluster DNS setup is only supported on macOS and Linux")
+		return nil
+	}
+
+	file := clusterDNSFile()
+	conf := clusterDNSConfig(rm.profile, dnsIP)
+
+	// nothing to do if unchanged
+	if b, err := os.ReadFile(file); err == nil && string(b) == conf {
+		return nil
+	}
+
+	dir := file[:strings.LastIndex(file, "/")]
+	if rm.plan != nil {
+		rm.plan.add(Change{Kind: ChangeResolver, Action: "write", Target: file, Content: conf,
+			Command: fmt.Sprintf("sudo mkdir -p %s && sudo tee %s >/dev/null", dir, file)})
+		return nil
+	}
+	if err := host.RunQuiet("sudo", "mkdir", "-p", dir); err != nil {
+		return fmt.Errorf("error creating resolver directory: %w", err)
+	}
+
+	stdout := &bytes.Buffer{}
+	if err := host.RunWith(strings.NewReader(conf), stdout, "sudo", "sh", "-c", "cat > "+file); err != nil {
+		return fmt.Errorf("error writing resolver config, stderr: %s, err: %w", stdout.String(), err)
+	}
+
+	if err := reloadResolver(host); err != nil {
+		return err
+	}
+
+	log.Infof("Host DNS resolution configured for *.%s via %s", ClusterDomain, dnsIP)
+	return nil
+}
+
+// CleanupClusterDNS removes the host resolver config for the cluster domain.
+// The config is only removed if it was created for the profile.
+func (rm *RouteManager) CleanupClusterDNS(host environment.HostActions) error {
+	if !supported() {
+		return nil
+	}
+
+	file := clusterDNSFile()
+	b, err := os.ReadFile(file)
+	if err != nil || !strings.HasPrefix(string(b), clusterDNSHeader(rm.profile)+"\n") {
+		// not present or not created for the profile
+		return nil
+	}
+
+	if rm.plan != nil {
+		rm.plan.add(Change{Kind: ChangeResolver, Action: "remove", Target: file, Command: sudoCommand("rm", "-f", file)})
+		return nil
+	}
+
+	if err := host.RunQuiet("sudo", "rm", "-f", file); err != nil {
+		return fmt.Errorf("error removing resolver config: %w", err)
+	}
+
+	return reloadResolver(host)
+}
+
+// reloadResolver reloads the host DNS resolver config.
+func reloadResolver(host environment.HostActions) error {
+	if util.Linux() {
+		if err := host.RunQuiet("sudo", "systemctl", "restart", "systemd-resolved"); err != nil {
+			return fmt.Errorf("error restarting systemd-resolved: %w", err)
+		}
+		return nil
+	}
+
+	// macOS picks up /etc/resolver changes, the cache is flushed for stale entries
+	_ = host.RunQuiet("sudo", "killall", "-HUP", "mDNSResponder")
+	return nil
+}
@@ -0,0 +1,312 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/util"
+)
+
+// Finding status values.
+const (
+	FindingOK      = "ok"
+	FindingWarning = "warning"
+	FindingFailed  = "failed"
+	FindingSkipped = "skipped"
+)
+
+// doctorTimeout is the timeout of the network probes.
+const doctorTimeout = 3 * time.Second
+
+// doctorHost is the hostname resolved and reached from the VM to check the internet access.
+const doctorHost = "github.com"
+
+// Finding is the result of a network diagnostic check.
+type Finding struct {
+	Check  string `json:"check"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Hint   string `json:"hint,omitempty"` // suggested action for a warning or failure
+}
+
+// Diagnose runs the network diagnostic checks for the VM of the profile.
+// The checks depending on a failed check are skipped.
+func Diagnose(ctx context.Context, profile string, conf config.Config) []Finding {
+	var findings []Finding
+	add := func(f Finding) Finding {
+		findings = append(findings, f)
+		return f
+	}
+	guest := newGuest(profile)
+
+	ssh := add(checkSSH(ctx, guest))
+
+	switch {
+	case !conf.Network.Address:
+		add(Finding{Check: "address", Status: FindingSkipped, Detail: "network address is not enabled"})
+	case util.Linux():
+		add(Finding{Check: "address", Status: FindingSkipped, Detail: "the VM has no IP address reachable from Linux hosts, the WireGuard tunnel is used for routing"})
+	default:
+		vmIP, err := GetVMIP(ctx, profile)
+		if err != nil {
+			add(Finding{Check: "address", Status: FindingFailed, Detail: err.Error(),
+				Hint: "restart the VM with 'colima restart', the network daemon may have failed to start"})
+			break
+		}
+		add(Finding{Check: "address", Status: FindingOK, Detail: vmIP})
+		add(checkPing(ctx, vmIP))
+	}
+
+	if ssh.Status != FindingOK {
+		for _, check := range []string{"internet", "dns", "mtu", "port forwards"} {
+			add(Finding{Check: check, Status: FindingSkipped, Detail: "VM not reachable via ssh"})
+		}
+	} else {
+		dns := add(checkDNS(guest))
+		add(checkInternet(guest, dns.Status == FindingOK))
+		add(checkMTU(guest, conf.Network.MTU))
+		add(checkPortForwards(guest, conf.Network.PortForwards))
+	}
+
+	add(checkRoutes(ctx, profile, conf))
+
+	return findings
+}
+
+// checkSSH checks the ssh connection to the VM.
+func checkSSH(ctx context.Context, guest vmGuest) Finding {
+	f := Finding{Check: "ssh"}
+	if !guest.Running(ctx) {
+		f.Status, f.Detail, f.Hint = FindingFailed, "VM not running", "start the VM with 'colima start'"
+		return f
+	}
+	if err := guest.RunQuiet("true"); err != nil {
+		f.Status, f.Detail, f.Hint = FindingFailed, err.Error(), "restart the VM with 'colima restart'"
+		return f
+	}
+	f.Status = FindingOK
+	return f
+}
+
+// checkPing checks the reachability of the VM address from the host.
+func checkPing(ctx context.Context, ip string) Finding {
+	f := Finding{Check: "ping", Detail: "host to " + ip}
+
+	// the timeout flag in seconds differs on macOS
+	timeout := []string{"-W", "2"}
+	if util.MacOS() {
+		timeout = []string{"-t", "2"}
+	}
+	args := append([]string{"-c", "1"}, timeout...)
+	if err := exec.CommandContext(ctx, "ping", append(args, ip)...).Run(); err != nil {
+		f.Status = FindingFailed
+		f.Hint = "check for a VPN or firewall on the host blocking the VM network"
+		return f
+	}
+	f.Status = FindingOK
+	return f
+}
+
+// checkDNS checks the DNS resolution in the VM.
+func checkDNS(guest vmGuest) Finding {
+	f := Finding{Check: "dns", Detail: "resolve " + doctorHost}
+	out, err := guest.RunOutput("getent", "hosts", doctorHost)
+	if err != nil || strings.TrimSpace(out) == "" {
+		f.Status = FindingFailed
+		f.Hint = "check network.dns in the config, or the DNS settings of the host and VPN"
+		return f
+	}
+	f.Status = FindingOK
+	f.Detail += ": " + strings.Fields(out)[0]
+	return f
+}
+
+// checkInternet checks the internet access from the VM, by hostname if DNS resolution works.
+func checkInternet(guest vmGuest, dns bool) Finding {
+	target := "https://" + doctorHost
+	if !dns {
+		target = "http://1.1.1.1"
+	}
+	f := Finding{Check: "internet", Detail: "VM to " + target}
+	timeout := strconv.Itoa(int(doctorTimeout.Seconds()))
+	if err := guest.RunQuiet("curl", "-sS", "-o", "/dev/null", "-m", timeout, target); err != nil {
+		f.Status = FindingFailed
+		f.Hint = "check the proxy settings and for a VPN or firewall on the host blocking the VM traffic"
+		return f
+	}
+	f.Status = FindingOK
+	return f
+}
+
+// mtuExternalAddress is probed in addition to the default gateway of the VM, as the path MTU
+// is commonly lowered beyond the gateway e.g. by a VPN on the host.
+const mtuExternalAddress = "1.1.1.1"
+
+// checkMTU probes the path MTU from the VM to its default gateway and to an external address
+// with unfragmented packets. Addresses not answering ICMP are not considered.
+func checkMTU(guest vmGuest, configured int) Finding {
+	f := Finding{Check: "mtu"}
+
+	script := `gw=$(ip -4 route show default | awk '{print $3; exit}'); dev=$(ip -4 route show default | awk '{print $5; exit}'); echo "$gw $(cat /sys/class/net/$dev/mtu)"`
+	out, err := guest.RunOutput("sh", "-c", script)
+	fields := strings.Fields(out)
+	if err != nil || len(fields) != 2 {
+		f.Status, f.Detail = FindingSkipped, "default route not found"
+		return f
+	}
+	gateway := fields[0]
+	mtu, err := strconv.Atoi(fields[1])
+	if err != nil {
+		f.Status, f.Detail = FindingSkipped, "interface MTU not found"
+		return f
+	}
+
+	probe := func(size int, address string) bool {
+		// 28 bytes of IP and ICMP headers
+		return guest.RunQuiet("ping", "-c", "1", "-W", "2", "-M", "do", "-s", strconv.Itoa(size-28), address) == nil
+	}
+
+	var probed bool
+	for _, address := range []string{gateway, mtuExternalAddress} {
+		if !probe(minProbeMTU, address) {
+			continue
+		}
+		if !probe(mtu, address) {
+			f := mtuFinding(mtu, configured, false, true)
+			f.Detail += " to " + address
+			return f
+		}
+		probed = true
+	}
+	return mtuFinding(mtu, configured, probed, probed)
+}
+
+// minProbeMTU is the packet size known to pass on all the networks, for telling apart
+// an MTU mismatch from ICMP being unavailable.
+const minProbeMTU = 1280
+
+// mtuFinding returns the MTU finding for the probe results of the interface MTU and the minimum MTU.
+func mtuFinding(mtu, configured int, full, minimum bool) Finding {
+	f := Finding{Check: "mtu", Detail: fmt.Sprintf("interface MTU %d", mtu)}
+	switch {
+	case full:
+		f.Status = FindingOK
+	case !minimum:
+		f.Status = FindingSkipped
+		f.Detail += ", ICMP not available"
+	default:
+		f.Status = FindingWarning
+		f.Detail += " exceeds the path MTU"
+		f.Hint = "lower network.mtu in the config, e.g. 1400 when connected via a VPN"
+		if configured > 0 {
+			f.Hint = fmt.Sprintf("lower network.mtu from %d in the config", configured)
+		}
+	}
+	if configured > 0 && configured != mtu {
+		f.Status = FindingWarning
+		f.Detail += fmt.Sprintf(", configured %d", configured)
+		f.Hint = "restart the VM with 'colima restart' to apply network.mtu"
+	}
+	return f
+}
+
+// checkPortForwards checks the reachability of the configured TCP port forwards from the host.
+// Forwards with the guest port not listening in the VM are not reachable and are ignored.
+func checkPortForwards(guest vmGuest, forwards []config.PortForward) Finding {
+	f := Finding{Check: "port forwards"}
+
+	var checked int
+	var failed []string
+	for _, p := range forwards {
+		if p.Protocol != "" && p.Protocol != "tcp" {
+			continue
+		}
+		out, err := guest.RunOutput("ss", "-Hltn", "sport = :"+strconv.Itoa(p.GuestPort))
+		if err != nil || strings.TrimSpace(out) == "" {
+			continue
+		}
+		checked++
+
+		hostIP, hostPort := "127.0.0.1", p.GuestPort
+		if p.HostIP != nil && !p.HostIP.IsUnspecified() {
+			hostIP = p.HostIP.String()
+		}
+		if p.HostPort > 0 {
+			hostPort = p.HostPort
+		}
+		address := net.JoinHostPort(hostIP, strconv.Itoa(hostPort))
+		conn, err := net.DialTimeout("tcp", address, doctorTimeout)
+		if err != nil {
+			failed = append(failed, address)
+			continue
+		}
+		_ = conn.Close()
+	}
+
+	switch {
+	case checked == 0:
+		f.Status, f.Detail = FindingSkipped, "no configured port forward listening in the VM"
+	case len(failed) > 0:
+		f.Status = FindingFailed
+		f.Detail = "not reachable: " + strings.Join(failed, ", ")
+		f.Hint = "check for another process using the host port, or add the forward with 'colima port add'"
+	default:
+		f.Status, f.Detail = FindingOK, fmt.Sprintf("%d reachable", checked)
+	}
+	return f
+}
+
+// checkRoutes checks the host routes to the Pod, Service and container networks.
+func checkRoutes(ctx context.Context, profile string, conf config.Config) Finding {
+	f := Finding{Check: "routes"}
+	if !conf.Kubernetes.Enabled && !conf.Network.ContainerRoutes {
+		f.Status, f.Detail = FindingSkipped, "neither kubernetes nor container routes are enabled"
+		return f
+	}
+
+	rm, err := ProfileRouteManager(ctx, profile, conf)
+	if err != nil {
+		f.Status, f.Detail = FindingSkipped, err.Error()
+		return f
+	}
+	statuses, err := rm.Status(ctx)
+	if err != nil {
+		f.Status, f.Detail = FindingFailed, err.Error()
+		return f
+	}
+
+	var problems []string
+	for _, s := range statuses {
+		if s.Status != RouteActive {
+			problems = append(problems, s.CIDR+" "+s.Status)
+		}
+	}
+	if len(problems) > 0 {
+		f.Status = FindingFailed
+		f.Detail = strings.Join(problems, ", ")
+		f.Hint = "repair the routes with 'colima routing repair'"
+		return f
+	}
+	f.Status, f.Detail = FindingOK, fmt.Sprintf("%d active", len(statuses))
+	return f
+}
+
+// FindingsErr returns an error if any of the findings failed.
+func FindingsErr(findings []Finding) error {
+	var failed int
+	for _, f := range findings {
+		if f.Status == FindingFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d network checks failed", failed, len(findings))
+	}
+	return nil
+}
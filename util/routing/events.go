@@ -0,0 +1,100 @@
+package routing
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/sirupsen/logrus"
+)
+
+// Routing events, recorded in the daemon log for diagnosing host access to the networks.
+const (
+	EventRouteAdded     = "route_added"
+	EventRouteAddFailed = "route_add_failed"
+	EventRouteRemoved   = "route_removed"
+	EventRoutePruned    = "route_pruned"
+	EventPFLoaded       = "pf_loaded"
+	EventPFFlushed      = "pf_flushed"
+	EventRepair         = "repair_attempted"
+)
+
+// eventLogFile returns the path to the log file for the routing events.
+// The events are appended to the daemon log of the current profile.
+func eventLogFile() string { return filepath.Join(process.Dir(), "daemon.log") }
+
+// profileEventLogFile returns the path to the daemon log of the profile.
+func profileEventLogFile(profile string) string {
+	return filepath.Join(profileDaemonDir(profile), "daemon.log")
+}
+
+// prunedEventLogFile returns the event log file for the pruned routes of the profile,
+// the daemon log of the profile or of the current profile if the profile is deleted.
+func prunedEventLogFile(profile string) string {
+	if _, err := os.Stat(profileDaemonDir(profile)); err != nil {
+		return eventLogFile()
+	}
+	return profileEventLogFile(profile)
+}
+
+// profileDaemonDir returns the daemon directory of the profile.
+// The path is derived from the current profile to avoid creating the
+// config directory of a deleted profile.
+func profileDaemonDir(profile string) string {
+	current := config.CurrentProfile()
+	p := config.ProfileFromName(profile)
+	if p.ID == current.ID {
+		return process.Dir()
+	}
+	dir := filepath.Dir(current.ConfigDir())
+	return filepath.Join(dir, p.ShortName, filepath.Base(process.Dir()))
+}
+
+// eventLogFile returns the event log file of the route manager.
+func (rm *RouteManager) eventLogFile() string {
+	if rm.eventLog != "" {
+		return rm.eventLog
+	}
+	return profileEventLogFile(rm.profile)
+}
+
+// emit records the routing event for the route manager.
+// Events are not recorded for dry-runs.
+func (rm *RouteManager) emit(event, cidr, gateway string, err error) {
+	if rm.plan != nil {
+		return
+	}
+	emitEvent(rm.eventLogFile(), event, rm.profile, cidr, gateway, err)
+}
+
+// emitEvent appends the routing event to file in JSON.
+// Failures are ignored, the event log is only meant for diagnostics and
+// it is not created if the directory does not exist e.g. a deleted profile.
+func emitEvent(file, event, profile, cidr, gateway string, err error) {
+	f, ferr := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if ferr != nil {
+		logrus.Tracef("error opening routing event log: %v", ferr)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	logger := logrus.New()
+	logger.SetOutput(f)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	fields := logrus.Fields{"event": event, "profile": profile}
+	if cidr != "" {
+		fields["cidr"] = cidr
+	}
+	if gateway != "" {
+		fields["gateway"] = gateway
+	}
+	entry := logger.WithFields(fields)
+
+	if err != nil {
+		entry.WithError(err).Error("routing " + event)
+		return
+	}
+	entry.Info("routing " + event)
+}
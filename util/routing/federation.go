@@ -0,0 +1,272 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// ExportLabel is the label of the Services exported to the federated clusters, set to true.
+const ExportLabel = "colima.export"
+
+const (
+	// federationNamespace is the namespace of the kubeconfigs of the federated clusters.
+	federationNamespace = "colima-federation"
+	// federationLabel is the label of the objects mirrored from a federated cluster, set to its profile.
+	federationLabel = "colima.federation"
+)
+
+// Federate connects the Kubernetes clusters of the running profiles for multi-cluster tooling.
+// The networks are routed between the VMs, and the kubeconfig of each cluster is stored as the
+// Secret colima-federation/<profile> in the other cluster. If exportServices, the Services with
+// ExportLabel are mirrored into the other cluster as <service>-<profile>, in the same namespace.
+func Federate(ctx context.Context, profile string, conf config.Config, peerProfile string, peerConf config.Config, exportServices bool) error {
+	// the Pod and Service networks must be told apart to be routed
+	self, err := clusterCIDRs(ctx, profile, conf)
+	if err != nil {
+		return err
+	}
+	other, err := clusterCIDRs(ctx, peerProfile, peerConf)
+	if err != nil {
+		return err
+	}
+	var routes []registryRoute
+	for _, cidr := range append(self, other...) {
+		routes = append(routes, registryRoute{CIDR: cidr})
+	}
+	for _, a := range self {
+		for _, b := range other {
+			if overlaps(a, b) {
+				return fmt.Errorf("network %s overlaps with %s of profile '%s'%s",
+					a, b, config.ProfileFromName(peerProfile).ShortName, registry{}.suggestion(routes))
+			}
+		}
+	}
+
+	if err := SetupPeers(ctx, profile, conf); err != nil {
+		return fmt.Errorf("error connecting networks: %w", err)
+	}
+
+	for _, p := range [][2]string{{profile, peerProfile}, {peerProfile, profile}} {
+		from, to := p[0], p[1]
+		if err := exchangeKubeconfig(from, to); err != nil {
+			return err
+		}
+		if !exportServices {
+			continue
+		}
+		if err := exportServicesTo(ctx, from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clusterCIDRs returns the Pod and Service networks of the cluster of the profile.
+func clusterCIDRs(ctx context.Context, profile string, conf config.Config) ([]string, error) {
+	pods, err := GetPodCIDR(ctx, profile, conf.Kubernetes)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving Pod network of profile '%s': %w", profile, err)
+	}
+	services, err := GetServiceCIDR(ctx, profile, conf.Kubernetes)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving Service network of profile '%s': %w", profile, err)
+	}
+	return append(pods, services...), nil
+}
+
+// exchangeKubeconfig stores the kubeconfig of the cluster of from as a Secret in the cluster of to.
+func exchangeKubeconfig(from, to string) error {
+	out, err := newGuest(from).RunOutput("kubectl", "config", "view", "--raw", "--minify", "--flatten")
+	if err != nil {
+		return fmt.Errorf("error retrieving kubeconfig of profile '%s': %w", from, err)
+	}
+	ip := limautil.UserNetIPAddress(from)
+	if ip == "" {
+		return fmt.Errorf("user-v2 network address of profile '%s' not available", from)
+	}
+	kubeconfig, err := federationKubeconfig([]byte(out), from, ip)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := joinManifests(
+		map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]any{"name": federationNamespace},
+		},
+		map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata": map[string]any{
+				"name":      from,
+				"namespace": federationNamespace,
+				"labels":    map[string]string{federationLabel: from},
+			},
+			"stringData": map[string]string{"kubeconfig": string(kubeconfig)},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if err := newGuest(to).RunWith(bytes.NewReader(manifest), "kubectl", "apply", "-f", "-"); err != nil {
+		return fmt.Errorf("error storing kubeconfig of profile '%s' in profile '%s': %w", from, to, err)
+	}
+	log.Debugf("kubeconfig of profile '%s' stored in profile '%s'", from, to)
+	return nil
+}
+
+// federationKubeconfig returns the kubeconfig with the cluster, context and user named after the
+// profile, and the server on the user-v2 network address reachable from the other VMs.
+// The server name is verified as kubernetes, included in the certificates of k3s and k0s.
+func federationKubeconfig(kubeconfig []byte, name, ip string) ([]byte, error) {
+	var conf struct {
+		Clusters []struct {
+			Cluster map[string]any `yaml:"cluster"`
+		} `yaml:"clusters"`
+		Users []struct {
+			User map[string]any `yaml:"user"`
+		} `yaml:"users"`
+	}
+	if err := yaml.Unmarshal(kubeconfig, &conf); err != nil {
+		return nil, fmt.Errorf("error parsing kubeconfig: %w", err)
+	}
+	if len(conf.Clusters) != 1 || len(conf.Users) != 1 {
+		return nil, fmt.Errorf("unexpected kubeconfig: %d clusters and %d users", len(conf.Clusters), len(conf.Users))
+	}
+
+	cluster := conf.Clusters[0].Cluster
+	server, _ := cluster["server"].(string)
+	u, err := url.Parse(server)
+	if err != nil || u.Port() == "" {
+		return nil, fmt.Errorf("invalid kubeconfig server: '%s'", server)
+	}
+	cluster["server"] = "https://" + net.JoinHostPort(ip, u.Port())
+	cluster["tls-server-name"] = "kubernetes"
+
+	b, err := yaml.Marshal(map[string]any{
+		"apiVersion":      "v1",
+		"kind":            "Config",
+		"clusters":        []map[string]any{{"name": name, "cluster": cluster}},
+		"users":           []map[string]any{{"name": name, "user": conf.Users[0].User}},
+		"contexts":        []map[string]any{{"name": name, "context": map[string]any{"cluster": name, "user": name}}},
+		"current-context": name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding kubeconfig: %w", err)
+	}
+	return b, nil
+}
+
+// exportServicesTo mirrors the exported Services of the cluster of from into the cluster of to.
+// The Services previously mirrored from the cluster are replaced.
+func exportServicesTo(ctx context.Context, from, to string) error {
+	api, err := newKubeAPI(ctx, from)
+	if err != nil {
+		return err
+	}
+	var services kubeList[kubeService]
+	if err := api.get("/api/v1/services?labelSelector="+url.QueryEscape(ExportLabel+"=true"), &services); err != nil {
+		return fmt.Errorf("error retrieving exported Services of profile '%s': %w", from, err)
+	}
+
+	guest := newGuest(to)
+	if err := guest.RunQuiet("kubectl", "delete", "services,endpointslices", "--all-namespaces", "--selector", federationLabel+"="+from); err != nil {
+		return fmt.Errorf("error removing Services of profile '%s' from profile '%s': %w", from, to, err)
+	}
+
+	objects := mirroredServices(services.Items, config.ProfileFromName(from))
+	if len(objects) == 0 {
+		return nil
+	}
+	manifest, err := joinManifests(objects...)
+	if err != nil {
+		return err
+	}
+	if err := guest.RunWith(bytes.NewReader(manifest), "kubectl", "apply", "-f", "-"); err != nil {
+		return fmt.Errorf("error exporting Services of profile '%s' to profile '%s': %w", from, to, err)
+	}
+	var count int
+	for _, o := range objects {
+		if o["kind"] == "Service" {
+			count++
+		}
+	}
+	log.Debugf("%d Services of profile '%s' exported to profile '%s'", count, from, to)
+	return nil
+}
+
+// mirroredServices returns the namespaces, selectorless Services and EndpointSlices mirroring
+// the Services to their cluster IPs, routed between the VMs.
+func mirroredServices(services []kubeService, from *config.Profile) []map[string]any {
+	var objects []map[string]any
+	namespaces := map[string]bool{}
+	for _, s := range services {
+		ip := net.ParseIP(s.Spec.ClusterIP)
+		// headless Services have no cluster IP, and the user-v2 network is IPv4 only
+		if ip == nil || ip.To4() == nil {
+			continue
+		}
+
+		var ports []map[string]any
+		for _, p := range s.Spec.Ports {
+			port := map[string]any{"port": p.Port, "protocol": p.Protocol}
+			if p.Name != "" {
+				port["name"] = p.Name
+			}
+			ports = append(ports, port)
+		}
+
+		ns := s.Metadata.Namespace
+		if !namespaces[ns] {
+			namespaces[ns] = true
+			objects = append(objects, map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Namespace",
+				"metadata":   map[string]any{"name": ns},
+			})
+		}
+
+		name := s.Metadata.Name + "-" + from.ShortName
+		labels := map[string]string{federationLabel: from.ID}
+		objects = append(objects,
+			map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Service",
+				"metadata":   map[string]any{"name": name, "namespace": ns, "labels": labels},
+				"spec":       map[string]any{"ports": ports},
+			},
+			map[string]any{
+				"apiVersion":  "discovery.k8s.io/v1",
+				"kind":        "EndpointSlice",
+				"metadata":    map[string]any{"name": name, "namespace": ns, "labels": map[string]string{federationLabel: from.ID, "kubernetes.io/service-name": name}},
+				"addressType": "IPv4",
+				"endpoints":   []map[string]any{{"addresses": []string{s.Spec.ClusterIP}}},
+				"ports":       ports,
+			},
+		)
+	}
+	return objects
+}
+
+// joinManifests returns the multi-document manifest of the objects.
+func joinManifests(objects ...map[string]any) ([]byte, error) {
+	var docs []string
+	for _, obj := range objects {
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding manifest: %w", err)
+		}
+		docs = append(docs, string(b))
+	}
+	return []byte(strings.Join(docs, "---\n")), nil
+}
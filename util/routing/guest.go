@@ -0,0 +1,60 @@
+package routing
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/host"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	log "github.com/sirupsen/logrus"
+)
+
+// vmGuest runs commands in the VM of a profile.
+// Unlike the lima VM, it is not bound to the current profile.
+type vmGuest struct {
+	profile string
+	host    environment.HostActions
+}
+
+// newGuest returns the guest for the VM of the profile.
+func newGuest(profile string) vmGuest {
+	envs := []string{
+		limautil.EnvLimaHome + "=" + config.LimaDir(),
+		"LIMA_INSTANCE=" + profile,
+	}
+	return vmGuest{profile: profile, host: host.New().WithEnv(envs...)}
+}
+
+// Running returns if the VM of the profile is running.
+func (g vmGuest) Running(context.Context) bool {
+	i, err := limautil.ProfileInstance(g.profile)
+	if err != nil {
+		log.Tracef("error retrieving instance: %v", err)
+		return false
+	}
+	return i.Running()
+}
+
+// RunQuiet runs the command in the VM whilst suppressing the output.
+func (g vmGuest) RunQuiet(args ...string) error {
+	return g.host.RunQuiet(append([]string{"lima"}, args...)...)
+}
+
+// RunOutput runs the command in the VM and returns its output.
+func (g vmGuest) RunOutput(args ...string) (string, error) {
+	return g.host.RunOutput(append([]string{"lima"}, args...)...)
+}
+
+// RunWith runs the command in the VM with stdin.
+func (g vmGuest) RunWith(stdin io.Reader, args ...string) error {
+	return g.host.RunWith(stdin, nil, append([]string{"lima"}, args...)...)
+}
+
+// RunScript runs the shell script in the VM as root.
+// The script is piped to the shell to keep its contents out of the process list.
+func (g vmGuest) RunScript(script string) error {
+	return g.host.RunWith(strings.NewReader(script), nil, "lima", "sudo", "sh")
+}
@@ -0,0 +1,192 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/abiosoft/colima/embedded"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/host"
+	log "github.com/sirupsen/logrus"
+)
+
+// HelperPath is the path to the privileged route helper.
+const HelperPath = "/opt/colima/bin/colima-route"
+
+const (
+	helperEmbeddedPath = "network/colima-route.sh"
+	helperSudoersFile  = "/etc/sudoers.d/colima-route"
+	// helperNetworksFile lists the networks the helper is permitted to route.
+	// It is owned by root to prevent the user widening the networks without the sudo password.
+	helperNetworksFile = "/opt/colima/etc/networks"
+)
+
+// helperSudoers returns the sudoers rule permitting the user to run the helper without a password.
+func helperSudoers() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("error retrieving current user: %w", err)
+	}
+	return "# managing Pod and Service network routes\n" +
+		u.Username + " ALL=(root) NOPASSWD:NOSETENV: " + HelperPath + " *\n", nil
+}
+
+// HelperInstalled returns if the privileged route helper is installed.
+// The sudoers rule is verified with sudo as the sudoers file is only readable by root.
+func HelperInstalled() bool {
+	script, err := embedded.Read(helperEmbeddedPath)
+	if err != nil {
+		return false
+	}
+	if b, err := os.ReadFile(HelperPath); err != nil || !bytes.Equal(b, script) {
+		return false
+	}
+	return exec.Command("sudo", "-n", "-l", HelperPath).Run() == nil
+}
+
+// helperPermits returns if the networks are recorded for the privileged route helper.
+func helperPermits(networks ...string) bool {
+	b, err := os.ReadFile(helperNetworksFile)
+	if err != nil {
+		return len(networks) == 0
+	}
+	recorded := strings.Fields(string(b))
+	for _, network := range networks {
+		if !slices.Contains(recorded, network) {
+			return false
+		}
+	}
+	return true
+}
+
+// helperNetworks returns the content of the networks file of the privileged route helper,
+// the recorded networks merged with networks.
+func helperNetworks(recorded string, networks []string) string {
+	merged := strings.Fields(recorded)
+	for _, network := range networks {
+		if network != "" && !slices.Contains(merged, network) {
+			merged = append(merged, network)
+		}
+	}
+	slices.Sort(merged)
+	if len(merged) == 0 {
+		return ""
+	}
+	return strings.Join(merged, "\n") + "\n"
+}
+
+// InstallHelper installs the privileged route helper and the sudoers rule for it,
+// permitting routes for the networks in addition to the previously recorded ones.
+// The sudo password may be required.
+func InstallHelper(host environment.HostActions, networks []string) error {
+	script, err := embedded.ReadString(helperEmbeddedPath)
+	if err != nil {
+		return fmt.Errorf("error retrieving embedded route helper: %w", err)
+	}
+	sudoers, err := helperSudoers()
+	if err != nil {
+		return err
+	}
+
+	// helper script
+	if err := host.RunInteractive("sudo", "mkdir", "-p", filepath.Dir(HelperPath)); err != nil {
+		return fmt.Errorf("error preparing colima privileged dir: %w", err)
+	}
+	stdout := &bytes.Buffer{}
+	if err := host.RunWith(strings.NewReader(script), stdout, "sudo", "sh", "-c", "cat > "+HelperPath); err != nil {
+		return fmt.Errorf("error writing route helper, stderr: %s, err: %w", stdout.String(), err)
+	}
+	if err := host.RunInteractive("sudo", "chmod", "755", HelperPath); err != nil {
+		return fmt.Errorf("error setting route helper permissions: %w", err)
+	}
+
+	// permitted networks
+	recorded, _ := os.ReadFile(helperNetworksFile)
+	if err := host.RunInteractive("sudo", "mkdir", "-p", filepath.Dir(helperNetworksFile)); err != nil {
+		return fmt.Errorf("error preparing colima privileged dir: %w", err)
+	}
+	stdout.Reset()
+	if err := host.RunWith(strings.NewReader(helperNetworks(string(recorded), networks)), stdout, "sudo", "sh", "-c", "cat > "+helperNetworksFile); err != nil {
+		return fmt.Errorf("error writing route helper networks, stderr: %s, err: %w", stdout.String(), err)
+	}
+	if err := host.RunInteractive("sudo", "chmod", "644", helperNetworksFile); err != nil {
+		return fmt.Errorf("error setting route helper networks permissions: %w", err)
+	}
+
+	// sudoers rule, validated before use as an invalid file breaks sudo
+	tmp := helperSudoersFile + ".tmp"
+	if err := host.RunInteractive("sudo", "mkdir", "-p", filepath.Dir(helperSudoersFile)); err != nil {
+		return fmt.Errorf("error preparing sudoers directory: %w", err)
+	}
+	stdout.Reset()
+	if err := host.RunWith(strings.NewReader(sudoers), stdout, "sudo", "sh", "-c", "cat > "+tmp); err != nil {
+		return fmt.Errorf("error writing sudoers file, stderr: %s, err: %w", stdout.String(), err)
+	}
+	if err := host.RunQuiet("sudo", "visudo", "-cf", tmp); err != nil {
+		_ = host.RunQuiet("sudo", "rm", "-f", tmp)
+		return fmt.Errorf("error validating sudoers file: %w", err)
+	}
+	if err := host.RunInteractive("sudo", "sh", "-c", "chmod 440 "+tmp+" && mv "+tmp+" "+helperSudoersFile); err != nil {
+		return fmt.Errorf("error installing sudoers file: %w", err)
+	}
+
+	log.Debugf("privileged route helper installed at %s", HelperPath)
+	return nil
+}
+
+// EnsureHelper installs the privileged route helper if missing or not permitted to route the networks,
+// to avoid sudo prompts for subsequent route and hosts file changes. Failures are not fatal.
+func EnsureHelper(ctx context.Context, networks ...string) {
+	if !supported() || os.Geteuid() == 0 || (HelperInstalled() && helperPermits(networks...)) {
+		return
+	}
+	if plan := planFromContext(ctx); plan != nil {
+		if err := planHelper(plan, networks); err != nil {
+			log.Warnf("Failed to plan privileged route helper: %v", err)
+		}
+		return
+	}
+	log.Info("installing privileged helper for network routes, sudo password may be required")
+	if err := InstallHelper(host.New(), networks); err != nil {
+		log.Warnf("Failed to install privileged route helper: %v", err)
+	}
+}
+
+// planHelper records the installation of the privileged route helper in plan.
+func planHelper(plan *Plan, networks []string) error {
+	script, err := embedded.ReadString(helperEmbeddedPath)
+	if err != nil {
+		return fmt.Errorf("error retrieving embedded route helper: %w", err)
+	}
+	sudoers, err := helperSudoers()
+	if err != nil {
+		return err
+	}
+
+	plan.add(Change{Kind: ChangeHelper, Action: "install", Target: HelperPath, Content: script,
+		Command: fmt.Sprintf("sudo mkdir -p %s && sudo tee %s >/dev/null && sudo chmod 755 %s", filepath.Dir(HelperPath), HelperPath, HelperPath)})
+	recorded, _ := os.ReadFile(helperNetworksFile)
+	plan.add(Change{Kind: ChangeHelper, Action: "install", Target: helperNetworksFile, Content: helperNetworks(string(recorded), networks),
+		Command: fmt.Sprintf("sudo mkdir -p %s && sudo tee %s >/dev/null && sudo chmod 644 %s", filepath.Dir(helperNetworksFile), helperNetworksFile, helperNetworksFile)})
+	tmp := helperSudoersFile + ".tmp"
+	plan.add(Change{Kind: ChangeHelper, Action: "install", Target: helperSudoersFile, Content: sudoers,
+		Command: fmt.Sprintf("sudo tee %s >/dev/null && sudo visudo -cf %s && sudo chmod 440 %s && sudo mv %s %s", tmp, tmp, tmp, tmp, helperSudoersFile)})
+	return nil
+}
+
+// runHelper runs the privileged route helper with sudo.
+// sudo is run non-interactively as no password is required for the helper.
+func runHelper(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "sudo", append([]string{"-n", HelperPath}, args...)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w, output: %s", err, string(output))
+	}
+	return nil
+}
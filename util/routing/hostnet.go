@@ -0,0 +1,63 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// checkHostNetworks returns an error if any of the networks overlap with the
+// networks of the host e.g. LAN or VPN routes, as the routes would break them.
+// routes are the routes in the host routing table.
+func (rm *RouteManager) checkHostNetworks(routes []Route) error {
+	r, err := loadRegistry(rm.registryFile())
+	if err != nil {
+		return err
+	}
+
+	// routes of colima profiles are handled by the registry
+	registered := map[registryRoute]bool{}
+	for _, routes := range r {
+		for _, route := range routes {
+			registered[registryRoute{CIDR: route.CIDR, Gateway: route.Gateway}] = true
+		}
+	}
+
+	// loopback, link-local and multicast networks are not routed
+	var networks []Route
+	for _, route := range routes {
+		if ip := route.Destination.IP; !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsMulticast() {
+			networks = append(networks, route)
+		}
+	}
+
+	var conflicts []string
+	used := make([]registryRoute, 0, len(networks))
+	for _, route := range networks {
+		used = append(used, registryRoute{CIDR: route.Destination.String()})
+	}
+
+	for _, cidr := range rm.cidrs() {
+		used = append(used, registryRoute{CIDR: cidr})
+		for _, route := range networks {
+			network := route.Destination.String()
+			// existing routes for the network are replaced
+			if network == cidr {
+				continue
+			}
+			if route.Gateway != nil && registered[registryRoute{CIDR: network, Gateway: route.Gateway.String()}] {
+				continue
+			}
+			if overlaps(cidr, network) {
+				conflicts = append(conflicts, fmt.Sprintf("%s overlaps with host network %s (via %s)", cidr, network, route.via()))
+			}
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	msg := "network routes conflict with host networks: " + strings.Join(conflicts, ", ")
+	return errors.New(msg + r.suggestion(used))
+}
@@ -0,0 +1,259 @@
+package routing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+	log "github.com/sirupsen/logrus"
+)
+
+// hostsFile is the hosts file of the host.
+const hostsFile = "/etc/hosts"
+
+// ContainerHostnameLabel is the container label for the hostname of a container in the hosts file.
+const ContainerHostnameLabel = "colima.hostname"
+
+// hostnameRegex matches the valid hostnames for the hosts file, wildcards are not supported.
+var hostnameRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+
+// hostsBlockMarkers returns the lines enclosing the entries of the profile in the hosts file.
+func hostsBlockMarkers(profile string) (begin, end string) {
+	return "# BEGIN colima " + profile, "# END colima " + profile
+}
+
+// hostsEntries returns the hosts file entries for the hostnames pointing to ip.
+// Invalid hostnames are discarded.
+func hostsEntries(ip string, hostnames []string) string {
+	var lines []string
+	for _, h := range uniqueHostnames(hostnames) {
+		lines = append(lines, ip+" "+h)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// uniqueHostnames returns the sorted unique valid hostnames.
+func uniqueHostnames(hostnames []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, h := range hostnames {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if seen[h] || !hostnameRegex.MatchString(h) {
+			continue
+		}
+		seen[h] = true
+		unique = append(unique, h)
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// replaceHostsBlock returns the hosts file content with the block of the profile replaced by entries.
+// The block is removed if entries is empty.
+func replaceHostsBlock(content, profile, entries string) string {
+	begin, end := hostsBlockMarkers(profile)
+
+	var b strings.Builder
+	skip := false
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == begin:
+			skip = true
+		case line == end:
+			skip = false
+		case !skip:
+			b.WriteString(line + "\n")
+		}
+	}
+	if entries != "" {
+		fmt.Fprintf(&b, "%s\n%s\n%s\n", begin, entries, end)
+	}
+	return b.String()
+}
+
+// hasHostsBlock returns if the hosts file has entries of the profile.
+func hasHostsBlock(profile string) bool {
+	b, err := os.ReadFile(hostsFile)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(hostsProfiles(string(b)), profile)
+}
+
+// hostsProfiles returns the profiles with entries in the hosts file content.
+func hostsProfiles(content string) []string {
+	var profiles []string
+	for _, line := range strings.Split(content, "\n") {
+		if profile, ok := strings.CutPrefix(line, "# BEGIN colima "); ok && profile != "" {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// pruneHosts removes the hosts file entries of the profiles that are not running
+// e.g. after a crash of the VM and the daemon.
+func pruneHosts(ctx context.Context, running map[string]bool) {
+	b, err := os.ReadFile(hostsFile)
+	if err != nil {
+		return
+	}
+	for _, p := range hostsProfiles(string(b)) {
+		if running[p] {
+			continue
+		}
+		if plan := planFromContext(ctx); plan != nil {
+			plan.add(Change{Kind: ChangeHosts, Action: "remove", Target: hostsFile,
+				Command: fmt.Sprintf("sudo sed -i.bak '/^# BEGIN colima %[1]s$/,/^# END colima %[1]s$/d' %[2]s", p, hostsFile)})
+			continue
+		}
+		if err := CleanupHosts(ctx, p); err != nil {
+			log.Warnf("Failed to remove hosts file entries of profile '%s': %v", p, err)
+		}
+	}
+}
+
+// SetHosts points the hostnames to ip in the hosts file, replacing the previous entries of the profile.
+// The privileged helper is used when installed, non-interactive sudo otherwise.
+func SetHosts(ctx context.Context, profile, ip string, hostnames []string) error {
+	entries := hostsEntries(ip, hostnames)
+	if entries == "" {
+		return CleanupHosts(ctx, profile)
+	}
+	if err := writeHosts(ctx, profile, entries); err != nil {
+		return fmt.Errorf("error updating %s: %w", hostsFile, err)
+	}
+	return nil
+}
+
+// CleanupHosts removes the entries of the profile from the hosts file, if any.
+func CleanupHosts(ctx context.Context, profile string) error {
+	if !hasHostsBlock(profile) {
+		return nil
+	}
+	if err := writeHosts(ctx, profile, ""); err != nil {
+		return fmt.Errorf("error cleaning up %s: %w", hostsFile, err)
+	}
+	return nil
+}
+
+// writeHosts replaces the block of the profile in the hosts file with entries.
+func writeHosts(ctx context.Context, profile, entries string) error {
+	if os.Geteuid() != 0 && HelperInstalled() {
+		action := "hosts-set"
+		if entries == "" {
+			action = "hosts-clear"
+		}
+		cmd := exec.CommandContext(ctx, "sudo", "-n", HelperPath, action, profile)
+		cmd.Stdin = strings.NewReader(entries)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%w, output: %s", err, string(output))
+		}
+		return nil
+	}
+
+	b, err := os.ReadFile(hostsFile)
+	if err != nil {
+		return err
+	}
+	content := replaceHostsBlock(string(b), profile, entries)
+	if os.Geteuid() == 0 {
+		return os.WriteFile(hostsFile, []byte(content), 0644)
+	}
+	// the daemon has no terminal for the sudo password
+	cmd := exec.CommandContext(ctx, "sudo", "-n", "tee", hostsFile)
+	cmd.Stdin = strings.NewReader(content)
+	cmd.Stdout = io.Discard
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w, sudo is run non-interactively without the privileged route helper, output: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// kubeIngress is a Kubernetes ingress.
+type kubeIngress struct {
+	Spec struct {
+		Rules []struct {
+			Host string `json:"host"`
+		} `json:"rules"`
+		TLS []struct {
+			Hosts []string `json:"hosts"`
+		} `json:"tls"`
+	} `json:"spec"`
+}
+
+// GetIngressHosts retrieves the hostnames of the Ingresses in the Kubernetes cluster of the profile.
+func GetIngressHosts(ctx context.Context, profile string) ([]string, error) {
+	api, err := newKubeAPI(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var ingresses kubeList[kubeIngress]
+	if err := api.get("/apis/networking.k8s.io/v1/ingresses", &ingresses); err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, i := range ingresses.Items {
+		for _, r := range i.Spec.Rules {
+			hosts = append(hosts, r.Host)
+		}
+		for _, t := range i.Spec.TLS {
+			hosts = append(hosts, t.Hosts...)
+		}
+	}
+	return uniqueHostnames(hosts), nil
+}
+
+// GetContainerHosts retrieves the hostnames of the running containers of the runtime in the VM of the profile,
+// set with the ContainerHostnameLabel label. The containers of the rootless containerd of the user are
+// retrieved if rootless.
+func GetContainerHosts(ctx context.Context, profile, runtime string, rootless bool) ([]string, error) {
+	var args []string
+	switch runtime {
+	case docker.Name:
+		args = []string{docker.Name, "ps", "--filter", "label=" + ContainerHostnameLabel, "--format", "{{.Labels}}"}
+	case containerd.Name:
+		args = append(containerd.Nerdctl(rootless), "ps", "--filter", "label="+ContainerHostnameLabel, "--format", "{{.Labels}}")
+	default:
+		return nil, fmt.Errorf("container hostnames not supported for runtime '%s'", runtime)
+	}
+
+	guest := newGuest(profile)
+	if !guest.Running(ctx) {
+		return nil, fmt.Errorf("VM not running")
+	}
+	output, err := guest.RunOutput(args...)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving containers: %w", err)
+	}
+	return parseContainerHosts(output), nil
+}
+
+// parseContainerHosts returns the hostnames in the comma separated container labels, a container per line.
+func parseContainerHosts(output string) []string {
+	var hosts []string
+	for _, line := range strings.Split(output, "\n") {
+		for _, label := range strings.Split(line, ",") {
+			if key, val, ok := strings.Cut(strings.TrimSpace(label), "="); ok && key == ContainerHostnameLabel {
+				hosts = append(hosts, val)
+			}
+		}
+	}
+	return uniqueHostnames(hosts)
+}
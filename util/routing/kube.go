@@ -0,0 +1,434 @@
+package routing
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/util"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrClusterUnreachable is returned when the Kubernetes API server cannot be reached.
+	ErrClusterUnreachable = errors.New("kubernetes cluster unreachable")
+	// ErrResourceNotFound is returned when a Kubernetes resource does not exist,
+	// e.g. resources of CNIs that are not installed.
+	ErrResourceNotFound = errors.New("kubernetes resource not found")
+)
+
+// guestKubeconfigFile is the kubeconfig of the k3s cluster in the VM.
+const guestKubeconfigFile = "/etc/rancher/k3s/k3s.yaml"
+
+// newKubeAPI returns the Kubernetes API client for the running VM of the profile, with the
+// kubeconfig of the profile on the host, or the kubeconfig in the VM if the context of the
+// profile is missing on the host e.g. removed or renamed by the user.
+func newKubeAPI(ctx context.Context, profile string) (kubeAPI, error) {
+	if !newGuest(profile).Running(ctx) {
+		return kubeAPI{}, fmt.Errorf("VM not running")
+	}
+
+	p := config.ProfileFromName(profile)
+	conf, err := configmanager.LoadFrom(p.StateFile())
+	if err != nil {
+		return kubeAPI{}, fmt.Errorf("error retrieving config of profile '%s': %w", profile, err)
+	}
+	name, err := conf.Kubernetes.Kubeconfig.ContextName(p)
+	if err != nil {
+		return kubeAPI{}, err
+	}
+	kubeconfig, err := os.ReadFile(kubeconfigFile(conf.Kubernetes.Kubeconfig))
+	if err == nil {
+		api, err := kubeAPIFromConfig(kubeconfig, name)
+		if !errors.Is(err, ErrClusterUnreachable) {
+			return api, err
+		}
+	}
+	log.Debugf("kubeconfig context '%s' not found on the host, using the kubeconfig in the VM", name)
+
+	kubeconfig, err = guestKubeconfig(profile)
+	if err != nil {
+		return kubeAPI{}, fmt.Errorf("%w: error reading kubeconfig: %w", ErrClusterUnreachable, err)
+	}
+	return kubeAPIFromConfig(kubeconfig, "default")
+}
+
+// KubernetesStarted returns if the Kubernetes cluster of the profile is started. With lazy
+// startup, the cluster is started by the first request to the API server and the periodic
+// requests e.g. of the daemon would start the cluster.
+func KubernetesStarted(ctx context.Context, profile string) bool {
+	guest := newGuest(profile)
+	if !guest.Running(ctx) {
+		return false
+	}
+	conf, err := configmanager.LoadFrom(config.ProfileFromName(profile).StateFile())
+	if err != nil || !conf.Kubernetes.Lazy {
+		return true
+	}
+	return guest.RunQuiet("systemctl", "is-active", "--quiet", "k3s") == nil
+}
+
+// guestKubeconfig returns the kubeconfig of the k3s cluster in the VM of the profile.
+func guestKubeconfig(profile string) ([]byte, error) {
+	out, err := newGuest(profile).RunOutput("sudo", "cat", guestKubeconfigFile)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+// kubeconfigFile returns the kubeconfig file of the cluster on the host, the standalone file
+// or the first file of KUBECONFIG or ~/.kube/config the kubeconfig is merged into.
+func kubeconfigFile(k config.KubernetesKubeconfig) string {
+	if file := k.FilePath(); file != "" {
+		return file
+	}
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	return filepath.Join(util.HomeDir(), ".kube", "config")
+}
+
+// kubeconfig is the subset of a kubeconfig for the API requests.
+type kubeconfig struct {
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			TLSServerName            string `yaml:"tls-server-name"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKeyData         string `yaml:"client-key-data"`
+			Token                 string `yaml:"token"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// kubeAPIFromConfig returns the Kubernetes API client for the context of the kubeconfig.
+// ErrClusterUnreachable is returned if the context is not in the kubeconfig.
+func kubeAPIFromConfig(b []byte, context string) (kubeAPI, error) {
+	var conf kubeconfig
+	if err := yaml.Unmarshal(b, &conf); err != nil {
+		return kubeAPI{}, fmt.Errorf("error parsing kubeconfig: %w", err)
+	}
+
+	var clusterName, userName string
+	for _, c := range conf.Contexts {
+		if c.Name == context {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+		}
+	}
+	if clusterName == "" {
+		return kubeAPI{}, fmt.Errorf("%w: context '%s' not found in kubeconfig", ErrClusterUnreachable, context)
+	}
+
+	tlsConfig := &tls.Config{}
+	var server, token string
+	for _, c := range conf.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		server = strings.TrimSuffix(c.Cluster.Server, "/")
+		tlsConfig.ServerName = c.Cluster.TLSServerName
+		tlsConfig.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		if c.Cluster.CertificateAuthorityData != "" {
+			ca, err := base64.StdEncoding.DecodeString(c.Cluster.CertificateAuthorityData)
+			if err != nil {
+				return kubeAPI{}, fmt.Errorf("invalid certificate authority of cluster '%s': %w", clusterName, err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return kubeAPI{}, fmt.Errorf("invalid certificate authority of cluster '%s'", clusterName)
+			}
+		}
+	}
+	if server == "" {
+		return kubeAPI{}, fmt.Errorf("server of cluster '%s' not found in kubeconfig", clusterName)
+	}
+
+	for _, u := range conf.Users {
+		if u.Name != userName {
+			continue
+		}
+		token = u.User.Token
+		if u.User.ClientCertificateData != "" {
+			cert, err := base64.StdEncoding.DecodeString(u.User.ClientCertificateData)
+			if err != nil {
+				return kubeAPI{}, fmt.Errorf("invalid client certificate of user '%s': %w", userName, err)
+			}
+			key, err := base64.StdEncoding.DecodeString(u.User.ClientKeyData)
+			if err != nil {
+				return kubeAPI{}, fmt.Errorf("invalid client key of user '%s': %w", userName, err)
+			}
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return kubeAPI{}, fmt.Errorf("invalid client certificate of user '%s': %w", userName, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+	}
+
+	client := &http.Client{
+		Timeout:   kubeAPITimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	return kubeAPI{request: func(path string) (int, []byte, error) {
+		req, err := http.NewRequest(http.MethodGet, server+path, nil)
+		if err != nil {
+			return 0, nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(resp.Body)
+		return resp.StatusCode, body, err
+	}}, nil
+}
+
+// GetClusterNetworks retrieves the Pod and Service networks from the Kubernetes cluster in the VM of the profile.
+// ErrClusterUnreachable is returned if the cluster cannot be reached.
+func GetClusterNetworks(ctx context.Context, profile string) (ClusterNetworks, error) {
+	api, err := newKubeAPI(ctx, profile)
+	if err != nil {
+		return ClusterNetworks{}, err
+	}
+	return api.clusterNetworks()
+}
+
+// kubeAPITimeout is the timeout of the requests to the Kubernetes API server.
+const kubeAPITimeout = 10 * time.Second
+
+// kubeAPI queries the Kubernetes API server in the VM from the host.
+type kubeAPI struct {
+	// request retrieves the API path and returns the status code and the body.
+	request func(path string) (status int, body []byte, err error)
+}
+
+// get retrieves the resource at the API path and decodes it into v.
+func (k kubeAPI) get(path string, v any) error {
+	status, body, err := k.request(path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrClusterUnreachable, err)
+	}
+	switch {
+	case status == http.StatusNotFound:
+		return fmt.Errorf("%s: %w", path, ErrResourceNotFound)
+	case status != http.StatusOK:
+		return fmt.Errorf("%w: error retrieving %s: %s: %s", ErrClusterUnreachable, path, http.StatusText(status), strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error decoding %s: %w", path, err)
+	}
+	return nil
+}
+
+// kubeList is a list of Kubernetes resources.
+type kubeList[T any] struct {
+	Items []T `json:"items"`
+}
+
+// kubeNode is a Kubernetes node.
+type kubeNode struct {
+	Metadata struct {
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		PodCIDR  string   `json:"podCIDR"`
+		PodCIDRs []string `json:"podCIDRs"`
+	} `json:"spec"`
+}
+
+// kubeConfigMap is a Kubernetes configmap.
+type kubeConfigMap struct {
+	Data map[string]string `json:"data"`
+}
+
+// kubeService is a Kubernetes service.
+type kubeService struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Type      string `json:"type"`
+		ClusterIP string `json:"clusterIP"`
+		Ports     []struct {
+			Name     string `json:"name"`
+			Port     int    `json:"port"`
+			Protocol string `json:"protocol"`
+		} `json:"ports"`
+	} `json:"spec"`
+	Status struct {
+		LoadBalancer struct {
+			Ingress []struct {
+				IP string `json:"ip"`
+			} `json:"ingress"`
+		} `json:"loadBalancer"`
+	} `json:"status"`
+}
+
+// k3sNodeArgsAnnotation is the node annotation with the args of the k3s server.
+const k3sNodeArgsAnnotation = "k3s.io/node-args"
+
+// ClusterNetworks are the Pod and Service networks of a Kubernetes cluster.
+type ClusterNetworks struct {
+	PodCIDRs     []string
+	ServiceCIDRs []string
+}
+
+// clusterNetworks retrieves the Pod and Service networks from the Kubernetes API.
+// ErrClusterUnreachable is returned if the nodes cannot be retrieved, resources
+// of CNIs and distributions that are not in use are ignored.
+func (k kubeAPI) clusterNetworks() (ClusterNetworks, error) {
+	var n ClusterNetworks
+
+	var nodes kubeList[kubeNode]
+	if err := k.get("/api/v1/nodes", &nodes); err != nil {
+		return n, err
+	}
+
+	for _, node := range nodes.Items {
+		// k3s server args
+		var args []string
+		if val, ok := node.Metadata.Annotations[k3sNodeArgsAnnotation]; ok && json.Unmarshal([]byte(val), &args) == nil {
+			if val, ok := k3sArgValue(args, "--cluster-cidr"); ok {
+				n.PodCIDRs = append(n.PodCIDRs, parseCIDRList(val)...)
+			}
+			if val, ok := k3sArgValue(args, "--service-cidr"); ok {
+				n.ServiceCIDRs = append(n.ServiceCIDRs, parseCIDRList(val)...)
+			}
+		}
+
+		// node Pod CIDRs
+		n.PodCIDRs = append(n.PodCIDRs, parseCIDRList(node.Spec.PodCIDR)...)
+		for _, cidr := range node.Spec.PodCIDRs {
+			n.PodCIDRs = append(n.PodCIDRs, parseCIDRList(cidr)...)
+		}
+	}
+
+	// kubeadm cluster configuration
+	var kubeadm kubeConfigMap
+	if k.optional("/api/v1/namespaces/kube-system/configmaps/kubeadm-config", &kubeadm) {
+		var conf struct {
+			Networking struct {
+				PodSubnet     string `yaml:"podSubnet"`
+				ServiceSubnet string `yaml:"serviceSubnet"`
+			} `yaml:"networking"`
+		}
+		if yaml.Unmarshal([]byte(kubeadm.Data["ClusterConfiguration"]), &conf) == nil {
+			n.PodCIDRs = append(n.PodCIDRs, parseCIDRList(conf.Networking.PodSubnet)...)
+			n.ServiceCIDRs = append(n.ServiceCIDRs, parseCIDRList(conf.Networking.ServiceSubnet)...)
+		}
+	}
+
+	// Calico IP pools
+	var calico kubeList[struct {
+		Spec struct {
+			CIDR string `json:"cidr"`
+		} `json:"spec"`
+	}]
+	if k.optional("/apis/crd.projectcalico.org/v1/ippools", &calico) {
+		for _, pool := range calico.Items {
+			n.PodCIDRs = append(n.PodCIDRs, parseCIDRList(pool.Spec.CIDR)...)
+		}
+	}
+
+	// Cilium cluster-pool IPAM
+	var cilium kubeConfigMap
+	if k.optional("/api/v1/namespaces/kube-system/configmaps/cilium-config", &cilium) {
+		for _, key := range []string{"cluster-pool-ipv4-cidr", "cluster-pool-ipv6-cidr"} {
+			n.PodCIDRs = append(n.PodCIDRs, fieldCIDRs(cilium.Data[key])...)
+		}
+	}
+
+	// Cilium multi-pool IPAM
+	var ciliumPools kubeList[struct {
+		Spec struct {
+			IPv4 struct {
+				CIDRs []string `json:"cidrs"`
+			} `json:"ipv4"`
+			IPv6 struct {
+				CIDRs []string `json:"cidrs"`
+			} `json:"ipv6"`
+		} `json:"spec"`
+	}]
+	if k.optional("/apis/cilium.io/v2alpha1/ciliumpodippools", &ciliumPools) {
+		for _, pool := range ciliumPools.Items {
+			for _, cidr := range append(pool.Spec.IPv4.CIDRs, pool.Spec.IPv6.CIDRs...) {
+				n.PodCIDRs = append(n.PodCIDRs, parseCIDRList(cidr)...)
+			}
+		}
+	}
+
+	// flannel network config
+	var flannel kubeConfigMap
+	if k.optional("/api/v1/namespaces/kube-system/configmaps/kube-flannel-cfg", &flannel) {
+		var conf struct {
+			Network     string `json:"Network"`
+			IPv6Network string `json:"IPv6Network"`
+		}
+		if json.Unmarshal([]byte(flannel.Data["net-conf.json"]), &conf) == nil {
+			n.PodCIDRs = append(n.PodCIDRs, parseCIDRList(conf.Network)...)
+			n.PodCIDRs = append(n.PodCIDRs, parseCIDRList(conf.IPv6Network)...)
+		}
+	}
+
+	// Service CIDRs (Kubernetes 1.33+)
+	var serviceCIDRs kubeList[struct {
+		Spec struct {
+			CIDRs []string `json:"cidrs"`
+		} `json:"spec"`
+	}]
+	if k.optional("/apis/networking.k8s.io/v1/servicecidrs", &serviceCIDRs) {
+		for _, s := range serviceCIDRs.Items {
+			for _, cidr := range s.Spec.CIDRs {
+				n.ServiceCIDRs = append(n.ServiceCIDRs, parseCIDRList(cidr)...)
+			}
+		}
+	}
+
+	n.PodCIDRs = mergeCIDRs(n.PodCIDRs)
+	n.ServiceCIDRs = mergeCIDRs(n.ServiceCIDRs)
+	return n, nil
+}
+
+// optional retrieves the optional resource at the API path into v and returns if it exists.
+func (k kubeAPI) optional(path string, v any) bool {
+	err := k.get(path, v)
+	if err != nil && !errors.Is(err, ErrResourceNotFound) {
+		log.Debugf("error retrieving %s: %v", path, err)
+	}
+	return err == nil
+}
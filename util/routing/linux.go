@@ -0,0 +1,104 @@
+package routing
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// guestForwardingTable is the nftables table for the guest forwarding rules.
+const guestForwardingTable = "colima_routing"
+
+// dockerUserChain is the iptables chain of docker for user defined rules.
+const dockerUserChain = "DOCKER-USER"
+
+// linuxRouteArgs returns the ip(8) args for cidr, with the address family set for IPv6.
+func linuxRouteArgs(cidr string, args ...string) []string {
+	family := "-4"
+	if isIPv6(cidr) {
+		family = "-6"
+	}
+	args = append([]string{"ip", family, "route"}, args...)
+	return append(args, cidr)
+}
+
+// setupGuestForwarding allows forwarding of traffic from the host to cidrs in the VM.
+func setupGuestForwarding(guest vmGuest, cidrs []string) error {
+	if err := guest.RunQuiet("sudo", "sh", "-c", guestForwardingScript(cidrs)); err != nil {
+		return fmt.Errorf("error setting up forwarding rules in the VM: %w", err)
+	}
+
+	log.Debugf("Forwarding rules configured in the VM for %s", strings.Join(cidrs, ", "))
+	return nil
+}
+
+// guestForwardingScript returns the shell script for the forwarding rules for cidrs in the VM.
+// iptables is used when available, nftables otherwise.
+func guestForwardingScript(cidrs []string) string {
+	var script []string
+	script = append(script, "sysctl -w net.ipv4.ip_forward=1 >/dev/null")
+	script = append(script, "sysctl -w net.ipv6.conf.all.forwarding=1 >/dev/null")
+	script = append(script, "if command -v iptables >/dev/null; then")
+	for _, cidr := range cidrs {
+		iptables := iptablesCommand(cidr)
+		for _, dir := range []string{"-d", "-s"} {
+			rule := fmt.Sprintf("FORWARD %s %s -j ACCEPT", dir, cidr)
+			script = append(script, fmt.Sprintf("  %s -C %s 2>/dev/null || %s -I %s", iptables, rule, iptables, rule))
+		}
+		// docker only permits published ports to the bridge networks otherwise
+		rule := fmt.Sprintf("%s -d %s -j ACCEPT", dockerUserChain, cidr)
+		script = append(script, fmt.Sprintf("  if %s -n -L %s >/dev/null 2>&1; then %s -C %s 2>/dev/null || %s -I %s; fi", iptables, dockerUserChain, iptables, rule, iptables, rule))
+	}
+	script = append(script, "else")
+	script = append(script, fmt.Sprintf("  nft add table inet %s", guestForwardingTable))
+	script = append(script, fmt.Sprintf("  nft 'add chain inet %s forward { type filter hook forward priority 0; policy accept; }'", guestForwardingTable))
+	script = append(script, fmt.Sprintf("  nft flush chain inet %s forward", guestForwardingTable))
+	for _, cidr := range cidrs {
+		family := nftFamily(cidr)
+		script = append(script, fmt.Sprintf("  nft add rule inet %s forward %s daddr %s accept", guestForwardingTable, family, cidr))
+		script = append(script, fmt.Sprintf("  nft add rule inet %s forward %s saddr %s accept", guestForwardingTable, family, cidr))
+	}
+	script = append(script, "fi")
+
+	return strings.Join(script, "\n")
+}
+
+// cleanupGuestForwarding removes the forwarding rules added by setupGuestForwarding.
+func cleanupGuestForwarding(guest vmGuest, cidrs []string) error {
+	var script []string
+	script = append(script, "if command -v iptables >/dev/null; then")
+	for _, cidr := range cidrs {
+		iptables := iptablesCommand(cidr)
+		for _, dir := range []string{"-d", "-s"} {
+			rule := fmt.Sprintf("FORWARD %s %s -j ACCEPT", dir, cidr)
+			script = append(script, fmt.Sprintf("  %s -D %s 2>/dev/null || true", iptables, rule))
+		}
+		rule := fmt.Sprintf("%s -d %s -j ACCEPT", dockerUserChain, cidr)
+		script = append(script, fmt.Sprintf("  %s -D %s 2>/dev/null || true", iptables, rule))
+	}
+	script = append(script, "else")
+	script = append(script, fmt.Sprintf("  nft delete table inet %s 2>/dev/null || true", guestForwardingTable))
+	script = append(script, "fi")
+
+	if err := guest.RunQuiet("sudo", "sh", "-c", strings.Join(script, "\n")); err != nil {
+		return fmt.Errorf("error removing forwarding rules in the VM: %w", err)
+	}
+	return nil
+}
+
+// iptablesCommand returns the iptables command for the address family of cidr.
+func iptablesCommand(cidr string) string {
+	if isIPv6(cidr) {
+		return "ip6tables"
+	}
+	return "iptables"
+}
+
+// nftFamily returns the nftables address family of cidr.
+func nftFamily(cidr string) string {
+	if isIPv6(cidr) {
+		return "ip6"
+	}
+	return "ip"
+}
@@ -0,0 +1,54 @@
+package routing
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strconv"
+)
+
+// LoadBalancerPort is a TCP port of a LoadBalancer Service, on the IP of the load balancer in the VM.
+type LoadBalancerPort struct {
+	IP   string
+	Port int
+}
+
+// String returns the address of the port.
+func (p LoadBalancerPort) String() string { return net.JoinHostPort(p.IP, strconv.Itoa(p.Port)) }
+
+// GetLoadBalancerPorts retrieves the TCP ports of the LoadBalancer Services with an allocated IP,
+// allocated by ServiceLB or MetalLB, of the Kubernetes cluster in the VM of the profile.
+func GetLoadBalancerPorts(ctx context.Context, profile string) ([]LoadBalancerPort, error) {
+	api, err := newKubeAPI(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+	return api.loadBalancerPorts()
+}
+
+// loadBalancerPorts retrieves the TCP ports of the LoadBalancer Services, sorted by port.
+func (k kubeAPI) loadBalancerPorts() ([]LoadBalancerPort, error) {
+	var services kubeList[kubeService]
+	if err := k.get("/api/v1/services", &services); err != nil {
+		return nil, err
+	}
+
+	var ports []LoadBalancerPort
+	for _, s := range services.Items {
+		if s.Spec.Type != "LoadBalancer" {
+			continue
+		}
+		for _, ingress := range s.Status.LoadBalancer.Ingress {
+			if ip := net.ParseIP(ingress.IP); ip == nil || ip.To4() == nil {
+				continue
+			}
+			for _, p := range s.Spec.Ports {
+				if p.Protocol == "" || p.Protocol == "TCP" {
+					ports = append(ports, LoadBalancerPort{IP: ingress.IP, Port: p.Port})
+				}
+			}
+		}
+	}
+	slices.SortStableFunc(ports, func(a, b LoadBalancerPort) int { return a.Port - b.Port })
+	return ports, nil
+}
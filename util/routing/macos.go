@@ -0,0 +1,9 @@
+package routing
+
+// macOSRouteArgs returns the route(8) args for cidr, with the address family set for IPv6.
+func macOSRouteArgs(cidr string, args ...string) []string {
+	if isIPv6(cidr) {
+		args = append(args, "-inet6")
+	}
+	return append(args, cidr)
+}
@@ -0,0 +1,180 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	log "github.com/sirupsen/logrus"
+)
+
+// peer is the VM of a profile connected to the VMs of other profiles.
+// The VMs are connected via the user-v2 network, which is shared by all the VMs.
+type peer struct {
+	profile string
+	ip      string   // user-v2 network address
+	cidrs   []string // container, Pod and Service networks
+}
+
+// peerNetworks returns the peer for the running VM of the profile.
+func peerNetworks(ctx context.Context, profile string, conf config.Config) (peer, error) {
+	p := peer{profile: profile}
+	if !newGuest(profile).Running(ctx) {
+		return p, fmt.Errorf("VM not running")
+	}
+
+	p.ip = limautil.UserNetIPAddress(profile)
+	if p.ip == "" {
+		return p, fmt.Errorf("user-v2 network address not available")
+	}
+
+	switch conf.Runtime {
+	case docker.Name, containerd.Name:
+		cidrs, err := GetContainerCIDR(ctx, profile, conf.Runtime)
+		if err != nil {
+			return p, err
+		}
+		p.cidrs = append(p.cidrs, cidrs...)
+	}
+
+	if conf.Kubernetes.Enabled {
+		if cidrs, err := GetPodCIDR(ctx, profile, conf.Kubernetes); err == nil {
+			p.cidrs = append(p.cidrs, cidrs...)
+		}
+		if cidrs, err := GetServiceCIDR(ctx, profile, conf.Kubernetes); err == nil {
+			p.cidrs = append(p.cidrs, cidrs...)
+		}
+	}
+
+	return p, nil
+}
+
+// peerProfiles returns the running profiles connected to the profile, the peers in
+// the config and the running profiles with the profile as a peer in their config.
+func peerProfiles(profile string, conf config.Config) map[string]config.Config {
+	peers := map[string]config.Config{}
+	for p := range runningProfiles() {
+		if p == profile {
+			continue
+		}
+		c, err := configmanager.LoadFrom(config.ProfileFromName(p).StateFile())
+		if err != nil {
+			log.Debugf("error retrieving config of profile '%s': %v", p, err)
+			continue
+		}
+		if slices.ContainsFunc(conf.Network.Peers, func(name string) bool { return config.ProfileFromName(name).ID == p }) ||
+			slices.ContainsFunc(c.Network.Peers, func(name string) bool { return config.ProfileFromName(name).ID == profile }) {
+			peers[p] = c
+		}
+	}
+	return peers
+}
+
+// peerRoutes returns the networks of to that are routed from the VM of from.
+// Networks overlapping with the networks of from are excluded, they cannot be told apart.
+func peerRoutes(from, to peer) (routes, skipped []string) {
+	for _, cidr := range to.cidrs {
+		if isIPv6(cidr) {
+			continue // the user-v2 network is IPv4 only
+		}
+		if slices.ContainsFunc(from.cidrs, func(c string) bool { return overlaps(c, cidr) }) {
+			skipped = append(skipped, cidr)
+			continue
+		}
+		routes = append(routes, cidr)
+	}
+	return
+}
+
+// peerRoutesScript returns the shell script to route the networks via the peer address in the VM.
+func peerRoutesScript(cidrs []string, via string) string {
+	script := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		script = append(script, fmt.Sprintf("ip route replace %s via %s", cidr, via))
+	}
+	return strings.Join(script, "\n")
+}
+
+// connectPeer routes the networks of to from the VM of from and permits the forwarding in the VM of to.
+func connectPeer(from, to peer) error {
+	routes, skipped := peerRoutes(from, to)
+	if len(skipped) > 0 {
+		log.Warnf("networks %s of profile '%s' overlap with the networks of profile '%s' and are not reachable from it",
+			strings.Join(skipped, ", "), to.profile, from.profile)
+	}
+	if len(routes) == 0 {
+		return nil
+	}
+
+	if err := setupGuestForwarding(newGuest(to.profile), routes); err != nil {
+		return err
+	}
+	if err := newGuest(from.profile).RunQuiet("sudo", "sh", "-c", peerRoutesScript(routes, to.ip)); err != nil {
+		return fmt.Errorf("error adding routes to profile '%s' in profile '%s': %w", to.profile, from.profile, err)
+	}
+
+	log.Debugf("profile '%s' routes %s via profile '%s'", from.profile, strings.Join(routes, ", "), to.profile)
+	return nil
+}
+
+// SetupPeers connects the VM of the profile with the VMs of the running peer profiles in both
+// directions, routing the container, Pod and Service networks of each VM via the other VM.
+func SetupPeers(ctx context.Context, profile string, conf config.Config) error {
+	peers := peerProfiles(profile, conf)
+	if len(peers) == 0 {
+		return nil
+	}
+
+	self, err := peerNetworks(ctx, profile, conf)
+	if err != nil {
+		return fmt.Errorf("error retrieving networks: %w", err)
+	}
+
+	for p, c := range peers {
+		other, err := peerNetworks(ctx, p, c)
+		if err != nil {
+			log.Warnf("Failed to retrieve networks of peer profile '%s': %v", p, err)
+			continue
+		}
+		if err := connectPeer(self, other); err != nil {
+			log.Warnf("Failed to connect to peer profile '%s': %v", p, err)
+		}
+		if err := connectPeer(other, self); err != nil {
+			log.Warnf("Failed to connect peer profile '%s': %v", p, err)
+		}
+	}
+	return nil
+}
+
+// CleanupPeers removes the routes to the networks of the profile from the VMs of the running peer profiles.
+func CleanupPeers(ctx context.Context, profile string, conf config.Config) error {
+	peers := peerProfiles(profile, conf)
+	if len(peers) == 0 || !newGuest(profile).Running(ctx) {
+		return nil
+	}
+
+	self, err := peerNetworks(ctx, profile, conf)
+	if err != nil {
+		return fmt.Errorf("error retrieving networks: %w", err)
+	}
+	if len(self.cidrs) == 0 {
+		return nil
+	}
+
+	for p := range peers {
+		var script []string
+		for _, cidr := range self.cidrs {
+			script = append(script, fmt.Sprintf("ip route del %s via %s 2>/dev/null || true", cidr, self.ip))
+		}
+		if err := newGuest(p).RunQuiet("sudo", "sh", "-c", strings.Join(script, "\n")); err != nil {
+			log.Warnf("Failed to remove routes from peer profile '%s': %v", p, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package routing
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// launchdInterval is the interval in seconds at which the launchd job re-applies the routes.
+// The routes cannot be added until the VM network is up, it is thereby retried periodically.
+const launchdInterval = 30
+
+const launchdPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>Label</key>
+  <string>{{ .Label }}</string>
+  <key>ProgramArguments</key>
+  <array>
+    <string>/bin/sh</string>
+    <string>-c</string>
+    <string>{{ .Script }}</string>
+  </array>
+  <key>RunAtLoad</key>
+  <true/>
+  <key>StartInterval</key>
+  <integer>{{ .Interval }}</integer>
+</dict>
+</plist>
+`
+
+// launchdLabel returns the launchd job label for the routes of the profile.
+func launchdLabel(profile string) string { return "com.abiosoft." + profile + ".routes" }
+
+// launchdFile returns the path to the launchd job file for the routes of the profile.
+func launchdFile(profile string) string {
+	return "/Library/LaunchDaemons/" + launchdLabel(profile) + ".plist"
+}
+
+// persistScript returns the shell script that re-applies the routes.
+// The script is regenerated on every startup with the current VM IP address, an existing
+// route to another gateway e.g. of a previous VM IP address is replaced to allow re-runs.
+func (rm *RouteManager) persistScript() string {
+	var lines []string
+	for _, cidr := range rm.cidrs() {
+		gateway := rm.gateway(cidr)
+		if gateway == "" {
+			continue
+		}
+		get := strings.Join(macOSRouteArgs(cidr, "/sbin/route", "-n", "get"), " ")
+		change := strings.Join(append(macOSRouteArgs(cidr, "/sbin/route", "-n", "change"), gateway), " ")
+		add := strings.Join(append(macOSRouteArgs(cidr, "/sbin/route", "-n", "add"), gateway), " ")
+		lines = append(lines, fmt.Sprintf("(%s 2>/dev/null | grep -q 'gateway: %s$' || %s >/dev/null 2>&1 || %s)", get, gateway, change, add))
+	}
+	return strings.Join(lines, "; ")
+}
+
+// InstallPersistence installs a launchd job that re-applies the routes on boot.
+// This is only supported on macOS.
+func (rm *RouteManager) InstallPersistence(host environment.HostActions) error {
+	if !util.MacOS() {
+		log.Debug("Persistent Pod routing is only supported on macOS")
+		return nil
+	}
+
+	script := rm.persistScript()
+	if script == "" {
+		return nil
+	}
+
+	var escaped bytes.Buffer
+	if err := xml.EscapeText(&escaped, []byte(script)); err != nil {
+		return fmt.Errorf("error escaping route script: %w", err)
+	}
+
+	values := struct {
+		Label    string
+		Script   string
+		Interval int
+	}{
+		Label:    launchdLabel(rm.profile),
+		Script:   escaped.String(),
+		Interval: launchdInterval,
+	}
+	plist, err := util.ParseTemplate(launchdPlist, values)
+	if err != nil {
+		return fmt.Errorf("error generating launchd job: %w", err)
+	}
+
+	// nothing to do if unchanged
+	file := launchdFile(rm.profile)
+	if b, err := os.ReadFile(file); err == nil && bytes.Equal(b, plist) {
+		return nil
+	}
+
+	if rm.plan != nil {
+		rm.plan.add(Change{Kind: ChangePersistence, Action: "install", Target: file, Content: string(plist),
+			Command: fmt.Sprintf("sudo tee %s >/dev/null && sudo launchctl bootstrap system %s", file, file)})
+		return nil
+	}
+
+	// unload previous job, if any
+	_ = host.RunQuiet("sudo", "launchctl", "bootout", "system/"+values.Label)
+
+	stdout := &bytes.Buffer{}
+	if err := host.RunWith(bytes.NewReader(plist), stdout, "sudo", "sh", "-c", "cat > "+file); err != nil {
+		return fmt.Errorf("error writing launchd job, stderr: %s, err: %w", stdout.String(), err)
+	}
+	if err := host.RunQuiet("sudo", "launchctl", "bootstrap", "system", file); err != nil {
+		return fmt.Errorf("error loading launchd job: %w", err)
+	}
+
+	log.Infof("Pod network routes will be restored on boot via launchd job '%s'", values.Label)
+	return nil
+}
+
+// UninstallPersistence removes the launchd job installed by InstallPersistence.
+func (rm *RouteManager) UninstallPersistence(host environment.HostActions) error {
+	if !util.MacOS() {
+		return nil
+	}
+
+	file := launchdFile(rm.profile)
+	if _, err := os.Stat(file); err != nil {
+		// not installed
+		return nil
+	}
+
+	if rm.plan != nil {
+		rm.plan.add(Change{Kind: ChangePersistence, Action: "uninstall", Target: file,
+			Command: fmt.Sprintf("sudo launchctl bootout system/%s; sudo rm -f %s", launchdLabel(rm.profile), file)})
+		return nil
+	}
+
+	_ = host.RunQuiet("sudo", "launchctl", "bootout", "system/"+launchdLabel(rm.profile))
+	if err := host.RunQuiet("sudo", "rm", "-f", file); err != nil {
+		return fmt.Errorf("error removing launchd job: %w", err)
+	}
+
+	log.Debugf("launchd job for Pod network routes removed: %s", file)
+	return nil
+}
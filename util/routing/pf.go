@@ -0,0 +1,188 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Pod access modes.
+const (
+	// AccessRoute adds host routes to the networks via the VM.
+	AccessRoute = "route"
+	// AccessPF programs pf rules to reach the networks via the VM, without modifying the routing table.
+	// It is only supported on macOS.
+	AccessPF = "pf"
+	// AccessWireGuard routes the networks through a WireGuard tunnel to the VM,
+	// independent of the VM IP address.
+	AccessWireGuard = "wireguard"
+	// AccessOff disables access to the networks from the host.
+	AccessOff = "off"
+)
+
+// pfAnchor returns the pf anchor for the rules of the profile.
+// Anchors under com.apple/ are evaluated by the default macOS pf config.
+func pfAnchor(profile string) string { return "com.apple/colima." + profile }
+
+// pfRouteRegex matches the route-to rules in the pfctl output.
+var pfRouteRegex = regexp.MustCompile(`route-to \(\S+ ([0-9a-fA-F:.]+)\) inet6? from any to ([0-9a-fA-F:./]+)`)
+
+// hostInterface returns the host network interface for the network containing ip.
+func hostInterface(ip net.IP) (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("error retrieving network interfaces: %w", err)
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if n, ok := addr.(*net.IPNet); ok && n.Contains(ip) {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no network interface found for %s", ip)
+}
+
+// pfRules returns the pf rules to reach the networks via the VM.
+// iface returns the host network interface for a gateway.
+// Traffic is routed to the VM and translated to the interface address for the replies to return.
+func (rm *RouteManager) pfRules(iface func(net.IP) (string, error)) (string, error) {
+	var nat, filter []string
+	for _, cidr := range rm.cidrs() {
+		r, err := parseRoute(cidr, rm.gateway(cidr))
+		if err != nil {
+			return "", err
+		}
+		if r.Gateway == nil {
+			continue
+		}
+		name, err := iface(r.Gateway)
+		if err != nil {
+			return "", err
+		}
+
+		family := "inet"
+		if isIPv6(cidr) {
+			family = "inet6"
+		}
+		nat = append(nat, fmt.Sprintf("nat on %s %s from any to %s -> (%s)", name, family, cidr, name))
+		filter = append(filter, fmt.Sprintf("pass out quick route-to (%s %s) %s from any to %s keep state", name, r.Gateway, family, cidr))
+	}
+
+	// translation rules must precede filter rules
+	return strings.Join(append(nat, filter...), "\n") + "\n", nil
+}
+
+// setupPF loads the pf rules for the networks into the anchor of the profile and enables pf.
+func (rm *RouteManager) setupPF(ctx context.Context) error {
+	rules, err := rm.pfRules(hostInterface)
+	if err != nil {
+		return err
+	}
+	if rm.plan != nil {
+		anchor := pfAnchor(rm.profile)
+		rm.plan.add(Change{Kind: ChangePF, Action: "load", Target: anchor, Content: rules,
+			Command: sudoCommand("pfctl", "-a", anchor, "-f", "-") + " && " + sudoCommand("pfctl", "-e")})
+		return nil
+	}
+	_, err = runPF(ctx, rm.profile, "pf-load", rules)
+	rm.emit(EventPFLoaded, strings.Join(rm.cidrs(), ","), rm.vmIP, err)
+	if err != nil {
+		return fmt.Errorf("error loading pf rules: %w", err)
+	}
+	return nil
+}
+
+// cleanupPF flushes the pf rules in the anchor of the profile.
+// pf is left enabled as it may be in use by other anchors.
+func (rm *RouteManager) cleanupPF(ctx context.Context) error {
+	if rm.plan != nil {
+		anchor := pfAnchor(rm.profile)
+		rm.plan.add(Change{Kind: ChangePF, Action: "flush", Target: anchor, Command: sudoCommand("pfctl", "-a", anchor, "-F", "all")})
+		return nil
+	}
+	_, err := runPF(ctx, rm.profile, "pf-flush", "")
+	rm.emit(EventPFFlushed, "", "", err)
+	if err != nil {
+		return fmt.Errorf("error flushing pf rules: %w", err)
+	}
+	return nil
+}
+
+// pfRoutes returns the routes in the pf rules of the anchor of the profile.
+func (rm *RouteManager) pfRoutes(ctx context.Context) (routeTable, error) {
+	output, err := runPF(ctx, rm.profile, "pf-show", "")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving pf rules: %w", err)
+	}
+	return parsePFRoutes(output), nil
+}
+
+// parsePFRoutes returns the routes in the pfctl rules output.
+func parsePFRoutes(output string) routeTable {
+	routes := routeTable{}
+	for _, match := range pfRouteRegex.FindAllStringSubmatch(output, -1) {
+		r, err := parseRoute(match[2], match[1])
+		if err != nil {
+			continue
+		}
+		routes[r.Destination.String()] = r
+	}
+	return routes
+}
+
+// routeTable is a lookup table of routes by destination network.
+type routeTable map[string]Route
+
+// Get returns the route for the exact destination network.
+func (t routeTable) Get(dst *net.IPNet) (Route, error) {
+	if r, ok := t[dst.String()]; ok {
+		return r, nil
+	}
+	return Route{}, ErrRouteNotFound
+}
+
+// runPF runs the pf action for the anchor of the profile with the privileged helper,
+// or pfctl with sudo when the helper is not installed.
+func runPF(ctx context.Context, profile, action, stdin string) (string, error) {
+	anchor := pfAnchor(profile)
+
+	var args []string
+	switch action {
+	case "pf-load":
+		args = []string{"sh", "-c", "pfctl -a " + anchor + " -f - && { pfctl -e >/dev/null 2>&1 || true; }"}
+	case "pf-flush":
+		args = []string{"pfctl", "-a", anchor, "-F", "all"}
+	case "pf-show":
+		args = []string{"pfctl", "-a", anchor, "-s", "rules"}
+	default:
+		return "", fmt.Errorf("invalid pf action '%s'", action)
+	}
+
+	switch {
+	case os.Geteuid() == 0:
+	case HelperInstalled():
+		args = []string{"sudo", "-n", HelperPath, action, anchor}
+	default:
+		args = append([]string{"sudo"}, args...)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w, output: %s", err, stderr.String())
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,72 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Change kinds.
+const (
+	ChangeRoute       = "route"
+	ChangePF          = "pf"
+	ChangeResolver    = "resolver"
+	ChangePersistence = "persistence"
+	ChangeForwarding  = "forwarding"
+	ChangeHelper      = "helper"
+	ChangeWireGuard   = "wireguard"
+	ChangeHosts       = "hosts"
+)
+
+// Change is a change to the host or the VM for the network routing.
+type Change struct {
+	Kind    string `json:"kind"`
+	Action  string `json:"action"`
+	Target  string `json:"target"`
+	Content string `json:"content,omitempty"` // file contents, rules or script piped to the command, if any
+	Command string `json:"command"`           // shell command to apply the change manually
+}
+
+// Plan is the list of changes for a dry-run of the network routing setup or cleanup.
+type Plan struct {
+	Changes []Change
+}
+
+func (p *Plan) add(c Change) { p.Changes = append(p.Changes, c) }
+
+type ctxKeyPlan struct{}
+
+// WithDryRun returns a context for a dry-run of the network routing setup or cleanup.
+// The changes are recorded in plan rather than applied.
+func WithDryRun(ctx context.Context, plan *Plan) context.Context {
+	return context.WithValue(ctx, ctxKeyPlan{}, plan)
+}
+
+// planFromContext returns the dry-run plan in ctx, if any.
+func planFromContext(ctx context.Context) *Plan {
+	plan, _ := ctx.Value(ctxKeyPlan{}).(*Plan)
+	return plan
+}
+
+// Script returns the plan as a shell script for applying the changes manually.
+func (p Plan) Script() string {
+	var b strings.Builder
+	for _, c := range p.Changes {
+		fmt.Fprintf(&b, "# %s: %s %s\n", c.Kind, c.Action, c.Target)
+		if c.Content == "" {
+			b.WriteString(c.Command + "\n\n")
+			continue
+		}
+		fmt.Fprintf(&b, "%s <<'EOF'\n%s", c.Command, c.Content)
+		if !strings.HasSuffix(c.Content, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString("EOF\n\n")
+	}
+	return b.String()
+}
+
+// sudoCommand returns the shell command for args, prefixed with sudo.
+func sudoCommand(args ...string) string {
+	return "sudo " + strings.Join(args, " ")
+}
@@ -0,0 +1,189 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/host"
+	log "github.com/sirupsen/logrus"
+)
+
+// PrunedRoute is a host route of a profile whose VM is gone.
+type PrunedRoute struct {
+	Profile string `json:"profile"`
+	CIDR    string `json:"cidr"`
+	Gateway string `json:"gateway"`
+	Removed bool   `json:"removed"` // false if the route was no longer on the host
+}
+
+// PruneRoutes removes the orphaned host routes of the profiles whose VM is no
+// longer running e.g. after a crash or a forceful delete.
+// The routes are retrieved from the route registry.
+// For a dry-run, the changes are recorded in the plan of ctx and the registry is left untouched.
+func PruneRoutes(ctx context.Context) ([]PrunedRoute, error) {
+	if !supported() {
+		return nil, nil
+	}
+
+	plan := planFromContext(ctx)
+	routeManager := func(profile string) *RouteManager {
+		rm := NewRouteManager("", "", nil, nil, profile)
+		rm.plan = plan
+		return rm
+	}
+	flushPF := func(ctx context.Context, profile string) error {
+		return routeManager(profile).cleanupPF(ctx)
+	}
+	running := runningProfiles()
+	pruneHosts(ctx, running)
+
+	var backend RouteBackend = defaultBackend()
+	if plan != nil {
+		backend = planBackend{RouteBackend: backend, plan: plan}
+	}
+	pruned, profiles, err := prune(ctx, backend, flushPF, config.RoutesFile(), running)
+	for _, r := range pruned {
+		if r.Removed && plan == nil {
+			emitEvent(prunedEventLogFile(r.Profile), EventRoutePruned, r.Profile, r.CIDR, r.Gateway, nil)
+		}
+	}
+	if err != nil {
+		return pruned, err
+	}
+
+	// host configurations of the orphaned profiles
+	for _, p := range profiles {
+		rm := routeManager(p)
+		if err := rm.UninstallPersistence(host.New()); err != nil {
+			log.Warnf("Failed to remove route persistence of profile '%s': %v", p, err)
+		}
+		if err := rm.CleanupClusterDNS(host.New()); err != nil {
+			log.Warnf("Failed to remove cluster DNS config of profile '%s': %v", p, err)
+		}
+		if err := cleanupWireGuard(ctx, p); err != nil {
+			log.Warnf("Failed to remove WireGuard tunnel of profile '%s': %v", p, err)
+		}
+	}
+
+	return pruned, nil
+}
+
+// prune removes the routes in the registry file of the profiles that are not running
+// and returns the pruned routes and profiles.
+// Routes that have since been replaced, or are shared with a running profile, are left untouched.
+// flushPF flushes the pf rules of a profile for the routes of the pf access mode.
+func prune(ctx context.Context, backend RouteBackend, flushPF func(context.Context, string) error, file string, running map[string]bool) ([]PrunedRoute, []string, error) {
+	r, err := loadRegistry(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var profiles []string
+	for p := range r {
+		if !running[p] {
+			profiles = append(profiles, p)
+		}
+	}
+	if len(profiles) == 0 {
+		return nil, nil, nil
+	}
+	sort.Strings(profiles)
+
+	// routes still in use by running profiles
+	inUse := func(route registryRoute) bool {
+		for p, routes := range r {
+			if !running[p] {
+				continue
+			}
+			for _, other := range routes {
+				if other == route {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	var pruned []PrunedRoute
+	for _, p := range profiles {
+		flushed := false
+		for _, route := range r[p] {
+			prunedRoute := PrunedRoute{Profile: p, CIDR: route.CIDR, Gateway: route.Gateway}
+
+			var removed bool
+			if route.PF {
+				// pf rules are flushed for all routes of the profile at once
+				if !flushed {
+					if err := flushPF(ctx, p); err != nil {
+						return pruned, nil, err
+					}
+					flushed = true
+				}
+				removed = true
+			} else {
+				var err error
+				removed, err = pruneRoute(ctx, backend, route, inUse(route))
+				if err != nil {
+					return pruned, nil, err
+				}
+			}
+			prunedRoute.Removed = removed
+			pruned = append(pruned, prunedRoute)
+
+			if removed && planFromContext(ctx) == nil {
+				log.Infof("Removed orphaned route %s via %s of profile '%s'", route.CIDR, route.Gateway, config.ProfileFromName(p).ShortName)
+			}
+		}
+		delete(r, p)
+	}
+
+	// dry-run
+	if planFromContext(ctx) != nil {
+		return pruned, profiles, nil
+	}
+	return pruned, profiles, r.save(file)
+}
+
+// planBackend records the route deletions in the plan rather than applying them.
+type planBackend struct {
+	RouteBackend
+	plan *Plan
+}
+
+func (b planBackend) Delete(_ context.Context, dst *net.IPNet) error {
+	cidr := dst.String()
+	b.plan.add(Change{Kind: ChangeRoute, Action: "delete", Target: cidr, Command: sudoCommand(routeDeleteArgs(cidr)...)})
+	return nil
+}
+
+// pruneRoute removes the host route if it still points to the recorded gateway
+// and it is not in use.
+func pruneRoute(ctx context.Context, backend RouteBackend, route registryRoute, inUse bool) (bool, error) {
+	_, dst, err := net.ParseCIDR(route.CIDR)
+	if err != nil || inUse {
+		return false, nil
+	}
+
+	current, err := backend.Get(dst)
+	if err != nil {
+		if errors.Is(err, ErrRouteNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !current.Gateway.Equal(net.ParseIP(route.Gateway)) {
+		// replaced since, not ours to remove
+		return false, nil
+	}
+
+	if err := backend.Delete(ctx, dst); err != nil {
+		if errors.Is(err, ErrRouteNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,234 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	log "github.com/sirupsen/logrus"
+)
+
+// registry is the record of the host routes of all profiles.
+// It is used to detect conflicting routes across profiles.
+type registry map[string][]registryRoute
+
+// registryRoute is a host route recorded in the registry.
+type registryRoute struct {
+	CIDR    string `json:"cidr"`
+	Gateway string `json:"gateway"`
+	PF      bool   `json:"pf,omitempty"` // set for the pf access mode
+}
+
+// registryFile returns the path to the route registry.
+func (rm *RouteManager) registryFile() string {
+	if rm.registry != "" {
+		return rm.registry
+	}
+	return config.RoutesFile()
+}
+
+// runningProfiles returns the IDs of the running profiles.
+// It is a variable to enable stubbing in tests.
+var runningProfiles = func() map[string]bool {
+	running := map[string]bool{}
+	instances, err := limautil.RunningInstances()
+	if err != nil {
+		log.Debugf("error retrieving running instances: %v", err)
+		return running
+	}
+	for _, i := range instances {
+		running[i.Name] = true
+	}
+	return running
+}
+
+// loadRegistry loads the route registry from file.
+// An empty registry is returned if the file does not exist.
+func loadRegistry(file string) (registry, error) {
+	r := registry{}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return r, nil
+		}
+		return nil, fmt.Errorf("error reading route registry: %w", err)
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("error parsing route registry: %w", err)
+	}
+	return r, nil
+}
+
+// save saves the registry to file.
+func (r registry) save(file string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding route registry: %w", err)
+	}
+
+	// write to a temporary file first to prevent a partial write
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("error writing route registry: %w", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return fmt.Errorf("error writing route registry: %w", err)
+	}
+	return nil
+}
+
+// conflicts returns an error if any of the routes overlap with the routes of
+// other running profiles.
+func (r registry) conflicts(profile string, routes []registryRoute, running map[string]bool) error {
+	var conflicts []string
+
+	profiles := make([]string, 0, len(r))
+	for p := range r {
+		profiles = append(profiles, p)
+	}
+	sort.Strings(profiles)
+
+	for _, route := range routes {
+		for _, p := range profiles {
+			// routes of stopped profiles are stale
+			if p == profile || !running[p] {
+				continue
+			}
+			for _, other := range r[p] {
+				if overlaps(route.CIDR, other.CIDR) {
+					conflicts = append(conflicts, fmt.Sprintf("%s overlaps with %s of profile '%s' (via %s)",
+						route.CIDR, other.CIDR, config.ProfileFromName(p).ShortName, other.Gateway))
+				}
+			}
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	msg := "network routes conflict with other profiles: " + strings.Join(conflicts, ", ")
+	return errors.New(msg + r.suggestion(routes))
+}
+
+// suggestion returns the remediation for conflicting routes, suggesting
+// networks that do not overlap with the registry or the additional routes.
+func (r registry) suggestion(additional []registryRoute) string {
+	pod, service, ok := r.freeCIDRs(additional)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("; set non-conflicting networks in the config with kubernetes.podCIDR: %s and kubernetes.serviceCIDR: %s", pod, service)
+}
+
+// freeCIDRs returns a pair of /16 networks in 10.0.0.0/8 that do not overlap
+// with any of the routes in the registry or the additional routes.
+func (r registry) freeCIDRs(additional []registryRoute) (pod, service string, ok bool) {
+	var free []string
+	for i := 42; i < 256 && len(free) < 2; i++ {
+		cidr := fmt.Sprintf("10.%d.0.0/16", i)
+		used := false
+		for _, route := range additional {
+			if overlaps(cidr, route.CIDR) {
+				used = true
+			}
+		}
+		for _, routes := range r {
+			for _, route := range routes {
+				if overlaps(cidr, route.CIDR) {
+					used = true
+				}
+			}
+		}
+		if !used {
+			free = append(free, cidr)
+		}
+	}
+	if len(free) < 2 {
+		return "", "", false
+	}
+	return free[0], free[1], true
+}
+
+// overlaps returns if the networks a and b overlap.
+func overlaps(a, b string) bool {
+	_, na, err := net.ParseCIDR(a)
+	if err != nil {
+		return false
+	}
+	_, nb, err := net.ParseCIDR(b)
+	if err != nil {
+		return false
+	}
+	return na.Contains(nb.IP) || nb.Contains(na.IP)
+}
+
+// register records the routes of the route manager in the registry.
+// An error is returned if the routes conflict with the routes of other running profiles.
+func (rm *RouteManager) register() error {
+	r, err := loadRegistry(rm.registryFile())
+	if err != nil {
+		return err
+	}
+
+	var routes []registryRoute
+	for _, cidr := range rm.cidrs() {
+		if gateway := rm.gateway(cidr); gateway != "" {
+			routes = append(routes, registryRoute{CIDR: cidr, Gateway: gateway, PF: rm.access == AccessPF})
+		}
+	}
+
+	if err := r.conflicts(rm.profile, routes, runningProfiles()); err != nil {
+		return err
+	}
+
+	// dry-run
+	if rm.plan != nil {
+		return nil
+	}
+
+	r[rm.profile] = routes
+	return r.save(rm.registryFile())
+}
+
+// unregister removes the routes of the route manager from the registry.
+func (rm *RouteManager) unregister() error {
+	r, err := loadRegistry(rm.registryFile())
+	if err != nil {
+		return err
+	}
+	if _, ok := r[rm.profile]; !ok || rm.plan != nil {
+		return nil
+	}
+
+	delete(r, rm.profile)
+	return r.save(rm.registryFile())
+}
+
+// otherProfile returns the other running profile that the route for cidr via
+// gateway is registered to, if any.
+func (rm *RouteManager) otherProfile(cidr string, gateway net.IP) (string, bool) {
+	r, err := loadRegistry(rm.registryFile())
+	if err != nil || gateway == nil {
+		return "", false
+	}
+
+	running := runningProfiles()
+	for p, routes := range r {
+		if p == rm.profile || !running[p] {
+			continue
+		}
+		for _, route := range routes {
+			if route.CIDR == cidr && gateway.Equal(net.ParseIP(route.Gateway)) {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
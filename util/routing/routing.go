@@ -2,248 +2,703 @@ package routing
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
-	"os/exec"
+	"slices"
 	"strings"
 
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/environment/host"
-	"github.com/abiosoft/colima/environment/vm/lima"
 	"github.com/abiosoft/colima/environment/vm/lima/limautil"
 	"github.com/abiosoft/colima/util"
 	log "github.com/sirupsen/logrus"
 )
 
-// RouteManager manages network routing rules for Pod networks
+const (
+	// DefaultPodCIDR is the default k3s Pod network CIDR
+	DefaultPodCIDR = "10.42.0.0/16"
+	// DefaultServiceCIDR is the default k3s Service network CIDR
+	DefaultServiceCIDR = "10.43.0.0/16"
+)
+
+// RouteManager manages network routing rules for Pod and Service networks
 type RouteManager struct {
-	vmIP    string
-	podCIDR string
-	profile string
+	vmIP           string
+	vmIPv6         string
+	podCIDRs       []string
+	serviceCIDRs   []string
+	containerCIDRs []string // container runtime bridge networks
+	lbCIDRs        []string // pool of the Kubernetes LoadBalancer IPs
+	profile        string
+	access         string // pod access mode, defaults to AccessRoute
+	plan           *Plan  // changes are recorded rather than applied when set
+	eventLog       string // event log file, defaults to the daemon log
+	backend        RouteBackend
+	registry       string // registry file, defaults to config.RoutesFile()
 }
 
-// NewRouteManager creates a new route manager instance
-func NewRouteManager(vmIP, podCIDR, profile string) *RouteManager {
+// NewRouteManager creates a new route manager instance.
+// vmIPv6 is the gateway for IPv6 CIDRs and can be empty for IPv4 only clusters.
+func NewRouteManager(vmIP, vmIPv6 string, podCIDRs, serviceCIDRs []string, profile string) *RouteManager {
 	return &RouteManager{
-		vmIP:    vmIP,
-		podCIDR: podCIDR,
-		profile: profile,
+		vmIP:         vmIP,
+		vmIPv6:       vmIPv6,
+		podCIDRs:     podCIDRs,
+		serviceCIDRs: serviceCIDRs,
+		profile:      profile,
+		access:       AccessRoute,
+		backend:      defaultBackend(),
+	}
+}
+
+// supported returns if routing is supported on the host OS
+func supported() bool { return util.MacOS() || util.Linux() }
+
+// cidrs returns the non-empty network CIDRs managed by the route manager
+func (rm *RouteManager) cidrs() []string {
+	var cidrs []string
+	for _, cidr := range append(append(append(append([]string{}, rm.podCIDRs...), rm.serviceCIDRs...), rm.containerCIDRs...), rm.lbCIDRs...) {
+		if cidr != "" {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs
+}
+
+// gateway returns the VM IP to route cidr through, matching the IP family of cidr
+func (rm *RouteManager) gateway(cidr string) string {
+	if isIPv6(cidr) {
+		return rm.vmIPv6
 	}
+	return rm.vmIP
+}
+
+// isIPv6 returns if cidr is an IPv6 network
+func isIPv6(cidr string) bool {
+	ip, _, err := net.ParseCIDR(cidr)
+	return err == nil && ip.To4() == nil
 }
 
-// SetupPodRouting configures routing rules for Pod network access
+// SetupPodRouting configures routing rules for Pod and Service network access
 func (rm *RouteManager) SetupPodRouting(ctx context.Context) error {
-	if !util.MacOS() {
-		log.Debug("Pod routing setup is only supported on macOS")
+	if !supported() {
+		log.Debug("Pod routing setup is only supported on macOS and Linux")
 		return nil
 	}
 
-	if rm.vmIP == "" || rm.podCIDR == "" {
-		log.Debug("VM IP or Pod CIDR not available, skipping Pod routing setup")
+	if rm.access == AccessOff {
+		log.Debug("Pod access disabled, skipping Pod routing setup")
 		return nil
 	}
 
-	log.Infof("Setting up Pod network routing: %s -> %s", rm.podCIDR, rm.vmIP)
-
-	// Check if route already exists
-	if rm.routeExists() {
-		log.Debug("Pod network route already exists")
+	if (rm.vmIP == "" && rm.vmIPv6 == "") || len(rm.cidrs()) == 0 {
+		log.Debug("VM IP or network CIDR not available, skipping Pod routing setup")
 		return nil
 	}
 
-	// Add route
-	cmd := exec.CommandContext(ctx, "sudo", "route", "add", rm.podCIDR, rm.vmIP)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to add Pod network route: %w, output: %s", err, string(output))
+	// Prevent routes breaking host networks e.g. LAN or VPN
+	if routes, err := rm.backend.List(); err != nil {
+		log.Debugf("error retrieving host routes: %v", err)
+	} else if err := rm.checkHostNetworks(routes); err != nil {
+		return err
+	}
+
+	// Prevent routes conflicting with other profiles
+	if err := rm.register(); err != nil {
+		return err
+	}
+
+	if rm.access == AccessPF {
+		return rm.setupPF(ctx)
+	}
+
+	// the routes are via the VM address in the tunnel
+	if rm.access == AccessWireGuard {
+		if err := rm.setupWireGuard(ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, cidr := range rm.cidrs() {
+		if err := rm.addRoute(ctx, cidr); err != nil {
+			return err
+		}
 	}
 
-	log.Infof("✅ Pod network route configured successfully: %s -> %s", rm.podCIDR, rm.vmIP)
 	return nil
 }
 
-// CleanupPodRouting removes routing rules for Pod network
+// CleanupPodRouting removes routing rules for Pod and Service networks
 func (rm *RouteManager) CleanupPodRouting(ctx context.Context) error {
-	if !util.MacOS() {
-		log.Debug("Pod routing cleanup is only supported on macOS")
+	if !supported() {
+		log.Debug("Pod routing cleanup is only supported on macOS and Linux")
 		return nil
 	}
 
-	if rm.podCIDR == "" {
-		log.Debug("Pod CIDR not available, skipping Pod routing cleanup")
+	if rm.access == AccessOff {
+		log.Debug("Pod access disabled, skipping Pod routing cleanup")
 		return nil
 	}
 
-	log.Infof("Cleaning up Pod network routing: %s", rm.podCIDR)
+	if len(rm.cidrs()) == 0 {
+		log.Debug("Network CIDR not available, skipping Pod routing cleanup")
+		return nil
+	}
 
-	// Check if route exists before trying to delete
-	if !rm.routeExists() {
-		log.Debug("Pod network route does not exist, nothing to cleanup")
+	if rm.access == AccessPF {
+		if err := rm.cleanupPF(ctx); err != nil {
+			log.Warnf("Failed to cleanup pf rules for Pod access: %v", err)
+		}
+	} else {
+		for _, cidr := range rm.cidrs() {
+			rm.deleteRoute(ctx, cidr)
+		}
+	}
+
+	if rm.access == AccessWireGuard {
+		if err := cleanupWireGuard(ctx, rm.profile); err != nil {
+			log.Warnf("Failed to cleanup WireGuard tunnel for Pod access: %v", err)
+		}
+	}
+
+	if err := rm.unregister(); err != nil {
+		log.Warnf("Failed to update route registry: %v", err)
+	}
+
+	return nil
+}
+
+// addRoute adds a route for cidr via the VM IP if not already present
+func (rm *RouteManager) addRoute(ctx context.Context, cidr string) error {
+	gateway := rm.gateway(cidr)
+	if gateway == "" {
+		log.Warnf("VM IP not available for %s, skipping network route", cidr)
 		return nil
 	}
 
-	// Remove route
-	cmd := exec.CommandContext(ctx, "sudo", "route", "delete", rm.podCIDR)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		// Don't treat route deletion failure as fatal
-		log.Warnf("Failed to remove Pod network route: %v, output: %s", err, string(output))
+	log.Infof("Setting up network routing: %s -> %s", cidr, gateway)
+
+	r, err := parseRoute(cidr, gateway)
+	if err != nil {
+		return err
+	}
+
+	// Check if route already exists
+	current, err := rm.backend.Get(r.Destination)
+	if err == nil && current.Gateway.Equal(r.Gateway) {
+		log.Debugf("Network route for %s already exists", cidr)
+		return nil
+	}
+
+	if rm.plan != nil {
+		action := "add"
+		if err == nil {
+			action = "replace"
+		}
+		rm.plan.add(Change{Kind: ChangeRoute, Action: action, Target: r.String(), Command: sudoCommand(routeAddArgs(r, err == nil)...)})
 		return nil
 	}
 
-	log.Infof("✅ Pod network route cleaned up successfully: %s", rm.podCIDR)
+	// Add route
+	if err := rm.backend.Add(ctx, r); err != nil {
+		rm.emit(EventRouteAddFailed, cidr, gateway, err)
+		return fmt.Errorf("failed to add network route for %s: %w", cidr, err)
+	}
+	rm.emit(EventRouteAdded, cidr, gateway, nil)
+
+	log.Infof("✅ Network route configured successfully: %s -> %s", cidr, gateway)
 	return nil
 }
 
-// routeExists checks if the Pod network route already exists
-func (rm *RouteManager) routeExists() bool {
-	cmd := exec.Command("route", "-n", "get", rm.podCIDR)
-	output, err := cmd.CombinedOutput()
+// deleteRoute removes the route for cidr.
+// Failures are logged and not treated as fatal.
+func (rm *RouteManager) deleteRoute(ctx context.Context, cidr string) {
+	log.Infof("Cleaning up network routing: %s", cidr)
+
+	r, err := parseRoute(cidr, "")
+	if err != nil {
+		log.Warnf("Failed to remove network route: %v", err)
+		return
+	}
+
+	// Check if route exists before trying to delete
+	current, err := rm.backend.Get(r.Destination)
 	if err != nil {
-		return false
+		log.Debugf("Network route for %s does not exist, nothing to cleanup", cidr)
+		return
+	}
+
+	// The route may have been taken over by another profile
+	if p, ok := rm.otherProfile(cidr, current.Gateway); ok {
+		log.Debugf("Network route for %s belongs to profile '%s', skipping cleanup", cidr, p)
+		return
+	}
+
+	if rm.plan != nil {
+		rm.plan.add(Change{Kind: ChangeRoute, Action: "delete", Target: cidr, Command: sudoCommand(routeDeleteArgs(cidr)...)})
+		return
+	}
+
+	// Remove route
+	if err := rm.backend.Delete(ctx, r.Destination); err != nil {
+		// Don't treat route deletion failure as fatal
+		log.Warnf("Failed to remove network route for %s: %v", cidr, err)
+		return
 	}
+	rm.emit(EventRouteRemoved, cidr, current.Gateway.String(), nil)
 
-	// Check if the route points to our VM IP
-	return strings.Contains(string(output), rm.vmIP)
+	log.Infof("✅ Network route cleaned up successfully: %s", cidr)
 }
 
-// GetVMIP retrieves the VM IP address for the current profile
+// GetVMIP retrieves the VM IP address for the profile.
+// Only an address reachable from the host is returned, of the network address or of an
+// additional shared or bridged network. The user-mode network of the VM is not reachable.
 func GetVMIP(ctx context.Context, profile string) (string, error) {
-	if !util.MacOS() {
-		return "", fmt.Errorf("VM IP detection is only supported on macOS")
+	if !supported() {
+		return "", fmt.Errorf("VM IP detection is only supported on macOS and Linux")
+	}
+
+	instance, err := limautil.ProfileInstance(profile)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving VM IP: %w", err)
+	}
+	var interfaces []string
+	for _, n := range instance.Network {
+		interfaces = append(interfaces, n.Interface)
+	}
+
+	ipAddress, err := reachableIP(interfaces, func(iface string) string {
+		return limautil.InterfaceIPAddress(profile, iface)
+	})
+	if err != nil && util.Linux() {
+		// the network address is limited to macOS, the routes are via the WireGuard tunnel
+		return "", fmt.Errorf("VM IP address is not reachable from the host on Linux, the WireGuard tunnel is used for routing")
+	}
+	return ipAddress, err
+}
+
+// reachableIP returns the IP address of the first network interface reachable from the host.
+// The interface of the network address is preferred over the additional networks.
+func reachableIP(interfaces []string, address func(iface string) string) (string, error) {
+	var candidates []string
+	if slices.Contains(interfaces, limautil.NetInterface) {
+		candidates = append(candidates, limautil.NetInterface)
+	}
+	for i := 1; i <= len(interfaces); i++ {
+		if iface := limautil.NetworkInterface(i); slices.Contains(interfaces, iface) {
+			candidates = append(candidates, iface)
+		}
+	}
+
+	for _, iface := range candidates {
+		ipAddress := address(iface)
+		if ip := net.ParseIP(ipAddress); ip != nil && ip.To4() != nil && !ip.IsLoopback() {
+			return ipAddress, nil
+		}
+	}
+
+	return "", fmt.Errorf("VM IP address is not reachable from the host, enable the network address with `network.address` or `--network-address`")
+}
+
+// GetVMIPv6 retrieves the global IPv6 address of the VM for the profile
+func GetVMIPv6(ctx context.Context, profile string) (string, error) {
+	if !supported() {
+		return "", fmt.Errorf("VM IP detection is only supported on macOS and Linux")
+	}
+
+	iface := limautil.NetInterface
+	if util.Linux() {
+		iface = limautil.UserNetInterface
 	}
 
-	// Use limautil.IPAddress to get VM IP (same as getStatus method)
-	ipAddress := limautil.IPAddress(profile)
-	if ipAddress == "" || ipAddress == "127.0.0.1" {
-		return "", fmt.Errorf("VM IP not available or is localhost")
+	ipAddress := limautil.IPv6Address(profile, iface)
+	if ipAddress == "" {
+		return "", fmt.Errorf("VM IPv6 address not available")
 	}
 
 	// Validate IP address
-	if net.ParseIP(ipAddress) == nil {
-		return "", fmt.Errorf("invalid VM IP address: %s", ipAddress)
+	if ip := net.ParseIP(ipAddress); ip == nil || ip.To4() != nil {
+		return "", fmt.Errorf("invalid VM IPv6 address: %s", ipAddress)
 	}
 
 	return ipAddress, nil
 }
 
-// GetPodCIDR retrieves the Pod network CIDR from the Kubernetes cluster
-func GetPodCIDR(ctx context.Context) (string, error) {
-	// Create lima VM instance to execute commands
-	guest := lima.New(host.New())
-
-	// Check if VM is running
-	if !guest.Running(ctx) {
-		return "", fmt.Errorf("VM not running")
-	}
-
-	// Method 1: Try to get Pod CIDR from k3s cluster info dump
-	output, err := guest.RunOutput("kubectl", "cluster-info", "dump")
-	if err == nil {
-		// Parse cluster-cidr from output
-		lines := strings.Split(output, "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "cluster-cidr=") {
-				// Extract CIDR value
-				start := strings.Index(line, "cluster-cidr=") + len("cluster-cidr=")
-				remaining := line[start:]
-				// Handle quoted values
-				if strings.HasPrefix(remaining, `"`) {
-					end := strings.Index(remaining[1:], `"`)
-					if end > 0 {
-						cidr := remaining[1 : end+1]
-						if _, _, err := net.ParseCIDR(cidr); err == nil {
-							return cidr, nil
-						}
-					}
-				} else {
-					// Handle unquoted values
-					fields := strings.Fields(remaining)
-					if len(fields) > 0 {
-						cidr := fields[0]
-						if _, _, err := net.ParseCIDR(cidr); err == nil {
-							return cidr, nil
-						}
-					}
-				}
+// GetPodCIDR retrieves the Pod network CIDRs from the Kubernetes cluster of the profile.
+// Dual-stack clusters and clusters with multiple IP pools return all the CIDRs.
+//
+// The CIDRs are gathered from the config, the k3s args, the kube-controller-manager flags,
+// the Calico and Cilium IP pools (when flannel is disabled) and the node Pod CIDRs.
+// CIDRs contained in another CIDR are omitted.
+func GetPodCIDR(ctx context.Context, profile string, conf config.Kubernetes) ([]string, error) {
+	// explicitly configured
+	if cidrs := parseCIDRList(conf.PodCIDR); len(cidrs) > 0 {
+		return cidrs, nil
+	}
+
+	// explicitly configured via k3s args
+	if val, ok := k3sArgValue(conf.K3sArgs, "--cluster-cidr"); ok {
+		if cidrs := parseCIDRList(val); len(cidrs) > 0 {
+			return cidrs, nil
+		}
+		log.Warnf("Invalid --cluster-cidr k3s arg '%s', ignoring", val)
+	}
+
+	networks, err := GetClusterNetworks(ctx, profile)
+	if err != nil {
+		if !errors.Is(err, ErrClusterUnreachable) {
+			return nil, err
+		}
+		log.Debugf("Failed to get Pod CIDR from cluster: %v", err)
+	}
+	if cidrs := networks.PodCIDRs; len(cidrs) > 0 {
+		return cidrs, nil
+	}
+	// Fallback to default k3s Pod CIDR
+	log.Debug("Failed to get Pod CIDR from cluster, using default k3s CIDR")
+	return []string{DefaultPodCIDR}, nil
+}
+
+// fieldCIDRs returns the valid CIDRs in the whitespace or comma separated output.
+func fieldCIDRs(output string) []string {
+	var cidrs []string
+	for _, field := range strings.Fields(output) {
+		cidrs = append(cidrs, parseCIDRList(field)...)
+	}
+	return cidrs
+}
+
+// mergeCIDRs returns the unique CIDRs in cidrs, omitting the CIDRs contained in another.
+// The order of the CIDRs is preserved.
+func mergeCIDRs(cidrs []string) []string {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		if _, n, err := net.ParseCIDR(cidr); err == nil {
+			networks = append(networks, n)
+		}
+	}
+
+	contains := func(a, b *net.IPNet) bool {
+		aOnes, aBits := a.Mask.Size()
+		bOnes, bBits := b.Mask.Size()
+		return aBits == bBits && aOnes <= bOnes && a.Contains(b.IP)
+	}
+
+	var merged []string
+	for i, n := range networks {
+		covered := false
+		for j, other := range networks {
+			if i == j {
+				continue
 			}
+			// for identical networks, only the first is kept
+			if contains(other, n) && (n.String() != other.String() || j < i) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			merged = append(merged, n.String())
+		}
+	}
+	return merged
+}
+
+// GetServiceCIDR retrieves the Service network CIDRs from the config, the k3s args or the Kubernetes cluster of the profile.
+// Dual-stack clusters return both the IPv4 and IPv6 CIDRs.
+func GetServiceCIDR(ctx context.Context, profile string, conf config.Kubernetes) ([]string, error) {
+	// Method 1: explicitly configured
+	if cidrs := parseCIDRList(conf.ServiceCIDR); len(cidrs) > 0 {
+		return cidrs, nil
+	}
+
+	// explicitly configured via k3s args
+	if val, ok := k3sArgValue(conf.K3sArgs, "--service-cidr"); ok {
+		if cidrs := parseCIDRList(val); len(cidrs) > 0 {
+			return cidrs, nil
+		}
+		log.Warnf("Invalid --service-cidr k3s arg '%s', ignoring", val)
+	}
+
+	// Method 2: retrieve from the cluster
+	networks, err := GetClusterNetworks(ctx, profile)
+	if err != nil {
+		if !errors.Is(err, ErrClusterUnreachable) {
+			return nil, err
+		}
+		log.Debugf("Failed to get Service CIDR from cluster: %v", err)
+	}
+	if cidrs := networks.ServiceCIDRs; len(cidrs) > 0 {
+		return cidrs, nil
+	}
+
+	// Fallback to default k3s Service CIDR
+	log.Debug("Failed to get Service CIDR from cluster, using default k3s CIDR")
+	return []string{DefaultServiceCIDR}, nil
+}
+
+// parseCIDRList parses a comma separated list of CIDRs, invalid values are discarded.
+func parseCIDRList(value string) []string {
+	var cidrs []string
+	for _, cidr := range strings.Split(value, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if _, _, err := net.ParseCIDR(cidr); err == nil {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs
+}
+
+// k3sArgValue returns the value of the k3s arg name in either of
+// `--name=value` or `--name value` forms.
+func k3sArgValue(k3sArgs []string, name string) (string, bool) {
+	for i, arg := range k3sArgs {
+		if strings.HasPrefix(arg, name+"=") {
+			return strings.TrimPrefix(arg, name+"="), true
+		}
+		if strings.HasPrefix(arg, name+" ") {
+			return strings.TrimSpace(strings.TrimPrefix(arg, name+" ")), true
+		}
+		if arg == name && i+1 < len(k3sArgs) {
+			return k3sArgs[i+1], true
+		}
+	}
+	return "", false
+}
+
+// ProfileRouteManager returns the route manager for the Pod, Service and container networks of the profile.
+// The profile is not required to be the current profile.
+func ProfileRouteManager(ctx context.Context, profile string, conf config.Config) (*RouteManager, error) {
+	if !conf.Kubernetes.Enabled && !conf.Network.ContainerRoutes {
+		return nil, fmt.Errorf("neither kubernetes nor container routes are enabled")
+	}
+	access := podAccess(conf.Network)
+	if !conf.Network.Address && access != AccessWireGuard {
+		return nil, fmt.Errorf("network address is not enabled")
+	}
+
+	// Get VM IP, the address in the tunnel for the wireguard access mode
+	var vmIP string
+	var err error
+	if access == AccessWireGuard {
+		state, err := loadWireGuardState(profile)
+		if err != nil {
+			return nil, err
+		}
+		_, guestIP := state.addresses()
+		vmIP = guestIP.String()
+	} else if vmIP, err = GetVMIP(ctx, profile); err != nil {
+		return nil, fmt.Errorf("error retrieving VM IP: %w", err)
+	}
+
+	var podCIDRs, serviceCIDRs []string
+	if conf.Kubernetes.Enabled {
+		// Get Pod CIDR
+		podCIDRs, err = GetPodCIDR(ctx, profile, conf.Kubernetes)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving Pod CIDR: %w", err)
+		}
+
+		// Get Service CIDR
+		serviceCIDRs, err = GetServiceCIDR(ctx, profile, conf.Kubernetes)
+		if err != nil {
+			log.Warnf("Failed to get Service CIDR for routing: %v", err)
+			serviceCIDRs = nil // Pod routing can proceed without the Service route
 		}
 	}
 
-	// Method 2: Try to get from flannel configmap
-	output, err = guest.RunOutput("kubectl", "get", "configmap", "kube-flannel-cfg", "-n", "kube-system", "-o", "yaml")
-	if err == nil {
-		lines := strings.Split(output, "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "Network") && strings.Contains(line, ":") {
-				parts := strings.Split(line, ":")
-				if len(parts) > 1 {
-					cidr := strings.TrimSpace(parts[1])
-					cidr = strings.Trim(cidr, `"'`)
-					if _, _, err := net.ParseCIDR(cidr); err == nil {
-						return cidr, nil
-					}
-				}
+	rm := NewRouteManager(vmIP, "", podCIDRs, serviceCIDRs, profile)
+	rm.access = access
+	rm.plan = planFromContext(ctx)
+	rm.lbCIDRs = parseCIDRList(conf.Kubernetes.LoadBalancerCIDR())
+
+	if conf.Network.ContainerRoutes {
+		rm.containerCIDRs, err = GetContainerCIDR(ctx, profile, conf.Runtime)
+		if err != nil {
+			log.Warnf("Failed to get container network CIDR for routing: %v", err)
+		}
+	}
+
+	// Get VM IPv6 address, only required for dual-stack clusters.
+	// The tunnel of the wireguard access mode is IPv4 only.
+	for _, cidr := range rm.cidrs() {
+		if access == AccessWireGuard {
+			break
+		}
+		if isIPv6(cidr) {
+			rm.vmIPv6, err = GetVMIPv6(ctx, profile)
+			if err != nil {
+				log.Warnf("Failed to get VM IPv6 address for Pod routing: %v", err)
 			}
+			break
 		}
 	}
 
-	// Fallback to default k3s Pod CIDR
-	log.Debug("Failed to get Pod CIDR from cluster, using default k3s CIDR")
-	return "10.42.0.0/16", nil
+	return rm, nil
+}
+
+// Repair sets up the forwarding in the VM and the host routes,
+// replacing any route pointing to a different gateway.
+func (rm *RouteManager) Repair(ctx context.Context) error {
+	if cidrs := rm.forwardedCIDRs(); len(cidrs) > 0 {
+		if rm.plan != nil {
+			script := guestForwardingScript(cidrs)
+			rm.plan.add(Change{Kind: ChangeForwarding, Action: "add", Target: "vm", Content: script, Command: "colima ssh -- sudo sh"})
+		} else if err := setupGuestForwarding(newGuest(rm.profile), cidrs); err != nil {
+			log.Warnf("Failed to setup forwarding for Pod routing: %v", err)
+		}
+	}
+
+	err := rm.SetupPodRouting(ctx)
+	rm.emit(EventRepair, strings.Join(rm.cidrs(), ","), rm.vmIP, err)
+	return err
 }
 
-// SetupPodRoutingForProfile sets up Pod network routing for a specific profile
-func SetupPodRoutingForProfile(ctx context.Context, conf config.Config) error {
-	// Only setup routing if Kubernetes is enabled and network.address is used
-	if !conf.Kubernetes.Enabled {
+// forwardedCIDRs returns the CIDRs that require forwarding rules in the VM.
+// Linux hosts and the WireGuard tunnel require them for all networks, container
+// networks require them to bypass the forwarding restrictions of the container runtime.
+func (rm *RouteManager) forwardedCIDRs() []string {
+	if util.Linux() || rm.access == AccessWireGuard {
+		return rm.cidrs()
+	}
+	return rm.containerCIDRs
+}
+
+// podAccess returns the pod access mode for the network config.
+// The VM has no IP address reachable from Linux hosts, the routes are via the WireGuard
+// tunnel over the user-mode network instead.
+func podAccess(conf config.Network) string {
+	access := conf.PodAccess
+	if access == "" {
+		access = AccessRoute
+	}
+	if access == AccessRoute && util.Linux() {
+		return AccessWireGuard
+	}
+	return access
+}
+
+// SetupPodRoutingForProfile sets up Pod and Service network routing for a specific profile
+func SetupPodRoutingForProfile(ctx context.Context, profile string, conf config.Config) error {
+	// Only setup routing if Kubernetes or container routes are enabled and network.address is used
+	if !conf.Kubernetes.Enabled && !conf.Network.ContainerRoutes {
 		log.Debug("Kubernetes not enabled, skipping Pod routing setup")
 		return nil
 	}
 
-	if !conf.Network.Address {
+	if !conf.Network.Address && podAccess(conf.Network) != AccessWireGuard {
 		log.Debug("Neither network.address nor network address enabled, skipping Pod routing setup")
 		return nil
 	}
 
-	profile := config.CurrentProfile().ID
+	if podAccess(conf.Network) == AccessOff {
+		log.Debug("Pod access disabled, skipping Pod routing setup")
+		return nil
+	}
 
-	// Get VM IP
-	vmIP, err := GetVMIP(ctx, profile)
+	rm, err := ProfileRouteManager(ctx, profile, conf)
 	if err != nil {
-		log.Warnf("Failed to get VM IP for Pod routing: %v", err)
-		return nil // Don't fail startup for routing issues
+		return err
 	}
 
-	// Get Pod CIDR
-	podCIDR, err := GetPodCIDR(ctx)
+	// avoid sudo prompts for subsequent route changes
+	EnsureHelper(ctx, rm.cidrs()...)
+
+	return repairPodRouting(ctx, rm, profile, conf)
+}
+
+// RepairPodRoutingForProfile sets up the Pod and Service network routing for a specific profile,
+// replacing routes that point to a previous VM IP address.
+func RepairPodRoutingForProfile(ctx context.Context, profile string, conf config.Config) error {
+	rm, err := ProfileRouteManager(ctx, profile, conf)
 	if err != nil {
-		log.Warnf("Failed to get Pod CIDR for routing: %v", err)
-		return nil // Don't fail startup for routing issues
+		return err
+	}
+	return repairPodRouting(ctx, rm, profile, conf)
+}
+
+// repairPodRouting sets up the Pod and Service network routing with the route manager of the profile.
+func repairPodRouting(ctx context.Context, rm *RouteManager, profile string, conf config.Config) error {
+	if err := rm.Repair(ctx); err != nil {
+		return err
+	}
+
+	// re-apply the routes on boot
+	if conf.Network.PersistRoutes && rm.access == AccessRoute {
+		if err := rm.InstallPersistence(host.New()); err != nil {
+			log.Warnf("Failed to persist Pod routing: %v", err)
+		}
 	}
 
-	// Setup routing
-	rm := NewRouteManager(vmIP, podCIDR, profile)
-	return rm.SetupPodRouting(ctx)
+	// resolve the cluster domain from the host
+	if conf.Network.ClusterDNS {
+		if dnsIP, err := GetClusterDNSIP(ctx, profile); err != nil {
+			log.Warnf("Failed to get cluster DNS IP address: %v", err)
+		} else if err := rm.SetupClusterDNS(host.New(), dnsIP); err != nil {
+			log.Warnf("Failed to setup cluster DNS: %v", err)
+		}
+	}
+
+	return nil
 }
 
-// CleanupPodRoutingForProfile cleans up Pod network routing for a specific profile
-func CleanupPodRoutingForProfile(ctx context.Context, conf config.Config) error {
-	// Only cleanup routing if Kubernetes was enabled
-	if !conf.Kubernetes.Enabled {
+// CleanupPodRoutingForProfile cleans up Pod and Service network routing for a specific profile
+func CleanupPodRoutingForProfile(ctx context.Context, profile string, conf config.Config) error {
+	// Only cleanup routing if Kubernetes or container routes were enabled
+	if !conf.Kubernetes.Enabled && !conf.Network.ContainerRoutes {
 		log.Debug("Kubernetes not enabled, skipping Pod routing cleanup")
 		return nil
 	}
 
-	profile := config.CurrentProfile().ID
+	var podCIDRs, serviceCIDRs []string
+	if conf.Kubernetes.Enabled {
+		// Get Pod CIDR (we don't need VM IP for cleanup)
+		var err error
+		podCIDRs, err = GetPodCIDR(ctx, profile, conf.Kubernetes)
+		if err != nil {
+			log.Warnf("Failed to get Pod CIDR for routing cleanup: %v", err)
+			// Try with default CIDR
+			podCIDRs = []string{DefaultPodCIDR}
+		}
 
-	// Get Pod CIDR (we don't need VM IP for cleanup)
-	podCIDR, err := GetPodCIDR(ctx)
-	if err != nil {
-		log.Warnf("Failed to get Pod CIDR for routing cleanup: %v", err)
-		// Try with default CIDR
-		podCIDR = "10.42.0.0/16"
+		// Get Service CIDR
+		serviceCIDRs, err = GetServiceCIDR(ctx, profile, conf.Kubernetes)
+		if err != nil {
+			log.Warnf("Failed to get Service CIDR for routing cleanup: %v", err)
+			// Try with default CIDR
+			serviceCIDRs = []string{DefaultServiceCIDR}
+		}
 	}
 
 	// Cleanup routing
-	rm := NewRouteManager("", podCIDR, profile)
+	rm := NewRouteManager("", "", podCIDRs, serviceCIDRs, profile)
+	rm.access = podAccess(conf.Network)
+	rm.lbCIDRs = parseCIDRList(conf.Kubernetes.LoadBalancerCIDR())
+
+	if conf.Network.ContainerRoutes {
+		var err error
+		rm.containerCIDRs, err = GetContainerCIDR(ctx, profile, conf.Runtime)
+		if err != nil {
+			log.Warnf("Failed to get container network CIDR for routing cleanup: %v", err)
+		}
+	}
+
+	if cidrs := rm.forwardedCIDRs(); len(cidrs) > 0 {
+		if guest := newGuest(profile); guest.Running(ctx) {
+			if err := cleanupGuestForwarding(guest, cidrs); err != nil {
+				log.Warnf("Failed to cleanup forwarding for Pod routing: %v", err)
+			}
+		}
+	}
+
+	if err := rm.UninstallPersistence(host.New()); err != nil {
+		log.Warnf("Failed to remove persisted Pod routing: %v", err)
+	}
+
+	if err := rm.CleanupClusterDNS(host.New()); err != nil {
+		log.Warnf("Failed to cleanup cluster DNS: %v", err)
+	}
+
 	return rm.CleanupPodRouting(ctx)
 }
@@ -0,0 +1,812 @@
+package routing
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+)
+
+func Test_RouteManager_gateway(t *testing.T) {
+	rm := NewRouteManager("192.168.106.2", "fd00::2", nil, nil, "colima")
+	tests := []struct {
+		cidr string
+		want string
+	}{
+		{cidr: "10.42.0.0/16", want: "192.168.106.2"},
+		{cidr: "2001:cafe:42::/56", want: "fd00::2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			if got := rm.gateway(tt.cidr); got != tt.want {
+				t.Errorf("gateway() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_podAccess(t *testing.T) {
+	// the VM has no IP address reachable from Linux hosts
+	route := AccessRoute
+	if runtime.GOOS == "linux" {
+		route = AccessWireGuard
+	}
+
+	tests := []struct {
+		access string
+		want   string
+	}{
+		{access: "", want: route},
+		{access: AccessRoute, want: route},
+		{access: AccessWireGuard, want: AccessWireGuard},
+		{access: AccessOff, want: AccessOff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.access, func(t *testing.T) {
+			if got := podAccess(config.Network{PodAccess: tt.access}); got != tt.want {
+				t.Errorf("podAccess() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_reachableIP(t *testing.T) {
+	addresses := map[string]string{
+		"eth0": "192.168.5.15",
+		"col0": "192.168.106.2",
+		"col1": "192.168.1.20",
+	}
+	address := func(iface string) string { return addresses[iface] }
+
+	tests := []struct {
+		name       string
+		interfaces []string
+		want       string
+		wantErr    bool
+	}{
+		{name: "network address", interfaces: []string{"eth0", "col1", "col0"}, want: "192.168.106.2"},
+		{name: "additional network", interfaces: []string{"eth0", "col1"}, want: "192.168.1.20"},
+		{name: "user-mode network only", interfaces: []string{"eth0"}, wantErr: true},
+		{name: "no network", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reachableIP(tt.interfaces, address)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("reachableIP() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("reachableIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_RouteManager_persistScript(t *testing.T) {
+	rm := NewRouteManager("192.168.106.2", "", []string{"10.42.0.0/16", "2001:cafe:42::/56"}, nil, "colima")
+	want := "(/sbin/route -n get 10.42.0.0/16 2>/dev/null | grep -q 'gateway: 192.168.106.2$' || " +
+		"/sbin/route -n change 10.42.0.0/16 192.168.106.2 >/dev/null 2>&1 || /sbin/route -n add 10.42.0.0/16 192.168.106.2)"
+	if got := rm.persistScript(); got != want {
+		t.Errorf("persistScript() = %v, want %v", got, want)
+	}
+}
+
+// fakeBackend is an in-memory route backend.
+type fakeBackend map[string]Route
+
+func (f fakeBackend) Get(dst *net.IPNet) (Route, error) {
+	if r, ok := f[dst.String()]; ok {
+		return r, nil
+	}
+	return Route{}, ErrRouteNotFound
+}
+
+func (f fakeBackend) Add(_ context.Context, r Route) error {
+	f[r.Destination.String()] = r
+	return nil
+}
+
+func (f fakeBackend) List() ([]Route, error) {
+	var routes []Route
+	for _, r := range f {
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+func (f fakeBackend) Delete(_ context.Context, dst *net.IPNet) error {
+	if _, ok := f[dst.String()]; !ok {
+		return ErrRouteNotFound
+	}
+	delete(f, dst.String())
+	return nil
+}
+
+func Test_RouteManager_backend(t *testing.T) {
+	if !supported() {
+		t.Skip("routing not supported")
+	}
+
+	backend := fakeBackend{}
+	stale, _ := parseRoute("10.43.0.0/16", "192.168.106.9")
+	backend[stale.Destination.String()] = stale
+
+	rm := NewRouteManager("192.168.106.2", "", []string{"10.42.0.0/16"}, []string{"10.43.0.0/16"}, "colima")
+	rm.backend = backend
+	rm.registry = filepath.Join(t.TempDir(), "routes.json")
+	rm.eventLog = filepath.Join(t.TempDir(), "daemon.log")
+
+	if err := rm.SetupPodRouting(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, cidr := range []string{"10.42.0.0/16", "10.43.0.0/16"} {
+		if got := backend[cidr].Gateway.String(); got != "192.168.106.2" {
+			t.Errorf("gateway for %s = %v, want %v", cidr, got, "192.168.106.2")
+		}
+	}
+
+	// structured events
+	b, err := os.ReadFile(rm.eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var event map[string]any
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 2 || events[0]["event"] != EventRouteAdded || events[0]["cidr"] != "10.42.0.0/16" ||
+		events[0]["gateway"] != "192.168.106.2" || events[0]["profile"] != "colima" {
+		t.Errorf("events = %v", events)
+	}
+
+	if err := rm.CleanupPodRouting(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend) != 0 {
+		t.Errorf("routes not cleaned up: %v", backend)
+	}
+}
+
+func Test_RouteManager_Status(t *testing.T) {
+	backend := fakeBackend{}
+	active, _ := parseRoute("10.42.0.0/16", "192.168.106.2")
+	stale, _ := parseRoute("10.43.0.0/16", "192.168.106.9")
+	backend[active.Destination.String()] = active
+	backend[stale.Destination.String()] = stale
+
+	rm := NewRouteManager("192.168.106.2", "", []string{"10.42.0.0/16", "2001:cafe:42::/56"}, []string{"10.43.0.0/16"}, "colima")
+	rm.containerCIDRs = []string{"172.17.0.0/16"}
+	rm.lbCIDRs = []string{"10.44.0.0/24"}
+	rm.backend = backend
+
+	got, err := rm.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RouteStatus{
+		{Network: "pod", CIDR: "10.42.0.0/16", Gateway: "192.168.106.2", Current: "192.168.106.2", Status: RouteActive},
+		{Network: "pod", CIDR: "2001:cafe:42::/56", Status: RouteMissing},
+		{Network: "service", CIDR: "10.43.0.0/16", Gateway: "192.168.106.2", Current: "192.168.106.9", Status: RouteStale},
+		{Network: "container", CIDR: "172.17.0.0/16", Gateway: "192.168.106.2", Status: RouteMissing},
+		{Network: "loadbalancer", CIDR: "10.44.0.0/24", Gateway: "192.168.106.2", Status: RouteMissing},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Status() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_mergeCIDRs(t *testing.T) {
+	tests := []struct {
+		cidrs []string
+		want  []string
+	}{
+		{cidrs: []string{"10.42.0.0/16", "10.42.0.0/24"}, want: []string{"10.42.0.0/16"}},
+		{cidrs: []string{"10.42.0.0/24", "10.42.0.0/16", "10.42.0.0/16"}, want: []string{"10.42.0.0/16"}},
+		{cidrs: []string{"10.42.0.0/16", "192.168.0.0/16", "2001:cafe:42::/56", "2001:cafe:42::/64"}, want: []string{"10.42.0.0/16", "192.168.0.0/16", "2001:cafe:42::/56"}},
+		{cidrs: []string{"invalid"}, want: nil},
+	}
+	for i, tt := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if got := mergeCIDRs(tt.cidrs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeCIDRs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_RouteManager_register(t *testing.T) {
+	running := runningProfiles
+	defer func() { runningProfiles = running }()
+	runningProfiles = func() map[string]bool { return map[string]bool{"colima": true, "colima-dev": true} }
+
+	file := filepath.Join(t.TempDir(), "routes.json")
+
+	rm := NewRouteManager("192.168.106.2", "", []string{"10.42.0.0/16"}, []string{"10.43.0.0/16"}, "colima")
+	rm.registry = file
+	if err := rm.register(); err != nil {
+		t.Fatal(err)
+	}
+
+	// overlapping networks of another running profile
+	dev := NewRouteManager("192.168.106.3", "", []string{"10.42.0.0/24"}, []string{"10.45.0.0/16"}, "colima-dev")
+	dev.registry = file
+	err := dev.register()
+	if err == nil {
+		t.Fatal("expected conflict error")
+	}
+	if want := "kubernetes.podCIDR: 10.44.0.0/16 and kubernetes.serviceCIDR: 10.46.0.0/16"; !strings.Contains(err.Error(), want) {
+		t.Errorf("register() error = %v, want suggestion %v", err, want)
+	}
+
+	// routes of stopped profiles are ignored
+	runningProfiles = func() map[string]bool { return map[string]bool{"colima-dev": true} }
+	if err := dev.register(); err != nil {
+		t.Fatal(err)
+	}
+
+	// unregistered routes do not conflict
+	runningProfiles = func() map[string]bool { return map[string]bool{"colima": true, "colima-dev": true} }
+	if err := dev.unregister(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rm.register(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_prune(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "routes.json")
+	r := registry{
+		"colima":     {{CIDR: "10.42.0.0/16", Gateway: "192.168.106.2"}, {CIDR: "10.43.0.0/16", Gateway: "192.168.106.2"}},
+		"colima-dev": {{CIDR: "10.44.0.0/16", Gateway: "192.168.106.3"}, {CIDR: "10.45.0.0/16", Gateway: "192.168.106.3"}, {CIDR: "10.46.0.0/16", Gateway: "192.168.106.3"}},
+		"colima-ci":  {{CIDR: "10.46.0.0/16", Gateway: "192.168.106.3"}},
+		"colima-pf":  {{CIDR: "10.47.0.0/16", Gateway: "192.168.106.4", PF: true}, {CIDR: "10.48.0.0/16", Gateway: "192.168.106.4", PF: true}},
+	}
+	if err := r.save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := fakeBackend{}
+	for _, route := range [][2]string{
+		{"10.42.0.0/16", "192.168.106.2"},
+		{"10.44.0.0/16", "192.168.106.3"},
+		{"10.45.0.0/16", "192.168.106.9"}, // replaced since
+		{"10.46.0.0/16", "192.168.106.3"}, // in use by running profile
+	} {
+		rt, _ := parseRoute(route[0], route[1])
+		backend[rt.Destination.String()] = rt
+	}
+
+	var flushed []string
+	flushPF := func(_ context.Context, profile string) error {
+		flushed = append(flushed, profile)
+		return nil
+	}
+
+	pruned, profiles, err := prune(context.Background(), backend, flushPF, file, map[string]bool{"colima": true, "colima-ci": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"colima-dev", "colima-pf"}; !reflect.DeepEqual(profiles, want) {
+		t.Errorf("prune() profiles = %v, want %v", profiles, want)
+	}
+	if want := []string{"colima-pf"}; !reflect.DeepEqual(flushed, want) {
+		t.Errorf("prune() flushed pf rules of %v, want %v", flushed, want)
+	}
+	want := []PrunedRoute{
+		{Profile: "colima-dev", CIDR: "10.44.0.0/16", Gateway: "192.168.106.3", Removed: true},
+		{Profile: "colima-dev", CIDR: "10.45.0.0/16", Gateway: "192.168.106.3"},
+		{Profile: "colima-dev", CIDR: "10.46.0.0/16", Gateway: "192.168.106.3"},
+		{Profile: "colima-pf", CIDR: "10.47.0.0/16", Gateway: "192.168.106.4", Removed: true},
+		{Profile: "colima-pf", CIDR: "10.48.0.0/16", Gateway: "192.168.106.4", Removed: true},
+	}
+	if !reflect.DeepEqual(pruned, want) {
+		t.Errorf("prune() = %+v, want %+v", pruned, want)
+	}
+
+	for _, cidr := range []string{"10.42.0.0/16", "10.45.0.0/16", "10.46.0.0/16"} {
+		if _, ok := backend[cidr]; !ok {
+			t.Errorf("route %s should not be removed", cidr)
+		}
+	}
+	if _, ok := backend["10.44.0.0/16"]; ok {
+		t.Errorf("route %s not removed", "10.44.0.0/16")
+	}
+
+	r, err = loadRegistry(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r["colima-dev"]; ok || len(r) != 2 {
+		t.Errorf("registry not pruned: %v", r)
+	}
+}
+
+func Test_RouteManager_pfRules(t *testing.T) {
+	rm := NewRouteManager("192.168.106.2", "fd00::2", []string{"10.42.0.0/16", "2001:cafe:42::/56"}, []string{"10.43.0.0/16"}, "colima")
+	iface := func(net.IP) (string, error) { return "bridge100", nil }
+
+	got, err := rm.pfRules(iface)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `nat on bridge100 inet from any to 10.42.0.0/16 -> (bridge100)
+nat on bridge100 inet6 from any to 2001:cafe:42::/56 -> (bridge100)
+nat on bridge100 inet from any to 10.43.0.0/16 -> (bridge100)
+pass out quick route-to (bridge100 192.168.106.2) inet from any to 10.42.0.0/16 keep state
+pass out quick route-to (bridge100 fd00::2) inet6 from any to 2001:cafe:42::/56 keep state
+pass out quick route-to (bridge100 192.168.106.2) inet from any to 10.43.0.0/16 keep state
+`
+	if got != want {
+		t.Errorf("pfRules() = %v, want %v", got, want)
+	}
+
+	// pfctl output
+	output := `pass out quick route-to (bridge100 192.168.106.2) inet from any to 10.42.0.0/16 flags S/SA keep state
+pass out quick route-to (bridge100 192.168.106.9) inet from any to 10.43.0.0/16 flags S/SA keep state
+`
+	routes := parsePFRoutes(output)
+	if len(routes) != 2 || routes["10.43.0.0/16"].Gateway.String() != "192.168.106.9" {
+		t.Errorf("parsePFRoutes() = %v", routes)
+	}
+}
+
+func Test_kubeAPI_clusterNetworks(t *testing.T) {
+	resources := map[string]string{
+		"/api/v1/nodes": `{"items": [{
+			"metadata": {"annotations": {"k3s.io/node-args": "[\"server\",\"--cluster-cidr\",\"10.42.0.0/16,2001:cafe:42::/56\",\"--service-cidr=10.43.0.0/16\"]"}},
+			"spec": {"podCIDR": "10.42.0.0/24", "podCIDRs": ["10.42.0.0/24", "2001:cafe:42::/64"]}
+		}]}`,
+		"/apis/crd.projectcalico.org/v1/ippools":                     `{"items": [{"spec": {"cidr": "192.168.0.0/16"}}]}`,
+		"/api/v1/namespaces/kube-system/configmaps/kube-flannel-cfg": `{"data": {"net-conf.json": "{\"Network\": \"10.42.0.0/16\", \"IPv6Network\": \"2001:cafe:42::/56\"}"}}`,
+		"/apis/networking.k8s.io/v1/servicecidrs":                    `{"items": [{"spec": {"cidrs": ["10.43.0.0/16", "2001:cafe:43::/112"]}}]}`,
+	}
+	api := kubeAPI{request: func(path string) (int, []byte, error) {
+		if out, ok := resources[path]; ok {
+			return http.StatusOK, []byte(out), nil
+		}
+		return http.StatusNotFound, []byte(`{"kind": "Status", "reason": "NotFound"}`), nil
+	}}
+
+	got, err := api.clusterNetworks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ClusterNetworks{
+		PodCIDRs:     []string{"10.42.0.0/16", "2001:cafe:42::/56", "192.168.0.0/16"},
+		ServiceCIDRs: []string{"10.43.0.0/16", "2001:cafe:43::/112"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("clusterNetworks() = %+v, want %+v", got, want)
+	}
+
+	// unreachable cluster
+	api.request = func(string) (int, []byte, error) { return 0, nil, errors.New("connection refused") }
+	if _, err := api.clusterNetworks(); !errors.Is(err, ErrClusterUnreachable) {
+		t.Errorf("clusterNetworks() error = %v, want %v", err, ErrClusterUnreachable)
+	}
+}
+
+func Test_kubeAPIFromConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/v1/namespaces/kube-system/services/kube-dns" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"spec": {"clusterIP": "10.43.0.10"}}`))
+	}))
+	defer server.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: other
+  cluster: {server: "https://127.0.0.1:1"}
+- name: colima
+  cluster: {server: %q, certificate-authority-data: %s}
+contexts:
+- name: other
+  context: {cluster: other, user: other}
+- name: colima
+  context: {cluster: colima, user: colima}
+users:
+- name: other
+  user: {token: other}
+- name: colima
+  user: {token: secret}
+`, server.URL, base64.StdEncoding.EncodeToString(ca))
+
+	api, err := kubeAPIFromConfig([]byte(kubeconfig), "colima")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var service kubeService
+	if err := api.get("/api/v1/namespaces/kube-system/services/kube-dns", &service); err != nil {
+		t.Fatal(err)
+	}
+	if got := service.Spec.ClusterIP; got != "10.43.0.10" {
+		t.Errorf("get() clusterIP = %v, want %v", got, "10.43.0.10")
+	}
+	if err := api.get("/api/v1/namespaces/kube-system/configmaps/cilium-config", &kubeConfigMap{}); !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("get() error = %v, want %v", err, ErrResourceNotFound)
+	}
+
+	if _, err := kubeAPIFromConfig([]byte(kubeconfig), "missing"); !errors.Is(err, ErrClusterUnreachable) {
+		t.Errorf("kubeAPIFromConfig() error = %v, want %v", err, ErrClusterUnreachable)
+	}
+}
+
+func Test_kubeAPI_loadBalancerPorts(t *testing.T) {
+	api := kubeAPI{request: func(string) (int, []byte, error) {
+		return http.StatusOK, []byte(`{"items": [
+			{"spec": {"type": "ClusterIP", "ports": [{"port": 53, "protocol": "UDP"}]}},
+			{"spec": {"type": "LoadBalancer", "ports": [{"port": 443, "protocol": "TCP"}, {"port": 80, "protocol": "TCP"}, {"port": 5353, "protocol": "UDP"}]},
+			 "status": {"loadBalancer": {"ingress": [{"ip": "192.168.5.15"}, {"ip": "fd00::15"}]}}},
+			{"spec": {"type": "LoadBalancer", "ports": [{"port": 8080}]}, "status": {"loadBalancer": {}}}
+		]}`), nil
+	}}
+
+	got, err := api.loadBalancerPorts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LoadBalancerPort{{IP: "192.168.5.15", Port: 80}, {IP: "192.168.5.15", Port: 443}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadBalancerPorts() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_RouteManager_plan(t *testing.T) {
+	if !supported() {
+		t.Skip("routing not supported")
+	}
+
+	backend := fakeBackend{}
+	active, _ := parseRoute("10.42.0.0/16", "192.168.106.2")
+	backend[active.Destination.String()] = active
+
+	plan := &Plan{}
+	rm := NewRouteManager("192.168.106.2", "", []string{"10.42.0.0/16"}, []string{"10.43.0.0/16"}, "colima")
+	rm.backend = backend
+	rm.registry = filepath.Join(t.TempDir(), "routes.json")
+	rm.plan = plan
+
+	if err := rm.SetupPodRouting(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend) != 1 {
+		t.Errorf("routes modified in dry-run: %v", backend)
+	}
+	if r, err := loadRegistry(rm.registry); err != nil || len(r) != 0 {
+		t.Errorf("registry modified in dry-run: %v, %v", r, err)
+	}
+
+	route, _ := parseRoute("10.43.0.0/16", "192.168.106.2")
+	want := []Change{{Kind: ChangeRoute, Action: "add", Target: "10.43.0.0/16 -> 192.168.106.2", Command: sudoCommand(routeAddArgs(route, false)...)}}
+	if !reflect.DeepEqual(plan.Changes, want) {
+		t.Errorf("plan = %+v, want %+v", plan.Changes, want)
+	}
+	if script := plan.Script(); !strings.Contains(script, "# route: add 10.43.0.0/16 -> 192.168.106.2\nsudo ") {
+		t.Errorf("Script() = %v", script)
+	}
+}
+
+func Test_RouteManager_checkHostNetworks(t *testing.T) {
+	rm := NewRouteManager("192.168.106.2", "", []string{"10.42.0.0/16"}, []string{"10.43.0.0/16"}, "colima")
+	rm.registry = filepath.Join(t.TempDir(), "routes.json")
+
+	route := func(cidr, gateway, iface string) Route {
+		r, _ := parseRoute(cidr, gateway)
+		r.Interface = iface
+		return r
+	}
+
+	// replaced and non-overlapping routes
+	routes := []Route{
+		route("10.42.0.0/16", "192.168.106.9", "bridge100"),
+		route("192.168.106.0/24", "", "bridge100"),
+		route("127.0.0.0/8", "", "lo0"),
+	}
+	if err := rm.checkHostNetworks(routes); err != nil {
+		t.Fatal(err)
+	}
+
+	// VPN route
+	routes = append(routes, route("10.40.0.0/13", "", "utun3"))
+	err := rm.checkHostNetworks(routes)
+	if err == nil {
+		t.Fatal("expected conflict error")
+	}
+	for _, want := range []string{
+		"10.42.0.0/16 overlaps with host network 10.40.0.0/13 (via utun3)",
+		"10.43.0.0/16 overlaps with host network 10.40.0.0/13 (via utun3)",
+		"kubernetes.podCIDR: 10.48.0.0/16 and kubernetes.serviceCIDR: 10.49.0.0/16",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("checkHostNetworks() error = %v, want %v", err, want)
+		}
+	}
+
+	// routes of other profiles are handled by the registry
+	r := registry{"colima-dev": {{CIDR: "10.40.0.0/13", Gateway: "192.168.106.3"}}}
+	if err := r.save(rm.registry); err != nil {
+		t.Fatal(err)
+	}
+	routes[len(routes)-1] = route("10.40.0.0/13", "192.168.106.3", "bridge100")
+	if err := rm.checkHostNetworks(routes); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_wireGuardNetwork(t *testing.T) {
+	n := wireGuardNetwork("colima", nil)
+	if got := wireGuardNetwork("colima", nil); got != n {
+		t.Errorf("wireGuardNetwork() not deterministic: %d, want %d", got, n)
+	}
+	// the next network is allocated on collision
+	if got, want := wireGuardNetwork("colima", map[int]bool{n: true}), (n+1)%wireGuardNetworks; got != want {
+		t.Errorf("wireGuardNetwork() = %d on collision, want %d", got, want)
+	}
+
+	host, guest := wireGuardState{Network: n}.addresses()
+	_, tunnel, _ := net.ParseCIDR("10.254.0.0/16")
+	if !tunnel.Contains(host) || !tunnel.Contains(guest) {
+		t.Errorf("addresses() = %v %v, want addresses in %v", host, guest, tunnel)
+	}
+	if host.To4()[3]%4 != 1 || guest.To4()[3] != host.To4()[3]+1 {
+		t.Errorf("addresses() = %v %v, want consecutive host addresses of a /30", host, guest)
+	}
+}
+
+func Test_wireGuardTunnel_config(t *testing.T) {
+	hostKey, _ := wireGuardKey()
+	guestKey, _ := wireGuardKey()
+	tun, err := newWireGuardTunnel("colima", wireGuardState{HostKey: hostKey, GuestKey: guestKey, Network: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tun.allowedIPs = []string{"10.42.0.0/16", "10.43.0.0/16"}
+
+	host := tun.hostConfig()
+	for _, want := range []string{
+		"PrivateKey = " + hostKey,
+		"PublicKey = " + tun.guestPub,
+		"AllowedIPs = 10.254.0.6/32, 10.42.0.0/16, 10.43.0.0/16",
+	} {
+		if !strings.Contains(host, want) {
+			t.Errorf("hostConfig() = %q, missing %q", host, want)
+		}
+	}
+	if strings.Contains(host, "ListenPort") {
+		t.Errorf("hostConfig() = %q, want the listen port chosen by WireGuard", host)
+	}
+
+	tun.port = 51820
+	guest := tun.guestConfig()
+	for _, want := range []string{
+		"PrivateKey = " + guestKey,
+		"PublicKey = " + tun.hostPub,
+		"Endpoint = host.lima.internal:51820",
+		"AllowedIPs = 10.254.0.5/32",
+		"PersistentKeepalive = 25",
+	} {
+		if !strings.Contains(guest, want) {
+			t.Errorf("guestConfig() = %q, missing %q", guest, want)
+		}
+	}
+}
+
+func Test_wireGuardTunnel_scripts(t *testing.T) {
+	hostKey, _ := wireGuardKey()
+	guestKey, _ := wireGuardKey()
+	tun, err := newWireGuardTunnel("colima", wireGuardState{HostKey: hostKey, GuestKey: guestKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if script := tun.hostScript(); !strings.HasSuffix(script, "wg show \"$iface\" listen-port\n") {
+		t.Errorf("hostScript() = %q, want the listen port printed", script)
+	}
+	for name, script := range map[string]string{"host": tun.hostScript(), "guest": tun.guestScript(), "guest up": tun.guestUpScript()} {
+		if err := exec.Command("sh", "-n", "-c", script).Run(); err != nil {
+			t.Errorf("%s script is not a valid shell script: %v", name, err)
+		}
+	}
+}
+
+func Test_replaceHostsBlock(t *testing.T) {
+	content := "127.0.0.1 localhost\n# BEGIN colima colima\n192.168.106.2 old.test\n# END colima colima\n# BEGIN colima colima-dev\n192.168.106.3 dev.test\n# END colima colima-dev\n"
+
+	entries := hostsEntries("192.168.106.4", []string{"myapp.test", "MyApp.test", "*.wildcard.test", "api.test"})
+	if want := "192.168.106.4 api.test\n192.168.106.4 myapp.test"; entries != want {
+		t.Errorf("hostsEntries() = %q, want %q", entries, want)
+	}
+
+	got := replaceHostsBlock(content, "colima", entries)
+	want := "127.0.0.1 localhost\n# BEGIN colima colima-dev\n192.168.106.3 dev.test\n# END colima colima-dev\n# BEGIN colima colima\n" + entries + "\n# END colima colima\n"
+	if got != want {
+		t.Errorf("replaceHostsBlock() = %q, want %q", got, want)
+	}
+	if profiles := hostsProfiles(got); !slices.Equal(profiles, []string{"colima-dev", "colima"}) {
+		t.Errorf("hostsProfiles() = %v", profiles)
+	}
+
+	// removal
+	got = replaceHostsBlock(got, "colima-dev", "")
+	want = "127.0.0.1 localhost\n# BEGIN colima colima\n" + entries + "\n# END colima colima\n"
+	if got != want {
+		t.Errorf("replaceHostsBlock() = %q, want %q", got, want)
+	}
+}
+
+func Test_parseContainerHosts(t *testing.T) {
+	output := "colima.hostname=web.test,com.docker.compose.project=app\n" +
+		"maintainer=nobody,colima.hostname=api.test\n" +
+		"colima.hostname=web.test\n" +
+		"colima.hostname=invalid_host\n"
+	if got, want := parseContainerHosts(output), []string{"api.test", "web.test"}; !slices.Equal(got, want) {
+		t.Errorf("parseContainerHosts() = %v, want %v", got, want)
+	}
+}
+
+func Test_peerRoutes(t *testing.T) {
+	a := peer{profile: "colima", ip: "192.168.104.2", cidrs: []string{"172.17.0.0/16", "10.42.0.0/16", "fd00:42::/56"}}
+	b := peer{profile: "colima-dev", ip: "192.168.104.3", cidrs: []string{"172.17.0.0/16", "172.20.0.0/16", "10.52.0.0/16", "fd00:52::/56"}}
+
+	routes, skipped := peerRoutes(a, b)
+	if want := []string{"172.20.0.0/16", "10.52.0.0/16"}; !slices.Equal(routes, want) {
+		t.Errorf("peerRoutes() routes = %v, want %v", routes, want)
+	}
+	if want := []string{"172.17.0.0/16"}; !slices.Equal(skipped, want) {
+		t.Errorf("peerRoutes() skipped = %v, want %v", skipped, want)
+	}
+
+	script := peerRoutesScript(routes, b.ip)
+	if want := "ip route replace 172.20.0.0/16 via 192.168.104.3\nip route replace 10.52.0.0/16 via 192.168.104.3"; script != want {
+		t.Errorf("peerRoutesScript() = %q, want %q", script, want)
+	}
+}
+
+func Test_mtuFinding(t *testing.T) {
+	tests := []struct {
+		name          string
+		configured    int
+		full, minimum bool
+		want          string
+	}{
+		{name: "ok", full: true, minimum: true, want: FindingOK},
+		{name: "path MTU lower", minimum: true, want: FindingWarning},
+		{name: "no ICMP", want: FindingSkipped},
+		{name: "not applied", configured: 1400, full: true, minimum: true, want: FindingWarning},
+		{name: "applied", configured: 1500, full: true, minimum: true, want: FindingOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := mtuFinding(1500, tt.configured, tt.full, tt.minimum)
+			if f.Status != tt.want {
+				t.Errorf("mtuFinding() status = %s, want %s (%s)", f.Status, tt.want, f.Detail)
+			}
+			if f.Status == FindingWarning && f.Hint == "" {
+				t.Errorf("mtuFinding() warning without hint")
+			}
+		})
+	}
+}
+
+func Test_federationKubeconfig(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    certificate-authority-data: Y2E=
+    server: https://127.0.0.1:52436
+  name: default
+contexts:
+- context:
+    cluster: default
+    user: default
+  name: default
+current-context: default
+users:
+- name: default
+  user:
+    client-certificate-data: Y2VydA==
+    client-key-data: a2V5
+`
+	b, err := federationKubeconfig([]byte(kubeconfig), "colima-dev", "192.168.104.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"server: https://192.168.104.3:52436",
+		"tls-server-name: kubernetes",
+		"certificate-authority-data: Y2E=",
+		"client-key-data: a2V5",
+		"current-context: colima-dev",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("federationKubeconfig() = %s, want %q", b, want)
+		}
+	}
+	if strings.Contains(string(b), "default") {
+		t.Errorf("federationKubeconfig() = %s, want no default names", b)
+	}
+
+	if _, err := federationKubeconfig([]byte("clusters: []"), "colima-dev", "192.168.104.3"); err == nil {
+		t.Error("federationKubeconfig() expected error for kubeconfig without cluster")
+	}
+}
+
+func Test_helperNetworks(t *testing.T) {
+	tests := []struct {
+		name     string
+		recorded string
+		networks []string
+		want     string
+	}{
+		{name: "none", want: ""},
+		{name: "new", networks: []string{"10.43.0.0/16", "10.42.0.0/16"}, want: "10.42.0.0/16\n10.43.0.0/16\n"},
+		{name: "merged", recorded: "10.42.0.0/16\n", networks: []string{"10.42.0.0/16", "", "10.96.0.0/12"}, want: "10.42.0.0/16\n10.96.0.0/12\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := helperNetworks(tt.recorded, tt.networks); got != tt.want {
+				t.Errorf("helperNetworks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_prune_dryRun(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "routes.json")
+	r := registry{"colima-dev": {{CIDR: "10.44.0.0/16", Gateway: "192.168.106.3"}}}
+	if err := r.save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	rt, _ := parseRoute("10.44.0.0/16", "192.168.106.3")
+	fake := fakeBackend{rt.Destination.String(): rt}
+	plan := &Plan{}
+	ctx := WithDryRun(context.Background(), plan)
+	flushPF := func(context.Context, string) error { return nil }
+
+	if _, _, err := prune(ctx, planBackend{RouteBackend: fake, plan: plan}, flushPF, file, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0].Action != "delete" || plan.Changes[0].Target != "10.44.0.0/16" {
+		t.Errorf("prune() plan = %+v, want the route deletion", plan.Changes)
+	}
+	if _, ok := fake["10.44.0.0/16"]; !ok {
+		t.Errorf("route %s removed on dry-run", "10.44.0.0/16")
+	}
+	if r, err := loadRegistry(file); err != nil || len(r) != 1 {
+		t.Errorf("prune() registry = %v, want unchanged on dry-run", r)
+	}
+}
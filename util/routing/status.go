@@ -0,0 +1,83 @@
+package routing
+
+import (
+	"context"
+	"errors"
+)
+
+// Route status values.
+const (
+	RouteActive  = "active"
+	RouteMissing = "missing"
+	RouteStale   = "stale"
+)
+
+// RouteStatus is the status of a host route for a Pod or Service network.
+type RouteStatus struct {
+	Network string `json:"network"`
+	CIDR    string `json:"cidr"`
+	Gateway string `json:"gateway"`
+	Current string `json:"current,omitempty"`
+	Status  string `json:"status"`
+}
+
+// Status returns the status of the host routes managed by the route manager.
+// A route is stale if it points to a gateway other than the VM.
+// The routes in the pf rules are reported for the pf access mode.
+func (rm *RouteManager) Status(ctx context.Context) ([]RouteStatus, error) {
+	var statuses []RouteStatus
+
+	get := rm.backend.Get
+	if rm.access == AccessPF {
+		routes, err := rm.pfRoutes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		get = routes.Get
+	}
+
+	add := func(network string, cidrs []string) error {
+		for _, cidr := range cidrs {
+			if cidr == "" {
+				continue
+			}
+			s := RouteStatus{Network: network, CIDR: cidr, Gateway: rm.gateway(cidr), Status: RouteMissing}
+
+			r, err := parseRoute(cidr, s.Gateway)
+			if err != nil {
+				return err
+			}
+			current, err := get(r.Destination)
+			if err != nil && !errors.Is(err, ErrRouteNotFound) {
+				return err
+			}
+			if err == nil {
+				s.Status = RouteStale
+				if current.Gateway != nil {
+					s.Current = current.Gateway.String()
+				}
+				if current.Gateway.Equal(r.Gateway) {
+					s.Status = RouteActive
+				}
+			}
+
+			statuses = append(statuses, s)
+		}
+		return nil
+	}
+
+	if err := add("pod", rm.podCIDRs); err != nil {
+		return nil, err
+	}
+	if err := add("service", rm.serviceCIDRs); err != nil {
+		return nil, err
+	}
+	if err := add("container", rm.containerCIDRs); err != nil {
+		return nil, err
+	}
+	if err := add("loadbalancer", rm.lbCIDRs); err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,403 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/util"
+	"github.com/abiosoft/colima/util/pkgutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// wireGuardGuestInterface is the WireGuard network interface in the VM.
+const wireGuardGuestInterface = "colima-wg"
+
+// wireGuardEndpoint is the host address as seen from the VM via the user-v2 network.
+// It is independent of the reachable VM IP address.
+const wireGuardEndpoint = "host.lima.internal"
+
+// wireGuardKeepalive is the keepalive interval in seconds of the VM, keeping the
+// tunnel open and the VM endpoint known to the host.
+const wireGuardKeepalive = 25
+
+// wireGuardNetworks is the number of /30 networks of the tunnels in 10.254.0.0/16.
+const wireGuardNetworks = 1 << 14
+
+// wireGuardState is the persisted state of the WireGuard tunnel of a profile, keeping the
+// keys and the tunnel addresses stable across restarts and repairs.
+type wireGuardState struct {
+	HostKey    string   `json:"hostKey"`
+	GuestKey   string   `json:"guestKey"`
+	Network    int      `json:"network"`              // index of the /30 network in 10.254.0.0/16
+	AllowedIPs []string `json:"allowedIPs,omitempty"` // networks of the tunnel last set up
+}
+
+// addresses returns the tunnel addresses of the host and the VM.
+func (s wireGuardState) addresses() (host, guest net.IP) {
+	n := s.Network * 4
+	return net.IPv4(10, 254, byte(n>>8), byte(n)+1), net.IPv4(10, 254, byte(n>>8), byte(n)+2)
+}
+
+// wireGuardStateFile returns the file with the state of the WireGuard tunnel of the profile.
+func wireGuardStateFile(profile string) string {
+	return filepath.Join(profileDaemonDir(profile), "wireguard.json")
+}
+
+// loadWireGuardState returns the state of the WireGuard tunnel of the profile.
+// The keys are generated and the tunnel network allocated on first use.
+func loadWireGuardState(profile string) (wireGuardState, error) {
+	var s wireGuardState
+	if b, err := os.ReadFile(wireGuardStateFile(profile)); err == nil {
+		if err := json.Unmarshal(b, &s); err == nil && s.HostKey != "" && s.GuestKey != "" {
+			return s, nil
+		}
+	}
+
+	var err error
+	if s.HostKey, err = wireGuardKey(); err != nil {
+		return s, err
+	}
+	if s.GuestKey, err = wireGuardKey(); err != nil {
+		return s, err
+	}
+	s.Network = wireGuardNetwork(profile, usedWireGuardNetworks(profile))
+	return s, s.save(profile)
+}
+
+// save persists the state of the WireGuard tunnel of the profile.
+// The file is only readable by the user as it contains the private keys.
+func (s wireGuardState) save(profile string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("error encoding WireGuard state: %w", err)
+	}
+	file := wireGuardStateFile(profile)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("error creating WireGuard state directory: %w", err)
+	}
+	if err := os.WriteFile(file, b, 0600); err != nil {
+		return fmt.Errorf("error saving WireGuard state: %w", err)
+	}
+	return nil
+}
+
+// usedWireGuardNetworks returns the tunnel networks allocated to the profiles other than profile.
+func usedWireGuardNetworks(profile string) map[int]bool {
+	dir := profileDaemonDir(profile)
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(filepath.Dir(dir)), "*", filepath.Base(dir), "wireguard.json"))
+
+	used := map[int]bool{}
+	for _, file := range files {
+		if file == wireGuardStateFile(profile) {
+			continue
+		}
+		var s wireGuardState
+		if b, err := os.ReadFile(file); err == nil && json.Unmarshal(b, &s) == nil {
+			used[s.Network] = true
+		}
+	}
+	return used
+}
+
+// wireGuardNetwork returns the tunnel network for the profile, the first network not in
+// use by other profiles starting from the one derived from the profile name.
+func wireGuardNetwork(profile string, used map[int]bool) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(profile))
+	n := int(h.Sum32() % wireGuardNetworks)
+	for i := 0; i < wireGuardNetworks && used[n]; i++ {
+		n = (n + 1) % wireGuardNetworks
+	}
+	return n
+}
+
+// wireGuardHostInterface returns the name of the WireGuard network interface on Linux hosts.
+// macOS assigns the next available utun interface.
+func wireGuardHostInterface(profile string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(profile))
+	return fmt.Sprintf("wg-%08x", h.Sum32())
+}
+
+// wireGuardNameFile returns the file with the name of the WireGuard network interface of the profile on the host.
+func wireGuardNameFile(profile string) string {
+	return filepath.Join(profileDaemonDir(profile), "wireguard.name")
+}
+
+// wireGuardKey generates a WireGuard private key.
+func wireGuardKey() (string, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("error generating WireGuard key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key.Bytes()), nil
+}
+
+// wireGuardPublicKey returns the public key of the WireGuard private key.
+func wireGuardPublicKey(private string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(private)
+	if err != nil {
+		return "", fmt.Errorf("invalid WireGuard key: %w", err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(b)
+	if err != nil {
+		return "", fmt.Errorf("invalid WireGuard key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// wireGuardDependencies returns an error if the WireGuard tools are not installed on the host.
+// wireguard-go is only required on macOS, Linux hosts use the kernel module.
+func wireGuardDependencies() error {
+	tools := []string{"wg"}
+	if util.MacOS() {
+		tools = append(tools, "wireguard-go")
+	}
+	for _, t := range tools {
+		if _, err := exec.LookPath(t); err != nil {
+			return fmt.Errorf("%s is required for the '%s' pod access mode, install with `brew install wireguard-tools wireguard-go`", t, AccessWireGuard)
+		}
+	}
+	return nil
+}
+
+// wireGuardTunnel is the WireGuard tunnel between the host and the VM.
+type wireGuardTunnel struct {
+	profile    string
+	port       int // listen port of the host, chosen by WireGuard
+	hostIP     net.IP
+	guestIP    net.IP
+	hostKey    string
+	hostPub    string
+	guestKey   string
+	guestPub   string
+	allowedIPs []string // networks reached via the VM
+}
+
+// newWireGuardTunnel returns the WireGuard tunnel of the profile with the persisted state.
+func newWireGuardTunnel(profile string, s wireGuardState) (wireGuardTunnel, error) {
+	t := wireGuardTunnel{profile: profile, hostKey: s.HostKey, guestKey: s.GuestKey}
+	t.hostIP, t.guestIP = s.addresses()
+	var err error
+	if t.hostPub, err = wireGuardPublicKey(s.HostKey); err != nil {
+		return t, err
+	}
+	if t.guestPub, err = wireGuardPublicKey(s.GuestKey); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+// hostConfig returns the WireGuard config of the host.
+// The listen port is chosen by WireGuard to avoid racing for an available port,
+// and the VM endpoint is learnt from the handshakes initiated by the VM.
+func (t wireGuardTunnel) hostConfig() string {
+	allowed := append([]string{t.guestIP.String() + "/32"}, t.allowedIPs...)
+	return fmt.Sprintf("[Interface]\nPrivateKey = %s\n\n[Peer]\nPublicKey = %s\nAllowedIPs = %s\n",
+		t.hostKey, t.guestPub, strings.Join(allowed, ", "))
+}
+
+// guestConfig returns the WireGuard config of the VM.
+// WG_PORT is used for the host port if not known e.g. for dry-runs.
+func (t wireGuardTunnel) guestConfig() string {
+	port := "${WG_PORT:?listen port of the host tunnel}"
+	if t.port > 0 {
+		port = strconv.Itoa(t.port)
+	}
+	return fmt.Sprintf("[Interface]\nPrivateKey = %s\n\n[Peer]\nPublicKey = %s\nEndpoint = %s:%s\nAllowedIPs = %s/32\nPersistentKeepalive = %d\n",
+		t.guestKey, t.hostPub, wireGuardEndpoint, port, t.hostIP, wireGuardKeepalive)
+}
+
+// hostScript returns the shell script to bring up the tunnel on the host,
+// replacing the previous tunnel of the profile, if any.
+// The listen port of the tunnel is printed.
+func (t wireGuardTunnel) hostScript() string {
+	nameFile := wireGuardNameFile(t.profile)
+
+	script := []string{"set -e", wireGuardHostCleanupScript(t.profile)}
+	if util.MacOS() {
+		script = append(script,
+			fmt.Sprintf("WG_TUN_NAME_FILE='%s' wireguard-go utun", nameFile),
+			fmt.Sprintf("iface=$(cat '%s')", nameFile),
+		)
+	} else {
+		script = append(script,
+			"iface="+wireGuardHostInterface(t.profile),
+			`ip link add "$iface" type wireguard 2>/dev/null || WG_I_PREFER_BUGGY_USERSPACE_TO_POLISHED_KMOD=1 wireguard-go "$iface"`,
+			fmt.Sprintf(`echo "$iface" > '%s'`, nameFile),
+		)
+	}
+	script = append(script, `wg setconf "$iface" /dev/stdin <<'EOF'`, strings.TrimSuffix(t.hostConfig(), "\n"), "EOF")
+	if util.MacOS() {
+		script = append(script, fmt.Sprintf(`ifconfig "$iface" inet %s %s netmask 255.255.255.255 up`, t.hostIP, t.guestIP))
+	} else {
+		script = append(script,
+			fmt.Sprintf(`ip addr add %s peer %s dev "$iface"`, t.hostIP, t.guestIP),
+			`ip link set "$iface" up`,
+		)
+	}
+	script = append(script, `wg show "$iface" listen-port`)
+	return strings.Join(script, "\n") + "\n"
+}
+
+// guestScript returns the shell script to bring up the tunnel in the VM,
+// replacing the previous tunnel, if any.
+// The WireGuard kernel module of the VM is used.
+func (t wireGuardTunnel) guestScript() string {
+	iface := wireGuardGuestInterface
+	script := []string{
+		"set -e",
+		"command -v wg >/dev/null || { " + pkgutil.Install("wireguard-tools") + "; } >/dev/null",
+		fmt.Sprintf("ip link del %s 2>/dev/null || true", iface),
+		fmt.Sprintf("ip link add %s type wireguard", iface),
+		fmt.Sprintf("wg setconf %s /dev/stdin <<EOF", iface),
+		strings.TrimSuffix(t.guestConfig(), "\n"),
+		"EOF",
+		fmt.Sprintf("ip addr add %s peer %s dev %s", t.guestIP, t.hostIP, iface),
+		fmt.Sprintf("ip link set %s up", iface),
+	}
+	return strings.Join(script, "\n") + "\n"
+}
+
+// guestUpScript returns the shell script printing "up" if the tunnel in the VM has a recent
+// handshake with the host key i.e. the tunnel is up.
+func (t wireGuardTunnel) guestUpScript() string {
+	return fmt.Sprintf(`wg show %s latest-handshakes 2>/dev/null | awk -v key='%s' -v now="$(date +%%s)" '$1 == key && $2 > 0 && now - $2 < %d { print "up" }'`,
+		wireGuardGuestInterface, t.hostPub, wireGuardKeepalive*5)
+}
+
+// wireGuardHostCleanupScript returns the shell script to remove the tunnel of the profile on the host.
+// The routes via the tunnel are removed along with the network interface.
+func wireGuardHostCleanupScript(profile string) string {
+	nameFile := wireGuardNameFile(profile)
+	remove := `ip link del "$(cat '%[1]s')" 2>/dev/null || true`
+	if util.MacOS() {
+		// wireguard-go exits when its control socket is removed
+		remove = `rm -f "/var/run/wireguard/$(cat '%[1]s').sock"`
+	}
+	return fmt.Sprintf("if [ -f '%[1]s' ]; then "+remove+"; rm -f '%[1]s'; fi", nameFile)
+}
+
+// setupWireGuard brings up the WireGuard tunnel between the host and the VM
+// for the networks, replacing the previous tunnel.
+func (rm *RouteManager) setupWireGuard(ctx context.Context) error {
+	if err := wireGuardDependencies(); err != nil {
+		return err
+	}
+
+	state, err := loadWireGuardState(rm.profile)
+	if err != nil {
+		return err
+	}
+	t, err := newWireGuardTunnel(rm.profile, state)
+	if err != nil {
+		return err
+	}
+	for _, cidr := range rm.cidrs() {
+		// the tunnel only has IPv4 addresses
+		if !isIPv6(cidr) {
+			t.allowedIPs = append(t.allowedIPs, cidr)
+		}
+	}
+
+	if rm.plan != nil {
+		rm.plan.add(Change{Kind: ChangeWireGuard, Action: "up", Target: "host", Content: t.hostScript(), Command: sudoCommand("sh")})
+		rm.plan.add(Change{Kind: ChangeWireGuard, Action: "up", Target: "vm", Content: t.guestScript(),
+			Command: "colima ssh -- sudo WG_PORT=<listen port printed above> sh"})
+		return nil
+	}
+
+	// the tunnel is kept if up for the same networks, avoiding sudo on the host for repairs
+	guest := newGuest(rm.profile)
+	if slices.Equal(state.AllowedIPs, t.allowedIPs) {
+		if _, err := os.Stat(wireGuardNameFile(rm.profile)); err == nil {
+			if out, err := guest.RunOutput("sudo", "sh", "-c", t.guestUpScript()); err == nil && strings.TrimSpace(out) == "up" {
+				log.Debugf("WireGuard tunnel is up for %s", strings.Join(t.allowedIPs, ", "))
+				return nil
+			}
+		}
+	}
+
+	out, err := runHostScript(ctx, t.hostScript())
+	if err != nil {
+		return fmt.Errorf("error setting up WireGuard tunnel on the host: %w", err)
+	}
+	if t.port, err = strconv.Atoi(lastLine(out)); err != nil {
+		return fmt.Errorf("error retrieving WireGuard listen port on the host: %w", err)
+	}
+	if err := guest.RunScript(t.guestScript()); err != nil {
+		return fmt.Errorf("error setting up WireGuard tunnel in the VM: %w", err)
+	}
+
+	state.AllowedIPs = t.allowedIPs
+	if err := state.save(rm.profile); err != nil {
+		log.Warnf("Failed to save WireGuard state: %v", err)
+	}
+
+	log.Infof("WireGuard tunnel configured for %s", strings.Join(t.allowedIPs, ", "))
+	return nil
+}
+
+// lastLine returns the last non-empty line of the output.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// cleanupWireGuard removes the WireGuard tunnel of the profile on the host and in the VM, if running.
+func cleanupWireGuard(ctx context.Context, profile string) error {
+	if plan := planFromContext(ctx); plan != nil {
+		if newGuest(profile).Running(ctx) {
+			plan.add(Change{Kind: ChangeWireGuard, Action: "down", Target: "vm", Command: "colima ssh -- sudo ip link del " + wireGuardGuestInterface})
+		}
+		if _, err := os.Stat(wireGuardNameFile(profile)); err == nil {
+			plan.add(Change{Kind: ChangeWireGuard, Action: "down", Target: "host", Content: wireGuardHostCleanupScript(profile), Command: sudoCommand("sh")})
+		}
+		return nil
+	}
+
+	var errs []error
+	if guest := newGuest(profile); guest.Running(ctx) {
+		if err := guest.RunQuiet("sudo", "ip", "link", "del", wireGuardGuestInterface); err != nil {
+			log.Debugf("error removing WireGuard tunnel in the VM: %v", err)
+		}
+	}
+	if _, err := os.Stat(wireGuardNameFile(profile)); err == nil {
+		if _, err := runHostScript(ctx, wireGuardHostCleanupScript(profile)); err != nil {
+			errs = append(errs, fmt.Errorf("error removing WireGuard tunnel on the host: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runHostScript runs the shell script on the host as root, with sudo if required, and returns the output.
+// The script is piped to the shell to keep its contents out of the process list.
+func runHostScript(ctx context.Context, script string) (string, error) {
+	args := []string{"sh"}
+	if os.Geteuid() != 0 {
+		args = append([]string{"sudo"}, args...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w, output: %s", err, stderr.String())
+	}
+	return stdout.String(), nil
+}
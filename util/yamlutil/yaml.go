@@ -3,6 +3,7 @@ package yamlutil
 import (
 	"bytes"
 	"fmt"
+	"net"
 	"os"
 	"reflect"
 	"strconv"
@@ -36,6 +37,9 @@ func Save(c config.Config, file string) error {
 	return nil
 }
 
+// Encode encodes the config as YAML, with the comments of the default config.
+func Encode(c config.Config) ([]byte, error) { return encodeYAML(c) }
+
 func encodeYAML(conf config.Config) ([]byte, error) {
 	var doc yaml.Node
 
@@ -72,6 +76,8 @@ func encodeYAML(conf config.Config) ([]byte, error) {
 			switch val.(type) {
 			case map[string]any:
 			case map[string]string:
+			case map[string][]net.IP:
+			case map[int]int:
 
 			default:
 				continue
@@ -2,6 +2,8 @@ package yamlutil
 
 import (
 	"net"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -11,9 +13,15 @@ import (
 
 func Test_encode_Docker(t *testing.T) {
 	conf := config.Config{
-		Docker:     map[string]any{"insecure-registries": []any{"127.0.0.1"}},
-		Network:    config.Network{DNSResolvers: []net.IP{net.ParseIP("1.1.1.1")}},
-		Kubernetes: config.Kubernetes{K3sArgs: []string{"--disable=traefik"}},
+		Docker: map[string]any{"insecure-registries": []any{"127.0.0.1"}},
+		Network: config.Network{
+			DNSResolvers: []net.IP{net.ParseIP("1.1.1.1")},
+			DNSDomains:   map[string][]net.IP{"corp.example.com": {net.ParseIP("10.0.0.53")}},
+		},
+		Kubernetes: config.Kubernetes{
+			K3sArgs:      []string{"--disable=traefik"},
+			LoadBalancer: config.KubernetesLoadBalancer{HostPorts: true, HostPortMap: map[int]int{80: 8080}},
+		},
 	}
 
 	tests := []struct {
@@ -40,6 +48,77 @@ func Test_encode_Docker(t *testing.T) {
 			if !reflect.DeepEqual(got.Docker, tt.want.Docker) {
 				t.Errorf("save() = %+v\nwant %+v", got.Docker, tt.want.Docker)
 			}
+			if !reflect.DeepEqual(got.Network.DNSDomains, tt.want.Network.DNSDomains) {
+				t.Errorf("save() = %+v\nwant %+v", got.Network.DNSDomains, tt.want.Network.DNSDomains)
+			}
+			if !reflect.DeepEqual(got.Kubernetes.LoadBalancer, tt.want.Kubernetes.LoadBalancer) {
+				t.Errorf("save() = %+v\nwant %+v", got.Kubernetes.LoadBalancer, tt.want.Kubernetes.LoadBalancer)
+			}
 		})
 	}
 }
+
+func Test_Save_KubernetesServer(t *testing.T) {
+	conf := config.Config{
+		Kubernetes: config.Kubernetes{Enabled: true, Nodes: 1, Server: "colima-multi"},
+	}
+
+	got := saveAndLoad(t, conf)
+	if got.Kubernetes.Server != conf.Kubernetes.Server {
+		t.Errorf("Save() server = %q, want %q", got.Kubernetes.Server, conf.Kubernetes.Server)
+	}
+}
+
+func Test_Save_Proxy(t *testing.T) {
+	conf := config.Config{
+		Proxy: config.Proxy{
+			HTTP:    "http://proxy.example.com:3128",
+			HTTPS:   "http://proxy.example.com:3129",
+			NoProxy: []string{".example.com", "10.0.0.0/8"},
+			System:  true,
+		},
+	}
+
+	got := saveAndLoad(t, conf)
+	if !reflect.DeepEqual(got.Proxy, conf.Proxy) {
+		t.Errorf("Save() proxy = %+v\nwant %+v", got.Proxy, conf.Proxy)
+	}
+
+	// unset values are kept unset
+	got = saveAndLoad(t, config.Config{})
+	if p := got.Proxy; p.HTTP != "" || p.HTTPS != "" || len(p.NoProxy) > 0 || p.System {
+		t.Errorf("Save() proxy = %+v, want unset", p)
+	}
+}
+
+// saveAndLoad saves the config to a file and loads it back.
+func saveAndLoad(t *testing.T, conf config.Config) config.Config {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "colima.yaml")
+	if err := Save(conf, file); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got config.Config
+	if err := yaml.Unmarshal(b, &got); err != nil {
+		t.Fatalf("saved config is not valid yaml: %v", err)
+	}
+	return got
+}
+
+func Test_Save_VMOpts(t *testing.T) {
+	conf := config.Config{
+		VMOpts: config.VMOpts{
+			QEMU: config.QEMUOpts{Args: []string{"-device", "virtio-rng-pci"}},
+			VZ:   map[string]any{"diskImageFormat": "asif", "rosetta": map[string]any{"enabled": true}},
+		},
+	}
+
+	got := saveAndLoad(t, conf)
+	if !reflect.DeepEqual(got.VMOpts, conf.VMOpts) {
+		t.Errorf("Save() vmOpts = %+v\nwant %+v", got.VMOpts, conf.VMOpts)
+	}
+}